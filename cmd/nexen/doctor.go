@@ -0,0 +1,280 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/nexen/config"
+	"github.com/nexen/libs/redisx"
+)
+
+// defaultProviderEndpoints are used when a configured provider has no endpoint set.
+var defaultProviderEndpoints = map[string]string{
+	"openai":    "https://api.openai.com/v1",
+	"anthropic": "https://api.anthropic.com/v1",
+	"google":    "https://generativelanguage.googleapis.com/v1",
+	"mistral":   "https://api.mistral.ai/v1",
+}
+
+// checkStatus is the outcome of a single doctor check.
+type checkStatus string
+
+const (
+	statusPass checkStatus = "PASS"
+	statusFail checkStatus = "FAIL"
+	statusSkip checkStatus = "SKIP"
+)
+
+// checkResult is one line of the doctor report.
+type checkResult struct {
+	Name   string
+	Status checkStatus
+	Detail string
+}
+
+// doctorOptions controls which checks run and their limits.
+type doctorOptions struct {
+	VerifyKeys bool
+	Timeout    time.Duration
+	MaxSkew    time.Duration
+}
+
+// runDoctor parses flags, runs every check, prints the report, and returns the exit code.
+func runDoctor(args []string) int {
+	fs := flag.NewFlagSet("doctor", flag.ContinueOnError)
+	verifyKeys := fs.Bool("verify-keys", false, "Verify provider API keys with a cheap authenticated call")
+	timeout := fs.Duration("timeout", 5*time.Second, "Timeout for each network check")
+	maxSkew := fs.Duration("max-skew", 30*time.Second, "Maximum tolerated clock skew against provider servers")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	opts := doctorOptions{VerifyKeys: *verifyKeys, Timeout: *timeout, MaxSkew: *maxSkew}
+	results := runChecks(context.Background(), opts)
+	return printReport(os.Stdout, results)
+}
+
+// runChecks loads configuration and runs all checks against it.
+func runChecks(ctx context.Context, opts doctorOptions) []checkResult {
+	cfg, err := config.New()
+	if err != nil {
+		return []checkResult{{Name: "config", Status: statusFail, Detail: err.Error()}}
+	}
+
+	var results []checkResult
+	if err := cfg.Validate(); err != nil {
+		results = append(results, checkResult{Name: "config", Status: statusFail, Detail: err.Error()})
+	} else {
+		results = append(results, checkResult{Name: "config", Status: statusPass, Detail: "configuration is valid"})
+	}
+
+	results = append(results, checkRedis(ctx, cfg.Redis, opts.Timeout))
+
+	providers := make([]string, 0, len(cfg.Providers))
+	for name := range cfg.Providers {
+		providers = append(providers, name)
+	}
+	sort.Strings(providers)
+
+	if len(providers) == 0 {
+		results = append(results, checkResult{Name: "providers", Status: statusSkip, Detail: "no providers configured"})
+	}
+	for _, name := range providers {
+		endpoint := providerEndpoint(name, cfg.Providers[name])
+		results = append(results, checkDNS(ctx, name, endpoint, opts.Timeout))
+		if opts.VerifyKeys {
+			results = append(results, checkAPIKey(ctx, name, endpoint, cfg.Providers[name].APIKey, opts.Timeout))
+		}
+	}
+	if !opts.VerifyKeys {
+		results = append(results, checkResult{Name: "api keys", Status: statusSkip, Detail: "pass -verify-keys to enable"})
+	}
+
+	results = append(results, checkClockSkew(ctx, clockReference(cfg), opts.Timeout, opts.MaxSkew))
+	return results
+}
+
+// printReport writes the results and returns 1 if any check failed.
+func printReport(w io.Writer, results []checkResult) int {
+	failed := 0
+	for _, r := range results {
+		fmt.Fprintf(w, "[%s] %-24s %s\n", r.Status, r.Name, r.Detail)
+		if r.Status == statusFail {
+			failed++
+		}
+	}
+	if failed > 0 {
+		fmt.Fprintf(w, "\n%d check(s) failed\n", failed)
+		return 1
+	}
+	fmt.Fprintln(w, "\nAll checks passed")
+	return 0
+}
+
+// providerEndpoint returns the configured endpoint, falling back to the provider default.
+func providerEndpoint(name string, p config.ProviderConfig) string {
+	if p.Endpoint != "" {
+		return p.Endpoint
+	}
+	return defaultProviderEndpoints[strings.ToLower(name)]
+}
+
+// checkRedis pings Redis through a libs/redisx client, so the check connects the way the
+// services do: in the configured mode, over TLS and as the configured user.
+func checkRedis(ctx context.Context, cfg config.RedisConfig, timeout time.Duration) checkResult {
+	result := checkResult{Name: "redis"}
+
+	client, err := redisx.New(cfg)
+	if err != nil {
+		result.Status, result.Detail = statusFail, fmt.Sprintf("invalid configuration: %v", err)
+		return result
+	}
+	defer client.Close()
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	if err := client.Check(ctx); err != nil {
+		result.Status, result.Detail = statusFail, err.Error()
+		return result
+	}
+
+	result.Status, result.Detail = statusPass, fmt.Sprintf("PING %s ok", strings.Join(cfg.Nodes(), ","))
+	return result
+}
+
+// checkDNS resolves the host of a provider endpoint.
+func checkDNS(ctx context.Context, provider, endpoint string, timeout time.Duration) checkResult {
+	result := checkResult{Name: "dns " + provider}
+	if endpoint == "" {
+		result.Status, result.Detail = statusFail, "no endpoint configured and no default known"
+		return result
+	}
+	u, err := url.Parse(endpoint)
+	if err != nil || u.Hostname() == "" {
+		result.Status, result.Detail = statusFail, fmt.Sprintf("invalid endpoint %q", endpoint)
+		return result
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	addrs, err := net.DefaultResolver.LookupHost(ctx, u.Hostname())
+	if err != nil {
+		result.Status, result.Detail = statusFail, err.Error()
+		return result
+	}
+	result.Status, result.Detail = statusPass, fmt.Sprintf("%s -> %s", u.Hostname(), strings.Join(addrs, ", "))
+	return result
+}
+
+// checkAPIKey lists models on the provider, which is free and proves the key is accepted.
+func checkAPIKey(ctx context.Context, provider, endpoint, apiKey string, timeout time.Duration) checkResult {
+	result := checkResult{Name: "api key " + provider}
+	if apiKey == "" {
+		result.Status, result.Detail = statusSkip, "no API key configured"
+		return result
+	}
+	if endpoint == "" {
+		result.Status, result.Detail = statusFail, "no endpoint configured and no default known"
+		return result
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimRight(endpoint, "/")+"/models", nil)
+	if err != nil {
+		result.Status, result.Detail = statusFail, err.Error()
+		return result
+	}
+	switch strings.ToLower(provider) {
+	case "anthropic":
+		req.Header.Set("x-api-key", apiKey)
+		req.Header.Set("anthropic-version", "2023-06-01")
+	case "google":
+		q := req.URL.Query()
+		q.Set("key", apiKey)
+		req.URL.RawQuery = q.Encode()
+	default:
+		req.Header.Set("Authorization", "Bearer "+apiKey)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		result.Status, result.Detail = statusFail, err.Error()
+		return result
+	}
+	resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusOK:
+		result.Status, result.Detail = statusPass, "key accepted"
+	case resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden:
+		result.Status, result.Detail = statusFail, fmt.Sprintf("key rejected (%s)", resp.Status)
+	default:
+		result.Status, result.Detail = statusFail, fmt.Sprintf("unexpected response %s", resp.Status)
+	}
+	return result
+}
+
+// clockReference picks an HTTPS endpoint whose Date header is used for the clock check.
+func clockReference(cfg *config.Config) string {
+	names := make([]string, 0, len(cfg.Providers))
+	for name := range cfg.Providers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if endpoint := providerEndpoint(name, cfg.Providers[name]); endpoint != "" {
+			return endpoint
+		}
+	}
+	return defaultProviderEndpoints["openai"]
+}
+
+// checkClockSkew compares the local clock with the Date header returned by endpoint.
+func checkClockSkew(ctx context.Context, endpoint string, timeout, maxSkew time.Duration) checkResult {
+	result := checkResult{Name: "clock skew"}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, endpoint, nil)
+	if err != nil {
+		result.Status, result.Detail = statusFail, err.Error()
+		return result
+	}
+
+	start := time.Now()
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		result.Status, result.Detail = statusFail, err.Error()
+		return result
+	}
+	resp.Body.Close()
+	// Assume the server stamped the Date header halfway through the round trip.
+	local := start.Add(time.Since(start) / 2)
+
+	remote, err := http.ParseTime(resp.Header.Get("Date"))
+	if err != nil {
+		result.Status, result.Detail = statusSkip, "no usable Date header from "+endpoint
+		return result
+	}
+
+	skew := local.Sub(remote)
+	if skew < 0 {
+		skew = -skew
+	}
+	if skew > maxSkew {
+		result.Status, result.Detail = statusFail, fmt.Sprintf("local clock is off by %v (max %v)", skew.Round(time.Second), maxSkew)
+		return result
+	}
+	result.Status, result.Detail = statusPass, fmt.Sprintf("within %v of %s", skew.Round(time.Second), req.URL.Host)
+	return result
+}
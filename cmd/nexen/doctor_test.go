@@ -0,0 +1,160 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/nexen/config"
+)
+
+// fakeRedis serves RESP on a local port. It records each command and answers PING with
+// pong, HELLO as an unknown command (so clients fall back to AUTH) and anything else with +OK.
+func fakeRedis(t *testing.T, pong string) (string, *commandLog) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	log := &commandLog{}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go serveFakeRedis(conn, pong, log)
+		}
+	}()
+	return ln.Addr().String(), log
+}
+
+// commandLog records the commands a fakeRedis received.
+type commandLog struct {
+	mu       sync.Mutex
+	commands []string
+}
+
+func (l *commandLog) add(command string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.commands = append(l.commands, command)
+}
+
+func (l *commandLog) contains(command string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, c := range l.commands {
+		if strings.EqualFold(c, command) {
+			return true
+		}
+	}
+	return false
+}
+
+func serveFakeRedis(conn net.Conn, pong string, log *commandLog) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	for {
+		// Each command is "*N" followed by N length/value pairs.
+		header, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		var n int
+		if _, err := fmt.Sscanf(header, "*%d", &n); err != nil {
+			return
+		}
+		args := make([]string, n)
+		for i := range args {
+			if _, err := r.ReadString('\n'); err != nil {
+				return
+			}
+			arg, err := r.ReadString('\n')
+			if err != nil {
+				return
+			}
+			args[i] = strings.TrimRight(arg, "\r\n")
+		}
+		log.add(strings.Join(args, " "))
+
+		reply := "+OK"
+		switch strings.ToUpper(args[0]) {
+		case "PING":
+			reply = pong
+		case "HELLO":
+			reply = "-ERR unknown command 'HELLO'"
+		}
+		conn.Write([]byte(reply + "\r\n"))
+	}
+}
+
+func TestCheckRedis(t *testing.T) {
+	addr, _ := fakeRedis(t, "+PONG")
+	result := checkRedis(context.Background(), config.RedisConfig{Address: addr}, time.Second)
+	if result.Status != statusPass {
+		t.Fatalf("expected PASS, got %s: %s", result.Status, result.Detail)
+	}
+
+	addr, _ = fakeRedis(t, "-NOAUTH Authentication required.")
+	result = checkRedis(context.Background(), config.RedisConfig{Address: addr}, time.Second)
+	if result.Status != statusFail {
+		t.Fatalf("expected FAIL, got %s", result.Status)
+	}
+
+	result = checkRedis(context.Background(), config.RedisConfig{Address: addr, Mode: config.RedisModeSentinel}, time.Second)
+	if result.Status != statusFail || !strings.Contains(result.Detail, "invalid configuration") {
+		t.Errorf("expected FAIL for sentinel mode without a master name, got %s: %s", result.Status, result.Detail)
+	}
+}
+
+func TestCheckRedisAuthenticatesAsUser(t *testing.T) {
+	addr, log := fakeRedis(t, "+PONG")
+	cfg := config.RedisConfig{Address: addr, Username: "nexen", Password: "secret"}
+	if result := checkRedis(context.Background(), cfg, time.Second); result.Status != statusPass {
+		t.Fatalf("expected PASS, got %s: %s", result.Status, result.Detail)
+	}
+	if !log.contains("AUTH nexen secret") {
+		t.Errorf("expected AUTH with the ACL user, got %v", log.commands)
+	}
+}
+
+func TestCheckClockSkew(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Date", time.Now().Add(-2*time.Minute).UTC().Format(http.TimeFormat))
+	}))
+	defer srv.Close()
+
+	result := checkClockSkew(context.Background(), srv.URL, time.Second, 30*time.Second)
+	if result.Status != statusFail {
+		t.Fatalf("expected FAIL for 2m skew, got %s: %s", result.Status, result.Detail)
+	}
+
+	result = checkClockSkew(context.Background(), srv.URL, time.Second, 5*time.Minute)
+	if result.Status != statusPass {
+		t.Fatalf("expected PASS within 5m, got %s: %s", result.Status, result.Detail)
+	}
+}
+
+func TestPrintReport(t *testing.T) {
+	var buf bytes.Buffer
+	code := printReport(&buf, []checkResult{
+		{Name: "config", Status: statusPass, Detail: "ok"},
+		{Name: "redis", Status: statusFail, Detail: "down"},
+	})
+	if code != 1 {
+		t.Errorf("expected exit code 1, got %d", code)
+	}
+	if !strings.Contains(buf.String(), "[FAIL] redis") {
+		t.Errorf("report missing failed check:\n%s", buf.String())
+	}
+}
@@ -0,0 +1,33 @@
+// Command nexen provides operational tooling for a Nexen deployment.
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+const usage = `Usage: nexen <command> [flags]
+
+Commands:
+  doctor    Run startup self-checks and print a pass/fail report
+  trace     Print the timeline of a request from logs, spans and request dumps
+`
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	switch os.Args[1] {
+	case "doctor":
+		os.Exit(runDoctor(os.Args[2:]))
+	case "trace":
+		os.Exit(runTrace(os.Args[2:]))
+	case "help", "-h", "--help":
+		fmt.Print(usage)
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\n%s", os.Args[1], usage)
+		os.Exit(2)
+	}
+}
@@ -0,0 +1,314 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// spanRequestIDAttribute is the span attribute holding the request ID, as set by the
+// connectors' Trace middleware.
+const spanRequestIDAttribute = "nexen.request.id"
+
+// Kinds of timeline events.
+const (
+	eventCall     = "call"
+	eventRequest  = "request"
+	eventRetry    = "retry"
+	eventCache    = "cache"
+	eventSpan     = "span"
+	eventLog      = "log"
+	eventResponse = "response"
+	eventPrompt   = "prompt"
+)
+
+// traceEvent is one line of the timeline of a request.
+type traceEvent struct {
+	Time   time.Time
+	Kind   string
+	Detail string
+}
+
+// traceUsage is the usage of the calls a request made, from its call log entries.
+type traceUsage struct {
+	Calls            int
+	Failed           int
+	PromptTokens     int64
+	CompletionTokens int64
+	CostCents        float64
+}
+
+// traceSources are where the records of a request are read from.
+type traceSources struct {
+	Logs  []string // JSON log files, such as the output of calllog.SlogSink
+	Spans []string // JSON lines span exports
+	Dumps string   // request dump directory, see common.WithRequestDump
+}
+
+// stringList is a flag that can be given several times.
+type stringList []string
+
+func (l *stringList) String() string { return strings.Join(*l, ",") }
+
+func (l *stringList) Set(v string) error {
+	*l = append(*l, v)
+	return nil
+}
+
+// runTrace parses flags, collects the records of a request and prints its timeline.
+func runTrace(args []string) int {
+	fs := flag.NewFlagSet("trace", flag.ContinueOnError)
+	var sources traceSources
+	fs.Var((*stringList)(&sources.Logs), "log", "JSON log file to search; may be repeated")
+	fs.Var((*stringList)(&sources.Spans), "spans", "JSON lines span export to search; may be repeated")
+	fs.StringVar(&sources.Dumps, "dumps", "", "Provider request dump directory")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() != 1 {
+		fmt.Fprintln(os.Stderr, "Usage: nexen trace [-log file]... [-spans file]... [-dumps dir] <request-id>")
+		return 2
+	}
+
+	events, usage, err := collectTrace(fs.Arg(0), sources)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return printTrace(os.Stdout, fs.Arg(0), events, usage)
+}
+
+// collectTrace reads every record of requestID from sources, sorted by time.
+func collectTrace(requestID string, sources traceSources) ([]traceEvent, traceUsage, error) {
+	var events []traceEvent
+	var usage traceUsage
+	for _, path := range sources.Logs {
+		err := scanJSONLines(path, func(record map[string]any) {
+			if recordRequestID(record) == requestID {
+				events = append(events, logEvents(record, &usage)...)
+			}
+		})
+		if err != nil {
+			return nil, usage, err
+		}
+	}
+	for _, path := range sources.Spans {
+		err := scanJSONLines(path, func(record map[string]any) {
+			if event, ok := spanEvent(record, requestID); ok {
+				events = append(events, event)
+			}
+		})
+		if err != nil {
+			return nil, usage, err
+		}
+	}
+	if sources.Dumps != "" {
+		dumps, err := dumpEvents(sources.Dumps, requestID)
+		if err != nil {
+			return nil, usage, err
+		}
+		events = append(events, dumps...)
+	}
+	sort.SliceStable(events, func(i, j int) bool { return events[i].Time.Before(events[j].Time) })
+	return events, usage, nil
+}
+
+// scanJSONLines calls fn with each JSON object line of the file at path. Other lines, such as
+// plain text log output, are skipped.
+func scanJSONLines(path string, fn func(record map[string]any)) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		var record map[string]any
+		if json.Unmarshal(scanner.Bytes(), &record) == nil {
+			fn(record)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("reading %s: %w", path, err)
+	}
+	return nil
+}
+
+// recordRequestID returns the request ID of a log record written by log/slog or zerolog.
+func recordRequestID(record map[string]any) string {
+	for _, key := range []string{"request_id", "requestId"} {
+		if id, ok := record[key].(string); ok {
+			return id
+		}
+	}
+	return ""
+}
+
+// logEvents returns the timeline events of a log record. Call log entries add to usage and
+// include the transcript when the log has it.
+func logEvents(record map[string]any, usage *traceUsage) []traceEvent {
+	at := recordTime(record, "time")
+	msg := stringField(record, "msg")
+	if msg == "" {
+		msg = stringField(record, "message")
+	}
+
+	switch {
+	case msg == "llm call" || msg == "llm call failed":
+		usage.Calls++
+		detail := fmt.Sprintf("%s (%s) %sms", stringField(record, "model"), stringField(record, "provider"), numberText(record["latency_ms"]))
+		if class := stringField(record, "error_class"); class != "" {
+			usage.Failed++
+			detail += " failed: " + class
+			if message := stringField(record, "error"); message != "" {
+				detail += ": " + message
+			}
+		} else {
+			prompt, completion, cost := number(record["prompt_tokens"]), number(record["completion_tokens"]), number(record["cost_cents"])
+			usage.PromptTokens += int64(prompt)
+			usage.CompletionTokens += int64(completion)
+			usage.CostCents += cost
+			detail += fmt.Sprintf(", %d prompt + %d completion tokens, %.4f cents", int64(prompt), int64(completion), cost)
+		}
+		events := []traceEvent{{Time: at, Kind: eventCall, Detail: detail}}
+		if prompt := stringField(record, "prompt"); prompt != "" {
+			events = append(events, traceEvent{Time: at, Kind: eventPrompt, Detail: prompt})
+		}
+		if response := stringField(record, "response"); response != "" {
+			events = append(events, traceEvent{Time: at, Kind: eventResponse, Detail: response})
+		}
+		return events
+	case strings.Contains(strings.ToLower(msg), "retry"):
+		return []traceEvent{{Time: at, Kind: eventRetry, Detail: msg + attributeText(record)}}
+	case strings.Contains(strings.ToLower(msg), "cache"):
+		return []traceEvent{{Time: at, Kind: eventCache, Detail: msg + attributeText(record)}}
+	}
+	return []traceEvent{{Time: at, Kind: eventLog, Detail: msg + attributeText(record)}}
+}
+
+// spanEvent returns the event of an exported span of requestID. Spans are objects with a
+// name, startTime, endTime and attributes.
+func spanEvent(record map[string]any, requestID string) (traceEvent, bool) {
+	attributes, _ := record["attributes"].(map[string]any)
+	if id, _ := attributes[spanRequestIDAttribute].(string); id != requestID {
+		return traceEvent{}, false
+	}
+	start, end := recordTime(record, "startTime"), recordTime(record, "endTime")
+	detail := stringField(record, "name")
+	if !start.IsZero() && !end.IsZero() {
+		detail += fmt.Sprintf(" %dms", end.Sub(start).Milliseconds())
+	}
+	if status := stringField(record, "status"); status != "" {
+		detail += " " + status
+	}
+	return traceEvent{Time: start, Kind: eventSpan, Detail: detail}, true
+}
+
+// dumpEvents returns the provider requests dumped for requestID, named <id>.json and
+// <id>-<n>.json; later ones are retries or follow-up calls.
+func dumpEvents(dir, requestID string) ([]traceEvent, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, requestID+"*.json"))
+	if err != nil {
+		return nil, err
+	}
+	var events []traceEvent
+	for _, path := range paths {
+		suffix := strings.TrimSuffix(strings.TrimPrefix(filepath.Base(path), requestID), ".json")
+		kind := eventRequest
+		if suffix != "" {
+			if _, err := strconv.Atoi(strings.TrimPrefix(suffix, "-")); !strings.HasPrefix(suffix, "-") || err != nil {
+				continue // the dump of another request whose ID starts with requestID
+			}
+			kind = eventRetry
+		}
+
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		var dump struct {
+			Method string `json:"method"`
+			URL    string `json:"url"`
+		}
+		if err := json.Unmarshal(data, &dump); err != nil {
+			return nil, fmt.Errorf("reading %s: %w", path, err)
+		}
+		events = append(events, traceEvent{Time: info.ModTime(), Kind: kind, Detail: fmt.Sprintf("%s %s (%s)", dump.Method, dump.URL, filepath.Base(path))})
+	}
+	return events, nil
+}
+
+// printTrace writes the timeline of requestID with times relative to its first event, and
+// returns 1 when nothing was found.
+func printTrace(w io.Writer, requestID string, events []traceEvent, usage traceUsage) int {
+	if len(events) == 0 {
+		fmt.Fprintf(w, "No records found for request %s\n", requestID)
+		return 1
+	}
+
+	fmt.Fprintf(w, "Request %s\n\n", requestID)
+	start := events[0].Time
+	for _, e := range events {
+		offset := "        "
+		if !e.Time.IsZero() && !start.IsZero() {
+			offset = fmt.Sprintf("%+7.3fs", e.Time.Sub(start).Seconds())
+		}
+		fmt.Fprintf(w, "%s  %-8s  %s\n", offset, e.Kind, e.Detail)
+	}
+	fmt.Fprintf(w, "\nUsage: %d call(s), %d failed, %d prompt + %d completion tokens, %.4f cents\n",
+		usage.Calls, usage.Failed, usage.PromptTokens, usage.CompletionTokens, usage.CostCents)
+	return 0
+}
+
+// recordTime parses the RFC 3339 time in record[key], or returns the zero time.
+func recordTime(record map[string]any, key string) time.Time {
+	t, _ := time.Parse(time.RFC3339Nano, stringField(record, key))
+	return t
+}
+
+func stringField(record map[string]any, key string) string {
+	s, _ := record[key].(string)
+	return s
+}
+
+// number returns v as a float64, or 0 when it is not a JSON number.
+func number(v any) float64 {
+	f, _ := v.(float64)
+	return f
+}
+
+func numberText(v any) string {
+	return strconv.FormatFloat(number(v), 'f', -1, 64)
+}
+
+// attributeText formats the attributes of a log record that are not already shown.
+func attributeText(record map[string]any) string {
+	keys := make([]string, 0, len(record))
+	for key := range record {
+		switch key {
+		case "time", "level", "msg", "message", "request_id", "requestId":
+			continue
+		}
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	var sb strings.Builder
+	for _, key := range keys {
+		fmt.Fprintf(&sb, " %s=%v", key, record[key])
+	}
+	return sb.String()
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCollectTrace(t *testing.T) {
+	dir := t.TempDir()
+	logs := filepath.Join(dir, "gateway.log")
+	writeFile(t, logs, strings.Join([]string{
+		`{"time":"2026-10-16T10:00:00Z","level":"INFO","msg":"cache miss","request_id":"req-1","key":"abc"}`,
+		`{"time":"2026-10-16T10:00:01Z","level":"ERROR","msg":"llm call failed","request_id":"req-1","model":"gpt-4o","provider":"openai","latency_ms":300,"error_class":"rate_limited"}`,
+		`{"time":"2026-10-16T10:00:02Z","level":"WARN","msg":"retrying call","request_id":"req-1","attempt":2}`,
+		`{"time":"2026-10-16T10:00:03Z","level":"INFO","msg":"llm call","request_id":"req-1","model":"gpt-4o","provider":"openai","latency_ms":250,"prompt_tokens":12,"completion_tokens":30,"cost_cents":0.05,"prompt":"Hi","response":"Hello"}`,
+		`{"time":"2026-10-16T10:00:03Z","level":"INFO","msg":"llm call","request_id":"req-2","model":"gpt-4o","prompt_tokens":99}`,
+		`plain text line`,
+	}, "\n"))
+
+	spans := filepath.Join(dir, "spans.jsonl")
+	writeFile(t, spans, `{"name":"llm.call","startTime":"2026-10-16T10:00:00.500Z","endTime":"2026-10-16T10:00:03.250Z","attributes":{"nexen.request.id":"req-1"}}`+"\n")
+
+	dumps := filepath.Join(dir, "dumps")
+	os.Mkdir(dumps, 0o755)
+	writeFile(t, filepath.Join(dumps, "req-1.json"), `{"method":"POST","url":"https://api.openai.com/v1/chat/completions"}`)
+	writeFile(t, filepath.Join(dumps, "req-1-1.json"), `{"method":"POST","url":"https://api.openai.com/v1/chat/completions"}`)
+	writeFile(t, filepath.Join(dumps, "req-10.json"), `{"method":"POST","url":"https://other"}`)
+	base := time.Date(2026, 10, 16, 10, 0, 0, 0, time.UTC)
+	os.Chtimes(filepath.Join(dumps, "req-1.json"), base, base.Add(900*time.Millisecond))
+	os.Chtimes(filepath.Join(dumps, "req-1-1.json"), base, base.Add(2500*time.Millisecond))
+
+	events, usage, err := collectTrace("req-1", traceSources{Logs: []string{logs}, Spans: []string{spans}, Dumps: dumps})
+	if err != nil {
+		t.Fatalf("collectTrace failed: %v", err)
+	}
+	var kinds []string
+	for _, e := range events {
+		kinds = append(kinds, e.Kind)
+	}
+	want := "cache span request call retry retry call prompt response"
+	if got := strings.Join(kinds, " "); got != want {
+		t.Errorf("Expected events %q, got %q", want, got)
+	}
+	if usage.Calls != 2 || usage.Failed != 1 || usage.PromptTokens != 12 || usage.CompletionTokens != 30 || usage.CostCents != 0.05 {
+		t.Errorf("Unexpected usage %+v", usage)
+	}
+
+	var out bytes.Buffer
+	if code := printTrace(&out, "req-1", events, usage); code != 0 {
+		t.Errorf("Expected exit code 0, got %d", code)
+	}
+	for _, want := range []string{"Request req-1", "+0.000s  cache", "+3.000s  call", "rate_limited", "2 call(s), 1 failed"} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("Expected %q in the timeline:\n%s", want, out.String())
+		}
+	}
+}
+
+func TestPrintTraceNotFound(t *testing.T) {
+	var out bytes.Buffer
+	if code := printTrace(&out, "missing", nil, traceUsage{}); code != 1 {
+		t.Errorf("Expected exit code 1, got %d", code)
+	}
+}
@@ -2,19 +2,64 @@
 package config
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
+	"net"
+	"net/url"
+	"path"
 	"strings"
 	"time"
 
 	"github.com/spf13/viper"
 )
 
+// Redis deployment modes for RedisConfig.Mode.
+const (
+	RedisModeStandalone = "standalone"
+	RedisModeCluster    = "cluster"
+	RedisModeSentinel   = "sentinel"
+)
+
 // RedisConfig holds connection settings for Redis.
 type RedisConfig struct {
 	Address  string        `mapstructure:"address"`
 	DB       int           `mapstructure:"db"`
 	Timeout  time.Duration `mapstructure:"timeout"` // in seconds
+	Username string        `mapstructure:"username"`
 	Password string        `mapstructure:"password"`
+
+	// Mode is standalone (default), cluster, or sentinel.
+	Mode string `mapstructure:"mode"`
+	// Addresses lists cluster or sentinel seed nodes; Address is used when empty.
+	Addresses []string `mapstructure:"addresses"`
+	// MasterName is the sentinel master set name.
+	MasterName string `mapstructure:"master_name"`
+
+	PoolSize     int            `mapstructure:"pool_size"` // 0 uses the client default
+	MinIdleConns int            `mapstructure:"min_idle_conns"`
+	TLS          RedisTLSConfig `mapstructure:"tls"`
+}
+
+// RedisTLSConfig holds TLS settings for Redis connections.
+type RedisTLSConfig struct {
+	Enabled            bool   `mapstructure:"enabled"`
+	CAFile             string `mapstructure:"ca_file"`
+	CertFile           string `mapstructure:"cert_file"`
+	KeyFile            string `mapstructure:"key_file"`
+	ServerName         string `mapstructure:"server_name"`
+	InsecureSkipVerify bool   `mapstructure:"insecure_skip_verify"`
+}
+
+// Nodes returns the addresses to connect to: Addresses if set, otherwise Address.
+func (r RedisConfig) Nodes() []string {
+	if len(r.Addresses) > 0 {
+		return r.Addresses
+	}
+	if r.Address == "" {
+		return nil
+	}
+	return []string{r.Address}
 }
 
 // ServerConfig holds HTTP server settings.
@@ -53,22 +98,728 @@ type ModelSelectionConfig struct {
 type GatewayConfig struct {
 	EnableGRPC        bool          `mapstructure:"enable_grpc"`
 	EnableREST        bool          `mapstructure:"enable_rest"`
+	GRPCPort          int           `mapstructure:"grpc_port"`
 	CacheTTL          time.Duration `mapstructure:"cache_ttl"`
 	RequestTimeout    time.Duration `mapstructure:"request_timeout"`
 	RateLimitRequests int           `mapstructure:"rate_limit_requests"`
 	RateLimitPeriod   time.Duration `mapstructure:"rate_limit_period"`
+
+	// RouteTimeouts overrides RequestTimeout for individual endpoints, keyed by path, such as
+	// "/v1/llm/batch".
+	RouteTimeouts map[string]time.Duration `mapstructure:"route_timeouts"`
+	// ShutdownTimeout bounds how long the gateway waits for requests in flight when it stops.
+	ShutdownTimeout time.Duration `mapstructure:"shutdown_timeout"`
+	// StreamHeartbeat is how often a streamed response is sent a keep-alive comment, so that
+	// proxies do not close it while the model is silent. Zero disables heartbeats.
+	StreamHeartbeat time.Duration `mapstructure:"stream_heartbeat"`
+	// PingInterval is how often the providers are pinged in the background, so that routing
+	// avoids those refusing their credentials or out of reach before calls fail. Zero disables
+	// background pings.
+	PingInterval time.Duration `mapstructure:"ping_interval"`
+
+	// Profiles are named sets of request defaults that routes can build on.
+	Profiles map[string]RequestDefaults `mapstructure:"profiles"`
+	// Routes maps a route name to its request defaults.
+	Routes map[string]RequestDefaults `mapstructure:"routes"`
+
+	// KeyPolicies maps API key names, in lower case, to the limits of the requests made with
+	// them. The DefaultKeyPolicy entry applies to keys without their own.
+	KeyPolicies map[string]KeyPolicy `mapstructure:"key_policies"`
+
+	// OutputBudget caps the max_tokens derived for requests that set none, from the model's
+	// context window less the prompt. Zero uses the connectors' default.
+	OutputBudget int `mapstructure:"output_budget"`
+
+	// Auth sets the API keys that callers of the gateway authenticate with.
+	Auth AuthConfig `mapstructure:"auth"`
+
+	// Audit sets the audit trail of the gateway's LLM calls.
+	Audit AuditConfig `mapstructure:"audit"`
+
+	// Queue holds requests back while their provider is busy or rate limited.
+	Queue QueueConfig `mapstructure:"queue"`
+
+	// Priority sets the priority of requests that set none, and the models batch requests
+	// are sent to.
+	Priority PriorityConfig `mapstructure:"priority"`
+
+	// Jobs runs requests submitted to /v1/jobs in the background.
+	Jobs JobsConfig `mapstructure:"jobs"`
+
+	// Worker consumes requests from a message queue and publishes their responses.
+	Worker WorkerConfig `mapstructure:"worker"`
+}
+
+// PriorityConfig sets how the gateway treats the priority of requests, "interactive" or
+// "batch": the default rule and those of individual tenants.
+type PriorityConfig struct {
+	PriorityRule `mapstructure:",squash"`
+	// Tenants maps tenants, in lower case, to their rules.
+	Tenants map[string]PriorityRule `mapstructure:"tenants"`
+}
+
+// PriorityRule sets the priority of requests and where batch requests go.
+type PriorityRule struct {
+	// Default is the priority of requests that set none and are not sent to a batch endpoint,
+	// which makes them batch. Empty means "interactive".
+	Default string `mapstructure:"default"`
+	// Max is the highest priority requests may ask for: "batch" lowers every request to batch.
+	// Empty allows "interactive".
+	Max string `mapstructure:"max"`
+	// BatchModels maps models to the cheaper or slower models that batch requests for them are
+	// sent to instead.
+	BatchModels map[string]string `mapstructure:"batch_models"`
+}
+
+// PriorityFor returns the priority rule of tenant: its Tenants entry, with the fields it leaves
+// unset taken from the default rule.
+func (p PriorityConfig) PriorityFor(tenant string) PriorityRule {
+	rule := p.PriorityRule
+	t, ok := p.Tenants[strings.ToLower(tenant)]
+	if !ok {
+		return rule
+	}
+	if t.Default != "" {
+		rule.Default = t.Default
+	}
+	if t.Max != "" {
+		rule.Max = t.Max
+	}
+	if t.BatchModels != nil {
+		rule.BatchModels = t.BatchModels
+	}
+	return rule
+}
+
+// QueueConfig sets how requests wait for a provider that is at its concurrency cap or has
+// answered with a rate-limit error, instead of failing at once.
+type QueueConfig struct {
+	// Enabled queues the requests of every provider.
+	Enabled bool `mapstructure:"enabled"`
+	// MaxConcurrent caps the requests in flight to each provider; zero is unlimited, so that
+	// requests only wait out the provider's rate limit.
+	MaxConcurrent int `mapstructure:"max_concurrent"`
+	// ProviderMaxConcurrent overrides MaxConcurrent for individual providers.
+	ProviderMaxConcurrent map[string]int `mapstructure:"provider_max_concurrent"`
+	// MaxDepth is the number of requests that may wait for each provider. Requests beyond it
+	// are refused with a 503.
+	MaxDepth int `mapstructure:"max_depth"`
+	// MaxWait bounds how long a request waits in the queue, in all; it also stops waiting at
+	// its deadline.
+	MaxWait time.Duration `mapstructure:"max_wait"`
+}
+
+// MaxConcurrentFor returns the cap on the requests in flight to provider.
+func (q QueueConfig) MaxConcurrentFor(provider string) int {
+	if n, ok := q.ProviderMaxConcurrent[provider]; ok {
+		return n
+	}
+	return q.MaxConcurrent
+}
+
+// JobsConfig sets the asynchronous jobs of the gateway: requests submitted to run in the
+// background, whose results are kept in Redis and can be polled or sent to a webhook.
+type JobsConfig struct {
+	// Enabled serves /v1/jobs and runs the jobs submitted to it.
+	Enabled bool `mapstructure:"enabled"`
+	// TTL is how long a job and its result are kept after the job last changed.
+	TTL time.Duration `mapstructure:"ttl"`
+	// Timeout bounds each attempt of a job. A job whose replica stopped while running it is
+	// run again once it has been running for longer.
+	Timeout time.Duration `mapstructure:"timeout"`
+	// PollInterval is how often each replica looks for jobs to run.
+	PollInterval time.Duration `mapstructure:"poll_interval"`
+	// Concurrency is the number of jobs each replica runs at once.
+	Concurrency int `mapstructure:"concurrency"`
+	// MaxAttempts is how many times a job is tried when its provider rate limits it or is
+	// unavailable.
+	MaxAttempts int `mapstructure:"max_attempts"`
+	// WebhookSecret signs the webhooks sent to the callback URIs of jobs; empty sends them
+	// unsigned.
+	WebhookSecret string `mapstructure:"webhook_secret"`
+	// WebhookTimeout bounds each webhook delivery.
+	WebhookTimeout time.Duration `mapstructure:"webhook_timeout"`
+}
+
+// Message queues of the gateway's worker for WorkerConfig.Transport.
+const (
+	WorkerTransportRedis = "redis"
+	WorkerTransportKafka = "kafka"
+)
+
+// WorkerConfig sets the worker of the gateway, which consumes LLM requests from a message queue
+// and publishes their responses to another, for offline pipelines.
+type WorkerConfig struct {
+	// Enabled runs the worker.
+	Enabled bool `mapstructure:"enabled"`
+	// Transport is the message queue: WorkerTransportRedis, for Redis streams, or
+	// WorkerTransportKafka.
+	Transport string `mapstructure:"transport"`
+	// Requests and Replies are the streams, or topics, requests are consumed from and their
+	// replies published to.
+	Requests string `mapstructure:"requests"`
+	Replies  string `mapstructure:"replies"`
+	// Group is the consumer group the replicas share the requests in.
+	Group string `mapstructure:"group"`
+	// Consumer names the replica in the group of a Redis stream; empty uses the host name.
+	Consumer string `mapstructure:"consumer"`
+	// Brokers are the Kafka brokers of the kafka transport.
+	Brokers []string `mapstructure:"brokers"`
+	// RepliesMaxLen trims the Redis stream of replies to about this many; zero keeps them all.
+	RepliesMaxLen int64 `mapstructure:"replies_max_len"`
+	// Concurrency is the number of requests each replica runs at once.
+	Concurrency int `mapstructure:"concurrency"`
+	// RequestsPerMinute and TokensPerMinute cap the throughput of each replica; zero is
+	// unlimited.
+	RequestsPerMinute int `mapstructure:"requests_per_minute"`
+	TokensPerMinute   int `mapstructure:"tokens_per_minute"`
+	// Timeout bounds each request.
+	Timeout time.Duration `mapstructure:"timeout"`
+	// ClaimIdle is how long a request of a Redis stream stays with a consumer that has not
+	// acknowledged it before another replica takes it over. It should exceed Timeout.
+	ClaimIdle time.Duration `mapstructure:"claim_idle"`
+}
+
+// Sinks of audit records for AuditConfig.Sink.
+const (
+	AuditSinkFile  = "file"
+	AuditSinkRedis = "redis"
+	AuditSinkKafka = "kafka"
+)
+
+// AuditConfig sets where the gateway records who called which model, with what usage, cost,
+// latency and outcome.
+type AuditConfig struct {
+	// Enabled records every LLM call the gateway makes.
+	Enabled bool `mapstructure:"enabled"`
+	// Sink is where records go: AuditSinkFile, AuditSinkRedis or AuditSinkKafka.
+	Sink string `mapstructure:"sink"`
+	// Path is the file records are appended to, one JSON object per line, with the file sink.
+	Path string `mapstructure:"path"`
+	// Stream is the Redis stream records are added to with the redis sink.
+	Stream string `mapstructure:"stream"`
+	// StreamMaxLen trims the stream to about this many records; zero keeps every record.
+	StreamMaxLen int64 `mapstructure:"stream_max_len"`
+	// Brokers and Topic are the Kafka brokers and topic records are produced to with the
+	// kafka sink.
+	Brokers []string `mapstructure:"brokers"`
+	Topic   string   `mapstructure:"topic"`
+	// Content selects how prompts and responses are recorded: "omit", "hash", "truncate" or
+	// "full".
+	Content string `mapstructure:"content"`
+	// MaxContentLength is the number of characters "truncate" keeps; zero uses the call
+	// log's default.
+	MaxContentLength int `mapstructure:"max_content_length"`
+}
+
+// Stores of API keys for AuthConfig.Store.
+const (
+	KeyStoreStatic = "static"
+	KeyStoreRedis  = "redis"
+)
+
+// AuthConfig sets the API keys that callers of the gateway authenticate with.
+type AuthConfig struct {
+	// Enabled requires an API key, as "Authorization: Bearer <key>", on every request.
+	Enabled bool `mapstructure:"enabled"`
+	// Store is where keys are kept: KeyStoreStatic for the Keys of the configuration only,
+	// or KeyStoreRedis to also keep the keys created through the admin API in Redis.
+	Store string `mapstructure:"store"`
+	// Keys are valid with either store, and cannot be revoked at runtime.
+	Keys []APIKeyConfig `mapstructure:"keys"`
+	// AdminToken is the bearer token of the key admin API; empty rejects all admin requests.
+	AdminToken string `mapstructure:"admin_token"`
+	// OIDC accepts the JWTs of an OpenID Connect issuer as bearer tokens, as an alternative
+	// to API keys.
+	OIDC OIDCConfig `mapstructure:"oidc"`
+}
+
+// OIDCConfig sets the OpenID Connect issuer whose JWTs authenticate callers of the gateway.
+type OIDCConfig struct {
+	// Issuer is the issuer URL that tokens must name in their "iss" claim. Empty disables
+	// tokens.
+	Issuer string `mapstructure:"issuer"`
+	// Audience is the value tokens must hold in their "aud" claim.
+	Audience string `mapstructure:"audience"`
+	// JWKSURL is where the issuer's signing keys are published. Empty discovers it from the
+	// issuer's /.well-known/openid-configuration.
+	JWKSURL string `mapstructure:"jwks_url"`
+	// JWKSCacheTTL is how long the signing keys are cached; zero means an hour. Tokens signed
+	// with an unknown key refresh them sooner.
+	JWKSCacheTTL time.Duration `mapstructure:"jwks_cache_ttl"`
+	// TenantClaim and UserClaim name the claims that requests are attributed to.
+	TenantClaim string `mapstructure:"tenant_claim"`
+	UserClaim   string `mapstructure:"user_claim"`
+}
+
+// APIKeyConfig is an API key of the configuration. Only its hash is configured, so the
+// configuration holds no usable key.
+type APIKeyConfig struct {
+	// Name identifies the key. Its limits are those of the KeyPolicies entry of that name.
+	Name string `mapstructure:"name"`
+	// Hash is the hex-encoded SHA-256 of the key.
+	Hash string `mapstructure:"hash"`
+	// TenantID attributes the requests made with the key to a tenant.
+	TenantID string `mapstructure:"tenant_id"`
+}
+
+// TimeoutFor returns the timeout of requests to the endpoint at path: its RouteTimeouts entry,
+// or RequestTimeout.
+func (g GatewayConfig) TimeoutFor(path string) time.Duration {
+	if timeout, ok := g.RouteTimeouts[path]; ok {
+		return timeout
+	}
+	return g.RequestTimeout
+}
+
+// DefaultKeyPolicy names the key policy of API keys without their own.
+const DefaultKeyPolicy = "default"
+
+// KeyPolicy limits the requests made with one API key. Zero values mean unlimited.
+type KeyPolicy struct {
+	RequestsPerMinute int `mapstructure:"requests_per_minute"`
+	TokensPerMinute   int `mapstructure:"tokens_per_minute"`
+	// AllowedModels lists the models the key may use, as names or path.Match patterns such as
+	// "gpt-4o*"; empty allows every model.
+	AllowedModels []string `mapstructure:"allowed_models"`
+	// MaxTokensPerRequest caps the completion tokens a request may ask for.
+	MaxTokensPerRequest int `mapstructure:"max_tokens_per_request"`
+	// BatchPercent is the share, in percent, of the per-minute limits that requests of
+	// priority batch may use; zero lets them use all of it.
+	BatchPercent int `mapstructure:"batch_percent"`
+}
+
+// PolicyFor returns the policy of the API key, or the default policy, and whether either is
+// configured.
+func (g GatewayConfig) PolicyFor(key string) (KeyPolicy, bool) {
+	if p, ok := g.KeyPolicies[strings.ToLower(key)]; ok {
+		return p, true
+	}
+	p, ok := g.KeyPolicies[DefaultKeyPolicy]
+	return p, ok
+}
+
+// validate returns the problems of the auth settings.
+func (a AuthConfig) validate() []string {
+	var problems []string
+	switch a.Store {
+	case "", KeyStoreStatic, KeyStoreRedis:
+	default:
+		problems = append(problems, fmt.Sprintf("gateway.auth.store %q is not static or redis", a.Store))
+	}
+	seen := make(map[string]bool, len(a.Keys))
+	for i, k := range a.Keys {
+		if k.Name == "" || seen[k.Name] {
+			problems = append(problems, fmt.Sprintf("gateway.auth.keys[%d].name %q is empty or repeated", i, k.Name))
+		}
+		seen[k.Name] = true
+		if b, err := hex.DecodeString(k.Hash); err != nil || len(b) != sha256.Size {
+			problems = append(problems, fmt.Sprintf("gateway.auth.keys[%d].hash is not a hex SHA-256", i))
+		}
+	}
+	if o := a.OIDC; o.Issuer != "" {
+		for name, value := range map[string]string{"issuer": o.Issuer, "jwks_url": o.JWKSURL} {
+			if u, err := url.Parse(value); value != "" && (err != nil || u.Scheme == "" || u.Host == "") {
+				problems = append(problems, fmt.Sprintf("gateway.auth.oidc.%s %q is not an absolute URL", name, value))
+			}
+		}
+		if o.Audience == "" {
+			problems = append(problems, "gateway.auth.oidc.audience is required with an issuer")
+		}
+		if o.JWKSCacheTTL < 0 {
+			problems = append(problems, "gateway.auth.oidc.jwks_cache_ttl must not be negative")
+		}
+	}
+	return problems
+}
+
+// validate returns the problems of the audit settings.
+func (a AuditConfig) validate() []string {
+	if !a.Enabled {
+		return nil
+	}
+	var problems []string
+	switch a.Sink {
+	case AuditSinkFile:
+		if a.Path == "" {
+			problems = append(problems, "gateway.audit.path is required with the file sink")
+		}
+	case AuditSinkRedis:
+		if a.Stream == "" {
+			problems = append(problems, "gateway.audit.stream is required with the redis sink")
+		}
+	case AuditSinkKafka:
+		if len(a.Brokers) == 0 || a.Topic == "" {
+			problems = append(problems, "gateway.audit.brokers and gateway.audit.topic are required with the kafka sink")
+		}
+	default:
+		problems = append(problems, fmt.Sprintf("gateway.audit.sink %q is not file, redis or kafka", a.Sink))
+	}
+	if a.StreamMaxLen < 0 {
+		problems = append(problems, "gateway.audit.stream_max_len must not be negative")
+	}
+	switch a.Content {
+	case "", "omit", "hash", "truncate", "full":
+	default:
+		problems = append(problems, fmt.Sprintf("gateway.audit.content %q is not omit, hash, truncate or full", a.Content))
+	}
+	if a.MaxContentLength < 0 {
+		problems = append(problems, "gateway.audit.max_content_length must not be negative")
+	}
+	return problems
+}
+
+// validate returns the problems of the priority rule at path.
+func (r PriorityRule) validate(path string) []string {
+	var problems []string
+	for name, value := range map[string]string{"default": r.Default, "max": r.Max} {
+		switch value {
+		case "", "interactive", "batch":
+		default:
+			problems = append(problems, fmt.Sprintf("%s.%s %q is not interactive or batch", path, name, value))
+		}
+	}
+	for model, batch := range r.BatchModels {
+		if batch == "" {
+			problems = append(problems, fmt.Sprintf("%s.batch_models.%s model is required", path, model))
+		}
+	}
+	return problems
+}
+
+// validate returns the problems of the queue settings.
+func (q QueueConfig) validate() []string {
+	if !q.Enabled {
+		return nil
+	}
+	var problems []string
+	if q.MaxConcurrent < 0 {
+		problems = append(problems, "gateway.queue.max_concurrent must not be negative")
+	}
+	for provider, n := range q.ProviderMaxConcurrent {
+		if n < 0 {
+			problems = append(problems, fmt.Sprintf("gateway.queue.provider_max_concurrent.%s must not be negative", provider))
+		}
+	}
+	if q.MaxDepth <= 0 {
+		problems = append(problems, "gateway.queue.max_depth must be positive")
+	}
+	if q.MaxWait <= 0 {
+		problems = append(problems, "gateway.queue.max_wait must be positive")
+	}
+	return problems
+}
+
+func (j JobsConfig) validate() []string {
+	if !j.Enabled {
+		return nil
+	}
+	var problems []string
+	if j.TTL <= 0 {
+		problems = append(problems, "gateway.jobs.ttl must be positive")
+	}
+	if j.Timeout <= 0 {
+		problems = append(problems, "gateway.jobs.timeout must be positive")
+	}
+	if j.PollInterval <= 0 {
+		problems = append(problems, "gateway.jobs.poll_interval must be positive")
+	}
+	if j.Concurrency <= 0 {
+		problems = append(problems, "gateway.jobs.concurrency must be positive")
+	}
+	if j.MaxAttempts <= 0 {
+		problems = append(problems, "gateway.jobs.max_attempts must be positive")
+	}
+	if j.WebhookTimeout <= 0 {
+		problems = append(problems, "gateway.jobs.webhook_timeout must be positive")
+	}
+	return problems
+}
+
+func (w WorkerConfig) validate() []string {
+	if !w.Enabled {
+		return nil
+	}
+	var problems []string
+	switch w.Transport {
+	case WorkerTransportRedis:
+	case WorkerTransportKafka:
+		if len(w.Brokers) == 0 {
+			problems = append(problems, "gateway.worker.brokers is required with the kafka transport")
+		}
+	default:
+		problems = append(problems, fmt.Sprintf("gateway.worker.transport %q is not redis or kafka", w.Transport))
+	}
+	if w.Requests == "" || w.Replies == "" || w.Group == "" {
+		problems = append(problems, "gateway.worker.requests, replies and group are required")
+	}
+	if w.RepliesMaxLen < 0 {
+		problems = append(problems, "gateway.worker.replies_max_len must not be negative")
+	}
+	if w.Concurrency <= 0 {
+		problems = append(problems, "gateway.worker.concurrency must be positive")
+	}
+	if w.RequestsPerMinute < 0 || w.TokensPerMinute < 0 {
+		problems = append(problems, "gateway.worker rate limits must not be negative")
+	}
+	if w.Timeout <= 0 {
+		problems = append(problems, "gateway.worker.timeout must be positive")
+	}
+	if w.ClaimIdle <= 0 {
+		problems = append(problems, "gateway.worker.claim_idle must be positive")
+	}
+	return problems
+}
+
+// RequestDefaults holds generation settings applied to requests that leave them unset.
+// Zero values mean "no default".
+type RequestDefaults struct {
+	// Profile names the profile a route starts from; its own fields take precedence.
+	// It is ignored on profiles.
+	Profile string `mapstructure:"profile"`
+
+	Temperature       float64  `mapstructure:"temperature"`
+	TopP              float64  `mapstructure:"top_p"`
+	MaxTokens         int      `mapstructure:"max_tokens"`
+	SystemInstruction string   `mapstructure:"system_instruction"`
+	StopSequences     []string `mapstructure:"stop_sequences"`
+}
+
+// DefaultsFor returns the request defaults for route: the route's profile overlaid with the
+// route's own settings. An unknown route is looked up as a profile, so callers can also
+// select a profile directly.
+func (g GatewayConfig) DefaultsFor(route string) RequestDefaults {
+	r, ok := g.Routes[route]
+	if !ok {
+		p := g.Profiles[route]
+		p.Profile = ""
+		return p
+	}
+
+	d := g.Profiles[r.Profile]
+	d.Profile = r.Profile
+	if r.Temperature != 0 {
+		d.Temperature = r.Temperature
+	}
+	if r.TopP != 0 {
+		d.TopP = r.TopP
+	}
+	if r.MaxTokens != 0 {
+		d.MaxTokens = r.MaxTokens
+	}
+	if r.SystemInstruction != "" {
+		d.SystemInstruction = r.SystemInstruction
+	}
+	if len(r.StopSequences) > 0 {
+		d.StopSequences = r.StopSequences
+	}
+	return d
+}
+
+// ProviderConfig holds connection settings for a single LLM provider.
+type ProviderConfig struct {
+	Endpoint string `mapstructure:"endpoint"`
+	APIKey   string `mapstructure:"api_key"`
+	Timeout  int    `mapstructure:"timeout"` // seconds
+
+	// Client-side limits per API key; 0 means unlimited
+	RequestsPerMinute int `mapstructure:"requests_per_minute"`
+	TokensPerMinute   int `mapstructure:"tokens_per_minute"`
+
+	// ServiceTier is the provider service tier requests are sent with: "auto", "default",
+	// "flex" or "priority". Requests can override it. Empty uses the provider's default.
+	ServiceTier string `mapstructure:"service_tier"`
+}
+
+// PolicyConfig holds organization-wide rules applied to every LLM request.
+type PolicyConfig struct {
+	// SystemPreamble is placed before every request's system instruction.
+	SystemPreamble string `mapstructure:"system_preamble"`
+	// TenantPreambles replaces SystemPreamble for the listed tenants.
+	TenantPreambles map[string]string `mapstructure:"tenant_preambles"`
+}
+
+// FlagConfig is the default state of a feature flag. Flag state stored in Redis overrides it.
+type FlagConfig struct {
+	// Rollout is the percentage of tenants, 0 to 100, the flag is enabled for.
+	Rollout int `mapstructure:"rollout"`
+	// Tenants turns the flag on or off for individual tenants regardless of Rollout.
+	Tenants map[string]bool `mapstructure:"tenants"`
+}
+
+// ProfileConfig selects the model serving a capability profile such as "chat" or "code".
+type ProfileConfig struct {
+	// DefaultModel is the model ID used for the profile.
+	DefaultModel string `mapstructure:"default_model"`
+}
+
+// DeploymentsConfig spreads a model's requests over equivalent deployments, such as two Azure
+// deployments and the provider's own API.
+type DeploymentsConfig struct {
+	// Policy is "weighted_round_robin" (the default) or "least_outstanding".
+	Policy    string             `mapstructure:"policy"`
+	Endpoints []DeploymentConfig `mapstructure:"endpoints"`
+}
+
+// DeploymentConfig is one deployment of a model. An empty endpoint or API key keeps the
+// provider's.
+type DeploymentConfig struct {
+	Name     string `mapstructure:"name"`
+	Endpoint string `mapstructure:"endpoint"`
+	APIKey   string `mapstructure:"api_key"`
+	// Weight is the deployment's share of requests relative to the others; 0 means 1.
+	Weight int `mapstructure:"weight"`
+}
+
+// ShadowConfig mirrors a fraction of requests to a second model for offline comparison.
+type ShadowConfig struct {
+	// Model is the shadow model. Empty turns shadow mode off.
+	Model string `mapstructure:"model"`
+	// Fraction is the share of requests, from 0 to 1, mirrored to Model.
+	Fraction float64 `mapstructure:"fraction"`
+	// TTL is how long the stored request and responses are kept.
+	TTL time.Duration `mapstructure:"ttl"`
+}
+
+// BudgetConfig caps a tenant's LLM spend. A cap of 0 is unlimited.
+type BudgetConfig struct {
+	DailyCents   float64 `mapstructure:"daily_cents"`
+	MonthlyCents float64 `mapstructure:"monthly_cents"`
+	// SoftLimitPercent is the percentage of a cap at which warnings are sent; 0 means 80.
+	SoftLimitPercent int `mapstructure:"soft_limit_percent"`
+	// DowngradeModel serves the tenant's requests once a cap is reached instead of rejecting them.
+	DowngradeModel string `mapstructure:"downgrade_model"`
+	// WebhookURL receives the tenant's soft and hard limit alerts.
+	WebhookURL string `mapstructure:"webhook_url"`
+}
+
+// ModelCatalogConfig sets where the models registry is loaded from.
+type ModelCatalogConfig struct {
+	// Builtin registers the models compiled into the models package, with models.Init.
+	Builtin bool `mapstructure:"builtin"`
+	// Files are JSON or YAML catalogs registered in order with models.LoadFromFile, after the
+	// built-in models. An entry replaces the earlier registrations under its patterns.
+	Files []string `mapstructure:"files"`
+}
+
+// ModelAccessConfig restricts the models clients may be created for. Entries are model names
+// or path.Match patterns such as "gpt-4*". A model must pass the top-level rule, the rule of
+// the current environment and, for a tenant's requests, the tenant's rule.
+type ModelAccessConfig struct {
+	ModelAccessRule `mapstructure:",squash"`
+	// Environments maps environment names, such as production, to their rules.
+	Environments map[string]ModelAccessRule `mapstructure:"environments"`
+	// Tenants maps tenants, in lower case, to their rules.
+	Tenants map[string]ModelAccessRule `mapstructure:"tenants"`
+}
+
+// ModelAccessRule is a model allowlist and denylist. An empty Allow allows every model that is
+// not denied.
+type ModelAccessRule struct {
+	Allow []string `mapstructure:"allow"`
+	Deny  []string `mapstructure:"deny"`
+}
+
+// Rules returns the rules every model must pass in environment: the top-level rule and the
+// environment's.
+func (c ModelAccessConfig) Rules(environment string) []ModelAccessRule {
+	rules := []ModelAccessRule{c.ModelAccessRule}
+	if r, ok := c.Environments[strings.ToLower(environment)]; ok {
+		rules = append(rules, r)
+	}
+	return rules
+}
+
+// CurrencyConfig sets the organization's billing currency. Costs are priced in US dollars and
+// also reported in the billing currency at the configured or fetched exchange rates.
+type CurrencyConfig struct {
+	// Billing is the ISO 4217 code of the billing currency, such as EUR.
+	Billing string `mapstructure:"billing"`
+	// Rates maps currency codes to their units per US dollar. Fetched rates take precedence.
+	Rates map[string]float64 `mapstructure:"rates"`
+	// RatesURL serves exchange rates as JSON: {"rates": {"EUR": 0.92, ...}} per US dollar.
+	RatesURL string `mapstructure:"rates_url"`
+	// RefreshInterval is how long fetched rates are used before fetching them again.
+	RefreshInterval time.Duration `mapstructure:"refresh_interval"`
+}
+
+// Rate returns the configured units of code per US dollar, or 0 when none is set. Codes are
+// matched in any case, since configuration keys are read in lower case.
+func (c CurrencyConfig) Rate(code string) float64 {
+	for k, rate := range c.Rates {
+		if strings.EqualFold(k, code) {
+			return rate
+		}
+	}
+	return 0
+}
+
+// isCurrencyCode reports whether code looks like an ISO 4217 code: three letters.
+func isCurrencyCode(code string) bool {
+	if len(code) != 3 {
+		return false
+	}
+	for _, r := range code {
+		if (r < 'A' || r > 'Z') && (r < 'a' || r > 'z') {
+			return false
+		}
+	}
+	return true
+}
+
+// RetentionConfig sets how long stored state is kept. The retention janitor of libs/store
+// periodically deletes the keys under each rule's prefix that have not been written for
+// longer than the rule's max age.
+type RetentionConfig struct {
+	// Interval is the time between cleanup runs.
+	Interval time.Duration `mapstructure:"interval"`
+	// DryRun counts the keys that would be deleted without deleting them.
+	DryRun bool `mapstructure:"dry_run"`
+
+	Sessions RetentionRule `mapstructure:"sessions"`
+	Jobs     RetentionRule `mapstructure:"jobs"`
+	Cache    RetentionRule `mapstructure:"cache"`
+	Usage    RetentionRule `mapstructure:"usage"`
+}
+
+// RetentionRule is the retention of the keys under one prefix. A MaxAge of 0 keeps them.
+type RetentionRule struct {
+	Prefix string        `mapstructure:"prefix"`
+	MaxAge time.Duration `mapstructure:"max_age"`
+}
+
+// Rules returns the rules by name: "sessions", "jobs", "cache" and "usage".
+func (r RetentionConfig) Rules() map[string]RetentionRule {
+	return map[string]RetentionRule{
+		"sessions": r.Sessions,
+		"jobs":     r.Jobs,
+		"cache":    r.Cache,
+		"usage":    r.Usage,
+	}
 }
 
 // Config is your application's root configuration.
 type Config struct {
-	Server         ServerConfig         `mapstructure:"server"`
-	Logging        LoggingConfig        `mapstructure:"logging"`
-	Redis          RedisConfig          `mapstructure:"redis"`
-	Telemetry      TelemetryConfig      `mapstructure:"telemetry"`
-	ModelSelection ModelSelectionConfig `mapstructure:"model_selection"`
-	Gateway        GatewayConfig        `mapstructure:"gateway"`
-	ServiceName    string               `mapstructure:"service_name"`
-	Environment    string               `mapstructure:"environment"`
+	Server         ServerConfig                 `mapstructure:"server"`
+	Logging        LoggingConfig                `mapstructure:"logging"`
+	Redis          RedisConfig                  `mapstructure:"redis"`
+	Telemetry      TelemetryConfig              `mapstructure:"telemetry"`
+	ModelSelection ModelSelectionConfig         `mapstructure:"model_selection"`
+	Gateway        GatewayConfig                `mapstructure:"gateway"`
+	Providers      map[string]ProviderConfig    `mapstructure:"providers"`
+	Policy         PolicyConfig                 `mapstructure:"policy"`
+	Flags          map[string]FlagConfig        `mapstructure:"flags"`
+	Profiles       map[string]ProfileConfig     `mapstructure:"profiles"`
+	ModelAliases   map[string]string            `mapstructure:"model_aliases"`
+	ModelCatalog   ModelCatalogConfig           `mapstructure:"model_catalog"`
+	ModelAccess    ModelAccessConfig            `mapstructure:"model_access"`
+	Deployments    map[string]DeploymentsConfig `mapstructure:"deployments"`
+	Shadow         ShadowConfig                 `mapstructure:"shadow"`
+	Budgets        map[string]BudgetConfig      `mapstructure:"budgets"`
+	Currency       CurrencyConfig               `mapstructure:"currency"`
+	Retention      RetentionConfig              `mapstructure:"retention"`
+	ServiceName    string                       `mapstructure:"service_name"`
+	Environment    string                       `mapstructure:"environment"`
 }
 
 // New reads configuration from nexen.json + ENV vars and returns a Config.
@@ -98,22 +849,94 @@ func New() (*Config, error) {
 	v.SetDefault("redis.db", 0)
 	v.SetDefault("redis.timeout", 5)
 	v.SetDefault("redis.password", "")
+	v.SetDefault("redis.username", "")
+	v.SetDefault("redis.mode", RedisModeStandalone)
+	v.SetDefault("redis.addresses", []string{})
+	v.SetDefault("redis.master_name", "")
+	v.SetDefault("redis.pool_size", 0)
+	v.SetDefault("redis.min_idle_conns", 0)
+	v.SetDefault("redis.tls.enabled", false)
+	v.SetDefault("redis.tls.ca_file", "")
+	v.SetDefault("redis.tls.cert_file", "")
+	v.SetDefault("redis.tls.key_file", "")
+	v.SetDefault("redis.tls.server_name", "")
+	v.SetDefault("redis.tls.insecure_skip_verify", false)
 
 	v.SetDefault("telemetry.enabled", false)
 	v.SetDefault("telemetry.collector_addr", "localhost:4317")
 
 	v.SetDefault("gateway.enable_grpc", true)
 	v.SetDefault("gateway.enable_rest", true)
+	v.SetDefault("gateway.grpc_port", 9090)
 	v.SetDefault("gateway.cache_ttl", "3600s")
 	v.SetDefault("gateway.request_timeout", "30s")
 	v.SetDefault("gateway.rate_limit_requests", 100)
 	v.SetDefault("gateway.rate_limit_period", "1m")
+	v.SetDefault("gateway.shutdown_timeout", "30s")
+	v.SetDefault("gateway.stream_heartbeat", "15s")
+	v.SetDefault("gateway.auth.enabled", false)
+	v.SetDefault("gateway.auth.store", KeyStoreStatic)
+	v.SetDefault("gateway.auth.admin_token", "")
+	v.SetDefault("gateway.auth.oidc.issuer", "")
+	v.SetDefault("gateway.auth.oidc.audience", "")
+	v.SetDefault("gateway.auth.oidc.jwks_url", "")
+	v.SetDefault("gateway.auth.oidc.jwks_cache_ttl", "1h")
+	v.SetDefault("gateway.auth.oidc.tenant_claim", "tenant_id")
+	v.SetDefault("gateway.auth.oidc.user_claim", "sub")
+	v.SetDefault("gateway.audit.enabled", false)
+	v.SetDefault("gateway.audit.sink", AuditSinkFile)
+	v.SetDefault("gateway.audit.path", "audit.log")
+	v.SetDefault("gateway.audit.stream", "nexen:audit")
+	v.SetDefault("gateway.audit.stream_max_len", 0)
+	v.SetDefault("gateway.audit.brokers", []string{})
+	v.SetDefault("gateway.audit.topic", "nexen-audit")
+	v.SetDefault("gateway.audit.content", "omit")
+	v.SetDefault("gateway.audit.max_content_length", 0)
+	v.SetDefault("gateway.queue.enabled", false)
+	v.SetDefault("gateway.queue.max_concurrent", 0)
+	v.SetDefault("gateway.queue.max_depth", 100)
+	v.SetDefault("gateway.queue.max_wait", "10s")
+	v.SetDefault("gateway.jobs.enabled", false)
+	v.SetDefault("gateway.jobs.ttl", "24h")
+	v.SetDefault("gateway.jobs.timeout", "10m")
+	v.SetDefault("gateway.jobs.poll_interval", "1s")
+	v.SetDefault("gateway.jobs.concurrency", 4)
+	v.SetDefault("gateway.jobs.max_attempts", 5)
+	v.SetDefault("gateway.jobs.webhook_secret", "")
+	v.SetDefault("gateway.jobs.webhook_timeout", "10s")
+	v.SetDefault("gateway.worker.enabled", false)
+	v.SetDefault("gateway.worker.transport", WorkerTransportRedis)
+	v.SetDefault("gateway.worker.requests", "nexen-requests")
+	v.SetDefault("gateway.worker.replies", "nexen-replies")
+	v.SetDefault("gateway.worker.group", "nexen-worker")
+	v.SetDefault("gateway.worker.consumer", "")
+	v.SetDefault("gateway.worker.brokers", []string{})
+	v.SetDefault("gateway.worker.replies_max_len", 0)
+	v.SetDefault("gateway.worker.concurrency", 8)
+	v.SetDefault("gateway.worker.requests_per_minute", 0)
+	v.SetDefault("gateway.worker.tokens_per_minute", 0)
+	v.SetDefault("gateway.worker.timeout", "5m")
+	v.SetDefault("gateway.worker.claim_idle", "10m")
 
 	v.SetDefault("model_selection.strategy", "balanced")
 	v.SetDefault("model_selection.max_cost_per_request", 0.05)
 	v.SetDefault("model_selection.max_latency_ms", 5000)
 	v.SetDefault("model_selection.model_selection_port", 8081)
 
+	v.SetDefault("model_catalog.builtin", true)
+
+	v.SetDefault("currency.billing", "USD")
+	v.SetDefault("currency.refresh_interval", "1h")
+
+	v.SetDefault("retention.interval", "1h")
+	v.SetDefault("retention.dry_run", false)
+	v.SetDefault("retention.sessions.prefix", "session:")
+	v.SetDefault("retention.jobs.prefix", "deferred:job:")
+	v.SetDefault("retention.cache.prefix", "llmcache:")
+	v.SetDefault("retention.usage.prefix", "usage:")
+
+	v.SetDefault("shadow.ttl", "168h")
+
 	v.SetDefault("environment", "development")
 
 	if err := v.ReadInConfig(); err != nil {
@@ -161,3 +984,267 @@ func LoadServiceConfig(serviceName string) (*Config, error) {
 
 	return cfg, nil
 }
+
+// Validate checks the configuration for values that would prevent a service from starting.
+func (c *Config) Validate() error {
+	var problems []string
+
+	if c.Server.Port <= 0 || c.Server.Port > 65535 {
+		problems = append(problems, fmt.Sprintf("server.port %d is out of range", c.Server.Port))
+	}
+	if len(c.Redis.Nodes()) == 0 {
+		problems = append(problems, "redis.address is required")
+	}
+	for _, addr := range c.Redis.Nodes() {
+		if _, _, err := net.SplitHostPort(addr); err != nil {
+			problems = append(problems, fmt.Sprintf("redis.address %q is not host:port", addr))
+		}
+	}
+	if c.Redis.DB < 0 {
+		problems = append(problems, "redis.db must not be negative")
+	}
+	switch c.Redis.Mode {
+	case "", RedisModeStandalone, RedisModeCluster:
+	case RedisModeSentinel:
+		if c.Redis.MasterName == "" {
+			problems = append(problems, "redis.master_name is required in sentinel mode")
+		}
+	default:
+		problems = append(problems, fmt.Sprintf("redis.mode %q is not standalone, cluster, or sentinel", c.Redis.Mode))
+	}
+	if c.Redis.PoolSize < 0 || c.Redis.MinIdleConns < 0 {
+		problems = append(problems, "redis pool sizes must not be negative")
+	}
+	if (c.Redis.TLS.CertFile == "") != (c.Redis.TLS.KeyFile == "") {
+		problems = append(problems, "redis.tls.cert_file and redis.tls.key_file must be set together")
+	}
+	if !validLogLevel(c.Logging.Level) {
+		problems = append(problems, fmt.Sprintf("logging.level %q is not a known level", c.Logging.Level))
+	}
+	if c.Gateway.EnableGRPC && (c.Gateway.GRPCPort <= 0 || c.Gateway.GRPCPort > 65535) {
+		problems = append(problems, fmt.Sprintf("gateway.grpc_port %d is out of range", c.Gateway.GRPCPort))
+	}
+	if c.Gateway.RateLimitRequests < 0 {
+		problems = append(problems, "gateway.rate_limit_requests must not be negative")
+	}
+	for path, timeout := range c.Gateway.RouteTimeouts {
+		if timeout <= 0 {
+			problems = append(problems, fmt.Sprintf("gateway.route_timeouts.%s must be positive", path))
+		}
+	}
+	if c.Gateway.ShutdownTimeout < 0 {
+		problems = append(problems, "gateway.shutdown_timeout must not be negative")
+	}
+	if c.Gateway.StreamHeartbeat < 0 {
+		problems = append(problems, "gateway.stream_heartbeat must not be negative")
+	}
+	if c.Gateway.PingInterval < 0 {
+		problems = append(problems, "gateway.ping_interval must not be negative")
+	}
+	for name, p := range c.Gateway.Profiles {
+		problems = append(problems, p.validate("gateway.profiles."+name)...)
+	}
+	problems = append(problems, c.Gateway.Auth.validate()...)
+	problems = append(problems, c.Gateway.Audit.validate()...)
+	problems = append(problems, c.Gateway.Queue.validate()...)
+	problems = append(problems, c.Gateway.Jobs.validate()...)
+	problems = append(problems, c.Gateway.Worker.validate()...)
+	problems = append(problems, c.Gateway.Priority.validate("gateway.priority")...)
+	for tenant, r := range c.Gateway.Priority.Tenants {
+		problems = append(problems, r.validate("gateway.priority.tenants."+tenant)...)
+	}
+	for name, r := range c.Gateway.Routes {
+		problems = append(problems, r.validate("gateway.routes."+name)...)
+		if _, ok := c.Gateway.Profiles[r.Profile]; r.Profile != "" && !ok {
+			problems = append(problems, fmt.Sprintf("gateway.routes.%s.profile %q is not defined", name, r.Profile))
+		}
+	}
+	for name, p := range c.Providers {
+		if p.Endpoint != "" {
+			if u, err := url.Parse(p.Endpoint); err != nil || u.Scheme == "" || u.Host == "" {
+				problems = append(problems, fmt.Sprintf("providers.%s.endpoint %q is not an absolute URL", name, p.Endpoint))
+			}
+		}
+		if p.Timeout < 0 {
+			problems = append(problems, fmt.Sprintf("providers.%s.timeout must not be negative", name))
+		}
+		if p.RequestsPerMinute < 0 || p.TokensPerMinute < 0 {
+			problems = append(problems, fmt.Sprintf("providers.%s rate limits must not be negative", name))
+		}
+		switch p.ServiceTier {
+		case "", "auto", "default", "flex", "priority":
+		default:
+			problems = append(problems, fmt.Sprintf("providers.%s.service_tier %q is not auto, default, flex or priority", name, p.ServiceTier))
+		}
+	}
+	for name, f := range c.Flags {
+		if f.Rollout < 0 || f.Rollout > 100 {
+			problems = append(problems, fmt.Sprintf("flags.%s.rollout %d is not between 0 and 100", name, f.Rollout))
+		}
+	}
+	for name, p := range c.Profiles {
+		if p.DefaultModel == "" {
+			problems = append(problems, fmt.Sprintf("profiles.%s.default_model is required", name))
+		}
+	}
+	for alias, model := range c.ModelAliases {
+		if model == "" {
+			problems = append(problems, fmt.Sprintf("model_aliases.%s model is required", alias))
+			continue
+		}
+		// Follow the chain of aliases; one longer than the aliases themselves loops
+		for i := 0; i <= len(c.ModelAliases); i++ {
+			next, ok := c.ModelAliases[model]
+			if !ok {
+				break
+			}
+			if model == alias || i == len(c.ModelAliases) {
+				problems = append(problems, fmt.Sprintf("model_aliases.%s resolves in a loop", alias))
+				break
+			}
+			model = next
+		}
+	}
+	for i, path := range c.ModelCatalog.Files {
+		if path == "" {
+			problems = append(problems, fmt.Sprintf("model_catalog.files[%d] is empty", i))
+		}
+	}
+	if c.Gateway.OutputBudget < 0 {
+		problems = append(problems, "gateway.output_budget must not be negative")
+	}
+	for key, p := range c.Gateway.KeyPolicies {
+		if p.RequestsPerMinute < 0 || p.TokensPerMinute < 0 || p.MaxTokensPerRequest < 0 {
+			problems = append(problems, fmt.Sprintf("gateway.key_policies.%s limits must not be negative", key))
+		}
+		if p.BatchPercent < 0 || p.BatchPercent > 100 {
+			problems = append(problems, fmt.Sprintf("gateway.key_policies.%s.batch_percent %d is not between 0 and 100", key, p.BatchPercent))
+		}
+		for _, pattern := range p.AllowedModels {
+			if _, err := path.Match(pattern, ""); err != nil {
+				problems = append(problems, fmt.Sprintf("gateway.key_policies.%s.allowed_models pattern %q is invalid", key, pattern))
+			}
+		}
+	}
+	accessRules := map[string]ModelAccessRule{"model_access": c.ModelAccess.ModelAccessRule}
+	for env, r := range c.ModelAccess.Environments {
+		accessRules["model_access.environments."+env] = r
+	}
+	for tenant, r := range c.ModelAccess.Tenants {
+		accessRules["model_access.tenants."+tenant] = r
+	}
+	for name, r := range accessRules {
+		for _, pattern := range append(r.Allow[:len(r.Allow):len(r.Allow)], r.Deny...) {
+			if _, err := path.Match(pattern, ""); err != nil {
+				problems = append(problems, fmt.Sprintf("%s pattern %q is invalid", name, pattern))
+			}
+		}
+	}
+	for model, d := range c.Deployments {
+		switch d.Policy {
+		case "", "weighted_round_robin", "least_outstanding":
+		default:
+			problems = append(problems, fmt.Sprintf("deployments.%s.policy %q is not weighted_round_robin or least_outstanding", model, d.Policy))
+		}
+		if len(d.Endpoints) == 0 {
+			problems = append(problems, fmt.Sprintf("deployments.%s.endpoints is required", model))
+		}
+		seen := make(map[string]bool, len(d.Endpoints))
+		for i, e := range d.Endpoints {
+			if e.Name == "" || seen[e.Name] {
+				problems = append(problems, fmt.Sprintf("deployments.%s.endpoints[%d].name %q is empty or repeated", model, i, e.Name))
+			}
+			seen[e.Name] = true
+			if e.Endpoint != "" {
+				if u, err := url.Parse(e.Endpoint); err != nil || u.Scheme == "" || u.Host == "" {
+					problems = append(problems, fmt.Sprintf("deployments.%s.endpoints[%d].endpoint %q is not an absolute URL", model, i, e.Endpoint))
+				}
+			}
+			if e.Weight < 0 {
+				problems = append(problems, fmt.Sprintf("deployments.%s.endpoints[%d].weight must not be negative", model, i))
+			}
+		}
+	}
+	if c.Shadow.Fraction < 0 || c.Shadow.Fraction > 1 {
+		problems = append(problems, fmt.Sprintf("shadow.fraction %g is not between 0 and 1", c.Shadow.Fraction))
+	}
+	if c.Shadow.Model == "" && c.Shadow.Fraction > 0 {
+		problems = append(problems, "shadow.model is required when shadow.fraction is set")
+	}
+	if c.Shadow.TTL < 0 {
+		problems = append(problems, "shadow.ttl must not be negative")
+	}
+	for tenant, b := range c.Budgets {
+		if b.DailyCents < 0 || b.MonthlyCents < 0 {
+			problems = append(problems, fmt.Sprintf("budgets.%s caps must not be negative", tenant))
+		}
+		if b.SoftLimitPercent < 0 || b.SoftLimitPercent > 100 {
+			problems = append(problems, fmt.Sprintf("budgets.%s.soft_limit_percent %d is not between 0 and 100", tenant, b.SoftLimitPercent))
+		}
+		if b.WebhookURL != "" {
+			if u, err := url.Parse(b.WebhookURL); err != nil || u.Scheme == "" || u.Host == "" {
+				problems = append(problems, fmt.Sprintf("budgets.%s.webhook_url %q is not an absolute URL", tenant, b.WebhookURL))
+			}
+		}
+	}
+	if billing := c.Currency.Billing; billing != "" && !isCurrencyCode(billing) {
+		problems = append(problems, fmt.Sprintf("currency.billing %q is not a currency code", billing))
+	} else if billing != "" && !strings.EqualFold(billing, "USD") && c.Currency.RatesURL == "" && c.Currency.Rate(billing) == 0 {
+		problems = append(problems, fmt.Sprintf("currency.rates has no rate for %s and no rates_url is set", billing))
+	}
+	for code, rate := range c.Currency.Rates {
+		if rate <= 0 {
+			problems = append(problems, fmt.Sprintf("currency.rates.%s must be positive", code))
+		}
+	}
+	if c.Currency.RatesURL != "" {
+		if u, err := url.Parse(c.Currency.RatesURL); err != nil || u.Scheme == "" || u.Host == "" {
+			problems = append(problems, fmt.Sprintf("currency.rates_url %q is not an absolute URL", c.Currency.RatesURL))
+		}
+		if c.Currency.RefreshInterval <= 0 {
+			problems = append(problems, "currency.refresh_interval must be positive")
+		}
+	}
+	for name, r := range c.Retention.Rules() {
+		if r.MaxAge < 0 {
+			problems = append(problems, fmt.Sprintf("retention.%s.max_age must not be negative", name))
+		}
+		if r.MaxAge > 0 && r.Prefix == "" {
+			// An empty prefix would match every key
+			problems = append(problems, fmt.Sprintf("retention.%s.prefix is required when max_age is set", name))
+		}
+		if r.MaxAge > 0 && c.Retention.Interval <= 0 {
+			problems = append(problems, "retention.interval must be positive")
+			break
+		}
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("invalid configuration: %s", strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// validate returns the problems with d, prefixing each with its config path.
+func (d RequestDefaults) validate(path string) []string {
+	var problems []string
+	if d.Temperature < 0 || d.Temperature > 2 {
+		problems = append(problems, fmt.Sprintf("%s.temperature %v is not between 0 and 2", path, d.Temperature))
+	}
+	if d.TopP < 0 || d.TopP > 1 {
+		problems = append(problems, fmt.Sprintf("%s.top_p %v is not between 0 and 1", path, d.TopP))
+	}
+	if d.MaxTokens < 0 {
+		problems = append(problems, fmt.Sprintf("%s.max_tokens must not be negative", path))
+	}
+	return problems
+}
+
+// validLogLevel reports whether level is a level name understood by the logging library.
+func validLogLevel(level string) bool {
+	switch strings.ToLower(level) {
+	case "trace", "debug", "info", "warn", "error", "fatal", "panic", "disabled":
+		return true
+	}
+	return false
+}
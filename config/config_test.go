@@ -4,6 +4,7 @@ package config
 import (
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 )
@@ -45,7 +46,56 @@ func TestNew_LoadsFromFileAndEnv(t *testing.T) {
 			"enable_grpc": true,
 			"enable_rest": true,
 			"cache_ttl": "7200s",
-			"request_timeout": "15s"
+			"request_timeout": "15s",
+			"route_timeouts": {"/v1/llm/batch": "2m"},
+			"profiles": {
+				"support": {"temperature": 0.2, "max_tokens": 512, "system_instruction": "Be concise."}
+			},
+			"routes": {
+				"chat": {"profile": "support", "max_tokens": 1024}
+			},
+			"key_policies": {
+				"Search-Team": {"requests_per_minute": 600, "allowed_models": ["gpt-4o*"], "max_tokens_per_request": 2048},
+				"default": {"requests_per_minute": 60}
+			}
+		},
+		"policy": {
+			"system_preamble": "Follow the acceptable use policy.",
+			"tenant_preambles": {"acme": "You are Acme's assistant."}
+		},
+		"flags": {
+			"anthropic_batch_api": {"rollout": 25, "tenants": {"Acme": true, "globex": false}}
+		},
+		"profiles": {
+			"code": {"default_model": "claude-3-sonnet"}
+		},
+		"model_aliases": {
+			"fast": "gpt-4o-mini",
+			"default": "fast"
+		},
+		"model_catalog": {
+			"files": ["catalog/models.yaml"]
+		},
+		"model_access": {
+			"deny": ["gpt-3.5*"],
+			"environments": {"Testing": {"allow": ["gpt-4o*", "claude-3-*"]}},
+			"tenants": {"acme": {"deny": ["claude-3-opus"]}}
+		},
+		"deployments": {
+			"gpt-4o": {"policy": "least_outstanding", "endpoints": [
+				{"name": "azure-east", "endpoint": "https://east.openai.azure.com", "api_key": "east-key", "weight": 2},
+				{"name": "openai"}
+			]}
+		},
+		"shadow": {"model": "claude-3-5-sonnet", "fraction": 0.05},
+		"budgets": {
+			"Acme": {"daily_cents": 500, "monthly_cents": 10000, "downgrade_model": "gpt-4o-mini"}
+		},
+		"currency": {"billing": "EUR", "rates": {"EUR": 0.92}},
+		"retention": {
+			"dry_run": true,
+			"sessions": {"max_age": "168h"},
+			"usage": {"prefix": "metering:", "max_age": "2160h"}
 		},
 		"environment": "testing"
 	}`
@@ -106,11 +156,133 @@ func TestNew_LoadsFromFileAndEnv(t *testing.T) {
 		t.Errorf("expected cache_ttl=7200s, got %v", cfg.Gateway.CacheTTL)
 	}
 
+	if cfg.Gateway.TimeoutFor("/v1/llm/batch") != 2*time.Minute || cfg.Gateway.TimeoutFor("/v1/llm/call") != 15*time.Second {
+		t.Errorf("unexpected route timeouts: %v", cfg.Gateway.RouteTimeouts)
+	}
+	if cfg.Gateway.GRPCPort != 9090 {
+		t.Errorf("expected grpc_port=9090, got %d", cfg.Gateway.GRPCPort)
+	}
+	if cfg.Gateway.StreamHeartbeat != 15*time.Second {
+		t.Errorf("expected stream_heartbeat=15s, got %v", cfg.Gateway.StreamHeartbeat)
+	}
+	if cfg.Gateway.Auth.Enabled || cfg.Gateway.Auth.Store != KeyStoreStatic {
+		t.Errorf("expected auth disabled with the static store, got %+v", cfg.Gateway.Auth)
+	}
+	if oidc := cfg.Gateway.Auth.OIDC; oidc.JWKSCacheTTL != time.Hour || oidc.TenantClaim != "tenant_id" || oidc.UserClaim != "sub" {
+		t.Errorf("expected OIDC defaults, got %+v", oidc)
+	}
+	if audit := cfg.Gateway.Audit; audit.Enabled || audit.Sink != AuditSinkFile || audit.Path != "audit.log" || audit.Content != "omit" {
+		t.Errorf("expected audit disabled with the file sink, got %+v", audit)
+	}
+	if queue := cfg.Gateway.Queue; queue.Enabled || queue.MaxDepth != 100 || queue.MaxWait != 10*time.Second {
+		t.Errorf("expected the queue disabled, got %+v", queue)
+	}
+	if jobs := cfg.Gateway.Jobs; jobs.Enabled || jobs.TTL != 24*time.Hour || jobs.Timeout != 10*time.Minute || jobs.Concurrency != 4 || jobs.MaxAttempts != 5 {
+		t.Errorf("expected jobs disabled, got %+v", jobs)
+	}
+	if worker := cfg.Gateway.Worker; worker.Enabled || worker.Transport != WorkerTransportRedis || worker.Requests != "nexen-requests" || worker.Concurrency != 8 || worker.ClaimIdle != 10*time.Minute {
+		t.Errorf("expected the worker disabled, got %+v", worker)
+	}
+	if cfg.Gateway.ShutdownTimeout != 30*time.Second {
+		t.Errorf("expected shutdown_timeout=30s, got %v", cfg.Gateway.ShutdownTimeout)
+	}
+
+	if d := cfg.Gateway.DefaultsFor("chat"); d.Temperature != 0.2 || d.MaxTokens != 1024 || d.SystemInstruction != "Be concise." {
+		t.Errorf("unexpected chat route defaults: %+v", d)
+	}
+
+	if p, ok := cfg.Gateway.PolicyFor("search-team"); !ok || p.RequestsPerMinute != 600 || p.AllowedModels[0] != "gpt-4o*" || p.MaxTokensPerRequest != 2048 {
+		t.Errorf("unexpected key policy: %+v", p)
+	}
+	if p, _ := cfg.Gateway.PolicyFor("other-team"); p.RequestsPerMinute != 60 {
+		t.Errorf("expected the default key policy, got %+v", p)
+	}
+
+	if cfg.Policy.SystemPreamble != "Follow the acceptable use policy." || cfg.Policy.TenantPreambles["acme"] != "You are Acme's assistant." {
+		t.Errorf("unexpected policy cfg: %+v", cfg.Policy)
+	}
+
+	if flag := cfg.Flags["anthropic_batch_api"]; flag.Rollout != 25 || !flag.Tenants["acme"] || flag.Tenants["globex"] {
+		t.Errorf("unexpected flags cfg: %+v", cfg.Flags)
+	}
+
+	if cfg.Profiles["code"].DefaultModel != "claude-3-sonnet" {
+		t.Errorf("unexpected profiles cfg: %+v", cfg.Profiles)
+	}
+	if cfg.ModelAliases["fast"] != "gpt-4o-mini" || cfg.ModelAliases["default"] != "fast" {
+		t.Errorf("unexpected model_aliases cfg: %+v", cfg.ModelAliases)
+	}
+	if !cfg.ModelCatalog.Builtin || len(cfg.ModelCatalog.Files) != 1 || cfg.ModelCatalog.Files[0] != "catalog/models.yaml" {
+		t.Errorf("unexpected model_catalog cfg: %+v", cfg.ModelCatalog)
+	}
+
+	if rules := cfg.ModelAccess.Rules(cfg.Environment); len(rules) != 2 || rules[0].Deny[0] != "gpt-3.5*" || len(rules[1].Allow) != 2 ||
+		cfg.ModelAccess.Tenants["acme"].Deny[0] != "claude-3-opus" {
+		t.Errorf("unexpected model access cfg: %+v", cfg.ModelAccess)
+	}
+
+	if d := cfg.Deployments["gpt-4o"]; d.Policy != "least_outstanding" || len(d.Endpoints) != 2 ||
+		d.Endpoints[0] != (DeploymentConfig{Name: "azure-east", Endpoint: "https://east.openai.azure.com", APIKey: "east-key", Weight: 2}) {
+		t.Errorf("unexpected deployments cfg: %+v", cfg.Deployments)
+	}
+
+	if cfg.Shadow != (ShadowConfig{Model: "claude-3-5-sonnet", Fraction: 0.05, TTL: 168 * time.Hour}) {
+		t.Errorf("unexpected shadow cfg: %+v", cfg.Shadow)
+	}
+
+	if b := cfg.Budgets["acme"]; b.DailyCents != 500 || b.MonthlyCents != 10000 || b.DowngradeModel != "gpt-4o-mini" {
+		t.Errorf("unexpected budgets cfg: %+v", cfg.Budgets)
+	}
+
+	if c := cfg.Currency; c.Billing != "EUR" || c.Rate("eur") != 0.92 || c.RefreshInterval != time.Hour {
+		t.Errorf("unexpected currency cfg: %+v", c)
+	}
+
+	if r := cfg.Retention; r.Interval != time.Hour || !r.DryRun || r.Sessions != (RetentionRule{Prefix: "session:", MaxAge: 168 * time.Hour}) ||
+		r.Usage != (RetentionRule{Prefix: "metering:", MaxAge: 2160 * time.Hour}) || r.Cache.MaxAge != 0 {
+		t.Errorf("unexpected retention cfg: %+v", r)
+	}
+
 	if cfg.Environment != "testing" {
 		t.Errorf("expected environment=testing, got %s", cfg.Environment)
 	}
 }
 
+func TestNew_RedisTopologyFromEnv(t *testing.T) {
+	wd, _ := os.Getwd()
+	defer os.Chdir(wd)
+	os.Chdir(t.TempDir())
+
+	env := map[string]string{
+		"NEXEN_REDIS_MODE":        RedisModeSentinel,
+		"NEXEN_REDIS_ADDRESSES":   "sentinel-1:26379,sentinel-2:26379",
+		"NEXEN_REDIS_MASTER_NAME": "primary",
+		"NEXEN_REDIS_POOL_SIZE":   "50",
+		"NEXEN_REDIS_TLS_ENABLED": "true",
+	}
+	for k, v := range env {
+		os.Setenv(k, v)
+		defer os.Unsetenv(k)
+	}
+
+	cfg, err := New()
+	if err != nil {
+		t.Fatalf("New() error: %v", err)
+	}
+	if cfg.Redis.Mode != RedisModeSentinel || cfg.Redis.MasterName != "primary" {
+		t.Errorf("unexpected redis topology: %+v", cfg.Redis)
+	}
+	if nodes := cfg.Redis.Nodes(); len(nodes) != 2 || nodes[1] != "sentinel-2:26379" {
+		t.Errorf("expected two sentinel addresses, got %v", nodes)
+	}
+	if cfg.Redis.PoolSize != 50 || !cfg.Redis.TLS.Enabled {
+		t.Errorf("expected pool size and TLS from env, got %+v", cfg.Redis)
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Errorf("expected sentinel config to validate, got %v", err)
+	}
+}
+
 func TestLoadServiceConfig(t *testing.T) {
 	// create a temp directory and write a custom nexen.json
 	tmp := t.TempDir()
@@ -146,3 +318,131 @@ func TestLoadServiceConfig(t *testing.T) {
 		t.Errorf("expected Telemetry.ServiceName=%s, got %s", serviceName, cfg.Telemetry.ServiceName)
 	}
 }
+
+func TestValidate(t *testing.T) {
+	valid := Config{
+		Server:  ServerConfig{Port: 8080},
+		Logging: LoggingConfig{Level: "DEBUG"},
+		Redis:   RedisConfig{Address: "localhost:6379"},
+		Providers: map[string]ProviderConfig{
+			"openai": {Endpoint: "https://api.openai.com/v1", Timeout: 30, RequestsPerMinute: 500, TokensPerMinute: 90000},
+		},
+	}
+	if err := valid.Validate(); err != nil {
+		t.Fatalf("expected valid config, got %v", err)
+	}
+
+	invalid := valid
+	invalid.Server.Port = 70000
+	invalid.Redis.Address = "localhost"
+	invalid.Redis.Mode = RedisModeSentinel
+	invalid.Gateway.Profiles = map[string]RequestDefaults{"creative": {Temperature: 3}}
+	invalid.Gateway.Routes = map[string]RequestDefaults{"chat": {Profile: "missing", MaxTokens: -1}}
+	invalid.Gateway.OutputBudget = -1
+	invalid.Gateway.RouteTimeouts = map[string]time.Duration{"/v1/llm/call": 0}
+	invalid.Gateway.ShutdownTimeout = -1
+	invalid.Gateway.StreamHeartbeat = -1
+	invalid.Gateway.PingInterval = -1
+	invalid.Gateway.EnableGRPC = true
+	invalid.Gateway.KeyPolicies = map[string]KeyPolicy{"search": {TokensPerMinute: -1, AllowedModels: []string{"gpt-["}}}
+	invalid.Gateway.Auth = AuthConfig{Store: "vault", Keys: []APIKeyConfig{{Name: "search", Hash: "abc"}, {Name: "search", Hash: strings.Repeat("0", 64)}},
+		OIDC: OIDCConfig{Issuer: "accounts.example.com", JWKSCacheTTL: -1}}
+	invalid.Gateway.Audit = AuditConfig{Enabled: true, Sink: AuditSinkKafka, Content: "partial"}
+	invalid.Gateway.Queue = QueueConfig{Enabled: true, ProviderMaxConcurrent: map[string]int{"openai": -1}}
+	invalid.Gateway.Jobs = JobsConfig{Enabled: true, TTL: time.Hour, Timeout: time.Minute, PollInterval: -1, MaxAttempts: 1}
+	invalid.Gateway.Worker = WorkerConfig{Enabled: true, Transport: WorkerTransportKafka, Requests: "requests", Concurrency: 1, TokensPerMinute: -1, Timeout: time.Minute}
+	invalid.Gateway.Priority = PriorityConfig{PriorityRule: PriorityRule{Default: "urgent"},
+		Tenants: map[string]PriorityRule{"acme": {Max: "low", BatchModels: map[string]string{"gpt-4o": ""}}}}
+	invalid.Gateway.KeyPolicies["search"] = KeyPolicy{TokensPerMinute: -1, AllowedModels: []string{"gpt-["}, BatchPercent: 150}
+	invalid.Providers = map[string]ProviderConfig{
+		"custom":    {Endpoint: "not-a-url"},
+		"anthropic": {TokensPerMinute: -1},
+		"openai":    {ServiceTier: "express"},
+	}
+	invalid.Flags = map[string]FlagConfig{"new_parser": {Rollout: 150}}
+	invalid.Profiles = map[string]ProfileConfig{"chat": {}}
+	invalid.ModelAliases = map[string]string{"fast": "smart", "smart": "fast", "cheap": ""}
+	invalid.ModelCatalog.Files = []string{""}
+	invalid.ModelAccess = ModelAccessConfig{Tenants: map[string]ModelAccessRule{"acme": {Deny: []string{"gpt-["}}}}
+	invalid.Deployments = map[string]DeploymentsConfig{
+		"gpt-4o":      {Policy: "random", Endpoints: []DeploymentConfig{{Name: "east", Endpoint: "east"}, {Name: "east", Weight: -1}}},
+		"gpt-4o-mini": {},
+	}
+	invalid.Shadow = ShadowConfig{Fraction: 1.5, TTL: -1}
+	invalid.Budgets = map[string]BudgetConfig{"acme": {DailyCents: -1, SoftLimitPercent: 120, WebhookURL: "hooks"}}
+	invalid.Currency = CurrencyConfig{Billing: "EUR", Rates: map[string]float64{"gbp": -1}}
+	invalid.Retention = RetentionConfig{Interval: time.Hour, Jobs: RetentionRule{MaxAge: time.Hour}, Usage: RetentionRule{Prefix: "usage:", MaxAge: -1}}
+	err := invalid.Validate()
+	if err == nil {
+		t.Fatal("expected validation error")
+	}
+	for _, want := range []string{"server.port", "redis.address", "redis.master_name", "providers.custom.endpoint", "providers.anthropic rate limits",
+		"providers.openai.service_tier",
+		"gateway.profiles.creative.temperature", "gateway.routes.chat.max_tokens", "gateway.routes.chat.profile",
+		"gateway.output_budget", "gateway.route_timeouts./v1/llm/call", "gateway.shutdown_timeout", "gateway.stream_heartbeat", "gateway.ping_interval", "gateway.grpc_port", "gateway.key_policies.search limits", "gateway.key_policies.search.allowed_models",
+		"gateway.auth.store", "gateway.auth.keys[0].hash", "gateway.auth.keys[1].name",
+		"gateway.auth.oidc.issuer", "gateway.auth.oidc.audience", "gateway.auth.oidc.jwks_cache_ttl",
+		"gateway.audit.brokers", "gateway.audit.content",
+		"gateway.queue.provider_max_concurrent.openai", "gateway.queue.max_depth", "gateway.queue.max_wait",
+		"gateway.jobs.poll_interval", "gateway.jobs.concurrency", "gateway.jobs.webhook_timeout",
+		"gateway.worker.brokers", "gateway.worker.requests, replies and group", "gateway.worker rate limits", "gateway.worker.claim_idle",
+		"gateway.priority.default", "gateway.priority.tenants.acme.max", "gateway.priority.tenants.acme.batch_models.gpt-4o",
+		"gateway.key_policies.search.batch_percent", "flags.new_parser.rollout", "profiles.chat.default_model",
+		"model_aliases.fast resolves in a loop", "model_aliases.cheap model is required", "model_catalog.files[0] is empty",
+		"model_access.tenants.acme pattern",
+		"deployments.gpt-4o.policy", "deployments.gpt-4o.endpoints[0].endpoint", "deployments.gpt-4o.endpoints[1].name",
+		"deployments.gpt-4o.endpoints[1].weight", "deployments.gpt-4o-mini.endpoints is required",
+		"shadow.fraction", "shadow.model is required", "shadow.ttl",
+		"budgets.acme caps", "budgets.acme.soft_limit_percent", "budgets.acme.webhook_url", "currency.rates has no rate for EUR", "currency.rates.gbp",
+		"retention.jobs.prefix", "retention.usage.max_age"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("expected error to mention %s, got %v", want, err)
+		}
+	}
+}
+
+func TestGatewayDefaultsFor(t *testing.T) {
+	gateway := GatewayConfig{
+		Profiles: map[string]RequestDefaults{
+			"support": {Temperature: 0.2, MaxTokens: 512, SystemInstruction: "Be concise.", StopSequences: []string{"END"}},
+		},
+		Routes: map[string]RequestDefaults{
+			"chat":    {Profile: "support", MaxTokens: 1024},
+			"summary": {Temperature: 0.0, TopP: 0.9},
+		},
+	}
+
+	chat := gateway.DefaultsFor("chat")
+	if chat.Profile != "support" || chat.Temperature != 0.2 || chat.MaxTokens != 1024 ||
+		chat.SystemInstruction != "Be concise." || len(chat.StopSequences) != 1 {
+		t.Errorf("unexpected chat defaults: %+v", chat)
+	}
+	if summary := gateway.DefaultsFor("summary"); summary.TopP != 0.9 || summary.MaxTokens != 0 {
+		t.Errorf("unexpected summary defaults: %+v", summary)
+	}
+	if support := gateway.DefaultsFor("support"); support.MaxTokens != 512 {
+		t.Errorf("expected profile lookup by name, got %+v", support)
+	}
+	if unknown := gateway.DefaultsFor("unknown"); unknown.Temperature != 0 || unknown.MaxTokens != 0 {
+		t.Errorf("expected no defaults for unknown route, got %+v", unknown)
+	}
+}
+
+func TestPriorityFor(t *testing.T) {
+	priority := PriorityConfig{
+		PriorityRule: PriorityRule{BatchModels: map[string]string{"gpt-4o": "gpt-4o-mini"}},
+		Tenants: map[string]PriorityRule{
+			"reports": {Default: "batch"},
+			"trial":   {Max: "batch", BatchModels: map[string]string{}},
+		},
+	}
+	if r := priority.PriorityFor("Reports"); r.Default != "batch" || r.Max != "" || r.BatchModels["gpt-4o"] != "gpt-4o-mini" {
+		t.Errorf("expected the tenant's default with the default batch models, got %+v", r)
+	}
+	if r := priority.PriorityFor("trial"); r.Max != "batch" || len(r.BatchModels) != 0 {
+		t.Errorf("expected the tenant's own batch models, got %+v", r)
+	}
+	if r := priority.PriorityFor("other"); r.Default != "" || r.BatchModels["gpt-4o"] != "gpt-4o-mini" {
+		t.Errorf("expected the default rule, got %+v", r)
+	}
+}
@@ -0,0 +1,206 @@
+// Package flags evaluates feature flags that gate risky behavior, such as a new connector
+// code path, so it can be rolled out gradually without branching deployments.
+//
+// A flag's default comes from config.Config.Flags. Operators override it at runtime with Set,
+// which stores the flag in a store.Store (Redis in production) shared by every replica.
+package flags
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nexen/config"
+	"github.com/nexen/libs/nexenctx"
+	"github.com/nexen/libs/store"
+)
+
+// DefaultCacheTTL is how long a flag read from the store is used before it is read again.
+const DefaultCacheTTL = 10 * time.Second
+
+// keyPrefix is prepended to flag names to form store keys.
+const keyPrefix = "flags:"
+
+// Flag is the state of a feature flag.
+type Flag struct {
+	// Rollout is the percentage of tenants, 0 to 100, the flag is enabled for.
+	Rollout int `json:"rollout"`
+
+	// Tenants turns the flag on or off for individual tenants regardless of Rollout.
+	Tenants map[string]bool `json:"tenants,omitempty"`
+}
+
+// EnabledFor reports whether the flag is enabled for tenant. A tenant listed in Tenants gets
+// its override; otherwise the tenant is hashed with the flag name into one of 100 buckets, so
+// each tenant sees a stable result and raising Rollout only adds tenants. An empty tenant is
+// enabled only at a Rollout of 100.
+func (f Flag) EnabledFor(name, tenant string) bool {
+	tenant = strings.ToLower(tenant)
+	if on, ok := f.Tenants[tenant]; ok && tenant != "" {
+		return on
+	}
+	switch {
+	case f.Rollout >= 100:
+		return true
+	case f.Rollout <= 0 || tenant == "":
+		return false
+	}
+	h := fnv.New32a()
+	h.Write([]byte(name + "/" + tenant))
+	return int(h.Sum32()%100) < f.Rollout
+}
+
+// validate checks the rollout range and lower-cases tenant names.
+func (f Flag) validate() (Flag, error) {
+	if f.Rollout < 0 || f.Rollout > 100 {
+		return f, fmt.Errorf("rollout %d is not between 0 and 100", f.Rollout)
+	}
+	tenants := make(map[string]bool, len(f.Tenants))
+	for tenant, on := range f.Tenants {
+		tenants[strings.ToLower(tenant)] = on
+	}
+	f.Tenants = tenants
+	return f, nil
+}
+
+// cachedFlag is a flag read from the store. found is false when the store has no override.
+type cachedFlag struct {
+	flag    Flag
+	found   bool
+	expires time.Time
+}
+
+// Flags evaluates feature flags from configured defaults and runtime overrides.
+type Flags struct {
+	defaults map[string]Flag
+	store    store.Store
+
+	// CacheTTL is how long overrides read from the store are reused. Zero reads the store
+	// on every evaluation.
+	CacheTTL time.Duration
+
+	mu    sync.Mutex
+	cache map[string]cachedFlag
+
+	// now is replaceable in tests
+	now func() time.Time
+}
+
+// New creates flags with the defaults in cfg and runtime overrides in s, which may be nil
+// to use the defaults only.
+func New(cfg map[string]config.FlagConfig, s store.Store) *Flags {
+	defaults := make(map[string]Flag, len(cfg))
+	for name, fc := range cfg {
+		// Out-of-range rollouts are reported by config.Validate
+		defaults[name], _ = Flag{Rollout: fc.Rollout, Tenants: fc.Tenants}.validate()
+	}
+	return &Flags{
+		defaults: defaults,
+		store:    s,
+		CacheTTL: DefaultCacheTTL,
+		cache:    make(map[string]cachedFlag),
+		now:      time.Now,
+	}
+}
+
+// Enabled reports whether flag name is enabled for the tenant in ctx (see nexenctx.WithTenant).
+// Without a tenant, flags are only enabled at a rollout of 100 or more. Unknown flags are
+// disabled. If the store cannot be read, the configured default is used. Enabled
+// has the signature common.WithFeatureGate expects, so it can gate connector behavior.
+func (f *Flags) Enabled(ctx context.Context, name string) bool {
+	tenant, _ := nexenctx.TenantFrom(ctx)
+	flag, err := f.Lookup(ctx, name)
+	if err != nil {
+		slog.Warn("reading feature flag; using default", "flag", name, "error", err)
+	}
+	return flag.EnabledFor(name, tenant)
+}
+
+// Lookup returns the current state of flag name: the override in the store if there is one,
+// and the configured default otherwise. On a store error the default is returned with the
+// error.
+func (f *Flags) Lookup(ctx context.Context, name string) (Flag, error) {
+	if f.store == nil {
+		return f.defaults[name], nil
+	}
+
+	f.mu.Lock()
+	cached, ok := f.cache[name]
+	f.mu.Unlock()
+	if !ok || !f.now().Before(cached.expires) {
+		var err error
+		if cached, err = f.read(ctx, name); err != nil {
+			return f.defaults[name], err
+		}
+		f.mu.Lock()
+		f.cache[name] = cached
+		f.mu.Unlock()
+	}
+
+	if cached.found {
+		return cached.flag, nil
+	}
+	return f.defaults[name], nil
+}
+
+// read fetches the override for name from the store.
+func (f *Flags) read(ctx context.Context, name string) (cachedFlag, error) {
+	cached := cachedFlag{expires: f.now().Add(f.CacheTTL)}
+	data, err := f.store.Get(ctx, keyPrefix+name)
+	if errors.Is(err, store.ErrNotFound) {
+		return cached, nil
+	}
+	if err != nil {
+		return cached, fmt.Errorf("reading flag %s: %w", name, err)
+	}
+	if err := json.Unmarshal(data, &cached.flag); err != nil {
+		return cached, fmt.Errorf("decoding flag %s: %w", name, err)
+	}
+	cached.found = true
+	return cached, nil
+}
+
+// Set stores an override for flag name that takes effect on every replica within CacheTTL.
+func (f *Flags) Set(ctx context.Context, name string, flag Flag) error {
+	if f.store == nil {
+		return errors.New("flags: no store for overrides")
+	}
+	flag, err := flag.validate()
+	if err != nil {
+		return fmt.Errorf("flag %s: %w", name, err)
+	}
+	data, err := json.Marshal(flag)
+	if err != nil {
+		return err
+	}
+	if err := f.store.Set(ctx, keyPrefix+name, data, 0); err != nil {
+		return err
+	}
+	f.forget(name)
+	return nil
+}
+
+// Reset removes the override for flag name, restoring the configured default.
+func (f *Flags) Reset(ctx context.Context, name string) error {
+	if f.store == nil {
+		return nil
+	}
+	if err := f.store.Delete(ctx, keyPrefix+name); err != nil {
+		return err
+	}
+	f.forget(name)
+	return nil
+}
+
+// forget drops the cached override for name so this replica sees a change immediately.
+func (f *Flags) forget(name string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	delete(f.cache, name)
+}
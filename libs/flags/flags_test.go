@@ -0,0 +1,117 @@
+package flags
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/nexen/config"
+	"github.com/nexen/libs/nexenctx"
+	"github.com/nexen/libs/store"
+)
+
+func TestFlagEnabledFor(t *testing.T) {
+	flag := Flag{Rollout: 30, Tenants: map[string]bool{"acme": true, "globex": false}}
+
+	if !flag.EnabledFor("new_parser", "ACME") {
+		t.Error("Expected tenant override to enable the flag")
+	}
+	if (Flag{Rollout: 100, Tenants: map[string]bool{"globex": false}}).EnabledFor("new_parser", "globex") {
+		t.Error("Expected tenant override to disable the flag")
+	}
+	if flag.EnabledFor("new_parser", "") || !(Flag{Rollout: 100}).EnabledFor("new_parser", "") {
+		t.Error("Expected requests without a tenant to follow only a full rollout")
+	}
+
+	// Roughly the rollout percentage of tenants is enabled, and raising it keeps them enabled
+	enabled := 0
+	for i := 0; i < 1000; i++ {
+		tenant := fmt.Sprintf("tenant-%d", i)
+		if flag.EnabledFor("new_parser", tenant) {
+			enabled++
+			if !(Flag{Rollout: 60}).EnabledFor("new_parser", tenant) {
+				t.Fatalf("Tenant %s dropped out when the rollout was raised", tenant)
+			}
+		}
+	}
+	if enabled < 250 || enabled > 350 {
+		t.Errorf("Expected about 300 of 1000 tenants enabled, got %d", enabled)
+	}
+}
+
+func TestFlagsOverrides(t *testing.T) {
+	ctx := nexenctx.WithTenant(context.Background(), "acme")
+	backend := store.NewMemory()
+	flags := New(map[string]config.FlagConfig{"anthropic_batch_api": {Rollout: 0, Tenants: map[string]bool{"acme": true}}}, backend)
+
+	if !flags.Enabled(ctx, "anthropic_batch_api") {
+		t.Error("Expected the configured tenant override")
+	}
+	if flags.Enabled(ctx, "unknown") {
+		t.Error("Expected unknown flags to be disabled")
+	}
+
+	// An override replaces the configured default on every replica
+	if err := flags.Set(ctx, "anthropic_batch_api", Flag{Tenants: map[string]bool{"Acme": false}}); err != nil {
+		t.Fatalf("Set() error = %v", err)
+	}
+	replica := New(map[string]config.FlagConfig{"anthropic_batch_api": {Tenants: map[string]bool{"acme": true}}}, backend)
+	if flags.Enabled(ctx, "anthropic_batch_api") || replica.Enabled(ctx, "anthropic_batch_api") {
+		t.Error("Expected the stored override to disable the flag")
+	}
+
+	if err := flags.Set(ctx, "anthropic_batch_api", Flag{Rollout: 101}); err == nil {
+		t.Error("Expected an out-of-range rollout to be rejected")
+	}
+
+	if err := flags.Reset(ctx, "anthropic_batch_api"); err != nil {
+		t.Fatalf("Reset() error = %v", err)
+	}
+	if !flags.Enabled(ctx, "anthropic_batch_api") {
+		t.Error("Expected the configured default after Reset")
+	}
+}
+
+func TestFlagsCache(t *testing.T) {
+	backend := store.NewMemory()
+	now := time.Now()
+	flags := New(nil, backend)
+	flags.now = func() time.Time { return now }
+
+	if flags.Enabled(context.Background(), "new_parser") {
+		t.Fatal("Expected the flag to start disabled")
+	}
+	if err := backend.Set(context.Background(), "flags:new_parser", []byte(`{"rollout":100}`), 0); err != nil {
+		t.Fatal(err)
+	}
+	if flags.Enabled(context.Background(), "new_parser") {
+		t.Error("Expected the cached state within CacheTTL")
+	}
+	now = now.Add(DefaultCacheTTL)
+	if !flags.Enabled(context.Background(), "new_parser") {
+		t.Error("Expected the stored override after CacheTTL")
+	}
+}
+
+// failingStore fails every read.
+type failingStore struct {
+	store.Store
+}
+
+func (failingStore) Get(ctx context.Context, key string) ([]byte, error) {
+	return nil, errors.New("connection refused")
+}
+
+func TestFlagsStoreErrorUsesDefault(t *testing.T) {
+	flags := New(map[string]config.FlagConfig{"new_parser": {Rollout: 100}}, failingStore{})
+
+	flag, err := flags.Lookup(context.Background(), "new_parser")
+	if err == nil || flag.Rollout != 100 {
+		t.Errorf("Expected the default with the error, got %+v, %v", flag, err)
+	}
+	if !flags.Enabled(context.Background(), "new_parser") {
+		t.Error("Expected the default when the store is unavailable")
+	}
+}
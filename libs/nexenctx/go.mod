@@ -0,0 +1,16 @@
+module github.com/nexen/libs/nexenctx
+
+go 1.21
+
+require (
+	github.com/nexen/libs/logging v0.0.0
+	github.com/rs/zerolog v1.34.0
+)
+
+require (
+	github.com/mattn/go-colorable v0.1.13 // indirect
+	github.com/mattn/go-isatty v0.0.19 // indirect
+	golang.org/x/sys v0.12.0 // indirect
+)
+
+replace github.com/nexen/libs/logging => ../logging
@@ -0,0 +1,109 @@
+// libs/nexenctx/nexenctx.go
+package nexenctx
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+
+	"github.com/rs/zerolog"
+
+	"github.com/nexen/libs/logging"
+)
+
+// contextKey is unexported so no other package can collide with these keys.
+type contextKey int
+
+const (
+	requestIDKey contextKey = iota
+	tenantKey
+	sessionKey
+	budgetKey
+)
+
+// Budget limits what a single request may spend. Zero values mean unlimited.
+type Budget struct {
+	// MaxCostCents is the maximum spend for the request, in cents.
+	MaxCostCents float64
+	// MaxTokens is the maximum number of tokens (prompt + completion) for the request.
+	MaxTokens int
+}
+
+// NewRequestID returns a random 16-byte hex request identifier.
+func NewRequestID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "unknown"
+	}
+	return hex.EncodeToString(b)
+}
+
+// WithRequestID returns a copy of ctx carrying the request ID.
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey, id)
+}
+
+// RequestIDFrom returns the request ID stored in ctx, if any.
+func RequestIDFrom(ctx context.Context) (string, bool) {
+	id, ok := ctx.Value(requestIDKey).(string)
+	return id, ok && id != ""
+}
+
+// WithTenant returns a copy of ctx carrying the tenant identifier.
+func WithTenant(ctx context.Context, tenant string) context.Context {
+	return context.WithValue(ctx, tenantKey, tenant)
+}
+
+// TenantFrom returns the tenant stored in ctx, if any.
+func TenantFrom(ctx context.Context) (string, bool) {
+	tenant, ok := ctx.Value(tenantKey).(string)
+	return tenant, ok && tenant != ""
+}
+
+// WithSession returns a copy of ctx carrying the session identifier.
+func WithSession(ctx context.Context, session string) context.Context {
+	return context.WithValue(ctx, sessionKey, session)
+}
+
+// SessionFrom returns the session stored in ctx, if any.
+func SessionFrom(ctx context.Context) (string, bool) {
+	session, ok := ctx.Value(sessionKey).(string)
+	return session, ok && session != ""
+}
+
+// WithBudget returns a copy of ctx carrying the request budget.
+func WithBudget(ctx context.Context, budget Budget) context.Context {
+	return context.WithValue(ctx, budgetKey, budget)
+}
+
+// BudgetFrom returns the budget stored in ctx, if any.
+func BudgetFrom(ctx context.Context) (Budget, bool) {
+	budget, ok := ctx.Value(budgetKey).(Budget)
+	return budget, ok
+}
+
+// WithLogger returns a copy of ctx carrying the logger.
+func WithLogger(ctx context.Context, logger zerolog.Logger) context.Context {
+	return logging.WithContext(ctx, logger)
+}
+
+// LoggerFrom returns the logger stored in ctx (or the default logger), annotated with
+// the request ID, tenant, and session found in ctx.
+func LoggerFrom(ctx context.Context) zerolog.Logger {
+	logger := logging.FromContext(ctx)
+	if ctx == nil {
+		return logger
+	}
+
+	fields := logger.With()
+	if id, ok := RequestIDFrom(ctx); ok {
+		fields = fields.Str("request_id", id)
+	}
+	if tenant, ok := TenantFrom(ctx); ok {
+		fields = fields.Str("tenant", tenant)
+	}
+	if session, ok := SessionFrom(ctx); ok {
+		fields = fields.Str("session", session)
+	}
+	return fields.Logger()
+}
@@ -0,0 +1,58 @@
+// libs/nexenctx/nexenctx_test.go
+package nexenctx
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/rs/zerolog"
+)
+
+func TestValuesRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	if _, ok := RequestIDFrom(ctx); ok {
+		t.Fatal("expected no request ID on empty context")
+	}
+
+	ctx = WithRequestID(ctx, "req-1")
+	ctx = WithTenant(ctx, "acme")
+	ctx = WithSession(ctx, "sess-9")
+	ctx = WithBudget(ctx, Budget{MaxCostCents: 50, MaxTokens: 1000})
+
+	if id, ok := RequestIDFrom(ctx); !ok || id != "req-1" {
+		t.Errorf("expected request ID req-1, got %q", id)
+	}
+	if tenant, ok := TenantFrom(ctx); !ok || tenant != "acme" {
+		t.Errorf("expected tenant acme, got %q", tenant)
+	}
+	if session, ok := SessionFrom(ctx); !ok || session != "sess-9" {
+		t.Errorf("expected session sess-9, got %q", session)
+	}
+	if budget, ok := BudgetFrom(ctx); !ok || budget.MaxTokens != 1000 || budget.MaxCostCents != 50 {
+		t.Errorf("unexpected budget %+v", budget)
+	}
+}
+
+func TestLoggerFromAddsRequestFields(t *testing.T) {
+	buf := &bytes.Buffer{}
+	ctx := WithLogger(context.Background(), zerolog.New(buf))
+	ctx = WithRequestID(ctx, "req-2")
+	ctx = WithTenant(ctx, "acme")
+
+	logger := LoggerFrom(ctx)
+	logger.Info().Msg("hello")
+
+	out := buf.String()
+	if !strings.Contains(out, `"request_id":"req-2"`) || !strings.Contains(out, `"tenant":"acme"`) {
+		t.Errorf("expected request fields in log, got %q", out)
+	}
+}
+
+func TestNewRequestID(t *testing.T) {
+	a, b := NewRequestID(), NewRequestID()
+	if len(a) != 32 || a == b {
+		t.Errorf("expected distinct 32-char IDs, got %q and %q", a, b)
+	}
+}
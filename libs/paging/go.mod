@@ -0,0 +1,3 @@
+module github.com/nexen/libs/paging
+
+go 1.21
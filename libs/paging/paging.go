@@ -0,0 +1,263 @@
+// Package paging implements cursor-based pagination, sorting and field filtering for list
+// APIs, so every gateway and admin listing accepts the same query parameters and returns the
+// same page shape.
+//
+// Cursors point at the last item of a page by its sort value and key rather than by offset,
+// so pages stay stable while items are added or removed between requests.
+package paging
+
+import (
+	"cmp"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// DefaultLimit is the page size when the query sets none.
+	DefaultLimit = 50
+
+	// MaxLimit is the largest page size a query may ask for.
+	MaxLimit = 500
+)
+
+// ErrInvalidQuery is returned for malformed parameters, unknown fields and cursors that do
+// not belong to the query. List handlers answer it with 400 Bad Request.
+var ErrInvalidQuery = errors.New("invalid list query")
+
+// Query selects a page of a listing. It is parsed from the parameters
+//
+//	limit=50          page size, up to MaxLimit
+//	cursor=...        nextCursor of the previous page
+//	sort=name         sort field; prefix with "-" for descending order
+//	<field>=value     keep items whose field equals value; repeat for alternatives
+type Query struct {
+	Limit  int
+	Cursor string
+
+	// Sort is the field to sort by; empty sorts by key.
+	Sort string
+	Desc bool
+
+	// Filters maps field names to accepted values.
+	Filters map[string][]string
+}
+
+// ParseQuery parses a Query from URL query parameters.
+func ParseQuery(values url.Values) (Query, error) {
+	q := Query{Limit: DefaultLimit, Cursor: values.Get("cursor")}
+	if limit := values.Get("limit"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil || n < 1 || n > MaxLimit {
+			return Query{}, fmt.Errorf("%w: limit must be between 1 and %d", ErrInvalidQuery, MaxLimit)
+		}
+		q.Limit = n
+	}
+	q.Sort = values.Get("sort")
+	if strings.HasPrefix(q.Sort, "-") {
+		q.Sort, q.Desc = q.Sort[1:], true
+	}
+	for field, accepted := range values {
+		if field == "limit" || field == "cursor" || field == "sort" {
+			continue
+		}
+		if q.Filters == nil {
+			q.Filters = make(map[string][]string)
+		}
+		q.Filters[field] = accepted
+	}
+	return q, nil
+}
+
+// Page is one page of a listing.
+type Page[T any] struct {
+	Items []T `json:"items"`
+
+	// NextCursor fetches the following page; it is empty on the last page.
+	NextCursor string `json:"nextCursor,omitempty"`
+
+	// Total is the number of items matching the filters across all pages.
+	Total int `json:"total"`
+}
+
+// Fields maps the field names a listing can be sorted and filtered by to accessors. Values
+// must be a string, bool, int, int64, float64 or time.Time; filters compare their string form
+// case-insensitively.
+type Fields[T any] map[string]func(T) any
+
+// List returns the page of items selected by q. key returns each item's unique key, which
+// orders items with equal sort values and is the sort order when q.Sort is empty.
+func List[T any](items []T, key func(T) string, fields Fields[T], q Query) (Page[T], error) {
+	sortValue := func(item T) any { return key(item) }
+	if q.Sort != "" {
+		accessor, ok := fields[q.Sort]
+		if !ok {
+			return Page[T]{}, fmt.Errorf("%w: cannot sort by %q", ErrInvalidQuery, q.Sort)
+		}
+		sortValue = accessor
+	}
+
+	matched := make([]T, 0, len(items))
+	for _, item := range items {
+		ok, err := matches(item, fields, q.Filters)
+		if err != nil {
+			return Page[T]{}, err
+		}
+		if ok {
+			matched = append(matched, item)
+		}
+	}
+
+	less := func(a, b T) bool {
+		c := compare(sortValue(a), sortValue(b))
+		if c == 0 {
+			c = strings.Compare(key(a), key(b))
+		}
+		if q.Desc {
+			return c > 0
+		}
+		return c < 0
+	}
+	sort.SliceStable(matched, func(i, j int) bool { return less(matched[i], matched[j]) })
+
+	page := Page[T]{Items: []T{}, Total: len(matched)}
+	start := 0
+	if q.Cursor != "" && len(matched) > 0 {
+		c, err := decodeCursor(q, reflect.TypeOf(sortValue(matched[0])))
+		if err != nil {
+			return Page[T]{}, err
+		}
+		// The first item after the cursor's position, even if the item it named is gone
+		start = sort.Search(len(matched), func(i int) bool {
+			d := compare(sortValue(matched[i]), c.value)
+			if d == 0 {
+				d = strings.Compare(key(matched[i]), c.Key)
+			}
+			if q.Desc {
+				d = -d
+			}
+			return d > 0
+		})
+	}
+
+	limit := q.Limit
+	if limit <= 0 {
+		limit = DefaultLimit
+	}
+	end := start + limit
+	if end >= len(matched) {
+		end = len(matched)
+	} else {
+		last := matched[end-1]
+		next, err := encodeCursor(q, sortValue(last), key(last))
+		if err != nil {
+			return Page[T]{}, err
+		}
+		page.NextCursor = next
+	}
+	page.Items = append(page.Items, matched[start:end]...)
+	return page, nil
+}
+
+// matches reports whether item passes every filter.
+func matches[T any](item T, fields Fields[T], filters map[string][]string) (bool, error) {
+	for field, accepted := range filters {
+		accessor, ok := fields[field]
+		if !ok {
+			return false, fmt.Errorf("%w: cannot filter by %q", ErrInvalidQuery, field)
+		}
+		value := formatValue(accessor(item))
+		found := false
+		for _, want := range accepted {
+			if strings.EqualFold(value, want) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// cursor is the decoded form of a page cursor.
+type cursor struct {
+	Sort  string          `json:"s,omitempty"`
+	Desc  bool            `json:"d,omitempty"`
+	Value json.RawMessage `json:"v"`
+	Key   string          `json:"k"`
+
+	value any
+}
+
+func encodeCursor(q Query, value any, key string) (string, error) {
+	raw, err := json.Marshal(value)
+	if err != nil {
+		return "", fmt.Errorf("encoding cursor: %w", err)
+	}
+	data, err := json.Marshal(cursor{Sort: q.Sort, Desc: q.Desc, Value: raw, Key: key})
+	if err != nil {
+		return "", fmt.Errorf("encoding cursor: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+// decodeCursor decodes q's cursor, whose sort value has type valueType.
+func decodeCursor(q Query, valueType reflect.Type) (cursor, error) {
+	var c cursor
+	data, err := base64.RawURLEncoding.DecodeString(q.Cursor)
+	if err != nil || json.Unmarshal(data, &c) != nil {
+		return cursor{}, fmt.Errorf("%w: malformed cursor", ErrInvalidQuery)
+	}
+	if c.Sort != q.Sort || c.Desc != q.Desc {
+		return cursor{}, fmt.Errorf("%w: cursor belongs to a different sort order", ErrInvalidQuery)
+	}
+	value := reflect.New(valueType)
+	if err := json.Unmarshal(c.Value, value.Interface()); err != nil {
+		return cursor{}, fmt.Errorf("%w: malformed cursor", ErrInvalidQuery)
+	}
+	c.value = value.Elem().Interface()
+	return c, nil
+}
+
+// compare orders two values of the same supported type.
+func compare(a, b any) int {
+	switch x := a.(type) {
+	case string:
+		return strings.Compare(x, b.(string))
+	case int:
+		return cmp.Compare(x, b.(int))
+	case int64:
+		return cmp.Compare(x, b.(int64))
+	case float64:
+		return cmp.Compare(x, b.(float64))
+	case bool:
+		y := b.(bool)
+		switch {
+		case x == y:
+			return 0
+		case y:
+			return -1
+		}
+		return 1
+	case time.Time:
+		return x.Compare(b.(time.Time))
+	}
+	panic(fmt.Sprintf("paging: unsupported field type %T", a))
+}
+
+// formatValue returns the string form filters compare against.
+func formatValue(v any) string {
+	if t, ok := v.(time.Time); ok {
+		return t.Format(time.RFC3339)
+	}
+	return fmt.Sprint(v)
+}
@@ -0,0 +1,123 @@
+package paging
+
+import (
+	"errors"
+	"net/url"
+	"testing"
+)
+
+type model struct {
+	ID       string
+	Provider string
+	Tokens   int
+}
+
+var modelFields = Fields[model]{
+	"provider":  func(m model) any { return m.Provider },
+	"maxTokens": func(m model) any { return m.Tokens },
+}
+
+func modelKey(m model) string { return m.ID }
+
+func ids(models []model) []string {
+	out := make([]string, len(models))
+	for i, m := range models {
+		out[i] = m.ID
+	}
+	return out
+}
+
+func mustQuery(t *testing.T, raw string) Query {
+	t.Helper()
+	values, _ := url.ParseQuery(raw)
+	q, err := ParseQuery(values)
+	if err != nil {
+		t.Fatalf("ParseQuery(%q) error = %v", raw, err)
+	}
+	return q
+}
+
+var catalog = []model{
+	{"gpt-4", "openai", 8192},
+	{"claude-3-opus", "anthropic", 200000},
+	{"gpt-3.5-turbo", "openai", 16385},
+	{"claude-3-haiku", "anthropic", 200000},
+	{"gemini-pro", "google", 32768},
+}
+
+func TestListPages(t *testing.T) {
+	q := mustQuery(t, "limit=2&sort=-maxTokens")
+	var got []string
+	for pages := 0; ; pages++ {
+		page, err := List(catalog, modelKey, modelFields, q)
+		if err != nil {
+			t.Fatalf("List() error = %v", err)
+		}
+		if page.Total != 5 {
+			t.Errorf("Expected total 5, got %d", page.Total)
+		}
+		got = append(got, ids(page.Items)...)
+		if page.NextCursor == "" {
+			break
+		}
+		q.Cursor = page.NextCursor
+	}
+	want := []string{"claude-3-opus", "claude-3-haiku", "gemini-pro", "gpt-3.5-turbo", "gpt-4"}
+	if len(got) != len(want) {
+		t.Fatalf("Expected %v, got %v", want, got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("Expected %v, got %v", want, got)
+		}
+	}
+}
+
+func TestListCursorIsStable(t *testing.T) {
+	q := mustQuery(t, "limit=2")
+	page, _ := List(catalog, modelKey, modelFields, q)
+	if ids(page.Items)[1] != "claude-3-opus" {
+		t.Fatalf("Unexpected first page %v", ids(page.Items))
+	}
+
+	// Removing the cursor's item and adding one before it does not shift the next page
+	changed := []model{catalog[0], catalog[2], catalog[3], catalog[4], {"claude-2", "anthropic", 100000}}
+	q.Cursor = page.NextCursor
+	page, err := List(changed, modelKey, modelFields, q)
+	if err != nil {
+		t.Fatalf("List() error = %v", err)
+	}
+	if got := ids(page.Items); len(got) != 2 || got[0] != "gemini-pro" || got[1] != "gpt-3.5-turbo" {
+		t.Errorf("Expected the page after claude-3-opus, got %v", got)
+	}
+}
+
+func TestListFilters(t *testing.T) {
+	page, err := List(catalog, modelKey, modelFields, mustQuery(t, "provider=OpenAI&provider=google"))
+	if err != nil {
+		t.Fatalf("List() error = %v", err)
+	}
+	if got := ids(page.Items); page.Total != 3 || got[0] != "gemini-pro" {
+		t.Errorf("Expected the OpenAI and Google models, got %v", got)
+	}
+}
+
+func TestListInvalidQueries(t *testing.T) {
+	if _, err := ParseQuery(url.Values{"limit": {"0"}}); !errors.Is(err, ErrInvalidQuery) {
+		t.Errorf("Expected ErrInvalidQuery for limit 0, got %v", err)
+	}
+
+	for _, raw := range []string{"sort=version", "version=1", "cursor=garbage"} {
+		if _, err := List(catalog, modelKey, modelFields, mustQuery(t, raw)); !errors.Is(err, ErrInvalidQuery) {
+			t.Errorf("Expected ErrInvalidQuery for %q, got %v", raw, err)
+		}
+	}
+
+	// A cursor only continues the sort order it was issued for
+	page, _ := List(catalog, modelKey, modelFields, mustQuery(t, "limit=1&sort=maxTokens"))
+	q := mustQuery(t, "limit=1&sort=-maxTokens")
+	q.Cursor = page.NextCursor
+	if _, err := List(catalog, modelKey, modelFields, q); !errors.Is(err, ErrInvalidQuery) {
+		t.Errorf("Expected ErrInvalidQuery for a cursor of another sort order, got %v", err)
+	}
+}
@@ -0,0 +1,149 @@
+package redisx
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Tracer starts a span for a Redis operation. The returned function ends the span and
+// receives the operation's error, which is nil on success and for missing keys.
+// Adapters for a tracing library implement this interface.
+type Tracer interface {
+	Start(ctx context.Context, operation string) (context.Context, func(err error))
+}
+
+// Metrics accumulates command counts, errors and latency. It is safe for concurrent use.
+type Metrics struct {
+	commands   atomic.Int64
+	errors     atomic.Int64
+	dialErrors atomic.Int64
+	latencyNs  atomic.Int64
+
+	mu        sync.Mutex
+	byCommand map[string]int64
+}
+
+// Stats is a point-in-time copy of a client's metrics.
+type Stats struct {
+	Commands     int64
+	Errors       int64
+	DialErrors   int64
+	TotalLatency time.Duration
+	ByCommand    map[string]int64
+	Pool         PoolStats
+}
+
+// PoolStats reports connection pool usage.
+type PoolStats struct {
+	Hits       uint32 // Free connection found in the pool
+	Misses     uint32 // New connection had to be dialed
+	Timeouts   uint32 // Wait for a free connection timed out
+	TotalConns uint32
+	IdleConns  uint32
+}
+
+// Snapshot returns the current metrics.
+func (m *Metrics) Snapshot() Stats {
+	m.mu.Lock()
+	byCommand := make(map[string]int64, len(m.byCommand))
+	for name, n := range m.byCommand {
+		byCommand[name] = n
+	}
+	m.mu.Unlock()
+
+	return Stats{
+		Commands:     m.commands.Load(),
+		Errors:       m.errors.Load(),
+		DialErrors:   m.dialErrors.Load(),
+		TotalLatency: time.Duration(m.latencyNs.Load()),
+		ByCommand:    byCommand,
+	}
+}
+
+func (m *Metrics) record(cmds []redis.Cmder, elapsed time.Duration) {
+	m.latencyNs.Add(int64(elapsed))
+
+	m.mu.Lock()
+	if m.byCommand == nil {
+		m.byCommand = make(map[string]int64)
+	}
+	for _, cmd := range cmds {
+		m.byCommand[cmd.Name()]++
+	}
+	m.mu.Unlock()
+
+	for _, cmd := range cmds {
+		m.commands.Add(1)
+		if isFailure(cmd.Err()) {
+			m.errors.Add(1)
+		}
+	}
+}
+
+// instrumentation is the go-redis hook that feeds Metrics and Tracer.
+type instrumentation struct {
+	metrics *Metrics
+	tracer  Tracer
+}
+
+// DialHook counts failed dials.
+func (h *instrumentation) DialHook(next redis.DialHook) redis.DialHook {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		ctx, end := h.start(ctx, "redis.dial")
+		conn, err := next(ctx, network, addr)
+		if err != nil {
+			h.metrics.dialErrors.Add(1)
+		}
+		end(err)
+		return conn, err
+	}
+}
+
+// ProcessHook instruments single commands.
+func (h *instrumentation) ProcessHook(next redis.ProcessHook) redis.ProcessHook {
+	return func(ctx context.Context, cmd redis.Cmder) error {
+		ctx, end := h.start(ctx, "redis."+cmd.Name())
+		start := time.Now()
+		err := next(ctx, cmd)
+		h.metrics.record([]redis.Cmder{cmd}, time.Since(start))
+		end(failure(err))
+		return err
+	}
+}
+
+// ProcessPipelineHook instruments pipelines and transactions.
+func (h *instrumentation) ProcessPipelineHook(next redis.ProcessPipelineHook) redis.ProcessPipelineHook {
+	return func(ctx context.Context, cmds []redis.Cmder) error {
+		ctx, end := h.start(ctx, "redis.pipeline")
+		start := time.Now()
+		err := next(ctx, cmds)
+		h.metrics.record(cmds, time.Since(start))
+		end(failure(err))
+		return err
+	}
+}
+
+func (h *instrumentation) start(ctx context.Context, operation string) (context.Context, func(error)) {
+	if h.tracer == nil {
+		return ctx, func(error) {}
+	}
+	return h.tracer.Start(ctx, operation)
+}
+
+// isFailure reports whether err is a real failure; a missing key is a normal result.
+func isFailure(err error) bool {
+	return err != nil && !errors.Is(err, redis.Nil)
+}
+
+func failure(err error) error {
+	if isFailure(err) {
+		return err
+	}
+	return nil
+}
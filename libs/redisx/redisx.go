@@ -0,0 +1,189 @@
+// Package redisx builds instrumented Redis clients from config.RedisConfig.
+//
+// Subsystems that need Redis (caching, rate limiting, queues, sessions) should take a
+// *redisx.Client instead of dialing Redis themselves, so pooling, TLS, topology and
+// instrumentation are configured in one place.
+package redisx
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+
+	"github.com/redis/go-redis/v9"
+
+	"github.com/nexen/config"
+)
+
+// Nil is returned by commands when a key does not exist.
+const Nil = redis.Nil
+
+// Client is a Redis client for a standalone, cluster, or sentinel deployment.
+type Client struct {
+	redis.UniversalClient
+	metrics *Metrics
+}
+
+// options holds the settings applied by Option.
+type options struct {
+	clientName string
+	tracer     Tracer
+	metrics    *Metrics
+}
+
+// Option configures a Client.
+type Option func(*options)
+
+// WithClientName sets the name reported by CLIENT LIST for each connection.
+func WithClientName(name string) Option {
+	return func(o *options) {
+		o.clientName = name
+	}
+}
+
+// WithTracer traces every command and pipeline with t.
+func WithTracer(t Tracer) Option {
+	return func(o *options) {
+		o.tracer = t
+	}
+}
+
+// WithMetrics records command metrics into m instead of a new Metrics.
+// Sharing one Metrics between clients aggregates their counts.
+func WithMetrics(m *Metrics) Option {
+	return func(o *options) {
+		o.metrics = m
+	}
+}
+
+// New creates a client for cfg. It does not connect; use Check to verify connectivity.
+func New(cfg config.RedisConfig, opts ...Option) (*Client, error) {
+	o := &options{}
+	for _, opt := range opts {
+		opt(o)
+	}
+	if o.metrics == nil {
+		o.metrics = &Metrics{}
+	}
+
+	universal, err := universalOptions(cfg)
+	if err != nil {
+		return nil, err
+	}
+	universal.ClientName = o.clientName
+
+	var client redis.UniversalClient
+	switch cfg.Mode {
+	case config.RedisModeCluster:
+		client = redis.NewClusterClient(universal.Cluster())
+	case config.RedisModeSentinel:
+		client = redis.NewFailoverClient(universal.Failover())
+	default:
+		client = redis.NewClient(universal.Simple())
+	}
+	client.AddHook(&instrumentation{metrics: o.metrics, tracer: o.tracer})
+
+	return &Client{UniversalClient: client, metrics: o.metrics}, nil
+}
+
+// universalOptions maps cfg to go-redis options.
+func universalOptions(cfg config.RedisConfig) (*redis.UniversalOptions, error) {
+	addrs := cfg.Nodes()
+	if len(addrs) == 0 {
+		return nil, fmt.Errorf("redis address is required")
+	}
+
+	switch cfg.Mode {
+	case "", config.RedisModeStandalone, config.RedisModeCluster:
+	case config.RedisModeSentinel:
+		if cfg.MasterName == "" {
+			return nil, fmt.Errorf("redis sentinel mode requires a master name")
+		}
+	default:
+		return nil, fmt.Errorf("unknown redis mode %q", cfg.Mode)
+	}
+
+	tlsConfig, err := TLSConfig(cfg.TLS)
+	if err != nil {
+		return nil, err
+	}
+
+	return &redis.UniversalOptions{
+		Addrs:        addrs,
+		DB:           cfg.DB,
+		Username:     cfg.Username,
+		Password:     cfg.Password,
+		MasterName:   cfg.MasterName,
+		DialTimeout:  cfg.Timeout,
+		ReadTimeout:  cfg.Timeout,
+		WriteTimeout: cfg.Timeout,
+		PoolSize:     cfg.PoolSize,
+		MinIdleConns: cfg.MinIdleConns,
+		TLSConfig:    tlsConfig,
+	}, nil
+}
+
+// TLSConfig builds a *tls.Config from cfg, or returns nil when TLS is disabled.
+func TLSConfig(cfg config.RedisTLSConfig) (*tls.Config, error) {
+	if !cfg.Enabled {
+		return nil, nil
+	}
+
+	tlsConfig := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		ServerName:         cfg.ServerName,
+		InsecureSkipVerify: cfg.InsecureSkipVerify,
+	}
+
+	if cfg.CAFile != "" {
+		pem, err := os.ReadFile(cfg.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("reading redis CA file: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in redis CA file %s", cfg.CAFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	if cfg.CertFile != "" || cfg.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(cfg.CertFile, cfg.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("loading redis client certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	return tlsConfig, nil
+}
+
+// Check pings Redis and reports whether it is reachable.
+func (c *Client) Check(ctx context.Context) error {
+	if err := c.UniversalClient.Ping(ctx).Err(); err != nil {
+		return fmt.Errorf("pinging redis: %w", err)
+	}
+	return nil
+}
+
+// Metrics returns the client's command metrics.
+func (c *Client) Metrics() *Metrics {
+	return c.metrics
+}
+
+// Stats returns a snapshot of the command metrics together with connection pool statistics.
+func (c *Client) Stats() Stats {
+	stats := c.metrics.Snapshot()
+	if pool := c.PoolStats(); pool != nil {
+		stats.Pool = PoolStats{
+			Hits:       pool.Hits,
+			Misses:     pool.Misses,
+			Timeouts:   pool.Timeouts,
+			TotalConns: pool.TotalConns,
+			IdleConns:  pool.IdleConns,
+		}
+	}
+	return stats
+}
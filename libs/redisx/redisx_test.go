@@ -0,0 +1,137 @@
+package redisx
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"github.com/nexen/config"
+)
+
+func TestUniversalOptions(t *testing.T) {
+	opts, err := universalOptions(config.RedisConfig{
+		Address:      "localhost:6379",
+		DB:           2,
+		Timeout:      3 * time.Second,
+		Password:     "secret",
+		PoolSize:     20,
+		MinIdleConns: 5,
+	})
+	if err != nil {
+		t.Fatalf("universalOptions() error = %v", err)
+	}
+	if len(opts.Addrs) != 1 || opts.Addrs[0] != "localhost:6379" {
+		t.Errorf("Unexpected addresses %v", opts.Addrs)
+	}
+	if opts.DB != 2 || opts.PoolSize != 20 || opts.MinIdleConns != 5 || opts.ReadTimeout != 3*time.Second {
+		t.Errorf("Options not mapped: %+v", opts)
+	}
+	if opts.TLSConfig != nil {
+		t.Error("Expected no TLS config when TLS is disabled")
+	}
+
+	testCases := []struct {
+		name string
+		cfg  config.RedisConfig
+	}{
+		{"no address", config.RedisConfig{}},
+		{"sentinel without master", config.RedisConfig{Address: "a:1", Mode: config.RedisModeSentinel}},
+		{"unknown mode", config.RedisConfig{Address: "a:1", Mode: "ring"}},
+		{"missing CA file", config.RedisConfig{Address: "a:1", TLS: config.RedisTLSConfig{Enabled: true, CAFile: "/nonexistent"}}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if _, err := universalOptions(tc.cfg); err == nil {
+				t.Error("Expected error")
+			}
+		})
+	}
+}
+
+func TestNewSelectsTopology(t *testing.T) {
+	testCases := []struct {
+		mode string
+		want any
+	}{
+		{config.RedisModeStandalone, &redis.Client{}},
+		{config.RedisModeCluster, &redis.ClusterClient{}},
+		{config.RedisModeSentinel, &redis.Client{}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.mode, func(t *testing.T) {
+			client, err := New(config.RedisConfig{
+				Addresses:  []string{"localhost:26379", "localhost:26380"},
+				Mode:       tc.mode,
+				MasterName: "primary",
+				TLS:        config.RedisTLSConfig{Enabled: true},
+			})
+			if err != nil {
+				t.Fatalf("New() error = %v", err)
+			}
+			defer client.Close()
+
+			switch tc.want.(type) {
+			case *redis.ClusterClient:
+				if _, ok := client.UniversalClient.(*redis.ClusterClient); !ok {
+					t.Errorf("Expected cluster client, got %T", client.UniversalClient)
+				}
+			default:
+				if _, ok := client.UniversalClient.(*redis.Client); !ok {
+					t.Errorf("Expected single-node client, got %T", client.UniversalClient)
+				}
+			}
+		})
+	}
+}
+
+// recordingTracer records the operations it was asked to trace.
+type recordingTracer struct {
+	operations []string
+	errs       []error
+}
+
+func (r *recordingTracer) Start(ctx context.Context, operation string) (context.Context, func(error)) {
+	r.operations = append(r.operations, operation)
+	return ctx, func(err error) { r.errs = append(r.errs, err) }
+}
+
+func TestInstrumentation(t *testing.T) {
+	metrics := &Metrics{}
+	tracer := &recordingTracer{}
+	hook := &instrumentation{metrics: metrics, tracer: tracer}
+
+	process := hook.ProcessHook(func(ctx context.Context, cmd redis.Cmder) error {
+		cmd.SetErr(redis.Nil)
+		return redis.Nil
+	})
+	process(context.Background(), redis.NewStringCmd(context.Background(), "get", "missing"))
+
+	boom := errors.New("boom")
+	pipeline := hook.ProcessPipelineHook(func(ctx context.Context, cmds []redis.Cmder) error {
+		cmds[1].SetErr(boom)
+		return boom
+	})
+	pipeline(context.Background(), []redis.Cmder{
+		redis.NewStatusCmd(context.Background(), "set", "k", "v"),
+		redis.NewIntCmd(context.Background(), "incr", "k"),
+	})
+
+	stats := metrics.Snapshot()
+	if stats.Commands != 3 || stats.Errors != 1 {
+		t.Errorf("Expected 3 commands and 1 error, got %d and %d", stats.Commands, stats.Errors)
+	}
+	if stats.ByCommand["get"] != 1 || stats.ByCommand["incr"] != 1 {
+		t.Errorf("Unexpected per-command counts %v", stats.ByCommand)
+	}
+
+	if len(tracer.operations) != 2 || tracer.operations[0] != "redis.get" || tracer.operations[1] != "redis.pipeline" {
+		t.Errorf("Unexpected traced operations %v", tracer.operations)
+	}
+	if tracer.errs[0] != nil || !errors.Is(tracer.errs[1], boom) {
+		t.Errorf("Expected missing key to end span without error, got %v", tracer.errs)
+	}
+}
@@ -0,0 +1,203 @@
+package store
+
+import (
+	"context"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Memory is an in-process Backend. Data is lost when the process exits and is not shared
+// between replicas, so it suits tests, local development and single-instance deployments.
+type Memory struct {
+	mu     sync.Mutex
+	items  map[string]memoryItem
+	queues map[string][]queuedItem
+	seq    uint64
+
+	// now is replaceable in tests
+	now func() time.Time
+}
+
+type memoryItem struct {
+	value   []byte
+	written time.Time
+	expires time.Time // zero means no expiry
+}
+
+type queuedItem struct {
+	due     time.Time
+	seq     uint64
+	payload []byte
+}
+
+// NewMemory creates an empty in-memory backend.
+func NewMemory() *Memory {
+	return &Memory{
+		items:  make(map[string]memoryItem),
+		queues: make(map[string][]queuedItem),
+		now:    time.Now,
+	}
+}
+
+// lookup returns the live item at key, removing it if it has expired. Callers hold m.mu.
+func (m *Memory) lookup(key string) (memoryItem, bool) {
+	item, ok := m.items[key]
+	if !ok {
+		return item, false
+	}
+	if !item.expires.IsZero() && !m.now().Before(item.expires) {
+		delete(m.items, key)
+		return item, false
+	}
+	return item, true
+}
+
+func (m *Memory) expiry(ttl time.Duration) time.Time {
+	if ttl <= 0 {
+		return time.Time{}
+	}
+	return m.now().Add(ttl)
+}
+
+// Get implements Store.
+func (m *Memory) Get(ctx context.Context, key string) ([]byte, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	item, ok := m.lookup(key)
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return append([]byte(nil), item.value...), nil
+}
+
+// Set implements Store.
+func (m *Memory) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.items[key] = memoryItem{value: append([]byte(nil), value...), written: m.now(), expires: m.expiry(ttl)}
+	return nil
+}
+
+// SetNX implements Store.
+func (m *Memory) SetNX(ctx context.Context, key string, value []byte, ttl time.Duration) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.lookup(key); ok {
+		return false, nil
+	}
+	m.items[key] = memoryItem{value: append([]byte(nil), value...), written: m.now(), expires: m.expiry(ttl)}
+	return true, nil
+}
+
+// Delete implements Store.
+func (m *Memory) Delete(ctx context.Context, keys ...string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, key := range keys {
+		delete(m.items, key)
+	}
+	return nil
+}
+
+// IncrBy implements Store.
+func (m *Memory) IncrBy(ctx context.Context, key string, n int64, ttl time.Duration) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	item, ok := m.lookup(key)
+	var current int64
+	if ok {
+		var err error
+		if current, err = strconv.ParseInt(string(item.value), 10, 64); err != nil {
+			return 0, err
+		}
+	} else {
+		item.expires = m.expiry(ttl)
+	}
+
+	current += n
+	item.value = []byte(strconv.FormatInt(current, 10))
+	item.written = m.now()
+	m.items[key] = item
+	return current, nil
+}
+
+// Scan implements Scanner. It also removes the expired keys it passes, which are otherwise
+// only removed when read.
+func (m *Memory) Scan(ctx context.Context, prefix string, fn func(key string, idle time.Duration) error) error {
+	type scanned struct {
+		key  string
+		idle time.Duration
+	}
+	m.mu.Lock()
+	now := m.now()
+	var keys []scanned
+	for key := range m.items {
+		if !strings.HasPrefix(key, prefix) {
+			continue
+		}
+		if item, ok := m.lookup(key); ok {
+			keys = append(keys, scanned{key, now.Sub(item.written)})
+		}
+	}
+	m.mu.Unlock()
+
+	// fn runs unlocked so that it can modify the store
+	for _, k := range keys {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := fn(k.key, k.idle); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Push implements Queue.
+func (m *Memory) Push(ctx context.Context, queue string, payload []byte, at time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.seq++
+	items := append(m.queues[queue], queuedItem{due: at, seq: m.seq, payload: append([]byte(nil), payload...)})
+	// Keep items ordered by due time, then insertion order
+	sort.SliceStable(items, func(i, j int) bool {
+		if items[i].due.Equal(items[j].due) {
+			return items[i].seq < items[j].seq
+		}
+		return items[i].due.Before(items[j].due)
+	})
+	m.queues[queue] = items
+	return nil
+}
+
+// PopDue implements Queue.
+func (m *Memory) PopDue(ctx context.Context, queue string, now time.Time, limit int) ([][]byte, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	items := m.queues[queue]
+	var due [][]byte
+	for len(items) > 0 && len(due) < limit && !items[0].due.After(now) {
+		due = append(due, items[0].payload)
+		items = items[1:]
+	}
+	m.queues[queue] = items
+	return due, nil
+}
+
+// Len implements Queue.
+func (m *Memory) Len(ctx context.Context, queue string) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return int64(len(m.queues[queue])), nil
+}
+
+// Close implements Backend. The memory backend holds no external resources.
+func (m *Memory) Close() error {
+	return nil
+}
@@ -0,0 +1,186 @@
+package store
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"github.com/nexen/libs/redisx"
+)
+
+// Redis is a Backend stored in Redis, shared by every replica using the same deployment.
+type Redis struct {
+	client *redisx.Client
+}
+
+// NewRedis creates a backend on an existing client. Close closes the client.
+func NewRedis(client *redisx.Client) *Redis {
+	return &Redis{client: client}
+}
+
+// incrScript increments a counter and sets its expiry only when the counter is created.
+var incrScript = redis.NewScript(`
+local v = redis.call("INCRBY", KEYS[1], ARGV[1])
+if v == tonumber(ARGV[1]) and tonumber(ARGV[2]) > 0 then
+	redis.call("PEXPIRE", KEYS[1], ARGV[2])
+end
+return v
+`)
+
+// popDueScript atomically removes and returns due members of a sorted set.
+var popDueScript = redis.NewScript(`
+local items = redis.call("ZRANGEBYSCORE", KEYS[1], "-inf", ARGV[1], "LIMIT", 0, ARGV[2])
+if #items > 0 then
+	redis.call("ZREM", KEYS[1], unpack(items))
+end
+return items
+`)
+
+// memberIDLength is the length of the random prefix that keeps identical payloads distinct.
+const memberIDLength = 16
+
+// Get implements Store.
+func (r *Redis) Get(ctx context.Context, key string) ([]byte, error) {
+	value, err := r.client.Get(ctx, key).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("getting %s: %w", key, err)
+	}
+	return value, nil
+}
+
+// Set implements Store.
+func (r *Redis) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	if err := r.client.Set(ctx, key, value, ttl).Err(); err != nil {
+		return fmt.Errorf("setting %s: %w", key, err)
+	}
+	return nil
+}
+
+// SetNX implements Store.
+func (r *Redis) SetNX(ctx context.Context, key string, value []byte, ttl time.Duration) (bool, error) {
+	ok, err := r.client.SetNX(ctx, key, value, ttl).Result()
+	if err != nil {
+		return false, fmt.Errorf("setting %s: %w", key, err)
+	}
+	return ok, nil
+}
+
+// Delete implements Store.
+func (r *Redis) Delete(ctx context.Context, keys ...string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+	if err := r.client.Del(ctx, keys...).Err(); err != nil {
+		return fmt.Errorf("deleting keys: %w", err)
+	}
+	return nil
+}
+
+// IncrBy implements Store.
+func (r *Redis) IncrBy(ctx context.Context, key string, n int64, ttl time.Duration) (int64, error) {
+	value, err := incrScript.Run(ctx, r.client, []string{key}, n, ttl.Milliseconds()).Int64()
+	if err != nil {
+		return 0, fmt.Errorf("incrementing %s: %w", key, err)
+	}
+	return value, nil
+}
+
+// scanCount is the number of keys Scan asks Redis for per SCAN call.
+const scanCount = 500
+
+// Scan implements Scanner. It walks string keys only, so queues are never reported, and on a
+// cluster it walks every master.
+func (r *Redis) Scan(ctx context.Context, prefix string, fn func(key string, idle time.Duration) error) error {
+	if cluster, ok := r.client.UniversalClient.(*redis.ClusterClient); ok {
+		return cluster.ForEachMaster(ctx, func(ctx context.Context, node *redis.Client) error {
+			return scanNode(ctx, node, prefix, fn)
+		})
+	}
+	return scanNode(ctx, r.client, prefix, fn)
+}
+
+// scanNode scans the string keys of one node.
+func scanNode(ctx context.Context, node redis.Cmdable, prefix string, fn func(key string, idle time.Duration) error) error {
+	match := globEscaper.Replace(prefix) + "*"
+	var cursor uint64
+	for {
+		keys, next, err := node.ScanType(ctx, cursor, match, scanCount, "string").Result()
+		if err != nil {
+			return fmt.Errorf("scanning %s: %w", prefix, err)
+		}
+		for _, key := range keys {
+			idle, err := node.ObjectIdleTime(ctx, key).Result()
+			if errors.Is(err, redis.Nil) {
+				continue // deleted since the scan
+			}
+			if err != nil {
+				return fmt.Errorf("reading idle time of %s: %w", key, err)
+			}
+			if err := fn(key, idle); err != nil {
+				return err
+			}
+		}
+		if next == 0 {
+			return nil
+		}
+		cursor = next
+	}
+}
+
+// globEscaper escapes the characters that are special in SCAN MATCH patterns.
+var globEscaper = strings.NewReplacer(`\`, `\\`, "*", `\*`, "?", `\?`, "[", `\[`, "]", `\]`)
+
+// Push implements Queue.
+func (r *Redis) Push(ctx context.Context, queue string, payload []byte, at time.Time) error {
+	id := make([]byte, memberIDLength/2)
+	if _, err := rand.Read(id); err != nil {
+		return fmt.Errorf("generating queue member id: %w", err)
+	}
+	member := hex.EncodeToString(id) + string(payload)
+
+	if err := r.client.ZAdd(ctx, queue, redis.Z{Score: float64(at.UnixMilli()), Member: member}).Err(); err != nil {
+		return fmt.Errorf("pushing to %s: %w", queue, err)
+	}
+	return nil
+}
+
+// PopDue implements Queue.
+func (r *Redis) PopDue(ctx context.Context, queue string, now time.Time, limit int) ([][]byte, error) {
+	members, err := popDueScript.Run(ctx, r.client, []string{queue}, strconv.FormatInt(now.UnixMilli(), 10), limit).StringSlice()
+	if err != nil {
+		return nil, fmt.Errorf("popping from %s: %w", queue, err)
+	}
+
+	payloads := make([][]byte, 0, len(members))
+	for _, member := range members {
+		if len(member) < memberIDLength {
+			continue
+		}
+		payloads = append(payloads, []byte(member[memberIDLength:]))
+	}
+	return payloads, nil
+}
+
+// Len implements Queue.
+func (r *Redis) Len(ctx context.Context, queue string) (int64, error) {
+	n, err := r.client.ZCard(ctx, queue).Result()
+	if err != nil {
+		return 0, fmt.Errorf("counting %s: %w", queue, err)
+	}
+	return n, nil
+}
+
+// Close implements Backend.
+func (r *Redis) Close() error {
+	return r.client.Close()
+}
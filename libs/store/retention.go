@@ -0,0 +1,143 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/nexen/config"
+)
+
+// Janitor deletes keys that have outlived the retention policy: expired sessions, old jobs,
+// stale cache namespaces and aged usage records. Each rule of config.RetentionConfig deletes
+// the keys under its prefix that have not been written for longer than its max age.
+type Janitor struct {
+	scanner Scanner
+	store   Store
+	cfg     config.RetentionConfig
+
+	mu    sync.Mutex
+	stats map[string]RetentionStats
+}
+
+// RetentionStats are the cumulative results of one retention rule.
+type RetentionStats struct {
+	Rule string
+
+	// Runs is the number of cleanup runs of the rule.
+	Runs int64
+	// Scanned is the number of keys examined.
+	Scanned int64
+	// Expired is the number of keys past the rule's max age, deleted or, in dry-run mode,
+	// that would have been deleted.
+	Expired int64
+	// Deleted is the number of keys deleted.
+	Deleted int64
+	// Errors is the number of runs that failed.
+	Errors int64
+
+	LastRun   time.Time
+	LastError string
+}
+
+// NewJanitor returns a Janitor applying cfg to backend.
+func NewJanitor(backend Backend, cfg config.RetentionConfig) *Janitor {
+	return &Janitor{scanner: backend, store: backend, cfg: cfg, stats: make(map[string]RetentionStats)}
+}
+
+// Run cleans up every cfg.Interval until ctx is done. Failures are logged and retried on the
+// next run.
+func (j *Janitor) Run(ctx context.Context) {
+	ticker := time.NewTicker(j.cfg.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := j.RunOnce(ctx); err != nil && ctx.Err() == nil {
+				slog.WarnContext(ctx, "retention cleanup failed", "error", err)
+			}
+		}
+	}
+}
+
+// RunOnce applies every rule with a max age once, and returns the errors of the rules that
+// failed.
+func (j *Janitor) RunOnce(ctx context.Context) error {
+	var errs []error
+	for _, name := range j.ruleNames() {
+		if err := j.apply(ctx, name, j.cfg.Rules()[name]); err != nil {
+			errs = append(errs, fmt.Errorf("retention rule %s: %w", name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Stats returns the statistics of every rule that has run, sorted by rule name.
+func (j *Janitor) Stats() []RetentionStats {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	stats := make([]RetentionStats, 0, len(j.stats))
+	for _, s := range j.stats {
+		stats = append(stats, s)
+	}
+	sort.Slice(stats, func(a, b int) bool { return stats[a].Rule < stats[b].Rule })
+	return stats
+}
+
+// ruleNames returns the names of the rules with a max age, sorted.
+func (j *Janitor) ruleNames() []string {
+	var names []string
+	for name, rule := range j.cfg.Rules() {
+		if rule.MaxAge > 0 && rule.Prefix != "" {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// apply runs one rule and records its results.
+func (j *Janitor) apply(ctx context.Context, name string, rule config.RetentionRule) error {
+	var scanned, expired, deleted int64
+	err := j.scanner.Scan(ctx, rule.Prefix, func(key string, idle time.Duration) error {
+		scanned++
+		if idle <= rule.MaxAge {
+			return nil
+		}
+		expired++
+		if j.cfg.DryRun {
+			return nil
+		}
+		if err := j.store.Delete(ctx, key); err != nil {
+			return err
+		}
+		deleted++
+		return nil
+	})
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	s := j.stats[name]
+	s.Rule = name
+	s.Runs++
+	s.Scanned += scanned
+	s.Expired += expired
+	s.Deleted += deleted
+	s.LastRun = time.Now()
+	s.LastError = ""
+	if err != nil {
+		s.Errors++
+		s.LastError = err.Error()
+	}
+	j.stats[name] = s
+
+	slog.InfoContext(ctx, "retention cleanup", "rule", name, "prefix", rule.Prefix, "dry_run", j.cfg.DryRun,
+		"scanned", scanned, "expired", expired, "deleted", deleted)
+	return err
+}
@@ -0,0 +1,80 @@
+// Package store defines the storage primitives used by Redis-backed features such as
+// caching, rate limiting, sessions and job queues, with Redis and in-memory implementations.
+//
+// Features depend on the Store and Queue interfaces rather than on Redis directly. Open
+// returns the Redis implementation when Redis is configured and the in-memory one otherwise,
+// so library users and tests do not need a Redis server.
+package store
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/nexen/config"
+	"github.com/nexen/libs/redisx"
+)
+
+// ErrNotFound is returned by Get when the key does not exist or has expired.
+var ErrNotFound = errors.New("store: key not found")
+
+// Store is a key-value store with expiry and atomic counters.
+type Store interface {
+	// Get returns the value stored at key, or ErrNotFound.
+	Get(ctx context.Context, key string) ([]byte, error)
+
+	// Set stores value at key. A ttl of 0 means the key does not expire.
+	Set(ctx context.Context, key string, value []byte, ttl time.Duration) error
+
+	// SetNX stores value only if key does not exist and reports whether it was stored.
+	SetNX(ctx context.Context, key string, value []byte, ttl time.Duration) (bool, error)
+
+	// Delete removes keys. Missing keys are ignored.
+	Delete(ctx context.Context, keys ...string) error
+
+	// IncrBy adds n to the counter at key and returns the new value. A new counter starts at
+	// zero and expires after ttl; later increments do not extend the expiry, which makes
+	// counters suitable for fixed rate-limit and usage windows.
+	IncrBy(ctx context.Context, key string, n int64, ttl time.Duration) (int64, error)
+}
+
+// Queue is a set of delayed job queues. Payloads become due at the time they were pushed for.
+type Queue interface {
+	// Push schedules payload on queue to become due at the given time.
+	Push(ctx context.Context, queue string, payload []byte, at time.Time) error
+
+	// PopDue removes and returns up to limit payloads that are due at now, earliest first.
+	PopDue(ctx context.Context, queue string, now time.Time, limit int) ([][]byte, error)
+
+	// Len returns the number of payloads on queue, due or not.
+	Len(ctx context.Context, queue string) (int64, error)
+}
+
+// Scanner lists keys for maintenance jobs such as the retention janitor.
+type Scanner interface {
+	// Scan calls fn for each key starting with prefix, with the time since the key was last
+	// written (the Redis backend reports the time since it was last accessed). Keys written
+	// during a scan may be missed. Scan stops at the first error fn returns.
+	Scan(ctx context.Context, prefix string, fn func(key string, idle time.Duration) error) error
+}
+
+// Backend provides the primitives and releases its resources on Close.
+type Backend interface {
+	Store
+	Queue
+	Scanner
+	Close() error
+}
+
+// Open returns a Redis backend when cfg names at least one Redis address, and an in-memory
+// backend otherwise. Set NEXEN_REDIS_ADDRESS to an empty string to run without Redis.
+func Open(cfg config.RedisConfig, opts ...redisx.Option) (Backend, error) {
+	if len(cfg.Nodes()) == 0 {
+		return NewMemory(), nil
+	}
+	client, err := redisx.New(cfg, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return NewRedis(client), nil
+}
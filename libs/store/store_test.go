@@ -0,0 +1,163 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/nexen/config"
+)
+
+func TestOpenWithoutRedisUsesMemory(t *testing.T) {
+	backend, err := Open(config.RedisConfig{})
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	defer backend.Close()
+	if _, ok := backend.(*Memory); !ok {
+		t.Errorf("Expected in-memory backend, got %T", backend)
+	}
+
+	backend, err = Open(config.RedisConfig{Address: "localhost:6379"})
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	defer backend.Close()
+	if _, ok := backend.(*Redis); !ok {
+		t.Errorf("Expected Redis backend, got %T", backend)
+	}
+}
+
+func TestMemoryStore(t *testing.T) {
+	ctx := context.Background()
+	now := time.Unix(1000, 0)
+	m := NewMemory()
+	m.now = func() time.Time { return now }
+
+	if _, err := m.Get(ctx, "missing"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected ErrNotFound, got %v", err)
+	}
+
+	m.Set(ctx, "session", []byte("alice"), time.Minute)
+	if v, err := m.Get(ctx, "session"); err != nil || string(v) != "alice" {
+		t.Errorf("Get() = %q, %v", v, err)
+	}
+	if ok, _ := m.SetNX(ctx, "session", []byte("bob"), 0); ok {
+		t.Error("SetNX should not overwrite an existing key")
+	}
+
+	now = now.Add(time.Minute)
+	if _, err := m.Get(ctx, "session"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected key to expire, got %v", err)
+	}
+	if ok, _ := m.SetNX(ctx, "session", []byte("bob"), 0); !ok {
+		t.Error("SetNX should store after expiry")
+	}
+
+	m.Delete(ctx, "session")
+	if _, err := m.Get(ctx, "session"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected deleted key to be gone, got %v", err)
+	}
+}
+
+func TestMemoryCounterWindow(t *testing.T) {
+	ctx := context.Background()
+	now := time.Unix(1000, 0)
+	m := NewMemory()
+	m.now = func() time.Time { return now }
+
+	for i := 1; i <= 3; i++ {
+		n, err := m.IncrBy(ctx, "requests", 1, time.Minute)
+		if err != nil || n != int64(i) {
+			t.Fatalf("IncrBy() = %d, %v; want %d", n, err, i)
+		}
+		now = now.Add(10 * time.Second)
+	}
+
+	// Later increments do not extend the window
+	now = time.Unix(1000, 0).Add(time.Minute)
+	if n, _ := m.IncrBy(ctx, "requests", 5, time.Minute); n != 5 {
+		t.Errorf("Expected a fresh window, got %d", n)
+	}
+}
+
+func TestMemoryQueue(t *testing.T) {
+	ctx := context.Background()
+	m := NewMemory()
+	base := time.Unix(1000, 0)
+
+	m.Push(ctx, "retries", []byte("later"), base.Add(time.Hour))
+	m.Push(ctx, "retries", []byte("second"), base.Add(time.Second))
+	m.Push(ctx, "retries", []byte("first"), base)
+	m.Push(ctx, "retries", []byte("first-dup"), base)
+
+	if n, _ := m.Len(ctx, "retries"); n != 4 {
+		t.Errorf("Expected 4 queued, got %d", n)
+	}
+
+	due, err := m.PopDue(ctx, "retries", base.Add(time.Minute), 10)
+	if err != nil {
+		t.Fatalf("PopDue() error = %v", err)
+	}
+	var got []string
+	for _, p := range due {
+		got = append(got, string(p))
+	}
+	if len(got) != 3 || got[0] != "first" || got[1] != "first-dup" || got[2] != "second" {
+		t.Errorf("Unexpected due payloads %v", got)
+	}
+	if n, _ := m.Len(ctx, "retries"); n != 1 {
+		t.Errorf("Expected 1 remaining, got %d", n)
+	}
+}
+
+func TestJanitor(t *testing.T) {
+	ctx := context.Background()
+	now := time.Unix(1000, 0)
+	m := NewMemory()
+	m.now = func() time.Time { return now }
+
+	m.Set(ctx, "session:old", []byte("a"), 0)
+	m.Set(ctx, "session:gone", []byte("b"), time.Minute)
+	m.Set(ctx, "usage:acme:2026-01", []byte("1"), 0)
+	now = now.Add(2 * time.Hour)
+	m.Set(ctx, "session:new", []byte("c"), 0)
+	m.IncrBy(ctx, "usage:acme:2026-01", 1, 0) // an update keeps the record
+
+	cfg := config.RetentionConfig{
+		Interval: time.Hour,
+		DryRun:   true,
+		Sessions: config.RetentionRule{Prefix: "session:", MaxAge: time.Hour},
+		Usage:    config.RetentionRule{Prefix: "usage:", MaxAge: time.Hour},
+		Cache:    config.RetentionRule{Prefix: "llmcache:"}, // no max age: kept
+	}
+	if err := NewJanitor(m, cfg).RunOnce(ctx); err != nil {
+		t.Fatalf("RunOnce() error = %v", err)
+	}
+	if _, err := m.Get(ctx, "session:old"); err != nil {
+		t.Errorf("Dry run should not delete, got %v", err)
+	}
+
+	cfg.DryRun = false
+	janitor := NewJanitor(m, cfg)
+	if err := janitor.RunOnce(ctx); err != nil {
+		t.Fatalf("RunOnce() error = %v", err)
+	}
+	for key, kept := range map[string]bool{"session:old": false, "session:new": true, "usage:acme:2026-01": true} {
+		if _, err := m.Get(ctx, key); (err == nil) != kept {
+			t.Errorf("%s kept = %v, want %v", key, err == nil, kept)
+		}
+	}
+	if _, ok := m.items["session:gone"]; ok {
+		t.Error("Expected the expired session to be removed")
+	}
+
+	stats := janitor.Stats()
+	if len(stats) != 2 || stats[0].Rule != "sessions" || stats[1].Rule != "usage" {
+		t.Fatalf("Unexpected stats %+v", stats)
+	}
+	if s := stats[0]; s.Runs != 1 || s.Scanned != 2 || s.Expired != 1 || s.Deleted != 1 || s.LastError != "" {
+		t.Errorf("Unexpected sessions stats %+v", s)
+	}
+}
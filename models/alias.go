@@ -0,0 +1,138 @@
+package models
+
+import (
+	"fmt"
+	"strings"
+)
+
+// maxAliasDepth bounds the chain of aliases a name is resolved through.
+const maxAliasDepth = 8
+
+// RegisterAlias makes alias a logical name for model, such as "fast" for "gpt-4o-mini", so
+// that application code can refer to the alias while operators choose the model behind it.
+// Resolve and the connectors look the alias up on every use, so registering it again swaps
+// the model without redeploying callers. model may itself be an alias; cycles are rejected.
+func (r *Registry) RegisterAlias(alias, model string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	next := make(map[string]string, len(r.aliases)+1)
+	for a, m := range r.aliases {
+		next[a] = m
+	}
+	next[alias] = model
+	if err := checkAliases(next); err != nil {
+		return err
+	}
+	r.aliases = next
+	return nil
+}
+
+// RegisterAlias makes alias a logical name for model in the default registry. See
+// Registry.RegisterAlias.
+func RegisterAlias(alias, model string) error {
+	return defaultRegistry.RegisterAlias(alias, model)
+}
+
+// SetAliases replaces every alias at once, e.g. with the model_aliases settings of a reloaded
+// configuration. Nothing changes when any alias is invalid.
+func (r *Registry) SetAliases(m map[string]string) error {
+	next := make(map[string]string, len(m))
+	for a, model := range m {
+		next[a] = model
+	}
+	if err := checkAliases(next); err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.aliases = next
+	return nil
+}
+
+// SetAliases replaces every alias of the default registry at once.
+func SetAliases(m map[string]string) error {
+	return defaultRegistry.SetAliases(m)
+}
+
+// DeleteAlias removes an alias.
+func (r *Registry) DeleteAlias(alias string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.aliases, alias)
+}
+
+// DeleteAlias removes an alias from the default registry.
+func DeleteAlias(alias string) {
+	defaultRegistry.DeleteAlias(alias)
+}
+
+// ListAliases returns a copy of the registered aliases and the names they stand for.
+func (r *Registry) ListAliases() map[string]string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	out := make(map[string]string, len(r.aliases))
+	for a, model := range r.aliases {
+		out[a] = model
+	}
+	return out
+}
+
+// ListAliases returns a copy of the aliases of the default registry.
+func ListAliases() map[string]string {
+	return defaultRegistry.ListAliases()
+}
+
+// ResolveAlias returns the model name behind name, following aliases of aliases, and whether
+// name is an alias. Other names are returned unchanged.
+func (r *Registry) ResolveAlias(name string) (string, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.resolveAlias(name)
+}
+
+// ResolveAlias returns the model name behind name in the default registry, and whether name
+// is an alias.
+func ResolveAlias(name string) (string, bool) {
+	return defaultRegistry.ResolveAlias(name)
+}
+
+// resolveAlias is ResolveAlias for callers holding r.mu.
+func (r *Registry) resolveAlias(name string) (string, bool) {
+	model, ok := r.aliases[name]
+	if !ok {
+		return name, false
+	}
+	for i := 0; i < maxAliasDepth; i++ {
+		next, ok := r.aliases[model]
+		if !ok {
+			break
+		}
+		model = next
+	}
+	return model, true
+}
+
+// checkAliases reports the first problem with m: an empty name, an alias of itself, or a
+// chain of aliases that loops or is longer than maxAliasDepth.
+func checkAliases(m map[string]string) error {
+	for alias, model := range m {
+		if strings.TrimSpace(alias) == "" || strings.TrimSpace(model) == "" {
+			return fmt.Errorf("alias %q of model %q: names must not be empty", alias, model)
+		}
+		name := model
+		for depth := 0; ; depth++ {
+			if name == alias {
+				return fmt.Errorf("alias %q refers to itself", alias)
+			}
+			next, ok := m[name]
+			if !ok {
+				break
+			}
+			if depth == maxAliasDepth {
+				return fmt.Errorf("alias %q is more than %d aliases deep", alias, maxAliasDepth)
+			}
+			name = next
+		}
+	}
+	return nil
+}
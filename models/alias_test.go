@@ -0,0 +1,61 @@
+package models
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestRegisterAlias(t *testing.T) {
+	setupTestRegistry()
+	defer ClearRegistry()
+
+	if err := RegisterAlias("fast", "test-model-1"); err != nil {
+		t.Fatalf("RegisterAlias() error = %v", err)
+	}
+	if err := RegisterAlias("default", "fast"); err != nil {
+		t.Fatalf("RegisterAlias() error = %v", err)
+	}
+	info, err := Resolve("default")
+	if err != nil || info.ID != "test-model-1" {
+		t.Fatalf("Resolve(default) = %q, %v, want test-model-1", info.ID, err)
+	}
+	if model, ok := ResolveAlias("test-model-1"); ok || model != "test-model-1" {
+		t.Errorf("ResolveAlias() of a model = %q, %v", model, ok)
+	}
+
+	// Swapping the model behind an alias takes effect on the next lookup
+	if err := RegisterAlias("fast", "test-model-2"); err != nil {
+		t.Fatalf("RegisterAlias() error = %v", err)
+	}
+	if info, err := Resolve("default"); err != nil || info.ID != "test-model-2" {
+		t.Errorf("Resolve(default) after the swap = %q, %v, want test-model-2", info.ID, err)
+	}
+
+	for _, tc := range [][2]string{{"fast", "default"}, {"loop", "loop"}, {"", "test-model-1"}, {"empty", ""}} {
+		if err := RegisterAlias(tc[0], tc[1]); err == nil {
+			t.Errorf("RegisterAlias(%q, %q) expected an error", tc[0], tc[1])
+		}
+	}
+	want := map[string]string{"fast": "test-model-2", "default": "fast"}
+	if got := ListAliases(); !reflect.DeepEqual(got, want) {
+		t.Errorf("ListAliases() = %v, want %v", got, want)
+	}
+
+	if err := SetAliases(map[string]string{"a": "b", "b": "a"}); err == nil {
+		t.Error("SetAliases() expected an error for a cycle")
+	}
+	if got := ListAliases(); !reflect.DeepEqual(got, want) {
+		t.Errorf("SetAliases() changed the aliases after an error: %v", got)
+	}
+	if err := SetAliases(map[string]string{"smart": "test-model-1"}); err != nil {
+		t.Fatalf("SetAliases() error = %v", err)
+	}
+	if _, err := Resolve("fast"); err == nil {
+		t.Error("Resolve() expected an error for a replaced alias")
+	}
+
+	DeleteAlias("smart")
+	if len(ListAliases()) != 0 {
+		t.Errorf("DeleteAlias() left %v", ListAliases())
+	}
+}
@@ -0,0 +1,139 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Capability names, as reported by UnsupportedCapabilityError.
+const (
+	CapabilityVision        = "vision"
+	CapabilityAudioInput    = "audio_input"
+	CapabilityTools         = "tools"
+	CapabilityJSONMode      = "json_mode"
+	CapabilityStreaming     = "streaming"
+	CapabilityParallelTools = "parallel_tools"
+)
+
+// Capabilities are the input modalities and API features a model supports, or a request needs.
+type Capabilities struct {
+	// Vision is image input, sent as PartImage parts.
+	Vision bool `json:"vision,omitempty"`
+
+	// AudioInput is audio input, sent as PartAudio parts.
+	AudioInput bool `json:"audioInput,omitempty"`
+
+	// Tools is function calling with the request's tool declarations.
+	Tools bool `json:"tools,omitempty"`
+
+	// JSONMode is JSON output, with GenerateContentConfig.JSONMode or a response schema.
+	JSONMode bool `json:"jsonMode,omitempty"`
+
+	// Streaming is sending the response while it is generated, which requests ask for with
+	// LiveConnectConfig.EnableStreaming.
+	Streaming bool `json:"streaming,omitempty"`
+
+	// ParallelTools is several function calls in one response; requests whose history holds
+	// such a response need it.
+	ParallelTools bool `json:"parallelTools,omitempty"`
+}
+
+// names returns the names of the capabilities set in c.
+func (c Capabilities) names() []string {
+	var names []string
+	for _, capability := range []struct {
+		set  bool
+		name string
+	}{
+		{c.Vision, CapabilityVision},
+		{c.AudioInput, CapabilityAudioInput},
+		{c.Tools, CapabilityTools},
+		{c.JSONMode, CapabilityJSONMode},
+		{c.Streaming, CapabilityStreaming},
+		{c.ParallelTools, CapabilityParallelTools},
+	} {
+		if capability.set {
+			names = append(names, capability.name)
+		}
+	}
+	return names
+}
+
+// Missing returns the names of the capabilities required sets that c does not, in the order
+// of the Capabilities fields.
+func (c Capabilities) Missing(required Capabilities) []string {
+	return Capabilities{
+		Vision:        required.Vision && !c.Vision,
+		AudioInput:    required.AudioInput && !c.AudioInput,
+		Tools:         required.Tools && !c.Tools,
+		JSONMode:      required.JSONMode && !c.JSONMode,
+		Streaming:     required.Streaming && !c.Streaming,
+		ParallelTools: required.ParallelTools && !c.ParallelTools,
+	}.names()
+}
+
+// RequiredCapabilities returns the capabilities the request needs from its model: vision and
+// audio input for PartImage and PartAudio parts, tools for tool declarations, JSON mode for
+// JSONMode or a JSON response, streaming for LiveConnectConfig.EnableStreaming, and parallel
+// tools for contents holding more than one function call.
+func (r *LLMRequest) RequiredCapabilities() Capabilities {
+	var required Capabilities
+	for i := range r.Contents {
+		content := &r.Contents[i]
+		for _, part := range content.Parts {
+			m, ok := part.(map[string]any)
+			if !ok {
+				continue
+			}
+			if _, ok := m[PartImage]; ok {
+				required.Vision = true
+			}
+			if _, ok := m[PartAudio]; ok {
+				required.AudioInput = true
+			}
+		}
+		if len(content.FunctionCalls()) > 1 {
+			required.ParallelTools = true
+		}
+	}
+	if config := r.Config; config != nil {
+		required.Tools = len(config.Tools) > 0
+		required.JSONMode = config.JSONMode || config.ResponseSchema != nil || config.ResponseMimeType == "application/json"
+	}
+	required.Streaming = r.LiveConnect.EnableStreaming
+	return required
+}
+
+// ErrCapabilityUnsupported matches every *UnsupportedCapabilityError with errors.Is.
+var ErrCapabilityUnsupported = errors.New("capability not supported")
+
+// UnsupportedCapabilityError is returned for a request that needs capabilities its model
+// lacks, before the request is sent.
+type UnsupportedCapabilityError struct {
+	Model   string   `json:"model"`
+	Missing []string `json:"missing"`
+}
+
+// Error implements the error interface.
+func (e *UnsupportedCapabilityError) Error() string {
+	return fmt.Sprintf("model %s does not support %s", e.Model, strings.Join(e.Missing, ", "))
+}
+
+// Is reports whether target is ErrCapabilityUnsupported.
+func (e *UnsupportedCapabilityError) Is(target error) bool {
+	return target == ErrCapabilityUnsupported
+}
+
+// CheckCapabilities returns an *UnsupportedCapabilityError when request needs capabilities the
+// model of info lacks, and nil otherwise. Models whose Capabilities are not registered are not
+// checked.
+func (info ModelInfo) CheckCapabilities(request *LLMRequest) error {
+	if info.Capabilities == nil {
+		return nil
+	}
+	if missing := info.Capabilities.Missing(request.RequiredCapabilities()); len(missing) > 0 {
+		return &UnsupportedCapabilityError{Model: info.ID, Missing: missing}
+	}
+	return nil
+}
@@ -0,0 +1,325 @@
+package models
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Catalog file formats.
+const (
+	CatalogJSON = "json"
+	CatalogYAML = "yaml"
+)
+
+// knownProfiles are the capability profiles a catalog entry may declare.
+var knownProfiles = map[string]bool{
+	ProfileChat:     true,
+	ProfileThinking: true,
+	ProfileAgent:    true,
+	ProfileRAG:      true,
+	ProfileCreative: true,
+	ProfileCode:     true,
+}
+
+// CatalogEntry is one model of a catalog: its metadata and the model-name patterns it is
+// registered under.
+type CatalogEntry struct {
+	ModelInfo
+
+	// Patterns are the model-name regexes the model is registered under.
+	Patterns []string `json:"patterns"`
+}
+
+// Catalog is a document of models registered together, e.g. by an operator adding a
+// provider's new releases.
+type Catalog struct {
+	Models []CatalogEntry `json:"models"`
+}
+
+// Validate checks that the entry can be registered: it has an ID, a provider and at least one
+// pattern, its patterns compile, its prices and token limits are not negative, its output limit
+// fits its context window, and its profiles and cost tier are known. All problems are reported, joined with errors.Join.
+func (e CatalogEntry) Validate() error {
+	var errs []error
+	if e.ID == "" {
+		errs = append(errs, errors.New("id is required"))
+	}
+	if e.Provider == "" {
+		errs = append(errs, errors.New("provider is required"))
+	}
+	if len(e.Patterns) == 0 {
+		errs = append(errs, errors.New("at least one pattern is required"))
+	}
+	for _, pattern := range e.Patterns {
+		if _, err := regexp.Compile(pattern); err != nil {
+			errs = append(errs, fmt.Errorf("invalid pattern %q: %w", pattern, err))
+		}
+	}
+	if e.MaxTokens < 0 || e.ContextWindow < 0 || e.MaxOutputTokens < 0 {
+		errs = append(errs, errors.New("maxTokens, contextWindow and maxOutputTokens must not be negative"))
+	}
+	if window := e.withLimits().ContextWindow; window > 0 && e.MaxOutputTokens > window {
+		errs = append(errs, errors.New("maxOutputTokens must not exceed the context window"))
+	}
+	if e.CostPerToken < 0 || e.InputCostPerMTok < 0 || e.OutputCostPerMTok < 0 || e.CachedInputCostPerMTok < 0 || e.CacheWriteCostPerMTok < 0 {
+		errs = append(errs, errors.New("prices must not be negative"))
+	}
+	if (e.InputCostPerMTok == 0) != (e.OutputCostPerMTok == 0) {
+		errs = append(errs, errors.New("inputCostPerMTok and outputCostPerMTok must be set together"))
+	}
+	for tier, m := range e.ServiceTierMultipliers {
+		if m <= 0 {
+			errs = append(errs, fmt.Errorf("serviceTierMultipliers.%s must be positive", tier))
+		}
+	}
+	for _, profile := range e.Profiles {
+		if !knownProfiles[profile] {
+			errs = append(errs, fmt.Errorf("unknown profile %q", profile))
+		}
+	}
+	switch e.CostTier {
+	case "", CostTierBasic, CostTierStandard, CostTierPremium:
+	default:
+		errs = append(errs, fmt.Errorf("unknown cost tier %q", e.CostTier))
+	}
+	return errors.Join(errs...)
+}
+
+// Validate checks every entry of the catalog and returns one error per entry, nil for valid
+// entries. Each error joins the entry's problems with errors.Join. Entries registering the
+// same ID or pattern as an earlier entry are rejected.
+func (c Catalog) Validate() []error {
+	results := make([]error, len(c.Models))
+	ids := make(map[string]int)
+	patterns := make(map[string]int)
+	for i, entry := range c.Models {
+		var errs []error
+		if err := entry.Validate(); err != nil {
+			// Keep one error per problem
+			errs = append(errs, err.(interface{ Unwrap() []error }).Unwrap()...)
+		}
+		if first, ok := ids[entry.ID]; ok && entry.ID != "" {
+			errs = append(errs, fmt.Errorf("id %q is already used by entry %d", entry.ID, first))
+		} else {
+			ids[entry.ID] = i
+		}
+		for _, pattern := range entry.Patterns {
+			if first, ok := patterns[pattern]; ok {
+				errs = append(errs, fmt.Errorf("pattern %q is already used by entry %d", pattern, first))
+			} else {
+				patterns[pattern] = i
+			}
+		}
+		results[i] = errors.Join(errs...)
+	}
+	return results
+}
+
+// RegisterCatalog registers every model of the catalog at once: either the whole catalog is
+// valid and registered, or nothing is. Existing registrations under the same patterns are
+// replaced.
+func (r *Registry) RegisterCatalog(catalog Catalog) error {
+	for i, err := range catalog.Validate() {
+		if err != nil {
+			return fmt.Errorf("catalog entry %d: %w", i, err)
+		}
+	}
+
+	r.mu.Lock()
+	defer r.unlock()
+	for _, entry := range catalog.Models {
+		for _, pattern := range entry.Patterns {
+			r.setPattern(pattern, entry.ModelInfo)
+		}
+	}
+	r.cache = make(map[string]ModelInfo)
+	return nil
+}
+
+// RegisterCatalog registers every model of the catalog at once in the default registry.
+func RegisterCatalog(catalog Catalog) error {
+	return defaultRegistry.RegisterCatalog(catalog)
+}
+
+// RegisterModel registers entry, replacing every earlier registration of its ID, so that
+// patterns it no longer lists stop matching. Nothing changes when the entry is invalid.
+func (r *Registry) RegisterModel(entry CatalogEntry) error {
+	if err := entry.Validate(); err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.unlock()
+	// Patterns the entry keeps keep their precedence
+	kept := make(map[string]bool, len(entry.Patterns))
+	for _, pattern := range entry.Patterns {
+		kept[pattern] = true
+	}
+	for pattern, info := range r.patterns {
+		if info.ID == entry.ID && !kept[pattern] {
+			r.deletePattern(pattern)
+		}
+	}
+	for _, pattern := range entry.Patterns {
+		r.setPattern(pattern, entry.ModelInfo)
+	}
+	r.cache = make(map[string]ModelInfo)
+	return nil
+}
+
+// RegisterModel registers entry in the default registry, replacing every earlier registration
+// of its ID.
+func RegisterModel(entry CatalogEntry) error {
+	return defaultRegistry.RegisterModel(entry)
+}
+
+// UnregisterModel removes every registration of the model with the given ID, and reports
+// whether there was any.
+func (r *Registry) UnregisterModel(id string) bool {
+	r.mu.Lock()
+	defer r.unlock()
+	removed := false
+	for pattern, info := range r.patterns {
+		if info.ID == id {
+			r.deletePattern(pattern)
+			removed = true
+		}
+	}
+	if removed {
+		r.cache = make(map[string]ModelInfo)
+	}
+	return removed
+}
+
+// UnregisterModel removes every registration of the model with the given ID from the default
+// registry.
+func UnregisterModel(id string) bool {
+	return defaultRegistry.UnregisterModel(id)
+}
+
+// ListCatalog returns the registry as a catalog: one entry per model, sorted by ID, with its
+// patterns sorted.
+func (r *Registry) ListCatalog() Catalog {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	byID := make(map[string]*CatalogEntry)
+	var ids []string
+	for pattern, info := range r.patterns {
+		entry, ok := byID[info.ID]
+		if !ok {
+			entry = &CatalogEntry{ModelInfo: info}
+			byID[info.ID] = entry
+			ids = append(ids, info.ID)
+		}
+		entry.Patterns = append(entry.Patterns, pattern)
+	}
+	sort.Strings(ids)
+	catalog := Catalog{Models: make([]CatalogEntry, 0, len(ids))}
+	for _, id := range ids {
+		entry := byID[id]
+		sort.Strings(entry.Patterns)
+		catalog.Models = append(catalog.Models, *entry)
+	}
+	return catalog
+}
+
+// ListCatalog returns the default registry as a catalog.
+func ListCatalog() Catalog {
+	return defaultRegistry.ListCatalog()
+}
+
+// ParseCatalog reads a catalog in format, CatalogJSON or CatalogYAML. Both hold the JSON
+// fields of Catalog; YAML documents use the same names:
+//
+//	models:
+//	  - id: mistral-small
+//	    provider: mistral
+//	    patterns: ["^mistral-small.*"]
+//	    profiles: [chat, agent]
+//	    maxTokens: 32768
+//	    inputCostPerMTok: 0.2
+//	    outputCostPerMTok: 0.6
+//	    costTier: basic
+//
+// Unknown fields are rejected, so that a misspelled field is not silently dropped.
+func ParseCatalog(r io.Reader, format string) (Catalog, error) {
+	var data []byte
+	switch format {
+	case CatalogJSON:
+		var err error
+		if data, err = io.ReadAll(r); err != nil {
+			return Catalog{}, fmt.Errorf("reading catalog: %w", err)
+		}
+	case CatalogYAML:
+		// Decode through JSON so that YAML follows the JSON field names
+		var doc any
+		if err := yaml.NewDecoder(r).Decode(&doc); err != nil && err != io.EOF {
+			return Catalog{}, fmt.Errorf("decoding catalog: %w", err)
+		}
+		var err error
+		if data, err = json.Marshal(doc); err != nil {
+			return Catalog{}, fmt.Errorf("decoding catalog: %w", err)
+		}
+	default:
+		return Catalog{}, fmt.Errorf("unknown catalog format %q", format)
+	}
+
+	var catalog Catalog
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&catalog); err != nil {
+		return Catalog{}, fmt.Errorf("decoding catalog: %w", err)
+	}
+	return catalog, nil
+}
+
+// LoadFromReader registers the catalog read from in in format, CatalogJSON or CatalogYAML,
+// with RegisterCatalog: either every model is registered or, when the catalog cannot be read
+// or an entry is invalid, none is.
+func (r *Registry) LoadFromReader(in io.Reader, format string) error {
+	catalog, err := ParseCatalog(in, format)
+	if err != nil {
+		return err
+	}
+	return r.RegisterCatalog(catalog)
+}
+
+// LoadFromReader registers the catalog read from r in format in the default registry.
+func LoadFromReader(r io.Reader, format string) error {
+	return defaultRegistry.LoadFromReader(r, format)
+}
+
+// LoadFromFile registers the catalog of the file at path like LoadFromReader, in YAML when its
+// extension is .yaml or .yml and in JSON otherwise. Deployments keep their own catalog in such
+// a file, in place of or on top of the models of Init.
+func (r *Registry) LoadFromFile(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	format := CatalogJSON
+	if ext := strings.ToLower(filepath.Ext(path)); ext == ".yaml" || ext == ".yml" {
+		format = CatalogYAML
+	}
+	if err := r.LoadFromReader(f, format); err != nil {
+		return fmt.Errorf("loading %s: %w", path, err)
+	}
+	return nil
+}
+
+// LoadFromFile registers the catalog of the file at path in the default registry.
+func LoadFromFile(path string) error {
+	return defaultRegistry.LoadFromFile(path)
+}
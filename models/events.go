@@ -0,0 +1,93 @@
+package models
+
+// Registry event types.
+const (
+	// ModelAdded is a pattern registered for the first time.
+	ModelAdded = "added"
+
+	// ModelUpdated is a pattern registered again with a different model, e.g. repriced.
+	ModelUpdated = "updated"
+
+	// ModelRemoved is a pattern no longer registered.
+	ModelRemoved = "removed"
+)
+
+// RegistryEvent is a change of one registration, delivered to the functions of Subscribe.
+type RegistryEvent struct {
+	// Type is ModelAdded, ModelUpdated or ModelRemoved.
+	Type string `json:"type"`
+
+	// Pattern is the model-name pattern whose registration changed.
+	Pattern string `json:"pattern"`
+
+	// Model is the model registered under Pattern, or the one removed from it.
+	Model ModelInfo `json:"model"`
+
+	// Previous is the model Pattern was registered with before an update.
+	Previous *ModelInfo `json:"previous,omitempty"`
+}
+
+// subscriber is a function registered with Subscribe.
+type subscriber struct {
+	id uint64
+	fn func(RegistryEvent)
+}
+
+// Subscribe calls fn for every change of the registrations from now on, so that state derived
+// from the registry, such as cached model selections, can be invalidated when models are
+// added, removed or repriced at runtime. Registering a pattern again with the same model is
+// not a change, and aliases are not reported. fn is called synchronously after the change, in
+// the order of the changes, and must not change the registry itself. The returned function
+// unsubscribes fn.
+func (r *Registry) Subscribe(fn func(event RegistryEvent)) (unsubscribe func()) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.nextSubscriber++
+	id := r.nextSubscriber
+	// Copy on write: unlock delivers to the subscribers of the change without holding r.mu
+	r.subscribers = append(r.subscribers[:len(r.subscribers):len(r.subscribers)], subscriber{id: id, fn: fn})
+	return func() {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		kept := make([]subscriber, 0, len(r.subscribers))
+		for _, s := range r.subscribers {
+			if s.id != id {
+				kept = append(kept, s)
+			}
+		}
+		r.subscribers = kept
+	}
+}
+
+// Subscribe calls fn for every change of the default registry's registrations. See
+// Registry.Subscribe.
+func Subscribe(fn func(event RegistryEvent)) (unsubscribe func()) {
+	return defaultRegistry.Subscribe(fn)
+}
+
+// record queues event for the subscribers. Callers hold r.mu.
+func (r *Registry) record(event RegistryEvent) {
+	if len(r.subscribers) > 0 {
+		r.pending = append(r.pending, event)
+	}
+}
+
+// unlock releases r.mu, which the caller holds for writing, and delivers the events of the
+// changes made while holding it. Deliveries are serialized so that subscribers see changes in
+// order, and may read the registry.
+func (r *Registry) unlock() {
+	events, subscribers := r.pending, r.subscribers
+	r.pending = nil
+	if len(events) == 0 {
+		r.mu.Unlock()
+		return
+	}
+	r.deliverMu.Lock()
+	defer r.deliverMu.Unlock()
+	r.mu.Unlock()
+	for _, event := range events {
+		for _, s := range subscribers {
+			s.fn(event)
+		}
+	}
+}
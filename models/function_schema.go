@@ -0,0 +1,201 @@
+package models
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// JSONSchema is the subset of JSON Schema used to describe function parameters and outputs.
+type JSONSchema struct {
+	Type                 string                 `json:"type,omitempty"`
+	Description          string                 `json:"description,omitempty"`
+	Properties           map[string]*JSONSchema `json:"properties,omitempty"`
+	Required             []string               `json:"required,omitempty"`
+	Items                *JSONSchema            `json:"items,omitempty"`
+	Enum                 []string               `json:"enum,omitempty"`
+	Format               string                 `json:"format,omitempty"`
+	AdditionalProperties *JSONSchema            `json:"additionalProperties,omitempty"`
+}
+
+// FunctionSchema is a function declaration understood by every connector.
+// Its JSON encoding is the string BaseTool.Declaration is expected to return.
+type FunctionSchema struct {
+	Name        string      `json:"name"`
+	Description string      `json:"description,omitempty"`
+	Parameters  *JSONSchema `json:"parameters"`
+}
+
+// Declaration encodes the schema as a BaseTool declaration string.
+func (f *FunctionSchema) Declaration() (string, error) {
+	encoded, err := json.Marshal(f)
+	if err != nil {
+		return "", fmt.Errorf("encoding function schema %s: %w", f.Name, err)
+	}
+	return string(encoded), nil
+}
+
+var (
+	contextType = reflect.TypeOf((*context.Context)(nil)).Elem()
+	timeType    = reflect.TypeOf(time.Time{})
+)
+
+// NewFunctionSchema builds a function declaration whose parameters are described by params,
+// which must be a struct (or pointer to struct). Field names follow `json` tags; fields tagged
+// omitempty or of pointer type are optional. The `description` tag documents a field and the
+// `enum` tag restricts it to a comma-separated list of values.
+func NewFunctionSchema(name, description string, params any) (*FunctionSchema, error) {
+	t := reflect.TypeOf(params)
+	for t != nil && t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t == nil || t.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("parameters for function %s must be a struct, got %T", name, params)
+	}
+	return &FunctionSchema{
+		Name:        name,
+		Description: description,
+		Parameters:  SchemaForType(t),
+	}, nil
+}
+
+// FunctionSchemaFromFunc builds a function declaration from a Go function's signature.
+// A leading context.Context is ignored. A single struct argument is expanded like
+// NewFunctionSchema; otherwise each argument becomes a required property arg0, arg1, ...
+func FunctionSchemaFromFunc(name, description string, fn any) (*FunctionSchema, error) {
+	t := reflect.TypeOf(fn)
+	if t == nil || t.Kind() != reflect.Func {
+		return nil, fmt.Errorf("function %s: expected a func, got %T", name, fn)
+	}
+
+	var args []reflect.Type
+	for i := 0; i < t.NumIn(); i++ {
+		if i == 0 && t.In(i) == contextType {
+			continue
+		}
+		args = append(args, t.In(i))
+	}
+
+	if len(args) == 1 {
+		arg := args[0]
+		for arg.Kind() == reflect.Pointer {
+			arg = arg.Elem()
+		}
+		if arg.Kind() == reflect.Struct && arg != timeType {
+			return &FunctionSchema{Name: name, Description: description, Parameters: SchemaForType(arg)}, nil
+		}
+	}
+
+	params := &JSONSchema{Type: "object", Properties: make(map[string]*JSONSchema, len(args))}
+	for i, arg := range args {
+		argName := fmt.Sprintf("arg%d", i)
+		params.Properties[argName] = SchemaForType(arg)
+		params.Required = append(params.Required, argName)
+	}
+	return &FunctionSchema{Name: name, Description: description, Parameters: params}, nil
+}
+
+// SchemaForType derives a JSON schema from a Go type.
+func SchemaForType(t reflect.Type) *JSONSchema {
+	return schemaForType(t, make(map[reflect.Type]bool))
+}
+
+func schemaForType(t reflect.Type, visiting map[reflect.Type]bool) *JSONSchema {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+
+	switch t.Kind() {
+	case reflect.String:
+		return &JSONSchema{Type: "string"}
+	case reflect.Bool:
+		return &JSONSchema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return &JSONSchema{Type: "integer"}
+	case reflect.Float32, reflect.Float64:
+		return &JSONSchema{Type: "number"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			// []byte is encoded as base64 by encoding/json
+			return &JSONSchema{Type: "string", Format: "byte"}
+		}
+		return &JSONSchema{Type: "array", Items: schemaForType(t.Elem(), visiting)}
+	case reflect.Map:
+		return &JSONSchema{Type: "object", AdditionalProperties: schemaForType(t.Elem(), visiting)}
+	case reflect.Struct:
+		if t == timeType {
+			return &JSONSchema{Type: "string", Format: "date-time"}
+		}
+		if visiting[t] {
+			// Recursive type: stop expanding
+			return &JSONSchema{Type: "object"}
+		}
+		visiting[t] = true
+		defer delete(visiting, t)
+
+		schema := &JSONSchema{Type: "object", Properties: make(map[string]*JSONSchema)}
+		addStructFields(schema, t, visiting)
+		return schema
+	default:
+		// Interfaces and anything else accept any JSON value
+		return &JSONSchema{}
+	}
+}
+
+// addStructFields adds the exported fields of t to schema, flattening embedded structs.
+func addStructFields(schema *JSONSchema, t reflect.Type, visiting map[reflect.Type]bool) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() && !field.Anonymous {
+			continue
+		}
+
+		tag := field.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, opts, _ := strings.Cut(tag, ",")
+
+		fieldType := field.Type
+		if field.Anonymous && name == "" {
+			for fieldType.Kind() == reflect.Pointer {
+				fieldType = fieldType.Elem()
+			}
+			if fieldType.Kind() == reflect.Struct {
+				addStructFields(schema, fieldType, visiting)
+				continue
+			}
+		}
+		if !field.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+
+		prop := schemaForType(field.Type, visiting)
+		if desc := field.Tag.Get("description"); desc != "" {
+			prop.Description = desc
+		}
+		if enum := field.Tag.Get("enum"); enum != "" {
+			for _, v := range strings.Split(enum, ",") {
+				prop.Enum = append(prop.Enum, strings.TrimSpace(v))
+			}
+		}
+		schema.Properties[name] = prop
+
+		optional := field.Type.Kind() == reflect.Pointer
+		for _, opt := range strings.Split(opts, ",") {
+			if opt == "omitempty" {
+				optional = true
+			}
+		}
+		if !optional {
+			schema.Required = append(schema.Required, name)
+		}
+	}
+}
@@ -0,0 +1,168 @@
+package models
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+)
+
+type weatherParams struct {
+	City    string    `json:"city" description:"City name"`
+	Unit    string    `json:"unit,omitempty" enum:"celsius,fahrenheit"`
+	Days    *int      `json:"days"`
+	When    time.Time `json:"when,omitempty"`
+	Tags    []string  `json:"tags,omitempty"`
+	ignored string
+	Skip    string `json:"-"`
+}
+
+func TestNewFunctionSchema(t *testing.T) {
+	schema, err := NewFunctionSchema("get_weather", "Look up the weather", weatherParams{})
+	if err != nil {
+		t.Fatalf("NewFunctionSchema() error = %v", err)
+	}
+
+	params := schema.Parameters
+	if params.Type != "object" {
+		t.Errorf("Expected object parameters, got %q", params.Type)
+	}
+	if !reflect.DeepEqual(params.Required, []string{"city"}) {
+		t.Errorf("Expected only city to be required, got %v", params.Required)
+	}
+	if params.Properties["city"].Description != "City name" {
+		t.Errorf("Expected city description, got %q", params.Properties["city"].Description)
+	}
+	if !reflect.DeepEqual(params.Properties["unit"].Enum, []string{"celsius", "fahrenheit"}) {
+		t.Errorf("Unexpected unit enum %v", params.Properties["unit"].Enum)
+	}
+	if params.Properties["days"].Type != "integer" {
+		t.Errorf("Expected integer days, got %q", params.Properties["days"].Type)
+	}
+	if params.Properties["when"].Format != "date-time" {
+		t.Errorf("Expected date-time format for when, got %q", params.Properties["when"].Format)
+	}
+	if params.Properties["tags"].Items == nil || params.Properties["tags"].Items.Type != "string" {
+		t.Errorf("Expected string items for tags")
+	}
+	if _, ok := params.Properties["Skip"]; ok {
+		t.Error("Fields tagged json:\"-\" should be skipped")
+	}
+	if _, ok := params.Properties["ignored"]; ok {
+		t.Error("Unexported fields should be skipped")
+	}
+
+	if _, err := NewFunctionSchema("bad", "", "not a struct"); err == nil {
+		t.Error("Expected error for non-struct parameters")
+	}
+}
+
+func TestFunctionSchemaDeclaration(t *testing.T) {
+	schema, _ := NewFunctionSchema("get_weather", "Look up the weather", &weatherParams{})
+	decl, err := schema.Declaration()
+	if err != nil {
+		t.Fatalf("Declaration() error = %v", err)
+	}
+
+	var decoded map[string]any
+	if err := json.Unmarshal([]byte(decl), &decoded); err != nil {
+		t.Fatalf("Declaration is not valid JSON: %v", err)
+	}
+	if decoded["name"] != "get_weather" {
+		t.Errorf("Expected name get_weather, got %v", decoded["name"])
+	}
+	if _, ok := decoded["parameters"].(map[string]any)["properties"]; !ok {
+		t.Error("Expected parameters.properties in declaration")
+	}
+}
+
+func TestFunctionSchemaFromFunc(t *testing.T) {
+	schema, err := FunctionSchemaFromFunc("get_weather", "", func(ctx context.Context, p weatherParams) (string, error) {
+		return "", nil
+	})
+	if err != nil {
+		t.Fatalf("FunctionSchemaFromFunc() error = %v", err)
+	}
+	if _, ok := schema.Parameters.Properties["city"]; !ok {
+		t.Error("Expected struct argument to be expanded")
+	}
+
+	schema, err = FunctionSchemaFromFunc("add", "", func(a, b float64) float64 { return a + b })
+	if err != nil {
+		t.Fatalf("FunctionSchemaFromFunc() error = %v", err)
+	}
+	if len(schema.Parameters.Properties) != 2 || schema.Parameters.Properties["arg1"].Type != "number" {
+		t.Errorf("Unexpected positional parameters %+v", schema.Parameters.Properties)
+	}
+
+	if _, err := FunctionSchemaFromFunc("bad", "", 42); err == nil {
+		t.Error("Expected error for non-func value")
+	}
+}
+
+type treeNode struct {
+	Value    int         `json:"value"`
+	Children []*treeNode `json:"children,omitempty"`
+}
+
+func TestSchemaForRecursiveType(t *testing.T) {
+	schema := SchemaForType(reflect.TypeOf(treeNode{}))
+	children := schema.Properties["children"]
+	if children == nil || children.Items == nil || children.Items.Type != "object" {
+		t.Fatalf("Expected recursive children to stop at an object schema, got %+v", children)
+	}
+}
+
+func TestSchemaOf(t *testing.T) {
+	fromStruct, err := SchemaOf(weatherParams{})
+	if err != nil || fromStruct.Properties["city"] == nil {
+		t.Fatalf("SchemaOf(struct) = %+v, %v", fromStruct, err)
+	}
+
+	fromMap, err := SchemaOf(map[string]any{
+		"type":       "object",
+		"properties": map[string]any{"n": map[string]any{"type": "integer"}},
+		"required":   []string{"n"},
+	})
+	if err != nil || fromMap.Properties["n"].Type != "integer" {
+		t.Fatalf("SchemaOf(map) = %+v, %v", fromMap, err)
+	}
+
+	if _, err := SchemaOf(nil); err == nil {
+		t.Error("Expected error for nil schema")
+	}
+
+	var config *GenerateContentConfig
+	if schema, err := config.OutputSchema(); schema != nil || err != nil {
+		t.Errorf("Expected no schema for nil config, got %+v, %v", schema, err)
+	}
+}
+
+func TestJSONSchemaValidate(t *testing.T) {
+	schema := SchemaForType(reflect.TypeOf(weatherParams{}))
+
+	tests := []struct {
+		name    string
+		input   string
+		wantErr bool
+	}{
+		{"valid", `{"city": "Paris", "unit": "celsius", "days": 3, "tags": ["a"]}`, false},
+		{"missing required", `{"unit": "celsius"}`, true},
+		{"wrong type", `{"city": 42}`, true},
+		{"bad enum", `{"city": "Paris", "unit": "kelvin"}`, true},
+		{"non-integer", `{"city": "Paris", "days": 1.5}`, true},
+		{"bad array item", `{"city": "Paris", "tags": [1]}`, true},
+		{"not an object", `["Paris"]`, true},
+		{"invalid JSON", `{"city": `, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := schema.ValidateJSON([]byte(tt.input))
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ValidateJSON() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -2,3 +2,4 @@ module github.com/nexen/models
 
 go 1.21
 
+require gopkg.in/yaml.v3 v3.0.1
@@ -1,6 +1,7 @@
 package models
 
 import (
+	"context"
 	"fmt"
 )
 
@@ -12,6 +13,59 @@ type BaseTool interface {
 	Declaration() (string, error)
 }
 
+// CallableTool is a BaseTool that can also be executed with model-supplied arguments.
+// Agent loops dispatch function calls to the matching CallableTool in LLMRequest.ToolsDict.
+type CallableTool interface {
+	BaseTool
+	Call(ctx context.Context, args map[string]any) (any, error)
+}
+
+// Part keys used for structured content parts.
+const (
+	PartFunctionCall     = "function_call"
+	PartFunctionResponse = "function_response"
+	PartImage            = "image" // Image input, e.g. {"image": {"url": "https://..."}}
+	PartAudio            = "audio" // Audio input, e.g. {"audio": {"data": "<base64>", "format": "wav"}}
+)
+
+// FunctionCall is a tool invocation requested by the model.
+type FunctionCall struct {
+	ID   string         `json:"id,omitempty"`
+	Name string         `json:"name"`
+	Args map[string]any `json:"args,omitempty"`
+}
+
+// FunctionResponse is the result of executing a FunctionCall.
+type FunctionResponse struct {
+	ID       string `json:"id,omitempty"`
+	Name     string `json:"name"`
+	Response any    `json:"response"`
+	IsError  bool   `json:"isError,omitempty"`
+}
+
+// NewFunctionCallPart builds a content part holding a function call.
+func NewFunctionCallPart(call FunctionCall) map[string]any {
+	return map[string]any{
+		PartFunctionCall: map[string]any{
+			"id":   call.ID,
+			"name": call.Name,
+			"args": call.Args,
+		},
+	}
+}
+
+// NewFunctionResponsePart builds a content part holding a function result.
+func NewFunctionResponsePart(resp FunctionResponse) map[string]any {
+	return map[string]any{
+		PartFunctionResponse: map[string]any{
+			"id":       resp.ID,
+			"name":     resp.Name,
+			"response": resp.Response,
+			"isError":  resp.IsError,
+		},
+	}
+}
+
 // Content represents a single piece of content to send to the model.
 // Contains role (system/user/assistant) and text.
 type Content struct {
@@ -19,20 +73,96 @@ type Content struct {
 	Message string `json:"message"`
 	// Parts can contain multiple content segments (text, images, etc.)
 	Parts []any `json:"parts,omitempty"`
+
+	// CacheBreakpoint marks the conversation up to and including this content as a prefix
+	// the provider should cache, for providers with explicit caching such as Anthropic.
+	// Providers that cache automatically ignore it.
+	CacheBreakpoint bool `json:"cacheBreakpoint,omitempty"`
+}
+
+// Tool choice modes for GenerateContentConfig.ToolChoice.
+// Any other non-empty value is treated as the name of the function the model must call.
+const (
+	ToolChoiceAuto     = "auto"     // Model decides whether to call a tool
+	ToolChoiceNone     = "none"     // Model must not call any tool
+	ToolChoiceRequired = "required" // Model must call at least one tool
+)
+
+// FunctionCalls returns the function calls contained in the content parts, in order.
+func (c *Content) FunctionCalls() []FunctionCall {
+	if c == nil {
+		return nil
+	}
+	var calls []FunctionCall
+	for _, part := range c.Parts {
+		m, ok := part.(map[string]any)
+		if !ok {
+			continue
+		}
+		fc, ok := m[PartFunctionCall].(map[string]any)
+		if !ok {
+			continue
+		}
+		call := FunctionCall{}
+		call.ID, _ = fc["id"].(string)
+		call.Name, _ = fc["name"].(string)
+		call.Args, _ = fc["args"].(map[string]any)
+		calls = append(calls, call)
+	}
+	return calls
 }
 
+// Service tiers for GenerateContentConfig.ServiceTier, choosing the processing a provider
+// gives a request. Providers without a tier ignore it.
+const (
+	ServiceTierAuto     = "auto"     // Provider's choice; priority capacity when the account has it
+	ServiceTierDefault  = "default"  // Standard processing at standard prices
+	ServiceTierFlex     = "flex"     // Slower, cheaper processing that may be unavailable
+	ServiceTierPriority = "priority" // Faster, more reliable processing at a premium
+)
+
+// JSONModeInstruction is the system instruction connectors add for JSONMode when the
+// provider has no JSON mode of its own.
+const JSONModeInstruction = "Respond only with a single valid JSON object, without code fences or any other text."
+
 // GenerateContentConfig holds additional generation parameters, tools, and schema.
 type GenerateContentConfig struct {
 	SystemInstruction string            `json:"systemInstruction,omitempty"`
 	Tools             []ToolDeclaration `json:"tools,omitempty"`
+	ToolChoice        string            `json:"toolChoice,omitempty"`
 	ResponseSchema    any               `json:"responseSchema,omitempty"`
 	ResponseMimeType  string            `json:"responseMimeType,omitempty"`
 	Temperature       float64           `json:"temperature,omitempty"`
 	TopP              float64           `json:"topP,omitempty"`
 	MaxTokens         int               `json:"maxTokens,omitempty"`
 	StopSequences     []string          `json:"stopSequences,omitempty"`
+	ResponseLogprobs  bool              `json:"responseLogprobs,omitempty"`
+	TopLogprobs       int               `json:"topLogprobs,omitempty"`
+
+	// Timeout is the request's timeout in seconds. It overrides the client's timeout; see
+	// common.ResolveTimeout in the connectors module for the full precedence.
+	Timeout int `json:"timeout,omitempty"`
+
+	// JSONMode asks for a JSON object response without a schema. Connectors use the provider's
+	// basic JSON mode, or add JSONModeInstruction to the system instruction when it has none.
+	// ResponseSchema takes precedence.
+	JSONMode bool `json:"jsonMode,omitempty"`
+
+	// CacheSystemInstruction marks the tools and system instruction as a prefix the provider
+	// should cache. See Content.CacheBreakpoint for caching conversation history.
+	CacheSystemInstruction bool `json:"cacheSystemInstruction,omitempty"`
+
+	// ServiceTier overrides the client's service tier for the request, e.g.
+	// ServiceTierPriority.
+	ServiceTier string `json:"serviceTier,omitempty"`
 }
 
+// Priorities for RequestMetadata.Priority, the quality of service a request needs.
+const (
+	PriorityInteractive = "interactive" // A user is waiting for the response
+	PriorityBatch       = "batch"       // Throughput matters more than latency
+)
+
 // LiveConnectConfig holds live connection settings for streaming or other integrations.
 type LiveConnectConfig struct {
 	EnableStreaming bool           `json:"enableStreaming,omitempty"`
@@ -46,6 +176,30 @@ type ToolDeclaration struct {
 	FunctionDeclarations []string `json:"functionDeclarations,omitempty"`
 }
 
+// RequestMetadata identifies whom a request is made for, so that multi-tenant deployments
+// can attribute calls. It is never sent to the model: connectors record it in logs, traces,
+// usage accounting and the response's CustomMetadata, and pass UserID to providers that
+// accept an end-user identifier for abuse monitoring.
+type RequestMetadata struct {
+	TenantID  string `json:"tenantId,omitempty"`
+	UserID    string `json:"userId,omitempty"`
+	RequestID string `json:"requestId,omitempty"`
+
+	// Priority is PriorityInteractive or PriorityBatch. Services that share capacity between
+	// requests, such as the gateway, use it to order and budget them, and may send batch
+	// requests to cheaper, slower models. Empty leaves it to the service.
+	Priority string `json:"priority,omitempty"`
+
+	// Tags are arbitrary labels, such as a feature or experiment name. Keep their values
+	// low-cardinality when they are used as metric labels.
+	Tags map[string]string `json:"tags,omitempty"`
+}
+
+// IsZero reports whether no metadata is set.
+func (m RequestMetadata) IsZero() bool {
+	return m.TenantID == "" && m.UserID == "" && m.RequestID == "" && m.Priority == "" && len(m.Tags) == 0
+}
+
 // LLMRequest defines the structure for a single call to an LLM service.
 // It includes the prompt contents, generation config, and attached tools.
 type LLMRequest struct {
@@ -61,6 +215,9 @@ type LLMRequest struct {
 	// LiveConnect holds optional live-streaming or other live connection settings.
 	LiveConnect LiveConnectConfig `json:"liveConnect,omitempty"`
 
+	// Metadata attributes the request to a tenant, user and request.
+	Metadata RequestMetadata `json:"metadata,omitempty"`
+
 	// ToolsDict maps tool names to instances for post-processing.
 	// It is populated when tools are declared on the request.
 	ToolsDict map[string]BaseTool `json:"-"` // Not serialized
@@ -126,5 +283,40 @@ func (r *LLMRequest) Validate() error {
 	if len(r.Contents) == 0 {
 		return fmt.Errorf("request must contain at least one content message")
 	}
+	if r.Config != nil {
+		switch choice := r.Config.ToolChoice; choice {
+		case "", ToolChoiceAuto, ToolChoiceNone:
+		case ToolChoiceRequired:
+			if len(r.Config.Tools) == 0 {
+				return fmt.Errorf("tool choice %q requires at least one tool", choice)
+			}
+		default:
+			if len(r.Config.Tools) == 0 {
+				return fmt.Errorf("tool choice %q requires at least one tool", choice)
+			}
+			if len(r.ToolsDict) > 0 {
+				if _, ok := r.ToolsDict[choice]; !ok {
+					return fmt.Errorf("tool choice %q does not match any attached tool", choice)
+				}
+			}
+		}
+	}
+	switch r.Metadata.Priority {
+	case "", PriorityInteractive, PriorityBatch:
+	default:
+		return fmt.Errorf("priority %q is not %s or %s", r.Metadata.Priority, PriorityInteractive, PriorityBatch)
+	}
 	return nil
 }
+
+// SpecificToolChoice returns the function name the model is forced to call, if any.
+func (c *GenerateContentConfig) SpecificToolChoice() (string, bool) {
+	if c == nil {
+		return "", false
+	}
+	switch c.ToolChoice {
+	case "", ToolChoiceAuto, ToolChoiceNone, ToolChoiceRequired:
+		return "", false
+	}
+	return c.ToolChoice, true
+}
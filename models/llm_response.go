@@ -8,6 +8,13 @@ type UsageMetrics struct {
 	// CompletionTokens is the number of tokens in the completion.
 	CompletionTokens int `json:"completionTokens"`
 
+	// CachedPromptTokens is the part of PromptTokens the provider served from its prompt cache.
+	CachedPromptTokens int `json:"cachedPromptTokens,omitempty"`
+
+	// CacheWritePromptTokens is the part of PromptTokens the provider wrote to its prompt
+	// cache, which some providers charge at a premium.
+	CacheWritePromptTokens int `json:"cacheWritePromptTokens,omitempty"`
+
 	// TotalTokens is the sum of prompt and completion tokens.
 	TotalTokens int `json:"totalTokens"`
 
@@ -18,6 +25,19 @@ type UsageMetrics struct {
 	CostCents float64 `json:"costCents"`
 }
 
+// Add returns the sum of u and other, such as the usage of a response made of several calls.
+func (u UsageMetrics) Add(other UsageMetrics) UsageMetrics {
+	return UsageMetrics{
+		PromptTokens:           u.PromptTokens + other.PromptTokens,
+		CompletionTokens:       u.CompletionTokens + other.CompletionTokens,
+		CachedPromptTokens:     u.CachedPromptTokens + other.CachedPromptTokens,
+		CacheWritePromptTokens: u.CacheWritePromptTokens + other.CacheWritePromptTokens,
+		TotalTokens:            u.TotalTokens + other.TotalTokens,
+		LatencyMs:              u.LatencyMs + other.LatencyMs,
+		CostCents:              u.CostCents + other.CostCents,
+	}
+}
+
 // GroundingMetadata contains references to sources used for grounding.
 type GroundingMetadata struct {
 	// Citations is a list of source citations for generated content.
@@ -45,6 +65,33 @@ type Citation struct {
 	EndIndex int `json:"endIndex,omitempty"`
 }
 
+// Logprobs holds token-level log probabilities for generated content.
+type Logprobs struct {
+	// Tokens lists the generated tokens in order.
+	Tokens []TokenLogprob `json:"tokens"`
+}
+
+// TokenLogprob is the log probability of a single generated token.
+type TokenLogprob struct {
+	// Token is the generated token text.
+	Token string `json:"token"`
+
+	// Logprob is the natural log probability of the token.
+	Logprob float64 `json:"logprob"`
+
+	// TopAlternatives lists the most likely tokens at this position, if requested.
+	TopAlternatives []TopLogprob `json:"topAlternatives,omitempty"`
+}
+
+// TopLogprob is a candidate token considered at a position.
+type TopLogprob struct {
+	// Token is the candidate token text.
+	Token string `json:"token"`
+
+	// Logprob is the natural log probability of the candidate.
+	Logprob float64 `json:"logprob"`
+}
+
 // GenerateContentResponse represents the vendor-specific response.
 type GenerateContentResponse struct {
 	// Candidates are the potential responses from the model.
@@ -70,6 +117,9 @@ type Candidate struct {
 
 	// GroundingMetadata contains citation data if enabled.
 	GroundingMetadata *GroundingMetadata `json:"groundingMetadata,omitempty"`
+
+	// Logprobs contains token log probabilities if requested.
+	Logprobs *Logprobs `json:"logprobs,omitempty"`
 }
 
 // PromptFeedback contains information about prompt validation.
@@ -105,6 +155,9 @@ type LLMResponse struct {
 	// Interrupted signals if generation was interrupted (e.g. user cancel).
 	Interrupted *bool `json:"interrupted,omitempty"`
 
+	// Logprobs holds token log probabilities when the request asked for them.
+	Logprobs *Logprobs `json:"logprobs,omitempty"`
+
 	// CustomMetadata holds arbitrary, JSON-serializable metadata.
 	CustomMetadata map[string]any `json:"customMetadata,omitempty"`
 
@@ -130,6 +183,7 @@ func CreateLLMResponse(resp *GenerateContentResponse) LLMResponse {
 		if cand.Content != nil && (len(cand.Content.Parts) > 0 || cand.Content.Message != "") {
 			result.Content = cand.Content
 			result.GroundingMetadata = cand.GroundingMetadata
+			result.Logprobs = cand.Logprobs
 			return result
 		}
 		// Candidate present but no content parts: treat as error
@@ -154,6 +208,51 @@ func CreateLLMResponse(resp *GenerateContentResponse) LLMResponse {
 	return result
 }
 
+// MetadataConfidence is the CustomMetadata key holding a normalized (0-1) confidence score.
+const MetadataConfidence = "confidence"
+
+// SetConfidence records a normalized confidence score in CustomMetadata.
+func (r *LLMResponse) SetConfidence(score float64) {
+	if r.CustomMetadata == nil {
+		r.CustomMetadata = make(map[string]any)
+	}
+	r.CustomMetadata[MetadataConfidence] = score
+}
+
+// Confidence returns the confidence score recorded in CustomMetadata, if any.
+func (r *LLMResponse) Confidence() (float64, bool) {
+	score, ok := r.CustomMetadata[MetadataConfidence].(float64)
+	return score, ok
+}
+
+// MetadataRequest is the CustomMetadata key holding the RequestMetadata of the request a
+// response answers.
+const MetadataRequest = "request_metadata"
+
+// SetRequestMetadata records the request's metadata in CustomMetadata, replacing any recorded
+// before. Zero metadata removes it.
+func (r *LLMResponse) SetRequestMetadata(m RequestMetadata) {
+	if m.IsZero() {
+		delete(r.CustomMetadata, MetadataRequest)
+		return
+	}
+	if r.CustomMetadata == nil {
+		r.CustomMetadata = make(map[string]any)
+	}
+	r.CustomMetadata[MetadataRequest] = m
+}
+
+// RequestMetadata returns the request metadata recorded in CustomMetadata, if any.
+func (r *LLMResponse) RequestMetadata() (RequestMetadata, bool) {
+	m, ok := r.CustomMetadata[MetadataRequest].(RequestMetadata)
+	return m, ok
+}
+
+// IsPartial reports whether the response is part of an unfinished stream.
+func (r *LLMResponse) IsPartial() bool {
+	return r.Partial != nil && *r.Partial
+}
+
 // IsError returns true if the response contains an error.
 func (r *LLMResponse) IsError() bool {
 	return r.ErrorCode != nil || r.ErrorMessage != nil
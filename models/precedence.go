@@ -0,0 +1,132 @@
+package models
+
+import (
+	"regexp"
+	"regexp/syntax"
+	"sort"
+)
+
+// precedence ranks the patterns matching a model name. The most specific pattern wins: the one
+// requiring the most literal characters of the name, so that "gpt-4-turbo.*" wins over
+// "gpt-4-.*" for "gpt-4-turbo-2024-04-09". Among equally specific patterns, the earliest
+// registered wins; registering a pattern again keeps its place.
+type precedence struct {
+	literals int    // literal characters every name matching the pattern contains
+	seq      uint64 // registration order
+}
+
+// before reports whether p takes precedence over q.
+func (p precedence) before(q precedence) bool {
+	if p.literals != q.literals {
+		return p.literals > q.literals
+	}
+	return p.seq < q.seq
+}
+
+// setPattern registers info under pattern, which callers have checked compiles. Callers hold
+// r.mu.
+func (r *Registry) setPattern(pattern string, info ModelInfo) {
+	if _, ok := r.compiled[pattern]; !ok {
+		r.compiled[pattern] = regexp.MustCompile(pattern)
+	}
+	if _, ok := r.ranks[pattern]; !ok {
+		r.nextSeq++
+		r.ranks[pattern] = precedence{literals: literalLength(pattern), seq: r.nextSeq}
+		r.ordered = nil
+	}
+	info = info.withLimits()
+	previous, exists := r.patterns[pattern]
+	r.patterns[pattern] = info
+	switch {
+	case !exists:
+		r.record(RegistryEvent{Type: ModelAdded, Pattern: pattern, Model: info})
+	case len(r.subscribers) > 0 && !sameModel(previous, info):
+		r.record(RegistryEvent{Type: ModelUpdated, Pattern: pattern, Model: info, Previous: &previous})
+	}
+}
+
+// deletePattern removes the registration under pattern. Callers hold r.mu.
+func (r *Registry) deletePattern(pattern string) {
+	if info, ok := r.patterns[pattern]; ok {
+		r.record(RegistryEvent{Type: ModelRemoved, Pattern: pattern, Model: info})
+	}
+	delete(r.patterns, pattern)
+	delete(r.compiled, pattern)
+	delete(r.ranks, pattern)
+	r.ordered = nil
+}
+
+// clearPatterns removes every registration. Callers hold r.mu.
+func (r *Registry) clearPatterns() {
+	for _, pattern := range r.patternsByPrecedence() {
+		if len(r.subscribers) == 0 {
+			break
+		}
+		r.record(RegistryEvent{Type: ModelRemoved, Pattern: pattern, Model: r.patterns[pattern]})
+	}
+	r.patterns = make(map[string]ModelInfo)
+	r.compiled = make(map[string]*regexp.Regexp)
+	r.ranks = make(map[string]precedence)
+	r.ordered = nil
+}
+
+// patternsByPrecedence returns the registered patterns, those taking precedence first. Callers
+// hold r.mu for writing when the order may need to be rebuilt.
+func (r *Registry) patternsByPrecedence() []string {
+	if r.ordered == nil {
+		r.ordered = make([]string, 0, len(r.patterns))
+		for pattern := range r.patterns {
+			r.ordered = append(r.ordered, pattern)
+		}
+		sort.Slice(r.ordered, func(i, j int) bool { return r.ranks[r.ordered[i]].before(r.ranks[r.ordered[j]]) })
+	}
+	return r.ordered
+}
+
+// match returns the pattern taking precedence among those matching model, with the regexes
+// compiled when they were registered. Callers hold r.mu for writing.
+func (r *Registry) match(model string) (string, bool) {
+	for _, pattern := range r.patternsByPrecedence() {
+		if r.compiled[pattern].MatchString(model) {
+			return pattern, true
+		}
+	}
+	return "", false
+}
+
+// literalLength returns the number of literal characters every string matching pattern
+// contains, or 0 when pattern does not parse.
+func literalLength(pattern string) int {
+	re, err := syntax.Parse(pattern, syntax.Perl)
+	if err != nil {
+		return 0
+	}
+	return literals(re.Simplify())
+}
+
+// literals returns the number of literal characters every string matching re contains.
+func literals(re *syntax.Regexp) int {
+	switch re.Op {
+	case syntax.OpLiteral:
+		return len(re.Rune)
+	case syntax.OpCapture, syntax.OpPlus:
+		return literals(re.Sub[0])
+	case syntax.OpRepeat:
+		return re.Min * literals(re.Sub[0])
+	case syntax.OpConcat:
+		n := 0
+		for _, sub := range re.Sub {
+			n += literals(sub)
+		}
+		return n
+	case syntax.OpAlternate:
+		n := -1
+		for _, sub := range re.Sub {
+			if l := literals(sub); n < 0 || l < n {
+				n = l
+			}
+		}
+		return max(n, 0)
+	}
+	return 0
+}
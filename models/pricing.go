@@ -0,0 +1,318 @@
+package models
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Price sheet formats.
+const (
+	PriceSheetJSON = "json"
+	PriceSheetCSV  = "csv"
+)
+
+// Price is a model's per-token prices over an effective date range, in US dollars per million
+// tokens.
+type Price struct {
+	EffectiveFrom time.Time `json:"effectiveFrom"`
+
+	// EffectiveUntil is the start of the next price in the history, or zero for the current
+	// price.
+	EffectiveUntil time.Time `json:"effectiveUntil"`
+
+	InputCostPerMTok       float64 `json:"inputCostPerMTok"`
+	OutputCostPerMTok      float64 `json:"outputCostPerMTok"`
+	CachedInputCostPerMTok float64 `json:"cachedInputCostPerMTok,omitempty"`
+	CacheWriteCostPerMTok  float64 `json:"cacheWriteCostPerMTok,omitempty"`
+}
+
+// PriceSheetEntry is one price of a price sheet.
+type PriceSheetEntry struct {
+	// Model is the ID of a registered model, or a name resolving to one.
+	Model string `json:"model"`
+
+	// EffectiveFrom is the date the price applies from, as YYYY-MM-DD (UTC) or RFC 3339.
+	EffectiveFrom string `json:"effectiveFrom"`
+
+	InputCostPerMTok       float64 `json:"inputCostPerMTok"`
+	OutputCostPerMTok      float64 `json:"outputCostPerMTok"`
+	CachedInputCostPerMTok float64 `json:"cachedInputCostPerMTok,omitempty"`
+	CacheWriteCostPerMTok  float64 `json:"cacheWriteCostPerMTok,omitempty"`
+}
+
+// PriceSheet is a document of model prices, such as a provider's published pricing kept as a
+// data file.
+type PriceSheet struct {
+	Prices []PriceSheetEntry `json:"prices"`
+}
+
+// csvPriceColumns maps the CSV header names to the entry fields they set.
+var csvPriceColumns = map[string]func(e *PriceSheetEntry, value string) error{
+	"model":          func(e *PriceSheetEntry, v string) error { e.Model = v; return nil },
+	"effective_from": func(e *PriceSheetEntry, v string) error { e.EffectiveFrom = v; return nil },
+	"input_cost_per_mtok": func(e *PriceSheetEntry, v string) error {
+		return parsePrice(v, &e.InputCostPerMTok)
+	},
+	"output_cost_per_mtok": func(e *PriceSheetEntry, v string) error {
+		return parsePrice(v, &e.OutputCostPerMTok)
+	},
+	"cached_input_cost_per_mtok": func(e *PriceSheetEntry, v string) error {
+		return parsePrice(v, &e.CachedInputCostPerMTok)
+	},
+	"cache_write_cost_per_mtok": func(e *PriceSheetEntry, v string) error {
+		return parsePrice(v, &e.CacheWriteCostPerMTok)
+	},
+}
+
+// parsePrice parses a CSV price; an empty cell is zero.
+func parsePrice(value string, price *float64) error {
+	if value == "" {
+		return nil
+	}
+	p, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return fmt.Errorf("invalid price %q", value)
+	}
+	*price = p
+	return nil
+}
+
+// ParsePriceSheet reads a price sheet in format, PriceSheetJSON or PriceSheetCSV. A CSV sheet
+// has a header row naming its columns: model, effective_from, input_cost_per_mtok,
+// output_cost_per_mtok and the optional cached_input_cost_per_mtok and
+// cache_write_cost_per_mtok.
+func ParsePriceSheet(r io.Reader, format string) (PriceSheet, error) {
+	switch format {
+	case PriceSheetJSON:
+		var sheet PriceSheet
+		if err := json.NewDecoder(r).Decode(&sheet); err != nil {
+			return PriceSheet{}, fmt.Errorf("decoding price sheet: %w", err)
+		}
+		return sheet, nil
+	case PriceSheetCSV:
+		return parsePriceSheetCSV(r)
+	}
+	return PriceSheet{}, fmt.Errorf("unknown price sheet format %q", format)
+}
+
+func parsePriceSheetCSV(r io.Reader) (PriceSheet, error) {
+	reader := csv.NewReader(r)
+	reader.TrimLeadingSpace = true
+	header, err := reader.Read()
+	if err != nil {
+		return PriceSheet{}, fmt.Errorf("reading price sheet header: %w", err)
+	}
+	for i, name := range header {
+		header[i] = strings.ToLower(strings.TrimSpace(name))
+		if _, ok := csvPriceColumns[header[i]]; !ok {
+			return PriceSheet{}, fmt.Errorf("unknown price sheet column %q", name)
+		}
+	}
+
+	var sheet PriceSheet
+	for line := 2; ; line++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			return sheet, nil
+		}
+		if err != nil {
+			return PriceSheet{}, fmt.Errorf("reading price sheet: %w", err)
+		}
+		var entry PriceSheetEntry
+		for i, value := range record {
+			if err := csvPriceColumns[header[i]](&entry, strings.TrimSpace(value)); err != nil {
+				return PriceSheet{}, fmt.Errorf("price sheet line %d: %s: %w", line, header[i], err)
+			}
+		}
+		sheet.Prices = append(sheet.Prices, entry)
+	}
+}
+
+// LoadPriceSheet reads a price sheet file, in CSV when its extension is .csv and in JSON
+// otherwise.
+func LoadPriceSheet(path string) (PriceSheet, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return PriceSheet{}, err
+	}
+	defer f.Close()
+	format := PriceSheetJSON
+	if strings.EqualFold(filepath.Ext(path), ".csv") {
+		format = PriceSheetCSV
+	}
+	return ParsePriceSheet(f, format)
+}
+
+// FetchPriceSheet downloads a price sheet, in CSV when the response's content type or the
+// URL's path says so and in JSON otherwise.
+func FetchPriceSheet(ctx context.Context, url string) (PriceSheet, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return PriceSheet{}, err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return PriceSheet{}, fmt.Errorf("fetching price sheet: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return PriceSheet{}, fmt.Errorf("fetching price sheet: %s", resp.Status)
+	}
+	format := PriceSheetJSON
+	if strings.Contains(resp.Header.Get("Content-Type"), "csv") || strings.HasSuffix(strings.ToLower(req.URL.Path), ".csv") {
+		format = PriceSheetCSV
+	}
+	return ParsePriceSheet(resp.Body, format)
+}
+
+// price returns the entry's Price, or its problems joined with errors.Join.
+func (e PriceSheetEntry) price() (Price, error) {
+	var errs []error
+	if e.Model == "" {
+		errs = append(errs, errors.New("model is required"))
+	}
+	var from time.Time
+	if e.EffectiveFrom == "" {
+		errs = append(errs, errors.New("effectiveFrom is required"))
+	} else if t, err := time.Parse(time.DateOnly, e.EffectiveFrom); err == nil {
+		from = t
+	} else if t, err := time.Parse(time.RFC3339, e.EffectiveFrom); err == nil {
+		from = t
+	} else {
+		errs = append(errs, fmt.Errorf("effectiveFrom %q is not a date", e.EffectiveFrom))
+	}
+	if e.InputCostPerMTok < 0 || e.OutputCostPerMTok < 0 || e.CachedInputCostPerMTok < 0 || e.CacheWriteCostPerMTok < 0 {
+		errs = append(errs, errors.New("prices must not be negative"))
+	}
+	if e.InputCostPerMTok == 0 || e.OutputCostPerMTok == 0 {
+		errs = append(errs, errors.New("inputCostPerMTok and outputCostPerMTok are required"))
+	}
+	return Price{
+		EffectiveFrom:          from,
+		InputCostPerMTok:       e.InputCostPerMTok,
+		OutputCostPerMTok:      e.OutputCostPerMTok,
+		CachedInputCostPerMTok: e.CachedInputCostPerMTok,
+		CacheWriteCostPerMTok:  e.CacheWriteCostPerMTok,
+	}, errors.Join(errs...)
+}
+
+// ImportPrices adds the prices of sheet to the price history of the registered models, so
+// that EstimateCostAt prices usage at the rates in effect at the time; a price with the same
+// effective date as an existing one replaces it. Each model's pricing fields are set to the
+// price in effect now, and its prices before the first imported date are kept as the first
+// entry of its history. Either every price is imported or, when a price is invalid or names
+// no registered model, none is.
+func (r *Registry) ImportPrices(sheet PriceSheet) error {
+	r.mu.Lock()
+	defer r.unlock()
+
+	// Validate the whole sheet before changing the registry
+	prices := make([]Price, len(sheet.Prices))
+	targets := make([][]string, len(sheet.Prices))
+	for i, entry := range sheet.Prices {
+		price, err := entry.price()
+		if err == nil {
+			if targets[i] = r.pricedPatterns(entry.Model); len(targets[i]) == 0 {
+				err = fmt.Errorf("model %q is not registered", entry.Model)
+			}
+		}
+		if err != nil {
+			return fmt.Errorf("price sheet entry %d: %w", i, err)
+		}
+		prices[i] = price
+	}
+
+	now := time.Now()
+	for i, price := range prices {
+		for _, pattern := range targets[i] {
+			r.setPattern(pattern, addPrice(r.patterns[pattern], price, now))
+		}
+	}
+	r.cache = make(map[string]ModelInfo)
+	return nil
+}
+
+// ImportPrices adds the prices of sheet to the price history of the default registry's models.
+func ImportPrices(sheet PriceSheet) error {
+	return defaultRegistry.ImportPrices(sheet)
+}
+
+// pricedPatterns returns the patterns of the models a price sheet names: those registered with
+// model as their ID, or else the pattern model resolves to. Callers hold r.mu for writing.
+func (r *Registry) pricedPatterns(model string) []string {
+	var patterns []string
+	for pattern, info := range r.patterns {
+		if info.ID == model {
+			patterns = append(patterns, pattern)
+		}
+	}
+	if len(patterns) > 0 {
+		return patterns
+	}
+	if pattern, matched := r.match(model); matched {
+		return []string{pattern}
+	}
+	return nil
+}
+
+// addPrice returns info with price added to its history and its pricing fields set to the
+// price in effect at now.
+func addPrice(info ModelInfo, price Price, now time.Time) ModelInfo {
+	history := make([]Price, 0, len(info.PriceHistory)+2)
+	if len(info.PriceHistory) == 0 {
+		// The registered prices apply until the first imported one
+		history = append(history, info.currentPrice())
+	}
+	for _, p := range info.PriceHistory {
+		if !p.EffectiveFrom.Equal(price.EffectiveFrom) {
+			history = append(history, p)
+		}
+	}
+	history = append(history, price)
+	sort.Slice(history, func(i, j int) bool { return history[i].EffectiveFrom.Before(history[j].EffectiveFrom) })
+	for i := range history {
+		history[i].EffectiveUntil = time.Time{}
+		if i+1 < len(history) {
+			history[i].EffectiveUntil = history[i+1].EffectiveFrom
+		}
+	}
+	info.PriceHistory = history
+	return info.PriceAt(now)
+}
+
+// currentPrice returns the pricing fields of info as a Price effective from the beginning.
+func (info ModelInfo) currentPrice() Price {
+	return Price{
+		InputCostPerMTok:       info.InputCostPerMTok,
+		OutputCostPerMTok:      info.OutputCostPerMTok,
+		CachedInputCostPerMTok: info.CachedInputCostPerMTok,
+		CacheWriteCostPerMTok:  info.CacheWriteCostPerMTok,
+	}
+}
+
+// PriceAt returns info with its pricing fields set to the price of its PriceHistory in
+// effect at t. Without a history, or before its first price, info is returned unchanged.
+func (info ModelInfo) PriceAt(t time.Time) ModelInfo {
+	for i := len(info.PriceHistory) - 1; i >= 0; i-- {
+		p := info.PriceHistory[i]
+		if !p.EffectiveFrom.After(t) {
+			info.InputCostPerMTok = p.InputCostPerMTok
+			info.OutputCostPerMTok = p.OutputCostPerMTok
+			info.CachedInputCostPerMTok = p.CachedInputCostPerMTok
+			info.CacheWriteCostPerMTok = p.CacheWriteCostPerMTok
+			return info
+		}
+	}
+	return info
+}
@@ -3,8 +3,10 @@ package models
 import (
 	"fmt"
 	"regexp"
+	"sort"
 	"strings"
 	"sync"
+	"time"
 )
 
 // Common model profile constants
@@ -44,12 +46,50 @@ type ModelInfo struct {
 	// Profiles lists capabilities (e.g. "chat", "thinking", "agent").
 	Profiles []string `json:"profiles"`
 
-	// MaxTokens is the model's maximum context window size.
+	// MaxTokens is the model's maximum context window size. It predates ContextWindow and is
+	// kept for catalogs and callers that use it; registering a model fills whichever of the
+	// two is missing from the other.
 	MaxTokens int `json:"maxTokens"`
 
+	// ContextWindow is the most tokens the model accepts in a call, prompt and completion
+	// together.
+	ContextWindow int `json:"contextWindow,omitempty"`
+
+	// MaxOutputTokens is the most tokens the model generates in a call, usually well below
+	// its context window. Zero means the provider publishes no separate limit.
+	MaxOutputTokens int `json:"maxOutputTokens,omitempty"`
+
+	// Capabilities are the input modalities and API features the model supports. Nil means
+	// they are unknown, and requests are not checked against them.
+	Capabilities *Capabilities `json:"capabilities,omitempty"`
+
 	// CostPerToken is the price per token in cents.
 	CostPerToken float64 `json:"costPerToken"`
 
+	// InputCostPerMTok is the price of a million prompt tokens in US dollars.
+	InputCostPerMTok float64 `json:"inputCostPerMTok,omitempty"`
+
+	// OutputCostPerMTok is the price of a million completion tokens in US dollars.
+	OutputCostPerMTok float64 `json:"outputCostPerMTok,omitempty"`
+
+	// CachedInputCostPerMTok is the price of a million prompt tokens read from the provider's
+	// prompt cache in US dollars. Zero prices them as uncached input.
+	CachedInputCostPerMTok float64 `json:"cachedInputCostPerMTok,omitempty"`
+
+	// CacheWriteCostPerMTok is the price of a million prompt tokens written to the provider's
+	// prompt cache in US dollars. Zero prices them as uncached input.
+	CacheWriteCostPerMTok float64 `json:"cacheWriteCostPerMTok,omitempty"`
+
+	// PriceHistory holds the model's prices by effective date range, oldest first, as imported
+	// with ImportPrices. The pricing fields above hold the price in effect when it was last
+	// imported.
+	PriceHistory []Price `json:"priceHistory,omitempty"`
+
+	// ServiceTierMultipliers scale the model's prices for requests served in a service tier,
+	// e.g. {"priority": 1.75}. Tiers without an entry use the usual provider multipliers:
+	// half for flex, 1.75 for priority.
+	ServiceTierMultipliers map[string]float64 `json:"serviceTierMultipliers,omitempty"`
+
 	// Provider indicates the vendor (OpenAI, Anthropic, etc).
 	Provider string `json:"provider"`
 
@@ -58,93 +98,302 @@ type ModelInfo struct {
 
 	// Version is semantic version of the model if available.
 	Version string `json:"version,omitempty"`
+
+	// DeprecatedAt is when the provider retires the model, once announced. Calls may fail
+	// after it.
+	DeprecatedAt *time.Time `json:"deprecatedAt,omitempty"`
 }
 
-var (
+// withLimits returns info with ContextWindow set from MaxTokens when it is missing, and the
+// reverse, so that callers of either field see the registered window.
+func (info ModelInfo) withLimits() ModelInfo {
+	if info.ContextWindow == 0 {
+		info.ContextWindow = info.MaxTokens
+	}
+	if info.MaxTokens == 0 {
+		info.MaxTokens = info.ContextWindow
+	}
+	return info
+}
+
+// Requirements constrains which model serves a request. Zero values impose no constraint.
+type Requirements struct {
+	// Profile is a capability the model must support (e.g. "agent").
+	Profile string `json:"profile,omitempty"`
+
+	// MaxCostCents is the most the request may cost, in cents.
+	MaxCostCents float64 `json:"maxCostCents,omitempty"`
+
+	// PreferProvider ranks this provider's models ahead of the others that qualify.
+	PreferProvider string `json:"preferProvider,omitempty"`
+}
+
+// Registry holds models registered under model-name regex patterns, and aliases of their
+// names. The package-level functions use a default Registry shared by the process; a
+// Registry of its own isolates a test or a tenant from it. It is safe for concurrent use.
+type Registry struct {
 	mu       sync.RWMutex
-	registry = make(map[string]ModelInfo) // regex -> ModelInfo
-	cache    = make(map[string]ModelInfo) // model name -> resolved ModelInfo
-)
+	patterns map[string]ModelInfo      // regex -> ModelInfo
+	compiled map[string]*regexp.Regexp // regex -> its compiled form
+	cache    map[string]ModelInfo      // model name -> resolved ModelInfo
+	aliases  map[string]string         // logical name -> the model, or alias, it stands for
+
+	ranks   map[string]precedence // regex -> its precedence
+	nextSeq uint64
+	ordered []string // patterns by precedence; nil when it must be rebuilt
+
+	subscribers    []subscriber
+	nextSubscriber uint64
+	pending        []RegistryEvent // changes not yet delivered to subscribers
+	deliverMu      sync.Mutex      // serializes deliveries
+}
+
+// NewRegistry returns an empty Registry.
+func NewRegistry() *Registry {
+	return &Registry{
+		patterns: make(map[string]ModelInfo),
+		compiled: make(map[string]*regexp.Regexp),
+		cache:    make(map[string]ModelInfo),
+		aliases:  make(map[string]string),
+		ranks:    make(map[string]precedence),
+	}
+}
+
+// defaultRegistry is the Registry of the package-level functions.
+var defaultRegistry = NewRegistry()
+
+// Default returns the Registry the package-level functions use.
+func Default() *Registry {
+	return defaultRegistry
+}
 
 // Register registers a ModelInfo under a model-name regex pattern.
 // regexPattern should be a valid Go regexp that matches model IDs.
-func Register(regexPattern string, info ModelInfo) error {
-	mu.Lock()
-	defer mu.Unlock()
-	if _, exists := registry[regexPattern]; exists {
+func (r *Registry) Register(regexPattern string, info ModelInfo) error {
+	r.mu.Lock()
+	defer r.unlock()
+	if _, exists := r.patterns[regexPattern]; exists {
 		// Overwrite existing registration
 	}
-	// Validate regex compiles
-	if _, err := regexp.Compile(regexPattern); err != nil {
+	re, err := regexp.Compile(regexPattern)
+	if err != nil {
 		return fmt.Errorf("invalid regex %q: %w", regexPattern, err)
 	}
-	registry[regexPattern] = info
+	r.compiled[regexPattern] = re
+	r.setPattern(regexPattern, info)
 	// Clear cache to force re-resolve
-	cache = make(map[string]ModelInfo)
+	r.cache = make(map[string]ModelInfo)
 	return nil
 }
 
-// Resolve returns the ModelInfo whose regex matches the given model name.
-// It caches resolutions for performance.
-func Resolve(model string) (ModelInfo, error) {
-	mu.RLock()
-	if info, found := cache[model]; found {
-		mu.RUnlock()
+// Register registers info under regexPattern in the default registry.
+func Register(regexPattern string, info ModelInfo) error {
+	return defaultRegistry.Register(regexPattern, info)
+}
+
+// Unregister removes the registration under regexPattern, and reports whether there was one.
+// Aliases of the model are kept.
+func (r *Registry) Unregister(regexPattern string) bool {
+	r.mu.Lock()
+	defer r.unlock()
+	if _, exists := r.patterns[regexPattern]; !exists {
+		return false
+	}
+	r.deletePattern(regexPattern)
+	r.cache = make(map[string]ModelInfo)
+	return true
+}
+
+// Unregister removes the registration under regexPattern from the default registry.
+func Unregister(regexPattern string) bool {
+	return defaultRegistry.Unregister(regexPattern)
+}
+
+// Resolve returns the ModelInfo whose regex matches the given model name, or the name an alias
+// registered with RegisterAlias stands for; the ModelInfo's ID is then the aliased model.
+// When several regexes match, the most specific wins: the one with the most literal
+// characters, then the earliest registered.
+// It caches resolutions for performance. An unknown model fails with a *ModelNotFoundError
+// suggesting the closest registered models.
+func (r *Registry) Resolve(model string) (ModelInfo, error) {
+	r.mu.RLock()
+	model, _ = r.resolveAlias(model)
+	if info, found := r.cache[model]; found {
+		r.mu.RUnlock()
 		return info, nil
 	}
-	mu.RUnlock()
+	r.mu.RUnlock()
 
-	mu.Lock()
-	defer mu.Unlock()
+	r.mu.Lock()
+	defer r.mu.Unlock()
 	// Double-check cache under write lock
-	if info, found := cache[model]; found {
+	if info, found := r.cache[model]; found {
 		return info, nil
 	}
-	for pattern, info := range registry {
-		matched, err := regexp.MatchString(pattern, model)
-		if err != nil {
-			return ModelInfo{}, fmt.Errorf("invalid regex %q during resolve: %w", pattern, err)
-		}
-		if matched {
-			// Create a copy with the exact ID that was requested
-			resolvedInfo := info
-			resolvedInfo.ID = model
-			cache[model] = resolvedInfo
-			return resolvedInfo, nil
-		}
+	if pattern, matched := r.match(model); matched {
+		// Create a copy with the exact ID that was requested
+		resolvedInfo := r.patterns[pattern]
+		resolvedInfo.ID = model
+		r.cache[model] = resolvedInfo
+		return resolvedInfo, nil
+	}
+	candidates := make([]string, 0, 2*len(r.patterns))
+	for pattern, info := range r.patterns {
+		candidates = append(candidates, pattern, info.ID)
+	}
+	for alias := range r.aliases {
+		candidates = append(candidates, alias)
+	}
+	return ModelInfo{}, NewModelNotFoundError(model, candidates)
+}
+
+// Resolve resolves model in the default registry. See Registry.Resolve.
+func Resolve(model string) (ModelInfo, error) {
+	return defaultRegistry.Resolve(model)
+}
+
+// EstimateCost returns the cost of usage on model in cents at the current prices. Models with
+// per-direction prices are charged separately for uncached prompt, cached prompt, cache-write
+// prompt and completion tokens; other models are charged TotalTokens at CostPerToken.
+func (r *Registry) EstimateCost(model string, usage UsageMetrics) (float64, error) {
+	return r.EstimateCostAt(model, usage, time.Now())
+}
+
+// EstimateCost prices usage on model at the default registry's current prices.
+func EstimateCost(model string, usage UsageMetrics) (float64, error) {
+	return defaultRegistry.EstimateCost(model, usage)
+}
+
+// EstimateCostAt returns the cost of usage on model in cents at the prices in effect at t,
+// for reporting the cost of past usage after prices changed. See EstimateCost.
+func (r *Registry) EstimateCostAt(model string, usage UsageMetrics, t time.Time) (float64, error) {
+	info, err := r.Resolve(model)
+	if err != nil {
+		return 0, err
 	}
-	return ModelInfo{}, fmt.Errorf("model not found: %s", model)
+	info = info.PriceAt(t)
+	if info.InputCostPerMTok == 0 && info.OutputCostPerMTok == 0 {
+		return float64(usage.TotalTokens) * info.CostPerToken, nil
+	}
+
+	cachedRate := info.CachedInputCostPerMTok
+	if cachedRate == 0 {
+		cachedRate = info.InputCostPerMTok
+	}
+	writeRate := info.CacheWriteCostPerMTok
+	if writeRate == 0 {
+		writeRate = info.InputCostPerMTok
+	}
+	cached := min(usage.CachedPromptTokens, usage.PromptTokens)
+	written := min(usage.CacheWritePromptTokens, usage.PromptTokens-cached)
+	dollars := (float64(usage.PromptTokens-cached-written)*info.InputCostPerMTok +
+		float64(cached)*cachedRate +
+		float64(written)*writeRate +
+		float64(usage.CompletionTokens)*info.OutputCostPerMTok) / 1e6
+	return dollars * 100, nil
+}
+
+// EstimateCostAt prices usage on model at the default registry's prices in effect at t.
+func EstimateCostAt(model string, usage UsageMetrics, t time.Time) (float64, error) {
+	return defaultRegistry.EstimateCostAt(model, usage, t)
+}
+
+// defaultServiceTierMultipliers are the price multipliers of service tiers for models without
+// their own.
+var defaultServiceTierMultipliers = map[string]float64{
+	ServiceTierFlex:     0.5,
+	ServiceTierPriority: 1.75,
+}
+
+// ServiceTierMultiplier returns the factor the model's prices are scaled by in tier. It is 1
+// for the default tier and unknown tiers.
+func (info ModelInfo) ServiceTierMultiplier(tier string) float64 {
+	if m, ok := info.ServiceTierMultipliers[tier]; ok && m > 0 {
+		return m
+	}
+	if m, ok := defaultServiceTierMultipliers[tier]; ok {
+		return m
+	}
+	return 1
+}
+
+// EstimateTierCost returns the cost of usage on model in cents like EstimateCost, for a request
+// served in tier.
+func (r *Registry) EstimateTierCost(model string, usage UsageMetrics, tier string) (float64, error) {
+	cost, err := r.EstimateCost(model, usage)
+	if err != nil {
+		return 0, err
+	}
+	info, err := r.Resolve(model)
+	if err != nil {
+		return 0, err
+	}
+	return cost * info.ServiceTierMultiplier(tier), nil
+}
+
+// EstimateTierCost prices usage on model served in tier with the default registry.
+func EstimateTierCost(model string, usage UsageMetrics, tier string) (float64, error) {
+	return defaultRegistry.EstimateTierCost(model, usage, tier)
 }
 
 // NewModelInfo is a helper to register multiple patterns at once.
-func NewModelInfo(info ModelInfo, patterns ...string) error {
+func (r *Registry) NewModelInfo(info ModelInfo, patterns ...string) error {
 	for _, p := range patterns {
-		if err := Register(p, info); err != nil {
+		if err := r.Register(p, info); err != nil {
 			return err
 		}
 	}
 	return nil
 }
 
-// ListModels returns a list of all registered model patterns.
+// NewModelInfo registers info under each of patterns in the default registry.
+func NewModelInfo(info ModelInfo, patterns ...string) error {
+	return defaultRegistry.NewModelInfo(info, patterns...)
+}
+
+// ListModels returns a list of all registered model patterns, in the order Resolve tries them.
+func (r *Registry) ListModels() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]string(nil), r.patternsByPrecedence()...)
+}
+
+// ListModels returns the patterns of the default registry, in the order Resolve tries them.
 func ListModels() []string {
-	mu.RLock()
-	defer mu.RUnlock()
+	return defaultRegistry.ListModels()
+}
 
-	patterns := make([]string, 0, len(registry))
-	for pattern := range registry {
-		patterns = append(patterns, pattern)
+// ListModelInfos returns every registered model once, sorted by ID, even when it is
+// registered under several patterns.
+func (r *Registry) ListModelInfos() []ModelInfo {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	seen := make(map[string]bool, len(r.patterns))
+	infos := make([]ModelInfo, 0, len(r.patterns))
+	for _, info := range r.patterns {
+		if seen[info.ID] {
+			continue
+		}
+		seen[info.ID] = true
+		infos = append(infos, info)
 	}
-	return patterns
+	sort.Slice(infos, func(i, j int) bool { return infos[i].ID < infos[j].ID })
+	return infos
+}
+
+// ListModelInfos returns every model of the default registry once, sorted by ID.
+func ListModelInfos() []ModelInfo {
+	return defaultRegistry.ListModelInfos()
 }
 
 // ListModelsByProfile returns models that support a specific profile.
-func ListModelsByProfile(profile string) []ModelInfo {
-	mu.RLock()
-	defer mu.RUnlock()
+func (r *Registry) ListModelsByProfile(profile string) []ModelInfo {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
 
 	var models []ModelInfo
-	for _, info := range registry {
+	for _, info := range r.patterns {
 		for _, p := range info.Profiles {
 			if p == profile {
 				models = append(models, info)
@@ -155,13 +404,18 @@ func ListModelsByProfile(profile string) []ModelInfo {
 	return models
 }
 
+// ListModelsByProfile returns the models of the default registry that support profile.
+func ListModelsByProfile(profile string) []ModelInfo {
+	return defaultRegistry.ListModelsByProfile(profile)
+}
+
 // ListModelsByProvider returns models from a specific provider.
-func ListModelsByProvider(provider string) []ModelInfo {
-	mu.RLock()
-	defer mu.RUnlock()
+func (r *Registry) ListModelsByProvider(provider string) []ModelInfo {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
 
 	var models []ModelInfo
-	for _, info := range registry {
+	for _, info := range r.patterns {
 		if strings.EqualFold(info.Provider, provider) {
 			models = append(models, info)
 		}
@@ -169,9 +423,14 @@ func ListModelsByProvider(provider string) []ModelInfo {
 	return models
 }
 
+// ListModelsByProvider returns the models of the default registry from provider.
+func ListModelsByProvider(provider string) []ModelInfo {
+	return defaultRegistry.ListModelsByProvider(provider)
+}
+
 // HasProfile checks if a model supports a specific profile.
-func HasProfile(model, profile string) (bool, error) {
-	info, err := Resolve(model)
+func (r *Registry) HasProfile(model, profile string) (bool, error) {
+	info, err := r.Resolve(model)
 	if err != nil {
 		return false, err
 	}
@@ -184,88 +443,142 @@ func HasProfile(model, profile string) (bool, error) {
 	return false, nil
 }
 
-// ClearRegistry removes all model registrations.
+// HasProfile checks if a model of the default registry supports profile.
+func HasProfile(model, profile string) (bool, error) {
+	return defaultRegistry.HasProfile(model, profile)
+}
+
+// Clear removes all model registrations and aliases.
+func (r *Registry) Clear() {
+	r.mu.Lock()
+	defer r.unlock()
+	r.clearPatterns()
+	r.cache = make(map[string]ModelInfo)
+	r.aliases = make(map[string]string)
+}
+
+// ClearRegistry removes all model registrations and aliases of the default registry.
 // Primarily used for testing.
 func ClearRegistry() {
-	mu.Lock()
-	defer mu.Unlock()
-	registry = make(map[string]ModelInfo)
-	cache = make(map[string]ModelInfo)
+	defaultRegistry.Clear()
 }
 
 // Init registers common models with the registry.
-func Init() {
+func (r *Registry) Init() {
 	// OpenAI models
-	NewModelInfo(ModelInfo{
-		ID:           "gpt-4-turbo",
-		Profiles:     []string{ProfileChat, ProfileThinking, ProfileAgent, ProfileRAG},
-		MaxTokens:    128000,
-		CostPerToken: 0.00001,
-		Provider:     ProviderOpenAI,
-		CostTier:     CostTierPremium,
-		Version:      "1.0",
+	r.NewModelInfo(ModelInfo{
+		ID:                "gpt-4-turbo",
+		Profiles:          []string{ProfileChat, ProfileThinking, ProfileAgent, ProfileRAG},
+		MaxTokens:         128000,
+		ContextWindow:     128000,
+		MaxOutputTokens:   4096,
+		Capabilities:      &Capabilities{Vision: true, Tools: true, JSONMode: true, Streaming: true, ParallelTools: true},
+		CostPerToken:      0.00001,
+		InputCostPerMTok:  10,
+		OutputCostPerMTok: 30,
+		Provider:          ProviderOpenAI,
+		CostTier:          CostTierPremium,
+		Version:           "1.0",
 	}, "gpt-4-turbo.*")
 
-	NewModelInfo(ModelInfo{
-		ID:           "gpt-4",
-		Profiles:     []string{ProfileChat, ProfileThinking, ProfileAgent},
-		MaxTokens:    8192,
-		CostPerToken: 0.00003,
-		Provider:     ProviderOpenAI,
-		CostTier:     CostTierPremium,
-		Version:      "1.0",
+	r.NewModelInfo(ModelInfo{
+		ID:                "gpt-4",
+		Profiles:          []string{ProfileChat, ProfileThinking, ProfileAgent},
+		MaxTokens:         8192,
+		ContextWindow:     8192,
+		MaxOutputTokens:   8192,
+		Capabilities:      &Capabilities{Tools: true, JSONMode: true, Streaming: true},
+		CostPerToken:      0.00003,
+		InputCostPerMTok:  30,
+		OutputCostPerMTok: 60,
+		Provider:          ProviderOpenAI,
+		CostTier:          CostTierPremium,
+		Version:           "1.0",
 	}, "gpt-4$", "gpt-4-.*")
 
-	NewModelInfo(ModelInfo{
-		ID:           "gpt-3.5-turbo",
-		Profiles:     []string{ProfileChat, ProfileAgent},
-		MaxTokens:    16385,
-		CostPerToken: 0.000002,
-		Provider:     ProviderOpenAI,
-		CostTier:     CostTierStandard,
-		Version:      "1.0",
+	r.NewModelInfo(ModelInfo{
+		ID:                "gpt-3.5-turbo",
+		Profiles:          []string{ProfileChat, ProfileAgent},
+		MaxTokens:         16385,
+		ContextWindow:     16385,
+		MaxOutputTokens:   4096,
+		Capabilities:      &Capabilities{Tools: true, JSONMode: true, Streaming: true, ParallelTools: true},
+		CostPerToken:      0.000002,
+		InputCostPerMTok:  0.5,
+		OutputCostPerMTok: 1.5,
+		Provider:          ProviderOpenAI,
+		CostTier:          CostTierStandard,
+		Version:           "1.0",
 	}, "gpt-3.5-turbo.*")
 
 	// Anthropic models
-	NewModelInfo(ModelInfo{
-		ID:           "claude-3-opus",
-		Profiles:     []string{ProfileChat, ProfileThinking, ProfileRAG, ProfileCreative},
-		MaxTokens:    200000,
-		CostPerToken: 0.00002,
-		Provider:     ProviderAnthropic,
-		CostTier:     CostTierPremium,
-		Version:      "1.0",
+	r.NewModelInfo(ModelInfo{
+		ID:                     "claude-3-opus",
+		Profiles:               []string{ProfileChat, ProfileThinking, ProfileRAG, ProfileCreative},
+		MaxTokens:              200000,
+		ContextWindow:          200000,
+		MaxOutputTokens:        4096,
+		Capabilities:           &Capabilities{Vision: true, Tools: true, JSONMode: true, Streaming: true, ParallelTools: true},
+		CostPerToken:           0.00002,
+		InputCostPerMTok:       15,
+		OutputCostPerMTok:      75,
+		CachedInputCostPerMTok: 1.5,
+		CacheWriteCostPerMTok:  18.75,
+		Provider:               ProviderAnthropic,
+		CostTier:               CostTierPremium,
+		Version:                "1.0",
 	}, "claude-3-opus.*")
 
-	NewModelInfo(ModelInfo{
-		ID:           "claude-3-sonnet",
-		Profiles:     []string{ProfileChat, ProfileThinking, ProfileRAG},
-		MaxTokens:    200000,
-		CostPerToken: 0.00001,
-		Provider:     ProviderAnthropic,
-		CostTier:     CostTierStandard,
-		Version:      "1.0",
+	r.NewModelInfo(ModelInfo{
+		ID:                     "claude-3-sonnet",
+		Profiles:               []string{ProfileChat, ProfileThinking, ProfileRAG},
+		MaxTokens:              200000,
+		ContextWindow:          200000,
+		MaxOutputTokens:        4096,
+		Capabilities:           &Capabilities{Vision: true, Tools: true, JSONMode: true, Streaming: true, ParallelTools: true},
+		CostPerToken:           0.00001,
+		InputCostPerMTok:       3,
+		OutputCostPerMTok:      15,
+		CachedInputCostPerMTok: 0.3,
+		CacheWriteCostPerMTok:  3.75,
+		Provider:               ProviderAnthropic,
+		CostTier:               CostTierStandard,
+		Version:                "1.0",
 	}, "claude-3-sonnet.*")
 
 	// Google models
-	NewModelInfo(ModelInfo{
-		ID:           "gemini-pro",
-		Profiles:     []string{ProfileChat, ProfileAgent, ProfileRAG},
-		MaxTokens:    32768,
-		CostPerToken: 0.000005,
-		Provider:     ProviderGoogle,
-		CostTier:     CostTierStandard,
-		Version:      "1.0",
+	r.NewModelInfo(ModelInfo{
+		ID:                "gemini-pro",
+		Profiles:          []string{ProfileChat, ProfileAgent, ProfileRAG},
+		MaxTokens:         32768,
+		ContextWindow:     32768,
+		MaxOutputTokens:   8192,
+		Capabilities:      &Capabilities{Tools: true, JSONMode: true, Streaming: true},
+		CostPerToken:      0.000005,
+		InputCostPerMTok:  0.5,
+		OutputCostPerMTok: 1.5,
+		Provider:          ProviderGoogle,
+		CostTier:          CostTierStandard,
+		Version:           "1.0",
 	}, "gemini-pro.*")
 
 	// Mistral models
-	NewModelInfo(ModelInfo{
-		ID:           "mistral-large",
-		Profiles:     []string{ProfileChat, ProfileThinking},
-		MaxTokens:    32768,
-		CostPerToken: 0.000008,
-		Provider:     ProviderMistral,
-		CostTier:     CostTierStandard,
-		Version:      "1.0",
+	r.NewModelInfo(ModelInfo{
+		ID:                "mistral-large",
+		Profiles:          []string{ProfileChat, ProfileThinking},
+		MaxTokens:         32768,
+		ContextWindow:     32768,
+		Capabilities:      &Capabilities{Tools: true, JSONMode: true, Streaming: true, ParallelTools: true},
+		CostPerToken:      0.000008,
+		InputCostPerMTok:  2,
+		OutputCostPerMTok: 6,
+		Provider:          ProviderMistral,
+		CostTier:          CostTierStandard,
+		Version:           "1.0",
 	}, "mistral-large.*")
 }
+
+// Init registers common models with the default registry.
+func Init() {
+	defaultRegistry.Init()
+}
@@ -1,8 +1,16 @@
 package models
 
 import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"reflect"
 	"strings"
 	"testing"
+	"time"
 )
 
 func setupTestRegistry() {
@@ -68,6 +76,47 @@ func TestRegister(t *testing.T) {
 	}
 }
 
+func TestRegistryIsolation(t *testing.T) {
+	setupTestRegistry()
+
+	// Registries of their own do not see each other nor the default registry
+	tenants := []string{"tenant-a", "tenant-b"}
+	for _, tenant := range tenants {
+		tenant := tenant
+		t.Run(tenant, func(t *testing.T) {
+			t.Parallel()
+			r := NewRegistry()
+			if err := r.Register("^private-.*", ModelInfo{ID: tenant + "-model", MaxTokens: 1024}); err != nil {
+				t.Fatal(err)
+			}
+			if err := r.RegisterAlias("fast", "private-small"); err != nil {
+				t.Fatal(err)
+			}
+			info, err := r.Resolve("fast")
+			if err != nil || info.ID != "private-small" || info.MaxTokens != 1024 {
+				t.Errorf("Resolve() = %+v, %v", info, err)
+			}
+			if models := r.ListModels(); len(models) != 1 {
+				t.Errorf("Expected the registry's own pattern only, got %v", models)
+			}
+			if _, err := r.Resolve("test-model-1"); !errors.Is(err, ErrModelNotFound) {
+				t.Errorf("Expected the default registry's models to be unknown, got %v", err)
+			}
+			if !r.Unregister("^private-.*") || r.Unregister("^private-.*") {
+				t.Error("Expected the pattern to be unregistered once")
+			}
+		})
+	}
+	t.Cleanup(func() {
+		if _, err := Resolve("private-small"); err == nil {
+			t.Error("Expected the default registry to be unchanged")
+		}
+		if Default() != defaultRegistry || len(ListModels()) != 3 {
+			t.Errorf("Unexpected default registry %v", ListModels())
+		}
+	})
+}
+
 func TestResolve(t *testing.T) {
 	setupTestRegistry()
 
@@ -128,6 +177,70 @@ func TestResolve(t *testing.T) {
 	}
 }
 
+func TestResolveSuggestions(t *testing.T) {
+	setupTestRegistry()
+
+	_, err := Resolve("test-modle-1")
+	var notFound *ModelNotFoundError
+	if !errors.As(err, &notFound) || !errors.Is(err, ErrModelNotFound) {
+		t.Fatalf("Resolve() error = %v, want a *ModelNotFoundError", err)
+	}
+	if len(notFound.Suggestions) == 0 || notFound.Suggestions[0] != "test-model-1" {
+		t.Errorf("Expected test-model-1 first, got %v", notFound.Suggestions)
+	}
+	if !strings.Contains(err.Error(), "did you mean test-model-1") {
+		t.Errorf("Unexpected message %q", err.Error())
+	}
+
+	got := Suggest("gpt4o", []string{"^claude-3-opus.*", "gpt-4$", "gpt-4o", `claude-3\.5`, "gpt-4-.*"})
+	if len(got) != 2 || got[0] != "gpt-4o" || got[1] != "gpt-4" {
+		t.Errorf("Suggest() = %v, want [gpt-4o gpt-4]", got)
+	}
+	if got := Suggest("mistral-large", []string{"gpt-4"}); len(got) != 0 {
+		t.Errorf("Expected no suggestions for distant names, got %v", got)
+	}
+}
+
+func TestResolvePrecedence(t *testing.T) {
+	// Map iteration order differs between runs, resolution must not
+	for run := 0; run < 50; run++ {
+		ClearRegistry()
+		for _, pattern := range []string{"gpt-4-.*", "gpt-4$", "gpt-4-turbo.*", "g.t-.*", "(gp|o)t-.*", "gpt-.*"} {
+			Register(pattern, ModelInfo{ID: "gpt", Version: pattern})
+		}
+
+		for model, want := range map[string]string{
+			"gpt-4-turbo-2024-04-09": "gpt-4-turbo.*", // the most literal characters
+			"gpt-4-0613":             "gpt-4-.*",
+			"gpt-4":                  "gpt-4$",
+			"gpt-3.5-turbo":          "gpt-.*",
+			"got-1":                  "g.t-.*", // ties with (gp|o)t-.* and was registered first
+		} {
+			if info, err := Resolve(model); err != nil || info.Version != want {
+				t.Fatalf("Run %d: %s resolved to %s, want %s (%v)", run, model, info.Version, want, err)
+			}
+		}
+
+		want := []string{"gpt-4-turbo.*", "gpt-4-.*", "gpt-4$", "gpt-.*", "g.t-.*", "(gp|o)t-.*"}
+		if got := ListModels(); !reflect.DeepEqual(got, want) {
+			t.Fatalf("Run %d: ListModels() = %v, want %v", run, got, want)
+		}
+	}
+
+	// Registering a pattern again keeps its place
+	Register("g.t-.*", ModelInfo{ID: "gxt", Version: "g.t-.*"})
+	if info, _ := Resolve("got-1"); info.Version != "g.t-.*" {
+		t.Errorf("Expected g.t-.* to keep precedence over (gp|o)t-.*, got %s", info.Version)
+	}
+
+	// An unregistered pattern registered again goes last among its ties
+	Unregister("g.t-.*")
+	Register("g.t-.*", ModelInfo{ID: "gxt", Version: "g.t-.*"})
+	if info, _ := Resolve("got-1"); info.Version != "(gp|o)t-.*" {
+		t.Errorf("Expected (gp|o)t-.* to take precedence, got %s", info.Version)
+	}
+}
+
 func TestListModels(t *testing.T) {
 	setupTestRegistry()
 
@@ -148,6 +261,437 @@ func TestListModels(t *testing.T) {
 	}
 }
 
+func TestListModelInfos(t *testing.T) {
+	setupTestRegistry()
+	Register("test-model-1-.*", ModelInfo{ID: "test-model-1"})
+
+	infos := ListModelInfos()
+	if len(infos) != 3 {
+		t.Fatalf("ListModelInfos() returned %d models, want 3", len(infos))
+	}
+	for i, want := range []string{"test-model-1", "test-model-2", "test-regex-model"} {
+		if infos[i].ID != want {
+			t.Errorf("ListModelInfos()[%d] = %s, want %s", i, infos[i].ID, want)
+		}
+	}
+}
+
+func TestEstimateCost(t *testing.T) {
+	setupTestRegistry()
+	NewModelInfo(ModelInfo{
+		ID:                     "priced-model",
+		InputCostPerMTok:       3,
+		OutputCostPerMTok:      15,
+		CachedInputCostPerMTok: 0.3,
+		CacheWriteCostPerMTok:  3.75,
+	}, "priced-model")
+	NewModelInfo(ModelInfo{ID: "uncached-model", InputCostPerMTok: 2, OutputCostPerMTok: 6}, "uncached-model")
+
+	tests := []struct {
+		model string
+		usage UsageMetrics
+		want  float64
+	}{
+		// 600k uncached input at $3, 400k cached at $0.30, 100k output at $15
+		{"priced-model", UsageMetrics{PromptTokens: 1000000, CachedPromptTokens: 400000, CompletionTokens: 100000}, 342},
+		// 400k uncached input at $3, 400k cached at $0.30, 200k written at $3.75, 100k output at $15
+		{"priced-model", UsageMetrics{PromptTokens: 1000000, CachedPromptTokens: 400000, CacheWritePromptTokens: 200000, CompletionTokens: 100000}, 357},
+		// Cached and cache-write tokens are priced as input without their own rates
+		{"uncached-model", UsageMetrics{PromptTokens: 1000000, CachedPromptTokens: 500000, CacheWritePromptTokens: 100000, CompletionTokens: 1000000}, 800},
+		// Models without per-direction prices use CostPerToken
+		{"test-model-1", UsageMetrics{PromptTokens: 60, CompletionTokens: 40, TotalTokens: 100}, 0.01},
+	}
+	for _, tt := range tests {
+		got, err := EstimateCost(tt.model, tt.usage)
+		if err != nil {
+			t.Fatalf("EstimateCost(%s) error = %v", tt.model, err)
+		}
+		if math.Abs(got-tt.want) > 1e-9 {
+			t.Errorf("EstimateCost(%s) = %v cents, want %v", tt.model, got, tt.want)
+		}
+	}
+
+	if _, err := EstimateCost("unknown-model", UsageMetrics{}); err == nil {
+		t.Error("EstimateCost() expected an error for an unknown model")
+	}
+}
+
+func TestEstimateTierCost(t *testing.T) {
+	setupTestRegistry()
+	NewModelInfo(ModelInfo{ID: "tiered-model", InputCostPerMTok: 2, OutputCostPerMTok: 8}, "tiered-model")
+	NewModelInfo(ModelInfo{
+		ID:                     "custom-tier-model",
+		InputCostPerMTok:       2,
+		OutputCostPerMTok:      8,
+		ServiceTierMultipliers: map[string]float64{ServiceTierPriority: 2},
+	}, "custom-tier-model")
+
+	// 1M input at $2 and 1M output at $8
+	usage := UsageMetrics{PromptTokens: 1000000, CompletionTokens: 1000000}
+	tests := []struct {
+		model, tier string
+		want        float64
+	}{
+		{"tiered-model", ServiceTierDefault, 1000},
+		{"tiered-model", ServiceTierFlex, 500},
+		{"tiered-model", ServiceTierPriority, 1750},
+		{"tiered-model", "unknown", 1000},
+		{"custom-tier-model", ServiceTierPriority, 2000},
+		{"custom-tier-model", ServiceTierFlex, 500},
+	}
+	for _, tt := range tests {
+		got, err := EstimateTierCost(tt.model, usage, tt.tier)
+		if err != nil || math.Abs(got-tt.want) > 1e-9 {
+			t.Errorf("EstimateTierCost(%s, %s) = %v, %v, want %v", tt.model, tt.tier, got, err, tt.want)
+		}
+	}
+}
+
+func TestRegisterCatalog(t *testing.T) {
+	setupTestRegistry()
+
+	valid := CatalogEntry{
+		ModelInfo: ModelInfo{ID: "catalog-model", Provider: ProviderMistral, Profiles: []string{ProfileChat}, MaxTokens: 32000},
+		Patterns:  []string{"^catalog-model$"},
+	}
+	invalid := CatalogEntry{
+		ModelInfo: ModelInfo{ID: "catalog-model", Profiles: []string{"telepathy"}, InputCostPerMTok: -1, ContextWindow: 4096, MaxOutputTokens: 8192},
+		Patterns:  []string{"catalog-(", "^catalog-model$"},
+	}
+
+	results := Catalog{Models: []CatalogEntry{valid, invalid}}.Validate()
+	if results[0] != nil {
+		t.Errorf("Expected the first entry to be valid, got %v", results[0])
+	}
+	for _, want := range []string{"provider is required", "invalid pattern", "prices must not be negative", "unknown profile", "already used by entry 0", "maxOutputTokens must not exceed"} {
+		if results[1] == nil || !strings.Contains(results[1].Error(), want) {
+			t.Errorf("Expected %q in %v", want, results[1])
+		}
+	}
+
+	// Nothing is registered when any entry is invalid
+	if err := RegisterCatalog(Catalog{Models: []CatalogEntry{valid, invalid}}); err == nil {
+		t.Fatal("RegisterCatalog() expected an error")
+	}
+	if _, err := Resolve("catalog-model"); err == nil {
+		t.Error("Expected no registration from a rejected catalog")
+	}
+
+	if err := RegisterCatalog(Catalog{Models: []CatalogEntry{valid}}); err != nil {
+		t.Fatalf("RegisterCatalog() error = %v", err)
+	}
+	if info, err := Resolve("catalog-model"); err != nil || info.MaxTokens != 32000 || info.ContextWindow != 32000 {
+		t.Errorf("Resolve() = %+v, %v", info, err)
+	}
+}
+
+func TestLoadFromFile(t *testing.T) {
+	setupTestRegistry()
+	dir := t.TempDir()
+
+	yamlPath := filepath.Join(dir, "catalog.yaml")
+	yamlCatalog := `models:
+  - id: file-small
+    provider: mistral
+    patterns: ["^file-small.*"]
+    profiles: [chat, agent]
+    maxTokens: 32768
+    inputCostPerMTok: 0.2
+    outputCostPerMTok: 0.6
+    costTier: basic
+    deprecatedAt: 2027-01-31T00:00:00Z
+`
+	if err := os.WriteFile(yamlPath, []byte(yamlCatalog), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := LoadFromFile(yamlPath); err != nil {
+		t.Fatalf("LoadFromFile() error = %v", err)
+	}
+	info, err := Resolve("file-small-2501")
+	if err != nil || info.ContextWindow != 32768 || info.InputCostPerMTok != 0.2 || info.CostTier != CostTierBasic || !reflect.DeepEqual(info.Profiles, []string{ProfileChat, ProfileAgent}) {
+		t.Errorf("Expected the YAML entry to be registered, got %+v, %v", info, err)
+	}
+	if info.DeprecatedAt == nil || info.DeprecatedAt.Year() != 2027 {
+		t.Errorf("Expected the deprecation date, got %v", info.DeprecatedAt)
+	}
+
+	jsonPath := filepath.Join(dir, "catalog.json")
+	if err := os.WriteFile(jsonPath, []byte(`{"models": [{"id": "file-large", "provider": "openai", "patterns": ["^file-large$"], "contextWindow": 128000, "maxOutputTokens": 16384}]}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := LoadFromFile(jsonPath); err != nil {
+		t.Fatalf("LoadFromFile() error = %v", err)
+	}
+	if info, err := Resolve("file-large"); err != nil || info.ContextWindow != 128000 || info.MaxOutputTokens != 16384 || info.MaxTokens != 128000 {
+		t.Errorf("Expected the JSON entry to be registered, got %+v, %v", info, err)
+	}
+
+	// Misspelled fields and invalid entries reject the whole catalog
+	if err := LoadFromReader(strings.NewReader("models:\n  - id: file-typo\n    provider: openai\n    patterns: [\"^file-typo$\"]\n    maxTokenz: 10\n"), CatalogYAML); err == nil || !strings.Contains(err.Error(), "maxTokenz") {
+		t.Errorf("Expected the unknown field to be reported, got %v", err)
+	}
+	err = LoadFromReader(strings.NewReader(`{"models": [{"id": "file-ok", "provider": "openai", "patterns": ["^file-ok$"]}, {"id": "file-bad", "patterns": ["^file-bad$"]}]}`), CatalogJSON)
+	if err == nil || !strings.Contains(err.Error(), "provider is required") {
+		t.Errorf("Expected the invalid entry to be reported, got %v", err)
+	}
+	if _, err := Resolve("file-ok"); err == nil {
+		t.Error("Expected no registration from a rejected catalog")
+	}
+	if err := LoadFromFile(filepath.Join(dir, "missing.yaml")); err == nil {
+		t.Error("Expected an error for a missing file")
+	}
+}
+
+func TestRegisterModelAndUnregister(t *testing.T) {
+	setupTestRegistry()
+
+	entry := CatalogEntry{
+		ModelInfo: ModelInfo{ID: "rollout-model", Provider: ProviderMistral, MaxTokens: 32000},
+		Patterns:  []string{"^rollout-model$", "^rollout-model-.*"},
+	}
+	if err := RegisterModel(entry); err != nil {
+		t.Fatalf("RegisterModel() error = %v", err)
+	}
+	if _, err := Resolve("rollout-model-2025"); err != nil {
+		t.Errorf("Expected the second pattern to match, got %v", err)
+	}
+
+	// Registering the model again replaces its patterns
+	entry.Patterns, entry.MaxTokens = []string{"^rollout-model$"}, 64000
+	if err := RegisterModel(entry); err != nil {
+		t.Fatalf("RegisterModel() error = %v", err)
+	}
+	if _, err := Resolve("rollout-model-2025"); err == nil {
+		t.Error("Expected the dropped pattern not to match")
+	}
+	if info, err := Resolve("rollout-model"); err != nil || info.MaxTokens != 64000 {
+		t.Errorf("Resolve() = %+v, %v", info, err)
+	}
+	if err := RegisterModel(CatalogEntry{ModelInfo: ModelInfo{ID: "rollout-model"}}); err == nil {
+		t.Error("Expected an invalid entry to be rejected")
+	}
+
+	var listed *CatalogEntry
+	catalog := ListCatalog()
+	for i := range catalog.Models {
+		if catalog.Models[i].ID == "rollout-model" {
+			listed = &catalog.Models[i]
+		}
+	}
+	if listed == nil || !reflect.DeepEqual(listed.Patterns, []string{"^rollout-model$"}) {
+		t.Errorf("Expected the model in the catalog with its pattern, got %+v", listed)
+	}
+
+	if !Unregister("^rollout-model$") || Unregister("^rollout-model$") {
+		t.Error("Expected Unregister to report whether the pattern was registered")
+	}
+	if _, err := Resolve("rollout-model"); err == nil {
+		t.Error("Expected an unregistered model not to resolve")
+	}
+	if !UnregisterModel("test-model-1") || UnregisterModel("test-model-1") {
+		t.Error("Expected UnregisterModel to report whether the model was registered")
+	}
+	if _, err := Resolve("test-model-1"); err == nil {
+		t.Error("Expected every pattern of an unregistered model to be removed")
+	}
+}
+
+func TestSnapshotAndImport(t *testing.T) {
+	r := NewRegistry()
+	r.Init()
+	if err := r.RegisterAlias("fast", "gpt-4o-mini"); err != nil {
+		t.Fatal(err)
+	}
+	deprecated := time.Date(2026, 6, 1, 0, 0, 0, 0, time.UTC)
+	if err := r.Register("^legacy-.*", ModelInfo{ID: "legacy", MaxTokens: 8192, DeprecatedAt: &deprecated}); err != nil {
+		t.Fatal(err)
+	}
+
+	// The snapshot survives its JSON form and reproduces the registry
+	data, err := json.Marshal(r.Snapshot())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var snapshot []ModelEntry
+	if err := json.Unmarshal(data, &snapshot); err != nil {
+		t.Fatal(err)
+	}
+	copied := NewRegistry()
+	if err := copied.Import(snapshot); err != nil {
+		t.Fatalf("Import() error = %v", err)
+	}
+	if !reflect.DeepEqual(copied.ListModels(), r.ListModels()) {
+		t.Errorf("Expected the same patterns in the same order, got %v", copied.ListModels())
+	}
+	if diff := DiffSnapshots(r.Snapshot(), copied.Snapshot()); !diff.Empty() {
+		t.Errorf("Expected no difference, got %+v", diff)
+	}
+	if again, _ := json.Marshal(copied.Snapshot()); string(again) != string(data) {
+		t.Error("Expected the JSON form to be stable")
+	}
+
+	// Import replaces the registrations and keeps the aliases
+	if err := r.Import(snapshot[:1]); err != nil {
+		t.Fatal(err)
+	}
+	if models := r.ListModels(); len(models) != 1 || models[0] != snapshot[0].Pattern {
+		t.Errorf("Expected only the imported pattern, got %v", models)
+	}
+	if alias, ok := r.ResolveAlias("fast"); !ok || alias != "gpt-4o-mini" {
+		t.Errorf("Expected the alias to be kept, got %q", alias)
+	}
+	if err := r.Import([]ModelEntry{{Pattern: "^a$"}, {Pattern: "(unclosed"}}); err == nil {
+		t.Error("Expected an invalid pattern to be rejected")
+	}
+	if err := r.Import([]ModelEntry{{Pattern: "^a$"}, {Pattern: "^a$"}}); err == nil {
+		t.Error("Expected a duplicate pattern to be rejected")
+	}
+	if models := r.ListModels(); len(models) != 1 {
+		t.Errorf("Expected a failed import to change nothing, got %v", models)
+	}
+
+	before := []ModelEntry{
+		{Pattern: "^a$", Info: ModelInfo{ID: "a", MaxTokens: 1000}},
+		{Pattern: "^b$", Info: ModelInfo{ID: "b", MaxTokens: 1000}},
+	}
+	after := []ModelEntry{
+		{Pattern: "^c$", Info: ModelInfo{ID: "c"}},
+		{Pattern: "^b$", Info: ModelInfo{ID: "b", MaxTokens: 2000}},
+	}
+	diff := DiffSnapshots(before, after)
+	if len(diff.Added) != 1 || diff.Added[0].Pattern != "^c$" ||
+		len(diff.Removed) != 1 || diff.Removed[0].Pattern != "^a$" ||
+		len(diff.Changed) != 1 || diff.Changed[0].Before.MaxTokens != 1000 || diff.Changed[0].After.MaxTokens != 2000 {
+		t.Errorf("DiffSnapshots() = %+v", diff)
+	}
+}
+
+func TestSubscribe(t *testing.T) {
+	r := NewRegistry()
+	var events []RegistryEvent
+	unsubscribe := r.Subscribe(func(event RegistryEvent) {
+		// Subscribers may read the registry
+		r.ListModels()
+		events = append(events, event)
+	})
+	expect := func(step string, want ...string) {
+		t.Helper()
+		var got []string
+		for _, event := range events {
+			got = append(got, event.Type+" "+event.Pattern)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: events %v, want %v", step, got, want)
+		}
+		events = nil
+	}
+
+	r.Register("^sub-a$", ModelInfo{ID: "sub-a", Provider: ProviderOpenAI, MaxTokens: 1000})
+	expect("register", "added ^sub-a$")
+	r.Register("^sub-a$", ModelInfo{ID: "sub-a", Provider: ProviderOpenAI, MaxTokens: 1000})
+	expect("register again")
+
+	err := r.ImportPrices(PriceSheet{Prices: []PriceSheetEntry{{Model: "sub-a", EffectiveFrom: "2026-01-01", InputCostPerMTok: 1, OutputCostPerMTok: 2}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 1 || events[0].Previous == nil || events[0].Previous.InputCostPerMTok != 0 || events[0].Model.InputCostPerMTok != 1 {
+		t.Errorf("Expected the repricing with the previous model, got %+v", events)
+	}
+	expect("reprice", "updated ^sub-a$")
+
+	r.RegisterModel(CatalogEntry{ModelInfo: ModelInfo{ID: "sub-a", Provider: ProviderOpenAI}, Patterns: []string{"^sub-b$"}})
+	expect("register model", "removed ^sub-a$", "added ^sub-b$")
+	r.Import([]ModelEntry{{Pattern: "^sub-b$", Info: r.Snapshot()[0].Info}, {Pattern: "^sub-c$"}})
+	expect("import", "added ^sub-c$")
+	r.Clear()
+	expect("clear", "removed ^sub-b$", "removed ^sub-c$")
+
+	unsubscribe()
+	r.Register("^sub-d$", ModelInfo{ID: "sub-d"})
+	expect("unsubscribed")
+}
+
+func TestImportPrices(t *testing.T) {
+	setupTestRegistry()
+	NewModelInfo(ModelInfo{ID: "priced-model", Provider: ProviderAnthropic, InputCostPerMTok: 3, OutputCostPerMTok: 15}, "^priced-model.*")
+
+	csvSheet := `model,effective_from,input_cost_per_mtok,output_cost_per_mtok,cached_input_cost_per_mtok
+priced-model,2026-01-01,2,10,0.2
+priced-model-latest,2099-01-01T00:00:00Z,1,5,
+`
+	sheet, err := ParsePriceSheet(strings.NewReader(csvSheet), PriceSheetCSV)
+	if err != nil {
+		t.Fatalf("ParsePriceSheet() error = %v", err)
+	}
+	if len(sheet.Prices) != 2 || sheet.Prices[0].CachedInputCostPerMTok != 0.2 || sheet.Prices[1].Model != "priced-model-latest" {
+		t.Fatalf("Unexpected sheet %+v", sheet)
+	}
+
+	// Nothing is imported when any entry is invalid
+	bad := PriceSheet{Prices: append(sheet.Prices, PriceSheetEntry{Model: "unknown-model", EffectiveFrom: "2026-02-01", InputCostPerMTok: 1, OutputCostPerMTok: 1})}
+	if err := ImportPrices(bad); err == nil || !strings.Contains(err.Error(), "not registered") {
+		t.Fatalf("ImportPrices() error = %v, want unregistered model", err)
+	}
+	if info, _ := Resolve("priced-model"); len(info.PriceHistory) != 0 {
+		t.Fatalf("Expected no history after a rejected import, got %+v", info.PriceHistory)
+	}
+
+	if err := ImportPrices(sheet); err != nil {
+		t.Fatalf("ImportPrices() error = %v", err)
+	}
+	info, _ := Resolve("priced-model")
+	if len(info.PriceHistory) != 3 || info.InputCostPerMTok != 2 || info.OutputCostPerMTok != 10 {
+		t.Errorf("Expected the 2026 price to be current with three prices in history, got %+v", info)
+	}
+	if until := info.PriceHistory[1].EffectiveUntil; !until.Equal(info.PriceHistory[2].EffectiveFrom) || !info.PriceHistory[2].EffectiveUntil.IsZero() {
+		t.Errorf("Expected contiguous effective ranges, got %+v", info.PriceHistory)
+	}
+
+	// 1M input and 1M output tokens at the prices of each period
+	usage := UsageMetrics{PromptTokens: 1000000, CompletionTokens: 1000000}
+	for _, tt := range []struct {
+		at   time.Time
+		want float64
+	}{
+		{time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC), 1800},
+		{time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC), 1200},
+		{time.Date(2099, 6, 1, 0, 0, 0, 0, time.UTC), 600},
+	} {
+		if got, _ := EstimateCostAt("priced-model", usage, tt.at); math.Abs(got-tt.want) > 1e-9 {
+			t.Errorf("EstimateCostAt(%v) = %v cents, want %v", tt.at, got, tt.want)
+		}
+	}
+
+	// A price with the same effective date replaces the earlier one
+	err = ImportPrices(PriceSheet{Prices: []PriceSheetEntry{{Model: "priced-model", EffectiveFrom: "2026-01-01", InputCostPerMTok: 2.5, OutputCostPerMTok: 10}}})
+	if err != nil {
+		t.Fatalf("ImportPrices() error = %v", err)
+	}
+	if info, _ := Resolve("priced-model"); len(info.PriceHistory) != 3 || info.InputCostPerMTok != 2.5 {
+		t.Errorf("Expected the corrected price to replace the old one, got %+v", info)
+	}
+}
+
+func TestParsePriceSheetErrors(t *testing.T) {
+	if _, err := ParsePriceSheet(strings.NewReader("model,price\n"), PriceSheetCSV); err == nil {
+		t.Error("Expected an error for an unknown column")
+	}
+	if _, err := ParsePriceSheet(strings.NewReader("model,input_cost_per_mtok\nx,cheap\n"), PriceSheetCSV); err == nil || !strings.Contains(err.Error(), "line 2") {
+		t.Errorf("Expected an error naming the line, got %v", err)
+	}
+	sheet, err := ParsePriceSheet(strings.NewReader(`{"prices":[{"model":"x","effectiveFrom":"soon","inputCostPerMTok":1}]}`), PriceSheetJSON)
+	if err != nil {
+		t.Fatalf("ParsePriceSheet() error = %v", err)
+	}
+	err = ImportPrices(sheet)
+	for _, want := range []string{"is not a date", "are required"} {
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("Expected %q in %v", want, err)
+		}
+	}
+}
+
 func TestListModelsByProfile(t *testing.T) {
 	setupTestRegistry()
 
@@ -284,4 +828,32 @@ func TestInit(t *testing.T) {
 			t.Errorf("Init() should register models containing %q", model)
 		}
 	}
+
+	// Output limits are registered apart from the context window
+	info, err := Resolve("gpt-4-turbo-2024-04-09")
+	if err != nil || info.ContextWindow != 128000 || info.MaxOutputTokens != 4096 {
+		t.Errorf("Expected the window and output limit, got %+v, %v", info, err)
+	}
+}
+
+// BenchmarkResolve resolves names missing from the cache against hundreds of patterns.
+func BenchmarkResolve(b *testing.B) {
+	r := NewRegistry()
+	for i := 0; i < 500; i++ {
+		id := fmt.Sprintf("bench-%03d", i)
+		if err := r.Register("^"+id+"(-.*)?$", ModelInfo{ID: id, Provider: ProviderOpenAI}); err != nil {
+			b.Fatal(err)
+		}
+	}
+	names := make([]string, b.N)
+	for i := range names {
+		names[i] = fmt.Sprintf("bench-%03d-%d", i%500, i)
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for _, name := range names {
+		if _, err := r.Resolve(name); err != nil {
+			b.Fatal(err)
+		}
+	}
 }
@@ -0,0 +1,152 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+)
+
+// RequestBuilder builds an LLMRequest fluently:
+//
+//	request, err := models.NewRequest("gpt-4o").
+//		System("You are terse.").
+//		User("What is the capital of France?").
+//		Temperature(0.2).
+//		Build()
+//
+// Errors, such as a tool whose declaration fails, are collected and returned by Build.
+type RequestBuilder struct {
+	request LLMRequest
+	errs    []error
+}
+
+// NewRequest starts a request for model.
+func NewRequest(model string) *RequestBuilder {
+	return &RequestBuilder{request: LLMRequest{Model: model}}
+}
+
+func (b *RequestBuilder) config() *GenerateContentConfig {
+	if b.request.Config == nil {
+		b.request.Config = &GenerateContentConfig{}
+	}
+	return b.request.Config
+}
+
+// System appends instructions to the system instruction.
+func (b *RequestBuilder) System(instructions ...string) *RequestBuilder {
+	b.request.AppendInstructions(instructions...)
+	return b
+}
+
+// User appends a user message.
+func (b *RequestBuilder) User(message string) *RequestBuilder {
+	return b.Content(Content{Role: "user", Message: message})
+}
+
+// Assistant appends an assistant message, e.g. an earlier turn of the conversation.
+func (b *RequestBuilder) Assistant(message string) *RequestBuilder {
+	return b.Content(Content{Role: "assistant", Message: message})
+}
+
+// Content appends contents as they are.
+func (b *RequestBuilder) Content(contents ...Content) *RequestBuilder {
+	b.request.Contents = append(b.request.Contents, contents...)
+	return b
+}
+
+// Temperature sets the sampling temperature, between 0 and 2.
+func (b *RequestBuilder) Temperature(temperature float64) *RequestBuilder {
+	b.config().Temperature = temperature
+	return b
+}
+
+// TopP sets nucleus sampling, between 0 and 1.
+func (b *RequestBuilder) TopP(topP float64) *RequestBuilder {
+	b.config().TopP = topP
+	return b
+}
+
+// MaxTokens sets the maximum number of completion tokens.
+func (b *RequestBuilder) MaxTokens(maxTokens int) *RequestBuilder {
+	b.config().MaxTokens = maxTokens
+	return b
+}
+
+// Stop appends stop sequences.
+func (b *RequestBuilder) Stop(sequences ...string) *RequestBuilder {
+	b.config().StopSequences = append(b.config().StopSequences, sequences...)
+	return b
+}
+
+// Tool attaches tools to the request.
+func (b *RequestBuilder) Tool(tools ...BaseTool) *RequestBuilder {
+	if err := b.request.AppendTools(tools...); err != nil {
+		b.errs = append(b.errs, err)
+	}
+	return b
+}
+
+// ToolChoice sets the tool choice: a ToolChoice constant or the name of a function.
+func (b *RequestBuilder) ToolChoice(choice string) *RequestBuilder {
+	b.config().ToolChoice = choice
+	return b
+}
+
+// OutputSchema requests JSON output matching schema (see SetOutputSchema).
+func (b *RequestBuilder) OutputSchema(schema any) *RequestBuilder {
+	b.request.SetOutputSchema(schema)
+	return b
+}
+
+// Logprobs requests token log probabilities with up to top alternatives per token.
+func (b *RequestBuilder) Logprobs(top int) *RequestBuilder {
+	b.config().ResponseLogprobs = true
+	b.config().TopLogprobs = top
+	return b
+}
+
+// Build validates and returns the request. The builder can be reused afterwards; later
+// changes do not affect requests already built.
+func (b *RequestBuilder) Build() (*LLMRequest, error) {
+	errs := append([]error(nil), b.errs...)
+	if config := b.request.Config; config != nil {
+		if config.Temperature < 0 || config.Temperature > 2 {
+			errs = append(errs, fmt.Errorf("temperature %v is not between 0 and 2", config.Temperature))
+		}
+		if config.TopP < 0 || config.TopP > 1 {
+			errs = append(errs, fmt.Errorf("top_p %v is not between 0 and 1", config.TopP))
+		}
+		if config.MaxTokens < 0 {
+			errs = append(errs, fmt.Errorf("max tokens must not be negative"))
+		}
+		if config.TopLogprobs < 0 {
+			errs = append(errs, fmt.Errorf("top logprobs must not be negative"))
+		}
+	}
+	if err := b.request.Validate(); err != nil {
+		errs = append(errs, err)
+	}
+	if len(errs) > 0 {
+		return nil, fmt.Errorf("invalid request: %w", errors.Join(errs...))
+	}
+	return b.copy(), nil
+}
+
+// copy returns a copy of the request under construction that shares no slices or maps
+// with the builder.
+func (b *RequestBuilder) copy() *LLMRequest {
+	request := b.request
+	request.Contents = append([]Content(nil), b.request.Contents...)
+	if b.request.Config != nil {
+		config := *b.request.Config
+		config.Tools = append([]ToolDeclaration(nil), config.Tools...)
+		config.StopSequences = append([]string(nil), config.StopSequences...)
+		request.Config = &config
+	}
+	if b.request.ToolsDict != nil {
+		request.ToolsDict = make(map[string]BaseTool, len(b.request.ToolsDict))
+		for name, tool := range b.request.ToolsDict {
+			request.ToolsDict[name] = tool
+		}
+	}
+	return &request
+}
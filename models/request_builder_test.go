@@ -0,0 +1,63 @@
+package models
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestRequestBuilder(t *testing.T) {
+	tool := mockTool{name: "get_weather", decl: `{"name":"get_weather"}`}
+	builder := NewRequest("gpt-4o").
+		System("You are terse.").
+		User("What is the weather in Paris?").
+		Temperature(0.2).
+		MaxTokens(256).
+		Stop("END").
+		Tool(tool).
+		ToolChoice("get_weather")
+
+	request, err := builder.Build()
+	if err != nil {
+		t.Fatalf("Build() error = %v", err)
+	}
+	if request.Model != "gpt-4o" || len(request.Contents) != 1 || request.Contents[0].Role != "user" {
+		t.Errorf("Unexpected request %+v", request)
+	}
+	config := request.Config
+	if config.SystemInstruction != "You are terse." || config.Temperature != 0.2 || config.MaxTokens != 256 ||
+		len(config.StopSequences) != 1 || len(config.Tools) != 1 || request.ToolsDict["get_weather"] == nil {
+		t.Errorf("Unexpected config %+v", config)
+	}
+
+	// Later changes to the builder do not leak into built requests
+	builder.Assistant("Sunny.").Stop("STOP")
+	if len(request.Contents) != 1 || len(request.Config.StopSequences) != 1 {
+		t.Errorf("Built request changed with the builder: %+v", request)
+	}
+}
+
+func TestRequestBuilderValidation(t *testing.T) {
+	declErr := errors.New("no schema")
+	_, err := NewRequest("gpt-4o").
+		User("Hi").
+		Temperature(3).
+		TopP(-1).
+		Tool(mockTool{name: "broken", err: declErr}).
+		Build()
+	if err == nil {
+		t.Fatal("Build() expected an error")
+	}
+	if !errors.Is(err, declErr) {
+		t.Errorf("Expected the tool error to be wrapped, got %v", err)
+	}
+	for _, want := range []string{"temperature", "top_p"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("Expected error to mention %s, got %v", want, err)
+		}
+	}
+
+	if _, err := NewRequest("gpt-4o").Build(); err == nil {
+		t.Error("Build() expected an error without contents")
+	}
+}
@@ -1,6 +1,8 @@
 package models
 
 import (
+	"errors"
+	"reflect"
 	"testing"
 )
 
@@ -52,6 +54,59 @@ func TestLLMRequestValidation(t *testing.T) {
 			},
 			wantErr: false,
 		},
+		{
+			name: "required tool choice without tools",
+			request: LLMRequest{
+				Model:    "gpt-4",
+				Contents: []Content{{Role: "user", Message: "Hello"}},
+				Config:   &GenerateContentConfig{ToolChoice: ToolChoiceRequired},
+			},
+			wantErr: true,
+		},
+		{
+			name: "specific tool choice matching attached tool",
+			request: LLMRequest{
+				Model:    "gpt-4",
+				Contents: []Content{{Role: "user", Message: "Hello"}},
+				Config: &GenerateContentConfig{
+					Tools:      []ToolDeclaration{{FunctionDeclarations: []string{`{"name":"search"}`}}},
+					ToolChoice: "search",
+				},
+				ToolsDict: map[string]BaseTool{"search": mockTool{name: "search"}},
+			},
+			wantErr: false,
+		},
+		{
+			name: "specific tool choice not attached",
+			request: LLMRequest{
+				Model:    "gpt-4",
+				Contents: []Content{{Role: "user", Message: "Hello"}},
+				Config: &GenerateContentConfig{
+					Tools:      []ToolDeclaration{{FunctionDeclarations: []string{`{"name":"search"}`}}},
+					ToolChoice: "book",
+				},
+				ToolsDict: map[string]BaseTool{"search": mockTool{name: "search"}},
+			},
+			wantErr: true,
+		},
+		{
+			name: "batch priority",
+			request: LLMRequest{
+				Model:    "gpt-4",
+				Contents: []Content{{Role: "user", Message: "Hello"}},
+				Metadata: RequestMetadata{Priority: PriorityBatch},
+			},
+			wantErr: false,
+		},
+		{
+			name: "unknown priority",
+			request: LLMRequest{
+				Model:    "gpt-4",
+				Contents: []Content{{Role: "user", Message: "Hello"}},
+				Metadata: RequestMetadata{Priority: "urgent"},
+			},
+			wantErr: true,
+		},
 	}
 
 	for _, tt := range tests {
@@ -173,3 +228,67 @@ func TestSetOutputSchema(t *testing.T) {
 		t.Error("ResponseSchema is nil")
 	}
 }
+
+func TestContentFunctionCalls(t *testing.T) {
+	content := &Content{
+		Role: "assistant",
+		Parts: []any{
+			"Let me check.",
+			NewFunctionCallPart(FunctionCall{ID: "call_1", Name: "get_weather", Args: map[string]any{"city": "Paris"}}),
+			NewFunctionResponsePart(FunctionResponse{ID: "call_0", Name: "noop", Response: "ignored"}),
+		},
+	}
+
+	calls := content.FunctionCalls()
+	if len(calls) != 1 {
+		t.Fatalf("Expected 1 function call, got %d", len(calls))
+	}
+	if calls[0].ID != "call_1" || calls[0].Name != "get_weather" || calls[0].Args["city"] != "Paris" {
+		t.Errorf("Unexpected function call: %+v", calls[0])
+	}
+
+	var empty *Content
+	if empty.FunctionCalls() != nil {
+		t.Error("Expected nil calls for nil content")
+	}
+}
+
+func TestCheckCapabilities(t *testing.T) {
+	request := &LLMRequest{
+		Model: "vision-model",
+		Contents: []Content{
+			{Role: "user", Parts: []any{"What is this?", map[string]any{PartImage: map[string]any{"url": "https://example.com/cat.png"}}}},
+			{Role: "assistant", Parts: []any{
+				NewFunctionCallPart(FunctionCall{ID: "call_1", Name: "lookup"}),
+				NewFunctionCallPart(FunctionCall{ID: "call_2", Name: "lookup"}),
+			}},
+		},
+		Config: &GenerateContentConfig{Tools: []ToolDeclaration{{FunctionDeclarations: []string{`{"name": "lookup"}`}}}, JSONMode: true},
+	}
+	want := Capabilities{Vision: true, Tools: true, JSONMode: true, ParallelTools: true}
+	if got := request.RequiredCapabilities(); got != want {
+		t.Errorf("RequiredCapabilities() = %+v, want %+v", got, want)
+	}
+
+	textOnly := ModelInfo{ID: "text-model", Capabilities: &Capabilities{Tools: true, JSONMode: true, Streaming: true}}
+	err := textOnly.CheckCapabilities(request)
+	var unsupported *UnsupportedCapabilityError
+	if !errors.As(err, &unsupported) || !errors.Is(err, ErrCapabilityUnsupported) {
+		t.Fatalf("CheckCapabilities() error = %v, want an *UnsupportedCapabilityError", err)
+	}
+	if !reflect.DeepEqual(unsupported.Missing, []string{CapabilityVision, CapabilityParallelTools}) {
+		t.Errorf("Missing = %v", unsupported.Missing)
+	}
+	if err.Error() != "model text-model does not support vision, parallel_tools" {
+		t.Errorf("Unexpected message %q", err.Error())
+	}
+
+	// Models without registered capabilities are not checked
+	if err := (ModelInfo{ID: "unknown-model"}).CheckCapabilities(request); err != nil {
+		t.Errorf("Expected no check without capabilities, got %v", err)
+	}
+	full := ModelInfo{ID: "full-model", Capabilities: &Capabilities{Vision: true, Tools: true, JSONMode: true, ParallelTools: true}}
+	if err := full.CheckCapabilities(request); err != nil {
+		t.Errorf("CheckCapabilities() error = %v", err)
+	}
+}
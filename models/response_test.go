@@ -194,3 +194,58 @@ func TestLLMResponseErrorInterface(t *testing.T) {
 func strPtr(s string) *string {
 	return &s
 }
+
+func TestCreateLLMResponseCarriesLogprobs(t *testing.T) {
+	logprobs := &Logprobs{Tokens: []TokenLogprob{
+		{Token: "Hi", Logprob: -0.1, TopAlternatives: []TopLogprob{{Token: "Hello", Logprob: -2.3}}},
+	}}
+	result := CreateLLMResponse(&GenerateContentResponse{
+		Candidates: []Candidate{{
+			Content:  &Content{Role: "assistant", Message: "Hi"},
+			Logprobs: logprobs,
+		}},
+	})
+
+	if result.Logprobs != logprobs {
+		t.Fatalf("Expected logprobs to be carried over, got %+v", result.Logprobs)
+	}
+}
+
+func TestLLMResponseConfidence(t *testing.T) {
+	var resp LLMResponse
+	if _, ok := resp.Confidence(); ok {
+		t.Fatal("Expected no confidence on empty response")
+	}
+	resp.SetConfidence(0.8)
+	if score, ok := resp.Confidence(); !ok || score != 0.8 {
+		t.Errorf("Expected confidence 0.8, got %v", score)
+	}
+}
+
+func TestLLMResponseRequestMetadata(t *testing.T) {
+	var resp LLMResponse
+	resp.SetRequestMetadata(RequestMetadata{})
+	if resp.CustomMetadata != nil {
+		t.Errorf("Expected no metadata map for zero metadata, got %v", resp.CustomMetadata)
+	}
+
+	meta := RequestMetadata{TenantID: "acme", UserID: "u-1", Tags: map[string]string{"feature": "search"}}
+	resp.SetRequestMetadata(meta)
+	if got, ok := resp.RequestMetadata(); !ok || got.TenantID != "acme" || got.Tags["feature"] != "search" {
+		t.Errorf("RequestMetadata() = %+v, %v", got, ok)
+	}
+
+	resp.SetRequestMetadata(RequestMetadata{})
+	if _, ok := resp.RequestMetadata(); ok {
+		t.Error("Expected zero metadata to remove the recorded metadata")
+	}
+}
+
+func TestUsageMetricsAdd(t *testing.T) {
+	a := UsageMetrics{PromptTokens: 100, CompletionTokens: 20, CachedPromptTokens: 60, CacheWritePromptTokens: 30, TotalTokens: 120, LatencyMs: 250, CostCents: 0.5}
+	b := UsageMetrics{PromptTokens: 50, CompletionTokens: 10, CachedPromptTokens: 40, CacheWritePromptTokens: 5, TotalTokens: 60, LatencyMs: 100, CostCents: 0.25}
+	want := UsageMetrics{PromptTokens: 150, CompletionTokens: 30, CachedPromptTokens: 100, CacheWritePromptTokens: 35, TotalTokens: 180, LatencyMs: 350, CostCents: 0.75}
+	if got := a.Add(b); got != want {
+		t.Errorf("Add() = %+v, want %+v", got, want)
+	}
+}
@@ -0,0 +1,151 @@
+package models
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"slices"
+	"sort"
+)
+
+// SchemaOf returns the JSON schema described by v. It accepts a *JSONSchema or JSONSchema,
+// a map holding a raw JSON schema, or any Go value whose type is converted with SchemaForType.
+func SchemaOf(v any) (*JSONSchema, error) {
+	switch s := v.(type) {
+	case nil:
+		return nil, fmt.Errorf("schema is nil")
+	case *JSONSchema:
+		return s, nil
+	case JSONSchema:
+		return &s, nil
+	case map[string]any, json.RawMessage:
+		encoded, err := json.Marshal(s)
+		if err != nil {
+			return nil, fmt.Errorf("encoding schema: %w", err)
+		}
+		var schema JSONSchema
+		if err := json.Unmarshal(encoded, &schema); err != nil {
+			return nil, fmt.Errorf("decoding schema: %w", err)
+		}
+		return &schema, nil
+	default:
+		return SchemaForType(reflect.TypeOf(v)), nil
+	}
+}
+
+// OutputSchema returns the JSON schema set by SetOutputSchema, or nil if none is set.
+func (c *GenerateContentConfig) OutputSchema() (*JSONSchema, error) {
+	if c == nil || c.ResponseSchema == nil {
+		return nil, nil
+	}
+	return SchemaOf(c.ResponseSchema)
+}
+
+// ValidateJSON decodes data and checks it against the schema.
+func (s *JSONSchema) ValidateJSON(data []byte) error {
+	var value any
+	if err := json.Unmarshal(data, &value); err != nil {
+		return fmt.Errorf("invalid JSON: %w", err)
+	}
+	return s.Validate(value)
+}
+
+// Validate checks a decoded JSON value (as produced by encoding/json into an any)
+// against the schema. Only the keywords JSONSchema models are enforced.
+func (s *JSONSchema) Validate(value any) error {
+	return s.validate("$", value)
+}
+
+func (s *JSONSchema) validate(path string, value any) error {
+	if s == nil {
+		return nil
+	}
+
+	switch s.Type {
+	case "":
+		// Any value is allowed
+	case "object":
+		obj, ok := value.(map[string]any)
+		if !ok {
+			return schemaTypeError(path, s.Type, value)
+		}
+		for _, name := range s.Required {
+			if _, ok := obj[name]; !ok {
+				return fmt.Errorf("%s: missing required property %q", path, name)
+			}
+		}
+		keys := make([]string, 0, len(obj))
+		for key := range obj {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			prop, ok := s.Properties[key]
+			if !ok {
+				prop = s.AdditionalProperties
+			}
+			if err := prop.validate(path+"."+key, obj[key]); err != nil {
+				return err
+			}
+		}
+	case "array":
+		items, ok := value.([]any)
+		if !ok {
+			return schemaTypeError(path, s.Type, value)
+		}
+		for i, item := range items {
+			if err := s.Items.validate(fmt.Sprintf("%s[%d]", path, i), item); err != nil {
+				return err
+			}
+		}
+	case "string":
+		if _, ok := value.(string); !ok {
+			return schemaTypeError(path, s.Type, value)
+		}
+	case "number":
+		if _, ok := value.(float64); !ok {
+			return schemaTypeError(path, s.Type, value)
+		}
+	case "integer":
+		n, ok := value.(float64)
+		if !ok || n != math.Trunc(n) {
+			return schemaTypeError(path, s.Type, value)
+		}
+	case "boolean":
+		if _, ok := value.(bool); !ok {
+			return schemaTypeError(path, s.Type, value)
+		}
+	case "null":
+		if value != nil {
+			return schemaTypeError(path, s.Type, value)
+		}
+	default:
+		return fmt.Errorf("%s: unsupported schema type %q", path, s.Type)
+	}
+
+	if len(s.Enum) > 0 {
+		str, _ := value.(string)
+		if !slices.Contains(s.Enum, str) {
+			return fmt.Errorf("%s: value %v is not one of %v", path, value, s.Enum)
+		}
+	}
+	return nil
+}
+
+func schemaTypeError(path, want string, value any) error {
+	got := "null"
+	switch value.(type) {
+	case map[string]any:
+		got = "object"
+	case []any:
+		got = "array"
+	case string:
+		got = "string"
+	case float64:
+		got = "number"
+	case bool:
+		got = "boolean"
+	}
+	return fmt.Errorf("%s: expected %s, got %s", path, want, got)
+}
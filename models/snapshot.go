@@ -0,0 +1,139 @@
+package models
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+)
+
+// ModelEntry is one registration of a registry snapshot: a model-name pattern and the model
+// registered under it. Its JSON form is stable, so that snapshots can be stored, compared
+// across environments and checked in as test fixtures:
+//
+//	[
+//	  {"pattern": "^gpt-4o$", "info": {"id": "gpt-4o", "provider": "openai", ...}},
+//	  {"pattern": "gpt-4.*", "info": {"id": "gpt-4", "provider": "openai", ...}}
+//	]
+type ModelEntry struct {
+	Pattern string    `json:"pattern"`
+	Info    ModelInfo `json:"info"`
+}
+
+// Snapshot returns every registration, in the order Resolve tries them. Importing it into
+// another registry reproduces the registrations and their precedence. Aliases are not
+// included; see ListAliases.
+func (r *Registry) Snapshot() []ModelEntry {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	patterns := r.patternsByPrecedence()
+	entries := make([]ModelEntry, 0, len(patterns))
+	for _, pattern := range patterns {
+		entries = append(entries, ModelEntry{Pattern: pattern, Info: r.patterns[pattern]})
+	}
+	return entries
+}
+
+// Snapshot returns every registration of the default registry. See Registry.Snapshot.
+func Snapshot() []ModelEntry {
+	return defaultRegistry.Snapshot()
+}
+
+// Import replaces every registration with those of snapshot. Equally specific patterns take
+// precedence in the order of snapshot, as they do in the registry it was taken from. Aliases
+// are kept. Nothing changes when a pattern does not compile or appears twice.
+func (r *Registry) Import(snapshot []ModelEntry) error {
+	seen := make(map[string]bool, len(snapshot))
+	for i, entry := range snapshot {
+		if _, err := regexp.Compile(entry.Pattern); err != nil {
+			return fmt.Errorf("snapshot entry %d: invalid regex %q: %w", i, entry.Pattern, err)
+		}
+		if seen[entry.Pattern] {
+			return fmt.Errorf("snapshot entry %d: pattern %q is already used", i, entry.Pattern)
+		}
+		seen[entry.Pattern] = true
+	}
+
+	r.mu.Lock()
+	defer r.unlock()
+	// Only the patterns that change are reported to subscribers
+	for pattern := range r.patterns {
+		if !seen[pattern] {
+			r.deletePattern(pattern)
+		}
+	}
+	r.ranks = make(map[string]precedence)
+	r.ordered = nil
+	for _, entry := range snapshot {
+		r.setPattern(entry.Pattern, entry.Info)
+	}
+	r.cache = make(map[string]ModelInfo)
+	return nil
+}
+
+// Import replaces every registration of the default registry with those of snapshot. See
+// Registry.Import.
+func Import(snapshot []ModelEntry) error {
+	return defaultRegistry.Import(snapshot)
+}
+
+// SnapshotDiff lists the registrations that differ between two snapshots, each sorted by
+// pattern.
+type SnapshotDiff struct {
+	// Added are the registrations only in the newer snapshot.
+	Added []ModelEntry `json:"added,omitempty"`
+
+	// Removed are the registrations only in the older snapshot.
+	Removed []ModelEntry `json:"removed,omitempty"`
+
+	// Changed are the patterns registered in both with different models.
+	Changed []ModelChange `json:"changed,omitempty"`
+}
+
+// ModelChange is a pattern whose model differs between two snapshots.
+type ModelChange struct {
+	Pattern string    `json:"pattern"`
+	Before  ModelInfo `json:"before"`
+	After   ModelInfo `json:"after"`
+}
+
+// Empty reports whether the snapshots hold the same registrations.
+func (d SnapshotDiff) Empty() bool {
+	return len(d.Added) == 0 && len(d.Removed) == 0 && len(d.Changed) == 0
+}
+
+// DiffSnapshots compares the registrations of two snapshots, e.g. of staging and production.
+// Models are compared by their JSON form. The order of the snapshots is not compared.
+func DiffSnapshots(before, after []ModelEntry) SnapshotDiff {
+	old := make(map[string]ModelInfo, len(before))
+	for _, entry := range before {
+		old[entry.Pattern] = entry.Info
+	}
+	var diff SnapshotDiff
+	for _, entry := range after {
+		info, ok := old[entry.Pattern]
+		switch {
+		case !ok:
+			diff.Added = append(diff.Added, entry)
+		case !sameModel(info, entry.Info):
+			diff.Changed = append(diff.Changed, ModelChange{Pattern: entry.Pattern, Before: info, After: entry.Info})
+		}
+		delete(old, entry.Pattern)
+	}
+	for pattern, info := range old {
+		diff.Removed = append(diff.Removed, ModelEntry{Pattern: pattern, Info: info})
+	}
+	sort.Slice(diff.Added, func(i, j int) bool { return diff.Added[i].Pattern < diff.Added[j].Pattern })
+	sort.Slice(diff.Removed, func(i, j int) bool { return diff.Removed[i].Pattern < diff.Removed[j].Pattern })
+	sort.Slice(diff.Changed, func(i, j int) bool { return diff.Changed[i].Pattern < diff.Changed[j].Pattern })
+	return diff
+}
+
+// sameModel reports whether a and b have the same JSON form, so that models read back from a
+// stored snapshot compare equal to those they were taken from.
+func sameModel(a, b ModelInfo) bool {
+	ja, errA := json.Marshal(a)
+	jb, errB := json.Marshal(b)
+	return errA == nil && errB == nil && bytes.Equal(ja, jb)
+}
@@ -0,0 +1,111 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// maxSuggestions is the number of suggestions a ModelNotFoundError carries.
+const maxSuggestions = 3
+
+// ErrModelNotFound matches every *ModelNotFoundError with errors.Is.
+var ErrModelNotFound = errors.New("model not found")
+
+// ModelNotFoundError is returned when no registered pattern matches a model name. It carries
+// the registered names closest to the requested one, for "did you mean" messages.
+type ModelNotFoundError struct {
+	Model       string   `json:"model"`
+	Suggestions []string `json:"suggestions,omitempty"`
+}
+
+// Error implements the error interface.
+func (e *ModelNotFoundError) Error() string {
+	msg := "model not found: " + e.Model
+	if len(e.Suggestions) > 0 {
+		msg += fmt.Sprintf(" (did you mean %s?)", strings.Join(e.Suggestions, ", "))
+	}
+	return msg
+}
+
+// Is reports whether target is ErrModelNotFound.
+func (e *ModelNotFoundError) Is(target error) bool {
+	return target == ErrModelNotFound
+}
+
+// NewModelNotFoundError returns a ModelNotFoundError for model with the closest of candidates
+// as suggestions. Candidates may be model IDs or registry patterns; patterns are reduced to
+// the model name they describe, e.g. "^gpt-4-turbo.*" to "gpt-4-turbo".
+func NewModelNotFoundError(model string, candidates []string) *ModelNotFoundError {
+	return &ModelNotFoundError{Model: model, Suggestions: Suggest(model, candidates)}
+}
+
+// literalPrefix matches patterns that are a literal model name, optionally anchored and
+// followed by a wildcard suffix.
+var literalPrefix = regexp.MustCompile(`^\^?([A-Za-z0-9._-]+?)(\$|\.\*)?$`)
+
+// Suggest returns up to three of candidates closest to model by edit distance, ignoring case,
+// closest first. Candidates further than a third of the model name's length are left out.
+func Suggest(model string, candidates []string) []string {
+	type scored struct {
+		name     string
+		distance int
+	}
+	limit := max(2, len(model)/3)
+	seen := make(map[string]bool)
+	var matches []scored
+	for _, candidate := range candidates {
+		name := candidate
+		if m := literalPrefix.FindStringSubmatch(candidate); m != nil {
+			name = strings.TrimRight(m[1], "-.")
+		} else if regexp.QuoteMeta(candidate) != candidate {
+			// Not a literal name; it cannot be suggested
+			continue
+		}
+		if name == "" || seen[name] {
+			continue
+		}
+		seen[name] = true
+		if d := editDistance(strings.ToLower(model), strings.ToLower(name)); d <= limit {
+			matches = append(matches, scored{name, d})
+		}
+	}
+	sort.Slice(matches, func(i, j int) bool {
+		if matches[i].distance != matches[j].distance {
+			return matches[i].distance < matches[j].distance
+		}
+		return matches[i].name < matches[j].name
+	})
+
+	suggestions := make([]string, 0, maxSuggestions)
+	for _, m := range matches {
+		if len(suggestions) == maxSuggestions {
+			break
+		}
+		suggestions = append(suggestions, m.name)
+	}
+	return suggestions
+}
+
+// editDistance returns the Levenshtein distance between a and b.
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	curr := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		curr[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+	return prev[len(b)]
+}
@@ -0,0 +1,72 @@
+package connectors
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/nexen/services/connectors/common"
+)
+
+// ModelAccess is a model allowlist and denylist.
+type ModelAccess = common.ModelAccess
+
+var (
+	accessMu     sync.RWMutex
+	accessRules  []ModelAccess
+	tenantAccess = make(map[string]ModelAccess) // lower-cased tenant -> rule
+)
+
+// SetModelAccess replaces the access rules every model must pass, such as the organization's
+// and the environment's. NewLLM refuses to create clients for models they do not allow.
+func SetModelAccess(rules ...ModelAccess) {
+	accessMu.Lock()
+	defer accessMu.Unlock()
+	accessRules = append([]ModelAccess(nil), rules...)
+}
+
+// SetTenantModelAccess sets the access rule of a tenant, applied to clients created with
+// common.WithTenant and to CheckModelAccess calls naming the tenant.
+func SetTenantModelAccess(tenant string, access ModelAccess) {
+	accessMu.Lock()
+	defer accessMu.Unlock()
+	tenantAccess[strings.ToLower(tenant)] = access
+}
+
+// DeleteTenantModelAccess removes the access rule of a tenant.
+func DeleteTenantModelAccess(tenant string) {
+	accessMu.Lock()
+	defer accessMu.Unlock()
+	delete(tenantAccess, strings.ToLower(tenant))
+}
+
+// CheckModelAccess returns a *common.ModelAccessError when model is refused by the process
+// rules, the tenant's rule or any of extra, and nil otherwise. Gateways use it to refuse
+// requests before choosing a client.
+func CheckModelAccess(model, tenant string, extra ...ModelAccess) error {
+	accessMu.RLock()
+	defer accessMu.RUnlock()
+	for _, rule := range accessRules {
+		if !rule.Allows(model) {
+			return &common.ModelAccessError{Model: model}
+		}
+	}
+	for _, rule := range extra {
+		if !rule.Allows(model) {
+			return &common.ModelAccessError{Model: model}
+		}
+	}
+	if rule, ok := tenantAccess[strings.ToLower(tenant)]; ok && tenant != "" && !rule.Allows(model) {
+		return &common.ModelAccessError{Model: model, Tenant: tenant}
+	}
+	return nil
+}
+
+// optionsConfig returns the configuration opts set, ignoring invalid options; those are
+// reported by the constructor.
+func optionsConfig(opts []Option) common.LLMConfig {
+	var config common.LLMConfig
+	for _, opt := range opts {
+		_ = opt(&config)
+	}
+	return config
+}
@@ -0,0 +1,42 @@
+package connectors
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/nexen/services/connectors/common"
+)
+
+func TestModelAccess(t *testing.T) {
+	Register("^access-.*", mockConstructor)
+	SetModelAccess(ModelAccess{Deny: []string{"access-legacy*"}}, ModelAccess{Allow: []string{"access-*"}})
+	SetTenantModelAccess("Acme", ModelAccess{Allow: []string{"access-small"}})
+	defer func() {
+		SetModelAccess()
+		DeleteTenantModelAccess("acme")
+	}()
+
+	if _, err := NewLLM("access-large"); err != nil {
+		t.Errorf("NewLLM(access-large) error = %v", err)
+	}
+	_, err := NewLLM("access-legacy-1")
+	var accessErr *common.ModelAccessError
+	if !errors.As(err, &accessErr) || !errors.Is(err, common.ErrModelNotAllowed) || accessErr.Model != "access-legacy-1" {
+		t.Errorf("Expected a ModelAccessError for a denied model, got %v", err)
+	}
+
+	// The tenant's rule and the client's own rules apply on top of the process rules
+	if _, err := NewLLM("access-large", common.WithTenant("acme")); !errors.As(err, &accessErr) || accessErr.Tenant != "acme" {
+		t.Errorf("Expected the tenant rule to refuse access-large, got %v", err)
+	}
+	if _, err := NewLLM("access-small", common.WithTenant("acme")); err != nil {
+		t.Errorf("NewLLM(access-small) error = %v", err)
+	}
+	if _, err := NewLLM("access-large", common.WithModelAccess(ModelAccess{Deny: []string{"ACCESS-LARGE"}})); !errors.Is(err, common.ErrModelNotAllowed) {
+		t.Errorf("Expected the client rule to refuse access-large, got %v", err)
+	}
+
+	if err := CheckModelAccess("access-small", "globex"); err != nil {
+		t.Errorf("CheckModelAccess() error = %v", err)
+	}
+}
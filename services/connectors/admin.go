@@ -0,0 +1,505 @@
+package connectors
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/nexen/libs/paging"
+	"github.com/nexen/models"
+)
+
+// AdminHandler returns an http.Handler exposing the provider settings for runtime changes.
+// Mount it under a prefix with http.StripPrefix. Listings are paginated, sorted and filtered
+// with the libs/paging query parameters. The handler changes API keys and endpoints, so every
+// request must carry token as "Authorization: Bearer <token>"; an empty token rejects all
+// requests. Routes:
+//
+//	GET    /models                 list registered models
+//	GET    /models/{model}         resolve a model name to its registered model
+//	PUT    /models/{model}         register a model, replacing its earlier registration
+//	DELETE /models/{model}         remove every registration of a model
+//	POST   /models:batch           register a catalog of models atomically
+//	GET    /catalog                list registered models with their patterns
+//	GET    /snapshot               export every registration in Resolve order
+//	PUT    /snapshot               replace every registration with a snapshot
+//	GET    /providers              list provider overrides
+//	GET    /providers/{provider}   get a provider's overrides
+//	PUT    /providers/{provider}   replace a provider's overrides
+//	DELETE /providers/{provider}   remove a provider's overrides
+//	GET    /providers/{provider}/models  list the provider's models upstream and in the registry
+//	POST   /providers/{provider}/models  register the provider's upstream models missing from the registry
+//	GET    /keys                   list API key aliases (names only)
+//	PUT    /keys/{alias}           set the API key for an alias
+//	DELETE /keys/{alias}           remove an API key alias
+//	GET    /aliases                list model aliases
+//	PUT    /aliases/{alias}        point a model alias at a model
+//	DELETE /aliases/{alias}        remove a model alias
+//	GET    /stats                  list the latency and error statistics of observed models
+//	GET    /stats/{model}          get a model's latency and error statistics
+func AdminHandler(token string) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/models", handleModels)
+	mux.HandleFunc("/models:batch", handleModelsBatch)
+	mux.HandleFunc("/models/", handleModel)
+	mux.HandleFunc("/catalog", handleCatalog)
+	mux.HandleFunc("/snapshot", handleSnapshot)
+	mux.HandleFunc("/providers", handleProviders)
+	mux.HandleFunc("/providers/", handleProvider)
+	mux.HandleFunc("/keys", handleKeys)
+	mux.HandleFunc("/keys/", handleKey)
+	mux.HandleFunc("/aliases", handleAliases)
+	mux.HandleFunc("/aliases/", handleAlias)
+	mux.HandleFunc("/stats", handleStats)
+	mux.HandleFunc("/stats/", handleModelStats)
+	return requireAdminToken(token, mux)
+}
+
+// requireAdminToken rejects requests that do not carry token as a bearer token.
+func requireAdminToken(token string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if token == "" || !ok || subtle.ConstantTimeCompare([]byte(got), []byte(token)) != 1 {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="nexen-admin"`)
+			writeAdminError(w, http.StatusUnauthorized, "admin token required")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// apiKeyRequest is the body accepted by PUT /keys/{alias}.
+type apiKeyRequest struct {
+	APIKey string `json:"apiKey"`
+}
+
+// modelAlias is an item of GET /aliases and the body of PUT /aliases/{alias}.
+type modelAlias struct {
+	Alias string `json:"alias,omitempty"`
+	Model string `json:"model"`
+}
+
+// providerEntry is an item of GET /providers.
+type providerEntry struct {
+	Provider string `json:"provider"`
+	ProviderSettings
+}
+
+// Fields the admin listings can be sorted and filtered by.
+var (
+	modelFields = paging.Fields[models.ModelInfo]{
+		"provider":        func(m models.ModelInfo) any { return m.Provider },
+		"costTier":        func(m models.ModelInfo) any { return string(m.CostTier) },
+		"maxTokens":       func(m models.ModelInfo) any { return m.MaxTokens },
+		"contextWindow":   func(m models.ModelInfo) any { return m.ContextWindow },
+		"maxOutputTokens": func(m models.ModelInfo) any { return m.MaxOutputTokens },
+		"costPerToken":    func(m models.ModelInfo) any { return estimateCost(m, typicalUsage) / float64(typicalUsage.TotalTokens) },
+	}
+	remoteModelFields = paging.Fields[RemoteModel]{
+		"upstream":   func(m RemoteModel) any { return m.Upstream },
+		"registered": func(m RemoteModel) any { return m.Registered },
+		"added":      func(m RemoteModel) any { return m.Added },
+	}
+	aliasFields = paging.Fields[modelAlias]{
+		"model": func(a modelAlias) any { return a.Model },
+	}
+	statsFields = paging.Fields[ModelStats]{
+		"healthy":   func(s ModelStats) any { return s.Healthy },
+		"errorRate": func(s ModelStats) any { return s.ErrorRate },
+		"latencyMs": func(s ModelStats) any { return s.LatencyMs },
+		"p95Ms":     func(s ModelStats) any { return s.P95Ms },
+		"requests":  func(s ModelStats) any { return s.Requests },
+	}
+	providerFields = paging.Fields[providerEntry]{
+		"apiKeyAlias": func(p providerEntry) any { return p.APIKeyAlias },
+		"timeout":     func(p providerEntry) any { return p.Timeout },
+	}
+)
+
+func handleModels(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeAdminError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	writeAdminPage(w, r, models.ListModelInfos(), func(m models.ModelInfo) string { return m.ID }, modelFields)
+}
+
+// modelNotFoundBody is the 404 body of GET /models/{model}.
+type modelNotFoundBody struct {
+	Error       string   `json:"error"`
+	Suggestions []string `json:"suggestions,omitempty"`
+}
+
+func handleModel(w http.ResponseWriter, r *http.Request) {
+	model := strings.TrimPrefix(r.URL.Path, "/models/")
+	if model == "" || strings.Contains(model, "/") {
+		writeAdminError(w, http.StatusNotFound, "model not specified")
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		info, err := models.Resolve(model)
+		var notFound *models.ModelNotFoundError
+		if errors.As(err, &notFound) {
+			writeAdminJSON(w, http.StatusNotFound, modelNotFoundBody{Error: err.Error(), Suggestions: notFound.Suggestions})
+			return
+		}
+		if err != nil {
+			writeAdminError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		writeAdminJSON(w, http.StatusOK, info)
+	case http.MethodPut:
+		putModel(w, r, model)
+	case http.MethodDelete:
+		if !models.UnregisterModel(model) {
+			writeAdminError(w, http.StatusNotFound, "model "+model+" is not registered")
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		writeAdminError(w, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
+
+// putModel registers the models.CatalogEntry of the body as model, replacing its earlier
+// registration. The entry's ID defaults to model and its patterns to model's exact name.
+func putModel(w http.ResponseWriter, r *http.Request, model string) {
+	var entry models.CatalogEntry
+	if err := json.NewDecoder(r.Body).Decode(&entry); err != nil {
+		writeAdminError(w, http.StatusBadRequest, "invalid body: "+err.Error())
+		return
+	}
+	if entry.ID == "" {
+		entry.ID = model
+	}
+	if entry.ID != model {
+		writeAdminError(w, http.StatusBadRequest, "id "+entry.ID+" does not match the path")
+		return
+	}
+	if len(entry.Patterns) == 0 {
+		entry.Patterns = []string{"^" + regexp.QuoteMeta(model) + "$"}
+	}
+
+	status := http.StatusCreated
+	for _, info := range models.ListModelInfos() {
+		if info.ID == model {
+			status = http.StatusOK
+			break
+		}
+	}
+	if err := models.RegisterModel(entry); err != nil {
+		writeAdminError(w, http.StatusBadRequest, strings.ReplaceAll(err.Error(), "\n", "; "))
+		return
+	}
+	writeAdminJSON(w, status, entry)
+}
+
+func handleCatalog(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeAdminError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	writeAdminJSON(w, http.StatusOK, models.ListCatalog())
+}
+
+// handleSnapshot exports the registry with models.Snapshot, or replaces it with the snapshot of
+// the body with models.Import. A PUT answers the models.SnapshotDiff of the registry it
+// replaced; with ?dryRun=true the registry is only compared to the snapshot.
+func handleSnapshot(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		writeAdminJSON(w, http.StatusOK, models.Snapshot())
+	case http.MethodPut:
+		var snapshot []models.ModelEntry
+		if err := json.NewDecoder(r.Body).Decode(&snapshot); err != nil {
+			writeAdminError(w, http.StatusBadRequest, "invalid body: "+err.Error())
+			return
+		}
+		diff := models.DiffSnapshots(models.Snapshot(), snapshot)
+		if r.URL.Query().Get("dryRun") != "true" {
+			if err := models.Import(snapshot); err != nil {
+				writeAdminError(w, http.StatusBadRequest, err.Error())
+				return
+			}
+		}
+		writeAdminJSON(w, http.StatusOK, diff)
+	default:
+		writeAdminError(w, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
+
+// catalogReport is the response of POST /models:batch.
+type catalogReport struct {
+	// Applied is true when the catalog was registered.
+	Applied bool                 `json:"applied"`
+	Entries []catalogEntryResult `json:"entries"`
+}
+
+// catalogEntryResult reports whether one catalog entry was accepted.
+type catalogEntryResult struct {
+	Index    int      `json:"index"`
+	ID       string   `json:"id"`
+	Accepted bool     `json:"accepted"`
+	Errors   []string `json:"errors,omitempty"`
+}
+
+// handleModelsBatch validates every entry of a models.Catalog body and registers the catalog
+// only if all entries are accepted. With ?dryRun=true the catalog is only validated.
+func handleModelsBatch(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeAdminError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	var catalog models.Catalog
+	if err := json.NewDecoder(r.Body).Decode(&catalog); err != nil {
+		writeAdminError(w, http.StatusBadRequest, "invalid body: "+err.Error())
+		return
+	}
+	if len(catalog.Models) == 0 {
+		writeAdminError(w, http.StatusBadRequest, "catalog has no models")
+		return
+	}
+
+	report := catalogReport{Entries: make([]catalogEntryResult, len(catalog.Models))}
+	rejected := false
+	for i, err := range catalog.Validate() {
+		result := catalogEntryResult{Index: i, ID: catalog.Models[i].ID, Accepted: err == nil}
+		if err != nil {
+			rejected = true
+			// Validation joins one error per problem
+			if joined, ok := err.(interface{ Unwrap() []error }); ok {
+				for _, e := range joined.Unwrap() {
+					result.Errors = append(result.Errors, e.Error())
+				}
+			} else {
+				result.Errors = []string{err.Error()}
+			}
+		}
+		report.Entries[i] = result
+	}
+	if rejected {
+		writeAdminJSON(w, http.StatusUnprocessableEntity, report)
+		return
+	}
+	if r.URL.Query().Get("dryRun") != "true" {
+		if err := models.RegisterCatalog(catalog); err != nil {
+			writeAdminError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		report.Applied = true
+	}
+	writeAdminJSON(w, http.StatusOK, report)
+}
+
+func handleProviders(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeAdminError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	var entries []providerEntry
+	for provider, settings := range ListProviderSettings() {
+		entries = append(entries, providerEntry{Provider: provider, ProviderSettings: settings})
+	}
+	writeAdminPage(w, r, entries, func(p providerEntry) string { return p.Provider }, providerFields)
+}
+
+func handleProvider(w http.ResponseWriter, r *http.Request) {
+	provider := strings.TrimPrefix(r.URL.Path, "/providers/")
+	if name, ok := strings.CutSuffix(provider, "/models"); ok && name != "" && !strings.Contains(name, "/") {
+		handleProviderModels(w, r, name)
+		return
+	}
+	if provider == "" || strings.Contains(provider, "/") {
+		writeAdminError(w, http.StatusNotFound, "provider not specified")
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		settings, ok := GetProviderSettings(provider)
+		if !ok {
+			writeAdminError(w, http.StatusNotFound, "no settings for provider "+provider)
+			return
+		}
+		writeAdminJSON(w, http.StatusOK, settings)
+	case http.MethodPut:
+		var settings ProviderSettings
+		if err := json.NewDecoder(r.Body).Decode(&settings); err != nil {
+			writeAdminError(w, http.StatusBadRequest, "invalid body: "+err.Error())
+			return
+		}
+		if settings.Timeout < 0 {
+			writeAdminError(w, http.StatusBadRequest, "timeout must not be negative")
+			return
+		}
+		if settings.RequestsPerMinute < 0 || settings.TokensPerMinute < 0 {
+			writeAdminError(w, http.StatusBadRequest, "rate limits must not be negative")
+			return
+		}
+		SetProviderSettings(provider, settings)
+		writeAdminJSON(w, http.StatusOK, settings)
+	case http.MethodDelete:
+		DeleteProviderSettings(provider)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		writeAdminError(w, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
+
+// handleProviderModels lists the provider's models with ListRemoteModels, or with
+// SyncRemoteModels for a POST, which registers those missing. Filter with
+// ?upstream=true&registered=false to find models missing from the registry.
+func handleProviderModels(w http.ResponseWriter, r *http.Request, provider string) {
+	list := ListRemoteModels
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost:
+		list = SyncRemoteModels
+	default:
+		writeAdminError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	remote, err := list(r.Context(), provider)
+	if err != nil {
+		writeAdminError(w, http.StatusBadGateway, err.Error())
+		return
+	}
+	writeAdminPage(w, r, remote, func(m RemoteModel) string { return m.ID }, remoteModelFields)
+}
+
+func handleKeys(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeAdminError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	writeAdminPage(w, r, ListAPIKeyAliases(), func(alias string) string { return alias }, nil)
+}
+
+func handleKey(w http.ResponseWriter, r *http.Request) {
+	alias := strings.TrimPrefix(r.URL.Path, "/keys/")
+	if alias == "" || strings.Contains(alias, "/") {
+		writeAdminError(w, http.StatusNotFound, "alias not specified")
+		return
+	}
+
+	switch r.Method {
+	case http.MethodPut:
+		var body apiKeyRequest
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			writeAdminError(w, http.StatusBadRequest, "invalid body: "+err.Error())
+			return
+		}
+		if body.APIKey == "" {
+			writeAdminError(w, http.StatusBadRequest, "apiKey is required")
+			return
+		}
+		SetAPIKeyAlias(alias, body.APIKey)
+		w.WriteHeader(http.StatusNoContent)
+	case http.MethodDelete:
+		DeleteAPIKeyAlias(alias)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		writeAdminError(w, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
+
+func handleAliases(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeAdminError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	var entries []modelAlias
+	for alias, model := range models.ListAliases() {
+		entries = append(entries, modelAlias{Alias: alias, Model: model})
+	}
+	writeAdminPage(w, r, entries, func(a modelAlias) string { return a.Alias }, aliasFields)
+}
+
+func handleAlias(w http.ResponseWriter, r *http.Request) {
+	alias := strings.TrimPrefix(r.URL.Path, "/aliases/")
+	if alias == "" || strings.Contains(alias, "/") {
+		writeAdminError(w, http.StatusNotFound, "alias not specified")
+		return
+	}
+
+	switch r.Method {
+	case http.MethodPut:
+		var body modelAlias
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			writeAdminError(w, http.StatusBadRequest, "invalid body: "+err.Error())
+			return
+		}
+		if err := models.RegisterAlias(alias, body.Model); err != nil {
+			writeAdminError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		writeAdminJSON(w, http.StatusOK, modelAlias{Alias: alias, Model: body.Model})
+	case http.MethodDelete:
+		models.DeleteAlias(alias)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		writeAdminError(w, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
+
+func handleStats(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeAdminError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	writeAdminPage(w, r, DefaultHealthTracker.ListStats(), func(s ModelStats) string { return s.Model }, statsFields)
+}
+
+func handleModelStats(w http.ResponseWriter, r *http.Request) {
+	model := strings.TrimPrefix(r.URL.Path, "/stats/")
+	if model == "" || strings.Contains(model, "/") {
+		writeAdminError(w, http.StatusNotFound, "model not specified")
+		return
+	}
+	if r.Method != http.MethodGet {
+		writeAdminError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	stats, ok := DefaultHealthTracker.Stats(model)
+	if !ok {
+		writeAdminError(w, http.StatusNotFound, "no calls observed for model "+model)
+		return
+	}
+	writeAdminJSON(w, http.StatusOK, stats)
+}
+
+// writeAdminPage writes the page of items selected by the request's query parameters.
+func writeAdminPage[T any](w http.ResponseWriter, r *http.Request, items []T, key func(T) string, fields paging.Fields[T]) {
+	q, err := paging.ParseQuery(r.URL.Query())
+	if err != nil {
+		writeAdminError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	page, err := paging.List(items, key, fields, q)
+	if errors.Is(err, paging.ErrInvalidQuery) {
+		writeAdminError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err != nil {
+		writeAdminError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeAdminJSON(w, http.StatusOK, page)
+}
+
+// writeAdminJSON writes v as a JSON response with the given status.
+func writeAdminJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// writeAdminError writes a JSON error body with the given status.
+func writeAdminError(w http.ResponseWriter, status int, msg string) {
+	writeAdminJSON(w, status, map[string]string{"error": msg})
+}
@@ -0,0 +1,88 @@
+// Package agent runs tool-calling conversations against an LLM.
+package agent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/nexen/models"
+	"github.com/nexen/services/connectors/common"
+)
+
+// ErrMaxTurns is returned when the model is still calling tools after the turn limit.
+var ErrMaxTurns = errors.New("agent: turn limit reached before a final answer")
+
+// DefaultMaxTurns is used when Run is called with a non-positive turn limit.
+const DefaultMaxTurns = 10
+
+// toolRole is the role assigned to content carrying tool results.
+const toolRole = "tool"
+
+// Run calls llm with request and executes any function calls in the response using the
+// matching tools in request.ToolsDict. Tool results are appended to request.Contents and
+// the model is called again until it answers without calling a tool or maxTurns calls have
+// been made. The returned response's Usage covers every call made.
+func Run(ctx context.Context, llm common.LLM, request *models.LLMRequest, maxTurns int) (*models.LLMResponse, error) {
+	if maxTurns <= 0 {
+		maxTurns = DefaultMaxTurns
+	}
+
+	var usage models.UsageMetrics
+	var response *models.LLMResponse
+	for turn := 0; turn < maxTurns; turn++ {
+		if err := ctx.Err(); err != nil {
+			return response, err
+		}
+
+		var err error
+		response, err = llm.Call(ctx, request)
+		if err != nil {
+			return nil, fmt.Errorf("turn %d: %w", turn+1, err)
+		}
+		usage = usage.Add(response.Usage)
+		response.Usage = usage
+
+		if response.IsError() {
+			return response, nil
+		}
+		calls := response.Content.FunctionCalls()
+		if len(calls) == 0 {
+			return response, nil
+		}
+
+		request.Contents = append(request.Contents, *response.Content)
+		results := make([]any, 0, len(calls))
+		for _, call := range calls {
+			results = append(results, models.NewFunctionResponsePart(dispatch(ctx, request.ToolsDict, call)))
+		}
+		request.Contents = append(request.Contents, models.Content{Role: toolRole, Parts: results})
+	}
+
+	return response, ErrMaxTurns
+}
+
+// dispatch executes a single function call. Failures are reported back to the model as
+// error results rather than aborting the run, so it can correct itself.
+func dispatch(ctx context.Context, tools map[string]models.BaseTool, call models.FunctionCall) models.FunctionResponse {
+	resp := models.FunctionResponse{ID: call.ID, Name: call.Name}
+
+	tool, ok := tools[call.Name]
+	if !ok {
+		resp.Response, resp.IsError = fmt.Sprintf("unknown tool %q", call.Name), true
+		return resp
+	}
+	callable, ok := tool.(models.CallableTool)
+	if !ok {
+		resp.Response, resp.IsError = fmt.Sprintf("tool %q cannot be executed", call.Name), true
+		return resp
+	}
+
+	result, err := callable.Call(ctx, call.Args)
+	if err != nil {
+		resp.Response, resp.IsError = err.Error(), true
+		return resp
+	}
+	resp.Response = result
+	return resp
+}
@@ -0,0 +1,133 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/nexen/models"
+)
+
+// scriptedLLM returns the queued responses in order and records each request it sees.
+type scriptedLLM struct {
+	responses []*models.LLMResponse
+	calls     int
+}
+
+func (s *scriptedLLM) Call(ctx context.Context, request *models.LLMRequest) (*models.LLMResponse, error) {
+	if s.calls >= len(s.responses) {
+		return nil, errors.New("no more scripted responses")
+	}
+	resp := s.responses[s.calls]
+	s.calls++
+	return resp, nil
+}
+
+func (s *scriptedLLM) BatchCall(ctx context.Context, requests []*models.LLMRequest) ([]*models.LLMResponse, error) {
+	return nil, errors.New("not implemented")
+}
+
+func (s *scriptedLLM) SupportedModels() []string {
+	return []string{"scripted"}
+}
+
+// weatherTool is a CallableTool returning a fixed forecast.
+type weatherTool struct{}
+
+func (weatherTool) Name() string { return "get_weather" }
+
+func (weatherTool) Declaration() (string, error) {
+	return `{"name":"get_weather","description":"Look up the weather"}`, nil
+}
+
+func (weatherTool) Call(ctx context.Context, args map[string]any) (any, error) {
+	return "sunny in " + args["city"].(string), nil
+}
+
+func toolCallResponse(name string) *models.LLMResponse {
+	return &models.LLMResponse{
+		Content: &models.Content{
+			Role: "assistant",
+			Parts: []any{models.NewFunctionCallPart(models.FunctionCall{
+				ID:   "call_1",
+				Name: name,
+				Args: map[string]any{"city": "Paris"},
+			})},
+		},
+		Usage: models.UsageMetrics{PromptTokens: 10, CompletionTokens: 5, TotalTokens: 15},
+	}
+}
+
+func newRequest(t *testing.T) *models.LLMRequest {
+	request := &models.LLMRequest{
+		Model:    "scripted",
+		Contents: []models.Content{{Role: "user", Message: "Weather in Paris?"}},
+	}
+	if err := request.AppendTools(weatherTool{}); err != nil {
+		t.Fatalf("AppendTools failed: %v", err)
+	}
+	return request
+}
+
+func TestRunExecutesToolsUntilFinalAnswer(t *testing.T) {
+	llm := &scriptedLLM{responses: []*models.LLMResponse{
+		toolCallResponse("get_weather"),
+		{
+			Content: &models.Content{Role: "assistant", Message: "It is sunny in Paris."},
+			Usage:   models.UsageMetrics{PromptTokens: 20, CompletionTokens: 7, TotalTokens: 27},
+		},
+	}}
+	request := newRequest(t)
+
+	response, err := Run(context.Background(), llm, request, 5)
+	if err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+	if response.Content.Message != "It is sunny in Paris." {
+		t.Errorf("Unexpected final message %q", response.Content.Message)
+	}
+	if response.Usage.TotalTokens != 42 {
+		t.Errorf("Expected accumulated usage of 42 tokens, got %d", response.Usage.TotalTokens)
+	}
+
+	// user, assistant tool call, tool result
+	if len(request.Contents) != 3 {
+		t.Fatalf("Expected 3 contents in conversation, got %d", len(request.Contents))
+	}
+	result := request.Contents[2].Parts[0].(map[string]any)[models.PartFunctionResponse].(map[string]any)
+	if result["response"] != "sunny in Paris" || result["id"] != "call_1" {
+		t.Errorf("Unexpected tool result %+v", result)
+	}
+}
+
+func TestRunReportsUnknownToolToModel(t *testing.T) {
+	llm := &scriptedLLM{responses: []*models.LLMResponse{
+		toolCallResponse("book_flight"),
+		{Content: &models.Content{Role: "assistant", Message: "I cannot book flights."}},
+	}}
+	request := newRequest(t)
+
+	if _, err := Run(context.Background(), llm, request, 5); err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+	result := request.Contents[2].Parts[0].(map[string]any)[models.PartFunctionResponse].(map[string]any)
+	if result["isError"] != true {
+		t.Errorf("Expected error result for unknown tool, got %+v", result)
+	}
+}
+
+func TestRunStopsAtTurnLimit(t *testing.T) {
+	llm := &scriptedLLM{responses: []*models.LLMResponse{
+		toolCallResponse("get_weather"),
+		toolCallResponse("get_weather"),
+		toolCallResponse("get_weather"),
+	}}
+
+	_, err := Run(context.Background(), llm, newRequest(t), 2)
+	if !errors.Is(err, ErrMaxTurns) {
+		t.Fatalf("Expected ErrMaxTurns, got %v", err)
+	}
+	if llm.calls != 2 {
+		t.Errorf("Expected 2 model calls, got %d", llm.calls)
+	}
+}
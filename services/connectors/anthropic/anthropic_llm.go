@@ -2,12 +2,15 @@ package anthropic
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"net/http"
 	"strings"
-	"time"
 
 	"github.com/anthropics/anthropic-sdk-go"
 	"github.com/anthropics/anthropic-sdk-go/option"
+	"github.com/anthropics/anthropic-sdk-go/packages/pagination"
 
 	"github.com/nexen/models"
 	"github.com/nexen/services/connectors"
@@ -17,6 +20,12 @@ import (
 const (
 	defaultAnthropicEndpoint = "https://api.anthropic.com/v1"
 	defaultMaxTokens         = 4096
+
+	// maxCacheBreakpoints is the number of cache_control blocks Anthropic accepts per request.
+	maxCacheBreakpoints = 4
+
+	// modelsPageSize is the largest page the models endpoint returns.
+	modelsPageSize = 1000
 )
 
 var (
@@ -32,8 +41,19 @@ type AnthropicClient struct {
 	config    *common.LLMConfig
 	modelName string
 	client    anthropic.Client
+	limiter   *common.RateLimiter
 }
 
+// The interfaces AnthropicClient implements, checked at compile time.
+var (
+	_ common.LLM            = (*AnthropicClient)(nil)
+	_ common.ModelNamer     = (*AnthropicClient)(nil)
+	_ common.ModelLister    = (*AnthropicClient)(nil)
+	_ common.ModelDescriber = (*AnthropicClient)(nil)
+	_ common.Pinger         = (*AnthropicClient)(nil)
+	_ common.TokenCounter   = (*AnthropicClient)(nil)
+)
+
 // init registers this adapter with the connectors registry.
 func init() {
 	for _, pattern := range supportedModelPatterns {
@@ -70,14 +90,27 @@ func NewAnthropicClient(model string, opts ...common.Option) (common.LLM, error)
 		clientOpts = append(clientOpts, option.WithBaseURL(config.EndpointOverride))
 	}
 
-	// Set timeout
-	if config.Timeout > 0 {
-		clientOpts = append(clientOpts, option.WithRequestTimeout(time.Duration(config.Timeout)*time.Second))
-	}
-
-	// Set retry configuration
-	if config.RetryConfig.MaxRetries > 0 {
-		clientOpts = append(clientOpts, option.WithMaxRetries(config.RetryConfig.MaxRetries))
+	// Timeouts and retries are handled by common.CallContext and common.DoWithRetry so they
+	// apply as for other connectors
+	clientOpts = append(clientOpts, option.WithMaxRetries(0))
+
+	// Propagate the caller's trace context to Anthropic
+	clientOpts = append(clientOpts, option.WithMiddleware(func(req *http.Request, next option.MiddlewareNext) (*http.Response, error) {
+		common.InjectTraceContext(req.Context(), req.Header)
+		return next(req)
+	}))
+
+	// Measure the round trips, for the latency and timing breakdown of responses
+	clientOpts = append(clientOpts, option.WithMiddleware(func(req *http.Request, next option.MiddlewareNext) (*http.Response, error) {
+		return common.MeasureRoundTrip(models.ProviderAnthropic, req, next)
+	}))
+
+	// Dump requests as sent, after the SDK has encoded them
+	if config.RequestDump.Dir != "" {
+		clientOpts = append(clientOpts, option.WithMiddleware(func(req *http.Request, next option.MiddlewareNext) (*http.Response, error) {
+			common.DumpRequest(config.RequestDump, req)
+			return next(req)
+		}))
 	}
 
 	client := anthropic.NewClient(clientOpts...)
@@ -86,6 +119,7 @@ func NewAnthropicClient(model string, opts ...common.Option) (common.LLM, error)
 		config:    config,
 		modelName: model,
 		client:    client,
+		limiter:   common.SharedRateLimiter(models.ProviderAnthropic, config.APIKey, config.RateLimit),
 	}, nil
 }
 
@@ -132,12 +166,20 @@ func contentToMessageParams(contents []models.Content) []anthropic.MessageParam
 					contentBlocks = append(contentBlocks, anthropic.NewTextBlock(v))
 				case map[string]interface{}:
 					// Attempt to handle function calls or other structured content
-					if funcCall, ok := v["function_call"].(map[string]interface{}); ok {
+					if funcCall, ok := v[models.PartFunctionCall].(map[string]interface{}); ok {
 						name, _ := funcCall["name"].(string)
 						args, _ := funcCall["args"].(map[string]interface{})
-						id := fmt.Sprintf("tool_%d", len(contentBlocks))
+						id, _ := funcCall["id"].(string)
+						if id == "" {
+							id = fmt.Sprintf("tool_%d", len(contentBlocks))
+						}
 
 						contentBlocks = append(contentBlocks, anthropic.ContentBlockParamOfToolUse(id, args, name))
+					} else if funcResp, ok := v[models.PartFunctionResponse].(map[string]interface{}); ok {
+						id, _ := funcResp["id"].(string)
+						isError, _ := funcResp["isError"].(bool)
+
+						contentBlocks = append(contentBlocks, anthropic.NewToolResultBlock(id, functionResultText(funcResp["response"]), isError))
 					}
 				}
 			}
@@ -155,6 +197,25 @@ func contentToMessageParams(contents []models.Content) []anthropic.MessageParam
 	return messages
 }
 
+// functionDeclaration is the JSON shape of a declaration produced by BaseTool.Declaration.
+type functionDeclaration struct {
+	Name        string         `json:"name"`
+	Description string         `json:"description"`
+	Parameters  map[string]any `json:"parameters"`
+}
+
+// functionResultText renders a tool result as the text content Anthropic expects.
+func functionResultText(result any) string {
+	if text, ok := result.(string); ok {
+		return text
+	}
+	encoded, err := json.Marshal(result)
+	if err != nil {
+		return fmt.Sprintf("%v", result)
+	}
+	return string(encoded)
+}
+
 // prepareFunctionTools converts tool declarations to Anthropic tool parameters
 func prepareFunctionTools(config *models.GenerateContentConfig) []anthropic.ToolUnionParam {
 	if config == nil || len(config.Tools) == 0 {
@@ -164,17 +225,37 @@ func prepareFunctionTools(config *models.GenerateContentConfig) []anthropic.Tool
 	var tools []anthropic.ToolUnionParam
 
 	for _, toolDecl := range config.Tools {
-		for i, _ := range toolDecl.FunctionDeclarations {
-			// Basic parsing of function declaration - in real implementation would need more robust parsing
+		for i, declaration := range toolDecl.FunctionDeclarations {
+			// Fall back to a generic single-input tool when the declaration cannot be parsed
+			name := fmt.Sprintf("function_%d", i)
+			description := "Function tool"
+			properties := map[string]map[string]interface{}{
+				"input": {
+					"type": "string",
+				},
+			}
+
+			var decl functionDeclaration
+			if err := json.Unmarshal([]byte(declaration), &decl); err == nil && decl.Name != "" {
+				name = decl.Name
+				if decl.Description != "" {
+					description = decl.Description
+				}
+				if props, ok := decl.Parameters["properties"].(map[string]any); ok {
+					properties = make(map[string]map[string]interface{}, len(props))
+					for propName, prop := range props {
+						if propSchema, ok := prop.(map[string]any); ok {
+							properties[propName] = propSchema
+						}
+					}
+				}
+			}
+
 			toolParam := anthropic.ToolParam{
-				Name:        fmt.Sprintf("function_%d", i),
-				Description: anthropic.String("Function tool"),
+				Name:        name,
+				Description: anthropic.String(description),
 				InputSchema: anthropic.ToolInputSchemaParam{
-					Properties: map[string]map[string]interface{}{
-						"input": {
-							"type": "string",
-						},
-					},
+					Properties: properties,
 				},
 			}
 
@@ -188,6 +269,95 @@ func prepareFunctionTools(config *models.GenerateContentConfig) []anthropic.Tool
 	return tools
 }
 
+// outputToolName is the tool Anthropic is forced to call when the request sets an output
+// schema. Its input is returned as the response's JSON text rather than as a function call.
+const outputToolName = "structured_output"
+
+// prepareOutputTool builds the extraction tool for the request's output schema.
+// Anthropic has no JSON mode, so structured output is obtained by forcing a tool call whose
+// input schema is the requested schema. Only object schemas can be used as tool input.
+func prepareOutputTool(config *models.GenerateContentConfig) (anthropic.ToolUnionParam, bool) {
+	schema, err := config.OutputSchema()
+	if err != nil || schema == nil || schema.Type != "object" {
+		return anthropic.ToolUnionParam{}, false
+	}
+
+	inputSchema := anthropic.ToolInputSchemaParam{Properties: schema.Properties}
+	if len(schema.Required) > 0 {
+		inputSchema.ExtraFields = map[string]any{"required": schema.Required}
+	}
+	return anthropic.ToolUnionParam{
+		OfTool: &anthropic.ToolParam{
+			Name:        outputToolName,
+			Description: anthropic.String("Return the final answer in the required format."),
+			InputSchema: inputSchema,
+		},
+	}, true
+}
+
+// prepareToolChoice maps the request's tool choice to Anthropic's tool_choice parameter.
+// Anthropic calls "required" "any" and selects a specific function with a "tool" choice.
+func prepareToolChoice(config *models.GenerateContentConfig) anthropic.ToolChoiceUnionParam {
+	if name, ok := config.SpecificToolChoice(); ok {
+		return anthropic.ToolChoiceUnionParam{
+			OfTool: &anthropic.ToolChoiceToolParam{
+				Name: name,
+				Type: "tool",
+			},
+		}
+	}
+
+	switch config.ToolChoice {
+	case models.ToolChoiceNone:
+		return anthropic.ToolChoiceUnionParam{
+			OfNone: &anthropic.ToolChoiceNoneParam{
+				Type: "none",
+			},
+		}
+	case models.ToolChoiceRequired:
+		return anthropic.ToolChoiceUnionParam{
+			OfAny: &anthropic.ToolChoiceAnyParam{
+				Type: "any",
+			},
+		}
+	default:
+		return anthropic.ToolChoiceUnionParam{
+			OfAuto: &anthropic.ToolChoiceAutoParam{
+				Type: "auto",
+			},
+		}
+	}
+}
+
+// knownStopReasons lists the stop_reason values this connector understands.
+var knownStopReasons = []string{"end_turn", "max_tokens", "stop_sequence", "tool_use"}
+
+// serviceTierParams maps service tiers to Anthropic's service_tier values. Anthropic serves
+// "auto" requests from priority capacity when the organization has it, and has no flex tier.
+var serviceTierParams = map[string]string{
+	models.ServiceTierAuto:     "auto",
+	models.ServiceTierPriority: "auto",
+	models.ServiceTierDefault:  "standard_only",
+	models.ServiceTierFlex:     "standard_only",
+}
+
+// servedTier returns the service tier Anthropic reports in the usage of a raw message, with
+// "standard" as models.ServiceTierDefault, or empty when it reports none.
+func servedTier(raw string) string {
+	var message struct {
+		Usage struct {
+			ServiceTier string `json:"service_tier"`
+		} `json:"usage"`
+	}
+	if err := json.Unmarshal([]byte(raw), &message); err != nil {
+		return ""
+	}
+	if message.Usage.ServiceTier == "standard" {
+		return models.ServiceTierDefault
+	}
+	return message.Usage.ServiceTier
+}
+
 // anthropicResponseToLLMResponse converts Anthropic's response to models.LLMResponse
 func anthropicResponseToLLMResponse(anthResponse *anthropic.Message) *models.LLMResponse {
 	// Create a content object from the response
@@ -198,33 +368,74 @@ func anthropicResponseToLLMResponse(anthResponse *anthropic.Message) *models.LLM
 	// Process content blocks
 	if len(anthResponse.Content) > 0 {
 		var sb strings.Builder
+		var parts []any
+		hasToolUse := false
 
 		for _, block := range anthResponse.Content {
+			// Other block types are dropped; report them so new ones are noticed
+			common.CheckValue(models.ProviderAnthropic, "content.type", block.Type, "text", "tool_use")
 			switch block := block.AsAny().(type) {
 			case anthropic.TextBlock:
 				sb.WriteString(block.Text)
+				parts = append(parts, block.Text)
 			case anthropic.ToolUseBlock:
-				// Tool use blocks would need specialized handling
-				// This is simplified
+				if block.Name == outputToolName {
+					// Structured output: the tool input is the answer
+					sb.Write(block.Input)
+					parts = append(parts, string(block.Input))
+					continue
+				}
 				sb.WriteString(fmt.Sprintf("[Tool Use: %s]", block.Name))
+				var args map[string]any
+				if len(block.Input) > 0 {
+					json.Unmarshal(block.Input, &args)
+				}
+				parts = append(parts, models.NewFunctionCallPart(models.FunctionCall{
+					ID:   block.ID,
+					Name: block.Name,
+					Args: args,
+				}))
+				hasToolUse = true
 			}
 		}
 
 		content.Message = sb.String()
+		// Only structured parts can carry tool calls back into the conversation
+		if hasToolUse {
+			content.Parts = parts
+		}
 	}
 
+	// Anthropic reports prompt tokens read from and written to the cache separately
+	usage := anthResponse.Usage
+	promptTokens := usage.InputTokens + usage.CacheReadInputTokens + usage.CacheCreationInputTokens
+
 	// Create the final response
 	response := &models.LLMResponse{
 		Content: content,
 		Usage: models.UsageMetrics{
-			PromptTokens:     int(anthResponse.Usage.InputTokens),
-			CompletionTokens: int(anthResponse.Usage.OutputTokens),
-			TotalTokens:      int(anthResponse.Usage.InputTokens + anthResponse.Usage.OutputTokens),
-			LatencyMs:        float64(0), // Not provided directly by Anthropic
-			CostCents:        0.0,        // Would need pricing calculation
+			PromptTokens:           int(promptTokens),
+			CachedPromptTokens:     int(usage.CacheReadInputTokens),
+			CacheWritePromptTokens: int(usage.CacheCreationInputTokens),
+			CompletionTokens:       int(usage.OutputTokens),
+			TotalTokens:            int(promptTokens + usage.OutputTokens),
+			LatencyMs:              float64(0), // Not provided directly by Anthropic
+			CostCents:              0.0,        // Priced by connectors.Meter
 		},
 	}
 
+	if anthResponse.StopReason != "" {
+		response.CustomMetadata = map[string]any{common.MetadataFinishReason: string(anthResponse.StopReason)}
+	}
+	if tier := servedTier(anthResponse.RawJSON()); tier != "" {
+		if response.CustomMetadata == nil {
+			response.CustomMetadata = make(map[string]any)
+		}
+		response.CustomMetadata[common.MetadataServiceTier] = tier
+	}
+	common.CheckValue(models.ProviderAnthropic, "stop_reason", string(anthResponse.StopReason), knownStopReasons...)
+	common.ReportUnknownFields(models.ProviderAnthropic, []byte(anthResponse.RawJSON()), anthResponse)
+
 	// Set error information if there's a stop reason that indicates an issue
 	if anthResponse.StopReason == "max_tokens" {
 		maxTokensErr := "MAX_TOKENS"
@@ -236,18 +447,8 @@ func anthropicResponseToLLMResponse(anthResponse *anthropic.Message) *models.LLM
 	return response
 }
 
-// Call implements the LLM interface Call method.
-func (c *AnthropicClient) Call(ctx context.Context, request *models.LLMRequest) (*models.LLMResponse, error) {
-	// Check if context is done
-	if ctx.Err() != nil {
-		return nil, ctx.Err()
-	}
-
-	// Validate the request
-	if err := request.Validate(); err != nil {
-		return nil, fmt.Errorf("invalid request: %w", err)
-	}
-
+// messageParams converts request into Messages API parameters for the client's model.
+func (c *AnthropicClient) messageParams(request *models.LLMRequest) anthropic.MessageNewParams {
 	// Prepare messages
 	messages := contentToMessageParams(request.Contents)
 
@@ -275,23 +476,20 @@ func (c *AnthropicClient) Call(ctx context.Context, request *models.LLMRequest)
 		System:    systemTextBlocks,
 		MaxTokens: maxTokens,
 	}
-
-	// Set request timeout and other options
-	var callOpts []option.RequestOption
-	if c.config.Timeout > 0 {
-		callOpts = append(callOpts, option.WithRequestTimeout(time.Duration(c.config.Timeout)*time.Second))
+	if request.Metadata.UserID != "" {
+		msgParams.Metadata = anthropic.MetadataParam{UserID: anthropic.String(request.Metadata.UserID)}
 	}
 
 	// Add optional parameters
 	if request.Config != nil {
 		// Add temperature if provided
 		if request.Config.Temperature > 0 {
-			callOpts = append(callOpts, option.WithJSONSet("temperature", request.Config.Temperature))
+			msgParams.Temperature = anthropic.Float(request.Config.Temperature)
 		}
 
 		// Add top_p if provided
 		if request.Config.TopP > 0 {
-			callOpts = append(callOpts, option.WithJSONSet("top_p", request.Config.TopP))
+			msgParams.TopP = anthropic.Float(request.Config.TopP)
 		}
 
 		// Prepare tools if applicable
@@ -299,49 +497,248 @@ func (c *AnthropicClient) Call(ctx context.Context, request *models.LLMRequest)
 			toolsParam := prepareFunctionTools(request.Config)
 			if len(toolsParam) > 0 {
 				msgParams.Tools = toolsParam
-				// Enable auto tool choice
-				msgParams.ToolChoice = anthropic.ToolChoiceUnionParam{
-					OfAuto: &anthropic.ToolChoiceAutoParam{
-						Type: "auto",
-					},
-				}
+				msgParams.ToolChoice = prepareToolChoice(request.Config)
 			}
 		}
+
+		// Force the extraction tool when an output schema is set
+		if outputTool, ok := prepareOutputTool(request.Config); ok {
+			msgParams.Tools = append(msgParams.Tools, outputTool)
+			msgParams.ToolChoice = anthropic.ToolChoiceUnionParam{
+				OfTool: &anthropic.ToolChoiceToolParam{
+					Name: outputToolName,
+					Type: "tool",
+				},
+			}
+		} else if request.Config.JSONMode {
+			// Anthropic has no JSON mode, so ask for JSON in the system prompt
+			msgParams.System = append(msgParams.System, anthropic.TextBlockParam{Text: models.JSONModeInstruction, Type: "text"})
+		}
+	}
+	setCacheBreakpoints(&msgParams, request)
+	return msgParams
+}
+
+// setCacheBreakpoints adds cache_control breakpoints where the request marks cacheable
+// prefixes. Anthropic allows maxCacheBreakpoints per request; the latest content breakpoints
+// are kept, since each cached prefix includes the earlier ones.
+func setCacheBreakpoints(msgParams *anthropic.MessageNewParams, request *models.LLMRequest) {
+	remaining := maxCacheBreakpoints
+	if request.Config != nil && request.Config.CacheSystemInstruction {
+		// Tools come before the system prompt, so a breakpoint on the system prompt caches both
+		if n := len(msgParams.System); n > 0 {
+			msgParams.System[n-1].CacheControl = anthropic.NewCacheControlEphemeralParam()
+			remaining--
+		} else if n := len(msgParams.Tools); n > 0 {
+			if cacheControl := msgParams.Tools[n-1].GetCacheControl(); cacheControl != nil {
+				*cacheControl = anthropic.NewCacheControlEphemeralParam()
+				remaining--
+			}
+		}
+	}
+	for i := len(request.Contents) - 1; i >= 0 && remaining > 0; i-- {
+		if !request.Contents[i].CacheBreakpoint || i >= len(msgParams.Messages) {
+			continue
+		}
+		blocks := msgParams.Messages[i].Content
+		if len(blocks) == 0 {
+			continue
+		}
+		if cacheControl := blocks[len(blocks)-1].GetCacheControl(); cacheControl != nil {
+			*cacheControl = anthropic.NewCacheControlEphemeralParam()
+			remaining--
+		}
+	}
+}
+
+// Call implements the LLM interface Call method.
+func (c *AnthropicClient) Call(ctx context.Context, request *models.LLMRequest) (*models.LLMResponse, error) {
+	// Check if context is done
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+
+	// Validate the request
+	if err := request.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid request: %w", err)
+	}
+
+	ctx, cancel := common.CallContext(ctx, request, c.config)
+	defer cancel()
+
+	msgParams := c.messageParams(request)
+	var reqOpts []option.RequestOption
+	if tier, ok := serviceTierParams[common.RequestServiceTier(c.config, request)]; ok {
+		reqOpts = append(reqOpts, option.WithJSONSet("service_tier", tier))
+	}
+
+	// Wait for the key's rate limit before sending
+	estimatedTokens := common.EstimateTokens(request)
+	if request.Config == nil || request.Config.MaxTokens <= 0 {
+		estimatedTokens += defaultMaxTokens
+	}
+	if err := c.limiter.Wait(ctx, estimatedTokens); err != nil {
+		return nil, err
 	}
 
 	// Make the API call
-	response, err := c.client.Messages.New(ctx, msgParams, callOpts...)
+	var response *anthropic.Message
+	err := common.DoWithRetry(ctx, c.config.RetryConfig, func(ctx context.Context) error {
+		var err error
+		response, err = c.client.Messages.New(ctx, msgParams, reqOpts...)
+		if err != nil {
+			return classifyError(err)
+		}
+		return nil
+	})
 	if err != nil {
-		return nil, fmt.Errorf("Anthropic API call failed: %w", err)
+		return nil, err
 	}
 
 	// Convert to LLMResponse
-	return anthropicResponseToLLMResponse(response), nil
+	llmResponse := anthropicResponseToLLMResponse(response)
+	c.limiter.Adjust(llmResponse.Usage.TotalTokens - estimatedTokens)
+	common.DefaultTokenCalibrator.ObserveRequest(request, llmResponse.Usage.PromptTokens)
+	return llmResponse, nil
 }
 
-// BatchCall implements the LLM interface BatchCall method.
-func (c *AnthropicClient) BatchCall(ctx context.Context, requests []*models.LLMRequest) ([]*models.LLMResponse, error) {
-	responses := make([]*models.LLMResponse, len(requests))
-	var err error
+// CountTokens implements common.TokenCounter with Anthropic's token counting endpoint, which
+// is exact but costs a round trip. It is not registered automatically because it needs a
+// client; register one with common.RegisterTokenCounter(models.ProviderAnthropic, client).
+func (c *AnthropicClient) CountTokens(model string, contents []models.Content) (int, error) {
+	if model == "" {
+		model = c.modelName
+	}
+	params := anthropic.MessageCountTokensParams{
+		Model:    mapToAnthropicModel(model),
+		Messages: contentToMessageParams(contents),
+	}
+
+	ctx, cancel := common.CallContext(context.Background(), nil, c.config)
+	defer cancel()
 
-	// Process each request sequentially
-	// Note: The Anthropic API doesn't have a native batch endpoint, so we process sequentially
-	for i, req := range requests {
-		responses[i], err = c.Call(ctx, req)
+	var count *anthropic.MessageTokensCount
+	err := common.DoWithRetry(ctx, c.config.RetryConfig, func(ctx context.Context) error {
+		var err error
+		count, err = c.client.Messages.CountTokens(ctx, params)
 		if err != nil {
-			return responses, fmt.Errorf("error processing request %d: %w", i, err)
+			return classifyError(err)
 		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
 	}
+	return int(count.InputTokens), nil
+}
 
-	return responses, nil
+// ListModels implements common.ModelLister with the models endpoint.
+func (c *AnthropicClient) ListModels(ctx context.Context) ([]string, error) {
+	described, err := c.DescribeModels(ctx)
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]string, len(described))
+	for i, model := range described {
+		ids[i] = model.ID
+	}
+	return ids, nil
 }
 
-// SupportedModels returns a list of model names supported by this client.
-func (c *AnthropicClient) SupportedModels() []string {
-	return []string{
-		"claude-3-opus",
-		"claude-3-sonnet",
-		"claude-3-haiku",
-		"claude-3.5-sonnet",
+// DescribeModels implements common.ModelDescriber with the models endpoint, which reports the
+// display name and release date of each model, following its after_id cursor until every
+// page is fetched.
+func (c *AnthropicClient) DescribeModels(ctx context.Context) ([]common.ModelDescription, error) {
+	var described []common.ModelDescription
+	params := anthropic.ModelListParams{Limit: anthropic.Int(modelsPageSize)}
+	for {
+		var page *pagination.Page[anthropic.ModelInfo]
+		err := common.DoWithRetry(ctx, c.config.RetryConfig, func(ctx context.Context) error {
+			var err error
+			page, err = c.client.Models.List(ctx, params)
+			if err != nil {
+				return classifyError(err)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		for _, model := range page.Data {
+			described = append(described, common.ModelDescription{ID: model.ID, DisplayName: model.DisplayName, Created: model.CreatedAt})
+		}
+		if !page.HasMore || page.LastID == "" {
+			return described, nil
+		}
+		params.AfterID = anthropic.String(page.LastID)
+	}
+}
+
+// Ping implements common.Pinger by listing a single model, which fails like a call would
+// when the API key is refused or the API cannot be reached. It is not retried.
+func (c *AnthropicClient) Ping(ctx context.Context) error {
+	if _, err := c.client.Models.List(ctx, anthropic.ModelListParams{Limit: anthropic.Int(1)}); err != nil {
+		return classifyError(err)
+	}
+	return nil
+}
+
+// errorBody is the JSON body of an Anthropic API error.
+type errorBody struct {
+	Error struct {
+		Type    string `json:"type"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+// classifyError converts an SDK error into a classified *common.ProviderError.
+func classifyError(err error) error {
+	var apiErr *anthropic.Error
+	if !errors.As(err, &apiErr) {
+		return common.TransportError(models.ProviderAnthropic, err)
+	}
+
+	var body errorBody
+	json.Unmarshal([]byte(apiErr.RawJSON()), &body)
+
+	providerErr := newProviderError(apiErr.StatusCode, body.Error.Type, body.Error.Message)
+	if apiErr.Response != nil {
+		providerErr.RetryAfter = common.ParseRetryAfter(apiErr.Response.Header.Get("Retry-After"))
+	}
+	providerErr.Err = err
+	return providerErr
+}
+
+// newProviderError creates a *common.ProviderError classified by Anthropic's error type.
+func newProviderError(statusCode int, errorType, message string) *common.ProviderError {
+	providerErr := common.NewProviderError(models.ProviderAnthropic, statusCode, errorType, message)
+	switch errorType {
+	case "overloaded_error", "api_error":
+		providerErr.Class = common.ErrProviderUnavailable
+	case "rate_limit_error":
+		providerErr.Class = common.ErrRateLimited
+	case "authentication_error", "permission_error":
+		providerErr.Class = common.ErrAuth
 	}
+	return providerErr
+}
+
+// BatchCall implements the LLM interface BatchCall method. Batches of at least the
+// configured batch threshold are sent through the Message Batches API, if BatchAPIFlag is
+// enabled; other batches are sent as concurrent Calls.
+func (c *AnthropicClient) BatchCall(ctx context.Context, requests []*models.LLMRequest) ([]*models.LLMResponse, error) {
+	if threshold := c.batchThreshold(); threshold > 0 && len(requests) >= threshold && common.FeatureEnabled(ctx, c.config, BatchAPIFlag) {
+		return common.Responses(c.messageBatch(ctx, requests))
+	}
+	return common.BatchCall(ctx, requests, c.config.BatchConcurrency, c.Call)
+}
+
+// Model returns the model name this client was created for.
+func (c *AnthropicClient) Model() string {
+	return c.modelName
+}
+
+// SupportedModels returns the IDs of the provider's models in the registry.
+func (c *AnthropicClient) SupportedModels() []string {
+	return common.RegisteredModels(models.ProviderAnthropic)
 }
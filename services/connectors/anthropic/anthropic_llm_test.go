@@ -2,8 +2,20 @@ package anthropic
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
 	"testing"
 
+	"github.com/anthropics/anthropic-sdk-go"
+
+	"github.com/nexen/libs/nexenctx"
 	"github.com/nexen/models"
 	"github.com/nexen/services/connectors/common"
 )
@@ -109,3 +121,339 @@ func TestMockCall(t *testing.T) {
 		t.Fatal("Expected error for invalid API key, got nil")
 	}
 }
+
+func TestPrepareToolChoice(t *testing.T) {
+	testCases := []struct {
+		choice string
+		check  func(anthropic.ToolChoiceUnionParam) bool
+	}{
+		{"", func(p anthropic.ToolChoiceUnionParam) bool { return p.OfAuto != nil }},
+		{models.ToolChoiceAuto, func(p anthropic.ToolChoiceUnionParam) bool { return p.OfAuto != nil }},
+		{models.ToolChoiceNone, func(p anthropic.ToolChoiceUnionParam) bool { return p.OfNone != nil }},
+		{models.ToolChoiceRequired, func(p anthropic.ToolChoiceUnionParam) bool { return p.OfAny != nil }},
+		{"get_weather", func(p anthropic.ToolChoiceUnionParam) bool {
+			return p.OfTool != nil && p.OfTool.Name == "get_weather"
+		}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.choice, func(t *testing.T) {
+			param := prepareToolChoice(&models.GenerateContentConfig{ToolChoice: tc.choice})
+			if !tc.check(param) {
+				t.Errorf("Unexpected tool choice mapping for %q: %+v", tc.choice, param)
+			}
+		})
+	}
+}
+
+func TestPrepareFunctionToolsUsesDeclaredName(t *testing.T) {
+	config := &models.GenerateContentConfig{
+		Tools: []models.ToolDeclaration{{
+			FunctionDeclarations: []string{`{"name":"get_weather","description":"Look up weather","parameters":{"type":"object","properties":{"city":{"type":"string"}}}}`},
+		}},
+	}
+
+	tools := prepareFunctionTools(config)
+	if len(tools) != 1 || tools[0].OfTool == nil {
+		t.Fatalf("Expected 1 tool, got %d", len(tools))
+	}
+	if tools[0].OfTool.Name != "get_weather" {
+		t.Errorf("Expected tool name 'get_weather', got '%s'", tools[0].OfTool.Name)
+	}
+}
+
+func TestPrepareOutputTool(t *testing.T) {
+	type answer struct {
+		City string `json:"city"`
+	}
+	request := &models.LLMRequest{}
+	request.SetOutputSchema(answer{})
+
+	tool, ok := prepareOutputTool(request.Config)
+	if !ok || tool.OfTool == nil || tool.OfTool.Name != outputToolName {
+		t.Fatalf("Expected %s tool, got %+v", outputToolName, tool)
+	}
+	if !reflect.DeepEqual(tool.OfTool.InputSchema.ExtraFields["required"], []string{"city"}) {
+		t.Errorf("Expected required fields to be forwarded, got %v", tool.OfTool.InputSchema.ExtraFields)
+	}
+
+	if _, ok := prepareOutputTool(&models.GenerateContentConfig{}); ok {
+		t.Error("Expected no output tool without a schema")
+	}
+}
+
+func TestOutputToolUseBecomesMessage(t *testing.T) {
+	var message anthropic.Message
+	raw := `{"content":[{"type":"tool_use","id":"toolu_1","name":"structured_output","input":{"city":"Paris"}}],"stop_reason":"tool_use","usage":{"input_tokens":5,"output_tokens":3}}`
+	if err := json.Unmarshal([]byte(raw), &message); err != nil {
+		t.Fatalf("Unmarshal failed: %v", err)
+	}
+
+	response := anthropicResponseToLLMResponse(&message)
+	if response.Content.Message != `{"city":"Paris"}` {
+		t.Errorf("Expected tool input as message, got %q", response.Content.Message)
+	}
+	if len(response.Content.FunctionCalls()) != 0 {
+		t.Error("Output tool should not surface as a function call")
+	}
+}
+
+func TestUnknownStopReasonIsReported(t *testing.T) {
+	var drifts []common.Drift
+	common.SetDriftHandler(func(d common.Drift) { drifts = append(drifts, d) })
+	defer common.SetDriftHandler(nil)
+
+	var message anthropic.Message
+	raw := `{"content":[{"type":"text","text":"Paris"},{"type":"citations_v9","data":{}}],"stop_reason":"refusal_v2","usage":{"input_tokens":5,"output_tokens":3},"new_field":true}`
+	if err := json.Unmarshal([]byte(raw), &message); err != nil {
+		t.Fatalf("Unmarshal failed: %v", err)
+	}
+
+	response := anthropicResponseToLLMResponse(&message)
+	if response.Content.Message != "Paris" {
+		t.Errorf("Expected known blocks to be kept, got %q", response.Content.Message)
+	}
+
+	reported := make(map[string]string)
+	for _, d := range drifts {
+		reported[d.Field] = d.Value
+	}
+	if reported["stop_reason"] != "refusal_v2" || reported["content.type"] != "citations_v9" {
+		t.Errorf("Expected unknown enum values to be reported, got %+v", drifts)
+	}
+	if _, ok := reported["new_field"]; !ok {
+		t.Errorf("Expected unknown field to be reported, got %+v", drifts)
+	}
+}
+
+func TestClassifyError(t *testing.T) {
+	testCases := []struct {
+		status int
+		body   string
+		class  error
+	}{
+		{529, `{"type":"error","error":{"type":"overloaded_error","message":"Overloaded"}}`, common.ErrProviderUnavailable},
+		{429, `{"type":"error","error":{"type":"rate_limit_error","message":"Slow down"}}`, common.ErrRateLimited},
+		{401, `{"type":"error","error":{"type":"authentication_error","message":"invalid x-api-key"}}`, common.ErrAuth},
+		{400, `{"type":"error","error":{"type":"invalid_request_error","message":"prompt is too long: 210000 tokens > 200000 maximum"}}`, common.ErrContextLengthExceeded},
+	}
+
+	for _, tc := range testCases {
+		apiErr := &anthropic.Error{StatusCode: tc.status}
+		if err := apiErr.UnmarshalJSON([]byte(tc.body)); err != nil {
+			t.Fatalf("UnmarshalJSON failed: %v", err)
+		}
+		apiErr.StatusCode = tc.status
+
+		err := classifyError(apiErr)
+		if !errors.Is(err, tc.class) {
+			t.Errorf("Status %d: expected %v, got %v", tc.status, tc.class, err)
+		}
+		var target *anthropic.Error
+		if !errors.As(err, &target) {
+			t.Errorf("Status %d: expected the SDK error to stay reachable", tc.status)
+		}
+	}
+}
+
+func TestRequestDump(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"id":"msg_1","type":"message","role":"assistant","model":"claude-3-haiku-20240307",`+
+			`"content":[{"type":"text","text":"Hi"}],"stop_reason":"end_turn","usage":{"input_tokens":3,"output_tokens":1}}`)
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	client, err := NewAnthropicClient("claude-3-haiku",
+		common.WithAPIKey("test-api-key"),
+		common.WithEndpoint(server.URL),
+		common.WithRequestDump(dir))
+	if err != nil {
+		t.Fatalf("NewAnthropicClient failed: %v", err)
+	}
+
+	request := &models.LLMRequest{
+		Model:    "claude-3-haiku",
+		Contents: []models.Content{{Role: "user", Message: "Hello"}},
+		Config:   &models.GenerateContentConfig{Temperature: 0.3},
+	}
+	if _, err := client.Call(nexenctx.WithRequestID(context.Background(), "req-1"), request); err != nil {
+		t.Fatalf("Call failed: %v", err)
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, "req-1.json"))
+	if err != nil {
+		t.Fatalf("Expected a request dump: %v", err)
+	}
+	dump := string(data)
+	if strings.Contains(dump, "test-api-key") {
+		t.Errorf("Dump contains the API key:\n%s", dump)
+	}
+	if !strings.Contains(dump, `"temperature":0.3`) || !strings.Contains(dump, `/v1/messages"`) {
+		t.Errorf("Expected the wire-format request in the dump:\n%s", dump)
+	}
+}
+
+func TestCountTokens(t *testing.T) {
+	var body map[string]any
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/messages/count_tokens" {
+			t.Errorf("Unexpected path %s", r.URL.Path)
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"input_tokens":14}`)
+	}))
+	defer server.Close()
+
+	client, err := NewAnthropicClient("claude-3-haiku", common.WithAPIKey("test-api-key"), common.WithEndpoint(server.URL))
+	if err != nil {
+		t.Fatalf("NewAnthropicClient failed: %v", err)
+	}
+	counter := client.(common.TokenCounter)
+
+	n, err := counter.CountTokens("claude-3-haiku", []models.Content{{Role: "user", Message: "Hello"}})
+	if err != nil || n != 14 {
+		t.Fatalf("Expected 14 tokens, got %d, %v", n, err)
+	}
+	if body["model"] != "claude-3-haiku-20240307" {
+		t.Errorf("Expected the resolved model in the request, got %v", body["model"])
+	}
+}
+
+func TestCacheBreakpoints(t *testing.T) {
+	client := &AnthropicClient{modelName: "claude-3-sonnet"}
+	request := &models.LLMRequest{
+		Contents: []models.Content{
+			{Role: "user", Message: "Here is the contract: ...", CacheBreakpoint: true},
+			{Role: "assistant", Message: "Got it."},
+			{Role: "user", Message: "Who are the parties?"},
+		},
+		Config: &models.GenerateContentConfig{SystemInstruction: "You review contracts.", CacheSystemInstruction: true},
+	}
+	params := client.messageParams(request)
+
+	if params.System[0].CacheControl.Type != "ephemeral" {
+		t.Error("Expected a breakpoint on the system prompt")
+	}
+	if *params.Messages[0].Content[0].GetCacheControl() != anthropic.NewCacheControlEphemeralParam() {
+		t.Error("Expected a breakpoint on the marked message")
+	}
+	encoded, _ := json.Marshal(params)
+	if n := strings.Count(string(encoded), `"cache_control"`); n != 2 {
+		t.Errorf("Expected 2 breakpoints, got %d in %s", n, encoded)
+	}
+
+	// Only the latest breakpoints fit Anthropic's limit
+	for i := range request.Contents {
+		request.Contents[i].CacheBreakpoint = true
+	}
+	request.Contents = append(request.Contents, models.Content{Role: "assistant", Message: "Acme and Globex.", CacheBreakpoint: true})
+	encoded, _ = json.Marshal(client.messageParams(request))
+	if n := strings.Count(string(encoded), `"cache_control"`); n != maxCacheBreakpoints {
+		t.Errorf("Expected %d breakpoints, got %d", maxCacheBreakpoints, n)
+	}
+}
+
+func TestCacheUsage(t *testing.T) {
+	var message anthropic.Message
+	json.Unmarshal([]byte(`{"id":"msg_1","type":"message","role":"assistant","content":[{"type":"text","text":"Hi"}],`+
+		`"stop_reason":"end_turn","usage":{"input_tokens":10,"cache_read_input_tokens":1000,"cache_creation_input_tokens":200,"output_tokens":5}}`), &message)
+
+	usage := anthropicResponseToLLMResponse(&message).Usage
+	if usage.PromptTokens != 1210 || usage.CachedPromptTokens != 1000 || usage.CacheWritePromptTokens != 200 || usage.TotalTokens != 1215 {
+		t.Errorf("Unexpected usage %+v", usage)
+	}
+}
+
+func TestJSONModeInstruction(t *testing.T) {
+	client := &AnthropicClient{modelName: "claude-3-sonnet"}
+	request := &models.LLMRequest{
+		Contents: []models.Content{{Role: "user", Message: "List three colors."}},
+		Config:   &models.GenerateContentConfig{SystemInstruction: "You are terse.", JSONMode: true},
+	}
+	params := client.messageParams(request)
+	if len(params.System) != 2 || params.System[1].Text != models.JSONModeInstruction {
+		t.Errorf("Expected the JSON instruction after the system prompt, got %+v", params.System)
+	}
+}
+
+func TestMetadataUserID(t *testing.T) {
+	client := &AnthropicClient{modelName: "claude-3-sonnet"}
+	request := &models.LLMRequest{
+		Contents: []models.Content{{Role: "user", Message: "Hi"}},
+		Metadata: models.RequestMetadata{UserID: "u-42"},
+	}
+	if params := client.messageParams(request); params.Metadata.UserID.Value != "u-42" {
+		t.Errorf("Expected metadata user_id u-42, got %+v", params.Metadata)
+	}
+}
+
+func TestServiceTier(t *testing.T) {
+	var sent []any
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]any
+		json.NewDecoder(r.Body).Decode(&body)
+		sent = append(sent, body["service_tier"])
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"id":"msg_1","type":"message","role":"assistant","model":"claude-3-haiku-20240307",`+
+			`"content":[{"type":"text","text":"Hi"}],"stop_reason":"end_turn","usage":{"input_tokens":3,"output_tokens":1,"service_tier":"priority"}}`)
+	}))
+	defer server.Close()
+
+	client, err := NewAnthropicClient("claude-3-haiku",
+		common.WithAPIKey("test-api-key"),
+		common.WithEndpoint(server.URL),
+		common.WithServiceTier(models.ServiceTierPriority))
+	if err != nil {
+		t.Fatalf("NewAnthropicClient failed: %v", err)
+	}
+	request := &models.LLMRequest{Model: "claude-3-haiku", Contents: []models.Content{{Role: "user", Message: "Hello"}}}
+	response, err := client.Call(context.Background(), request)
+	if err != nil {
+		t.Fatalf("Call failed: %v", err)
+	}
+	if response.CustomMetadata[common.MetadataServiceTier] != models.ServiceTierPriority {
+		t.Errorf("Expected the serving tier in CustomMetadata, got %v", response.CustomMetadata)
+	}
+
+	request.Config = &models.GenerateContentConfig{ServiceTier: models.ServiceTierDefault}
+	if _, err := client.Call(context.Background(), request); err != nil {
+		t.Fatalf("Call failed: %v", err)
+	}
+	if len(sent) != 2 || sent[0] != "auto" || sent[1] != "standard_only" {
+		t.Errorf("Sent service tiers %v, want [auto standard_only]", sent)
+	}
+}
+
+func TestPing(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/models" || r.URL.Query().Get("limit") != "1" {
+			t.Errorf("Expected a single model listed, got %s", r.URL)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if r.Header.Get("X-Api-Key") != "test-api-key" {
+			w.WriteHeader(http.StatusUnauthorized)
+			fmt.Fprint(w, `{"type":"error","error":{"type":"authentication_error","message":"invalid x-api-key"}}`)
+			return
+		}
+		fmt.Fprint(w, `{"data":[{"type":"model","id":"claude-3-5-sonnet-20241022"}],"has_more":true,"first_id":"claude-3-5-sonnet-20241022","last_id":"claude-3-5-sonnet-20241022"}`)
+	}))
+	defer server.Close()
+
+	for _, key := range []string{"test-api-key", "revoked-key"} {
+		client, err := NewAnthropicClient("claude-3-haiku", common.WithAPIKey(key), common.WithEndpoint(server.URL))
+		if err != nil {
+			t.Fatalf("NewAnthropicClient failed: %v", err)
+		}
+		err = client.(common.Pinger).Ping(context.Background())
+		if key == "revoked-key" {
+			if !errors.Is(err, common.ErrAuth) {
+				t.Errorf("Expected an authentication error, got %v", err)
+			}
+		} else if err != nil {
+			t.Errorf("Ping() error = %v", err)
+		}
+	}
+}
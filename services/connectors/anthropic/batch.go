@@ -0,0 +1,206 @@
+package anthropic
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/anthropics/anthropic-sdk-go"
+
+	"github.com/nexen/models"
+	"github.com/nexen/services/connectors/common"
+)
+
+const (
+	// BatchThresholdOption is the CustomOptions key for the smallest BatchCall that is sent
+	// through the Message Batches API. Zero, the default, always sends concurrent Calls.
+	BatchThresholdOption = "anthropic.batch_threshold"
+
+	// BatchPollIntervalOption is the CustomOptions key for how often a submitted batch is
+	// checked for completion.
+	BatchPollIntervalOption = "anthropic.batch_poll_interval"
+
+	// BatchIDMetadataKey is the CustomMetadata key holding the ID of the batch a response
+	// came from.
+	BatchIDMetadataKey = "anthropic_batch_id"
+
+	// BatchAPIFlag is the feature flag gating the Message Batches API when the client has a
+	// feature gate (see common.WithFeatureGate).
+	BatchAPIFlag = "anthropic_batch_api"
+
+	// BatchDiscount is the fraction of the standard price Anthropic charges for batch requests.
+	BatchDiscount = 0.5
+
+	defaultBatchPollInterval = 30 * time.Second
+)
+
+// WithBatchThreshold sends batches of at least n requests through the Message Batches API.
+// Batches are billed at a discount but can take up to 24 hours to complete.
+func WithBatchThreshold(n int) common.Option {
+	return common.WithCustomOption(BatchThresholdOption, n)
+}
+
+// WithBatchPollInterval sets how often a submitted message batch is checked for completion.
+func WithBatchPollInterval(interval time.Duration) common.Option {
+	return common.WithCustomOption(BatchPollIntervalOption, interval)
+}
+
+func (c *AnthropicClient) batchThreshold() int {
+	threshold, _ := c.config.CustomOptions[BatchThresholdOption].(int)
+	return threshold
+}
+
+func (c *AnthropicClient) batchPollInterval() time.Duration {
+	if interval, ok := c.config.CustomOptions[BatchPollIntervalOption].(time.Duration); ok && interval > 0 {
+		return interval
+	}
+	return defaultBatchPollInterval
+}
+
+// messageBatch submits requests as one message batch, waits for it to end, and returns one
+// result per request. Requests that fail validation are not submitted, and requests that
+// errored, expired or were canceled fail individually while the others succeed. If ctx is
+// done before the batch ends, the batch is canceled.
+func (c *AnthropicClient) messageBatch(ctx context.Context, requests []*models.LLMRequest) []common.Result {
+	results := make([]common.Result, len(requests))
+	// fail sets err on every request that has no result yet
+	fail := func(err error) []common.Result {
+		for i := range results {
+			if results[i].Err == nil && results[i].Response == nil {
+				results[i].Err = err
+			}
+		}
+		return results
+	}
+
+	params := anthropic.MessageBatchNewParams{}
+	for i, request := range requests {
+		if err := request.Validate(); err != nil {
+			results[i].Err = fmt.Errorf("invalid request: %w", err)
+			continue
+		}
+		params.Requests = append(params.Requests, anthropic.MessageBatchNewParamsRequest{
+			CustomID: strconv.Itoa(i),
+			Params:   batchRequestParams(c.messageParams(request)),
+		})
+	}
+	if len(params.Requests) == 0 {
+		return results
+	}
+
+	var batch *anthropic.MessageBatch
+	err := common.DoWithRetry(ctx, c.config.RetryConfig, func(ctx context.Context) error {
+		var err error
+		batch, err = c.client.Messages.Batches.New(ctx, params)
+		if err != nil {
+			return classifyError(err)
+		}
+		return nil
+	})
+	if err != nil {
+		return fail(err)
+	}
+
+	if err := c.waitForBatch(ctx, batch); err != nil {
+		return fail(err)
+	}
+
+	stream := c.client.Messages.Batches.ResultsStreaming(ctx, batch.ID)
+	defer stream.Close()
+	for stream.Next() {
+		item := stream.Current()
+		i, err := strconv.Atoi(item.CustomID)
+		if err != nil || i < 0 || i >= len(results) {
+			common.ReportDrift(common.Drift{Provider: models.ProviderAnthropic, Kind: common.DriftUnknownValue, Field: "custom_id", Value: item.CustomID})
+			continue
+		}
+		results[i] = c.batchResult(batch.ID, item.Result)
+	}
+	if err := stream.Err(); err != nil {
+		return fail(classifyError(err))
+	}
+	return fail(fmt.Errorf("message batch %s returned no result for the request", batch.ID))
+}
+
+// waitForBatch polls batch until it has ended. If ctx is done first, the batch is canceled
+// and ctx's error is returned.
+func (c *AnthropicClient) waitForBatch(ctx context.Context, batch *anthropic.MessageBatch) error {
+	ticker := time.NewTicker(c.batchPollInterval())
+	defer ticker.Stop()
+
+	id := batch.ID
+	for batch.ProcessingStatus != anthropic.MessageBatchProcessingStatusEnded {
+		select {
+		case <-ctx.Done():
+			// Don't leave work running that nobody will collect
+			c.client.Messages.Batches.Cancel(context.WithoutCancel(ctx), id)
+			return ctx.Err()
+		case <-ticker.C:
+		}
+
+		err := common.DoWithRetry(ctx, c.config.RetryConfig, func(ctx context.Context) error {
+			var err error
+			batch, err = c.client.Messages.Batches.Get(ctx, id)
+			if err != nil {
+				return classifyError(err)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		common.CheckValue(models.ProviderAnthropic, "processing_status", string(batch.ProcessingStatus), "in_progress", "canceling", "ended")
+	}
+	return nil
+}
+
+// batchResult converts one entry of a message batch's results.
+func (c *AnthropicClient) batchResult(batchID string, result anthropic.MessageBatchResultUnion) common.Result {
+	switch result := result.AsAny().(type) {
+	case anthropic.MessageBatchSucceededResult:
+		response := anthropicResponseToLLMResponse(&result.Message)
+		response.Usage.CostCents = c.batchCostCents(response.Usage)
+		if response.CustomMetadata == nil {
+			response.CustomMetadata = make(map[string]any)
+		}
+		response.CustomMetadata[BatchIDMetadataKey] = batchID
+		return common.Result{Response: response}
+	case anthropic.MessageBatchErroredResult:
+		return common.Result{Err: newProviderError(0, result.Error.Error.Type, result.Error.Error.Message)}
+	case anthropic.MessageBatchExpiredResult:
+		return common.Result{Err: fmt.Errorf("message batch %s expired before the request was processed", batchID)}
+	case anthropic.MessageBatchCanceledResult:
+		return common.Result{Err: fmt.Errorf("message batch %s was canceled before the request was processed", batchID)}
+	}
+	common.CheckValue(models.ProviderAnthropic, "result.type", result.Type, "succeeded", "errored", "expired", "canceled")
+	return common.Result{Err: fmt.Errorf("message batch %s returned unknown result type %q", batchID, result.Type)}
+}
+
+// batchCostCents prices usage at the model's registered prices with the batch discount
+// applied. It returns 0 for models without registered pricing.
+func (c *AnthropicClient) batchCostCents(usage models.UsageMetrics) float64 {
+	cost, err := models.EstimateCost(c.modelName, usage)
+	if err != nil {
+		return 0
+	}
+	return cost * BatchDiscount
+}
+
+// batchRequestParams copies Messages API parameters into a message batch request.
+func batchRequestParams(p anthropic.MessageNewParams) anthropic.MessageBatchNewParamsRequestParams {
+	return anthropic.MessageBatchNewParamsRequestParams{
+		MaxTokens:     p.MaxTokens,
+		Messages:      p.Messages,
+		Model:         p.Model,
+		Temperature:   p.Temperature,
+		TopK:          p.TopK,
+		TopP:          p.TopP,
+		Metadata:      p.Metadata,
+		StopSequences: p.StopSequences,
+		System:        p.System,
+		Thinking:      p.Thinking,
+		ToolChoice:    p.ToolChoice,
+		Tools:         p.Tools,
+	}
+}
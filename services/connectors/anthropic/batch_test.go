@@ -0,0 +1,153 @@
+package anthropic
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/nexen/models"
+	"github.com/nexen/services/connectors/common"
+)
+
+// fakeBatchServer serves the Message Batches endpoints. The batch is in progress for the
+// first status check and ended afterwards.
+func fakeBatchServer(t *testing.T, results string) (*httptest.Server, *atomic.Int32) {
+	var polls atomic.Int32
+	batch := func(status string) string {
+		return fmt.Sprintf(`{"id":"msgbatch_1","type":"message_batch","processing_status":%q,"request_counts":{}}`, status)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v1/messages/batches", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		var body struct {
+			Requests []struct {
+				CustomID string `json:"custom_id"`
+			} `json:"requests"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil || len(body.Requests) == 0 {
+			t.Errorf("Unexpected batch body: %v", err)
+		}
+		fmt.Fprint(w, batch("in_progress"))
+	})
+	mux.HandleFunc("/v1/messages/batches/msgbatch_1", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if polls.Add(1) == 1 {
+			fmt.Fprint(w, batch("in_progress"))
+			return
+		}
+		fmt.Fprint(w, batch("ended"))
+	})
+	mux.HandleFunc("/v1/messages/batches/msgbatch_1/results", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/x-jsonl")
+		fmt.Fprint(w, results)
+	})
+	mux.HandleFunc("/v1/messages/batches/msgbatch_1/cancel", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, batch("canceling"))
+	})
+
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return server, &polls
+}
+
+func newBatchTestClient(t *testing.T, endpoint string) *AnthropicClient {
+	client, err := NewAnthropicClient("claude-3-haiku",
+		common.WithAPIKey("test-api-key"),
+		common.WithEndpoint(endpoint),
+		WithBatchThreshold(2),
+		WithBatchPollInterval(time.Millisecond))
+	if err != nil {
+		t.Fatalf("NewAnthropicClient failed: %v", err)
+	}
+	return client.(*AnthropicClient)
+}
+
+func batchTestRequests(n int) []*models.LLMRequest {
+	requests := make([]*models.LLMRequest, n)
+	for i := range requests {
+		requests[i] = &models.LLMRequest{Model: "claude-3-haiku", Contents: []models.Content{{Role: "user", Message: fmt.Sprintf("question %d", i)}}}
+	}
+	return requests
+}
+
+func TestBatchCallUsesMessageBatches(t *testing.T) {
+	if err := models.Register("^claude-3-haiku$", models.ModelInfo{Provider: models.ProviderAnthropic, CostPerToken: 0.01}); err != nil {
+		t.Fatal(err)
+	}
+
+	results := `{"custom_id":"2","result":{"type":"expired"}}
+{"custom_id":"0","result":{"type":"succeeded","message":{"id":"msg_1","type":"message","role":"assistant","content":[{"type":"text","text":"Paris"}],"stop_reason":"end_turn","usage":{"input_tokens":10,"output_tokens":10}}}}
+{"custom_id":"1","result":{"type":"errored","error":{"type":"error","error":{"type":"overloaded_error","message":"Overloaded"}}}}
+`
+	server, polls := fakeBatchServer(t, results)
+	client := newBatchTestClient(t, server.URL)
+
+	responses, err := client.BatchCall(context.Background(), batchTestRequests(3))
+	var batchErr *common.BatchError
+	if !errors.As(err, &batchErr) || len(batchErr.Errors) != 2 {
+		t.Fatalf("Expected two failed requests, got %v", err)
+	}
+	if !errors.Is(batchErr.Errors[1], common.ErrProviderUnavailable) || batchErr.Errors[2] == nil {
+		t.Errorf("Unexpected per-request errors %v", batchErr.Errors)
+	}
+	if polls.Load() != 2 {
+		t.Errorf("Expected the batch to be polled until it ended, got %d polls", polls.Load())
+	}
+
+	response := responses[0]
+	if response == nil || response.Content.Message != "Paris" {
+		t.Fatalf("Expected the succeeded request's response, got %+v", response)
+	}
+	if response.CustomMetadata[BatchIDMetadataKey] != "msgbatch_1" {
+		t.Errorf("Expected batch ID in metadata, got %v", response.CustomMetadata)
+	}
+	// 20 tokens at 0.01 cents, half price
+	if math.Abs(response.Usage.CostCents-0.1) > 1e-9 {
+		t.Errorf("Expected discounted cost 0.1, got %v", response.Usage.CostCents)
+	}
+}
+
+func TestBatchCallCancelsBatchOnContextDone(t *testing.T) {
+	server, _ := fakeBatchServer(t, "")
+	client := newBatchTestClient(t, server.URL)
+	client.config.CustomOptions[BatchPollIntervalOption] = time.Hour
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	_, err := client.BatchCall(ctx, batchTestRequests(2))
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected deadline error, got %v", err)
+	}
+}
+
+func TestBatchCallFeatureGate(t *testing.T) {
+	server, polls := fakeBatchServer(t, "")
+	client := newBatchTestClient(t, server.URL)
+	var gated []string
+	client.config.FeatureGate = func(ctx context.Context, name string) bool {
+		gated = append(gated, name)
+		return false
+	}
+
+	// With the flag off the requests go to the Messages API, which the fake server lacks
+	_, err := client.BatchCall(context.Background(), batchTestRequests(2))
+	var batchErr *common.BatchError
+	if !errors.As(err, &batchErr) || len(batchErr.Errors) != 2 {
+		t.Errorf("Expected individual calls to fail, got %v", err)
+	}
+	if polls.Load() != 0 {
+		t.Error("Expected no message batch while the flag is off")
+	}
+	if len(gated) != 1 || gated[0] != BatchAPIFlag {
+		t.Errorf("Expected the gate to be asked about %s, got %v", BatchAPIFlag, gated)
+	}
+}
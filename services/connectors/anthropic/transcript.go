@@ -0,0 +1,151 @@
+package anthropic
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/anthropics/anthropic-sdk-go"
+
+	"github.com/nexen/models"
+)
+
+// conversation is the part of a Messages API request body that holds a conversation.
+type conversation struct {
+	System   string                   `json:"system,omitempty"`
+	Messages []anthropic.MessageParam `json:"messages"`
+}
+
+// ExportConversation encodes a conversation as an Anthropic Messages API body with "system"
+// and "messages" fields. Function calls become tool_use blocks and function results become
+// tool_result blocks in user messages.
+func ExportConversation(contents []models.Content, systemInstruction string) ([]byte, error) {
+	return json.Marshal(conversation{System: systemInstruction, Messages: contentToMessageParams(contents)})
+}
+
+// transcriptMessage is a message as found in Anthropic transcripts, whose content may be a
+// string or an array of content blocks.
+type transcriptMessage struct {
+	Role    string          `json:"role"`
+	Content json.RawMessage `json:"content"`
+}
+
+// transcriptBlock is a content block of a transcript message.
+type transcriptBlock struct {
+	Type      string          `json:"type"`
+	Text      string          `json:"text"`
+	ID        string          `json:"id"`
+	Name      string          `json:"name"`
+	Input     map[string]any  `json:"input"`
+	ToolUseID string          `json:"tool_use_id"`
+	Content   json.RawMessage `json:"content"`
+	IsError   bool            `json:"is_error"`
+}
+
+// ImportConversation decodes an Anthropic Messages API body, or a bare messages array, into
+// contents and the system instruction. tool_result blocks become a "tool" content of
+// function responses; text in the same user message follows as a separate user content.
+func ImportConversation(data []byte) ([]models.Content, string, error) {
+	var body struct {
+		System   json.RawMessage     `json:"system"`
+		Messages []transcriptMessage `json:"messages"`
+	}
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '[' {
+		if err := json.Unmarshal(data, &body.Messages); err != nil {
+			return nil, "", fmt.Errorf("decoding Anthropic conversation: %w", err)
+		}
+	} else if err := json.Unmarshal(data, &body); err != nil {
+		return nil, "", fmt.Errorf("decoding Anthropic conversation: %w", err)
+	}
+
+	system, err := blocksText(body.System)
+	if err != nil {
+		return nil, "", fmt.Errorf("system: %w", err)
+	}
+
+	var contents []models.Content
+	callNames := make(map[string]string)
+	for i, message := range body.Messages {
+		if message.Role != "user" && message.Role != "assistant" {
+			return nil, "", fmt.Errorf("message %d: unknown role %q", i, message.Role)
+		}
+		blocks, err := messageBlocks(message.Content)
+		if err != nil {
+			return nil, "", fmt.Errorf("message %d: %w", i, err)
+		}
+
+		var text strings.Builder
+		var parts, results []any
+		hasCalls := false
+		for _, block := range blocks {
+			switch block.Type {
+			case "text":
+				text.WriteString(block.Text)
+				parts = append(parts, block.Text)
+			case "tool_use":
+				callNames[block.ID] = block.Name
+				parts = append(parts, models.NewFunctionCallPart(models.FunctionCall{ID: block.ID, Name: block.Name, Args: block.Input}))
+				hasCalls = true
+			case "tool_result":
+				result, err := blocksText(block.Content)
+				if err != nil {
+					return nil, "", fmt.Errorf("message %d: tool result %s: %w", i, block.ToolUseID, err)
+				}
+				results = append(results, models.NewFunctionResponsePart(models.FunctionResponse{
+					ID:       block.ToolUseID,
+					Name:     callNames[block.ToolUseID],
+					Response: result,
+					IsError:  block.IsError,
+				}))
+			default:
+				return nil, "", fmt.Errorf("message %d: content block type %q is not supported", i, block.Type)
+			}
+		}
+
+		if len(results) > 0 {
+			contents = append(contents, models.Content{Role: "tool", Parts: results})
+		}
+		if text.Len() > 0 || hasCalls {
+			content := models.Content{Role: message.Role, Message: text.String()}
+			if hasCalls {
+				content.Parts = parts
+			}
+			contents = append(contents, content)
+		}
+	}
+	return contents, system, nil
+}
+
+// messageBlocks returns the content blocks of a message whose content may be a string.
+func messageBlocks(raw json.RawMessage) ([]transcriptBlock, error) {
+	var text string
+	if err := json.Unmarshal(raw, &text); err == nil {
+		return []transcriptBlock{{Type: "text", Text: text}}, nil
+	}
+	var blocks []transcriptBlock
+	if err := json.Unmarshal(raw, &blocks); err != nil {
+		return nil, fmt.Errorf("content is neither text nor content blocks")
+	}
+	return blocks, nil
+}
+
+// blocksText returns the text of a string or an array of text blocks, as used by "system"
+// and tool_result content.
+func blocksText(raw json.RawMessage) (string, error) {
+	if len(raw) == 0 || string(raw) == "null" {
+		return "", nil
+	}
+	blocks, err := messageBlocks(raw)
+	if err != nil {
+		return "", err
+	}
+	var sb strings.Builder
+	for _, block := range blocks {
+		if block.Type != "text" {
+			return "", fmt.Errorf("content block type %q is not supported", block.Type)
+		}
+		sb.WriteString(block.Text)
+	}
+	return sb.String(), nil
+}
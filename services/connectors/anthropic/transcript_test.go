@@ -0,0 +1,59 @@
+package anthropic
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/nexen/models"
+)
+
+func weatherConversation() []models.Content {
+	return []models.Content{
+		{Role: "user", Message: "What's the weather in Paris?"},
+		{Role: "assistant", Parts: []any{models.NewFunctionCallPart(models.FunctionCall{ID: "call_1", Name: "get_weather", Args: map[string]any{"city": "Paris"}})}},
+		{Role: "tool", Parts: []any{models.NewFunctionResponsePart(models.FunctionResponse{ID: "call_1", Name: "get_weather", Response: "sunny"})}},
+		{Role: "assistant", Message: "It's sunny."},
+	}
+}
+
+func TestConversationRoundTrip(t *testing.T) {
+	data, err := ExportConversation(weatherConversation(), "Be brief.")
+	if err != nil {
+		t.Fatalf("ExportConversation failed: %v", err)
+	}
+	contents, system, err := ImportConversation(data)
+	if err != nil {
+		t.Fatalf("ImportConversation failed: %v", err)
+	}
+	if system != "Be brief." {
+		t.Errorf("Expected system instruction, got %q", system)
+	}
+	if !reflect.DeepEqual(contents, weatherConversation()) {
+		t.Errorf("Round trip changed the conversation:\n got %#v\nwant %#v\nJSON %s", contents, weatherConversation(), data)
+	}
+}
+
+func TestImportAnthropicConversation(t *testing.T) {
+	data := `{"model":"claude-3-haiku","system":[{"type":"text","text":"Be brief."}],"messages":[
+		{"role":"user","content":"Weather in Paris?"},
+		{"role":"assistant","content":[{"type":"text","text":"Checking."},{"type":"tool_use","id":"toolu_1","name":"get_weather","input":{"city":"Paris"}}]},
+		{"role":"user","content":[{"type":"tool_result","tool_use_id":"toolu_1","content":"unavailable","is_error":true},{"type":"text","text":"Guess then."}]}]}`
+
+	contents, system, err := ImportConversation([]byte(data))
+	if err != nil {
+		t.Fatalf("ImportConversation failed: %v", err)
+	}
+	if system != "Be brief." || len(contents) != 4 {
+		t.Fatalf("Unexpected import: %q, %#v", system, contents)
+	}
+	if calls := contents[1].FunctionCalls(); contents[1].Message != "Checking." || len(calls) != 1 || calls[0].Args["city"] != "Paris" {
+		t.Errorf("Unexpected assistant content %#v", contents[1])
+	}
+	result, _ := contents[2].Parts[0].(map[string]any)[models.PartFunctionResponse].(map[string]any)
+	if contents[2].Role != "tool" || result["name"] != "get_weather" || result["isError"] != true {
+		t.Errorf("Unexpected tool result %#v", contents[2])
+	}
+	if contents[3].Role != "user" || contents[3].Message != "Guess then." {
+		t.Errorf("Expected trailing text as a user message, got %#v", contents[3])
+	}
+}
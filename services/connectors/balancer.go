@@ -0,0 +1,280 @@
+package connectors
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nexen/models"
+	"github.com/nexen/services/connectors/common"
+)
+
+// MetadataDeployment is the CustomMetadata key holding the name of the deployment a
+// BalancedLLM sent the request to.
+const MetadataDeployment = "deployment"
+
+// Policies choosing the deployment of a BalancedLLM, as in the deployments.<model>.policy
+// config setting.
+const (
+	BalanceWeightedRoundRobin = "weighted_round_robin" // spread requests in proportion to the weights
+	BalanceLeastOutstanding   = "least_outstanding"    // fewest requests in flight, relative to the weights
+)
+
+// Deployment is one of several equivalent endpoints serving the same model, such as two Azure
+// deployments and the provider's own API.
+type Deployment struct {
+	// Name identifies the deployment in metadata and health statistics. It must be unique.
+	Name string
+
+	LLM LLM
+
+	// Weight is the share of requests the deployment gets relative to the others. Zero means 1.
+	Weight int
+}
+
+// DeploymentSettings are the endpoint and key of a deployment, as in the
+// deployments.<model>.endpoints config settings. Empty fields keep the provider's endpoint and
+// key.
+type DeploymentSettings struct {
+	Name     string
+	Endpoint string
+	APIKey   string
+	Weight   int
+}
+
+// options returns the options pointing a client at the deployment.
+func (s DeploymentSettings) options() []Option {
+	var opts []Option
+	if s.Endpoint != "" {
+		opts = append(opts, common.WithEndpoint(s.Endpoint))
+	}
+	if s.APIKey != "" {
+		opts = append(opts, common.WithAPIKey(s.APIKey))
+	}
+	return opts
+}
+
+// modelDeployments are the deployments of a model set with SetDeployments. Guarded by
+// settingsMu.
+type modelDeployments struct {
+	policy   string
+	settings []DeploymentSettings
+}
+
+var deploymentsByModel = make(map[string]modelDeployments)
+
+// SetDeployments makes NewLLM spread the requests of model over deployments by policy, e.g.
+// from the deployments.<model> config settings, as the gateway does at startup. An empty policy
+// is BalanceWeightedRoundRobin. Clients created afterwards use the deployments; pooled clients
+// are rebuilt on next use.
+func SetDeployments(model, policy string, deployments []DeploymentSettings) error {
+	if policy == "" {
+		policy = BalanceWeightedRoundRobin
+	}
+	policy = strings.ToLower(policy)
+	if err := validateDeployments(policy, len(deployments), func(i int) (string, int) {
+		return deployments[i].Name, deployments[i].Weight
+	}); err != nil {
+		return err
+	}
+	settingsMu.Lock()
+	defer settingsMu.Unlock()
+	deploymentsByModel[model] = modelDeployments{policy: policy, settings: append([]DeploymentSettings(nil), deployments...)}
+	settingsVersion++
+	return nil
+}
+
+// DeleteDeployments removes the deployments of model, so that its clients use the provider's
+// endpoint again.
+func DeleteDeployments(model string) {
+	settingsMu.Lock()
+	defer settingsMu.Unlock()
+	if _, ok := deploymentsByModel[model]; ok {
+		delete(deploymentsByModel, model)
+		settingsVersion++
+	}
+}
+
+// deploymentsOf returns the deployments of model set with SetDeployments.
+func deploymentsOf(model string) (modelDeployments, bool) {
+	settingsMu.RLock()
+	defer settingsMu.RUnlock()
+	d, ok := deploymentsByModel[model]
+	return d, ok
+}
+
+// NewDeployments creates a client of model for each of settings with its constructor, with
+// the deployment's endpoint and API key added to opts. The clients are not wrapped with Meter
+// or middleware; NewLLM wraps the BalancedLLM of a model's deployments instead.
+func NewDeployments(model string, settings []DeploymentSettings, opts ...Option) ([]Deployment, error) {
+	ctor, err := Resolve(model)
+	if err != nil {
+		return nil, err
+	}
+	deployments := make([]Deployment, 0, len(settings))
+	for _, s := range settings {
+		llm, err := ctor(model, append(opts[:len(opts):len(opts)], s.options()...)...)
+		if err != nil {
+			return nil, fmt.Errorf("deployment %s: %w", s.Name, err)
+		}
+		deployments = append(deployments, Deployment{Name: s.Name, LLM: llm, Weight: s.Weight})
+	}
+	return deployments, nil
+}
+
+// validateDeployments checks the policy and the names and weights of n deployments.
+func validateDeployments(policy string, n int, deployment func(i int) (name string, weight int)) error {
+	switch policy {
+	case BalanceWeightedRoundRobin, BalanceLeastOutstanding:
+	default:
+		return fmt.Errorf("unknown load balancing policy %q", policy)
+	}
+	if n == 0 {
+		return fmt.Errorf("no deployments to balance")
+	}
+	seen := make(map[string]bool, n)
+	for i := 0; i < n; i++ {
+		name, weight := deployment(i)
+		if name == "" || seen[name] {
+			return fmt.Errorf("deployment names must be unique and not empty, got %q", name)
+		}
+		if weight < 0 {
+			return fmt.Errorf("deployment %s has negative weight %d", name, weight)
+		}
+		seen[name] = true
+	}
+	return nil
+}
+
+// balancedDeployment is a Deployment with its balancing state. Guarded by BalancedLLM.mu.
+type balancedDeployment struct {
+	Deployment
+	current     int // smooth weighted round-robin counter
+	outstanding int
+}
+
+// BalancedLLM spreads requests for one model over equivalent deployments by a balancing
+// policy. Deployments its health tracker considers unhealthy are ejected: they get no
+// requests until they recover, unless every deployment is unhealthy. Failed requests are not
+// retried on another deployment; wrap the BalancedLLM in a FallbackLLM or retry for that.
+type BalancedLLM struct {
+	policy      string
+	health      *HealthTracker
+	mu          sync.Mutex
+	deployments []*balancedDeployment
+}
+
+// NewBalancedLLM returns an LLM balancing requests over deployments by policy, either
+// BalanceWeightedRoundRobin or BalanceLeastOutstanding. Deployment health is tracked by a
+// HealthTracker with the default options, keyed by deployment name.
+func NewBalancedLLM(policy string, deployments ...Deployment) (*BalancedLLM, error) {
+	policy = strings.ToLower(policy)
+	if err := validateDeployments(policy, len(deployments), func(i int) (string, int) {
+		return deployments[i].Name, deployments[i].Weight
+	}); err != nil {
+		return nil, err
+	}
+
+	b := &BalancedLLM{policy: policy, health: NewHealthTracker(HealthOptions{})}
+	for _, d := range deployments {
+		if d.Weight == 0 {
+			d.Weight = 1
+		}
+		b.deployments = append(b.deployments, &balancedDeployment{Deployment: d})
+	}
+	return b, nil
+}
+
+// Health returns the tracker of the deployments' latency and errors, keyed by deployment name.
+func (b *BalancedLLM) Health() *HealthTracker {
+	return b.health
+}
+
+// Call implements the LLM interface Call method. The deployment used is recorded in the
+// response's CustomMetadata under MetadataDeployment.
+func (b *BalancedLLM) Call(ctx context.Context, request *models.LLMRequest) (*models.LLMResponse, error) {
+	d := b.pick()
+	defer b.done(d)
+
+	start := time.Now()
+	response, err := d.LLM.Call(ctx, request)
+	b.health.Observe(d.Name, time.Since(start), err)
+	if err != nil {
+		return nil, fmt.Errorf("deployment %s: %w", d.Name, err)
+	}
+	if response.CustomMetadata == nil {
+		response.CustomMetadata = make(map[string]any)
+	}
+	response.CustomMetadata[MetadataDeployment] = d.Name
+	return response, nil
+}
+
+// pick chooses the deployment of the next request by the policy, among the healthy ones, and
+// counts the request as outstanding on it.
+func (b *BalancedLLM) pick() *balancedDeployment {
+	candidates := make([]*balancedDeployment, 0, len(b.deployments))
+	for _, d := range b.deployments {
+		if b.health.Healthy(d.Name) {
+			candidates = append(candidates, d)
+		}
+	}
+	if len(candidates) == 0 {
+		candidates = b.deployments
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	var chosen *balancedDeployment
+	switch b.policy {
+	case BalanceLeastOutstanding:
+		// Compare outstanding/weight without dividing
+		for _, d := range candidates {
+			if chosen == nil || d.outstanding*chosen.Weight < chosen.outstanding*d.Weight {
+				chosen = d
+			}
+		}
+	default:
+		// Smooth weighted round-robin: every candidate gains its weight, and the one with the
+		// highest counter is chosen and loses the total, which interleaves the deployments.
+		total := 0
+		for _, d := range candidates {
+			d.current += d.Weight
+			total += d.Weight
+			if chosen == nil || d.current > chosen.current {
+				chosen = d
+			}
+		}
+		chosen.current -= total
+	}
+	chosen.outstanding++
+	return chosen
+}
+
+// done ends an outstanding request on d.
+func (b *BalancedLLM) done(d *balancedDeployment) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	d.outstanding--
+}
+
+// BatchCall implements the LLM interface BatchCall method.
+func (b *BalancedLLM) BatchCall(ctx context.Context, requests []*models.LLMRequest) ([]*models.LLMResponse, error) {
+	return common.BatchCall(ctx, requests, common.DefaultBatchConcurrency, b.Call)
+}
+
+// SupportedModels returns the models supported by any deployment.
+func (b *BalancedLLM) SupportedModels() []string {
+	seen := make(map[string]bool)
+	var supported []string
+	for _, d := range b.deployments {
+		for _, model := range d.LLM.SupportedModels() {
+			if !seen[model] {
+				seen[model] = true
+				supported = append(supported, model)
+			}
+		}
+	}
+	return supported
+}
@@ -0,0 +1,169 @@
+package connectors
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/nexen/models"
+	"github.com/nexen/services/connectors/common"
+)
+
+func servedDeployments(t *testing.T, b *BalancedLLM, n int) string {
+	t.Helper()
+	var served []string
+	for i := 0; i < n; i++ {
+		response, err := b.Call(context.Background(), fallbackRequest())
+		if err != nil {
+			t.Fatalf("Call failed: %v", err)
+		}
+		served = append(served, response.CustomMetadata[MetadataDeployment].(string))
+	}
+	return strings.Join(served, " ")
+}
+
+func TestBalancedLLMWeightedRoundRobin(t *testing.T) {
+	b, err := NewBalancedLLM(BalanceWeightedRoundRobin,
+		Deployment{Name: "a", LLM: &namedLLM{model: "gpt-4o"}, Weight: 2},
+		Deployment{Name: "b", LLM: &namedLLM{model: "gpt-4o"}},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := servedDeployments(t, b, 6), "a b a a b a"; got != want {
+		t.Errorf("Expected deployments %q, got %q", want, got)
+	}
+}
+
+// blockingLLM holds calls until release is closed.
+type blockingLLM struct {
+	mockLLM
+	started chan struct{}
+	release chan struct{}
+}
+
+func (l *blockingLLM) Call(ctx context.Context, request *models.LLMRequest) (*models.LLMResponse, error) {
+	l.started <- struct{}{}
+	<-l.release
+	return &models.LLMResponse{}, nil
+}
+
+func TestBalancedLLMLeastOutstanding(t *testing.T) {
+	slow := &blockingLLM{started: make(chan struct{}), release: make(chan struct{})}
+	b, err := NewBalancedLLM(BalanceLeastOutstanding,
+		Deployment{Name: "slow", LLM: slow},
+		Deployment{Name: "fast", LLM: &namedLLM{model: "gpt-4o"}},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		b.Call(context.Background(), fallbackRequest())
+	}()
+	<-slow.started
+	if got := servedDeployments(t, b, 3); got != "fast fast fast" {
+		t.Errorf("Expected requests to avoid the busy deployment, got %q", got)
+	}
+	close(slow.release)
+	wg.Wait()
+}
+
+func TestBalancedLLMEjectsUnhealthyDeployments(t *testing.T) {
+	failing := &namedLLM{model: "gpt-4o", err: common.NewProviderError(models.ProviderOpenAI, 503, "unavailable", "down")}
+	b, err := NewBalancedLLM(BalanceWeightedRoundRobin,
+		Deployment{Name: "failing", LLM: failing},
+		Deployment{Name: "ok", LLM: &namedLLM{model: "gpt-4o"}},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 2*DefaultHealthMinSamples; i++ {
+		_, err := b.Call(context.Background(), fallbackRequest())
+		if err != nil && !errors.Is(err, common.ErrProviderUnavailable) {
+			t.Fatalf("Unexpected error %v", err)
+		}
+	}
+	calls := failing.calls
+	if got := servedDeployments(t, b, 4); got != "ok ok ok ok" {
+		t.Errorf("Expected the failing deployment to be ejected, got %q", got)
+	}
+	if failing.calls != calls {
+		t.Errorf("Expected no calls to the ejected deployment, got %d more", failing.calls-calls)
+	}
+	if stats, _ := b.Health().Stats("failing"); stats.Healthy {
+		t.Errorf("Expected the failing deployment to be unhealthy, got %+v", stats)
+	}
+}
+
+func TestNewBalancedLLMValidates(t *testing.T) {
+	llm := &namedLLM{model: "gpt-4o"}
+	testCases := map[string][]Deployment{
+		"no deployments":  nil,
+		"duplicate names": {{Name: "a", LLM: llm}, {Name: "a", LLM: llm}},
+		"empty name":      {{LLM: llm}},
+		"negative weight": {{Name: "a", LLM: llm, Weight: -1}},
+	}
+	for name, deployments := range testCases {
+		if _, err := NewBalancedLLM(BalanceLeastOutstanding, deployments...); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+	if _, err := NewBalancedLLM("random", Deployment{Name: "a", LLM: llm}); err == nil {
+		t.Error("Expected an error for an unknown policy")
+	}
+}
+
+func TestNewLLMBalancesSetDeployments(t *testing.T) {
+	Register("^deployprobe$", func(model string, opts ...common.Option) (common.LLM, error) {
+		var config common.LLMConfig
+		for _, opt := range opts {
+			if err := opt(&config); err != nil {
+				return nil, err
+			}
+		}
+		return &namedLLM{model: config.EndpointOverride}, nil
+	})
+	if err := SetDeployments("deployprobe", "random", []DeploymentSettings{{Name: "east"}}); err == nil {
+		t.Error("Expected an error for an unknown policy")
+	}
+	err := SetDeployments("deployprobe", "", []DeploymentSettings{
+		{Name: "east", Endpoint: "https://east.example.com"},
+		{Name: "west", Endpoint: "https://west.example.com"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer DeleteDeployments("deployprobe")
+
+	llm, err := NewLLM("deployprobe")
+	if err != nil {
+		t.Fatalf("NewLLM failed: %v", err)
+	}
+	var served []string
+	for i := 0; i < 2; i++ {
+		response, err := llm.Call(context.Background(), fallbackRequest())
+		if err != nil {
+			t.Fatalf("Call failed: %v", err)
+		}
+		served = append(served, response.CustomMetadata[MetadataDeployment].(string)+"="+response.Content.Message)
+	}
+	if got, want := strings.Join(served, " "), "east=https://east.example.com west=https://west.example.com"; got != want {
+		t.Errorf("Expected deployments %q, got %q", want, got)
+	}
+
+	DeleteDeployments("deployprobe")
+	llm, err = NewLLM("deployprobe")
+	if err != nil {
+		t.Fatalf("NewLLM failed: %v", err)
+	}
+	if response, err := llm.Call(context.Background(), fallbackRequest()); err != nil || response.CustomMetadata[MetadataDeployment] != nil {
+		t.Errorf("Expected a client without deployments, got %+v, %v", response, err)
+	}
+}
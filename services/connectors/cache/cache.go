@@ -0,0 +1,127 @@
+// Package cache serves repeated requests from a response cache instead of calling the
+// provider again.
+//
+// Responses are stored under a hash of the request's model, contents and generation config.
+// Only deterministic requests are cached by default: a request with a temperature above zero
+// asks for varied answers, so replaying one answer would change its meaning.
+//
+// Responses are kept in a Store, which libs/store satisfies; with its Redis backend the cache
+// is shared by every replica. Use the gateway's cache_ttl setting as the TTL.
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"time"
+
+	"github.com/nexen/models"
+	"github.com/nexen/services/connectors/common"
+)
+
+// MetadataKey is the CustomMetadata key set to true on responses served from the cache.
+const MetadataKey = "cache_hit"
+
+const (
+	// DefaultTTL is how long responses are cached when Options.TTL is zero.
+	DefaultTTL = time.Hour
+
+	keyPrefix = "llmcache:"
+)
+
+// Store holds cached responses. Get must return an error for missing or expired keys.
+type Store interface {
+	Get(ctx context.Context, key string) ([]byte, error)
+	Set(ctx context.Context, key string, value []byte, ttl time.Duration) error
+}
+
+// Options configures the cache.
+type Options struct {
+	// TTL is how long a response is served from the cache. Zero means DefaultTTL.
+	TTL time.Duration
+
+	// Force caches requests with a temperature above zero too.
+	Force bool
+}
+
+// cachingLLM answers requests from the cache before calling the wrapped LLM.
+type cachingLLM struct {
+	common.LLM
+	store Store
+	opts  Options
+}
+
+// Wrap returns an LLM that serves repeated cacheable requests from store. Cache failures are
+// logged and the request is sent to llm as if there were no cache.
+func Wrap(llm common.LLM, store Store, opts Options) common.LLM {
+	if opts.TTL <= 0 {
+		opts.TTL = DefaultTTL
+	}
+	return &cachingLLM{LLM: llm, store: store, opts: opts}
+}
+
+// Middleware returns a common.Middleware that wraps clients with Wrap.
+func Middleware(store Store, opts Options) common.Middleware {
+	return func(next common.LLM) common.LLM { return Wrap(next, store, opts) }
+}
+
+// Call implements the LLM interface Call method. A cached response is marked with
+// MetadataKey and has a CostCents of zero, since the provider was not billed for it.
+func (c *cachingLLM) Call(ctx context.Context, request *models.LLMRequest) (*models.LLMResponse, error) {
+	if !c.cacheable(request) {
+		return c.LLM.Call(ctx, request)
+	}
+	key, err := c.key(request)
+	if err != nil {
+		slog.Warn("response cache: hashing request", "error", err)
+		return c.LLM.Call(ctx, request)
+	}
+
+	if data, err := c.store.Get(ctx, key); err == nil {
+		var response models.LLMResponse
+		if err := json.Unmarshal(data, &response); err == nil {
+			if response.CustomMetadata == nil {
+				response.CustomMetadata = make(map[string]any)
+			}
+			response.CustomMetadata[MetadataKey] = true
+			response.Usage.CostCents = 0
+			// The cached response carries the metadata of the request that filled the cache
+			response.SetRequestMetadata(request.Metadata)
+			return &response, nil
+		}
+	}
+
+	response, err := c.LLM.Call(ctx, request)
+	if err != nil || response == nil || response.IsError() {
+		return response, err
+	}
+	if data, err := json.Marshal(response); err != nil {
+		slog.Warn("response cache: encoding response", "error", err)
+	} else if err := c.store.Set(ctx, key, data, c.opts.TTL); err != nil {
+		slog.Warn("response cache: storing response", "error", err)
+	}
+	return response, nil
+}
+
+// BatchCall implements the LLM interface BatchCall method.
+func (c *cachingLLM) BatchCall(ctx context.Context, requests []*models.LLMRequest) ([]*models.LLMResponse, error) {
+	return common.BatchCall(ctx, requests, common.DefaultBatchConcurrency, c.Call)
+}
+
+// cacheable reports whether request may be answered from the cache.
+func (c *cachingLLM) cacheable(request *models.LLMRequest) bool {
+	return c.opts.Force || request.Config == nil || request.Config.Temperature <= 0
+}
+
+// key returns the cache key of request: a hash of its model, contents and config.
+func (c *cachingLLM) key(request *models.LLMRequest) (string, error) {
+	var model string
+	if namer, ok := c.LLM.(common.ModelNamer); ok {
+		model = namer.Model()
+	}
+	hash, err := common.RequestHash(model, request)
+	if err != nil {
+		return "", err
+	}
+	return keyPrefix + hash, nil
+}
@@ -0,0 +1,123 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/nexen/models"
+)
+
+// memStore is an in-memory Store that records TTLs.
+type memStore struct {
+	mu    sync.Mutex
+	items map[string][]byte
+	ttls  map[string]time.Duration
+}
+
+func newMemStore() *memStore {
+	return &memStore{items: make(map[string][]byte), ttls: make(map[string]time.Duration)}
+}
+
+func (m *memStore) Get(ctx context.Context, key string) ([]byte, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	value, ok := m.items[key]
+	if !ok {
+		return nil, errors.New("not found")
+	}
+	return value, nil
+}
+
+func (m *memStore) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.items[key] = value
+	m.ttls[key] = ttl
+	return nil
+}
+
+// countingLLM counts calls and answers with the request's last message.
+type countingLLM struct {
+	calls int
+}
+
+func (c *countingLLM) Call(ctx context.Context, request *models.LLMRequest) (*models.LLMResponse, error) {
+	c.calls++
+	message := request.Contents[len(request.Contents)-1].Message
+	return &models.LLMResponse{
+		Content: &models.Content{Role: "assistant", Message: "echo: " + message},
+		Usage:   models.UsageMetrics{TotalTokens: 10, CostCents: 0.5},
+	}, nil
+}
+
+func (c *countingLLM) BatchCall(ctx context.Context, requests []*models.LLMRequest) ([]*models.LLMResponse, error) {
+	return nil, errors.New("not used")
+}
+
+func (c *countingLLM) SupportedModels() []string { return []string{"gpt-4"} }
+
+func request(message string, temperature float64) *models.LLMRequest {
+	return &models.LLMRequest{
+		Model:    "gpt-4",
+		Contents: []models.Content{{Role: "user", Message: message}},
+		Config:   &models.GenerateContentConfig{Temperature: temperature},
+	}
+}
+
+func TestCacheServesRepeatedRequests(t *testing.T) {
+	ctx := context.Background()
+	llm := &countingLLM{}
+	store := newMemStore()
+	cached := Wrap(llm, store, Options{TTL: time.Minute})
+
+	first, err := cached.Call(ctx, request("hello", 0))
+	if err != nil {
+		t.Fatalf("Call() error = %v", err)
+	}
+	if first.CustomMetadata[MetadataKey] != nil {
+		t.Error("Expected the first response not to be a cache hit")
+	}
+
+	second, err := cached.Call(ctx, request("hello", 0))
+	if err != nil {
+		t.Fatalf("Call() error = %v", err)
+	}
+	if llm.calls != 1 {
+		t.Errorf("Expected one provider call, got %d", llm.calls)
+	}
+	if second.CustomMetadata[MetadataKey] != true || second.Content.Message != "echo: hello" || second.Usage.CostCents != 0 {
+		t.Errorf("Expected a free cache hit with the stored answer, got %+v", second)
+	}
+	for _, ttl := range store.ttls {
+		if ttl != time.Minute {
+			t.Errorf("Expected the configured TTL, got %v", ttl)
+		}
+	}
+
+	// A different prompt is a different key
+	if _, err := cached.Call(ctx, request("goodbye", 0)); err != nil || llm.calls != 2 {
+		t.Errorf("Expected a cache miss for another prompt, got %d calls, %v", llm.calls, err)
+	}
+}
+
+func TestCacheSkipsNondeterministicRequests(t *testing.T) {
+	ctx := context.Background()
+	llm := &countingLLM{}
+	cached := Wrap(llm, newMemStore(), Options{})
+
+	cached.Call(ctx, request("hello", 0.7))
+	cached.Call(ctx, request("hello", 0.7))
+	if llm.calls != 2 {
+		t.Errorf("Expected requests with a temperature to bypass the cache, got %d calls", llm.calls)
+	}
+
+	forced := Wrap(llm, newMemStore(), Options{Force: true})
+	forced.Call(ctx, request("hello", 0.7))
+	forced.Call(ctx, request("hello", 0.7))
+	if llm.calls != 3 {
+		t.Errorf("Expected Force to cache requests with a temperature, got %d calls", llm.calls)
+	}
+}
@@ -0,0 +1,75 @@
+package connectors
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+
+	"github.com/nexen/models"
+	"github.com/nexen/services/connectors/structured"
+)
+
+// ErrNoJSON is wrapped by DecodeError when the response contains no JSON value.
+var ErrNoJSON = errors.New("no JSON found in response")
+
+// DecodeError reports a response that could not be decoded into the CallInto target.
+type DecodeError struct {
+	// Raw is the response message as returned by the model.
+	Raw string
+
+	// Err is ErrNoJSON or the error from encoding/json.
+	Err error
+}
+
+// Error implements the error interface.
+func (e *DecodeError) Error() string {
+	return fmt.Sprintf("decoding LLM response: %v", e.Err)
+}
+
+// Unwrap returns the underlying error.
+func (e *DecodeError) Unwrap() error {
+	return e.Err
+}
+
+// CallInto calls llm with an output schema derived from target's type and unmarshals the
+// answer into target, which must be a non-nil pointer. JSON is extracted from markdown
+// fences and surrounding text, and common defects such as trailing commas or truncated
+// brackets are repaired before decoding. The caller's request is not modified.
+func CallInto(ctx context.Context, llm LLM, request *models.LLMRequest, target any) (*models.LLMResponse, error) {
+	value := reflect.ValueOf(target)
+	if value.Kind() != reflect.Pointer || value.IsNil() {
+		return nil, fmt.Errorf("CallInto target must be a non-nil pointer, got %T", target)
+	}
+
+	typed := *request
+	if request.Config != nil {
+		config := *request.Config
+		typed.Config = &config
+	}
+	typed.SetOutputSchema(models.SchemaForType(value.Type().Elem()))
+
+	response, err := llm.Call(ctx, &typed)
+	if err != nil {
+		return nil, err
+	}
+	if response.IsError() {
+		return response, fmt.Errorf("LLM returned an error: %s", response.Error())
+	}
+	if response.Content == nil {
+		return response, &DecodeError{Err: ErrNoJSON}
+	}
+
+	raw := response.Content.Message
+	extracted := structured.ExtractJSON(raw)
+	if extracted == "" {
+		return response, &DecodeError{Raw: raw, Err: ErrNoJSON}
+	}
+	if err := json.Unmarshal([]byte(extracted), target); err != nil {
+		if repairErr := json.Unmarshal([]byte(structured.RepairJSON(extracted)), target); repairErr != nil {
+			return response, &DecodeError{Raw: raw, Err: err}
+		}
+	}
+	return response, nil
+}
@@ -0,0 +1,80 @@
+package connectors
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/nexen/models"
+)
+
+// replyLLM answers with a fixed message and records the last request.
+type replyLLM struct {
+	mockLLM
+	reply   string
+	request *models.LLMRequest
+}
+
+func (r *replyLLM) Call(ctx context.Context, request *models.LLMRequest) (*models.LLMResponse, error) {
+	r.request = request
+	return &models.LLMResponse{Content: &models.Content{Role: "assistant", Message: r.reply}}, nil
+}
+
+type capital struct {
+	City       string `json:"city"`
+	Population int    `json:"population"`
+}
+
+func TestCallInto(t *testing.T) {
+	testCases := []struct {
+		name  string
+		reply string
+	}{
+		{"bare", `{"city": "Paris", "population": 2100000}`},
+		{"fenced", "```json\n{\"city\": \"Paris\", \"population\": 2100000}\n```"},
+		{"surrounding text", `Sure! {"city": "Paris", "population": 2100000} Hope this helps.`},
+		{"trailing comma", `{"city": "Paris", "population": 2100000,}`},
+		{"truncated", `{"city": "Paris", "population": 2100000`},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			llm := &replyLLM{reply: tc.reply}
+			request := &models.LLMRequest{Model: "m", Contents: []models.Content{{Role: "user", Message: "Capital of France?"}}}
+
+			var got capital
+			if _, err := CallInto(context.Background(), llm, request, &got); err != nil {
+				t.Fatalf("CallInto failed: %v", err)
+			}
+			if got.City != "Paris" || got.Population != 2100000 {
+				t.Errorf("Unexpected result %+v", got)
+			}
+			if llm.request.Config.ResponseSchema == nil {
+				t.Error("Expected output schema on the sent request")
+			}
+			if request.Config != nil {
+				t.Error("Caller's request should not be modified")
+			}
+		})
+	}
+}
+
+func TestCallIntoErrors(t *testing.T) {
+	request := &models.LLMRequest{Model: "m", Contents: []models.Content{{Role: "user", Message: "Hi"}}}
+
+	var got capital
+	_, err := CallInto(context.Background(), &replyLLM{reply: "I don't know"}, request, &got)
+	var decodeErr *DecodeError
+	if !errors.As(err, &decodeErr) || !errors.Is(err, ErrNoJSON) || decodeErr.Raw != "I don't know" {
+		t.Errorf("Expected DecodeError wrapping ErrNoJSON, got %v", err)
+	}
+
+	_, err = CallInto(context.Background(), &replyLLM{reply: `{"city": 42}`}, request, &got)
+	if !errors.As(err, &decodeErr) || errors.Is(err, ErrNoJSON) {
+		t.Errorf("Expected DecodeError for mismatched types, got %v", err)
+	}
+
+	if _, err := CallInto(context.Background(), &replyLLM{}, request, got); err == nil {
+		t.Error("Expected error for non-pointer target")
+	}
+}
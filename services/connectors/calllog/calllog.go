@@ -0,0 +1,257 @@
+// Package calllog logs every LLM call: model, latency, tokens, cost and error class, with the
+// prompt and response content redacted as configured.
+//
+// Entries go to a Sink. The default sink writes them with log/slog; to log through
+// libs/logging, pass a sink that writes the entry's fields to logging.FromContext(ctx), which
+// also adds the request ID and tenant found in the context.
+package calllog
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"log/slog"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/nexen/models"
+	"github.com/nexen/services/connectors/common"
+)
+
+// ContentMode selects how prompt and response content is logged.
+type ContentMode string
+
+const (
+	// ContentOmit logs metadata only, for compliance: no content and no error messages,
+	// which may quote it.
+	ContentOmit ContentMode = "omit"
+
+	// ContentHash logs a SHA-256 hash of the content, so identical prompts can be correlated
+	// without being readable.
+	ContentHash ContentMode = "hash"
+
+	// ContentTruncate logs the first Options.MaxContentLength characters of the content.
+	ContentTruncate ContentMode = "truncate"
+
+	// ContentFull logs the content as is.
+	ContentFull ContentMode = "full"
+)
+
+// DefaultMaxContentLength is the number of characters ContentTruncate keeps when
+// Options.MaxContentLength is zero.
+const DefaultMaxContentLength = 200
+
+// Entry is the log entry of one call.
+type Entry struct {
+	Model            string
+	Provider         string
+	Metadata         models.RequestMetadata
+	Latency          time.Duration
+	PromptTokens     int
+	CompletionTokens int
+	CostCents        float64
+
+	// ErrorClass is empty on success, or a stable name for the failure such as
+	// "rate_limited"; see ErrorClass.
+	ErrorClass string
+
+	// Error is the error message. It is empty in ContentOmit mode.
+	Error string
+
+	// Prompt and Response are the redacted content. They are empty in ContentOmit mode.
+	Prompt   string
+	Response string
+}
+
+// Sink writes log entries.
+type Sink func(ctx context.Context, entry Entry)
+
+// Options configures the logged content and where entries go.
+type Options struct {
+	// Content selects how content is logged. Empty means ContentOmit.
+	Content ContentMode
+
+	// MaxContentLength is the number of characters ContentTruncate keeps. Zero means
+	// DefaultMaxContentLength.
+	MaxContentLength int
+
+	// Sink receives the entries. Nil means SlogSink.
+	Sink Sink
+}
+
+// loggingLLM logs the calls of the wrapped LLM.
+type loggingLLM struct {
+	common.LLM
+	opts Options
+}
+
+// Wrap returns an LLM that logs every call to llm.
+func Wrap(llm common.LLM, opts Options) common.LLM {
+	if opts.Content == "" {
+		opts.Content = ContentOmit
+	}
+	if opts.MaxContentLength <= 0 {
+		opts.MaxContentLength = DefaultMaxContentLength
+	}
+	if opts.Sink == nil {
+		opts.Sink = SlogSink
+	}
+	return &loggingLLM{LLM: llm, opts: opts}
+}
+
+// Middleware returns a common.Middleware that wraps clients with Wrap.
+func Middleware(opts Options) common.Middleware {
+	return func(next common.LLM) common.LLM { return Wrap(next, opts) }
+}
+
+// Call implements the LLM interface Call method.
+func (l *loggingLLM) Call(ctx context.Context, request *models.LLMRequest) (*models.LLMResponse, error) {
+	start := time.Now()
+	response, err := l.LLM.Call(ctx, request)
+	l.log(ctx, request, time.Since(start), response, err)
+	return response, err
+}
+
+// CallStream implements common.Streamer, logging the call once with its final response.
+func (l *loggingLLM) CallStream(ctx context.Context, request *models.LLMRequest, yield func(*models.LLMResponse) error) error {
+	start := time.Now()
+	var final *models.LLMResponse
+	err := common.CallStream(ctx, l.LLM, request, func(response *models.LLMResponse) error {
+		if !response.IsPartial() {
+			final = response
+		}
+		return yield(response)
+	})
+	l.log(ctx, request, time.Since(start), final, err)
+	return err
+}
+
+// log writes the entry of a call that took latency and returned response and err.
+func (l *loggingLLM) log(ctx context.Context, request *models.LLMRequest, latency time.Duration, response *models.LLMResponse, err error) {
+	entry := Entry{Model: request.Model, Metadata: request.Metadata, Latency: latency}
+	if namer, ok := l.LLM.(common.ModelNamer); ok && entry.Model == "" {
+		entry.Model = namer.Model()
+	}
+	if info, infoErr := models.Resolve(entry.Model); infoErr == nil {
+		entry.Provider = info.Provider
+	}
+	if response != nil {
+		entry.PromptTokens = response.Usage.PromptTokens
+		entry.CompletionTokens = response.Usage.CompletionTokens
+		entry.CostCents = response.Usage.CostCents
+		if response.Content != nil {
+			entry.Response = l.redact(response.Content.Message)
+		}
+	}
+	entry.Prompt = l.redact(promptText(request))
+	if err != nil {
+		entry.ErrorClass = ErrorClass(err)
+		if l.opts.Content != ContentOmit {
+			entry.Error = err.Error()
+		}
+	}
+	l.opts.Sink(ctx, entry)
+}
+
+// BatchCall implements the LLM interface BatchCall method.
+func (l *loggingLLM) BatchCall(ctx context.Context, requests []*models.LLMRequest) ([]*models.LLMResponse, error) {
+	return common.BatchCall(ctx, requests, common.DefaultBatchConcurrency, l.Call)
+}
+
+// redact applies the content mode to text.
+func (l *loggingLLM) redact(text string) string {
+	if text == "" {
+		return ""
+	}
+	switch l.opts.Content {
+	case ContentHash:
+		sum := sha256.Sum256([]byte(text))
+		return "sha256:" + hex.EncodeToString(sum[:])
+	case ContentTruncate:
+		if utf8.RuneCountInString(text) <= l.opts.MaxContentLength {
+			return text
+		}
+		return string([]rune(text)[:l.opts.MaxContentLength]) + "…"
+	case ContentFull:
+		return text
+	}
+	return ""
+}
+
+// promptText returns the request's system instruction and messages, one per line.
+func promptText(request *models.LLMRequest) string {
+	var lines []string
+	if request.Config != nil && request.Config.SystemInstruction != "" {
+		lines = append(lines, "system: "+request.Config.SystemInstruction)
+	}
+	for _, content := range request.Contents {
+		if content.Message != "" {
+			lines = append(lines, content.Role+": "+content.Message)
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// ErrorClass returns a stable, low-cardinality name for err: "rate_limited", "auth",
+// "context_length_exceeded", "content_filtered", "provider_unavailable", "timeout",
+// "canceled" or "other".
+func ErrorClass(err error) string {
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		return "timeout"
+	case errors.Is(err, context.Canceled):
+		return "canceled"
+	case errors.Is(err, common.ErrRateLimited):
+		return "rate_limited"
+	case errors.Is(err, common.ErrAuth):
+		return "auth"
+	case errors.Is(err, common.ErrContextLengthExceeded):
+		return "context_length_exceeded"
+	case errors.Is(err, common.ErrContentFiltered):
+		return "content_filtered"
+	case errors.Is(err, common.ErrProviderUnavailable):
+		return "provider_unavailable"
+	}
+	return "other"
+}
+
+// SlogSink writes entries with log/slog: failed calls at error level, others at info.
+func SlogSink(ctx context.Context, entry Entry) {
+	attrs := []any{
+		"model", entry.Model,
+		"provider", entry.Provider,
+		"latency_ms", entry.Latency.Milliseconds(),
+		"prompt_tokens", entry.PromptTokens,
+		"completion_tokens", entry.CompletionTokens,
+		"cost_cents", entry.CostCents,
+	}
+	if entry.Metadata.TenantID != "" {
+		attrs = append(attrs, "tenant_id", entry.Metadata.TenantID)
+	}
+	if entry.Metadata.UserID != "" {
+		attrs = append(attrs, "user_id", entry.Metadata.UserID)
+	}
+	if entry.Metadata.RequestID != "" {
+		attrs = append(attrs, "request_id", entry.Metadata.RequestID)
+	}
+	if len(entry.Metadata.Tags) > 0 {
+		attrs = append(attrs, "tags", entry.Metadata.Tags)
+	}
+	if entry.Prompt != "" {
+		attrs = append(attrs, "prompt", entry.Prompt)
+	}
+	if entry.Response != "" {
+		attrs = append(attrs, "response", entry.Response)
+	}
+	if entry.ErrorClass == "" {
+		slog.InfoContext(ctx, "llm call", attrs...)
+		return
+	}
+	attrs = append(attrs, "error_class", entry.ErrorClass)
+	if entry.Error != "" {
+		attrs = append(attrs, "error", entry.Error)
+	}
+	slog.ErrorContext(ctx, "llm call failed", attrs...)
+}
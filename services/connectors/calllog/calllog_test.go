@@ -0,0 +1,124 @@
+package calllog
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/nexen/models"
+	"github.com/nexen/services/connectors/common"
+)
+
+// stubLLM answers with a fixed response and error.
+type stubLLM struct {
+	response *models.LLMResponse
+	err      error
+}
+
+func (s *stubLLM) Call(ctx context.Context, request *models.LLMRequest) (*models.LLMResponse, error) {
+	return s.response, s.err
+}
+
+func (s *stubLLM) BatchCall(ctx context.Context, requests []*models.LLMRequest) ([]*models.LLMResponse, error) {
+	return nil, errors.New("not used")
+}
+
+func (s *stubLLM) SupportedModels() []string { return []string{"gpt-4"} }
+
+func request() *models.LLMRequest {
+	return &models.LLMRequest{
+		Model:    "gpt-4",
+		Contents: []models.Content{{Role: "user", Message: "My card number is 4111 1111 1111 1111"}},
+		Config:   &models.GenerateContentConfig{SystemInstruction: "You are a bank assistant."},
+	}
+}
+
+func callWith(t *testing.T, llm *stubLLM, opts Options) Entry {
+	t.Helper()
+	var entries []Entry
+	opts.Sink = func(ctx context.Context, entry Entry) { entries = append(entries, entry) }
+	Wrap(llm, opts).Call(context.Background(), request())
+	if len(entries) != 1 {
+		t.Fatalf("Expected one entry, got %d", len(entries))
+	}
+	return entries[0]
+}
+
+func TestContentModes(t *testing.T) {
+	llm := &stubLLM{response: &models.LLMResponse{
+		Content: &models.Content{Role: "assistant", Message: "I cannot help with card numbers."},
+		Usage:   models.UsageMetrics{PromptTokens: 20, CompletionTokens: 8, CostCents: 0.1},
+	}}
+
+	entry := callWith(t, llm, Options{})
+	if entry.Prompt != "" || entry.Response != "" {
+		t.Errorf("Expected no content by default, got %q and %q", entry.Prompt, entry.Response)
+	}
+	if entry.Model != "gpt-4" || entry.PromptTokens != 20 || entry.CompletionTokens != 8 || entry.ErrorClass != "" {
+		t.Errorf("Expected the call's metadata, got %+v", entry)
+	}
+
+	entry = callWith(t, llm, Options{Content: ContentHash})
+	if !strings.HasPrefix(entry.Prompt, "sha256:") || strings.Contains(entry.Prompt, "4111") {
+		t.Errorf("Expected a hashed prompt, got %q", entry.Prompt)
+	}
+
+	entry = callWith(t, llm, Options{Content: ContentTruncate, MaxContentLength: 10})
+	if entry.Prompt != "system: Yo…" || entry.Response != "I cannot h…" {
+		t.Errorf("Expected truncated content, got %q and %q", entry.Prompt, entry.Response)
+	}
+
+	entry = callWith(t, llm, Options{Content: ContentFull})
+	if entry.Prompt != "system: You are a bank assistant.\nuser: My card number is 4111 1111 1111 1111" {
+		t.Errorf("Expected the full prompt, got %q", entry.Prompt)
+	}
+}
+
+func TestErrorsAreClassified(t *testing.T) {
+	llm := &stubLLM{err: common.NewProviderError("openai", 429, "rate_limit_exceeded", "Rate limit reached")}
+
+	entry := callWith(t, llm, Options{})
+	if entry.ErrorClass != "rate_limited" || entry.Error != "" {
+		t.Errorf("Expected the error class without its message, got %+v", entry)
+	}
+	if entry := callWith(t, llm, Options{Content: ContentFull}); entry.Error == "" {
+		t.Error("Expected the error message outside compliance mode")
+	}
+}
+
+// streamingLLM streams its response word by word.
+type streamingLLM struct{ stubLLM }
+
+func (s *streamingLLM) CallStream(ctx context.Context, request *models.LLMRequest, yield func(*models.LLMResponse) error) error {
+	partial := true
+	for _, word := range []string{"Hello ", "there"} {
+		if err := yield(&models.LLMResponse{Content: &models.Content{Role: "assistant", Message: word}, Partial: &partial}); err != nil {
+			return err
+		}
+	}
+	return yield(s.response)
+}
+
+func TestStreamsAreLoggedOnce(t *testing.T) {
+	llm := &streamingLLM{stubLLM{response: &models.LLMResponse{
+		Content: &models.Content{Role: "assistant", Message: "Hello there"},
+		Usage:   models.UsageMetrics{PromptTokens: 5, CompletionTokens: 2},
+	}}}
+	var entries []Entry
+	wrapped := Wrap(llm, Options{Content: ContentFull, Sink: func(ctx context.Context, entry Entry) { entries = append(entries, entry) }})
+
+	partials := 0
+	err := common.CallStream(context.Background(), wrapped, request(), func(response *models.LLMResponse) error {
+		if response.IsPartial() {
+			partials++
+		}
+		return nil
+	})
+	if err != nil || partials != 2 {
+		t.Fatalf("Expected the stream to pass through, got %d partials and %v", partials, err)
+	}
+	if len(entries) != 1 || entries[0].Response != "Hello there" || entries[0].CompletionTokens != 2 {
+		t.Errorf("Expected one entry with the final response, got %+v", entries)
+	}
+}
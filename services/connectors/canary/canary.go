@@ -0,0 +1,216 @@
+// Package canary splits traffic between a control and a candidate model to compare them.
+//
+// A Router sends a percentage of requests, such as 5%, to the candidate and the rest to the
+// control, tags each response with the arm that served it and keeps per-arm statistics of
+// errors, latency, cost and confidence, so a new model can be evaluated on production traffic
+// before it takes over.
+package canary
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/nexen/models"
+	"github.com/nexen/services/connectors/common"
+)
+
+// MetadataArm is the CustomMetadata key holding the arm that served a request, ArmControl or
+// ArmCandidate. The model that answered is under common.MetadataServedBy.
+const MetadataArm = "arm"
+
+// Names of the arms.
+const (
+	ArmControl   = "control"
+	ArmCandidate = "candidate"
+)
+
+// Arm is one of the model configurations traffic is split between.
+type Arm struct {
+	// LLM is the client the arm's requests are sent to.
+	LLM common.LLM
+
+	// Model is the model ID sent to LLM. When empty, the request's model is kept.
+	Model string
+}
+
+// Options configures how traffic is split.
+type Options struct {
+	// Percent is the share of requests, from 0 to 100, sent to the candidate.
+	Percent float64
+
+	// KeyFrom returns the key pinning a request to an arm, so that, for example, a user keeps
+	// talking to the same model. Requests with an empty key, or all requests when KeyFrom is
+	// nil, are split at random.
+	KeyFrom func(request *models.LLMRequest) string
+
+	// Random returns a number in [0, 1) used to split unpinned requests. Nil uses math/rand.
+	Random func() float64
+}
+
+// ArmStats are the statistics of the requests an arm served.
+type ArmStats struct {
+	Requests int `json:"requests"`
+	Errors   int `json:"errors"`
+
+	// ErrorRate is Errors over Requests.
+	ErrorRate float64 `json:"errorRate"`
+
+	// LatencyMs is the mean latency of successful requests.
+	LatencyMs float64 `json:"latencyMs"`
+
+	// CostCents is the mean cost of successful requests.
+	CostCents float64 `json:"costCents"`
+
+	// TotalTokens is the mean number of tokens of successful requests.
+	TotalTokens float64 `json:"totalTokens"`
+
+	// Confidence is the mean confidence score of the responses that have one, and Scored
+	// their number.
+	Confidence float64 `json:"confidence"`
+	Scored     int     `json:"scored"`
+}
+
+// totals are the running sums behind an ArmStats.
+type totals struct {
+	requests, errors, scored int
+	latencyMs, costCents     float64
+	tokens, confidence       float64
+}
+
+// Router splits requests between a control and a candidate arm. It is safe for concurrent use.
+type Router struct {
+	control   Arm
+	candidate Arm
+	opts      Options
+
+	mu     sync.Mutex
+	totals map[string]*totals
+}
+
+// New returns a Router sending opts.Percent of requests to candidate and the rest to control.
+func New(control, candidate Arm, opts Options) (*Router, error) {
+	if control.LLM == nil || candidate.LLM == nil {
+		return nil, fmt.Errorf("canary requires a control and a candidate client")
+	}
+	if opts.Percent < 0 || opts.Percent > 100 {
+		return nil, fmt.Errorf("canary percent %g is not between 0 and 100", opts.Percent)
+	}
+	if opts.Random == nil {
+		opts.Random = rand.Float64
+	}
+	return &Router{
+		control:   control,
+		candidate: candidate,
+		opts:      opts,
+		totals:    map[string]*totals{ArmControl: {}, ArmCandidate: {}},
+	}, nil
+}
+
+// Call implements the LLM interface Call method. The response is tagged with the arm under
+// MetadataArm and the model under common.MetadataServedBy.
+func (r *Router) Call(ctx context.Context, request *models.LLMRequest) (*models.LLMResponse, error) {
+	name, arm := ArmControl, r.control
+	if r.pickCandidate(request) {
+		name, arm = ArmCandidate, r.candidate
+	}
+	armRequest := *request
+	if arm.Model != "" {
+		armRequest.Model = arm.Model
+	}
+
+	start := time.Now()
+	response, err := arm.LLM.Call(ctx, &armRequest)
+	r.record(name, time.Since(start), response, err)
+	if err != nil {
+		return nil, err
+	}
+	if response.CustomMetadata == nil {
+		response.CustomMetadata = make(map[string]any)
+	}
+	response.CustomMetadata[MetadataArm] = name
+	response.CustomMetadata[common.MetadataServedBy] = armRequest.Model
+	return response, nil
+}
+
+// pickCandidate reports whether request goes to the candidate. Pinned requests hash their key
+// into one of 10000 buckets, so raising Percent only moves keys to the candidate.
+func (r *Router) pickCandidate(request *models.LLMRequest) bool {
+	if r.opts.KeyFrom != nil {
+		if key := r.opts.KeyFrom(request); key != "" {
+			h := fnv.New32a()
+			h.Write([]byte(key))
+			return float64(h.Sum32()%10000) < r.opts.Percent*100
+		}
+	}
+	return r.opts.Random()*100 < r.opts.Percent
+}
+
+// record adds the outcome of a request to the arm's totals.
+func (r *Router) record(arm string, elapsed time.Duration, response *models.LLMResponse, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	t := r.totals[arm]
+	t.requests++
+	if err != nil || response == nil || response.IsError() {
+		t.errors++
+		return
+	}
+	latency := response.Usage.LatencyMs
+	if latency == 0 {
+		latency = float64(elapsed) / float64(time.Millisecond)
+	}
+	t.latencyMs += latency
+	t.costCents += response.Usage.CostCents
+	t.tokens += float64(response.Usage.TotalTokens)
+	if score, ok := response.Confidence(); ok {
+		t.confidence += score
+		t.scored++
+	}
+}
+
+// Stats returns the statistics of each arm, keyed by ArmControl and ArmCandidate.
+func (r *Router) Stats() map[string]ArmStats {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	stats := make(map[string]ArmStats, len(r.totals))
+	for arm, t := range r.totals {
+		s := ArmStats{Requests: t.requests, Errors: t.errors, Scored: t.scored}
+		if t.requests > 0 {
+			s.ErrorRate = float64(t.errors) / float64(t.requests)
+		}
+		if ok := t.requests - t.errors; ok > 0 {
+			s.LatencyMs = t.latencyMs / float64(ok)
+			s.CostCents = t.costCents / float64(ok)
+			s.TotalTokens = t.tokens / float64(ok)
+		}
+		if t.scored > 0 {
+			s.Confidence = t.confidence / float64(t.scored)
+		}
+		stats[arm] = s
+	}
+	return stats
+}
+
+// BatchCall implements the LLM interface BatchCall method.
+func (r *Router) BatchCall(ctx context.Context, requests []*models.LLMRequest) ([]*models.LLMResponse, error) {
+	return common.BatchCall(ctx, requests, common.DefaultBatchConcurrency, r.Call)
+}
+
+// SupportedModels returns the models supported by either arm.
+func (r *Router) SupportedModels() []string {
+	seen := make(map[string]bool)
+	var supported []string
+	for _, arm := range []Arm{r.control, r.candidate} {
+		for _, model := range arm.LLM.SupportedModels() {
+			if !seen[model] {
+				seen[model] = true
+				supported = append(supported, model)
+			}
+		}
+	}
+	return supported
+}
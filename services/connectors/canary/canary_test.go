@@ -0,0 +1,129 @@
+package canary
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/nexen/models"
+	"github.com/nexen/services/connectors/common"
+)
+
+// stubLLM answers with a fixed usage and confidence, or fails with err.
+type stubLLM struct {
+	usage      models.UsageMetrics
+	confidence float64
+	err        error
+	calls      int
+}
+
+func (s *stubLLM) Call(ctx context.Context, request *models.LLMRequest) (*models.LLMResponse, error) {
+	s.calls++
+	if s.err != nil {
+		return nil, s.err
+	}
+	response := &models.LLMResponse{Content: &models.Content{Role: "assistant", Message: request.Model}, Usage: s.usage}
+	if s.confidence > 0 {
+		response.SetConfidence(s.confidence)
+	}
+	return response, nil
+}
+
+func (s *stubLLM) BatchCall(ctx context.Context, requests []*models.LLMRequest) ([]*models.LLMResponse, error) {
+	return nil, nil
+}
+
+func (s *stubLLM) SupportedModels() []string {
+	return []string{"stub"}
+}
+
+func request(user string) *models.LLMRequest {
+	return &models.LLMRequest{Model: "claude-3.5-sonnet", Metadata: models.RequestMetadata{UserID: user},
+		Contents: []models.Content{{Role: "user", Message: "Hi"}}}
+}
+
+func TestRouterSplitsAndTagsResponses(t *testing.T) {
+	control := &stubLLM{usage: models.UsageMetrics{TotalTokens: 100, LatencyMs: 400, CostCents: 0.2}, confidence: 0.8}
+	candidate := &stubLLM{usage: models.UsageMetrics{TotalTokens: 80, LatencyMs: 200, CostCents: 0.1}}
+	draws := []float64{0.01, 0.5, 0.049, 0.05}
+	router, err := New(Arm{LLM: control}, Arm{LLM: candidate, Model: "new-model"}, Options{
+		Percent: 5,
+		Random: func() float64 {
+			draw := draws[0]
+			draws = draws[1:]
+			return draw
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var arms []string
+	for i := 0; i < 4; i++ {
+		response, err := router.Call(context.Background(), request(""))
+		if err != nil {
+			t.Fatalf("Call failed: %v", err)
+		}
+		arm := response.CustomMetadata[MetadataArm].(string)
+		arms = append(arms, arm)
+		if model := response.CustomMetadata[common.MetadataServedBy]; arm == ArmCandidate && model != "new-model" || arm == ArmControl && model != "claude-3.5-sonnet" {
+			t.Errorf("Arm %s was served by %v", arm, model)
+		}
+	}
+	want := []string{ArmCandidate, ArmControl, ArmCandidate, ArmControl}
+	for i := range want {
+		if arms[i] != want[i] {
+			t.Fatalf("Expected arms %v, got %v", want, arms)
+		}
+	}
+
+	stats := router.Stats()
+	if s := stats[ArmControl]; s.Requests != 2 || s.LatencyMs != 400 || s.CostCents != 0.2 || s.TotalTokens != 100 || s.Confidence != 0.8 || s.Scored != 2 {
+		t.Errorf("Unexpected control stats %+v", s)
+	}
+	if s := stats[ArmCandidate]; s.Requests != 2 || s.LatencyMs != 200 || s.CostCents != 0.1 || s.Scored != 0 {
+		t.Errorf("Unexpected candidate stats %+v", s)
+	}
+}
+
+func TestRouterPinsKeysToAnArm(t *testing.T) {
+	router, err := New(Arm{LLM: &stubLLM{}}, Arm{LLM: &stubLLM{}}, Options{
+		Percent: 50,
+		KeyFrom: func(request *models.LLMRequest) string { return request.Metadata.UserID },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, user := range []string{"alice", "bob", "carol", "dave"} {
+		first, _ := router.Call(context.Background(), request(user))
+		for i := 0; i < 5; i++ {
+			response, _ := router.Call(context.Background(), request(user))
+			if response.CustomMetadata[MetadataArm] != first.CustomMetadata[MetadataArm] {
+				t.Fatalf("User %s moved from the %v arm to the %v arm", user, first.CustomMetadata[MetadataArm], response.CustomMetadata[MetadataArm])
+			}
+		}
+	}
+}
+
+func TestRouterCountsErrors(t *testing.T) {
+	failing := &stubLLM{err: errors.New("down")}
+	router, err := New(Arm{LLM: &stubLLM{}}, Arm{LLM: failing}, Options{Percent: 100})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := router.Call(context.Background(), request("")); err == nil {
+		t.Fatal("Expected the candidate's error")
+	}
+	if s := router.Stats()[ArmCandidate]; s.Requests != 1 || s.Errors != 1 || s.ErrorRate != 1 {
+		t.Errorf("Unexpected candidate stats %+v", s)
+	}
+}
+
+func TestNewValidates(t *testing.T) {
+	if _, err := New(Arm{LLM: &stubLLM{}}, Arm{}, Options{}); err == nil {
+		t.Error("Expected an error without a candidate client")
+	}
+	if _, err := New(Arm{LLM: &stubLLM{}}, Arm{LLM: &stubLLM{}}, Options{Percent: 120}); err == nil {
+		t.Error("Expected an error for a percent over 100")
+	}
+}
@@ -0,0 +1,71 @@
+package connectors
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/nexen/models"
+	"github.com/nexen/services/connectors/common"
+)
+
+// CheckCapabilities returns a Middleware that fails requests needing a capability their model
+// lacks, such as image input for a text-only model, with a *models.UnsupportedCapabilityError
+// before they are sent. The model is the request's, or model when the request does not name
+// one; models whose capabilities are not registered are not checked. NewLLM applies it to every
+// client.
+func CheckCapabilities(model string) Middleware {
+	return func(next LLM) LLM {
+		return &capableLLM{LLM: next, model: model}
+	}
+}
+
+// capableLLM checks requests against the capabilities of their model.
+type capableLLM struct {
+	LLM
+	model string
+}
+
+// Model implements common.ModelNamer.
+func (c *capableLLM) Model() string {
+	return c.model
+}
+
+// check returns the error of request's model for the capabilities request needs.
+func (c *capableLLM) check(request *models.LLMRequest) error {
+	model := request.Model
+	if model == "" {
+		model = c.model
+	}
+	info, err := models.Resolve(model)
+	if err != nil {
+		return nil
+	}
+	return info.CheckCapabilities(request)
+}
+
+// Call implements the LLM interface Call method.
+func (c *capableLLM) Call(ctx context.Context, request *models.LLMRequest) (*models.LLMResponse, error) {
+	if err := c.check(request); err != nil {
+		return nil, err
+	}
+	return c.LLM.Call(ctx, request)
+}
+
+// CallStream implements common.Streamer.
+func (c *capableLLM) CallStream(ctx context.Context, request *models.LLMRequest, yield func(*models.LLMResponse) error) error {
+	if err := c.check(request); err != nil {
+		return err
+	}
+	return common.CallStream(ctx, c.LLM, request, yield)
+}
+
+// BatchCall implements the LLM interface BatchCall method. The batch fails without any request
+// being sent when one of them needs a capability its model lacks.
+func (c *capableLLM) BatchCall(ctx context.Context, requests []*models.LLMRequest) ([]*models.LLMResponse, error) {
+	for i, request := range requests {
+		if err := c.check(request); err != nil {
+			return nil, fmt.Errorf("request %d: %w", i, err)
+		}
+	}
+	return c.LLM.BatchCall(ctx, requests)
+}
@@ -0,0 +1,54 @@
+package connectors
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/nexen/models"
+)
+
+func TestCheckCapabilities(t *testing.T) {
+	if err := models.Register("^capprobe-text$", models.ModelInfo{ID: "capprobe-text", Provider: "capprobe", Capabilities: &models.Capabilities{Tools: true}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := models.Register("^capprobe-vision$", models.ModelInfo{ID: "capprobe-vision", Provider: "capprobe", Capabilities: &models.Capabilities{Vision: true, Streaming: true}}); err != nil {
+		t.Fatal(err)
+	}
+	image := []models.Content{{Role: "user", Parts: []any{map[string]any{models.PartImage: map[string]any{"url": "https://example.com/cat.png"}}}}}
+	ctx := context.Background()
+
+	llm := CheckCapabilities("capprobe-text")(&streamingUsageLLM{})
+	_, err := llm.Call(ctx, &models.LLMRequest{Contents: image})
+	var unsupported *models.UnsupportedCapabilityError
+	if !errors.As(err, &unsupported) || unsupported.Model != "capprobe-text" || unsupported.Missing[0] != models.CapabilityVision {
+		t.Errorf("Expected the image to be refused, got %v", err)
+	}
+	if _, err := llm.Call(ctx, &models.LLMRequest{Contents: []models.Content{{Role: "user", Message: "Hi"}}}); err != nil {
+		t.Errorf("Expected a text request to pass, got %v", err)
+	}
+
+	// The request's model takes precedence over the client's
+	if _, err := llm.Call(ctx, &models.LLMRequest{Model: "capprobe-vision", Contents: image}); err != nil {
+		t.Errorf("Expected the request's model to be checked, got %v", err)
+	}
+
+	stream := &models.LLMRequest{Contents: image, LiveConnect: models.LiveConnectConfig{EnableStreaming: true}}
+	if err := CheckCapabilities("capprobe-vision")(&streamingUsageLLM{}).(*capableLLM).CallStream(ctx, stream, func(*models.LLMResponse) error { return nil }); err != nil {
+		t.Errorf("Expected the stream to pass, got %v", err)
+	}
+	err = llm.(*capableLLM).CallStream(ctx, stream, func(*models.LLMResponse) error { return nil })
+	if !errors.As(err, &unsupported) || len(unsupported.Missing) != 2 || unsupported.Missing[1] != models.CapabilityStreaming {
+		t.Errorf("Expected vision and streaming to be missing, got %v", err)
+	}
+
+	// A batch fails as a whole before anything is sent
+	if _, err := llm.BatchCall(ctx, []*models.LLMRequest{{Contents: image}}); !errors.Is(err, models.ErrCapabilityUnsupported) {
+		t.Errorf("Expected the batch to be refused, got %v", err)
+	}
+
+	// Models without registered capabilities are not checked
+	if _, err := CheckCapabilities("unregistered-model")(&streamingUsageLLM{}).Call(ctx, &models.LLMRequest{Contents: image}); err != nil {
+		t.Errorf("Expected no check for an unknown model, got %v", err)
+	}
+}
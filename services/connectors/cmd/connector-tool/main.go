@@ -28,6 +28,7 @@ func main() {
 	apiKeyFlag := flag.String("apikey", "", "API key (can also use env var)")
 	timeoutFlag := flag.Int("timeout", 30, "Timeout in seconds")
 	listFlag := flag.Bool("list", false, "List available registered model patterns")
+	dumpFlag := flag.String("dump-dir", "", "Write the provider request, with credentials redacted, to this directory")
 
 	flag.Parse()
 
@@ -51,6 +52,7 @@ func main() {
 	llm, err := connectors.NewLLM(*modelFlag,
 		common.WithAPIKey(apiKey),
 		common.WithTimeout(*timeoutFlag),
+		common.WithRequestDump(*dumpFlag),
 	)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error creating client: %v\n", err)
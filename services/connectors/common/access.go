@@ -0,0 +1,80 @@
+package common
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+)
+
+// ErrModelNotAllowed is matched by the errors of clients refused by a model access rule.
+var ErrModelNotAllowed = errors.New("model not allowed")
+
+// ModelAccess is a model allowlist and denylist. Entries are model names or path.Match
+// patterns such as "gpt-4*", matched in any case.
+type ModelAccess struct {
+	// Allow lists the models that may be used; empty allows every model not denied.
+	Allow []string
+
+	// Deny lists models that may not be used, even when allowed.
+	Deny []string
+}
+
+// Allows reports whether the rule allows model.
+func (a ModelAccess) Allows(model string) bool {
+	model = strings.ToLower(model)
+	if matchModel(a.Deny, model) {
+		return false
+	}
+	return len(a.Allow) == 0 || matchModel(a.Allow, model)
+}
+
+// matchModel reports whether model matches any of patterns.
+func matchModel(patterns []string, model string) bool {
+	for _, pattern := range patterns {
+		if matched, _ := path.Match(strings.ToLower(pattern), model); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// ModelAccessError reports a model refused by an access rule. It matches ErrModelNotAllowed
+// with errors.Is.
+type ModelAccessError struct {
+	Model string
+
+	// Tenant is the tenant whose rule refused the model, or empty for the other rules.
+	Tenant string
+}
+
+// Error implements the error interface.
+func (e *ModelAccessError) Error() string {
+	if e.Tenant != "" {
+		return fmt.Sprintf("model not allowed: %s for tenant %s", e.Model, e.Tenant)
+	}
+	return "model not allowed: " + e.Model
+}
+
+// Is reports whether target is ErrModelNotAllowed.
+func (e *ModelAccessError) Is(target error) bool {
+	return target == ErrModelNotAllowed
+}
+
+// WithModelAccess adds an access rule the client's model must pass, on top of the rules set
+// for the process and tenant.
+func WithModelAccess(access ModelAccess) Option {
+	return func(config *LLMConfig) error {
+		config.ModelAccess = append(config.ModelAccess, access)
+		return nil
+	}
+}
+
+// WithTenant names the tenant the client is created for, so that the tenant's model access
+// rule applies.
+func WithTenant(tenant string) Option {
+	return func(config *LLMConfig) error {
+		config.Tenant = tenant
+		return nil
+	}
+}
@@ -2,6 +2,9 @@ package common
 
 import (
 	"context"
+	"fmt"
+	"sort"
+	"time"
 
 	"github.com/nexen/models"
 )
@@ -20,7 +23,8 @@ type LLMConfig struct {
 	// EndpointOverride allows using custom endpoints.
 	EndpointOverride string
 
-	// Timeout specifies the request timeout in seconds.
+	// Timeout specifies the request timeout in seconds. Requests and calls may override it;
+	// see ResolveTimeout.
 	Timeout int
 
 	// RetryConfig controls retry behavior.
@@ -29,6 +33,34 @@ type LLMConfig struct {
 	// RegionRouting controls endpoint region selection.
 	RegionRouting RegionRouting
 
+	// BatchConcurrency is the number of BatchCall requests sent at once.
+	BatchConcurrency int
+
+	// RateLimit caps requests and tokens per minute for the API key, shared by all clients
+	// of the provider that use the same key.
+	RateLimit RateLimit
+
+	// RequestDump writes the requests sent to the provider to files for debugging.
+	RequestDump RequestDump
+
+	// FeatureGate decides whether gated connector behavior is used for a request.
+	FeatureGate FeatureGate
+
+	// ModelAccess are the access rules the client's model must pass, in addition to those
+	// set with connectors.SetModelAccess.
+	ModelAccess []ModelAccess
+
+	// Tenant is the tenant the client is created for, whose model access rule applies.
+	Tenant string
+
+	// ServiceTier is the provider service tier requests are sent with, e.g.
+	// models.ServiceTierPriority. Empty uses the provider's default.
+	ServiceTier string
+
+	// Middleware wraps the client created by connectors.NewLLM. The first middleware is the
+	// outermost.
+	Middleware []Middleware
+
 	// CustomOptions contains provider-specific options.
 	CustomOptions map[string]interface{}
 }
@@ -38,7 +70,8 @@ type RetryConfig struct {
 	// MaxRetries is the number of times to retry a failed request.
 	MaxRetries int
 
-	// MinBackoff is the minimum backoff time in milliseconds.
+	// MinBackoff is the backoff ceiling for the first retry in milliseconds; it doubles on each
+	// later retry.
 	MinBackoff int
 
 	// MaxBackoff is the maximum backoff time in milliseconds.
@@ -46,6 +79,10 @@ type RetryConfig struct {
 
 	// StatusCodesToRetry lists HTTP status codes that should trigger a retry.
 	StatusCodesToRetry []int
+
+	// Jitter returns a random number in [0, 1) used to spread backoff waits.
+	// Nil uses math/rand; tests can supply a fixed source for deterministic waits.
+	Jitter func() float64
 }
 
 // RegionRouting defines region selection strategy.
@@ -56,8 +93,11 @@ type RegionRouting struct {
 	// PreferredRegions lists regions in order of preference.
 	PreferredRegions []string
 
-	// FailoverStrategy defines failover behavior (round-robin, etc.).
+	// FailoverStrategy is FailoverSequential or FailoverRoundRobin.
 	FailoverStrategy string
+
+	// Cooldown is how long a failed region is skipped. Zero means DefaultRegionCooldown.
+	Cooldown time.Duration
 }
 
 // LLM defines the core interface for interacting with language models.
@@ -67,12 +107,74 @@ type LLM interface {
 	Call(ctx context.Context, request *models.LLMRequest) (*models.LLMResponse, error)
 
 	// BatchCall processes multiple requests and returns corresponding responses.
+	// Implementations return one entry per request, nil where a request failed, and a
+	// *BatchError describing the failures.
 	BatchCall(ctx context.Context, requests []*models.LLMRequest) ([]*models.LLMResponse, error)
 
 	// SupportedModels returns a list of model IDs that this implementation can handle.
 	SupportedModels() []string
 }
 
+// ModelNamer is implemented by LLMs bound to a single model, such as the provider clients.
+type ModelNamer interface {
+	// Model returns the model name the client was created for.
+	Model() string
+}
+
+// ModelLister is implemented by clients that can list the models their provider serves.
+type ModelLister interface {
+	// ListModels returns the IDs of every model the provider serves to the client's API key,
+	// fetching all pages of the provider's listing.
+	ListModels(ctx context.Context) ([]string, error)
+}
+
+// ModelDescription describes a model as its provider's models endpoint does. Fields the
+// provider does not report are zero.
+type ModelDescription struct {
+	ID          string
+	DisplayName string
+
+	// ContextWindow is the most tokens the model reads in a request.
+	ContextWindow int
+
+	// Created is when the provider released the model.
+	Created time.Time
+
+	// DeprecatedAt is when the provider retires the model, once announced.
+	DeprecatedAt time.Time
+}
+
+// ModelDescriber is implemented by model listers whose provider describes its models beyond
+// their IDs.
+type ModelDescriber interface {
+	// DescribeModels returns every model the provider serves to the client's API key, in the
+	// order of ListModels.
+	DescribeModels(ctx context.Context) ([]ModelDescription, error)
+}
+
+// RegisteredModels returns the IDs of provider's models in the models registry, sorted. The
+// provider clients return them from SupportedModels, so that models registered at runtime,
+// such as those synced from the provider's listing, are included.
+func RegisteredModels(provider string) []string {
+	seen := make(map[string]bool)
+	var ids []string
+	for _, info := range models.ListModelsByProvider(provider) {
+		if !seen[info.ID] {
+			seen[info.ID] = true
+			ids = append(ids, info.ID)
+		}
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// Pinger is implemented by clients that can check their provider is reachable.
+type Pinger interface {
+	// Ping makes a cheap call to the provider, failing when it cannot be reached or refuses
+	// the client's credentials.
+	Ping(ctx context.Context) error
+}
+
 // WithAPIKey sets the API key option.
 func WithAPIKey(apiKey string) Option {
 	return func(config *LLMConfig) error {
@@ -81,6 +183,14 @@ func WithAPIKey(apiKey string) Option {
 	}
 }
 
+// WithMiddleware adds mws around the client; the first middleware is the outermost.
+func WithMiddleware(mws ...Middleware) Option {
+	return func(config *LLMConfig) error {
+		config.Middleware = append(config.Middleware, mws...)
+		return nil
+	}
+}
+
 // WithOrgID sets the organization ID option.
 func WithOrgID(orgID string) Option {
 	return func(config *LLMConfig) error {
@@ -118,13 +228,57 @@ func WithRetryConfig(maxRetries, minBackoff, maxBackoff int, statusCodes []int)
 	}
 }
 
-// WithRegionRouting sets region routing configuration.
+// WithRegionRouting sends requests to the provider's endpoints in regions, in order of
+// preference, failing over between them by strategy: FailoverSequential (the default when
+// empty) or FailoverRoundRobin. See RegionRouter.
 func WithRegionRouting(enable bool, regions []string, strategy string) Option {
 	return func(config *LLMConfig) error {
+		strategy, err := validFailoverStrategy(strategy)
+		if err != nil {
+			return err
+		}
 		config.RegionRouting = RegionRouting{
 			EnableRegionRouting: enable,
 			PreferredRegions:    regions,
 			FailoverStrategy:    strategy,
+			Cooldown:            config.RegionRouting.Cooldown,
+		}
+		return nil
+	}
+}
+
+// WithRegionCooldown sets how long a failed region is skipped.
+func WithRegionCooldown(cooldown time.Duration) Option {
+	return func(config *LLMConfig) error {
+		if cooldown < 0 {
+			return fmt.Errorf("region cooldown must not be negative")
+		}
+		config.RegionRouting.Cooldown = cooldown
+		return nil
+	}
+}
+
+// WithBatchConcurrency sets how many BatchCall requests are sent at once.
+func WithBatchConcurrency(n int) Option {
+	return func(config *LLMConfig) error {
+		if n <= 0 {
+			return fmt.Errorf("batch concurrency must be positive")
+		}
+		config.BatchConcurrency = n
+		return nil
+	}
+}
+
+// WithRateLimit limits requests and tokens per minute for the client's API key.
+// Zero leaves the corresponding limit off.
+func WithRateLimit(requestsPerMinute, tokensPerMinute int) Option {
+	return func(config *LLMConfig) error {
+		if requestsPerMinute < 0 || tokensPerMinute < 0 {
+			return fmt.Errorf("rate limits must not be negative")
+		}
+		config.RateLimit = RateLimit{
+			RequestsPerMinute: requestsPerMinute,
+			TokensPerMinute:   tokensPerMinute,
 		}
 		return nil
 	}
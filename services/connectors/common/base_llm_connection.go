@@ -2,8 +2,9 @@ package common
 
 import (
 	"context"
-	"fmt"
+	"errors"
 	"math"
+	"math/rand"
 	"net/http"
 	"time"
 )
@@ -31,11 +32,12 @@ var DefaultRetryConfig = RetryConfig{
 // DefaultLLMConfig provides a default configuration for LLM clients.
 func DefaultLLMConfig() *LLMConfig {
 	return &LLMConfig{
-		Timeout:     DefaultTimeoutSeconds,
-		RetryConfig: DefaultRetryConfig,
+		Timeout:          DefaultTimeoutSeconds,
+		RetryConfig:      DefaultRetryConfig,
+		BatchConcurrency: DefaultBatchConcurrency,
 		RegionRouting: RegionRouting{
 			EnableRegionRouting: false,
-			FailoverStrategy:    "sequential",
+			FailoverStrategy:    FailoverSequential,
 		},
 		CustomOptions: make(map[string]interface{}),
 	}
@@ -63,25 +65,27 @@ func NewHTTPClientWithTimeout(timeoutSec int) *http.Client {
 }
 
 // CalculateBackoff determines the backoff duration for a retry attempt.
+//
+// It uses full-jitter exponential backoff: the wait is drawn uniformly from
+// [0, min(MaxBackoff, MinBackoff * 2^attempt)), so clients that fail together (for example
+// on a provider 429) spread their retries instead of retrying in lockstep.
 func CalculateBackoff(attempt int, config RetryConfig) time.Duration {
 	if attempt < 0 {
 		attempt = 0
 	}
 
-	// Exponential backoff with jitter: min(maxBackoff, minBackoff * 2^attempt) with 20% jitter
-	backoff := float64(config.MinBackoff) * math.Pow(2, float64(attempt))
-	backoff = math.Min(backoff, float64(config.MaxBackoff))
-
-	// Add jitter (±20%)
-	jitter := backoff * 0.2 * (2*rand() - 1)
-	backoff = backoff + jitter
+	ceiling := float64(config.MinBackoff) * math.Pow(2, float64(attempt))
+	ceiling = math.Min(ceiling, float64(config.MaxBackoff))
+	if ceiling <= 0 {
+		return 0
+	}
 
-	return time.Duration(backoff) * time.Millisecond
-}
+	random := config.Jitter
+	if random == nil {
+		random = rand.Float64
+	}
 
-// rand returns a random float in [0,1)
-func rand() float64 {
-	return float64(time.Now().UnixNano()%1000) / 1000.0
+	return time.Duration(ceiling * random() * float64(time.Millisecond))
 }
 
 // ShouldRetry determines if a request should be retried based on status code.
@@ -94,28 +98,50 @@ func ShouldRetry(statusCode int, config RetryConfig) bool {
 	return false
 }
 
-// WithContext applies a context timeout to an existing context.
-func WithContext(parent context.Context, timeoutSec int) (context.Context, context.CancelFunc) {
-	if timeoutSec <= 0 {
-		timeoutSec = DefaultTimeoutSeconds
+// DoWithRetry calls fn until it succeeds, fails with an error that should not be retried, or
+// config.MaxRetries retries have been made. A *ProviderError is retried when its status code is
+// in config.StatusCodesToRetry, or when no response was received and it is classified as
+// ErrProviderUnavailable. Waits use CalculateBackoff, extended to the provider's Retry-After
+// when that is longer. The last error is returned; waiting stops early if ctx is done.
+func DoWithRetry(ctx context.Context, config RetryConfig, fn func(ctx context.Context) error) error {
+	for attempt := 0; ; attempt++ {
+		err := fn(ctx)
+		if err == nil || attempt >= config.MaxRetries || !IsRetryable(err, config) {
+			return err
+		}
+
+		wait := CalculateBackoff(attempt, config)
+		var apiErr *ProviderError
+		if errors.As(err, &apiErr) && apiErr.RetryAfter > wait {
+			wait = apiErr.RetryAfter
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
 	}
-	return context.WithTimeout(parent, time.Duration(timeoutSec)*time.Second)
 }
 
-// CreateEndpointURL constructs an endpoint URL based on region settings.
-func CreateEndpointURL(baseEndpoint string, config *LLMConfig) string {
-	if config.EndpointOverride != "" {
-		return config.EndpointOverride
+// IsRetryable reports whether DoWithRetry would retry err under config.
+func IsRetryable(err error, config RetryConfig) bool {
+	var apiErr *ProviderError
+	if !errors.As(err, &apiErr) {
+		return false
 	}
-
-	if !config.RegionRouting.EnableRegionRouting || len(config.RegionRouting.PreferredRegions) == 0 {
-		return baseEndpoint
+	if apiErr.StatusCode != 0 {
+		return ShouldRetry(apiErr.StatusCode, config)
 	}
+	return errors.Is(apiErr.Class, ErrProviderUnavailable)
+}
 
-	// Here we would implement region routing logic based on the FailoverStrategy
-	// For simplicity, we'll just use the first preferred region in this example
-	region := config.RegionRouting.PreferredRegions[0]
-
-	// This is a simplified example; actual implementation would depend on provider URL structure
-	return fmt.Sprintf("%s/%s", baseEndpoint, region)
+// WithContext applies a context timeout to an existing context.
+func WithContext(parent context.Context, timeoutSec int) (context.Context, context.CancelFunc) {
+	if timeoutSec <= 0 {
+		timeoutSec = DefaultTimeoutSeconds
+	}
+	return context.WithTimeout(parent, time.Duration(timeoutSec)*time.Second)
 }
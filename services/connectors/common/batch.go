@@ -0,0 +1,107 @@
+package common
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/nexen/models"
+	"github.com/nexen/services/connectors/parallel"
+)
+
+// DefaultBatchConcurrency is the number of requests a batch runs at once when not configured.
+const DefaultBatchConcurrency = 4
+
+// Result is the outcome of one request in a batch.
+type Result struct {
+	// Response is the model's response, or nil if the request failed.
+	Response *models.LLMResponse
+
+	// Err is the request's error, if any.
+	Err error
+}
+
+// CallFunc sends a single request, such as an LLM's Call method.
+type CallFunc func(ctx context.Context, request *models.LLMRequest) (*models.LLMResponse, error)
+
+// ExecuteBatch calls call for every request with at most concurrency requests in flight and
+// returns one Result per request, in request order. A failed request does not stop the
+// others. Once ctx is done, requests that have not started fail with ctx's error.
+func ExecuteBatch(ctx context.Context, requests []*models.LLMRequest, concurrency int, call CallFunc) []Result {
+	if concurrency <= 0 {
+		concurrency = DefaultBatchConcurrency
+	}
+	outcomes := parallel.Map(ctx, requests, concurrency, func(ctx context.Context, _ int, request *models.LLMRequest) (*models.LLMResponse, error) {
+		return call(ctx, request)
+	})
+	results := make([]Result, len(outcomes))
+	for i, outcome := range outcomes {
+		results[i] = Result{Response: outcome.Value, Err: outcome.Err}
+	}
+	return results
+}
+
+// BatchCall implements LLM.BatchCall on top of ExecuteBatch. The returned slice has one
+// entry per request, nil where the request failed; if any failed, the error is a *BatchError.
+func BatchCall(ctx context.Context, requests []*models.LLMRequest, concurrency int, call CallFunc) ([]*models.LLMResponse, error) {
+	return Responses(ExecuteBatch(ctx, requests, concurrency, call))
+}
+
+// Responses converts batch results to BatchCall's return values: one response per result, nil
+// where the result failed, and a *BatchError if any did.
+func Responses(results []Result) ([]*models.LLMResponse, error) {
+	responses := make([]*models.LLMResponse, len(results))
+	batchErr := &BatchError{Total: len(results)}
+	for i, result := range results {
+		responses[i] = result.Response
+		if result.Err != nil {
+			if batchErr.Errors == nil {
+				batchErr.Errors = make(map[int]error)
+			}
+			batchErr.Errors[i] = result.Err
+		}
+	}
+	if len(batchErr.Errors) > 0 {
+		return responses, batchErr
+	}
+	return responses, nil
+}
+
+// BatchError reports the requests of a batch that failed.
+type BatchError struct {
+	// Total is the number of requests in the batch.
+	Total int
+
+	// Errors maps the index of each failed request to its error.
+	Errors map[int]error
+}
+
+// Error implements the error interface.
+func (e *BatchError) Error() string {
+	indexes := e.failed()
+	msgs := make([]string, 0, len(indexes))
+	for _, i := range indexes {
+		msgs = append(msgs, fmt.Sprintf("request %d: %v", i, e.Errors[i]))
+	}
+	return fmt.Sprintf("%d of %d requests failed: %s", len(indexes), e.Total, strings.Join(msgs, "; "))
+}
+
+// Unwrap returns the request errors in index order, so errors.Is matches any of them.
+func (e *BatchError) Unwrap() []error {
+	indexes := e.failed()
+	errs := make([]error, 0, len(indexes))
+	for _, i := range indexes {
+		errs = append(errs, e.Errors[i])
+	}
+	return errs
+}
+
+func (e *BatchError) failed() []int {
+	indexes := make([]int, 0, len(e.Errors))
+	for i := range e.Errors {
+		indexes = append(indexes, i)
+	}
+	sort.Ints(indexes)
+	return indexes
+}
@@ -0,0 +1,89 @@
+package common
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/nexen/models"
+)
+
+func batchRequests(messages ...string) []*models.LLMRequest {
+	requests := make([]*models.LLMRequest, len(messages))
+	for i, message := range messages {
+		requests[i] = &models.LLMRequest{Model: "batch", Contents: []models.Content{{Role: "user", Message: message}}}
+	}
+	return requests
+}
+
+func TestExecuteBatchBoundsConcurrency(t *testing.T) {
+	var inFlight, peak atomic.Int32
+	call := func(ctx context.Context, request *models.LLMRequest) (*models.LLMResponse, error) {
+		n := inFlight.Add(1)
+		defer inFlight.Add(-1)
+		for {
+			p := peak.Load()
+			if n <= p || peak.CompareAndSwap(p, n) {
+				break
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+		return &models.LLMResponse{Content: &models.Content{Message: request.Contents[0].Message}}, nil
+	}
+
+	results := ExecuteBatch(context.Background(), batchRequests("a", "b", "c", "d", "e", "f"), 2, call)
+	if peak.Load() != 2 {
+		t.Errorf("Expected at most 2 requests in flight, saw %d", peak.Load())
+	}
+	for i, want := range []string{"a", "b", "c", "d", "e", "f"} {
+		if results[i].Err != nil || results[i].Response.Content.Message != want {
+			t.Errorf("Result %d = %+v, want %q", i, results[i], want)
+		}
+	}
+}
+
+func TestBatchCallReportsPerItemErrors(t *testing.T) {
+	failure := errors.New("boom")
+	call := func(ctx context.Context, request *models.LLMRequest) (*models.LLMResponse, error) {
+		if request.Contents[0].Message == "bad" {
+			return nil, failure
+		}
+		return &models.LLMResponse{}, nil
+	}
+
+	responses, err := BatchCall(context.Background(), batchRequests("ok", "bad", "ok"), 3, call)
+	var batchErr *BatchError
+	if !errors.As(err, &batchErr) {
+		t.Fatalf("Expected *BatchError, got %v", err)
+	}
+	if len(batchErr.Errors) != 1 || batchErr.Errors[1] != failure || !errors.Is(err, failure) {
+		t.Errorf("Unexpected batch errors %v", batchErr.Errors)
+	}
+	if responses[0] == nil || responses[1] != nil || responses[2] == nil {
+		t.Errorf("Expected the other requests to complete, got %v", responses)
+	}
+
+	if _, err := BatchCall(context.Background(), batchRequests("ok"), 1, call); err != nil {
+		t.Errorf("Expected no error, got %v", err)
+	}
+}
+
+func TestExecuteBatchStopsOnCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	var calls atomic.Int32
+	call := func(ctx context.Context, request *models.LLMRequest) (*models.LLMResponse, error) {
+		calls.Add(1)
+		cancel()
+		return &models.LLMResponse{}, nil
+	}
+
+	results := ExecuteBatch(ctx, batchRequests("a", "b", "c"), 1, call)
+	if calls.Load() != 1 {
+		t.Errorf("Expected requests after cancellation not to start, got %d calls", calls.Load())
+	}
+	if results[0].Err != nil || !errors.Is(results[2].Err, context.Canceled) {
+		t.Errorf("Unexpected results %+v", results)
+	}
+}
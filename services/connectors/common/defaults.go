@@ -0,0 +1,35 @@
+package common
+
+import "github.com/nexen/models"
+
+// ApplyDefaults returns a copy of request whose unset generation settings are taken from
+// defaults, such as the defaults configured for a gateway route or profile. Values set on
+// the request always win; as elsewhere in GenerateContentConfig, a zero value means unset.
+// The caller's request is not modified.
+func ApplyDefaults(request *models.LLMRequest, defaults *models.GenerateContentConfig) *models.LLMRequest {
+	if defaults == nil {
+		return request
+	}
+	merged := *request
+	config := *defaults
+	if request.Config != nil {
+		config = *request.Config
+		if config.SystemInstruction == "" {
+			config.SystemInstruction = defaults.SystemInstruction
+		}
+		if config.Temperature == 0 {
+			config.Temperature = defaults.Temperature
+		}
+		if config.TopP == 0 {
+			config.TopP = defaults.TopP
+		}
+		if config.MaxTokens == 0 {
+			config.MaxTokens = defaults.MaxTokens
+		}
+		if len(config.StopSequences) == 0 {
+			config.StopSequences = defaults.StopSequences
+		}
+	}
+	merged.Config = &config
+	return &merged
+}
@@ -0,0 +1,41 @@
+package common
+
+import (
+	"testing"
+
+	"github.com/nexen/models"
+)
+
+func TestApplyDefaults(t *testing.T) {
+	defaults := &models.GenerateContentConfig{
+		SystemInstruction: "Be concise.",
+		Temperature:       0.2,
+		MaxTokens:         512,
+		StopSequences:     []string{"END"},
+	}
+
+	request := &models.LLMRequest{
+		Model:  "gpt-4",
+		Config: &models.GenerateContentConfig{Temperature: 0.9, ToolChoice: "auto"},
+	}
+	merged := ApplyDefaults(request, defaults)
+	config := merged.Config
+	if config.Temperature != 0.9 || config.ToolChoice != "auto" {
+		t.Errorf("Expected request values to win, got %+v", config)
+	}
+	if config.SystemInstruction != "Be concise." || config.MaxTokens != 512 || len(config.StopSequences) != 1 {
+		t.Errorf("Expected unset values from defaults, got %+v", config)
+	}
+	if request.Config.MaxTokens != 0 || request.Config.SystemInstruction != "" {
+		t.Error("Caller's request should not be modified")
+	}
+
+	bare := ApplyDefaults(&models.LLMRequest{Model: "gpt-4"}, defaults)
+	if bare.Config == defaults || bare.Config.MaxTokens != 512 {
+		t.Errorf("Expected a copy of the defaults, got %+v", bare.Config)
+	}
+
+	if ApplyDefaults(request, nil) != request {
+		t.Error("Expected nil defaults to return the request unchanged")
+	}
+}
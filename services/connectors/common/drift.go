@@ -0,0 +1,245 @@
+package common
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// DriftKind classifies a difference between a provider response and the schema a connector
+// was written against.
+type DriftKind string
+
+const (
+	// DriftUnknownField is a response field the connector does not decode.
+	DriftUnknownField DriftKind = "unknown_field"
+
+	// DriftUnknownValue is an enum value, such as a finish reason, the connector does not handle.
+	DriftUnknownValue DriftKind = "unknown_value"
+
+	// DriftTypeMismatch is a field whose JSON type differs from the expected one.
+	// The field is left at its zero value and the rest of the response is still decoded.
+	DriftTypeMismatch DriftKind = "type_mismatch"
+)
+
+// Drift records one unexpected element of a provider response.
+type Drift struct {
+	// Provider is the provider name, e.g. "openai".
+	Provider string
+
+	// Kind is the kind of drift.
+	Kind DriftKind
+
+	// Field is the dotted JSON path of the field, e.g. "choices.message.refusal".
+	Field string
+
+	// Value is the unexpected enum value, or the JSON type received for a type mismatch.
+	Value string
+}
+
+var (
+	driftMu      sync.Mutex
+	driftCounts  = make(map[Drift]int64)
+	driftHandler = logDrift
+)
+
+// SetDriftHandler replaces the function called the first time each distinct Drift is seen.
+// The default logs a warning with log/slog; nil disables notification. Counts are kept
+// regardless and are available from DriftCounts.
+func SetDriftHandler(handler func(Drift)) {
+	driftMu.Lock()
+	defer driftMu.Unlock()
+	driftHandler = handler
+}
+
+// DriftCounts returns how many times each drift has been seen since the process started.
+func DriftCounts() map[Drift]int64 {
+	driftMu.Lock()
+	defer driftMu.Unlock()
+	counts := make(map[Drift]int64, len(driftCounts))
+	for d, n := range driftCounts {
+		counts[d] = n
+	}
+	return counts
+}
+
+// ReportDrift counts d and notifies the drift handler if d has not been seen before.
+func ReportDrift(d Drift) {
+	driftMu.Lock()
+	driftCounts[d]++
+	first := driftCounts[d] == 1
+	handler := driftHandler
+	driftMu.Unlock()
+
+	if first && handler != nil {
+		handler(d)
+	}
+}
+
+func logDrift(d Drift) {
+	slog.Warn("provider response schema drift",
+		"provider", d.Provider, "kind", string(d.Kind), "field", d.Field, "value", d.Value)
+}
+
+// CheckValue reports whether value is one of known. An unknown, non-empty value is reported
+// as DriftUnknownValue so new enum values show up before connectors are updated for them.
+func CheckValue(provider, field, value string, known ...string) bool {
+	if value == "" {
+		return true
+	}
+	for _, k := range known {
+		if value == k {
+			return true
+		}
+	}
+	ReportDrift(Drift{Provider: provider, Kind: DriftUnknownValue, Field: field, Value: value})
+	return false
+}
+
+// DecodeLenient unmarshals a provider response into v without failing on schema drift.
+// Unknown fields are ignored and reported. A field whose JSON type changed is left unset and
+// reported, and the rest of the response is still decoded. Malformed JSON is an error.
+func DecodeLenient(provider string, data []byte, v any) error {
+	err := json.Unmarshal(data, v)
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &typeErr) {
+		ReportDrift(Drift{Provider: provider, Kind: DriftTypeMismatch, Field: stripIndexes(typeErr.Field), Value: typeErr.Value})
+		err = nil
+	}
+	if err != nil {
+		return err
+	}
+
+	ReportUnknownFields(provider, data, v)
+	return nil
+}
+
+// ReportUnknownFields reports every field in data that has no matching json-tagged field
+// in v. Use it when a response was decoded by a provider SDK rather than DecodeLenient.
+func ReportUnknownFields(provider string, data []byte, v any) {
+	for _, field := range UnknownFields(data, v) {
+		ReportDrift(Drift{Provider: provider, Kind: DriftUnknownField, Field: field})
+	}
+}
+
+// UnknownFields returns the sorted dotted paths of fields in data that do not map to a field
+// of v's type. Array elements share their parent's path. Invalid JSON yields no fields.
+func UnknownFields(data []byte, v any) []string {
+	var raw any
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil
+	}
+
+	found := make(map[string]bool)
+	collectUnknownFields(raw, reflect.TypeOf(v), "", found)
+
+	fields := make([]string, 0, len(found))
+	for field := range found {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+	return fields
+}
+
+var rawMessageType = reflect.TypeOf(json.RawMessage(nil))
+
+// collectUnknownFields walks raw alongside t, recording paths of object keys t does not declare.
+func collectUnknownFields(raw any, t reflect.Type, path string, found map[string]bool) {
+	for t != nil && t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t == nil || t == rawMessageType {
+		return
+	}
+
+	switch value := raw.(type) {
+	case []any:
+		if t.Kind() != reflect.Slice && t.Kind() != reflect.Array {
+			return
+		}
+		for _, elem := range value {
+			collectUnknownFields(elem, t.Elem(), path, found)
+		}
+	case map[string]any:
+		switch t.Kind() {
+		case reflect.Map:
+			for key, elem := range value {
+				collectUnknownFields(elem, t.Elem(), joinPath(path, key), found)
+			}
+		case reflect.Struct:
+			for key, elem := range value {
+				fieldType, ok := jsonField(t, key)
+				if !ok {
+					found[joinPath(path, key)] = true
+					continue
+				}
+				collectUnknownFields(elem, fieldType, joinPath(path, key), found)
+			}
+		}
+	}
+}
+
+// jsonField returns the type of the struct field encoding/json would decode key into.
+func jsonField(t reflect.Type, key string) (reflect.Type, bool) {
+	var folded reflect.Type
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("json")
+		if field.Anonymous && tag == "" {
+			// Fields of embedded structs are promoted
+			embedded := field.Type
+			if embedded.Kind() == reflect.Pointer {
+				embedded = embedded.Elem()
+			}
+			if embedded.Kind() == reflect.Struct {
+				if fieldType, ok := jsonField(embedded, key); ok {
+					return fieldType, true
+				}
+				continue
+			}
+		}
+		if !field.IsExported() {
+			continue
+		}
+		name := field.Name
+		if tag != "" {
+			if tag == "-" {
+				continue
+			}
+			if tagName, _, _ := strings.Cut(tag, ","); tagName != "" {
+				name = tagName
+			}
+		}
+		if name == key {
+			return field.Type, true
+		}
+		if folded == nil && strings.EqualFold(name, key) {
+			folded = field.Type
+		}
+	}
+	return folded, folded != nil
+}
+
+// stripIndexes removes array indexes from a dotted path so elements share their parent's path.
+func stripIndexes(path string) string {
+	segments := strings.Split(path, ".")
+	kept := segments[:0]
+	for _, segment := range segments {
+		if _, err := strconv.Atoi(segment); err != nil {
+			kept = append(kept, segment)
+		}
+	}
+	return strings.Join(kept, ".")
+}
+
+func joinPath(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
@@ -0,0 +1,95 @@
+package common
+
+import (
+	"reflect"
+	"testing"
+)
+
+type driftUsage struct {
+	PromptTokens int `json:"prompt_tokens"`
+}
+
+type driftBase struct {
+	ID string `json:"id"`
+}
+
+type driftResponse struct {
+	driftBase
+	Choices []struct {
+		Message struct {
+			Content string `json:"content"`
+		} `json:"message"`
+	} `json:"choices"`
+	Usage    *driftUsage       `json:"usage"`
+	Metadata map[string]string `json:"metadata"`
+}
+
+func TestUnknownFields(t *testing.T) {
+	data := []byte(`{
+		"id": "x",
+		"object": "chat.completion",
+		"choices": [{"message": {"content": "hi", "refusal": null}}, {"message": {"Content": "ok"}}],
+		"usage": {"prompt_tokens": 1, "prompt_tokens_details": {"cached_tokens": 0}},
+		"metadata": {"anything": "goes"}
+	}`)
+
+	got := UnknownFields(data, &driftResponse{})
+	want := []string{"choices.message.refusal", "object", "usage.prompt_tokens_details"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("UnknownFields() = %v, want %v", got, want)
+	}
+}
+
+func TestDecodeLenient(t *testing.T) {
+	var seen []Drift
+	SetDriftHandler(func(d Drift) { seen = append(seen, d) })
+	defer SetDriftHandler(logDrift)
+
+	// content changed from a string to an array of parts
+	data := []byte(`{"id":"x","choices":[{"message":{"content":[{"type":"text"}]}}],"usage":{"prompt_tokens":3},"extra":1}`)
+	var resp driftResponse
+	if err := DecodeLenient("drift-test", data, &resp); err != nil {
+		t.Fatalf("DecodeLenient() error = %v", err)
+	}
+	if resp.ID != "x" || resp.Usage == nil || resp.Usage.PromptTokens != 3 {
+		t.Errorf("Expected remaining fields to be decoded, got %+v", resp)
+	}
+
+	want := []Drift{
+		{Provider: "drift-test", Kind: DriftTypeMismatch, Field: "choices.message.content", Value: "array"},
+		{Provider: "drift-test", Kind: DriftUnknownField, Field: "extra"},
+	}
+	if !reflect.DeepEqual(seen, want) {
+		t.Errorf("Reported %+v, want %+v", seen, want)
+	}
+
+	if err := DecodeLenient("drift-test", []byte(`{"id":`), &resp); err == nil {
+		t.Error("Expected malformed JSON to fail")
+	}
+}
+
+func TestCheckValue(t *testing.T) {
+	var seen []Drift
+	SetDriftHandler(func(d Drift) { seen = append(seen, d) })
+	defer SetDriftHandler(logDrift)
+
+	if !CheckValue("drift-enum", "finish_reason", "stop", "stop", "length") {
+		t.Error("Expected known value to pass")
+	}
+	if !CheckValue("drift-enum", "finish_reason", "", "stop") {
+		t.Error("Expected empty value to pass")
+	}
+	for i := 0; i < 3; i++ {
+		if CheckValue("drift-enum", "finish_reason", "paused", "stop", "length") {
+			t.Error("Expected unknown value to fail")
+		}
+	}
+
+	if len(seen) != 1 {
+		t.Errorf("Expected the handler to be called once per distinct drift, got %d calls", len(seen))
+	}
+	d := Drift{Provider: "drift-enum", Kind: DriftUnknownValue, Field: "finish_reason", Value: "paused"}
+	if n := DriftCounts()[d]; n != 3 {
+		t.Errorf("Expected 3 occurrences counted, got %d", n)
+	}
+}
@@ -0,0 +1,166 @@
+package common
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/nexen/libs/nexenctx"
+)
+
+// redacted replaces credentials in request dumps.
+const redacted = "REDACTED"
+
+// RequestDump configures writing the exact requests sent to a provider to files, so reports
+// of wrong parameters can be reproduced. It is a debugging aid and is off by default.
+type RequestDump struct {
+	// Dir is the directory dumps are written to. Empty disables dumping.
+	Dir string
+}
+
+// WithRequestDump writes every provider request to a file in dir named after the request ID
+// of its context (see nexenctx.WithRequestID). Requests without an ID get a random one.
+// Credentials are redacted.
+func WithRequestDump(dir string) Option {
+	return func(config *LLMConfig) error {
+		config.RequestDump = RequestDump{Dir: dir}
+		return nil
+	}
+}
+
+// dumpedRequest is the file format of a request dump.
+type dumpedRequest struct {
+	Method string              `json:"method"`
+	URL    string              `json:"url"`
+	Header map[string][]string `json:"header"`
+	Body   json.RawMessage     `json:"body,omitempty"`
+}
+
+// DumpRequest writes req to dump.Dir as <request ID>.json, or <request ID>-<n>.json for
+// later provider requests of the same request such as retries. Header and query values that
+// carry credentials are redacted. The body of req is left unread. Failures are logged and
+// otherwise ignored so dumping never fails a call.
+func DumpRequest(dump RequestDump, req *http.Request) {
+	if dump.Dir == "" {
+		return
+	}
+	if err := dumpRequest(dump, req); err != nil {
+		slog.Warn("dumping provider request", "error", err)
+	}
+}
+
+func dumpRequest(dump RequestDump, req *http.Request) error {
+	body, err := requestBody(req)
+	if err != nil {
+		return err
+	}
+
+	u := *req.URL
+	query := u.Query()
+	for name := range query {
+		if isSecret(name) {
+			query.Set(name, redacted)
+		}
+	}
+	u.RawQuery = query.Encode()
+
+	header := make(map[string][]string, len(req.Header))
+	for name, values := range req.Header {
+		if isSecret(name) {
+			values = []string{redacted}
+		}
+		header[name] = values
+	}
+
+	d := dumpedRequest{Method: req.Method, URL: u.String(), Header: header}
+	if len(body) > 0 {
+		if json.Valid(body) {
+			d.Body = body
+		} else if d.Body, err = json.Marshal(string(body)); err != nil {
+			return err
+		}
+	}
+	data, err := json.Marshal(d)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(dump.Dir, 0o755); err != nil {
+		return err
+	}
+	id := dumpID(req.Context())
+	for n := 0; ; n++ {
+		name := id + ".json"
+		if n > 0 {
+			name = fmt.Sprintf("%s-%d.json", id, n)
+		}
+		f, err := os.OpenFile(filepath.Join(dump.Dir, name), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+		if errors.Is(err, fs.ErrExist) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		_, err = f.Write(data)
+		if closeErr := f.Close(); err == nil {
+			err = closeErr
+		}
+		return err
+	}
+}
+
+// requestBody returns a copy of the body of req, restoring req.Body if it had to be read.
+func requestBody(req *http.Request) ([]byte, error) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return nil, nil
+	}
+	if req.GetBody != nil {
+		body, err := req.GetBody()
+		if err != nil {
+			return nil, err
+		}
+		defer body.Close()
+		return io.ReadAll(body)
+	}
+	data, err := io.ReadAll(req.Body)
+	req.Body.Close()
+	req.Body = io.NopCloser(bytes.NewReader(data))
+	return data, err
+}
+
+// isSecret reports whether a header or query parameter name suggests a credential.
+func isSecret(name string) bool {
+	name = strings.ToLower(name)
+	for _, word := range []string{"auth", "key", "token", "secret", "cookie"} {
+		if strings.Contains(name, word) {
+			return true
+		}
+	}
+	return false
+}
+
+// dumpID returns the request ID from ctx made safe for use as a file name, or a random ID.
+func dumpID(ctx context.Context) string {
+	if id, ok := nexenctx.RequestIDFrom(ctx); ok {
+		return strings.Map(func(r rune) rune {
+			if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-' || r == '_' || r == '.' {
+				return r
+			}
+			return '_'
+		}, id)
+	}
+	b := make([]byte, 8)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
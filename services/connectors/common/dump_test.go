@@ -0,0 +1,70 @@
+package common
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/nexen/libs/nexenctx"
+)
+
+func TestDumpRequest(t *testing.T) {
+	dir := t.TempDir()
+	dump := RequestDump{Dir: filepath.Join(dir, "dumps")}
+	ctx := nexenctx.WithRequestID(context.Background(), "req/42")
+
+	newRequest := func() *http.Request {
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, "https://api.example.test/v1/generate?key=secret-key&alt=json", strings.NewReader(`{"model":"m","temperature":0.2}`))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Authorization", "Bearer secret-token")
+		req.Header.Set("X-Api-Key", "secret-key")
+		req.Header.Set("Content-Type", "application/json")
+		return req
+	}
+
+	req := newRequest()
+	DumpRequest(dump, req)
+	DumpRequest(dump, newRequest())
+
+	// The request body is still readable after dumping
+	body, _ := io.ReadAll(req.Body)
+	if string(body) != `{"model":"m","temperature":0.2}` {
+		t.Errorf("Request body was consumed: %q", body)
+	}
+
+	data, err := os.ReadFile(filepath.Join(dump.Dir, "req_42.json"))
+	if err != nil {
+		t.Fatalf("Expected a dump named after the request ID: %v", err)
+	}
+	if strings.Contains(string(data), "secret") {
+		t.Errorf("Dump contains credentials:\n%s", data)
+	}
+	var d dumpedRequest
+	if err := json.Unmarshal(data, &d); err != nil {
+		t.Fatalf("Invalid dump: %v", err)
+	}
+	if d.Method != http.MethodPost || !strings.Contains(d.URL, "alt=json") || d.Header["Content-Type"][0] != "application/json" {
+		t.Errorf("Unexpected dump %+v", d)
+	}
+	if string(d.Body) != `{"model":"m","temperature":0.2}` {
+		t.Errorf("Expected the body verbatim, got %s", d.Body)
+	}
+
+	if _, err := os.Stat(filepath.Join(dump.Dir, "req_42-1.json")); err != nil {
+		t.Errorf("Expected a second dump for the retried request: %v", err)
+	}
+
+	// Without a directory nothing is written
+	DumpRequest(RequestDump{}, newRequest())
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 1 {
+		t.Errorf("Expected only the dump directory, got %d entries", len(entries))
+	}
+}
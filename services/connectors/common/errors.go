@@ -0,0 +1,156 @@
+package common
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Error classes shared by all connectors. Provider errors wrap one of these so routing and
+// fallback logic can branch with errors.Is regardless of which provider failed.
+var (
+	// ErrRateLimited means the provider throttled the request; retry later or elsewhere.
+	ErrRateLimited = errors.New("rate limited")
+
+	// ErrAuth means the API key is missing, invalid, or lacks permission.
+	ErrAuth = errors.New("authentication failed")
+
+	// ErrContextLengthExceeded means the prompt plus requested output exceeds the model's window.
+	ErrContextLengthExceeded = errors.New("context length exceeded")
+
+	// ErrContentFiltered means the provider refused the request or response on policy grounds.
+	ErrContentFiltered = errors.New("content filtered")
+
+	// ErrProviderUnavailable means the provider is down, overloaded, or unreachable.
+	ErrProviderUnavailable = errors.New("provider unavailable")
+)
+
+// ProviderError is an error returned by a provider's API.
+type ProviderError struct {
+	// Provider is the provider name, e.g. "openai".
+	Provider string
+
+	// StatusCode is the HTTP status code, or 0 if no response was received.
+	StatusCode int
+
+	// Code is the provider's error type or code, e.g. "rate_limit_error".
+	Code string
+
+	// Message is the provider's error message.
+	Message string
+
+	// RetryAfter is the delay requested by the provider, if any.
+	RetryAfter time.Duration
+
+	// Class is one of the Err* error classes, or nil if the error is unclassified.
+	Class error
+
+	// Err is the underlying error, if any.
+	Err error
+}
+
+// Error implements the error interface.
+func (e *ProviderError) Error() string {
+	var sb strings.Builder
+	sb.WriteString(e.Provider)
+	sb.WriteString(" API error")
+	if e.StatusCode != 0 {
+		fmt.Fprintf(&sb, " (status %d)", e.StatusCode)
+	}
+	if e.Class != nil {
+		fmt.Fprintf(&sb, ": %v", e.Class)
+	}
+	if e.Message != "" {
+		fmt.Fprintf(&sb, ": %s", e.Message)
+	} else if e.Err != nil {
+		fmt.Fprintf(&sb, ": %v", e.Err)
+	}
+	return sb.String()
+}
+
+// Unwrap returns the error class and the underlying error.
+func (e *ProviderError) Unwrap() []error {
+	var errs []error
+	if e.Class != nil {
+		errs = append(errs, e.Class)
+	}
+	if e.Err != nil {
+		errs = append(errs, e.Err)
+	}
+	return errs
+}
+
+// NewProviderError builds a ProviderError for an HTTP error response and classifies it from
+// the status code, then from the provider's error code and message.
+func NewProviderError(provider string, statusCode int, code, message string) *ProviderError {
+	return &ProviderError{
+		Provider:   provider,
+		StatusCode: statusCode,
+		Code:       code,
+		Message:    message,
+		Class:      Classify(statusCode, code, message),
+	}
+}
+
+// Classify maps an HTTP status code and provider error code/message to an error class.
+// It returns nil if the error does not belong to a known class.
+func Classify(statusCode int, code, message string) error {
+	text := strings.ToLower(code + " " + message)
+	switch {
+	case strings.Contains(text, "context_length"), strings.Contains(text, "context length"),
+		strings.Contains(text, "too many tokens"), strings.Contains(text, "prompt is too long"):
+		return ErrContextLengthExceeded
+	case strings.Contains(text, "content_filter"), strings.Contains(text, "content_policy"),
+		strings.Contains(text, "safety"):
+		return ErrContentFiltered
+	}
+
+	switch statusCode {
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return ErrAuth
+	case http.StatusTooManyRequests:
+		return ErrRateLimited
+	case http.StatusRequestEntityTooLarge:
+		return ErrContextLengthExceeded
+	case http.StatusInternalServerError, http.StatusBadGateway, http.StatusServiceUnavailable,
+		http.StatusGatewayTimeout, 529: // 529: Anthropic "overloaded"
+		return ErrProviderUnavailable
+	}
+	return nil
+}
+
+// TransportError wraps an error from sending a request, such as a dial failure or timeout.
+// Network failures are classified as ErrProviderUnavailable; context cancellation is not.
+func TransportError(provider string, err error) error {
+	if errors.Is(err, context.Canceled) {
+		return err
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) || errors.Is(err, context.DeadlineExceeded) {
+		return &ProviderError{Provider: provider, Class: ErrProviderUnavailable, Err: err}
+	}
+	return &ProviderError{Provider: provider, Err: err}
+}
+
+// ParseRetryAfter parses a Retry-After header given in seconds or as an HTTP date.
+// It returns 0 if the header is empty or invalid.
+func ParseRetryAfter(header string) time.Duration {
+	header = strings.TrimSpace(header)
+	if header == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(header); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if at, err := http.ParseTime(header); err == nil {
+		if d := time.Until(at); d > 0 {
+			return d
+		}
+	}
+	return 0
+}
@@ -0,0 +1,146 @@
+package common
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestClassify(t *testing.T) {
+	testCases := []struct {
+		status  int
+		code    string
+		message string
+		want    error
+	}{
+		{http.StatusUnauthorized, "", "", ErrAuth},
+		{http.StatusTooManyRequests, "", "", ErrRateLimited},
+		{http.StatusBadGateway, "", "", ErrProviderUnavailable},
+		{http.StatusBadRequest, "context_length_exceeded", "", ErrContextLengthExceeded},
+		{http.StatusBadRequest, "", "This model's maximum context length is 8192 tokens", ErrContextLengthExceeded},
+		{http.StatusBadRequest, "content_filter", "", ErrContentFiltered},
+		{http.StatusBadRequest, "invalid_request_error", "bad temperature", nil},
+	}
+
+	for _, tc := range testCases {
+		if got := Classify(tc.status, tc.code, tc.message); got != tc.want {
+			t.Errorf("Classify(%d, %q, %q) = %v, want %v", tc.status, tc.code, tc.message, got, tc.want)
+		}
+	}
+}
+
+func TestTransportError(t *testing.T) {
+	dialErr := &net.OpError{Op: "dial", Err: errors.New("connection refused")}
+	if err := TransportError("openai", dialErr); !errors.Is(err, ErrProviderUnavailable) || !errors.Is(err, dialErr) {
+		t.Errorf("Expected dial failure to be ErrProviderUnavailable, got %v", err)
+	}
+	if err := TransportError("openai", context.Canceled); err != context.Canceled {
+		t.Errorf("Expected cancellation to pass through, got %v", err)
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	if got := ParseRetryAfter("3"); got != 3*time.Second {
+		t.Errorf("Expected 3s, got %v", got)
+	}
+	if got := ParseRetryAfter(time.Now().Add(time.Minute).UTC().Format(http.TimeFormat)); got <= 0 || got > time.Minute {
+		t.Errorf("Expected up to a minute, got %v", got)
+	}
+	if got := ParseRetryAfter("soon"); got != 0 {
+		t.Errorf("Expected 0 for invalid header, got %v", got)
+	}
+}
+
+func TestCalculateBackoff(t *testing.T) {
+	config := RetryConfig{MinBackoff: 100, MaxBackoff: 1000, Jitter: func() float64 { return 0.5 }}
+
+	testCases := []struct {
+		attempt int
+		want    time.Duration
+	}{
+		{0, 50 * time.Millisecond},
+		{1, 100 * time.Millisecond},
+		{3, 400 * time.Millisecond},
+		{10, 500 * time.Millisecond}, // capped at MaxBackoff
+	}
+	for _, tc := range testCases {
+		if got := CalculateBackoff(tc.attempt, config); got != tc.want {
+			t.Errorf("CalculateBackoff(%d) = %v, want %v", tc.attempt, got, tc.want)
+		}
+	}
+
+	config.Jitter = nil
+	seen := make(map[time.Duration]bool)
+	for i := 0; i < 20; i++ {
+		got := CalculateBackoff(2, config)
+		if got < 0 || got >= 400*time.Millisecond {
+			t.Fatalf("Expected backoff in [0, 400ms), got %v", got)
+		}
+		seen[got] = true
+	}
+	if len(seen) < 2 {
+		t.Error("Expected default jitter to vary between calls")
+	}
+}
+
+func TestDoWithRetry(t *testing.T) {
+	config := RetryConfig{MaxRetries: 2, MinBackoff: 1, MaxBackoff: 2, StatusCodesToRetry: DefaultRetryStatusCodes}
+
+	testCases := []struct {
+		name     string
+		err      error
+		attempts int
+	}{
+		{"retryable status", NewProviderError("p", http.StatusServiceUnavailable, "", ""), 3},
+		{"non-retryable status", NewProviderError("p", http.StatusUnauthorized, "", ""), 1},
+		{"network failure", TransportError("p", &net.OpError{Op: "dial", Err: errors.New("refused")}), 3},
+		{"plain error", errors.New("bad request"), 1},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			attempts := 0
+			err := DoWithRetry(context.Background(), config, func(ctx context.Context) error {
+				attempts++
+				return tc.err
+			})
+			if err != tc.err {
+				t.Errorf("Expected last error to be returned, got %v", err)
+			}
+			if attempts != tc.attempts {
+				t.Errorf("Expected %d attempts, got %d", tc.attempts, attempts)
+			}
+		})
+	}
+
+	attempts := 0
+	err := DoWithRetry(context.Background(), config, func(ctx context.Context) error {
+		attempts++
+		if attempts < 2 {
+			return NewProviderError("p", http.StatusTooManyRequests, "", "")
+		}
+		return nil
+	})
+	if err != nil || attempts != 2 {
+		t.Errorf("Expected success on second attempt, got %v after %d", err, attempts)
+	}
+}
+
+func TestDoWithRetryStopsOnCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	config := RetryConfig{MaxRetries: 5, MinBackoff: 10000, MaxBackoff: 10000, StatusCodesToRetry: DefaultRetryStatusCodes}
+
+	attempts := 0
+	start := time.Now()
+	DoWithRetry(ctx, config, func(ctx context.Context) error {
+		attempts++
+		cancel()
+		return NewProviderError("p", http.StatusServiceUnavailable, "", "")
+	})
+	if attempts != 1 || time.Since(start) > time.Second {
+		t.Errorf("Expected to stop waiting after cancel, got %d attempts in %v", attempts, time.Since(start))
+	}
+}
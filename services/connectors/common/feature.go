@@ -0,0 +1,22 @@
+package common
+
+import "context"
+
+// FeatureGate reports whether the named feature is enabled for the request in ctx, e.g.
+// flags.Flags.Enabled from libs/flags.
+type FeatureGate func(ctx context.Context, name string) bool
+
+// WithFeatureGate gates risky connector behavior, such as a new API, behind feature flags so
+// it can be rolled out gradually. Without a gate every feature is enabled as configured.
+func WithFeatureGate(gate FeatureGate) Option {
+	return func(config *LLMConfig) error {
+		config.FeatureGate = gate
+		return nil
+	}
+}
+
+// FeatureEnabled reports whether the named feature is enabled for the request in ctx. It is
+// true when config has no feature gate.
+func FeatureEnabled(ctx context.Context, config *LLMConfig, name string) bool {
+	return config.FeatureGate == nil || config.FeatureGate(ctx, name)
+}
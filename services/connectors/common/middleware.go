@@ -0,0 +1,49 @@
+package common
+
+import (
+	"context"
+
+	"github.com/nexen/models"
+)
+
+// Middleware wraps an LLM with cross-cutting behavior such as logging, metrics, caching,
+// guardrails or budget checks. The wrapper packages' constructors fit this shape, e.g.
+//
+//	func(next LLM) LLM { return normalize.Wrap(next, opts) }
+type Middleware func(next LLM) LLM
+
+// Chain wraps llm with mws. The first middleware is the outermost: it sees each request
+// first and each response last.
+func Chain(llm LLM, mws ...Middleware) LLM {
+	for i := len(mws) - 1; i >= 0; i-- {
+		llm = mws[i](llm)
+	}
+	return llm
+}
+
+// Interceptor handles a Call, passing the request on with next.
+type Interceptor func(ctx context.Context, request *models.LLMRequest, next CallFunc) (*models.LLMResponse, error)
+
+// Intercept returns a Middleware that runs interceptor around every Call. Requests of a
+// BatchCall are intercepted one by one and sent as concurrent Calls.
+func Intercept(interceptor Interceptor) Middleware {
+	return func(next LLM) LLM {
+		return &interceptedLLM{LLM: next, interceptor: interceptor}
+	}
+}
+
+// interceptedLLM runs an Interceptor around the wrapped LLM's Call.
+type interceptedLLM struct {
+	LLM
+	interceptor Interceptor
+}
+
+// Call implements the LLM interface Call method.
+func (i *interceptedLLM) Call(ctx context.Context, request *models.LLMRequest) (*models.LLMResponse, error) {
+	return i.interceptor(ctx, request, i.LLM.Call)
+}
+
+// BatchCall implements the LLM interface BatchCall method.
+func (i *interceptedLLM) BatchCall(ctx context.Context, requests []*models.LLMRequest) ([]*models.LLMResponse, error) {
+	return BatchCall(ctx, requests, DefaultBatchConcurrency, i.Call)
+}
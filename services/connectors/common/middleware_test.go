@@ -0,0 +1,62 @@
+package common
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/nexen/models"
+)
+
+// echoLLM replies with the request's first message.
+type echoLLM struct{}
+
+func (echoLLM) Call(ctx context.Context, request *models.LLMRequest) (*models.LLMResponse, error) {
+	return &models.LLMResponse{Content: &models.Content{Role: "assistant", Message: request.Contents[0].Message}}, nil
+}
+
+func (echoLLM) BatchCall(ctx context.Context, requests []*models.LLMRequest) ([]*models.LLMResponse, error) {
+	return nil, errors.New("not used")
+}
+
+func (echoLLM) SupportedModels() []string {
+	return []string{"echo"}
+}
+
+// tag appends name to the request message on the way in and to the response on the way out.
+func tag(name string) Middleware {
+	return Intercept(func(ctx context.Context, request *models.LLMRequest, next CallFunc) (*models.LLMResponse, error) {
+		r := *request
+		r.Contents = []models.Content{{Role: "user", Message: request.Contents[0].Message + ">" + name}}
+		response, err := next(ctx, &r)
+		if err == nil {
+			response.Content.Message += "<" + name
+		}
+		return response, err
+	})
+}
+
+func TestChainOrder(t *testing.T) {
+	llm := Chain(echoLLM{}, tag("outer"), tag("inner"))
+
+	response, err := llm.Call(context.Background(), &models.LLMRequest{Contents: []models.Content{{Role: "user", Message: "req"}}})
+	if err != nil {
+		t.Fatalf("Call failed: %v", err)
+	}
+	if response.Content.Message != "req>outer>inner<inner<outer" {
+		t.Errorf("Unexpected middleware order: %s", response.Content.Message)
+	}
+	if llm.SupportedModels()[0] != "echo" {
+		t.Error("Expected SupportedModels to pass through")
+	}
+
+	responses, err := llm.BatchCall(context.Background(), batchRequests("a", "b"))
+	if err != nil || !strings.HasPrefix(responses[1].Content.Message, "b>outer") {
+		t.Errorf("Expected batch requests to be intercepted, got %v, %v", responses, err)
+	}
+
+	if Chain(echoLLM{}) != (echoLLM{}) {
+		t.Error("Expected Chain without middleware to return the LLM")
+	}
+}
@@ -0,0 +1,224 @@
+package common
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"math"
+	"sync"
+	"time"
+)
+
+// RateLimit caps the throughput of one provider API key. Zero disables a limit.
+type RateLimit struct {
+	// RequestsPerMinute is the maximum number of requests per minute.
+	RequestsPerMinute int
+
+	// TokensPerMinute is the maximum number of prompt plus completion tokens per minute.
+	TokensPerMinute int
+}
+
+// Enabled reports whether any limit is set.
+func (r RateLimit) Enabled() bool {
+	return r.RequestsPerMinute > 0 || r.TokensPerMinute > 0
+}
+
+// RateLimiter is a pair of token buckets, one for requests and one for LLM tokens.
+// Each bucket holds up to one minute of allowance and refills continuously.
+// A nil *RateLimiter never waits. It is safe for concurrent use.
+type RateLimiter struct {
+	mu       sync.Mutex
+	requests bucket
+	tokens   bucket
+
+	// now is replaceable in tests
+	now func() time.Time
+}
+
+// bucket is a token bucket refilled at perMinute per minute up to perMinute.
+type bucket struct {
+	perMinute float64
+	available float64
+	updated   time.Time
+}
+
+// NewRateLimiter creates a limiter that starts with a full minute of allowance.
+func NewRateLimiter(limit RateLimit) *RateLimiter {
+	l := &RateLimiter{now: time.Now}
+	l.SetLimit(limit)
+	return l
+}
+
+// SetLimit changes the limits, keeping the current allowance within the new capacity.
+func (l *RateLimiter) SetLimit(limit RateLimit) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := l.now()
+	l.requests.resize(float64(limit.RequestsPerMinute), now)
+	l.tokens.resize(float64(limit.TokensPerMinute), now)
+}
+
+// Limit returns the current limits.
+func (l *RateLimiter) Limit() RateLimit {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return RateLimit{
+		RequestsPerMinute: int(l.requests.perMinute),
+		TokensPerMinute:   int(l.tokens.perMinute),
+	}
+}
+
+// Wait blocks until one request using the given number of tokens fits within the limits, and
+// reserves it. Token counts above the per-minute limit are treated as one full minute.
+// If ctx is done first, the reservation is released and ctx's error is returned.
+func (l *RateLimiter) Wait(ctx context.Context, tokens int) error {
+	if l == nil {
+		return nil
+	}
+
+	l.mu.Lock()
+	now := l.now()
+	reservedTokens := math.Min(float64(tokens), l.tokens.perMinute)
+	delay := l.requests.take(1, now)
+	if d := l.tokens.take(reservedTokens, now); d > delay {
+		delay = d
+	}
+	l.mu.Unlock()
+
+	if delay <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		l.mu.Lock()
+		l.requests.give(1)
+		l.tokens.give(reservedTokens)
+		l.mu.Unlock()
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// Allow reserves one request using the given number of tokens if it fits within the limits
+// now. Otherwise nothing is reserved and Allow returns false with the time until it would fit.
+// Token counts above the per-minute limit are treated as one full minute.
+func (l *RateLimiter) Allow(tokens int) (bool, time.Duration) {
+	if l == nil {
+		return true, 0
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := l.now()
+	reservedTokens := math.Min(float64(tokens), l.tokens.perMinute)
+	delay := l.requests.take(1, now)
+	if d := l.tokens.take(reservedTokens, now); d > delay {
+		delay = d
+	}
+	if delay <= 0 {
+		return true, 0
+	}
+	l.requests.give(1)
+	l.tokens.give(reservedTokens)
+	return false, delay
+}
+
+// Release gives back a reservation of Allow or Wait for the given number of tokens that was
+// not used.
+func (l *RateLimiter) Release(tokens int) {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := l.now()
+	l.requests.refill(now)
+	l.tokens.refill(now)
+	l.requests.give(1)
+	l.tokens.give(math.Min(float64(tokens), l.tokens.perMinute))
+}
+
+// Adjust corrects the token allowance once the actual usage of a request is known.
+// delta is the actual token count minus the count passed to Wait; it may be negative.
+func (l *RateLimiter) Adjust(delta int) {
+	if l == nil || delta == 0 {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.tokens.refill(l.now())
+	l.tokens.give(-float64(delta))
+}
+
+func (b *bucket) resize(perMinute float64, now time.Time) {
+	if b.updated.IsZero() {
+		b.available = perMinute
+	} else {
+		b.refill(now)
+	}
+	b.perMinute = perMinute
+	b.available = math.Min(b.available, perMinute)
+	b.updated = now
+}
+
+func (b *bucket) refill(now time.Time) {
+	if elapsed := now.Sub(b.updated); elapsed > 0 {
+		b.available = math.Min(b.perMinute, b.available+elapsed.Minutes()*b.perMinute)
+	}
+	b.updated = now
+}
+
+// take removes n from the bucket, which may go negative, and returns how long until the
+// balance is back to zero.
+func (b *bucket) take(n float64, now time.Time) time.Duration {
+	if b.perMinute <= 0 {
+		return 0
+	}
+	b.refill(now)
+	b.available -= n
+	if b.available >= 0 {
+		return 0
+	}
+	return time.Duration(-b.available / b.perMinute * float64(time.Minute))
+}
+
+// give returns n to the bucket, up to its capacity. A negative n charges the bucket.
+func (b *bucket) give(n float64) {
+	if b.perMinute <= 0 {
+		return
+	}
+	b.available = math.Min(b.perMinute, b.available+n)
+}
+
+var (
+	limitersMu sync.Mutex
+	limiters   = make(map[string]*RateLimiter) // provider + key fingerprint -> limiter
+)
+
+// SharedRateLimiter returns the limiter shared by every client of a provider that uses the
+// same API key, creating it if needed, so concurrent clients and BatchCall fan-out draw on
+// one allowance. An existing limiter is updated to limit. It returns nil if limit is disabled.
+func SharedRateLimiter(provider, apiKey string, limit RateLimit) *RateLimiter {
+	if !limit.Enabled() {
+		return nil
+	}
+
+	// Key by a fingerprint so API keys are not kept in the map
+	sum := sha256.Sum256([]byte(apiKey))
+	key := provider + "/" + hex.EncodeToString(sum[:8])
+
+	limitersMu.Lock()
+	defer limitersMu.Unlock()
+	if l, ok := limiters[key]; ok {
+		if l.Limit() != limit {
+			l.SetLimit(limit)
+		}
+		return l
+	}
+	l := NewRateLimiter(limit)
+	limiters[key] = l
+	return l
+}
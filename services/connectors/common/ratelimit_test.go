@@ -0,0 +1,125 @@
+package common
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestRateLimiterRequests(t *testing.T) {
+	now := time.Unix(1000, 0)
+	l := NewRateLimiter(RateLimit{RequestsPerMinute: 2})
+	l.now = func() time.Time { return now }
+
+	// A cancelled context makes Wait fail only when it would have to block
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	for i := 0; i < 2; i++ {
+		if err := l.Wait(cancelled, 0); err != nil {
+			t.Fatalf("Request %d should fit the burst, got %v", i, err)
+		}
+	}
+	if err := l.Wait(cancelled, 0); err == nil {
+		t.Fatal("Expected the third request to wait")
+	}
+
+	// The refused request was released, so half a minute refills exactly one request
+	now = now.Add(30 * time.Second)
+	if err := l.Wait(cancelled, 0); err != nil {
+		t.Errorf("Expected one request after 30s, got %v", err)
+	}
+}
+
+func TestRateLimiterTokens(t *testing.T) {
+	now := time.Unix(1000, 0)
+	l := NewRateLimiter(RateLimit{TokensPerMinute: 1000})
+	l.now = func() time.Time { return now }
+
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if err := l.Wait(cancelled, 800); err != nil {
+		t.Fatalf("Expected 800 tokens to fit, got %v", err)
+	}
+	// Actual usage was lower than estimated
+	l.Adjust(-500)
+	if err := l.Wait(cancelled, 600); err != nil {
+		t.Errorf("Expected refunded tokens to be available, got %v", err)
+	}
+	if err := l.Wait(cancelled, 200); err == nil {
+		t.Error("Expected to wait once the minute's tokens are used")
+	}
+
+	// Requests larger than the limit wait for a full bucket instead of forever
+	now = now.Add(time.Minute)
+	if err := l.Wait(cancelled, 5000); err != nil {
+		t.Errorf("Expected an oversized request to use the full bucket, got %v", err)
+	}
+}
+
+func TestRateLimiterAllow(t *testing.T) {
+	now := time.Unix(1000, 0)
+	l := NewRateLimiter(RateLimit{RequestsPerMinute: 60, TokensPerMinute: 1000})
+	l.now = func() time.Time { return now }
+
+	if ok, _ := l.Allow(800); !ok {
+		t.Fatal("Expected the first request to fit")
+	}
+	ok, retry := l.Allow(400)
+	if ok || retry != 12*time.Second {
+		t.Fatalf("Expected a refusal for 12s, got %v after %v", ok, retry)
+	}
+
+	// The refused request reserved nothing
+	if ok, _ := l.Allow(200); !ok {
+		t.Error("Expected the remaining 200 tokens to be available")
+	}
+
+	// A released reservation is available again
+	l.Release(200)
+	if ok, _ := l.Allow(200); !ok {
+		t.Error("Expected the released tokens to be available")
+	}
+	if ok, _ := (*RateLimiter)(nil).Allow(1 << 20); !ok {
+		t.Error("Expected a nil limiter to allow every request")
+	}
+}
+
+func TestRateLimiterWaits(t *testing.T) {
+	l := NewRateLimiter(RateLimit{RequestsPerMinute: 600}) // one request per 100ms after the burst
+	l.requests.available = 0
+
+	start := time.Now()
+	if err := l.Wait(context.Background(), 0); err != nil {
+		t.Fatalf("Wait() error = %v", err)
+	}
+	if elapsed := time.Since(start); elapsed < 50*time.Millisecond {
+		t.Errorf("Expected Wait to block, returned after %v", elapsed)
+	}
+
+	var nilLimiter *RateLimiter
+	if err := nilLimiter.Wait(context.Background(), 1e9); err != nil {
+		t.Errorf("Expected nil limiter not to wait, got %v", err)
+	}
+}
+
+func TestSharedRateLimiter(t *testing.T) {
+	limit := RateLimit{RequestsPerMinute: 10}
+	a := SharedRateLimiter("ratelimit-test", "key-1", limit)
+	b := SharedRateLimiter("ratelimit-test", "key-1", limit)
+	if a == nil || a != b {
+		t.Error("Expected clients with the same key to share a limiter")
+	}
+	if c := SharedRateLimiter("ratelimit-test", "key-2", limit); c == a {
+		t.Error("Expected different keys to have separate limiters")
+	}
+	if d := SharedRateLimiter("ratelimit-test", "key-1", RateLimit{}); d != nil {
+		t.Error("Expected no limiter without limits")
+	}
+
+	SharedRateLimiter("ratelimit-test", "key-1", RateLimit{RequestsPerMinute: 20})
+	if got := a.Limit().RequestsPerMinute; got != 20 {
+		t.Errorf("Expected shared limiter to pick up the new limit, got %d", got)
+	}
+}
@@ -0,0 +1,213 @@
+package common
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nexen/models"
+)
+
+// Region failover strategies, as in RegionRouting.FailoverStrategy.
+const (
+	// FailoverSequential sends requests to the first preferred region that has not recently
+	// failed, and to the next one when it fails.
+	FailoverSequential = "sequential"
+
+	// FailoverRoundRobin spreads requests over the regions that have not recently failed.
+	FailoverRoundRobin = "round_robin"
+)
+
+// DefaultRegionCooldown is how long a failed region is skipped when RegionRouting.Cooldown is
+// zero.
+const DefaultRegionCooldown = 30 * time.Second
+
+// RegionEndpointFunc returns a provider's endpoint in region, given its global endpoint.
+type RegionEndpointFunc func(baseEndpoint, region string) string
+
+var (
+	regionEndpointsMu sync.RWMutex
+	regionEndpoints   = map[string]RegionEndpointFunc{
+		// Data residency endpoints such as https://eu.api.openai.com/v1
+		models.ProviderOpenAI: prefixHost,
+		// Vertex AI endpoints such as https://europe-west4-aiplatform.googleapis.com/v1
+		models.ProviderGoogle: func(baseEndpoint, region string) string {
+			return replaceHost(baseEndpoint, region+"-aiplatform.googleapis.com")
+		},
+	}
+)
+
+// RegisterRegionEndpoint sets how the regional endpoints of provider are built.
+func RegisterRegionEndpoint(provider string, fn RegionEndpointFunc) {
+	regionEndpointsMu.Lock()
+	defer regionEndpointsMu.Unlock()
+	regionEndpoints[provider] = fn
+}
+
+// RegionEndpoint returns the endpoint of provider in region. An endpoint containing
+// "{region}" has it replaced by the region; otherwise the provider's RegionEndpointFunc is
+// used, and providers without one get the region prefixed to the host, as in
+// https://eu.api.example.com.
+func RegionEndpoint(provider, baseEndpoint, region string) string {
+	if strings.Contains(baseEndpoint, "{region}") {
+		return strings.ReplaceAll(baseEndpoint, "{region}", region)
+	}
+	regionEndpointsMu.RLock()
+	fn, ok := regionEndpoints[provider]
+	regionEndpointsMu.RUnlock()
+	if !ok {
+		fn = prefixHost
+	}
+	return fn(baseEndpoint, region)
+}
+
+// prefixHost prefixes the host of endpoint with region.
+func prefixHost(endpoint, region string) string {
+	u, err := url.Parse(endpoint)
+	if err != nil || u.Host == "" {
+		return endpoint
+	}
+	return replaceHost(endpoint, region+"."+u.Host)
+}
+
+// replaceHost replaces the host of endpoint.
+func replaceHost(endpoint, host string) string {
+	u, err := url.Parse(endpoint)
+	if err != nil || u.Host == "" {
+		return endpoint
+	}
+	u.Host = host
+	return u.String()
+}
+
+// RegionalEndpoint is an endpoint a RegionRouter sends requests to. Region is empty for the
+// provider's global endpoint.
+type RegionalEndpoint struct {
+	Region string
+	URL    string
+}
+
+// RegionRouter chooses the regional endpoint of each request and fails over to other regions
+// when one fails. A failed region is skipped for a cooldown, so requests stick to the regions
+// that work instead of trying a failing one first every time. It is safe for concurrent use.
+type RegionRouter struct {
+	endpoints []RegionalEndpoint // in order of preference
+	strategy  string
+	cooldown  time.Duration
+
+	mu          sync.Mutex
+	next        int                  // round-robin position
+	failedUntil map[string]time.Time // region -> end of its cooldown
+	now         func() time.Time
+}
+
+// NewRegionRouter returns the router of a provider client configured by config. Without
+// region routing, or with an endpoint override that has no "{region}" placeholder, every
+// request goes to a single endpoint.
+func NewRegionRouter(provider, baseEndpoint string, config *LLMConfig) *RegionRouter {
+	r := &RegionRouter{
+		strategy:    config.RegionRouting.FailoverStrategy,
+		cooldown:    config.RegionRouting.Cooldown,
+		failedUntil: make(map[string]time.Time),
+		now:         time.Now,
+	}
+	if r.cooldown <= 0 {
+		r.cooldown = DefaultRegionCooldown
+	}
+	if config.EndpointOverride != "" {
+		baseEndpoint = config.EndpointOverride
+	}
+	routing := config.RegionRouting
+	if !routing.EnableRegionRouting || len(routing.PreferredRegions) == 0 ||
+		(config.EndpointOverride != "" && !strings.Contains(baseEndpoint, "{region}")) {
+		r.endpoints = []RegionalEndpoint{{URL: baseEndpoint}}
+		return r
+	}
+	for _, region := range routing.PreferredRegions {
+		r.endpoints = append(r.endpoints, RegionalEndpoint{Region: region, URL: RegionEndpoint(provider, baseEndpoint, region)})
+	}
+	return r
+}
+
+// Endpoints returns the endpoints to try for the next request, in order. Regions cooling down
+// after a failure come last, so that a request is still sent somewhere when every region has
+// failed recently.
+func (r *RegionRouter) Endpoints() []RegionalEndpoint {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	now := r.now()
+	var available, cooling []RegionalEndpoint
+	for _, e := range r.endpoints {
+		if until, ok := r.failedUntil[e.Region]; ok && now.Before(until) {
+			cooling = append(cooling, e)
+			continue
+		}
+		available = append(available, e)
+	}
+	if r.strategy == FailoverRoundRobin && len(available) > 1 {
+		start := r.next % len(available)
+		r.next++
+		available = append(available[start:], available[:start]...)
+	}
+	return append(available, cooling...)
+}
+
+// Do calls fn with the URL of each endpoint from Endpoints until it succeeds or fails with an
+// error another region would not fix. Regions whose call fails because the provider was
+// unavailable, overloaded or rate limiting are put on cooldown. The last error is returned.
+func (r *RegionRouter) Do(ctx context.Context, fn func(ctx context.Context, endpoint string) error) error {
+	var err error
+	for _, e := range r.Endpoints() {
+		err = fn(ctx, e.URL)
+		if err == nil {
+			r.recover(e.Region)
+			return nil
+		}
+		if ctx.Err() != nil || !isRegionalFailure(err) {
+			return err
+		}
+		r.fail(e.Region)
+	}
+	return err
+}
+
+// fail puts region on cooldown.
+func (r *RegionRouter) fail(region string) {
+	if region == "" {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.failedUntil[region] = r.now().Add(r.cooldown)
+}
+
+// recover ends the cooldown of region.
+func (r *RegionRouter) recover(region string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.failedUntil, region)
+}
+
+// isRegionalFailure reports whether err may not happen in another region.
+func isRegionalFailure(err error) bool {
+	if IsRetryable(err, RetryConfig{StatusCodesToRetry: DefaultRetryStatusCodes}) {
+		return true
+	}
+	return errors.Is(err, ErrProviderUnavailable)
+}
+
+// validFailoverStrategy checks strategy, accepting "round-robin" for FailoverRoundRobin.
+func validFailoverStrategy(strategy string) (string, error) {
+	strategy = strings.ReplaceAll(strings.ToLower(strategy), "-", "_")
+	switch strategy {
+	case "":
+		return FailoverSequential, nil
+	case FailoverSequential, FailoverRoundRobin:
+		return strategy, nil
+	}
+	return "", fmt.Errorf("unknown region failover strategy %q", strategy)
+}
@@ -0,0 +1,135 @@
+package common
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/nexen/models"
+)
+
+func TestRegionEndpoint(t *testing.T) {
+	testCases := []struct {
+		provider, base, region, want string
+	}{
+		{models.ProviderOpenAI, "https://api.openai.com/v1", "eu", "https://eu.api.openai.com/v1"},
+		{models.ProviderGoogle, "https://aiplatform.googleapis.com/v1", "europe-west4", "https://europe-west4-aiplatform.googleapis.com/v1"},
+		{models.ProviderOpenAI, "https://{region}.proxy.internal/v1", "us", "https://us.proxy.internal/v1"},
+		{"other", "https://api.example.com", "ap", "https://ap.api.example.com"},
+	}
+	for _, tc := range testCases {
+		if got := RegionEndpoint(tc.provider, tc.base, tc.region); got != tc.want {
+			t.Errorf("RegionEndpoint(%q, %q, %q) = %q, want %q", tc.provider, tc.base, tc.region, got, tc.want)
+		}
+	}
+}
+
+func TestNewRegionRouterEndpoints(t *testing.T) {
+	config := DefaultLLMConfig()
+	config.RegionRouting = RegionRouting{EnableRegionRouting: true, PreferredRegions: []string{"us", "eu"}}
+	router := NewRegionRouter(models.ProviderOpenAI, "https://api.openai.com/v1", config)
+	if got := urls(router.Endpoints()); len(got) != 2 || got[0] != "https://us.api.openai.com/v1" || got[1] != "https://eu.api.openai.com/v1" {
+		t.Errorf("Unexpected endpoints %v", got)
+	}
+
+	config.EndpointOverride = "https://proxy.internal/v1"
+	router = NewRegionRouter(models.ProviderOpenAI, "https://api.openai.com/v1", config)
+	if got := urls(router.Endpoints()); len(got) != 1 || got[0] != "https://proxy.internal/v1" {
+		t.Errorf("Expected an override without {region} to be the only endpoint, got %v", got)
+	}
+
+	config.RegionRouting.EnableRegionRouting = false
+	config.EndpointOverride = ""
+	router = NewRegionRouter(models.ProviderOpenAI, "https://api.openai.com/v1", config)
+	if got := urls(router.Endpoints()); len(got) != 1 || got[0] != "https://api.openai.com/v1" {
+		t.Errorf("Expected the global endpoint without region routing, got %v", got)
+	}
+}
+
+func TestRegionRouterFailsOverSequentially(t *testing.T) {
+	router := testRegionRouter(FailoverSequential, "us", "eu")
+	now := time.Now()
+	router.now = func() time.Time { return now }
+	failing := map[string]bool{"us": true}
+
+	var tried []string
+	call := func(ctx context.Context, endpoint string) error {
+		tried = append(tried, endpoint)
+		if failing[endpoint] {
+			return &ProviderError{Provider: "test", StatusCode: http.StatusServiceUnavailable}
+		}
+		return nil
+	}
+	if err := router.Do(context.Background(), call); err != nil {
+		t.Fatalf("Expected eu to answer, got %v", err)
+	}
+	if len(tried) != 2 || tried[0] != "us" || tried[1] != "eu" {
+		t.Errorf("Expected us then eu, got %v", tried)
+	}
+
+	// us is cooling down, so requests stick to eu
+	tried = nil
+	router.Do(context.Background(), call)
+	if len(tried) != 1 || tried[0] != "eu" {
+		t.Errorf("Expected only eu during the cooldown, got %v", tried)
+	}
+
+	// After the cooldown us is tried first again
+	now = now.Add(DefaultRegionCooldown)
+	failing["us"] = false
+	tried = nil
+	router.Do(context.Background(), call)
+	if len(tried) != 1 || tried[0] != "us" {
+		t.Errorf("Expected us after the cooldown, got %v", tried)
+	}
+}
+
+func TestRegionRouterRoundRobin(t *testing.T) {
+	router := testRegionRouter(FailoverRoundRobin, "us", "eu", "ap")
+	var first []string
+	for i := 0; i < 4; i++ {
+		first = append(first, router.Endpoints()[0].URL)
+	}
+	if want := []string{"us", "eu", "ap", "us"}; first[0] != want[0] || first[1] != want[1] || first[2] != want[2] || first[3] != want[3] {
+		t.Errorf("Expected rotation %v, got %v", want, first)
+	}
+}
+
+func TestRegionRouterKeepsRequestErrors(t *testing.T) {
+	router := testRegionRouter(FailoverSequential, "us", "eu")
+	calls := 0
+	err := router.Do(context.Background(), func(ctx context.Context, endpoint string) error {
+		calls++
+		return &ProviderError{Provider: "test", StatusCode: http.StatusBadRequest}
+	})
+	if err == nil || calls != 1 {
+		t.Errorf("Expected a bad request not to fail over, got %d calls and %v", calls, err)
+	}
+}
+
+func TestWithRegionRoutingValidatesStrategy(t *testing.T) {
+	config := DefaultLLMConfig()
+	if err := WithRegionRouting(true, []string{"eu"}, "round-robin")(config); err != nil || config.RegionRouting.FailoverStrategy != FailoverRoundRobin {
+		t.Errorf("Expected round-robin to be accepted, got %q, %v", config.RegionRouting.FailoverStrategy, err)
+	}
+	if err := WithRegionRouting(true, []string{"eu"}, "random")(config); err == nil {
+		t.Error("Expected an unknown strategy to be rejected")
+	}
+}
+
+// testRegionRouter returns a router whose endpoint URLs are the region names.
+func testRegionRouter(strategy string, regions ...string) *RegionRouter {
+	config := DefaultLLMConfig()
+	config.EndpointOverride = "{region}"
+	config.RegionRouting = RegionRouting{EnableRegionRouting: true, PreferredRegions: regions, FailoverStrategy: strategy}
+	return NewRegionRouter("test", "", config)
+}
+
+func urls(endpoints []RegionalEndpoint) []string {
+	var urls []string
+	for _, e := range endpoints {
+		urls = append(urls, e.URL)
+	}
+	return urls
+}
@@ -0,0 +1,31 @@
+package common
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+
+	"github.com/nexen/models"
+)
+
+// hashedRequest is the part of a request that determines its response.
+type hashedRequest struct {
+	Model    string                        `json:"model"`
+	Contents []models.Content              `json:"contents"`
+	Config   *models.GenerateContentConfig `json:"config,omitempty"`
+}
+
+// RequestHash returns a hex SHA-256 hash of the request's model, contents and config, so
+// requests expecting the same response share a hash. model replaces an empty request.Model,
+// e.g. with the client's ModelNamer model.
+func RequestHash(model string, request *models.LLMRequest) (string, error) {
+	if request.Model != "" {
+		model = request.Model
+	}
+	data, err := json.Marshal(hashedRequest{Model: model, Contents: request.Contents, Config: request.Config})
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
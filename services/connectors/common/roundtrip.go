@@ -0,0 +1,222 @@
+package common
+
+import (
+	"context"
+	"crypto/tls"
+	"io"
+	"net/http"
+	"net/http/httptrace"
+	"sync"
+	"time"
+)
+
+// MetadataHTTPTimings is the CustomMetadata key holding the HTTPTimings of the provider
+// request that produced a response.
+const MetadataHTTPTimings = "http_timings"
+
+// Span attribute keys of HTTPTimings.
+const (
+	AttrHTTPDNSMs     = "nexen.http.dns_ms"
+	AttrHTTPConnectMs = "nexen.http.connect_ms"
+	AttrHTTPTLSMs     = "nexen.http.tls_ms"
+	AttrHTTPTTFBMs    = "nexen.http.ttfb_ms"
+	AttrHTTPTotalMs   = "nexen.http.total_ms"
+	AttrHTTPAttempts  = "nexen.http.attempts"
+)
+
+// HTTPTimings break down the last HTTP round trip of a provider call. Phases that did not
+// happen, such as DNS and connect on a reused connection, are zero.
+type HTTPTimings struct {
+	DNSMs     float64 `json:"dnsMs"`
+	ConnectMs float64 `json:"connectMs"`
+	TLSMs     float64 `json:"tlsMs"`
+
+	// TTFBMs is the time from sending the request to the first response byte.
+	TTFBMs float64 `json:"ttfbMs"`
+
+	// TotalMs is the time from sending the request to reading the whole response body.
+	TotalMs float64 `json:"totalMs"`
+
+	// ReusedConnection reports whether an idle connection was reused.
+	ReusedConnection bool `json:"reusedConnection"`
+
+	// Attempts is the number of round trips of the call, including retries.
+	Attempts int `json:"attempts"`
+}
+
+// RoundTripObserver receives the timings of every measured round trip, for example to record
+// them in latency histograms.
+type RoundTripObserver func(provider string, timings HTTPTimings)
+
+var (
+	observerMu sync.RWMutex
+	observer   RoundTripObserver
+)
+
+// SetRoundTripObserver sets the observer of measured round trips. Nil removes it.
+func SetRoundTripObserver(o RoundTripObserver) {
+	observerMu.Lock()
+	defer observerMu.Unlock()
+	observer = o
+}
+
+// roundTripsKey is the context key of the timings of a call's round trips.
+type roundTripsKey struct{}
+
+// roundTrips collects the round trips of one call.
+type roundTrips struct {
+	mu       sync.Mutex
+	last     HTTPTimings
+	attempts int
+}
+
+// WithRoundTripTimings returns a copy of ctx in which measured round trips are recorded, and
+// a function returning the timings of the last completed one, with the number of attempts.
+func WithRoundTripTimings(ctx context.Context) (context.Context, func() (HTTPTimings, bool)) {
+	trips := &roundTrips{}
+	return context.WithValue(ctx, roundTripsKey{}, trips), func() (HTTPTimings, bool) {
+		trips.mu.Lock()
+		defer trips.mu.Unlock()
+		if trips.attempts == 0 {
+			return HTTPTimings{}, false
+		}
+		timings := trips.last
+		timings.Attempts = trips.attempts
+		return timings, true
+	}
+}
+
+// MeasureRoundTrip sends req with send and measures its DNS, connect, TLS, first byte and
+// total times. The timings are recorded once the response body is read or closed, for the
+// call whose context came from WithRoundTripTimings, and passed to the RoundTripObserver.
+// Connectors use it to wrap their HTTP transport or SDK middleware.
+func MeasureRoundTrip(provider string, req *http.Request, send func(*http.Request) (*http.Response, error)) (*http.Response, error) {
+	m := &measurement{provider: provider}
+	trace := &httptrace.ClientTrace{
+		DNSStart:             func(httptrace.DNSStartInfo) { m.mark(&m.dnsStart) },
+		DNSDone:              func(httptrace.DNSDoneInfo) { m.span(m.dnsStart, &m.timings.DNSMs) },
+		ConnectStart:         func(string, string) { m.mark(&m.connectStart) },
+		ConnectDone:          func(string, string, error) { m.span(m.connectStart, &m.timings.ConnectMs) },
+		TLSHandshakeStart:    func() { m.mark(&m.tlsStart) },
+		TLSHandshakeDone:     func(tls.ConnectionState, error) { m.span(m.tlsStart, &m.timings.TLSMs) },
+		GotConn:              func(info httptrace.GotConnInfo) { m.reused(info.Reused) },
+		GotFirstResponseByte: func() { m.span(m.start, &m.timings.TTFBMs) },
+	}
+	m.start = time.Now()
+	resp, err := send(req.WithContext(httptrace.WithClientTrace(req.Context(), trace)))
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = &measuredBody{ReadCloser: resp.Body, done: func() { m.finish(req.Context()) }}
+	return resp, nil
+}
+
+// TimingTransport returns an http.RoundTripper that measures every round trip of next, or of
+// http.DefaultTransport when next is nil, with MeasureRoundTrip.
+func TimingTransport(provider string, next http.RoundTripper) http.RoundTripper {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	return roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		return MeasureRoundTrip(provider, req, next.RoundTrip)
+	})
+}
+
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+// measurement is one measured round trip. Trace hooks may run on other goroutines.
+type measurement struct {
+	provider string
+	start    time.Time
+
+	mu                               sync.Mutex
+	dnsStart, connectStart, tlsStart time.Time
+	timings                          HTTPTimings
+	finished                         bool
+}
+
+func (m *measurement) mark(t *time.Time) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	*t = time.Now()
+}
+
+func (m *measurement) span(start time.Time, ms *float64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if !start.IsZero() {
+		*ms = milliseconds(time.Since(start))
+	}
+}
+
+func (m *measurement) reused(reused bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.timings.ReusedConnection = reused
+}
+
+// finish records the round trip once.
+func (m *measurement) finish(ctx context.Context) {
+	m.mu.Lock()
+	if m.finished {
+		m.mu.Unlock()
+		return
+	}
+	m.finished = true
+	m.timings.TotalMs = milliseconds(time.Since(m.start))
+	timings := m.timings
+	m.mu.Unlock()
+
+	if trips, ok := ctx.Value(roundTripsKey{}).(*roundTrips); ok {
+		trips.mu.Lock()
+		trips.last = timings
+		trips.attempts++
+		trips.mu.Unlock()
+	}
+	observerMu.RLock()
+	o := observer
+	observerMu.RUnlock()
+	if o != nil {
+		timings.Attempts = 1
+		o(m.provider, timings)
+	}
+}
+
+func milliseconds(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+// measuredBody calls done when the body is fully read or closed.
+type measuredBody struct {
+	io.ReadCloser
+	done func()
+}
+
+func (b *measuredBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if err == io.EOF {
+		b.done()
+	}
+	return n, err
+}
+
+func (b *measuredBody) Close() error {
+	b.done()
+	return b.ReadCloser.Close()
+}
+
+// Attributes returns the span attributes of t.
+func (t HTTPTimings) Attributes() map[string]any {
+	return map[string]any{
+		AttrHTTPDNSMs:     t.DNSMs,
+		AttrHTTPConnectMs: t.ConnectMs,
+		AttrHTTPTLSMs:     t.TLSMs,
+		AttrHTTPTTFBMs:    t.TTFBMs,
+		AttrHTTPTotalMs:   t.TotalMs,
+		AttrHTTPAttempts:  t.Attempts,
+	}
+}
@@ -0,0 +1,32 @@
+package common
+
+import "github.com/nexen/models"
+
+// CustomMetadata keys connectors set from the service tier that served a request.
+const (
+	// MetadataServiceTier holds the tier the provider reports having served the request in,
+	// e.g. models.ServiceTierPriority.
+	MetadataServiceTier = "service_tier"
+
+	// MetadataServiceTierCostDelta holds how many cents the tier added to the cost of the
+	// request over the default tier; it is negative for cheaper tiers such as flex.
+	MetadataServiceTierCostDelta = "service_tier_cost_delta_cents"
+)
+
+// WithServiceTier sets the service tier requests are sent with, e.g.
+// models.ServiceTierPriority. Requests can override it with GenerateContentConfig.ServiceTier.
+func WithServiceTier(tier string) Option {
+	return func(config *LLMConfig) error {
+		config.ServiceTier = tier
+		return nil
+	}
+}
+
+// RequestServiceTier returns the service tier request should be sent with: its own, or the
+// client's. Empty means the provider's default.
+func RequestServiceTier(config *LLMConfig, request *models.LLMRequest) string {
+	if request.Config != nil && request.Config.ServiceTier != "" {
+		return request.Config.ServiceTier
+	}
+	return config.ServiceTier
+}
@@ -0,0 +1,196 @@
+package common
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrMalformedFrame marks a stream event that could not be parsed. Stream handlers wrap it
+// so that ReadStream repairs the stream instead of failing.
+var ErrMalformedFrame = errors.New("malformed stream frame")
+
+// SSEEvent is one server-sent event.
+type SSEEvent struct {
+	// ID is the event's id field, used to resume the stream after it.
+	ID string
+
+	// Event is the event type; empty means "message".
+	Event string
+
+	// Data is the event's data, with the lines of multi-line data joined by newlines.
+	Data string
+
+	// Retry is the reconnection delay the server asked for, if any.
+	Retry time.Duration
+}
+
+// SSEReader reads server-sent events from a stream. It tolerates what providers send in
+// practice: keep-alive comments, CRLF line endings, a leading byte order mark, unknown fields
+// and frames split across reads.
+type SSEReader struct {
+	r       *bufio.Reader
+	started bool
+}
+
+// NewSSEReader returns an SSEReader reading from r.
+func NewSSEReader(r io.Reader) *SSEReader {
+	return &SSEReader{r: bufio.NewReader(r)}
+}
+
+// Next returns the next event. It returns io.EOF when the stream ends between events and
+// io.ErrUnexpectedEOF when it ends inside one.
+func (s *SSEReader) Next() (SSEEvent, error) {
+	var event SSEEvent
+	var data []string
+	pending := false
+	for {
+		line, err := s.r.ReadString('\n')
+		if err != nil {
+			if err == io.EOF && (pending || line != "") {
+				return SSEEvent{}, io.ErrUnexpectedEOF
+			}
+			return SSEEvent{}, err
+		}
+		line = strings.TrimRight(line, "\r\n")
+		if !s.started {
+			line = strings.TrimPrefix(line, "\ufeff")
+			s.started = true
+		}
+
+		if line == "" {
+			// A blank line ends the event; events without data are not dispatched
+			if data != nil {
+				event.Data = strings.Join(data, "\n")
+				return event, nil
+			}
+			event, pending = SSEEvent{}, false
+			continue
+		}
+		if strings.HasPrefix(line, ":") {
+			continue // comment, such as a keep-alive
+		}
+
+		pending = true
+		field, value, _ := strings.Cut(line, ":")
+		value = strings.TrimPrefix(value, " ")
+		switch field {
+		case "data":
+			data = append(data, value)
+		case "event":
+			event.Event = value
+		case "id":
+			if !strings.ContainsRune(value, 0) {
+				event.ID = value
+			}
+		case "retry":
+			if ms, err := strconv.Atoi(value); err == nil && ms >= 0 {
+				event.Retry = time.Duration(ms) * time.Millisecond
+			}
+		}
+	}
+}
+
+// StreamOpener opens a stream of server-sent events. lastEventID is the ID of the last event
+// handled, empty on the first attempt; providers that resume streams take it as the
+// Last-Event-ID header.
+type StreamOpener func(ctx context.Context, lastEventID string) (io.ReadCloser, error)
+
+// StreamConfig configures how ReadStream repairs broken streams.
+type StreamConfig struct {
+	// MaxRepairs is how many times a broken stream is reopened before its error is returned.
+	MaxRepairs int
+
+	// Resumable is true when the provider resumes a stream from Last-Event-ID. Other
+	// streams are only reopened before the first event is handled, since reopening them
+	// would replay the events already handled.
+	Resumable bool
+
+	// Retry sets the backoff between repairs and which provider errors are repaired, as for
+	// DoWithRetry. Its MaxRetries is not used.
+	Retry RetryConfig
+}
+
+// ReadStream opens a stream with open and calls handle for each event until the stream ends.
+// A stream is broken when reading fails, when it ends inside an event, or when handle returns
+// an error wrapping ErrMalformedFrame or one DoWithRetry would retry; a broken stream is
+// reopened up to config.MaxRepairs times, resuming after the last handled event when the
+// provider supports it. Other errors from open or handle are returned straight away.
+func ReadStream(ctx context.Context, config StreamConfig, open StreamOpener, handle func(SSEEvent) error) error {
+	lastID := ""
+	handled := false
+	for repairs := 0; ; repairs++ {
+		err := readStreamOnce(ctx, open, lastID, func(event SSEEvent) error {
+			if err := handle(event); err != nil {
+				return err
+			}
+			handled = true
+			if event.ID != "" {
+				lastID = event.ID
+			}
+			return nil
+		})
+		if err == nil || !repairable(err, config.Retry) {
+			return err
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if handled && !(config.Resumable && lastID != "") {
+			return fmt.Errorf("stream broken and cannot be resumed: %w", err)
+		}
+		if repairs >= config.MaxRepairs {
+			return fmt.Errorf("stream broken after %d repairs: %w", repairs, err)
+		}
+
+		timer := time.NewTimer(CalculateBackoff(repairs, config.Retry))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// streamBroken wraps the read errors of a stream so that they are repaired.
+type streamBroken struct {
+	err error
+}
+
+func (e *streamBroken) Error() string { return "reading stream: " + e.err.Error() }
+func (e *streamBroken) Unwrap() error { return e.err }
+
+// readStreamOnce opens the stream once and handles its events until it ends or fails.
+func readStreamOnce(ctx context.Context, open StreamOpener, lastID string, handle func(SSEEvent) error) error {
+	body, err := open(ctx, lastID)
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+
+	reader := NewSSEReader(body)
+	for {
+		event, err := reader.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return &streamBroken{err}
+		}
+		if err := handle(event); err != nil {
+			return err
+		}
+	}
+}
+
+// repairable reports whether a broken stream should be reopened after err.
+func repairable(err error, config RetryConfig) bool {
+	var broken *streamBroken
+	return errors.As(err, &broken) || errors.Is(err, ErrMalformedFrame) || IsRetryable(err, config)
+}
@@ -0,0 +1,93 @@
+package common
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+func TestSSEReader(t *testing.T) {
+	stream := "\ufeff: keep-alive\r\n" +
+		"event: delta\r\nid: 1\r\ndata: {\"text\":\r\ndata: \"hi\"}\r\nunknown: field\r\n\r\n" +
+		": ping\n\n" +
+		"id: 2\nretry: 3000\ndata: done\n\n" +
+		"data: partial"
+	// One byte per read, so every frame is split
+	reader := NewSSEReader(iotest.OneByteReader(strings.NewReader(stream)))
+
+	event, err := reader.Next()
+	if err != nil || event.Event != "delta" || event.ID != "1" || event.Data != "{\"text\":\n\"hi\"}" {
+		t.Errorf("Next() = %+v, %v", event, err)
+	}
+	event, err = reader.Next()
+	if err != nil || event.ID != "2" || event.Data != "done" || event.Retry.Milliseconds() != 3000 {
+		t.Errorf("Next() = %+v, %v", event, err)
+	}
+	if _, err := reader.Next(); err != io.ErrUnexpectedEOF {
+		t.Errorf("Expected io.ErrUnexpectedEOF for a truncated event, got %v", err)
+	}
+}
+
+func TestReadStreamResumes(t *testing.T) {
+	var opened []string
+	open := func(ctx context.Context, lastEventID string) (io.ReadCloser, error) {
+		opened = append(opened, lastEventID)
+		switch len(opened) {
+		case 1:
+			return io.NopCloser(strings.NewReader("id: 1\ndata: a\n\nid: 2\ndata: b\n\nid: 3\ndata: {trunc")), nil
+		case 2:
+			return io.NopCloser(strings.NewReader("id: 3\ndata: bad\n\n")), nil
+		}
+		return io.NopCloser(strings.NewReader("id: 3\ndata: c\n\n")), nil
+	}
+
+	var got []string
+	err := ReadStream(context.Background(), StreamConfig{MaxRepairs: 2, Resumable: true}, open, func(event SSEEvent) error {
+		if event.Data == "bad" {
+			return fmt.Errorf("decoding event: %w", ErrMalformedFrame)
+		}
+		got = append(got, event.Data)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("ReadStream() error = %v", err)
+	}
+	if strings.Join(got, "") != "abc" {
+		t.Errorf("Expected every event once, got %v", got)
+	}
+	if strings.Join(opened, ",") != ",2,2" {
+		t.Errorf("Expected the stream to resume after the last handled event, got %q", opened)
+	}
+}
+
+func TestReadStreamGivesUp(t *testing.T) {
+	broken := func(ctx context.Context, lastEventID string) (io.ReadCloser, error) {
+		return io.NopCloser(strings.NewReader("id: 1\ndata: a\n\ndata: {trunc")), nil
+	}
+	handle := func(SSEEvent) error { return nil }
+
+	if err := ReadStream(context.Background(), StreamConfig{MaxRepairs: 2}, broken, handle); !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Errorf("Expected a stream that cannot be resumed to fail, got %v", err)
+	}
+
+	attempts := 0
+	counting := func(ctx context.Context, lastEventID string) (io.ReadCloser, error) {
+		attempts++
+		return broken(ctx, lastEventID)
+	}
+	err := ReadStream(context.Background(), StreamConfig{MaxRepairs: 2, Resumable: true}, counting, handle)
+	if !errors.Is(err, io.ErrUnexpectedEOF) || attempts != 3 {
+		t.Errorf("Expected the error after 2 repairs, got %v after %d attempts", err, attempts)
+	}
+
+	failing := func(ctx context.Context, lastEventID string) (io.ReadCloser, error) {
+		return nil, errors.New("unauthorized")
+	}
+	if err := ReadStream(context.Background(), StreamConfig{MaxRepairs: 2}, failing, handle); err == nil || err.Error() != "unauthorized" {
+		t.Errorf("Expected errors opening the stream to be returned as is, got %v", err)
+	}
+}
@@ -0,0 +1,29 @@
+package common
+
+import (
+	"context"
+
+	"github.com/nexen/models"
+)
+
+// Streamer is implemented by LLMs that can send their response while it is generated.
+type Streamer interface {
+	// CallStream sends request and calls yield with each partial response, whose Partial is
+	// true and whose Content holds the text generated since the previous one, and last with
+	// the final response, which holds the complete content and usage. An error returned by
+	// yield stops the stream and is returned.
+	CallStream(ctx context.Context, request *models.LLMRequest, yield func(*models.LLMResponse) error) error
+}
+
+// CallStream streams the response of llm to request with yield, as Streamer.CallStream does.
+// LLMs that are not Streamers are called with Call, and their response is the final one.
+func CallStream(ctx context.Context, llm LLM, request *models.LLMRequest, yield func(*models.LLMResponse) error) error {
+	if streamer, ok := llm.(Streamer); ok {
+		return streamer.CallStream(ctx, request, yield)
+	}
+	response, err := llm.Call(ctx, request)
+	if err != nil {
+		return err
+	}
+	return yield(response)
+}
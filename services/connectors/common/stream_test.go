@@ -0,0 +1,37 @@
+package common
+
+import (
+	"context"
+	"testing"
+
+	"github.com/nexen/models"
+)
+
+// callOnly is an LLM that cannot stream.
+type callOnly struct{}
+
+func (callOnly) Call(ctx context.Context, request *models.LLMRequest) (*models.LLMResponse, error) {
+	return &models.LLMResponse{Content: &models.Content{Role: "assistant", Message: "done"}}, nil
+}
+
+func (c callOnly) BatchCall(ctx context.Context, requests []*models.LLMRequest) ([]*models.LLMResponse, error) {
+	return BatchCall(ctx, requests, DefaultBatchConcurrency, c.Call)
+}
+
+func (callOnly) SupportedModels() []string {
+	return nil
+}
+
+func TestCallStreamFallsBackToCall(t *testing.T) {
+	var responses []*models.LLMResponse
+	err := CallStream(context.Background(), callOnly{}, &models.LLMRequest{Model: "m"}, func(response *models.LLMResponse) error {
+		responses = append(responses, response)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(responses) != 1 || responses[0].Content.Message != "done" {
+		t.Errorf("Expected the response of Call only, got %v", responses)
+	}
+}
@@ -0,0 +1,46 @@
+package common
+
+import (
+	"context"
+	"time"
+
+	"github.com/nexen/models"
+)
+
+// callTimeoutKey is the context key of the timeout set with WithCallTimeout.
+type callTimeoutKey struct{}
+
+// WithCallTimeout returns a context that sets the timeout of the calls made with it,
+// overriding the request's and the client's timeouts.
+func WithCallTimeout(ctx context.Context, timeout time.Duration) context.Context {
+	return context.WithValue(ctx, callTimeoutKey{}, timeout)
+}
+
+// ResolveTimeout returns the timeout of a call. The most specific setting wins:
+//
+//  1. the per-call timeout set on ctx with WithCallTimeout
+//  2. the request's Config.Timeout
+//  3. the client's LLMConfig.Timeout, set with WithTimeout or the provider settings
+//  4. DefaultTimeoutSeconds
+//
+// Zero or negative values at any level are ignored. request and config may be nil.
+func ResolveTimeout(ctx context.Context, request *models.LLMRequest, config *LLMConfig) time.Duration {
+	if timeout, ok := ctx.Value(callTimeoutKey{}).(time.Duration); ok && timeout > 0 {
+		return timeout
+	}
+	if request != nil && request.Config != nil && request.Config.Timeout > 0 {
+		return time.Duration(request.Config.Timeout) * time.Second
+	}
+	if config != nil && config.Timeout > 0 {
+		return time.Duration(config.Timeout) * time.Second
+	}
+	return DefaultTimeoutSeconds * time.Second
+}
+
+// CallContext returns ctx bounded by the call's ResolveTimeout. Connectors apply it once at
+// the start of Call, so the timeout covers the whole call: rate-limit waits, every retry and
+// reading the response. HTTP clients and SDKs must not set timeouts of their own. A deadline
+// already on ctx still applies when it is earlier.
+func CallContext(ctx context.Context, request *models.LLMRequest, config *LLMConfig) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(ctx, ResolveTimeout(ctx, request, config))
+}
@@ -0,0 +1,48 @@
+package common
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/nexen/models"
+)
+
+func TestResolveTimeout(t *testing.T) {
+	client := &LLMConfig{Timeout: 20}
+	request := &models.LLMRequest{Config: &models.GenerateContentConfig{Timeout: 10}}
+	perCall := WithCallTimeout(context.Background(), 5*time.Second)
+
+	tests := []struct {
+		name    string
+		ctx     context.Context
+		request *models.LLMRequest
+		config  *LLMConfig
+		want    time.Duration
+	}{
+		{"per-call option wins", perCall, request, client, 5 * time.Second},
+		{"request config beats client", context.Background(), request, client, 10 * time.Second},
+		{"client config", context.Background(), &models.LLMRequest{}, client, 20 * time.Second},
+		{"global default", context.Background(), nil, &LLMConfig{}, DefaultTimeoutSeconds * time.Second},
+		{"no config", context.Background(), nil, nil, DefaultTimeoutSeconds * time.Second},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ResolveTimeout(tt.ctx, tt.request, tt.config); got != tt.want {
+				t.Errorf("ResolveTimeout() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCallContextKeepsEarlierDeadline(t *testing.T) {
+	parent, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	want, _ := parent.Deadline()
+
+	ctx, cancelCall := CallContext(parent, nil, &LLMConfig{Timeout: 60})
+	defer cancelCall()
+	if got, _ := ctx.Deadline(); !got.Equal(want) {
+		t.Errorf("Expected the caller's earlier deadline %v, got %v", want, got)
+	}
+}
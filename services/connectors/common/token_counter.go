@@ -0,0 +1,64 @@
+package common
+
+import (
+	"math"
+	"sync"
+
+	"github.com/nexen/models"
+)
+
+// TokenCounter counts the prompt tokens of a conversation before it is sent, for model
+// selection and truncation.
+type TokenCounter interface {
+	// CountTokens returns the number of prompt tokens contents use on model.
+	CountTokens(model string, contents []models.Content) (int, error)
+}
+
+// HeuristicTokenCounter estimates tokens from character counts like EstimatePromptTokens,
+// corrected by DefaultTokenCalibrator. It works for every model and never fails.
+type HeuristicTokenCounter struct{}
+
+// CountTokens implements TokenCounter.
+func (HeuristicTokenCounter) CountTokens(model string, contents []models.Content) (int, error) {
+	request := &models.LLMRequest{Model: model, Contents: contents}
+	prompt := float64(EstimatePromptTokens(request)) * DefaultTokenCalibrator.Factor(model)
+	return int(math.Ceil(prompt)), nil
+}
+
+var (
+	tokenCountersMu sync.RWMutex
+	tokenCounters   = make(map[string]TokenCounter)
+)
+
+// RegisterTokenCounter sets the counter used for models of provider, replacing any earlier
+// one. Connectors with a local tokenizer register theirs when imported.
+func RegisterTokenCounter(provider string, counter TokenCounter) {
+	tokenCountersMu.Lock()
+	defer tokenCountersMu.Unlock()
+	tokenCounters[provider] = counter
+}
+
+// TokenCounterFor returns the counter registered for model's provider, or a
+// HeuristicTokenCounter when there is none or the model is not in the models registry.
+func TokenCounterFor(model string) TokenCounter {
+	info, err := models.Resolve(model)
+	if err != nil {
+		return HeuristicTokenCounter{}
+	}
+	tokenCountersMu.RLock()
+	defer tokenCountersMu.RUnlock()
+	if counter, ok := tokenCounters[info.Provider]; ok {
+		return counter
+	}
+	return HeuristicTokenCounter{}
+}
+
+// CountTokens counts the prompt tokens of contents on model with TokenCounterFor, falling
+// back to the heuristic estimate if the provider's counter fails.
+func CountTokens(model string, contents []models.Content) int {
+	if n, err := TokenCounterFor(model).CountTokens(model, contents); err == nil {
+		return n
+	}
+	n, _ := HeuristicTokenCounter{}.CountTokens(model, contents)
+	return n
+}
@@ -0,0 +1,157 @@
+package common
+
+import (
+	"encoding/json"
+	"math"
+	"sync"
+
+	"github.com/nexen/models"
+)
+
+const (
+	// charsPerToken is the average number of characters per token for English text.
+	charsPerToken = 4
+
+	// messageOverheadTokens approximates the role and formatting tokens added per message.
+	messageOverheadTokens = 4
+)
+
+// EstimateTokens returns a rough count of the tokens a request will use: its prompt tokens,
+// corrected by DefaultTokenCalibrator for the request's model, plus the requested MaxTokens
+// for the completion. It is meant for budgeting and rate limiting, not for exact accounting.
+func EstimateTokens(request *models.LLMRequest) int {
+	prompt := float64(EstimatePromptTokens(request)) * DefaultTokenCalibrator.Factor(request.Model)
+	tokens := int(math.Ceil(prompt))
+	if request.Config != nil {
+		tokens += request.Config.MaxTokens
+	}
+	return tokens
+}
+
+// EstimatePromptTokens returns the uncalibrated prompt token estimate for a request:
+// about four characters per token plus a fixed overhead per message.
+func EstimatePromptTokens(request *models.LLMRequest) int {
+	chars := 0
+	messages := 0
+	if request.Config != nil {
+		chars += len(request.Config.SystemInstruction)
+		for _, tool := range request.Config.Tools {
+			for _, declaration := range tool.FunctionDeclarations {
+				chars += len(declaration)
+			}
+		}
+		if request.Config.SystemInstruction != "" {
+			messages++
+		}
+	}
+	for _, content := range request.Contents {
+		messages++
+		// Connectors send Message only when there are no Parts
+		if len(content.Parts) == 0 {
+			chars += len(content.Message)
+		}
+		for _, part := range content.Parts {
+			switch v := part.(type) {
+			case string:
+				chars += len(v)
+			default:
+				if encoded, err := json.Marshal(v); err == nil {
+					chars += len(encoded)
+				}
+			}
+		}
+	}
+	return (chars+charsPerToken-1)/charsPerToken + messages*messageOverheadTokens
+}
+
+const (
+	// minCalibrationWeight is the smallest weight given to a new observation, so factors keep
+	// tracking tokenizer or prompt changes after many samples.
+	minCalibrationWeight = 0.05
+
+	// maxCalibrationRatio bounds how far one observation can move a factor.
+	maxCalibrationRatio = 4.0
+)
+
+// TokenCalibrator learns per-model correction factors for EstimatePromptTokens by comparing
+// estimates with the prompt token counts providers report. It is safe for concurrent use.
+type TokenCalibrator struct {
+	mu     sync.RWMutex
+	models map[string]Calibration
+}
+
+// Calibration is the learned correction for one model.
+type Calibration struct {
+	// Factor multiplies the heuristic estimate; 1 means the heuristic is accurate.
+	Factor float64 `json:"factor"`
+
+	// Samples is the number of observations the factor is based on.
+	Samples int `json:"samples"`
+}
+
+// DefaultTokenCalibrator is fed by the connectors and used by EstimateTokens.
+var DefaultTokenCalibrator = NewTokenCalibrator()
+
+// NewTokenCalibrator creates a calibrator with no observations.
+func NewTokenCalibrator() *TokenCalibrator {
+	return &TokenCalibrator{models: make(map[string]Calibration)}
+}
+
+// Observe records that a request estimated at estimated prompt tokens used actual tokens.
+// Early observations are averaged; later ones update an exponential moving average.
+// Observations with a non-positive count are ignored.
+func (c *TokenCalibrator) Observe(model string, estimated, actual int) {
+	if estimated <= 0 || actual <= 0 {
+		return
+	}
+	ratio := float64(actual) / float64(estimated)
+	ratio = math.Max(1/maxCalibrationRatio, math.Min(maxCalibrationRatio, ratio))
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	cal, ok := c.models[model]
+	if !ok {
+		cal.Factor = 1
+	}
+	cal.Samples++
+	weight := math.Max(1/float64(cal.Samples), minCalibrationWeight)
+	cal.Factor += weight * (ratio - cal.Factor)
+	c.models[model] = cal
+}
+
+// ObserveRequest records the prompt token count a provider reported for request.
+func (c *TokenCalibrator) ObserveRequest(request *models.LLMRequest, promptTokens int) {
+	c.Observe(request.Model, EstimatePromptTokens(request), promptTokens)
+}
+
+// Factor returns the correction factor for model, or 1 if it has no observations.
+func (c *TokenCalibrator) Factor(model string) float64 {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if cal, ok := c.models[model]; ok {
+		return cal.Factor
+	}
+	return 1
+}
+
+// Calibrations returns a copy of the learned factors, keyed by model.
+func (c *TokenCalibrator) Calibrations() map[string]Calibration {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	out := make(map[string]Calibration, len(c.models))
+	for model, cal := range c.models {
+		out[model] = cal
+	}
+	return out
+}
+
+// Reset discards the observations for model, or for all models if model is empty.
+func (c *TokenCalibrator) Reset(model string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if model == "" {
+		c.models = make(map[string]Calibration)
+		return
+	}
+	delete(c.models, model)
+}
@@ -0,0 +1,104 @@
+package common
+
+import (
+	"errors"
+	"math"
+	"testing"
+
+	"github.com/nexen/models"
+)
+
+func TestEstimateTokens(t *testing.T) {
+	request := &models.LLMRequest{
+		Model:    "estimate-test",
+		Contents: []models.Content{{Role: "user", Message: "12345678"}},
+		Config:   &models.GenerateContentConfig{SystemInstruction: "abcd", MaxTokens: 100},
+	}
+	// 12 characters -> 3 tokens, 2 messages -> 8 overhead
+	if got := EstimatePromptTokens(request); got != 11 {
+		t.Errorf("EstimatePromptTokens() = %d, want 11", got)
+	}
+	// Plus 100 output tokens
+	if got := EstimateTokens(request); got != 111 {
+		t.Errorf("EstimateTokens() = %d, want 111", got)
+	}
+
+	defer DefaultTokenCalibrator.Reset("estimate-test")
+	DefaultTokenCalibrator.ObserveRequest(request, 22)
+	if got := EstimateTokens(request); got != 122 {
+		t.Errorf("Expected calibrated estimate 122, got %d", got)
+	}
+}
+
+func TestTokenCalibrator(t *testing.T) {
+	c := NewTokenCalibrator()
+	if f := c.Factor("gpt-4"); f != 1 {
+		t.Errorf("Expected factor 1 without observations, got %v", f)
+	}
+
+	// The first observations are averaged
+	c.Observe("gpt-4", 100, 120)
+	c.Observe("gpt-4", 100, 140)
+	if f := c.Factor("gpt-4"); math.Abs(f-1.3) > 1e-9 {
+		t.Errorf("Expected factor 1.3, got %v", f)
+	}
+
+	// Many observations converge on the observed ratio
+	for i := 0; i < 200; i++ {
+		c.Observe("gpt-4", 100, 90)
+	}
+	if f := c.Factor("gpt-4"); math.Abs(f-0.9) > 0.01 {
+		t.Errorf("Expected factor near 0.9, got %v", f)
+	}
+
+	// Outliers are bounded and invalid observations ignored
+	c.Observe("claude-3-haiku", 10, 10000)
+	c.Observe("claude-3-haiku", 0, 50)
+	cal := c.Calibrations()["claude-3-haiku"]
+	if cal.Factor != maxCalibrationRatio || cal.Samples != 1 {
+		t.Errorf("Unexpected calibration %+v", cal)
+	}
+	if c.Factor("gpt-4") == 1 {
+		t.Error("Models should be calibrated independently")
+	}
+
+	c.Reset("")
+	if len(c.Calibrations()) != 0 {
+		t.Error("Expected Reset to discard all observations")
+	}
+}
+
+// fixedCounter counts every conversation as n tokens, or fails with err.
+type fixedCounter struct {
+	n   int
+	err error
+}
+
+func (c fixedCounter) CountTokens(model string, contents []models.Content) (int, error) {
+	return c.n, c.err
+}
+
+func TestTokenCounterFor(t *testing.T) {
+	if err := models.Register("^counterprobe-.*", models.ModelInfo{Provider: "counterprobe"}); err != nil {
+		t.Fatal(err)
+	}
+	contents := []models.Content{{Role: "user", Message: "12345678"}}
+
+	// 8 characters -> 2 tokens, 1 message -> 4 overhead
+	if got := CountTokens("counterprobe-1", contents); got != 6 {
+		t.Errorf("Expected the heuristic estimate 6 without a counter, got %d", got)
+	}
+
+	RegisterTokenCounter("counterprobe", fixedCounter{n: 42})
+	if got := CountTokens("counterprobe-1", contents); got != 42 {
+		t.Errorf("Expected the registered counter, got %d", got)
+	}
+	if _, ok := TokenCounterFor("unknown-model").(HeuristicTokenCounter); !ok {
+		t.Error("Expected the heuristic for models outside the registry")
+	}
+
+	RegisterTokenCounter("counterprobe", fixedCounter{err: errors.New("tokenizer unavailable")})
+	if got := CountTokens("counterprobe-1", contents); got != 6 {
+		t.Errorf("Expected the heuristic estimate when the counter fails, got %d", got)
+	}
+}
@@ -0,0 +1,98 @@
+package common
+
+import (
+	"context"
+	"net/http"
+	"sync"
+)
+
+// MetadataFinishReason is the CustomMetadata key connectors set to the provider's finish
+// reason, such as "stop" or "max_tokens".
+const MetadataFinishReason = "finish_reason"
+
+// MetadataServedBy is the CustomMetadata key wrappers that choose between models, such as
+// fallback chains and hedged calls, set to the model ID that produced the response.
+const MetadataServedBy = "served_by"
+
+// Span attribute keys of the OpenTelemetry semantic conventions for generative AI.
+const (
+	AttrOperationName         = "gen_ai.operation.name"
+	AttrSystem                = "gen_ai.system"
+	AttrRequestModel          = "gen_ai.request.model"
+	AttrRequestTemperature    = "gen_ai.request.temperature"
+	AttrRequestTopP           = "gen_ai.request.top_p"
+	AttrRequestMaxTokens      = "gen_ai.request.max_tokens"
+	AttrRequestStopSequences  = "gen_ai.request.stop_sequences"
+	AttrResponseFinishReasons = "gen_ai.response.finish_reasons"
+	AttrUsageInputTokens      = "gen_ai.usage.input_tokens"
+	AttrUsageOutputTokens     = "gen_ai.usage.output_tokens"
+	AttrErrorType             = "error.type"
+)
+
+// Span attribute keys of a request's models.RequestMetadata. Tags are recorded under
+// AttrTagPrefix followed by the tag name.
+const (
+	AttrEndUserID = "enduser.id"
+	AttrTenantID  = "nexen.tenant.id"
+	AttrRequestID = "nexen.request.id"
+	AttrTagPrefix = "nexen.tag."
+)
+
+// Tracer starts a client span for an LLM call. Attribute values are strings, ints, float64s
+// or string slices. Adapters for a tracing library, such as OpenTelemetry, implement this
+// interface.
+type Tracer interface {
+	Start(ctx context.Context, name string, attrs map[string]any) (context.Context, Span)
+}
+
+// Span is a span started by a Tracer.
+type Span interface {
+	// SetAttributes adds attributes to the span.
+	SetAttributes(attrs map[string]any)
+
+	// End ends the span, marking it failed when err is not nil.
+	End(err error)
+}
+
+// TracePropagator writes the trace context of ctx into the headers of an outbound request,
+// e.g. the W3C traceparent header.
+type TracePropagator func(ctx context.Context, header http.Header)
+
+var (
+	tracingMu  sync.RWMutex
+	tracer     Tracer
+	propagator TracePropagator
+)
+
+// SetTracer sets the tracer of the calls of clients created afterwards. Nil disables tracing.
+func SetTracer(t Tracer) {
+	tracingMu.Lock()
+	defer tracingMu.Unlock()
+	tracer = t
+}
+
+// CurrentTracer returns the tracer set with SetTracer, or nil.
+func CurrentTracer() Tracer {
+	tracingMu.RLock()
+	defer tracingMu.RUnlock()
+	return tracer
+}
+
+// SetTracePropagator sets how connectors propagate the trace context into provider requests.
+// Nil disables propagation.
+func SetTracePropagator(p TracePropagator) {
+	tracingMu.Lock()
+	defer tracingMu.Unlock()
+	propagator = p
+}
+
+// InjectTraceContext writes the trace context of ctx into header with the propagator set with
+// SetTracePropagator. Connectors call it for every outbound request.
+func InjectTraceContext(ctx context.Context, header http.Header) {
+	tracingMu.RLock()
+	p := propagator
+	tracingMu.RUnlock()
+	if p != nil {
+		p(ctx, header)
+	}
+}
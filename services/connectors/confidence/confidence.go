@@ -0,0 +1,188 @@
+// Package confidence estimates how much a response can be trusted.
+//
+// Estimators produce a normalized score in [0, 1] that is stored in the response's
+// CustomMetadata under models.MetadataConfidence, where routing can read it to decide
+// whether to escalate to a stronger model.
+package confidence
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+
+	"github.com/nexen/models"
+	"github.com/nexen/services/connectors/common"
+)
+
+// ErrNoLogprobs is returned by LogprobEstimator when the response carries no logprobs.
+var ErrNoLogprobs = errors.New("confidence: response has no logprobs")
+
+// Estimator scores a response to a request.
+type Estimator interface {
+	Estimate(ctx context.Context, request *models.LLMRequest, response *models.LLMResponse) (float64, error)
+}
+
+// LogprobEstimator scores a response from its token log probabilities.
+//
+// The score is the geometric mean token probability. When top alternatives are present it is
+// averaged with the mean margin between the chosen token and the runner-up, so answers where
+// the model hesitated between tokens score lower.
+type LogprobEstimator struct{}
+
+// Estimate implements Estimator.
+func (LogprobEstimator) Estimate(ctx context.Context, request *models.LLMRequest, response *models.LLMResponse) (float64, error) {
+	if response == nil || response.Logprobs == nil || len(response.Logprobs.Tokens) == 0 {
+		return 0, ErrNoLogprobs
+	}
+
+	var sumLogprob, sumMargin float64
+	margins := 0
+	for _, tok := range response.Logprobs.Tokens {
+		sumLogprob += tok.Logprob
+		if len(tok.TopAlternatives) < 2 {
+			continue
+		}
+		first, second := math.Inf(-1), math.Inf(-1)
+		for _, alt := range tok.TopAlternatives {
+			if alt.Logprob > first {
+				first, second = alt.Logprob, first
+			} else if alt.Logprob > second {
+				second = alt.Logprob
+			}
+		}
+		sumMargin += math.Exp(first) - math.Exp(second)
+		margins++
+	}
+
+	score := math.Exp(sumLogprob / float64(len(response.Logprobs.Tokens)))
+	if margins > 0 {
+		score = (score + sumMargin/float64(margins)) / 2
+	}
+	return clamp(score), nil
+}
+
+// defaultJudgePrompt asks the judge for a single 0-100 rating.
+const defaultJudgePrompt = "You are grading another assistant's answer. " +
+	"Rate from 0 to 100 how likely it is that the answer is correct and complete. " +
+	"Reply with the number only."
+
+// JudgeEstimator asks a model to grade the response. Using the same model that produced the
+// response gives a self-evaluation; a separate, stronger model acts as an independent judge.
+type JudgeEstimator struct {
+	// LLM is the model used to grade responses.
+	LLM common.LLM
+
+	// Model is the model ID sent in the grading request.
+	Model string
+
+	// Prompt overrides the grading instruction.
+	Prompt string
+}
+
+// NewSelfEvaluator returns a JudgeEstimator that asks the answering model to grade itself.
+func NewSelfEvaluator(llm common.LLM, model string) *JudgeEstimator {
+	return &JudgeEstimator{LLM: llm, Model: model}
+}
+
+// ratingPattern finds the first number in the judge's reply.
+var ratingPattern = regexp.MustCompile(`\d+(\.\d+)?`)
+
+// Estimate implements Estimator.
+func (j *JudgeEstimator) Estimate(ctx context.Context, request *models.LLMRequest, response *models.LLMResponse) (float64, error) {
+	if response == nil || response.Content == nil {
+		return 0, fmt.Errorf("confidence: response has no content to grade")
+	}
+
+	prompt := j.Prompt
+	if prompt == "" {
+		prompt = defaultJudgePrompt
+	}
+	question := ""
+	if n := len(request.Contents); n > 0 {
+		question = request.Contents[n-1].Message
+	}
+
+	grading := &models.LLMRequest{
+		Model: j.Model,
+		Contents: []models.Content{{
+			Role:    "user",
+			Message: fmt.Sprintf("Question:\n%s\n\nAnswer:\n%s", question, response.Content.Message),
+		}},
+		Config: &models.GenerateContentConfig{
+			SystemInstruction: prompt,
+			MaxTokens:         8,
+		},
+	}
+
+	verdict, err := j.LLM.Call(ctx, grading)
+	if err != nil {
+		return 0, fmt.Errorf("confidence: grading call failed: %w", err)
+	}
+	if verdict.IsError() || verdict.Content == nil {
+		return 0, fmt.Errorf("confidence: grading failed: %s", verdict.Error())
+	}
+
+	match := ratingPattern.FindString(verdict.Content.Message)
+	if match == "" {
+		return 0, fmt.Errorf("confidence: no rating in judge reply %q", verdict.Content.Message)
+	}
+	rating, err := strconv.ParseFloat(match, 64)
+	if err != nil {
+		return 0, fmt.Errorf("confidence: parsing rating %q: %w", match, err)
+	}
+	return clamp(rating / 100), nil
+}
+
+// Annotate estimates the response's confidence and records it in CustomMetadata.
+func Annotate(ctx context.Context, estimator Estimator, request *models.LLMRequest, response *models.LLMResponse) error {
+	score, err := estimator.Estimate(ctx, request, response)
+	if err != nil {
+		return err
+	}
+	response.SetConfidence(score)
+	return nil
+}
+
+// estimatingLLM annotates every successful response with a confidence score.
+type estimatingLLM struct {
+	common.LLM
+	estimator Estimator
+}
+
+// Wrap returns an LLM that runs estimator on each successful response. Estimation is best
+// effort: if it fails the response is returned without a confidence score.
+func Wrap(llm common.LLM, estimator Estimator) common.LLM {
+	return &estimatingLLM{LLM: llm, estimator: estimator}
+}
+
+// Call implements the LLM interface Call method.
+func (e *estimatingLLM) Call(ctx context.Context, request *models.LLMRequest) (*models.LLMResponse, error) {
+	response, err := e.LLM.Call(ctx, request)
+	if err != nil || response.IsError() {
+		return response, err
+	}
+	Annotate(ctx, e.estimator, request, response)
+	return response, nil
+}
+
+// BatchCall implements the LLM interface BatchCall method.
+func (e *estimatingLLM) BatchCall(ctx context.Context, requests []*models.LLMRequest) ([]*models.LLMResponse, error) {
+	responses, err := e.LLM.BatchCall(ctx, requests)
+	for i, response := range responses {
+		if response != nil && !response.IsError() && i < len(requests) {
+			Annotate(ctx, e.estimator, requests[i], response)
+		}
+	}
+	return responses, err
+}
+
+// clamp limits a score to [0, 1].
+func clamp(score float64) float64 {
+	if math.IsNaN(score) {
+		return 0
+	}
+	return math.Max(0, math.Min(1, score))
+}
@@ -0,0 +1,95 @@
+package confidence
+
+import (
+	"context"
+	"errors"
+	"math"
+	"testing"
+
+	"github.com/nexen/models"
+)
+
+// replyLLM answers every call with a fixed message.
+type replyLLM struct {
+	reply string
+}
+
+func (r *replyLLM) Call(ctx context.Context, request *models.LLMRequest) (*models.LLMResponse, error) {
+	return &models.LLMResponse{Content: &models.Content{Role: "assistant", Message: r.reply}}, nil
+}
+
+func (r *replyLLM) BatchCall(ctx context.Context, requests []*models.LLMRequest) ([]*models.LLMResponse, error) {
+	responses := make([]*models.LLMResponse, len(requests))
+	for i, req := range requests {
+		responses[i], _ = r.Call(ctx, req)
+	}
+	return responses, nil
+}
+
+func (r *replyLLM) SupportedModels() []string {
+	return []string{"reply"}
+}
+
+func TestLogprobEstimator(t *testing.T) {
+	var est LogprobEstimator
+	if _, err := est.Estimate(context.Background(), nil, &models.LLMResponse{}); !errors.Is(err, ErrNoLogprobs) {
+		t.Fatalf("Expected ErrNoLogprobs, got %v", err)
+	}
+
+	sure := &models.LLMResponse{Logprobs: &models.Logprobs{Tokens: []models.TokenLogprob{
+		{Token: "Paris", Logprob: math.Log(0.99), TopAlternatives: []models.TopLogprob{
+			{Token: "Paris", Logprob: math.Log(0.99)}, {Token: "Lyon", Logprob: math.Log(0.01)},
+		}},
+	}}}
+	unsure := &models.LLMResponse{Logprobs: &models.Logprobs{Tokens: []models.TokenLogprob{
+		{Token: "Paris", Logprob: math.Log(0.5), TopAlternatives: []models.TopLogprob{
+			{Token: "Paris", Logprob: math.Log(0.5)}, {Token: "Lyon", Logprob: math.Log(0.45)},
+		}},
+	}}}
+
+	high, err := est.Estimate(context.Background(), nil, sure)
+	if err != nil {
+		t.Fatalf("Estimate failed: %v", err)
+	}
+	low, _ := est.Estimate(context.Background(), nil, unsure)
+	if high <= low {
+		t.Errorf("Expected confident answer to score higher: %v <= %v", high, low)
+	}
+	if high < 0 || high > 1 || low < 0 || low > 1 {
+		t.Errorf("Scores must be normalized, got %v and %v", high, low)
+	}
+}
+
+func TestJudgeEstimator(t *testing.T) {
+	judge := &JudgeEstimator{LLM: &replyLLM{reply: "85"}, Model: "judge"}
+	request := &models.LLMRequest{Model: "m", Contents: []models.Content{{Role: "user", Message: "Capital of France?"}}}
+	response := &models.LLMResponse{Content: &models.Content{Role: "assistant", Message: "Paris"}}
+
+	if err := Annotate(context.Background(), judge, request, response); err != nil {
+		t.Fatalf("Annotate failed: %v", err)
+	}
+	if score, ok := response.Confidence(); !ok || score != 0.85 {
+		t.Errorf("Expected confidence 0.85, got %v", score)
+	}
+
+	judge.LLM = &replyLLM{reply: "I cannot say"}
+	if _, err := judge.Estimate(context.Background(), request, response); err == nil {
+		t.Error("Expected error when judge gives no rating")
+	}
+}
+
+func TestWrapAnnotatesResponses(t *testing.T) {
+	answering := &replyLLM{reply: "Paris"}
+	llm := Wrap(answering, NewSelfEvaluator(&replyLLM{reply: "Confidence: 70"}, "self"))
+
+	response, err := llm.Call(context.Background(), &models.LLMRequest{
+		Model:    "m",
+		Contents: []models.Content{{Role: "user", Message: "Capital of France?"}},
+	})
+	if err != nil {
+		t.Fatalf("Call failed: %v", err)
+	}
+	if score, ok := response.Confidence(); !ok || score != 0.7 {
+		t.Errorf("Expected confidence 0.7, got %v", score)
+	}
+}
@@ -0,0 +1,324 @@
+// Package contextwindow keeps requests within the model's context window.
+//
+// Long conversations eventually outgrow the window registered as the model's ContextWindow, and
+// the provider then rejects the call after the prompt was already uploaded. Wrap counts the
+// prompt with common.CountTokens before sending and applies a Strategy when it does not fit:
+// fail fast, drop the oldest turns, or summarize the older history with a cheap model.
+package contextwindow
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/nexen/models"
+	"github.com/nexen/services/connectors/common"
+)
+
+// MetadataKey is the CustomMetadata key holding the Report for a request that was shortened.
+const MetadataKey = "context_window"
+
+// Strategy selects what happens to a prompt that does not fit the context window.
+type Strategy string
+
+const (
+	// StrategyError fails the request with common.ErrContextLengthExceeded without calling
+	// the provider.
+	StrategyError Strategy = "error"
+
+	// StrategyDropOldest removes the oldest turns until the prompt fits.
+	StrategyDropOldest Strategy = "drop_oldest"
+
+	// StrategySummarize replaces the oldest turns with a summary written by Options.Summarizer,
+	// then drops further turns if the prompt still does not fit.
+	StrategySummarize Strategy = "summarize"
+)
+
+const (
+	// DefaultOutputReserve is the room kept for the answer when the request sets no MaxTokens,
+	// or the model's MaxOutputTokens when smaller.
+	DefaultOutputReserve = 1024
+
+	// DefaultKeepRecent is how many of the latest messages summarization leaves verbatim.
+	DefaultKeepRecent = 2
+
+	// summaryInstruction asks the summarizer for a summary of the dropped turns.
+	summaryInstruction = "Summarize the following conversation so it can replace the original " +
+		"in a continued chat. Keep names, numbers, decisions and open questions. Reply with the summary only."
+)
+
+// Options configures Wrap. The zero value fails requests that do not fit.
+type Options struct {
+	// Strategy is applied to prompts that do not fit; the zero value is StrategyError.
+	Strategy Strategy
+
+	// OutputReserve is the room kept for the answer when the request sets no MaxTokens.
+	// Zero means DefaultOutputReserve.
+	OutputReserve int
+
+	// Summarizer is the client that writes summaries for StrategySummarize, typically a
+	// cheap, fast model.
+	Summarizer common.LLM
+
+	// SummaryModel is the model ID sent to Summarizer.
+	SummaryModel string
+
+	// KeepRecent is how many of the latest messages StrategySummarize leaves verbatim, along
+	// with the rest of the turn they start in. Zero means DefaultKeepRecent.
+	KeepRecent int
+}
+
+// Report describes how a request was shortened.
+type Report struct {
+	// PromptTokens is the counted size of the original prompt.
+	PromptTokens int `json:"promptTokens"`
+
+	// Limit is the prompt budget: the context window less the output reserve.
+	Limit int `json:"limit"`
+
+	// Dropped is the number of contents removed without a summary.
+	Dropped int `json:"dropped,omitempty"`
+
+	// Summarized is the number of contents replaced by a summary.
+	Summarized int `json:"summarized,omitempty"`
+}
+
+// windowLLM fits requests into the context window before passing them to the wrapped LLM.
+type windowLLM struct {
+	common.LLM
+	opts Options
+}
+
+// Wrap returns an LLM that applies opts to every request whose prompt does not fit the
+// model's context window. When a request was shortened, the Report is stored in the
+// response's CustomMetadata under MetadataKey.
+func Wrap(llm common.LLM, opts Options) (common.LLM, error) {
+	switch opts.Strategy {
+	case "", StrategyError, StrategyDropOldest:
+	case StrategySummarize:
+		if opts.Summarizer == nil || opts.SummaryModel == "" {
+			return nil, fmt.Errorf("summarize strategy requires a summarizer model")
+		}
+	default:
+		return nil, fmt.Errorf("unknown context window strategy %q", opts.Strategy)
+	}
+	return &windowLLM{LLM: llm, opts: opts}, nil
+}
+
+// Call implements the LLM interface Call method. The response's Usage includes the
+// summarizer's usage when history was summarized.
+func (w *windowLLM) Call(ctx context.Context, request *models.LLMRequest) (*models.LLMResponse, error) {
+	model := request.Model
+	if namer, ok := w.LLM.(common.ModelNamer); ok && model == "" {
+		model = namer.Model()
+	}
+	fitted, report, summaryUsage, err := w.fit(ctx, model, request)
+	if err != nil {
+		return nil, err
+	}
+
+	response, err := w.LLM.Call(ctx, fitted)
+	if response != nil && fitted != request {
+		if response.CustomMetadata == nil {
+			response.CustomMetadata = make(map[string]any)
+		}
+		response.CustomMetadata[MetadataKey] = report
+		response.Usage = response.Usage.Add(summaryUsage)
+	}
+	return response, err
+}
+
+// BatchCall implements the LLM interface BatchCall method.
+func (w *windowLLM) BatchCall(ctx context.Context, requests []*models.LLMRequest) ([]*models.LLMResponse, error) {
+	return common.BatchCall(ctx, requests, common.DefaultBatchConcurrency, w.Call)
+}
+
+// fit returns request unchanged when it fits model's window, and otherwise a shortened copy.
+// Models without a registered window are not checked. Requests asking for more output than
+// the model's MaxOutputTokens fail whatever the strategy, since shortening the prompt does
+// not help them.
+func (w *windowLLM) fit(ctx context.Context, model string, request *models.LLMRequest) (*models.LLMRequest, Report, models.UsageMetrics, error) {
+	var usage models.UsageMetrics
+	info, err := models.Resolve(model)
+	if err != nil || info.ContextWindow <= 0 {
+		return request, Report{}, usage, nil
+	}
+
+	reserve := w.opts.OutputReserve
+	if reserve <= 0 {
+		reserve = DefaultOutputReserve
+	}
+	if info.MaxOutputTokens > 0 {
+		reserve = min(reserve, info.MaxOutputTokens)
+	}
+	if request.Config != nil && request.Config.MaxTokens > 0 {
+		if info.MaxOutputTokens > 0 && request.Config.MaxTokens > info.MaxOutputTokens {
+			return nil, Report{}, usage, fmt.Errorf("%w: max tokens %d exceeds the %d output tokens %s allows",
+				common.ErrContextLengthExceeded, request.Config.MaxTokens, info.MaxOutputTokens, model)
+		}
+		reserve = request.Config.MaxTokens
+	}
+	report := Report{PromptTokens: PromptTokens(model, request), Limit: info.ContextWindow - reserve}
+	if report.PromptTokens <= report.Limit {
+		return request, report, usage, nil
+	}
+
+	overflow := func(tokens int) error {
+		return fmt.Errorf("%w: prompt has %d tokens, %s allows %d with %d reserved for output",
+			common.ErrContextLengthExceeded, tokens, model, report.Limit, reserve)
+	}
+	if w.opts.Strategy == "" || w.opts.Strategy == StrategyError {
+		return nil, report, usage, overflow(report.PromptTokens)
+	}
+
+	fitted := *request
+	fitted.Contents = append([]models.Content(nil), request.Contents...)
+	if request.Config != nil {
+		config := *request.Config
+		fitted.Config = &config
+	}
+
+	if w.opts.Strategy == StrategySummarize {
+		keep := w.opts.KeepRecent
+		if keep <= 0 {
+			keep = DefaultKeepRecent
+		}
+		// Summarize whole turns only, so tool results stay with their calls
+		end := previousTurnStart(fitted.Contents, len(fitted.Contents)-keep)
+		start := leadingSystem(fitted.Contents)
+		if end > start {
+			summary, err := w.summarize(ctx, fitted.Contents[start:end])
+			if err != nil {
+				return nil, report, usage, fmt.Errorf("summarizing history: %w", err)
+			}
+			usage = summary.Usage
+			fitted.Contents = append(fitted.Contents[:start], fitted.Contents[end:]...)
+			fitted.AppendInstructions("Summary of the earlier conversation:\n" + summary.Content.Message)
+			report.Summarized = end - start
+		}
+	}
+
+	// Drop the oldest turns until the prompt fits, always keeping the latest turn
+	for tokens := PromptTokens(model, &fitted); tokens > report.Limit; tokens = PromptTokens(model, &fitted) {
+		start := leadingSystem(fitted.Contents)
+		end := turnStart(fitted.Contents, start+1)
+		if end <= start || end >= len(fitted.Contents) {
+			return nil, report, usage, overflow(tokens)
+		}
+		fitted.Contents = append(fitted.Contents[:start], fitted.Contents[end:]...)
+		report.Dropped += end - start
+	}
+	return &fitted, report, usage, nil
+}
+
+// summarize asks the summarizer for a summary of contents.
+func (w *windowLLM) summarize(ctx context.Context, contents []models.Content) (*models.LLMResponse, error) {
+	var transcript strings.Builder
+	for _, content := range contents {
+		fmt.Fprintf(&transcript, "%s: %s\n", content.Role, contentText(content))
+	}
+	request := &models.LLMRequest{
+		Model:    w.opts.SummaryModel,
+		Contents: []models.Content{{Role: "user", Message: transcript.String()}},
+		Config:   &models.GenerateContentConfig{SystemInstruction: summaryInstruction},
+	}
+	response, err := w.opts.Summarizer.Call(ctx, request)
+	if err != nil {
+		return nil, err
+	}
+	if response.IsError() {
+		return nil, response
+	}
+	if response.Content == nil || response.Content.Message == "" {
+		return nil, fmt.Errorf("summarizer returned no text")
+	}
+	return response, nil
+}
+
+// PromptTokens counts the prompt tokens of request on model with common.CountTokens,
+// including the system instruction and tool declarations.
+func PromptTokens(model string, request *models.LLMRequest) int {
+	contents := request.Contents
+	if request.Config != nil {
+		var preamble []string
+		if request.Config.SystemInstruction != "" {
+			preamble = append(preamble, request.Config.SystemInstruction)
+		}
+		for _, tool := range request.Config.Tools {
+			preamble = append(preamble, tool.FunctionDeclarations...)
+		}
+		if len(preamble) > 0 {
+			system := models.Content{Role: "system", Message: strings.Join(preamble, "\n")}
+			contents = append([]models.Content{system}, contents...)
+		}
+	}
+	return common.CountTokens(model, contents)
+}
+
+// leadingSystem returns the number of system contents at the start of contents, which are
+// never dropped.
+func leadingSystem(contents []models.Content) int {
+	i := 0
+	for i < len(contents) && contents[i].Role == "system" {
+		i++
+	}
+	return i
+}
+
+// turnStart returns the index of the first turn boundary at or after i, or len(contents).
+// Cutting at a turn boundary never separates tool results from their calls.
+func turnStart(contents []models.Content, i int) int {
+	if i < 0 {
+		i = 0
+	}
+	for ; i < len(contents); i++ {
+		if isTurnStart(contents[i]) {
+			return i
+		}
+	}
+	return len(contents)
+}
+
+// previousTurnStart returns the index of the last turn boundary at or before i, or -1.
+func previousTurnStart(contents []models.Content, i int) int {
+	for ; i >= 0; i-- {
+		if i < len(contents) && isTurnStart(contents[i]) {
+			return i
+		}
+	}
+	return -1
+}
+
+// isTurnStart reports whether content opens a turn: a user message that is not a tool result.
+func isTurnStart(content models.Content) bool {
+	return content.Role == "user" && !hasFunctionResponse(content)
+}
+
+// hasFunctionResponse reports whether content carries a tool result.
+func hasFunctionResponse(content models.Content) bool {
+	for _, part := range content.Parts {
+		if m, ok := part.(map[string]any); ok {
+			if _, ok := m[models.PartFunctionResponse]; ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// contentText returns the text of content for a summary transcript.
+func contentText(content models.Content) string {
+	if len(content.Parts) == 0 {
+		return content.Message
+	}
+	var texts []string
+	for _, part := range content.Parts {
+		switch v := part.(type) {
+		case string:
+			texts = append(texts, v)
+		default:
+			texts = append(texts, fmt.Sprint(v))
+		}
+	}
+	return strings.Join(texts, " ")
+}
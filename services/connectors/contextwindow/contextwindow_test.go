@@ -0,0 +1,178 @@
+package contextwindow
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/nexen/models"
+	"github.com/nexen/services/connectors/common"
+)
+
+// recordingLLM records the last request and answers with a fixed message.
+type recordingLLM struct {
+	answer  string
+	usage   models.UsageMetrics
+	request *models.LLMRequest
+}
+
+func (r *recordingLLM) Call(ctx context.Context, request *models.LLMRequest) (*models.LLMResponse, error) {
+	r.request = request
+	return &models.LLMResponse{Content: &models.Content{Role: "assistant", Message: r.answer}, Usage: r.usage}, nil
+}
+
+func (r *recordingLLM) BatchCall(ctx context.Context, requests []*models.LLMRequest) ([]*models.LLMResponse, error) {
+	return common.BatchCall(ctx, requests, 1, r.Call)
+}
+
+func (r *recordingLLM) SupportedModels() []string { return []string{"windowprobe-small"} }
+
+func init() {
+	// 100 token window; with 20 reserved for output, prompts may use 80
+	if err := models.Register("^windowprobe-.*", models.ModelInfo{Provider: "windowprobe", MaxTokens: 100}); err != nil {
+		panic(err)
+	}
+}
+
+// conversation returns alternating user and assistant messages of 24 heuristic tokens each,
+// ending with a user message.
+func conversation(n int) []models.Content {
+	contents := make([]models.Content, n)
+	for i := range contents {
+		role := "user"
+		if i%2 == 1 {
+			role = "assistant"
+		}
+		contents[i] = models.Content{Role: role, Message: strings.Repeat(string(rune('a'+i)), 80)}
+	}
+	return contents
+}
+
+func newRequest(contents []models.Content) *models.LLMRequest {
+	return &models.LLMRequest{Model: "windowprobe-small", Contents: contents, Config: &models.GenerateContentConfig{MaxTokens: 20}}
+}
+
+func TestFittingRequestIsUnchanged(t *testing.T) {
+	llm := &recordingLLM{answer: "ok"}
+	wrapped, err := Wrap(llm, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	request := newRequest(conversation(3))
+	response, err := wrapped.Call(context.Background(), request)
+	if err != nil {
+		t.Fatalf("Call() error = %v", err)
+	}
+	if llm.request != request || response.CustomMetadata[MetadataKey] != nil {
+		t.Error("Expected a request within the window to pass through unchanged")
+	}
+}
+
+func TestStrategyError(t *testing.T) {
+	llm := &recordingLLM{answer: "ok"}
+	wrapped, _ := Wrap(llm, Options{Strategy: StrategyError})
+
+	_, err := wrapped.Call(context.Background(), newRequest(conversation(5)))
+	if !errors.Is(err, common.ErrContextLengthExceeded) {
+		t.Errorf("Expected ErrContextLengthExceeded, got %v", err)
+	}
+	if llm.request != nil {
+		t.Error("Expected the provider not to be called")
+	}
+}
+
+func TestOutputLimit(t *testing.T) {
+	if err := models.Register("^outputprobe-.*", models.ModelInfo{Provider: "outputprobe", ContextWindow: 100, MaxOutputTokens: 30}); err != nil {
+		t.Fatal(err)
+	}
+	llm := &recordingLLM{answer: "ok"}
+	wrapped, _ := Wrap(llm, Options{Strategy: StrategyDropOldest})
+
+	// More output than the model generates fails whatever the strategy
+	request := &models.LLMRequest{Model: "outputprobe-small", Contents: conversation(1), Config: &models.GenerateContentConfig{MaxTokens: 50}}
+	if _, err := wrapped.Call(context.Background(), request); !errors.Is(err, common.ErrContextLengthExceeded) || llm.request != nil {
+		t.Errorf("Expected ErrContextLengthExceeded without calling the provider, got %v", err)
+	}
+
+	// Without MaxTokens, the reserve is the output limit rather than DefaultOutputReserve
+	request.Config = nil
+	if _, err := wrapped.Call(context.Background(), request); err != nil || llm.request != request {
+		t.Errorf("Expected the request to fit with 30 tokens reserved, got %v", err)
+	}
+}
+
+func TestStrategyDropOldest(t *testing.T) {
+	llm := &recordingLLM{answer: "ok"}
+	wrapped, _ := Wrap(llm, Options{Strategy: StrategyDropOldest})
+
+	request := newRequest(conversation(5))
+	response, err := wrapped.Call(context.Background(), request)
+	if err != nil {
+		t.Fatalf("Call() error = %v", err)
+	}
+	if len(llm.request.Contents) != 3 || llm.request.Contents[0].Message != request.Contents[2].Message {
+		t.Errorf("Expected the oldest turn to be dropped, got %+v", llm.request.Contents)
+	}
+	if len(request.Contents) != 5 {
+		t.Error("Expected the caller's request to be left intact")
+	}
+	report, _ := response.CustomMetadata[MetadataKey].(Report)
+	if report.Dropped != 2 || report.PromptTokens != 120 || report.Limit != 80 {
+		t.Errorf("Unexpected report %+v", report)
+	}
+
+	// A latest turn that alone exceeds the window cannot be fixed by dropping
+	huge := newRequest([]models.Content{{Role: "user", Message: strings.Repeat("x", 400)}})
+	if _, err := wrapped.Call(context.Background(), huge); !errors.Is(err, common.ErrContextLengthExceeded) {
+		t.Errorf("Expected ErrContextLengthExceeded, got %v", err)
+	}
+}
+
+func TestDropOldestKeepsToolResultsWithCalls(t *testing.T) {
+	llm := &recordingLLM{answer: "ok"}
+	wrapped, _ := Wrap(llm, Options{Strategy: StrategyDropOldest})
+
+	contents := conversation(5)
+	contents[1].Parts = []any{models.NewFunctionCallPart(models.FunctionCall{ID: "call_1", Name: "lookup"})}
+	contents[2].Parts = []any{models.NewFunctionResponsePart(models.FunctionResponse{ID: "call_1", Name: "lookup", Response: contents[2].Message})}
+	if _, err := wrapped.Call(context.Background(), newRequest(contents)); err != nil {
+		t.Fatalf("Call() error = %v", err)
+	}
+	// The tool result opens no turn, so the first turn runs up to the last message
+	if len(llm.request.Contents) != 1 || llm.request.Contents[0].Message != contents[4].Message {
+		t.Errorf("Expected the tool call and result to be dropped together, got %+v", llm.request.Contents)
+	}
+}
+
+func TestStrategySummarize(t *testing.T) {
+	if _, err := Wrap(&recordingLLM{}, Options{Strategy: StrategySummarize}); err == nil {
+		t.Error("Expected an error without a summarizer")
+	}
+
+	llm := &recordingLLM{answer: "ok", usage: models.UsageMetrics{TotalTokens: 50}}
+	summarizer := &recordingLLM{answer: "short summary", usage: models.UsageMetrics{TotalTokens: 30}}
+	wrapped, err := Wrap(llm, Options{Strategy: StrategySummarize, Summarizer: summarizer, SummaryModel: "windowprobe-mini", KeepRecent: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	request := newRequest(conversation(5))
+	response, err := wrapped.Call(context.Background(), request)
+	if err != nil {
+		t.Fatalf("Call() error = %v", err)
+	}
+	if summarizer.request.Model != "windowprobe-mini" || !strings.Contains(summarizer.request.Contents[0].Message, request.Contents[0].Message) {
+		t.Errorf("Expected the older history to be sent to the summarizer, got %+v", summarizer.request)
+	}
+	if len(llm.request.Contents) != 1 || !strings.Contains(llm.request.Config.SystemInstruction, "short summary") {
+		t.Errorf("Expected the summary to replace the older history, got %+v", llm.request)
+	}
+	if request.Config.SystemInstruction != "" {
+		t.Error("Expected the caller's config to be left intact")
+	}
+	report, _ := response.CustomMetadata[MetadataKey].(Report)
+	if report.Summarized != 4 || report.Dropped != 0 || response.Usage.TotalTokens != 80 {
+		t.Errorf("Unexpected report %+v or usage %+v", report, response.Usage)
+	}
+}
@@ -24,6 +24,13 @@ type CustomClient struct {
 	// client *http.Client
 }
 
+// The interfaces CustomClient implements, checked at compile time.
+var (
+	_ common.LLM        = (*CustomClient)(nil)
+	_ common.ModelNamer = (*CustomClient)(nil)
+	_ common.Pinger     = (*CustomClient)(nil)
+)
+
 // init registers this adapter with the connectors registry.
 func init() {
 	for _, pattern := range supportedModelPatterns {
@@ -97,26 +104,23 @@ func (c *CustomClient) Call(ctx context.Context, request *models.LLMRequest) (*m
 	}, nil
 }
 
+// Ping implements common.Pinger.
+func (c *CustomClient) Ping(ctx context.Context) error {
+	// In a real implementation, we would send a request to the custom endpoint, which fails when it cannot be reached
+	return ctx.Err()
+}
+
 // BatchCall implements the LLM interface BatchCall method.
 func (c *CustomClient) BatchCall(ctx context.Context, requests []*models.LLMRequest) ([]*models.LLMResponse, error) {
-	responses := make([]*models.LLMResponse, len(requests))
-	var err error
-
-	// Process each request sequentially
-	for i, req := range requests {
-		responses[i], err = c.Call(ctx, req)
-		if err != nil {
-			return responses, fmt.Errorf("error processing request %d: %w", i, err)
-		}
-	}
+	return common.BatchCall(ctx, requests, c.config.BatchConcurrency, c.Call)
+}
 
-	return responses, nil
+// Model returns the model name this client was created for.
+func (c *CustomClient) Model() string {
+	return c.modelName
 }
 
-// SupportedModels returns a list of model names supported by this client.
+// SupportedModels returns the IDs of the provider's models in the registry.
 func (c *CustomClient) SupportedModels() []string {
-	// Custom models could be anything, so we just return a generic list
-	return []string{
-		"custom-model",
-	}
+	return common.RegisteredModels(models.ProviderCustom)
 }
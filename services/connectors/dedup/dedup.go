@@ -0,0 +1,140 @@
+// Package dedup collapses identical in-flight requests into a single upstream call.
+//
+// When many goroutines send the same prompt at once, as happens when a popular prompt misses
+// the response cache, only the first request is sent to the provider. The others wait for
+// its response instead of each paying for their own. Requests are identical when their
+// common.RequestHash matches.
+//
+// Place the wrapper inside the response cache so that cache misses are deduplicated:
+//
+//	llm = common.Chain(llm, cache.Middleware(store, cache.Options{}), dedup.Middleware(dedup.Options{}))
+package dedup
+
+import (
+	"context"
+	"log/slog"
+	"maps"
+	"sync"
+
+	"github.com/nexen/models"
+	"github.com/nexen/services/connectors/common"
+)
+
+// MetadataKey is the CustomMetadata key set to true on responses shared from another
+// request's call.
+const MetadataKey = "deduplicated"
+
+// Options configures deduplication.
+type Options struct {
+	// Models are the model IDs whose requests are deduplicated. Empty means every model.
+	Models []string
+}
+
+// call is an upstream call that identical requests wait on.
+type call struct {
+	done     chan struct{}
+	response *models.LLMResponse
+	err      error
+}
+
+// dedupLLM shares the calls of identical concurrent requests.
+type dedupLLM struct {
+	common.LLM
+	models map[string]bool
+
+	mu       sync.Mutex
+	inflight map[string]*call
+}
+
+// Wrap returns an LLM that sends identical concurrent requests to llm once.
+func Wrap(llm common.LLM, opts Options) common.LLM {
+	d := &dedupLLM{LLM: llm, inflight: make(map[string]*call)}
+	if len(opts.Models) > 0 {
+		d.models = make(map[string]bool, len(opts.Models))
+		for _, model := range opts.Models {
+			d.models[model] = true
+		}
+	}
+	return d
+}
+
+// Middleware returns a common.Middleware that wraps clients with Wrap.
+func Middleware(opts Options) common.Middleware {
+	return func(next common.LLM) common.LLM { return Wrap(next, opts) }
+}
+
+// Call implements the LLM interface Call method. The upstream call is not canceled when the
+// request that started it is, since other requests may be waiting on it. Shared responses
+// are marked with MetadataKey and have a CostCents of zero, since only the first request
+// was billed.
+func (d *dedupLLM) Call(ctx context.Context, request *models.LLMRequest) (*models.LLMResponse, error) {
+	model := d.model(request)
+	if d.models != nil && !d.models[model] {
+		return d.LLM.Call(ctx, request)
+	}
+	key, err := common.RequestHash(model, request)
+	if err != nil {
+		slog.Warn("request dedup: hashing request", "error", err)
+		return d.LLM.Call(ctx, request)
+	}
+
+	d.mu.Lock()
+	c, shared := d.inflight[key]
+	if !shared {
+		c = &call{done: make(chan struct{})}
+		d.inflight[key] = c
+		go d.run(context.WithoutCancel(ctx), key, c, request)
+	}
+	d.mu.Unlock()
+
+	select {
+	case <-c.done:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	if !shared || c.response == nil {
+		return c.response, c.err
+	}
+	return sharedCopy(c.response, request.Metadata), c.err
+}
+
+// BatchCall implements the LLM interface BatchCall method.
+func (d *dedupLLM) BatchCall(ctx context.Context, requests []*models.LLMRequest) ([]*models.LLMResponse, error) {
+	return common.BatchCall(ctx, requests, common.DefaultBatchConcurrency, d.Call)
+}
+
+// run makes the upstream call for key and releases the requests waiting on it.
+func (d *dedupLLM) run(ctx context.Context, key string, c *call, request *models.LLMRequest) {
+	defer func() {
+		d.mu.Lock()
+		delete(d.inflight, key)
+		d.mu.Unlock()
+		close(c.done)
+	}()
+	c.response, c.err = d.LLM.Call(ctx, request)
+}
+
+// model returns the model request is sent to.
+func (d *dedupLLM) model(request *models.LLMRequest) string {
+	if request.Model != "" {
+		return request.Model
+	}
+	if namer, ok := d.LLM.(common.ModelNamer); ok {
+		return namer.Model()
+	}
+	return ""
+}
+
+// sharedCopy returns a copy of response for a request with metadata that waited on another's
+// call, so callers can modify their response without affecting the others.
+func sharedCopy(response *models.LLMResponse, metadata models.RequestMetadata) *models.LLMResponse {
+	shared := *response
+	shared.CustomMetadata = maps.Clone(response.CustomMetadata)
+	if shared.CustomMetadata == nil {
+		shared.CustomMetadata = make(map[string]any)
+	}
+	shared.CustomMetadata[MetadataKey] = true
+	shared.Usage.CostCents = 0
+	shared.SetRequestMetadata(metadata)
+	return &shared
+}
@@ -0,0 +1,91 @@
+package dedup
+
+import (
+	"context"
+	"errors"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/nexen/models"
+)
+
+// blockingLLM counts calls and answers once release is closed.
+type blockingLLM struct {
+	calls   atomic.Int32
+	release chan struct{}
+}
+
+func (b *blockingLLM) Call(ctx context.Context, request *models.LLMRequest) (*models.LLMResponse, error) {
+	b.calls.Add(1)
+	<-b.release
+	return &models.LLMResponse{
+		Content: &models.Content{Role: "assistant", Message: "echo: " + request.Contents[0].Message},
+		Usage:   models.UsageMetrics{CostCents: 0.5},
+	}, nil
+}
+
+func (b *blockingLLM) BatchCall(ctx context.Context, requests []*models.LLMRequest) ([]*models.LLMResponse, error) {
+	return nil, errors.New("not used")
+}
+
+func (b *blockingLLM) SupportedModels() []string { return []string{"gpt-4"} }
+
+func request(model, message string) *models.LLMRequest {
+	return &models.LLMRequest{Model: model, Contents: []models.Content{{Role: "user", Message: message}}}
+}
+
+// callConcurrently sends n copies of the request once llm has been called, then releases it.
+func callConcurrently(t *testing.T, llm *blockingLLM, wrapped interface {
+	Call(context.Context, *models.LLMRequest) (*models.LLMResponse, error)
+}, model string, n int) []*models.LLMResponse {
+	t.Helper()
+	responses := make([]*models.LLMResponse, n)
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			response, err := wrapped.Call(context.Background(), request(model, "hello"))
+			if err != nil {
+				t.Errorf("Call() error = %v", err)
+			}
+			responses[i] = response
+		}(i)
+	}
+	for llm.calls.Load() == 0 {
+		runtime.Gosched() // wait for the first call to be in flight
+	}
+	close(llm.release)
+	wg.Wait()
+	return responses
+}
+
+func TestDedupCollapsesIdenticalRequests(t *testing.T) {
+	llm := &blockingLLM{release: make(chan struct{})}
+	responses := callConcurrently(t, llm, Wrap(llm, Options{}), "gpt-4", 10)
+
+	// Requests arriving after the call finished start a new one
+	if calls := llm.calls.Load(); calls > 2 {
+		t.Errorf("Expected identical requests to share a call, got %d calls", calls)
+	}
+	var billed float64
+	for _, response := range responses {
+		if response.Content.Message != "echo: hello" {
+			t.Errorf("Expected every request to get the response, got %q", response.Content.Message)
+		}
+		billed += response.Usage.CostCents
+	}
+	if billed != 0.5*float64(llm.calls.Load()) {
+		t.Errorf("Expected only upstream calls to be billed, got %v", billed)
+	}
+}
+
+func TestDedupConfiguredModels(t *testing.T) {
+	llm := &blockingLLM{release: make(chan struct{})}
+	callConcurrently(t, llm, Wrap(llm, Options{Models: []string{"claude-3-opus"}}), "gpt-4", 3)
+	if calls := llm.calls.Load(); calls != 3 {
+		t.Errorf("Expected requests to other models to be sent as is, got %d calls", calls)
+	}
+}
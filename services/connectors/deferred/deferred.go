@@ -0,0 +1,456 @@
+// Package deferred parks non-interactive requests that failed with a transient error, such as
+// a 429 with a long Retry-After or a provider outage, on a delayed retry queue and runs them
+// later instead of failing them. Callers follow a parked request through its Job status.
+// Requests can also be submitted to run in the background from the start, and the callback URI
+// of a request notified with its job once it is done (see Webhook).
+//
+// Jobs are kept in a Store and scheduled on a Queue. Both interfaces are satisfied by
+// libs/store, whose Redis backend keeps the queue in a sorted set shared by every replica.
+package deferred
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/nexen/models"
+	"github.com/nexen/services/connectors/common"
+)
+
+// Job statuses.
+const (
+	StatusPending   = "pending"
+	StatusRunning   = "running"
+	StatusSucceeded = "succeeded"
+	StatusFailed    = "failed"
+)
+
+const (
+	// DefaultQueue is the queue jobs are scheduled on.
+	DefaultQueue = "deferred"
+
+	// DefaultMaxAttempts is how many times a job is tried, counting the original call.
+	DefaultMaxAttempts = 5
+
+	// DefaultDelay is the wait before the first retry when the provider gave no Retry-After.
+	// It doubles with each attempt.
+	DefaultDelay = time.Minute
+
+	// DefaultStatusTTL is how long job status is kept after a job is parked or updated.
+	DefaultStatusTTL = 24 * time.Hour
+
+	// DefaultLease is how long a worker may run an attempt of a job.
+	DefaultLease = 10 * time.Minute
+
+	// SignatureHeader carries the signature of the webhooks of Webhook: "sha256=" and the
+	// hex-encoded HMAC-SHA256 of the body.
+	SignatureHeader = "X-Nexen-Signature"
+
+	jobKeyPrefix = "deferred:job:"
+)
+
+// Queue schedules payloads to become due at a given time.
+type Queue interface {
+	Push(ctx context.Context, queue string, payload []byte, at time.Time) error
+	PopDue(ctx context.Context, queue string, now time.Time, limit int) ([][]byte, error)
+}
+
+// Store holds job records.
+type Store interface {
+	Get(ctx context.Context, key string) ([]byte, error)
+	Set(ctx context.Context, key string, value []byte, ttl time.Duration) error
+}
+
+// Job is a parked request and its status.
+type Job struct {
+	ID       string             `json:"id"`
+	Status   string             `json:"status"`
+	Request  *models.LLMRequest `json:"request"`
+	Attempts int                `json:"attempts"`
+
+	// NextAttempt is when a pending job is run next.
+	NextAttempt time.Time `json:"nextAttempt,omitempty"`
+
+	// Response is set once the job succeeded.
+	Response *models.LLMResponse `json:"response,omitempty"`
+
+	// Error is the last error the job failed with.
+	Error string `json:"error,omitempty"`
+
+	// Caller is data of whoever submitted the job, such as the identity its request is made
+	// for, kept for Scheduler.Call.
+	Caller json.RawMessage `json:"caller,omitempty"`
+
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+// Scheduler parks requests and runs them when they are due.
+type Scheduler struct {
+	queue Queue
+	store Store
+
+	// Resolve returns the client that runs a job's request, e.g. (*connectors.Pool).Get.
+	Resolve func(model string) (common.LLM, error)
+
+	// Call makes an attempt of a job in place of the client of Resolve, e.g. to restore the
+	// job's Caller.
+	Call func(ctx context.Context, job *Job) (*models.LLMResponse, error)
+
+	// Notify is called with each job once it has succeeded or failed for good; RunDue returns
+	// its error. The job is not notified again.
+	Notify func(ctx context.Context, job *Job) error
+
+	// Queue is the queue jobs are scheduled on.
+	Queue string
+
+	// MaxAttempts is how many times a job is tried, counting the original call.
+	MaxAttempts int
+
+	// Delay is the wait before the first retry when the provider gave no Retry-After.
+	Delay time.Duration
+
+	// StatusTTL is how long job status is kept after the job was last updated.
+	StatusTTL time.Duration
+
+	// Lease bounds each attempt of a job. A job found running for longer, whose worker must
+	// have stopped, is run again.
+	Lease time.Duration
+
+	// Concurrency is the number of jobs RunDue runs at once.
+	Concurrency int
+
+	// now is replaceable in tests
+	now func() time.Time
+}
+
+// New creates a scheduler on queue and store that runs jobs with clients from resolve.
+func New(queue Queue, store Store, resolve func(model string) (common.LLM, error)) *Scheduler {
+	return &Scheduler{
+		queue:       queue,
+		store:       store,
+		Resolve:     resolve,
+		Queue:       DefaultQueue,
+		MaxAttempts: DefaultMaxAttempts,
+		Delay:       DefaultDelay,
+		StatusTTL:   DefaultStatusTTL,
+		Lease:       DefaultLease,
+		Concurrency: 1,
+		now:         time.Now,
+	}
+}
+
+// ShouldDefer reports whether err is transient enough to retry later: the provider rate
+// limited the request or was unavailable.
+func ShouldDefer(err error) bool {
+	return errors.Is(err, common.ErrRateLimited) || errors.Is(err, common.ErrProviderUnavailable)
+}
+
+// CallOrDefer calls llm and parks the request when the call fails with an error for which
+// ShouldDefer is true. It returns either the response or the parked job; other errors are
+// returned as they are.
+func (s *Scheduler) CallOrDefer(ctx context.Context, llm common.LLM, request *models.LLMRequest) (*models.LLMResponse, *Job, error) {
+	response, err := llm.Call(ctx, request)
+	if err == nil || !ShouldDefer(err) {
+		return response, nil, err
+	}
+	if request.Model == "" {
+		if namer, ok := llm.(common.ModelNamer); ok {
+			r := *request
+			r.Model = namer.Model()
+			request = &r
+		}
+	}
+	job, deferErr := s.Defer(ctx, request, err)
+	if deferErr != nil {
+		return nil, nil, errors.Join(err, deferErr)
+	}
+	return nil, job, nil
+}
+
+// Defer parks request, which failed with err on its first attempt, and returns its job.
+// The request must name its model, and its contents must survive a JSON round trip: tool
+// instances in ToolsDict are not kept.
+func (s *Scheduler) Defer(ctx context.Context, request *models.LLMRequest, err error) (*Job, error) {
+	if request.Model == "" {
+		return nil, errors.New("deferred: request has no model")
+	}
+	id, idErr := newJobID()
+	if idErr != nil {
+		return nil, idErr
+	}
+	now := s.now()
+	job := &Job{ID: id, Request: request, Attempts: 1, CreatedAt: now}
+	if err := s.reschedule(ctx, job, err); err != nil {
+		return nil, err
+	}
+	return job, nil
+}
+
+// Submit parks request as a job to run as soon as a worker polls, with caller as its Caller,
+// and returns the job. The request must name its model, as for Defer.
+func (s *Scheduler) Submit(ctx context.Context, request *models.LLMRequest, caller json.RawMessage) (*Job, error) {
+	if request.Model == "" {
+		return nil, errors.New("deferred: request has no model")
+	}
+	id, err := newJobID()
+	if err != nil {
+		return nil, err
+	}
+	now := s.now()
+	job := &Job{ID: id, Status: StatusPending, Request: request, NextAttempt: now, Caller: caller, CreatedAt: now}
+	if err := s.save(ctx, job); err != nil {
+		return nil, err
+	}
+	if err := s.queue.Push(ctx, s.Queue, []byte(job.ID), now); err != nil {
+		return nil, err
+	}
+	return job, nil
+}
+
+// Status returns the job with the given ID. Store errors are wrapped, so an unknown or
+// expired job matches the store's not-found error (store.ErrNotFound for libs/store).
+func (s *Scheduler) Status(ctx context.Context, id string) (*Job, error) {
+	data, err := s.store.Get(ctx, jobKeyPrefix+id)
+	if err != nil {
+		return nil, fmt.Errorf("reading job %s: %w", id, err)
+	}
+	var job Job
+	if err := json.Unmarshal(data, &job); err != nil {
+		return nil, fmt.Errorf("decoding job %s: %w", id, err)
+	}
+	return &job, nil
+}
+
+// RunDue runs up to limit jobs that are due, Concurrency at a time, and returns how many it
+// took from the queue. A job that fails again with a deferrable error is parked for another
+// attempt until MaxAttempts is reached. Jobs whose attempt is cut short by ctx being done are
+// put back to run again.
+func (s *Scheduler) RunDue(ctx context.Context, limit int) (int, error) {
+	payloads, err := s.queue.PopDue(ctx, s.Queue, s.now(), limit)
+	if err != nil {
+		return 0, err
+	}
+	var (
+		mu   sync.Mutex
+		errs []error
+		wg   sync.WaitGroup
+	)
+	slots := make(chan struct{}, max(s.Concurrency, 1))
+	for _, payload := range payloads {
+		id := string(payload)
+		slots <- struct{}{}
+		wg.Add(1)
+		go func() {
+			defer func() {
+				<-slots
+				wg.Done()
+			}()
+			if err := s.run(ctx, id); err != nil {
+				mu.Lock()
+				errs = append(errs, err)
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	return len(payloads), errors.Join(errs...)
+}
+
+// Run calls RunDue every interval until ctx is done.
+func (s *Scheduler) Run(ctx context.Context, interval time.Duration, limit int) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+		// Failed attempts are recorded on their jobs; keep serving the queue
+		for {
+			n, _ := s.RunDue(ctx, limit)
+			if n < limit || ctx.Err() != nil {
+				break
+			}
+		}
+	}
+}
+
+// run makes the next attempt of job id and records the outcome. The queue may hold several
+// entries of a job; those that find it running within its lease, done, or not yet due are
+// dropped.
+func (s *Scheduler) run(ctx context.Context, id string) error {
+	job, err := s.Status(ctx, id)
+	if err != nil {
+		return err
+	}
+	now := s.now()
+	switch {
+	case job.Status == StatusPending && !job.NextAttempt.After(now):
+	case job.Status == StatusRunning && !now.Before(job.UpdatedAt.Add(s.Lease)):
+		// Its worker stopped during the attempt
+		if job.Attempts >= s.MaxAttempts {
+			return s.finish(ctx, job, nil, errors.New("deferred: job's worker stopped during its last attempt"))
+		}
+	default:
+		return nil
+	}
+	job.Status = StatusRunning
+	job.Attempts++
+	if err := s.save(ctx, job); err != nil {
+		return err
+	}
+	// Should this worker stop too, the job is run again once its lease ends
+	if err := s.queue.Push(ctx, s.Queue, []byte(job.ID), now.Add(s.Lease)); err != nil {
+		return err
+	}
+
+	attemptCtx, cancel := context.WithTimeout(ctx, s.Lease)
+	response, err := s.call(attemptCtx, job)
+	cancel()
+	if ctx.Err() != nil {
+		return s.release(context.WithoutCancel(ctx), job)
+	}
+	if err != nil && ShouldDefer(err) && job.Attempts < s.MaxAttempts {
+		return s.reschedule(ctx, job, err)
+	}
+	return s.finish(ctx, job, response, err)
+}
+
+// call makes an attempt of job with Call, or with the client of Resolve.
+func (s *Scheduler) call(ctx context.Context, job *Job) (*models.LLMResponse, error) {
+	if s.Call != nil {
+		return s.Call(ctx, job)
+	}
+	llm, err := s.Resolve(job.Request.Model)
+	if err != nil {
+		return nil, err
+	}
+	return llm.Call(ctx, job.Request)
+}
+
+// reschedule parks job for its next attempt after the provider's Retry-After, or after
+// Delay doubled for each earlier attempt.
+func (s *Scheduler) reschedule(ctx context.Context, job *Job, cause error) error {
+	delay := s.Delay << (job.Attempts - 1)
+	var apiErr *common.ProviderError
+	if errors.As(cause, &apiErr) && apiErr.RetryAfter > delay {
+		delay = apiErr.RetryAfter
+	}
+	job.Status = StatusPending
+	job.Error = cause.Error()
+	job.NextAttempt = s.now().Add(delay)
+	if err := s.save(ctx, job); err != nil {
+		return err
+	}
+	return s.queue.Push(ctx, s.Queue, []byte(job.ID), job.NextAttempt)
+}
+
+// release puts back job, whose attempt was cut short by its worker stopping, to be run by
+// the next worker that polls. The attempt does not count.
+func (s *Scheduler) release(ctx context.Context, job *Job) error {
+	job.Status = StatusPending
+	job.Attempts--
+	job.NextAttempt = s.now()
+	if err := s.save(ctx, job); err != nil {
+		return err
+	}
+	return s.queue.Push(ctx, s.Queue, []byte(job.ID), job.NextAttempt)
+}
+
+// finish records the final outcome of job and notifies it.
+func (s *Scheduler) finish(ctx context.Context, job *Job, response *models.LLMResponse, err error) error {
+	job.NextAttempt = time.Time{}
+	if err != nil {
+		job.Status = StatusFailed
+		job.Error = err.Error()
+	} else {
+		job.Status = StatusSucceeded
+		job.Response = response
+		job.Error = ""
+	}
+	if err := s.save(ctx, job); err != nil {
+		return err
+	}
+	if s.Notify != nil {
+		if err := s.Notify(ctx, job); err != nil {
+			return fmt.Errorf("notifying job %s: %w", job.ID, err)
+		}
+	}
+	return nil
+}
+
+// save stores job, keeping it for StatusTTL.
+func (s *Scheduler) save(ctx context.Context, job *Job) error {
+	job.UpdatedAt = s.now()
+	data, err := json.Marshal(job)
+	if err != nil {
+		return fmt.Errorf("encoding job %s: %w", job.ID, err)
+	}
+	if err := s.store.Set(ctx, jobKeyPrefix+job.ID, data, s.StatusTTL); err != nil {
+		return fmt.Errorf("saving job %s: %w", job.ID, err)
+	}
+	return nil
+}
+
+// Webhook returns a Scheduler.Notify that posts each job, without its Caller, as JSON to the
+// LiveConnect.CallbackURI of its request, if any, with client. With a secret, the body is
+// signed in the SignatureHeader. Responses other than 2xx are errors.
+func Webhook(client *http.Client, secret string) func(ctx context.Context, job *Job) error {
+	return func(ctx context.Context, job *Job) error {
+		uri := job.Request.LiveConnect.CallbackURI
+		if uri == "" {
+			return nil
+		}
+		notified := *job
+		notified.Caller = nil
+		body, err := json.Marshal(&notified)
+		if err != nil {
+			return fmt.Errorf("encoding job %s: %w", job.ID, err)
+		}
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, uri, bytes.NewReader(body))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Content-Type", "application/json")
+		if secret != "" {
+			req.Header.Set(SignatureHeader, Sign(secret, body))
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		if resp.StatusCode/100 != 2 {
+			return fmt.Errorf("webhook %s answered %s", uri, resp.Status)
+		}
+		return nil
+	}
+}
+
+// Sign returns the signature of a webhook body with secret, as sent in SignatureHeader, for
+// receivers to compare with hmac.Equal.
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// newJobID returns a random 16-byte hex job ID.
+func newJobID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("generating job ID: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
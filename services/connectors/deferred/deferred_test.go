@@ -0,0 +1,306 @@
+package deferred
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/nexen/models"
+	"github.com/nexen/services/connectors/common"
+)
+
+var errNotFound = errors.New("not found")
+
+// memBackend is an in-memory Queue and Store.
+type memBackend struct {
+	mu    sync.Mutex
+	items map[string][]byte
+	due   map[string]time.Time
+}
+
+func newMemBackend() *memBackend {
+	return &memBackend{items: make(map[string][]byte), due: make(map[string]time.Time)}
+}
+
+func (m *memBackend) Get(ctx context.Context, key string) ([]byte, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	value, ok := m.items[key]
+	if !ok {
+		return nil, errNotFound
+	}
+	return value, nil
+}
+
+func (m *memBackend) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.items[key] = value
+	return nil
+}
+
+func (m *memBackend) Push(ctx context.Context, queue string, payload []byte, at time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.due[string(payload)] = at
+	return nil
+}
+
+func (m *memBackend) PopDue(ctx context.Context, queue string, now time.Time, limit int) ([][]byte, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var ids []string
+	for id, at := range m.due {
+		if !at.After(now) {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+	var payloads [][]byte
+	for _, id := range ids {
+		if len(payloads) == limit {
+			break
+		}
+		delete(m.due, id)
+		payloads = append(payloads, []byte(id))
+	}
+	return payloads, nil
+}
+
+// scriptedLLM returns the queued errors in turn and succeeds once they are used up.
+type scriptedLLM struct {
+	errs  []error
+	calls int
+}
+
+func (s *scriptedLLM) Call(ctx context.Context, request *models.LLMRequest) (*models.LLMResponse, error) {
+	s.calls++
+	if len(s.errs) > 0 {
+		err := s.errs[0]
+		s.errs = s.errs[1:]
+		return nil, err
+	}
+	return &models.LLMResponse{Content: &models.Content{Role: "assistant", Message: "done"}}, nil
+}
+
+func (s *scriptedLLM) BatchCall(ctx context.Context, requests []*models.LLMRequest) ([]*models.LLMResponse, error) {
+	return nil, errors.New("not used")
+}
+
+func (s *scriptedLLM) SupportedModels() []string { return []string{"test-model"} }
+
+func (s *scriptedLLM) Model() string { return "test-model" }
+
+func rateLimited(retryAfter time.Duration) error {
+	return &common.ProviderError{Provider: "test", StatusCode: 429, Class: common.ErrRateLimited, RetryAfter: retryAfter}
+}
+
+func newTestScheduler(llm common.LLM) (*Scheduler, *time.Time) {
+	backend := newMemBackend()
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	s := New(backend, backend, func(model string) (common.LLM, error) { return llm, nil })
+	s.now = func() time.Time { return now }
+	return s, &now
+}
+
+func TestCallOrDeferRunsJobLater(t *testing.T) {
+	ctx := context.Background()
+	llm := &scriptedLLM{errs: []error{rateLimited(2 * time.Hour)}}
+	s, now := newTestScheduler(llm)
+
+	request := &models.LLMRequest{Contents: []models.Content{{Role: "user", Message: "Summarize the report"}}}
+	response, job, err := s.CallOrDefer(ctx, llm, request)
+	if err != nil || response != nil || job == nil {
+		t.Fatalf("Expected the request to be parked, got %v, %v, %v", response, job, err)
+	}
+	if job.Status != StatusPending || !job.NextAttempt.Equal(now.Add(2*time.Hour)) || job.Request.Model != "test-model" {
+		t.Errorf("Expected a pending job honoring Retry-After, got %+v", job)
+	}
+
+	// Nothing runs before the job is due
+	if n, err := s.RunDue(ctx, 10); n != 0 || err != nil {
+		t.Fatalf("Expected no due jobs, got %d, %v", n, err)
+	}
+
+	*now = now.Add(2 * time.Hour)
+	if n, err := s.RunDue(ctx, 10); n != 1 || err != nil {
+		t.Fatalf("Expected one due job, got %d, %v", n, err)
+	}
+	status, err := s.Status(ctx, job.ID)
+	if err != nil {
+		t.Fatalf("Status() error = %v", err)
+	}
+	if status.Status != StatusSucceeded || status.Attempts != 2 || status.Response.Content.Message != "done" {
+		t.Errorf("Expected the job to succeed on its second attempt, got %+v", status)
+	}
+
+	if _, err := s.Status(ctx, "unknown"); !errors.Is(err, errNotFound) {
+		t.Errorf("Expected the store's not-found error, got %v", err)
+	}
+}
+
+func TestCallOrDeferReturnsOtherErrors(t *testing.T) {
+	authErr := &common.ProviderError{Provider: "test", StatusCode: 401, Class: common.ErrAuth}
+	llm := &scriptedLLM{errs: []error{authErr}}
+	s, _ := newTestScheduler(llm)
+
+	_, job, err := s.CallOrDefer(context.Background(), llm, &models.LLMRequest{Model: "test-model"})
+	if job != nil || !errors.Is(err, common.ErrAuth) {
+		t.Errorf("Expected the auth error without a job, got %v, %v", job, err)
+	}
+}
+
+func TestJobFailsAfterMaxAttempts(t *testing.T) {
+	ctx := context.Background()
+	unavailable := &common.ProviderError{Provider: "test", StatusCode: 503, Class: common.ErrProviderUnavailable}
+	llm := &scriptedLLM{errs: []error{unavailable, unavailable, unavailable}}
+	s, now := newTestScheduler(llm)
+	s.MaxAttempts = 3
+
+	_, job, err := s.CallOrDefer(ctx, llm, &models.LLMRequest{Model: "test-model"})
+	if err != nil {
+		t.Fatalf("CallOrDefer() error = %v", err)
+	}
+
+	// Backoff doubles from Delay: the retries are due after 1 and then 2 more minutes
+	for _, wait := range []time.Duration{time.Minute, 2 * time.Minute} {
+		*now = now.Add(wait)
+		if n, err := s.RunDue(ctx, 10); n != 1 || err != nil {
+			t.Fatalf("Expected one due job after %v, got %d, %v", wait, n, err)
+		}
+	}
+
+	status, _ := s.Status(ctx, job.ID)
+	if status.Status != StatusFailed || status.Attempts != 3 || status.Error == "" {
+		t.Errorf("Expected the job to fail after 3 attempts, got %+v", status)
+	}
+	if llm.calls != 3 {
+		t.Errorf("Expected 3 calls, got %d", llm.calls)
+	}
+}
+
+func TestSubmit(t *testing.T) {
+	ctx := context.Background()
+	s, _ := newTestScheduler(&scriptedLLM{})
+	var notified []*Job
+	s.Call = func(ctx context.Context, job *Job) (*models.LLMResponse, error) {
+		if string(job.Caller) != `{"key":"search"}` {
+			t.Errorf("Expected the job's caller, got %s", job.Caller)
+		}
+		return &models.LLMResponse{Content: &models.Content{Role: "assistant", Message: "report"}}, nil
+	}
+	s.Notify = func(ctx context.Context, job *Job) error {
+		notified = append(notified, job)
+		return nil
+	}
+
+	job, err := s.Submit(ctx, &models.LLMRequest{Model: "test-model"}, json.RawMessage(`{"key":"search"}`))
+	if err != nil || job.Status != StatusPending || job.Attempts != 0 {
+		t.Fatalf("Expected a pending job, got %+v, %v", job, err)
+	}
+	if n, err := s.RunDue(ctx, 10); n != 1 || err != nil {
+		t.Fatalf("Expected the job to be due at once, got %d, %v", n, err)
+	}
+	status, _ := s.Status(ctx, job.ID)
+	if status.Status != StatusSucceeded || status.Attempts != 1 || status.Response.Content.Message != "report" {
+		t.Errorf("Expected the job to succeed, got %+v", status)
+	}
+	if len(notified) != 1 || notified[0].ID != job.ID {
+		t.Errorf("Expected the job to be notified once, got %v", notified)
+	}
+
+	if _, err := s.Submit(ctx, &models.LLMRequest{}, nil); err == nil {
+		t.Error("Expected a request without a model to be refused")
+	}
+}
+
+func TestJobOfStoppedWorkerRunsAgain(t *testing.T) {
+	ctx := context.Background()
+	s, now := newTestScheduler(&scriptedLLM{})
+	s.MaxAttempts = 2
+	job, _ := s.Submit(ctx, &models.LLMRequest{Model: "test-model"}, nil)
+
+	// A worker takes the job and stops during its attempt
+	job.Status, job.Attempts = StatusRunning, 1
+	if err := s.save(ctx, job); err != nil {
+		t.Fatal(err)
+	}
+
+	// Entries of the job found during its lease are dropped
+	*now = now.Add(s.Lease - time.Second)
+	s.RunDue(ctx, 10)
+	if status, _ := s.Status(ctx, job.ID); status.Status != StatusRunning || status.Attempts != 1 {
+		t.Errorf("Expected the job to be left to its worker during its lease, got %+v", status)
+	}
+
+	*now = now.Add(time.Second)
+	s.queue.Push(ctx, s.Queue, []byte(job.ID), *now)
+	s.RunDue(ctx, 10)
+	if status, _ := s.Status(ctx, job.ID); status.Status != StatusSucceeded || status.Attempts != 2 {
+		t.Errorf("Expected the job to run again after its lease, got %+v", status)
+	}
+}
+
+func TestStoppedWorkerReleasesJob(t *testing.T) {
+	s, _ := newTestScheduler(&scriptedLLM{})
+	ctx, cancel := context.WithCancel(context.Background())
+	s.Call = func(ctx context.Context, job *Job) (*models.LLMResponse, error) {
+		cancel()
+		return nil, ctx.Err()
+	}
+	job, _ := s.Submit(ctx, &models.LLMRequest{Model: "test-model"}, nil)
+	if _, err := s.RunDue(ctx, 10); err != nil {
+		t.Fatalf("RunDue() error = %v", err)
+	}
+	status, _ := s.Status(context.Background(), job.ID)
+	if status.Status != StatusPending || status.Attempts != 0 {
+		t.Errorf("Expected the job to be put back, got %+v", status)
+	}
+	if due, _ := s.queue.PopDue(context.Background(), s.Queue, s.now(), 10); len(due) != 1 {
+		t.Errorf("Expected the job to be due again, got %q", due)
+	}
+}
+
+func TestWebhook(t *testing.T) {
+	var body []byte
+	var signature string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ = io.ReadAll(r.Body)
+		signature = r.Header.Get(SignatureHeader)
+	}))
+	defer srv.Close()
+	notify := Webhook(srv.Client(), "secret")
+
+	request := &models.LLMRequest{Model: "test-model", LiveConnect: models.LiveConnectConfig{CallbackURI: srv.URL}}
+	job := &Job{ID: "job1", Status: StatusSucceeded, Request: request, Caller: json.RawMessage(`{"key":"search"}`)}
+	if err := notify(context.Background(), job); err != nil {
+		t.Fatalf("Webhook error = %v", err)
+	}
+	var got Job
+	if err := json.Unmarshal(body, &got); err != nil || got.ID != "job1" || got.Caller != nil {
+		t.Errorf("Expected the job without its caller, got %s", body)
+	}
+	if signature != Sign("secret", body) {
+		t.Errorf("Expected the body's signature, got %q", signature)
+	}
+
+	// Jobs without a callback URI are not sent
+	request.LiveConnect.CallbackURI = ""
+	body = nil
+	if err := notify(context.Background(), job); err != nil || body != nil {
+		t.Errorf("Expected nothing to be sent, got %s, %v", body, err)
+	}
+
+	request.LiveConnect.CallbackURI = srv.URL + "/missing"
+	srv.Config.Handler = http.NotFoundHandler()
+	if err := notify(context.Background(), job); err == nil {
+		t.Error("Expected an error for a 404")
+	}
+}
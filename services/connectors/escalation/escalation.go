@@ -0,0 +1,126 @@
+// Package escalation re-runs low-scoring requests on a stronger model.
+//
+// Scores are read from the response's CustomMetadata, such as the confidence score recorded
+// by the confidence package. When any configured score is below its threshold, the request is
+// sent to the premium model and the better-scoring of the two answers is returned.
+package escalation
+
+import (
+	"context"
+	"fmt"
+	"math"
+
+	"github.com/nexen/models"
+	"github.com/nexen/services/connectors/common"
+	"github.com/nexen/services/connectors/confidence"
+)
+
+// CustomMetadata keys set on responses that went through escalation.
+const (
+	MetadataEscalated     = "escalated"      // true when the premium model was called
+	MetadataEscalatedFrom = "escalated_from" // model ID of the first attempt
+)
+
+// Policy configures when and where requests are escalated.
+type Policy struct {
+	// Thresholds maps CustomMetadata score keys to the minimum acceptable score.
+	// A response missing a configured score counts as below the threshold.
+	Thresholds map[string]float64
+
+	// Premium is the client for the stronger model.
+	Premium common.LLM
+
+	// PremiumModel is the model ID sent to Premium.
+	PremiumModel string
+
+	// Estimator, if set, scores responses that do not already carry a confidence score.
+	Estimator confidence.Estimator
+}
+
+// escalatingLLM applies a Policy to every call.
+type escalatingLLM struct {
+	common.LLM
+	policy Policy
+}
+
+// New returns an LLM that applies policy to responses from llm.
+func New(llm common.LLM, policy Policy) (common.LLM, error) {
+	if policy.Premium == nil || policy.PremiumModel == "" {
+		return nil, fmt.Errorf("escalation policy requires a premium model")
+	}
+	if len(policy.Thresholds) == 0 {
+		return nil, fmt.Errorf("escalation policy requires at least one threshold")
+	}
+	return &escalatingLLM{LLM: llm, policy: policy}, nil
+}
+
+// Call implements the LLM interface Call method. The returned response's Usage covers both
+// attempts when the request was escalated.
+func (e *escalatingLLM) Call(ctx context.Context, request *models.LLMRequest) (*models.LLMResponse, error) {
+	response, err := e.LLM.Call(ctx, request)
+	if err != nil || response.IsError() {
+		return response, err
+	}
+	e.score(ctx, request, response)
+
+	margin := e.margin(response)
+	if margin >= 0 {
+		return response, nil
+	}
+
+	premiumRequest := *request
+	premiumRequest.Model = e.policy.PremiumModel
+	premium, err := e.policy.Premium.Call(ctx, &premiumRequest)
+	if err != nil || premium.IsError() {
+		// Keep the first answer; it is still usable, just below the bar
+		return response, nil
+	}
+	e.score(ctx, &premiumRequest, premium)
+
+	best := response
+	if e.margin(premium) >= margin {
+		best = premium
+	}
+	best.Usage = response.Usage.Add(premium.Usage)
+	setMetadata(best, MetadataEscalated, true)
+	setMetadata(best, MetadataEscalatedFrom, request.Model)
+	return best, nil
+}
+
+// BatchCall implements the LLM interface BatchCall method.
+func (e *escalatingLLM) BatchCall(ctx context.Context, requests []*models.LLMRequest) ([]*models.LLMResponse, error) {
+	return common.BatchCall(ctx, requests, common.DefaultBatchConcurrency, e.Call)
+}
+
+// score runs the estimator on responses that are not scored yet. Estimation is best effort.
+func (e *escalatingLLM) score(ctx context.Context, request *models.LLMRequest, response *models.LLMResponse) {
+	if e.policy.Estimator == nil {
+		return
+	}
+	if _, ok := response.Confidence(); ok {
+		return
+	}
+	confidence.Annotate(ctx, e.policy.Estimator, request, response)
+}
+
+// margin returns the smallest difference between a score and its threshold. A negative
+// margin means at least one score is below its threshold.
+func (e *escalatingLLM) margin(response *models.LLMResponse) float64 {
+	margin := math.Inf(1)
+	for key, threshold := range e.policy.Thresholds {
+		score, ok := response.CustomMetadata[key].(float64)
+		if !ok {
+			score = 0
+		}
+		margin = math.Min(margin, score-threshold)
+	}
+	return margin
+}
+
+// setMetadata records a value in the response's CustomMetadata.
+func setMetadata(response *models.LLMResponse, key string, value any) {
+	if response.CustomMetadata == nil {
+		response.CustomMetadata = make(map[string]any)
+	}
+	response.CustomMetadata[key] = value
+}
@@ -0,0 +1,101 @@
+package escalation
+
+import (
+	"context"
+	"testing"
+
+	"github.com/nexen/models"
+)
+
+// scoredLLM answers with a fixed message and confidence score and counts its calls.
+type scoredLLM struct {
+	reply string
+	score float64
+	calls int
+	model string
+}
+
+func (s *scoredLLM) Call(ctx context.Context, request *models.LLMRequest) (*models.LLMResponse, error) {
+	s.calls++
+	s.model = request.Model
+	response := &models.LLMResponse{
+		Content: &models.Content{Role: "assistant", Message: s.reply},
+		Usage:   models.UsageMetrics{TotalTokens: 10, CostCents: 1},
+	}
+	response.SetConfidence(s.score)
+	return response, nil
+}
+
+func (s *scoredLLM) BatchCall(ctx context.Context, requests []*models.LLMRequest) ([]*models.LLMResponse, error) {
+	return nil, nil
+}
+
+func (s *scoredLLM) SupportedModels() []string {
+	return []string{"scored"}
+}
+
+func newRequest() *models.LLMRequest {
+	return &models.LLMRequest{Model: "cheap", Contents: []models.Content{{Role: "user", Message: "Hi"}}}
+}
+
+func TestEscalation(t *testing.T) {
+	testCases := []struct {
+		name          string
+		cheapScore    float64
+		premiumScore  float64
+		wantReply     string
+		wantPremium   int
+		wantEscalated bool
+	}{
+		{"confident", 0.9, 0.95, "cheap", 0, false},
+		{"premium better", 0.3, 0.9, "premium", 1, true},
+		{"premium worse", 0.5, 0.2, "cheap", 1, true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			cheap := &scoredLLM{reply: "cheap", score: tc.cheapScore}
+			premium := &scoredLLM{reply: "premium", score: tc.premiumScore}
+			llm, err := New(cheap, Policy{
+				Thresholds:   map[string]float64{models.MetadataConfidence: 0.7},
+				Premium:      premium,
+				PremiumModel: "premium-model",
+			})
+			if err != nil {
+				t.Fatalf("New failed: %v", err)
+			}
+
+			response, err := llm.Call(context.Background(), newRequest())
+			if err != nil {
+				t.Fatalf("Call failed: %v", err)
+			}
+			if response.Content.Message != tc.wantReply {
+				t.Errorf("Expected %q answer, got %q", tc.wantReply, response.Content.Message)
+			}
+			if premium.calls != tc.wantPremium {
+				t.Errorf("Expected %d premium calls, got %d", tc.wantPremium, premium.calls)
+			}
+			escalated, _ := response.CustomMetadata[MetadataEscalated].(bool)
+			if escalated != tc.wantEscalated {
+				t.Errorf("Expected escalated=%v, got %v", tc.wantEscalated, escalated)
+			}
+			if tc.wantEscalated {
+				if premium.model != "premium-model" {
+					t.Errorf("Expected premium request model, got %q", premium.model)
+				}
+				if response.Usage.TotalTokens != 20 || response.Usage.CostCents != 2 {
+					t.Errorf("Expected usage of both attempts, got %+v", response.Usage)
+				}
+			}
+		})
+	}
+}
+
+func TestNewValidatesPolicy(t *testing.T) {
+	if _, err := New(&scoredLLM{}, Policy{Thresholds: map[string]float64{"confidence": 0.5}}); err == nil {
+		t.Error("Expected error without a premium model")
+	}
+	if _, err := New(&scoredLLM{}, Policy{Premium: &scoredLLM{}, PremiumModel: "p"}); err == nil {
+		t.Error("Expected error without thresholds")
+	}
+}
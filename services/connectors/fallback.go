@@ -0,0 +1,132 @@
+package connectors
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/nexen/models"
+	"github.com/nexen/services/connectors/common"
+)
+
+// CustomMetadata keys set on responses from a FallbackLLM.
+const (
+	MetadataServedBy         = common.MetadataServedBy // model that produced the response
+	MetadataFallbackAttempts = "fallback_attempts"     // number of models tried, including the one that answered
+)
+
+// FallbackLLM sends each request to a chain of models, moving on to the next model when one
+// fails with a transient error: rate limiting, provider unavailability (5xx and network
+// failures), or a per-call timeout. Other errors, such as invalid requests, are returned
+// immediately since another model would fail the same way.
+type FallbackLLM struct {
+	chain []LLM
+
+	// Budget bounds the whole chain, including every fallback attempt. Zero leaves only the
+	// caller's context deadline. No further model is tried once the budget is spent.
+	Budget time.Duration
+
+	// Health, when set, moves the models it considers unhealthy to the end of the chain,
+	// keeping the configured order otherwise, so that requests skip models that are failing.
+	Health *HealthTracker
+}
+
+// NewFallbackLLM returns an LLM that tries primary first and then each of fallbacks in order.
+func NewFallbackLLM(primary LLM, fallbacks ...LLM) *FallbackLLM {
+	return &FallbackLLM{chain: append([]LLM{primary}, fallbacks...)}
+}
+
+// Call implements the LLM interface Call method. The request is sent to each model in the
+// chain under that model's name when it is known (see common.ModelNamer). When every model
+// fails, the error wraps all of their errors.
+func (f *FallbackLLM) Call(ctx context.Context, request *models.LLMRequest) (*models.LLMResponse, error) {
+	if f.Budget > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, f.Budget)
+		defer cancel()
+	}
+
+	var errs []error
+	for i, llm := range f.order(request.Model) {
+		attempt := request
+		model := request.Model
+		if namer, ok := llm.(common.ModelNamer); ok {
+			model = namer.Model()
+			if model != request.Model {
+				r := *request
+				r.Model = model
+				attempt = &r
+			}
+		}
+
+		response, err := llm.Call(ctx, attempt)
+		if err == nil {
+			if response.CustomMetadata == nil {
+				response.CustomMetadata = make(map[string]any)
+			}
+			response.CustomMetadata[MetadataServedBy] = model
+			response.CustomMetadata[MetadataFallbackAttempts] = i + 1
+			return response, nil
+		}
+
+		errs = append(errs, fmt.Errorf("%s: %w", model, err))
+		if ctx.Err() != nil || !shouldFallback(err) {
+			break
+		}
+	}
+
+	if len(errs) == 1 {
+		return nil, errors.Unwrap(errs[0])
+	}
+	return nil, fmt.Errorf("%d models failed: %w", len(errs), errors.Join(errs...))
+}
+
+// order returns the chain with the models Health considers unhealthy moved to the end.
+// defaultModel names the LLMs that do not report a model.
+func (f *FallbackLLM) order(defaultModel string) []LLM {
+	if f.Health == nil {
+		return f.chain
+	}
+	healthy := make([]LLM, 0, len(f.chain))
+	var unhealthy []LLM
+	for _, llm := range f.chain {
+		model := defaultModel
+		if namer, ok := llm.(common.ModelNamer); ok {
+			model = namer.Model()
+		}
+		if f.Health.Healthy(model) {
+			healthy = append(healthy, llm)
+		} else {
+			unhealthy = append(unhealthy, llm)
+		}
+	}
+	return append(healthy, unhealthy...)
+}
+
+// shouldFallback reports whether another model might succeed where err failed.
+func shouldFallback(err error) bool {
+	return errors.Is(err, common.ErrRateLimited) ||
+		errors.Is(err, common.ErrProviderUnavailable) ||
+		errors.Is(err, context.DeadlineExceeded)
+}
+
+// BatchCall implements the LLM interface BatchCall method.
+func (f *FallbackLLM) BatchCall(ctx context.Context, requests []*models.LLMRequest) ([]*models.LLMResponse, error) {
+	return common.BatchCall(ctx, requests, common.DefaultBatchConcurrency, f.Call)
+}
+
+// SupportedModels returns the models supported by any LLM in the chain.
+func (f *FallbackLLM) SupportedModels() []string {
+	seen := make(map[string]bool)
+	var supported []string
+	for _, llm := range f.chain {
+		for _, model := range llm.SupportedModels() {
+			if !seen[model] {
+				seen[model] = true
+				supported = append(supported, model)
+			}
+		}
+	}
+	return supported
+}
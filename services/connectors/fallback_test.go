@@ -0,0 +1,112 @@
+package connectors
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/nexen/models"
+	"github.com/nexen/services/connectors/common"
+)
+
+// namedLLM is bound to one model and fails with err, or waits for ctx when block is set.
+type namedLLM struct {
+	mockLLM
+	model string
+	err   error
+	block bool
+	calls int
+	seen  string
+}
+
+func (n *namedLLM) Model() string {
+	return n.model
+}
+
+func (n *namedLLM) Call(ctx context.Context, request *models.LLMRequest) (*models.LLMResponse, error) {
+	n.calls++
+	n.seen = request.Model
+	if n.block {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+	if n.err != nil {
+		return nil, n.err
+	}
+	return &models.LLMResponse{Content: &models.Content{Role: "assistant", Message: n.model}}, nil
+}
+
+func fallbackRequest() *models.LLMRequest {
+	return &models.LLMRequest{Model: "primary", Contents: []models.Content{{Role: "user", Message: "Hi"}}}
+}
+
+func TestFallbackLLMMovesDownTheChain(t *testing.T) {
+	primary := &namedLLM{model: "primary", err: common.NewProviderError(models.ProviderOpenAI, 429, "rate_limit_exceeded", "slow down")}
+	second := &namedLLM{model: "second", err: common.NewProviderError(models.ProviderAnthropic, 529, "overloaded_error", "overloaded")}
+	third := &namedLLM{model: "third"}
+
+	response, err := NewFallbackLLM(primary, second, third).Call(context.Background(), fallbackRequest())
+	if err != nil {
+		t.Fatalf("Call failed: %v", err)
+	}
+	if response.CustomMetadata[MetadataServedBy] != "third" || response.CustomMetadata[MetadataFallbackAttempts] != 3 {
+		t.Errorf("Unexpected metadata %v", response.CustomMetadata)
+	}
+	if third.seen != "third" {
+		t.Errorf("Expected the fallback's model on the request, got %q", third.seen)
+	}
+}
+
+func TestFallbackLLMStopsOnPermanentErrors(t *testing.T) {
+	invalid := common.NewProviderError(models.ProviderOpenAI, 400, "invalid_request_error", "bad request")
+	primary := &namedLLM{model: "primary", err: invalid}
+	second := &namedLLM{model: "second"}
+
+	_, err := NewFallbackLLM(primary, second).Call(context.Background(), fallbackRequest())
+	if !errors.Is(err, invalid) || second.calls != 0 {
+		t.Errorf("Expected the primary's error without fallback, got %v after %d fallback calls", err, second.calls)
+	}
+
+	unavailable := common.NewProviderError(models.ProviderOpenAI, 503, "", "unavailable")
+	primary.err, second.err = unavailable, unavailable
+	_, err = NewFallbackLLM(primary, second).Call(context.Background(), fallbackRequest())
+	if !errors.Is(err, common.ErrProviderUnavailable) || second.calls != 1 {
+		t.Errorf("Expected both errors when every model fails, got %v", err)
+	}
+}
+
+func TestFallbackLLMRespectsBudget(t *testing.T) {
+	primary := &namedLLM{model: "primary", block: true}
+	second := &namedLLM{model: "second"}
+	llm := NewFallbackLLM(primary, second)
+	llm.Budget = 20 * time.Millisecond
+
+	start := time.Now()
+	_, err := llm.Call(context.Background(), fallbackRequest())
+	if !errors.Is(err, context.DeadlineExceeded) || second.calls != 0 {
+		t.Errorf("Expected the budget to end the chain, got %v after %d fallback calls", err, second.calls)
+	}
+	if time.Since(start) > time.Second {
+		t.Error("Expected the call to stop at the budget")
+	}
+}
+
+func TestFallbackLLMSkipsUnhealthyModels(t *testing.T) {
+	health := NewHealthTracker(HealthOptions{MinSamples: 1})
+	health.Observe("primary", time.Second, common.NewProviderError(models.ProviderOpenAI, 503, "unavailable", "down"))
+
+	primary := &namedLLM{model: "primary"}
+	second := &namedLLM{model: "second"}
+	fallback := NewFallbackLLM(primary, second)
+	fallback.Health = health
+
+	response, err := fallback.Call(context.Background(), fallbackRequest())
+	if err != nil {
+		t.Fatalf("Call failed: %v", err)
+	}
+	if response.CustomMetadata[MetadataServedBy] != "second" || primary.calls != 0 {
+		t.Errorf("Expected the unhealthy primary to be tried last, served by %v after %d primary calls",
+			response.CustomMetadata[MetadataServedBy], primary.calls)
+	}
+}
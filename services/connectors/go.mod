@@ -4,14 +4,32 @@ go 1.21
 
 require (
 	github.com/anthropics/anthropic-sdk-go v0.2.0-beta.4
+	github.com/nexen/libs/nexenctx v0.0.0
+	github.com/nexen/libs/paging v0.0.0
 	github.com/nexen/models v0.0.0
+	github.com/pkoukk/tiktoken-go v0.1.7
+	github.com/pkoukk/tiktoken-go-loader v0.0.2
+	golang.org/x/text v0.16.0
 )
 
 require (
+	github.com/dlclark/regexp2 v1.10.0 // indirect
+	github.com/google/uuid v1.3.0 // indirect
+	github.com/mattn/go-colorable v0.1.13 // indirect
+	github.com/mattn/go-isatty v0.0.19 // indirect
+	github.com/nexen/libs/logging v0.0.0 // indirect
+	github.com/rs/zerolog v1.34.0 // indirect
 	github.com/tidwall/gjson v1.14.4 // indirect
 	github.com/tidwall/match v1.1.1 // indirect
 	github.com/tidwall/pretty v1.2.1 // indirect
 	github.com/tidwall/sjson v1.2.5 // indirect
+	golang.org/x/sys v0.22.0 // indirect
+	gopkg.in/yaml.v3 v3.0.1 // indirect
 )
 
-replace github.com/nexen/models => ../../models
+replace (
+	github.com/nexen/libs/logging => ../../libs/logging
+	github.com/nexen/libs/nexenctx => ../../libs/nexenctx
+	github.com/nexen/libs/paging => ../../libs/paging
+	github.com/nexen/models => ../../models
+)
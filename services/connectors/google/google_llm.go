@@ -28,6 +28,13 @@ type GoogleClient struct {
 	// client *vertexai.Client
 }
 
+// The interfaces GoogleClient implements, checked at compile time.
+var (
+	_ common.LLM        = (*GoogleClient)(nil)
+	_ common.ModelNamer = (*GoogleClient)(nil)
+	_ common.Pinger     = (*GoogleClient)(nil)
+)
+
 // init registers this adapter with the connectors registry.
 func init() {
 	for _, pattern := range supportedModelPatterns {
@@ -56,6 +63,43 @@ func NewGoogleClient(model string, opts ...common.Option) (common.LLM, error) {
 	}, nil
 }
 
+// generationConfig is the generationConfig object of a Gemini generateContent request.
+type generationConfig struct {
+	Temperature      float64            `json:"temperature,omitempty"`
+	TopP             float64            `json:"topP,omitempty"`
+	MaxOutputTokens  int                `json:"maxOutputTokens,omitempty"`
+	StopSequences    []string           `json:"stopSequences,omitempty"`
+	ResponseMimeType string             `json:"responseMimeType,omitempty"`
+	ResponseSchema   *models.JSONSchema `json:"responseSchema,omitempty"`
+}
+
+// newGenerationConfig maps the request config to Gemini's generationConfig.
+// An output schema is passed as responseSchema and implies the JSON mime type, as does JSONMode.
+func newGenerationConfig(config *models.GenerateContentConfig) (*generationConfig, error) {
+	if config == nil {
+		return nil, nil
+	}
+	genConfig := &generationConfig{
+		Temperature:      config.Temperature,
+		TopP:             config.TopP,
+		MaxOutputTokens:  config.MaxTokens,
+		StopSequences:    config.StopSequences,
+		ResponseMimeType: config.ResponseMimeType,
+	}
+
+	schema, err := config.OutputSchema()
+	if err != nil {
+		return nil, fmt.Errorf("converting response schema: %w", err)
+	}
+	if schema != nil {
+		genConfig.ResponseSchema = schema
+		genConfig.ResponseMimeType = "application/json"
+	} else if config.JSONMode {
+		genConfig.ResponseMimeType = "application/json"
+	}
+	return genConfig, nil
+}
+
 // Call implements the LLM interface Call method.
 func (c *GoogleClient) Call(ctx context.Context, request *models.LLMRequest) (*models.LLMResponse, error) {
 	// Check if context is done
@@ -68,8 +112,13 @@ func (c *GoogleClient) Call(ctx context.Context, request *models.LLMRequest) (*m
 		return nil, fmt.Errorf("invalid request: %w", err)
 	}
 
+	// Map generation parameters, including the structured output schema
+	if _, err := newGenerationConfig(request.Config); err != nil {
+		return nil, fmt.Errorf("invalid request: %w", err)
+	}
+
 	// In a real implementation, we would:
-	// 1. Transform the models.LLMRequest to Google's request format
+	// 1. Transform the rest of the models.LLMRequest to Google's request format
 	// 2. Call the Google API
 	// 3. Transform the response to models.LLMResponse
 	// 4. Handle errors, retries, and streaming if requested
@@ -100,29 +149,23 @@ func (c *GoogleClient) Call(ctx context.Context, request *models.LLMRequest) (*m
 	}, nil
 }
 
+// Ping implements common.Pinger.
+func (c *GoogleClient) Ping(ctx context.Context) error {
+	// In a real implementation, we would list the models of the Gemini API, which refuses an invalid API key
+	return ctx.Err()
+}
+
 // BatchCall implements the LLM interface BatchCall method.
 func (c *GoogleClient) BatchCall(ctx context.Context, requests []*models.LLMRequest) ([]*models.LLMResponse, error) {
-	responses := make([]*models.LLMResponse, len(requests))
-	var err error
-
-	// Process each request sequentially
-	// In a real implementation, we might consider parallel processing with rate limiting
-	for i, req := range requests {
-		responses[i], err = c.Call(ctx, req)
-		if err != nil {
-			return responses, fmt.Errorf("error processing request %d: %w", i, err)
-		}
-	}
+	return common.BatchCall(ctx, requests, c.config.BatchConcurrency, c.Call)
+}
 
-	return responses, nil
+// Model returns the model name this client was created for.
+func (c *GoogleClient) Model() string {
+	return c.modelName
 }
 
-// SupportedModels returns a list of model names supported by this client.
+// SupportedModels returns the IDs of the provider's models in the registry.
 func (c *GoogleClient) SupportedModels() []string {
-	// In a real implementation, we might fetch this from the API
-	// or from the models registry
-	return []string{
-		"gemini-pro",
-		"gemini-ultra",
-	}
+	return common.RegisteredModels(models.ProviderGoogle)
 }
@@ -0,0 +1,27 @@
+package google
+
+import (
+	"testing"
+
+	"github.com/nexen/models"
+)
+
+func TestNewGenerationConfigResponseSchema(t *testing.T) {
+	type answer struct {
+		City string `json:"city"`
+	}
+	request := &models.LLMRequest{}
+	request.SetOutputSchema(answer{})
+	request.Config.ResponseMimeType = ""
+
+	genConfig, err := newGenerationConfig(request.Config)
+	if err != nil {
+		t.Fatalf("newGenerationConfig() error = %v", err)
+	}
+	if genConfig.ResponseMimeType != "application/json" {
+		t.Errorf("Expected JSON mime type, got %q", genConfig.ResponseMimeType)
+	}
+	if genConfig.ResponseSchema == nil || genConfig.ResponseSchema.Properties["city"] == nil {
+		t.Errorf("Expected responseSchema with city, got %+v", genConfig.ResponseSchema)
+	}
+}
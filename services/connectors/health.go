@@ -0,0 +1,298 @@
+package connectors
+
+import (
+	"context"
+	"errors"
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/nexen/models"
+)
+
+// Defaults of HealthOptions.
+const (
+	DefaultHealthAlpha         = 0.1
+	DefaultHealthWindow        = 200
+	DefaultHealthMinSamples    = 10
+	DefaultHealthMaxErrorRate  = 0.5
+	DefaultHealthRecoveryAfter = time.Minute
+)
+
+// HealthOptions configures a HealthTracker. Zero values use the defaults.
+type HealthOptions struct {
+	// Alpha weighs the latest observation in the moving averages of latency and errors.
+	Alpha float64
+
+	// Window is the number of recent latencies the percentiles are computed from.
+	Window int
+
+	// MinSamples is the number of calls a model needs before it can be unhealthy.
+	MinSamples int
+
+	// MaxErrorRate is the moving error rate above which a model is unhealthy.
+	MaxErrorRate float64
+
+	// RecoveryAfter is how long after its last error an unhealthy model is given traffic
+	// again, since it has no other way to show it recovered.
+	RecoveryAfter time.Duration
+}
+
+// CircuitState is the state of a model's circuit breaker, as derived from its health.
+type CircuitState string
+
+const (
+	// CircuitClosed lets the model's calls through: it has too few calls to tell, or its
+	// error rate is within MaxErrorRate.
+	CircuitClosed CircuitState = "closed"
+
+	// CircuitOpen holds routing off the model: its error rate is over MaxErrorRate and it
+	// failed within RecoveryAfter.
+	CircuitOpen CircuitState = "open"
+
+	// CircuitHalfOpen gives the model traffic again to show whether it recovered: its error
+	// rate is over MaxErrorRate but it has not failed for RecoveryAfter.
+	CircuitHalfOpen CircuitState = "half_open"
+)
+
+// ModelStats are the latency and error statistics of a model's recent calls.
+type ModelStats struct {
+	Model string `json:"model"`
+
+	// Requests is the number of calls observed.
+	Requests int `json:"requests"`
+
+	// Errors is the number of calls that failed with a transient error: rate limiting,
+	// provider unavailability or a timeout.
+	Errors int `json:"errors"`
+
+	// ErrorRate is the exponentially weighted moving average of failures, from 0 to 1.
+	ErrorRate float64 `json:"errorRate"`
+
+	// LatencyMs is the exponentially weighted moving average of successful calls' latency.
+	LatencyMs float64 `json:"latencyMs"`
+
+	// P50Ms, P95Ms and P99Ms are latency percentiles of the latest successful calls.
+	P50Ms float64 `json:"p50Ms"`
+	P95Ms float64 `json:"p95Ms"`
+	P99Ms float64 `json:"p99Ms"`
+
+	// Healthy reports whether routing should use the model.
+	Healthy bool `json:"healthy"`
+
+	// Circuit is the state of the model's circuit breaker. Only an open circuit is unhealthy.
+	Circuit CircuitState `json:"circuit"`
+
+	// PingError is the error of the latest ping of the model's provider, when it failed
+	// within RecoveryAfter; it holds the circuit open whatever the model's calls.
+	PingError string `json:"pingError,omitempty"`
+
+	LastError time.Time `json:"lastError,omitempty"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+// modelHealth is the state of one model.
+type modelHealth struct {
+	stats     ModelStats
+	latencies []float64 // ring buffer of the latest latencies
+	next      int
+}
+
+// failedPing is the latest ping of a provider, when it failed.
+type failedPing struct {
+	err string
+	at  time.Time
+}
+
+// HealthTracker keeps per-model latency and error statistics from real traffic, and the
+// failed pings of providers, which SelectModel, ModelForProfile and FallbackLLM use to prefer healthy, fast models. It is safe
+// for concurrent use.
+type HealthTracker struct {
+	opts HealthOptions
+	now  func() time.Time
+
+	mu        sync.RWMutex
+	models    map[string]*modelHealth
+	providers map[string]failedPing // provider -> its latest ping, when it failed
+}
+
+// DefaultHealthTracker is fed by the clients NewLLM creates, through Meter, and consulted by
+// the routing functions.
+var DefaultHealthTracker = NewHealthTracker(HealthOptions{})
+
+// NewHealthTracker creates a tracker with no observations.
+func NewHealthTracker(opts HealthOptions) *HealthTracker {
+	if opts.Alpha <= 0 || opts.Alpha > 1 {
+		opts.Alpha = DefaultHealthAlpha
+	}
+	if opts.Window <= 0 {
+		opts.Window = DefaultHealthWindow
+	}
+	if opts.MinSamples <= 0 {
+		opts.MinSamples = DefaultHealthMinSamples
+	}
+	if opts.MaxErrorRate <= 0 {
+		opts.MaxErrorRate = DefaultHealthMaxErrorRate
+	}
+	if opts.RecoveryAfter <= 0 {
+		opts.RecoveryAfter = DefaultHealthRecoveryAfter
+	}
+	return &HealthTracker{opts: opts, now: time.Now, models: make(map[string]*modelHealth), providers: make(map[string]failedPing)}
+}
+
+// Observe records a call to model that took latency and failed with err, or succeeded when err
+// is nil. Errors that another model would also get, such as invalid requests, count as
+// successes without a latency, since they say nothing about the model's health.
+func (h *HealthTracker) Observe(model string, latency time.Duration, err error) {
+	failed := err != nil && shouldFallback(err)
+	now := h.now()
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	m, ok := h.models[model]
+	if !ok {
+		m = &modelHealth{stats: ModelStats{Model: model}}
+		h.models[model] = m
+	}
+	m.stats.Requests++
+	m.stats.UpdatedAt = now
+
+	// Early observations are averaged so that the first call does not dominate
+	weight := max(1/float64(m.stats.Requests), h.opts.Alpha)
+	errorValue := 0.0
+	if failed {
+		errorValue = 1
+		m.stats.Errors++
+		m.stats.LastError = now
+	}
+	m.stats.ErrorRate += weight * (errorValue - m.stats.ErrorRate)
+	if err != nil {
+		return
+	}
+
+	ms := float64(latency) / float64(time.Millisecond)
+	if m.stats.LatencyMs == 0 {
+		m.stats.LatencyMs = ms
+	} else {
+		m.stats.LatencyMs += h.opts.Alpha * (ms - m.stats.LatencyMs)
+	}
+	if len(m.latencies) < h.opts.Window {
+		m.latencies = append(m.latencies, ms)
+	} else {
+		m.latencies[m.next] = ms
+		m.next = (m.next + 1) % h.opts.Window
+	}
+}
+
+// ObservePing records the result of pinging provider, as PingProvider does. A failed ping
+// opens the circuits of every model of the provider until a ping succeeds or RecoveryAfter
+// passes, so that routing avoids a provider refusing its credentials or out of reach before
+// calls fail. Providers that cannot be pinged, and pings canceled by their caller, are ignored.
+func (h *HealthTracker) ObservePing(provider string, err error) {
+	if errors.Is(err, ErrPingNotSupported) || errors.Is(err, context.Canceled) {
+		return
+	}
+	now := h.now()
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if err == nil {
+		delete(h.providers, provider)
+		return
+	}
+	h.providers[provider] = failedPing{err: err.Error(), at: now}
+}
+
+// Stats returns the statistics of model, and whether it has any.
+func (h *HealthTracker) Stats(model string) (ModelStats, bool) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	m, ok := h.models[model]
+	if !ok {
+		stats := ModelStats{Model: model, Healthy: true, Circuit: CircuitClosed}
+		h.applyPing(&stats)
+		return stats, false
+	}
+	return h.snapshot(m), true
+}
+
+// ListStats returns the statistics of every observed model, sorted by model.
+func (h *HealthTracker) ListStats() []ModelStats {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	stats := make([]ModelStats, 0, len(h.models))
+	for _, m := range h.models {
+		stats = append(stats, h.snapshot(m))
+	}
+	sort.Slice(stats, func(i, j int) bool { return stats[i].Model < stats[j].Model })
+	return stats
+}
+
+// Healthy reports whether model should be routed to: it has too few calls to tell, its error
+// rate is within MaxErrorRate, or its last error is older than RecoveryAfter.
+func (h *HealthTracker) Healthy(model string) bool {
+	stats, _ := h.Stats(model)
+	return stats.Healthy
+}
+
+// LatencyMs returns the moving average latency of model, or 0 when it has none.
+func (h *HealthTracker) LatencyMs(model string) float64 {
+	stats, _ := h.Stats(model)
+	return stats.LatencyMs
+}
+
+// Reset drops every observation.
+func (h *HealthTracker) Reset() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.models = make(map[string]*modelHealth)
+	h.providers = make(map[string]failedPing)
+}
+
+// snapshot returns the statistics of m with its percentiles and health. Callers hold mu.
+func (h *HealthTracker) snapshot(m *modelHealth) ModelStats {
+	stats := m.stats
+	switch {
+	case stats.Requests < h.opts.MinSamples || stats.ErrorRate <= h.opts.MaxErrorRate:
+		stats.Circuit = CircuitClosed
+	case h.now().Sub(stats.LastError) >= h.opts.RecoveryAfter:
+		stats.Circuit = CircuitHalfOpen
+	default:
+		stats.Circuit = CircuitOpen
+	}
+	stats.Healthy = stats.Circuit != CircuitOpen
+	h.applyPing(&stats)
+	if len(m.latencies) > 0 {
+		sorted := append([]float64(nil), m.latencies...)
+		sort.Float64s(sorted)
+		stats.P50Ms = percentile(sorted, 0.50)
+		stats.P95Ms = percentile(sorted, 0.95)
+		stats.P99Ms = percentile(sorted, 0.99)
+	}
+	return stats
+}
+
+// applyPing opens the circuit of stats when the latest ping of its model's provider failed
+// within RecoveryAfter. Callers hold mu.
+func (h *HealthTracker) applyPing(stats *ModelStats) {
+	if len(h.providers) == 0 {
+		return
+	}
+	info, err := models.Resolve(stats.Model)
+	if err != nil {
+		return
+	}
+	ping, ok := h.providers[info.Provider]
+	if !ok || h.now().Sub(ping.at) >= h.opts.RecoveryAfter {
+		return
+	}
+	stats.PingError = ping.err
+	stats.Circuit, stats.Healthy = CircuitOpen, false
+}
+
+// percentile returns the nearest-rank p-th percentile of sorted.
+func percentile(sorted []float64, p float64) float64 {
+	rank := int(math.Ceil(p*float64(len(sorted)))) - 1
+	return sorted[min(max(rank, 0), len(sorted)-1)]
+}
@@ -0,0 +1,137 @@
+package connectors
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/nexen/models"
+	"github.com/nexen/services/connectors/common"
+)
+
+func TestHealthTrackerStats(t *testing.T) {
+	h := NewHealthTracker(HealthOptions{})
+	for i := 1; i <= 100; i++ {
+		h.Observe("probe", time.Duration(i)*time.Millisecond, nil)
+	}
+
+	stats, ok := h.Stats("probe")
+	if !ok {
+		t.Fatal("Expected statistics for an observed model")
+	}
+	if stats.Requests != 100 || stats.Errors != 0 || stats.ErrorRate != 0 || !stats.Healthy {
+		t.Errorf("Unexpected stats %+v", stats)
+	}
+	if stats.P50Ms != 50 || stats.P95Ms != 95 || stats.P99Ms != 99 {
+		t.Errorf("Expected percentiles 50/95/99, got %v/%v/%v", stats.P50Ms, stats.P95Ms, stats.P99Ms)
+	}
+	if stats.LatencyMs < 80 || stats.LatencyMs > 100 {
+		t.Errorf("Expected the moving average to follow recent latencies, got %v", stats.LatencyMs)
+	}
+
+	if _, ok := h.Stats("unseen"); ok || !h.Healthy("unseen") {
+		t.Error("Expected unobserved models to be healthy without statistics")
+	}
+}
+
+func TestHealthTrackerWindow(t *testing.T) {
+	h := NewHealthTracker(HealthOptions{Window: 10})
+	for i := 0; i < 10; i++ {
+		h.Observe("probe", time.Second, nil)
+	}
+	for i := 0; i < 10; i++ {
+		h.Observe("probe", time.Millisecond, nil)
+	}
+	if stats, _ := h.Stats("probe"); stats.P99Ms != 1 {
+		t.Errorf("Expected only the latest window in the percentiles, got p99 %v", stats.P99Ms)
+	}
+}
+
+func TestHealthTrackerUnhealthyAndRecovery(t *testing.T) {
+	now := time.Now()
+	h := NewHealthTracker(HealthOptions{MinSamples: 5, RecoveryAfter: time.Minute})
+	h.now = func() time.Time { return now }
+
+	overloaded := common.NewProviderError(models.ProviderAnthropic, 529, "overloaded_error", "overloaded")
+	for i := 0; i < 4; i++ {
+		h.Observe("probe", time.Second, overloaded)
+	}
+	if !h.Healthy("probe") {
+		t.Error("Expected a model with fewer than MinSamples calls to be healthy")
+	}
+	h.Observe("probe", time.Second, overloaded)
+	if stats, _ := h.Stats("probe"); stats.Healthy || stats.Circuit != CircuitOpen {
+		t.Errorf("Expected a model failing every call to be unhealthy with an open circuit, got %+v", stats)
+	}
+	if stats, _ := h.Stats("probe"); stats.Errors != 5 || stats.LatencyMs != 0 {
+		t.Errorf("Expected failures to count without a latency, got %+v", stats)
+	}
+
+	now = now.Add(time.Minute)
+	if stats, _ := h.Stats("probe"); !stats.Healthy || stats.Circuit != CircuitHalfOpen {
+		t.Errorf("Expected the model to be given traffic again after RecoveryAfter with a half-open circuit, got %+v", stats)
+	}
+}
+
+func TestHealthTrackerIgnoresPermanentErrors(t *testing.T) {
+	h := NewHealthTracker(HealthOptions{MinSamples: 1})
+	invalid := common.NewProviderError(models.ProviderOpenAI, 400, "invalid_request_error", "bad request")
+	for i := 0; i < 20; i++ {
+		h.Observe("probe", time.Second, invalid)
+	}
+	h.Observe("probe", time.Second, errors.New("boom"))
+	if stats, _ := h.Stats("probe"); stats.Errors != 0 || !stats.Healthy {
+		t.Errorf("Expected errors another model would share not to count, got %+v", stats)
+	}
+}
+
+func TestHealthTrackerPing(t *testing.T) {
+	for _, id := range []string{"pingtrack-a", "pingtrack-b"} {
+		if err := models.Register("^"+id+"$", models.ModelInfo{ID: id, Provider: "pingtrack"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	now := time.Now()
+	h := NewHealthTracker(HealthOptions{RecoveryAfter: time.Minute})
+	h.now = func() time.Time { return now }
+	h.Observe("pingtrack-a", time.Millisecond, nil)
+
+	h.ObservePing("pingtrack", errors.New("401 invalid x-api-key"))
+	if stats, _ := h.Stats("pingtrack-a"); stats.Healthy || stats.Circuit != CircuitOpen || stats.PingError != "401 invalid x-api-key" {
+		t.Errorf("Expected a failed ping to open the circuit, got %+v", stats)
+	}
+	if h.Healthy("pingtrack-b") {
+		t.Error("Expected a failed ping to hold off the provider's models without calls")
+	}
+
+	h.ObservePing("pingtrack", ErrPingNotSupported)
+	h.ObservePing("pingtrack", context.Canceled)
+	if h.Healthy("pingtrack-b") {
+		t.Error("Expected pings that say nothing about the provider to be ignored")
+	}
+	h.ObservePing("pingtrack", nil)
+	if stats, _ := h.Stats("pingtrack-a"); !stats.Healthy || stats.PingError != "" {
+		t.Errorf("Expected a successful ping to close the circuit, got %+v", stats)
+	}
+
+	h.ObservePing("pingtrack", errors.New("connection refused"))
+	now = now.Add(time.Minute)
+	if !h.Healthy("pingtrack-a") {
+		t.Error("Expected a failed ping to expire after RecoveryAfter")
+	}
+}
+
+func TestHealthTrackerListStats(t *testing.T) {
+	h := NewHealthTracker(HealthOptions{})
+	h.Observe("b", time.Millisecond, nil)
+	h.Observe("a", time.Millisecond, nil)
+	stats := h.ListStats()
+	if len(stats) != 2 || stats[0].Model != "a" || stats[1].Model != "b" {
+		t.Errorf("Expected the models sorted by name, got %+v", stats)
+	}
+	h.Reset()
+	if len(h.ListStats()) != 0 {
+		t.Error("Expected Reset to drop every observation")
+	}
+}
@@ -0,0 +1,147 @@
+// Package hedge sends slow requests to a backup model as well.
+//
+// A hedged call sends the request to the primary model and, if no answer has arrived after a
+// delay, to the backup model too. The first successful response is returned and the other
+// call is canceled, which trims the latency tail when a provider is slow. A failed primary
+// call starts the backup immediately.
+package hedge
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/nexen/models"
+	"github.com/nexen/services/connectors/common"
+)
+
+// MetadataHedged is the CustomMetadata key set to true on responses whose call also went to
+// the backup model. The model that answered is under common.MetadataServedBy.
+const MetadataHedged = "hedged"
+
+// Policy configures the backup model and when it is called.
+type Policy struct {
+	// Backup is the client for the backup model.
+	Backup common.LLM
+
+	// BackupModel is the model ID sent to Backup. When empty, the request's model is kept.
+	BackupModel string
+
+	// Delay is how long to wait for the primary before also calling the backup. Set it
+	// around the primary's p95 latency so only the slow tail is hedged.
+	Delay time.Duration
+}
+
+// hedgingLLM applies a Policy to every call.
+type hedgingLLM struct {
+	common.LLM
+	policy Policy
+}
+
+// New returns an LLM that hedges calls to llm with the policy's backup model.
+func New(llm common.LLM, policy Policy) (common.LLM, error) {
+	if policy.Backup == nil {
+		return nil, fmt.Errorf("hedge policy requires a backup model")
+	}
+	if policy.Delay < 0 {
+		return nil, fmt.Errorf("hedge delay must not be negative")
+	}
+	return &hedgingLLM{LLM: llm, policy: policy}, nil
+}
+
+// attempt is the outcome of a call to the primary or backup model.
+type attempt struct {
+	response *models.LLMResponse
+	err      error
+	model    string
+	primary  bool
+}
+
+func (a attempt) ok() bool {
+	return a.err == nil && a.response != nil && !a.response.IsError()
+}
+
+// Call implements the LLM interface Call method. When both models fail, the primary's
+// result is returned.
+func (h *hedgingLLM) Call(ctx context.Context, request *models.LLMRequest) (*models.LLMResponse, error) {
+	primaryCtx, cancelPrimary := context.WithCancel(ctx)
+	defer cancelPrimary()
+	backupCtx, cancelBackup := context.WithCancel(ctx)
+	defer cancelBackup()
+
+	// Buffered so the losing call can finish after Call returns
+	results := make(chan attempt, 2)
+	go func() {
+		response, err := h.LLM.Call(primaryCtx, request)
+		results <- attempt{response, err, request.Model, true}
+	}()
+
+	backupRequest := *request
+	if h.policy.BackupModel != "" {
+		backupRequest.Model = h.policy.BackupModel
+	}
+	hedged := false
+	startBackup := func() {
+		hedged = true
+		go func() {
+			response, err := h.policy.Backup.Call(backupCtx, &backupRequest)
+			results <- attempt{response, err, backupRequest.Model, false}
+		}()
+	}
+
+	timer := time.NewTimer(h.policy.Delay)
+	defer timer.Stop()
+
+	pending := 1
+	var failures []attempt
+	for {
+		select {
+		case <-timer.C:
+			if !hedged {
+				startBackup()
+				pending++
+			}
+		case a := <-results:
+			pending--
+			if a.ok() {
+				setMetadata(a.response, MetadataHedged, hedged)
+				setMetadata(a.response, common.MetadataServedBy, a.model)
+				return a.response, nil
+			}
+			failures = append(failures, a)
+			if !hedged {
+				startBackup()
+				pending++
+				continue
+			}
+			if pending == 0 {
+				return primaryResult(failures)
+			}
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// BatchCall implements the LLM interface BatchCall method.
+func (h *hedgingLLM) BatchCall(ctx context.Context, requests []*models.LLMRequest) ([]*models.LLMResponse, error) {
+	return common.BatchCall(ctx, requests, common.DefaultBatchConcurrency, h.Call)
+}
+
+// primaryResult returns the primary model's failed attempt.
+func primaryResult(failures []attempt) (*models.LLMResponse, error) {
+	for _, a := range failures {
+		if a.primary {
+			return a.response, a.err
+		}
+	}
+	return failures[0].response, failures[0].err
+}
+
+// setMetadata records a value in the response's CustomMetadata.
+func setMetadata(response *models.LLMResponse, key string, value any) {
+	if response.CustomMetadata == nil {
+		response.CustomMetadata = make(map[string]any)
+	}
+	response.CustomMetadata[key] = value
+}
@@ -0,0 +1,115 @@
+package hedge
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/nexen/models"
+	"github.com/nexen/services/connectors/common"
+)
+
+// delayedLLM answers after a delay, or fails with err, and records whether it was canceled.
+type delayedLLM struct {
+	delay    time.Duration
+	err      error
+	calls    atomic.Int32
+	canceled atomic.Bool
+	model    atomic.Value
+}
+
+func (d *delayedLLM) Call(ctx context.Context, request *models.LLMRequest) (*models.LLMResponse, error) {
+	d.calls.Add(1)
+	d.model.Store(request.Model)
+	select {
+	case <-time.After(d.delay):
+	case <-ctx.Done():
+		d.canceled.Store(true)
+		return nil, ctx.Err()
+	}
+	if d.err != nil {
+		return nil, d.err
+	}
+	return &models.LLMResponse{Content: &models.Content{Role: "assistant", Message: request.Model}}, nil
+}
+
+func (d *delayedLLM) BatchCall(ctx context.Context, requests []*models.LLMRequest) ([]*models.LLMResponse, error) {
+	return nil, nil
+}
+
+func (d *delayedLLM) SupportedModels() []string {
+	return []string{"delayed"}
+}
+
+func newRequest() *models.LLMRequest {
+	return &models.LLMRequest{Model: "primary", Contents: []models.Content{{Role: "user", Message: "Hi"}}}
+}
+
+func TestSlowPrimaryIsHedged(t *testing.T) {
+	primary := &delayedLLM{delay: time.Second}
+	backup := &delayedLLM{}
+	llm, err := New(primary, Policy{Backup: backup, BackupModel: "backup", Delay: 10 * time.Millisecond})
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+
+	start := time.Now()
+	response, err := llm.Call(context.Background(), newRequest())
+	if err != nil {
+		t.Fatalf("Call failed: %v", err)
+	}
+	if time.Since(start) > 500*time.Millisecond {
+		t.Error("Expected the backup's answer without waiting for the primary")
+	}
+	if response.Content.Message != "backup" || response.CustomMetadata[common.MetadataServedBy] != "backup" || response.CustomMetadata[MetadataHedged] != true {
+		t.Errorf("Unexpected response %+v", response)
+	}
+
+	// The losing call is canceled
+	time.Sleep(10 * time.Millisecond)
+	if !primary.canceled.Load() {
+		t.Error("Expected the primary call to be canceled")
+	}
+}
+
+func TestFastPrimaryIsNotHedged(t *testing.T) {
+	primary := &delayedLLM{}
+	backup := &delayedLLM{}
+	llm, _ := New(primary, Policy{Backup: backup, Delay: time.Second})
+
+	response, err := llm.Call(context.Background(), newRequest())
+	if err != nil {
+		t.Fatalf("Call failed: %v", err)
+	}
+	if backup.calls.Load() != 0 || response.CustomMetadata[MetadataHedged] != false {
+		t.Errorf("Expected no backup call, got %d", backup.calls.Load())
+	}
+}
+
+func TestFailedPrimaryStartsBackupImmediately(t *testing.T) {
+	failure := errors.New("overloaded")
+	primary := &delayedLLM{err: failure}
+	backup := &delayedLLM{}
+	llm, _ := New(primary, Policy{Backup: backup, Delay: time.Hour})
+
+	response, err := llm.Call(context.Background(), newRequest())
+	if err != nil || response.CustomMetadata[common.MetadataServedBy] != "primary" || backup.calls.Load() != 1 {
+		t.Fatalf("Expected the backup to answer with the request's model, got %v, %v", response, err)
+	}
+
+	backup.err = errors.New("also down")
+	if _, err := llm.Call(context.Background(), newRequest()); !errors.Is(err, failure) {
+		t.Errorf("Expected the primary's error when both fail, got %v", err)
+	}
+}
+
+func TestNewValidatesPolicy(t *testing.T) {
+	if _, err := New(&delayedLLM{}, Policy{}); err == nil {
+		t.Error("Expected an error without a backup")
+	}
+	if _, err := New(&delayedLLM{}, Policy{Backup: &delayedLLM{}, Delay: -time.Second}); err == nil {
+		t.Error("Expected an error for a negative delay")
+	}
+}
@@ -28,6 +28,13 @@ type LlamaClient struct {
 	// client *llama.Client
 }
 
+// The interfaces LlamaClient implements, checked at compile time.
+var (
+	_ common.LLM        = (*LlamaClient)(nil)
+	_ common.ModelNamer = (*LlamaClient)(nil)
+	_ common.Pinger     = (*LlamaClient)(nil)
+)
+
 // init registers this adapter with the connectors registry.
 func init() {
 	for _, pattern := range supportedModelPatterns {
@@ -101,30 +108,23 @@ func (c *LlamaClient) Call(ctx context.Context, request *models.LLMRequest) (*mo
 	}, nil
 }
 
+// Ping implements common.Pinger.
+func (c *LlamaClient) Ping(ctx context.Context) error {
+	// In a real implementation, we would query the models of the local server, which fails when it is not running
+	return ctx.Err()
+}
+
 // BatchCall implements the LLM interface BatchCall method.
 func (c *LlamaClient) BatchCall(ctx context.Context, requests []*models.LLMRequest) ([]*models.LLMResponse, error) {
-	responses := make([]*models.LLMResponse, len(requests))
-	var err error
-
-	// Process each request sequentially
-	// Local models typically can't handle many parallel requests
-	for i, req := range requests {
-		responses[i], err = c.Call(ctx, req)
-		if err != nil {
-			return responses, fmt.Errorf("error processing request %d: %w", i, err)
-		}
-	}
+	return common.BatchCall(ctx, requests, c.config.BatchConcurrency, c.Call)
+}
 
-	return responses, nil
+// Model returns the model name this client was created for.
+func (c *LlamaClient) Model() string {
+	return c.modelName
 }
 
-// SupportedModels returns a list of model names supported by this client.
+// SupportedModels returns the IDs of the provider's models in the registry.
 func (c *LlamaClient) SupportedModels() []string {
-	// In a real implementation, we might query the local server
-	// to see what models are available
-	return []string{
-		"llama-7b",
-		"llama-13b",
-		"llama-70b",
-	}
+	return common.RegisteredModels(models.ProviderLlama)
 }
@@ -0,0 +1,121 @@
+// Package maxtokens sets MaxTokens on requests that leave it unset.
+//
+// Without MaxTokens, some providers cap the answer at a small default that truncates it, and
+// others let it run to the end of the context window. Wrap derives a limit that fits: the
+// model's registered context window less the prompt, counted with contextwindow.PromptTokens,
+// and a safety margin, capped at an output budget and at the model's MaxOutputTokens.
+//
+//	llm = common.Chain(llm, maxtokens.Middleware(maxtokens.Options{OutputBudget: cfg.Gateway.OutputBudget}))
+package maxtokens
+
+import (
+	"context"
+
+	"github.com/nexen/models"
+	"github.com/nexen/services/connectors/common"
+	"github.com/nexen/services/connectors/contextwindow"
+)
+
+// MetadataKey is the CustomMetadata key holding the MaxTokens derived for a request.
+const MetadataKey = "derived_max_tokens"
+
+const (
+	// DefaultOutputBudget caps derived limits when Options.OutputBudget is zero.
+	DefaultOutputBudget = 4096
+
+	// DefaultMargin is the room kept in the window for counting errors when Options.Margin is
+	// zero.
+	DefaultMargin = 64
+)
+
+// Options configures Wrap. The zero value uses the defaults.
+type Options struct {
+	// OutputBudget is the most tokens a derived MaxTokens allows. Zero means
+	// DefaultOutputBudget.
+	OutputBudget int
+
+	// Margin is kept free in the context window, since prompt counts of models without an
+	// exact tokenizer are estimates. Zero means DefaultMargin.
+	Margin int
+}
+
+// shapedLLM derives MaxTokens before passing requests to the wrapped LLM.
+type shapedLLM struct {
+	common.LLM
+	budget, margin int
+}
+
+// Wrap returns an LLM that sets MaxTokens on requests without one. Requests for models
+// without a registered context window are sent with the output budget, or the model's
+// output limit when smaller. Requests whose prompt
+// leaves no room are sent unchanged, for the provider or contextwindow.Wrap to reject.
+func Wrap(llm common.LLM, opts Options) common.LLM {
+	s := &shapedLLM{LLM: llm, budget: opts.OutputBudget, margin: opts.Margin}
+	if s.budget <= 0 {
+		s.budget = DefaultOutputBudget
+	}
+	if s.margin <= 0 {
+		s.margin = DefaultMargin
+	}
+	return s
+}
+
+// Middleware returns a common.Middleware that wraps clients with Wrap.
+func Middleware(opts Options) common.Middleware {
+	return func(next common.LLM) common.LLM { return Wrap(next, opts) }
+}
+
+// Call implements the LLM interface Call method. The derived limit is stored in the
+// response's CustomMetadata under MetadataKey.
+func (s *shapedLLM) Call(ctx context.Context, request *models.LLMRequest) (*models.LLMResponse, error) {
+	if request.Config != nil && request.Config.MaxTokens > 0 {
+		return s.LLM.Call(ctx, request)
+	}
+	model := request.Model
+	if namer, ok := s.LLM.(common.ModelNamer); ok && model == "" {
+		model = namer.Model()
+	}
+	limit := s.limit(model, request)
+	if limit <= 0 {
+		return s.LLM.Call(ctx, request)
+	}
+
+	shaped := *request
+	config := models.GenerateContentConfig{}
+	if request.Config != nil {
+		config = *request.Config
+	}
+	config.MaxTokens = limit
+	shaped.Config = &config
+
+	response, err := s.LLM.Call(ctx, &shaped)
+	if response != nil {
+		if response.CustomMetadata == nil {
+			response.CustomMetadata = make(map[string]any)
+		}
+		response.CustomMetadata[MetadataKey] = limit
+	}
+	return response, err
+}
+
+// BatchCall implements the LLM interface BatchCall method.
+func (s *shapedLLM) BatchCall(ctx context.Context, requests []*models.LLMRequest) ([]*models.LLMResponse, error) {
+	return common.BatchCall(ctx, requests, common.DefaultBatchConcurrency, s.Call)
+}
+
+// limit returns the MaxTokens for request on model, or 0 when the prompt leaves no room.
+func (s *shapedLLM) limit(model string, request *models.LLMRequest) int {
+	info, err := models.Resolve(model)
+	if err != nil {
+		return s.budget
+	}
+	budget := s.budget
+	if info.MaxOutputTokens > 0 {
+		budget = min(budget, info.MaxOutputTokens)
+	}
+	if info.ContextWindow <= 0 {
+		return budget
+	}
+	room := info.ContextWindow - contextwindow.PromptTokens(model, request) - s.margin
+	return max(min(room, budget), 0)
+}
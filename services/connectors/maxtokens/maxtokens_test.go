@@ -0,0 +1,75 @@
+package maxtokens
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/nexen/models"
+	"github.com/nexen/services/connectors/common"
+	"github.com/nexen/services/connectors/contextwindow"
+)
+
+// recordingLLM records the last request it was sent.
+type recordingLLM struct {
+	request *models.LLMRequest
+}
+
+func (r *recordingLLM) Call(ctx context.Context, request *models.LLMRequest) (*models.LLMResponse, error) {
+	r.request = request
+	return &models.LLMResponse{Content: &models.Content{Role: "assistant", Message: "ok"}}, nil
+}
+
+func (r *recordingLLM) BatchCall(ctx context.Context, requests []*models.LLMRequest) ([]*models.LLMResponse, error) {
+	return common.BatchCall(ctx, requests, 1, r.Call)
+}
+
+func (r *recordingLLM) SupportedModels() []string { return []string{"shapeprobe-small"} }
+
+func TestWrap(t *testing.T) {
+	if err := models.Register("^shapeprobe-small$", models.ModelInfo{Provider: "shapeprobe", MaxTokens: 1000}); err != nil {
+		t.Fatal(err)
+	}
+	if err := models.Register("^shapeprobe-capped$", models.ModelInfo{Provider: "shapeprobe", ContextWindow: 1000, MaxOutputTokens: 100}); err != nil {
+		t.Fatal(err)
+	}
+	short := []models.Content{{Role: "user", Message: "Hello"}}
+	long := []models.Content{{Role: "user", Message: strings.Repeat("word ", 700)}}
+	longPrompt := contextwindow.PromptTokens("shapeprobe-small", &models.LLMRequest{Contents: long})
+
+	testCases := []struct {
+		name    string
+		model   string
+		request *models.LLMRequest
+		want    int
+	}{
+		{"budget caps the window", "shapeprobe-small", &models.LLMRequest{Contents: short}, 200},
+		{"window less prompt and margin", "shapeprobe-small", &models.LLMRequest{Contents: long}, 1000 - longPrompt - 10},
+		{"output limit caps the budget", "shapeprobe-capped", &models.LLMRequest{Contents: short}, 100},
+		{"caller's limit kept", "shapeprobe-small", &models.LLMRequest{Contents: short, Config: &models.GenerateContentConfig{MaxTokens: 50}}, 50},
+		{"unregistered model", "shapeprobe-unknown", &models.LLMRequest{Contents: short}, 200},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			llm := &recordingLLM{}
+			tc.request.Model = tc.model
+			response, err := Wrap(llm, Options{OutputBudget: 200, Margin: 10}).Call(context.Background(), tc.request)
+			if err != nil {
+				t.Fatalf("Call() error = %v", err)
+			}
+			if got := llm.request.Config.MaxTokens; got != tc.want {
+				t.Errorf("MaxTokens = %d, want %d", got, tc.want)
+			}
+			if tc.request.Config == nil && response.CustomMetadata[MetadataKey] != tc.want {
+				t.Errorf("Expected the derived limit in CustomMetadata, got %v", response.CustomMetadata)
+			}
+		})
+	}
+
+	// A prompt that fills the window is left for the provider to reject
+	llm := &recordingLLM{}
+	full := &models.LLMRequest{Model: "shapeprobe-small", Contents: []models.Content{{Role: "user", Message: strings.Repeat("word ", 2000)}}}
+	if _, err := Wrap(llm, Options{}).Call(context.Background(), full); err != nil || llm.request.Config != nil {
+		t.Errorf("Expected the request unchanged, got %+v, %v", llm.request.Config, err)
+	}
+}
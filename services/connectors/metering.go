@@ -0,0 +1,118 @@
+package connectors
+
+import (
+	"context"
+	"time"
+
+	"github.com/nexen/models"
+	"github.com/nexen/services/connectors/common"
+)
+
+// Meter returns a Middleware that fills in UsageMetrics.LatencyMs and CostCents when the
+// provider left them zero. Latency is the total time of the call's last HTTP round trip when
+// the connector measures it with common.MeasureRoundTrip, whose breakdown is stored in the
+// response's CustomMetadata under common.MetadataHTTPTimings, and otherwise the wall-clock
+// time of the call. Cost is the response's usage priced by models.EstimateCost for the
+// request's model, or for model when the request does not name one, scaled for the service
+// tier the provider reports under common.MetadataServiceTier; the difference the tier makes is
+// stored under common.MetadataServiceTierCostDelta. It also records the request's Metadata in the response so
+// that usage can be attributed to tenants and users, and feeds each call's latency and outcome
+// to DefaultHealthTracker. NewLLM applies it to every client.
+func Meter(model string) Middleware {
+	return func(next LLM) LLM {
+		return &meteredLLM{LLM: next, model: model}
+	}
+}
+
+// meteredLLM fills in latency and cost of the wrapped LLM's responses.
+type meteredLLM struct {
+	LLM
+	model string
+}
+
+// Model implements common.ModelNamer.
+func (m *meteredLLM) Model() string {
+	return m.model
+}
+
+// Call implements the LLM interface Call method.
+func (m *meteredLLM) Call(ctx context.Context, request *models.LLMRequest) (*models.LLMResponse, error) {
+	ctx, timings := common.WithRoundTripTimings(ctx)
+	start := time.Now()
+	response, err := m.LLM.Call(ctx, request)
+	if response != nil {
+		elapsed := time.Since(start)
+		if t, ok := timings(); ok {
+			if response.CustomMetadata == nil {
+				response.CustomMetadata = make(map[string]any)
+			}
+			response.CustomMetadata[common.MetadataHTTPTimings] = t
+			elapsed = time.Duration(t.TotalMs * float64(time.Millisecond))
+		}
+		m.meter(request, response, elapsed)
+		DefaultHealthTracker.Observe(m.model, elapsed, err)
+	} else if err != nil {
+		DefaultHealthTracker.Observe(m.model, time.Since(start), err)
+	}
+	return response, err
+}
+
+// CallStream implements common.Streamer, metering the final response like that of Call. LLMs
+// that cannot stream are called with Call, as by common.CallStream.
+func (m *meteredLLM) CallStream(ctx context.Context, request *models.LLMRequest, yield func(*models.LLMResponse) error) error {
+	start := time.Now()
+	var yieldErr error
+	err := common.CallStream(ctx, m.LLM, request, func(response *models.LLMResponse) error {
+		if !response.IsPartial() {
+			elapsed := time.Since(start)
+			m.meter(request, response, elapsed)
+			DefaultHealthTracker.Observe(m.model, elapsed, nil)
+		}
+		yieldErr = yield(response)
+		return yieldErr
+	})
+	// The caller's own failures say nothing about the model's health
+	if err != nil && err != yieldErr {
+		DefaultHealthTracker.Observe(m.model, time.Since(start), err)
+	}
+	return err
+}
+
+// BatchCall implements the LLM interface BatchCall method. Responses without a latency of
+// their own are given the duration of the whole batch.
+func (m *meteredLLM) BatchCall(ctx context.Context, requests []*models.LLMRequest) ([]*models.LLMResponse, error) {
+	start := time.Now()
+	responses, err := m.LLM.BatchCall(ctx, requests)
+	elapsed := time.Since(start)
+	for i, response := range responses {
+		if response != nil && i < len(requests) {
+			m.meter(requests[i], response, elapsed)
+		}
+	}
+	return responses, err
+}
+
+// meter sets the response's latency and cost where they are zero, and its request metadata.
+func (m *meteredLLM) meter(request *models.LLMRequest, response *models.LLMResponse, elapsed time.Duration) {
+	if request != nil {
+		response.SetRequestMetadata(request.Metadata)
+	}
+	if response.Usage.LatencyMs == 0 {
+		response.Usage.LatencyMs = float64(elapsed.Milliseconds())
+	}
+	if response.Usage.CostCents == 0 && response.Usage.TotalTokens > 0 {
+		model := m.model
+		if request != nil && request.Model != "" {
+			model = request.Model
+		}
+		if cost, err := models.EstimateCost(model, response.Usage); err == nil {
+			response.Usage.CostCents = cost
+			if tier, ok := response.CustomMetadata[common.MetadataServiceTier].(string); ok && tier != "" {
+				if tiered, err := models.EstimateTierCost(model, response.Usage, tier); err == nil && tiered != cost {
+					response.Usage.CostCents = tiered
+					response.CustomMetadata[common.MetadataServiceTierCostDelta] = tiered - cost
+				}
+			}
+		}
+	}
+}
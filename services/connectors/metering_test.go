@@ -0,0 +1,220 @@
+package connectors
+
+import (
+	"context"
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/nexen/models"
+	"github.com/nexen/services/connectors/common"
+)
+
+// usageLLM replies after a delay with fixed usage.
+type usageLLM struct {
+	mockLLM
+	usage models.UsageMetrics
+}
+
+func (u *usageLLM) Call(ctx context.Context, request *models.LLMRequest) (*models.LLMResponse, error) {
+	time.Sleep(5 * time.Millisecond)
+	return &models.LLMResponse{Usage: u.usage}, nil
+}
+
+func (u *usageLLM) BatchCall(ctx context.Context, requests []*models.LLMRequest) ([]*models.LLMResponse, error) {
+	responses := make([]*models.LLMResponse, len(requests))
+	for i := range requests {
+		responses[i], _ = u.Call(ctx, requests[i])
+	}
+	return responses, nil
+}
+
+func TestMeter(t *testing.T) {
+	if err := models.Register("^meterprobe-.*", models.ModelInfo{Provider: "meterprobe", CostPerToken: 0.001}); err != nil {
+		t.Fatalf("models.Register failed: %v", err)
+	}
+	if err := models.Register("^meterprobe2-.*", models.ModelInfo{Provider: "meterprobe", CostPerToken: 0.002}); err != nil {
+		t.Fatalf("models.Register failed: %v", err)
+	}
+
+	llm := Meter("meterprobe-small")(&usageLLM{usage: models.UsageMetrics{TotalTokens: 100}})
+	response, err := llm.Call(context.Background(), &models.LLMRequest{})
+	if err != nil {
+		t.Fatalf("Call failed: %v", err)
+	}
+	if response.Usage.LatencyMs < 5 {
+		t.Errorf("Expected latency of at least 5ms, got %v", response.Usage.LatencyMs)
+	}
+	if math.Abs(response.Usage.CostCents-0.1) > 1e-9 {
+		t.Errorf("Expected cost 0.1 cents, got %v", response.Usage.CostCents)
+	}
+
+	// The request's model takes precedence over the client's
+	responses, err := llm.BatchCall(context.Background(), []*models.LLMRequest{{Model: "meterprobe2-large"}, {}})
+	if err != nil {
+		t.Fatalf("BatchCall failed: %v", err)
+	}
+	if math.Abs(responses[0].Usage.CostCents-0.2) > 1e-9 || math.Abs(responses[1].Usage.CostCents-0.1) > 1e-9 {
+		t.Errorf("Unexpected batch costs %v and %v", responses[0].Usage.CostCents, responses[1].Usage.CostCents)
+	}
+
+	// Values reported by the provider are kept
+	reported := Meter("meterprobe-small")(&usageLLM{usage: models.UsageMetrics{TotalTokens: 100, LatencyMs: 42, CostCents: 0.05}})
+	response, _ = reported.Call(context.Background(), &models.LLMRequest{})
+	if response.Usage.LatencyMs != 42 || response.Usage.CostCents != 0.05 {
+		t.Errorf("Expected provider usage to be kept, got %+v", response.Usage)
+	}
+
+	// The request's metadata is recorded for attribution
+	metadata := models.RequestMetadata{TenantID: "acme", UserID: "u-1"}
+	response, _ = llm.Call(context.Background(), &models.LLMRequest{Metadata: metadata})
+	if got, ok := response.RequestMetadata(); !ok || got.TenantID != "acme" || got.UserID != "u-1" {
+		t.Errorf("Expected request metadata in the response, got %v", response.CustomMetadata)
+	}
+
+	// Unknown models are not priced
+	unknown := Meter("unpriced-model")(&usageLLM{usage: models.UsageMetrics{TotalTokens: 100}})
+	response, _ = unknown.Call(context.Background(), &models.LLMRequest{})
+	if response.Usage.CostCents != 0 {
+		t.Errorf("Expected no cost for an unknown model, got %v", response.Usage.CostCents)
+	}
+}
+
+// streamingUsageLLM streams two words, then its final response with fixed usage.
+type streamingUsageLLM struct {
+	usageLLM
+}
+
+func (s *streamingUsageLLM) CallStream(ctx context.Context, request *models.LLMRequest, yield func(*models.LLMResponse) error) error {
+	partial := true
+	for _, word := range []string{"Hello ", "there"} {
+		if err := yield(&models.LLMResponse{Partial: &partial, Content: &models.Content{Message: word}}); err != nil {
+			return err
+		}
+	}
+	time.Sleep(5 * time.Millisecond)
+	return yield(&models.LLMResponse{Content: &models.Content{Message: "Hello there"}, Usage: s.usage})
+}
+
+func TestMeterStream(t *testing.T) {
+	if err := models.Register("^meterstream-.*", models.ModelInfo{Provider: "meterprobe", CostPerToken: 0.001}); err != nil {
+		t.Fatalf("models.Register failed: %v", err)
+	}
+	usage := models.UsageMetrics{TotalTokens: 100}
+	for name, llm := range map[string]LLM{
+		"streamer": &streamingUsageLLM{usageLLM{usage: usage}},
+		"call":     &usageLLM{usage: usage},
+	} {
+		var responses []*models.LLMResponse
+		err := common.CallStream(context.Background(), Meter("meterstream-small")(llm), &models.LLMRequest{}, func(response *models.LLMResponse) error {
+			responses = append(responses, response)
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("%s: CallStream failed: %v", name, err)
+		}
+		final := responses[len(responses)-1]
+		if math.Abs(final.Usage.CostCents-0.1) > 1e-9 || final.Usage.LatencyMs == 0 {
+			t.Errorf("%s: expected the final response to be metered, got %+v", name, final.Usage)
+		}
+		for _, partial := range responses[:len(responses)-1] {
+			if partial.Usage.CostCents != 0 {
+				t.Errorf("%s: expected partial responses to be passed through, got %+v", name, partial.Usage)
+			}
+		}
+	}
+}
+
+// httpLLM calls a server through common.TimingTransport, which answers after a delay.
+type httpLLM struct {
+	mockLLM
+	client *http.Client
+	url    string
+}
+
+func (h *httpLLM) Call(ctx context.Context, request *models.LLMRequest) (*models.LLMResponse, error) {
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, h.url, nil)
+	resp, err := h.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	io.ReadAll(resp.Body)
+	// Work after the round trip is not counted as latency
+	time.Sleep(20 * time.Millisecond)
+	return &models.LLMResponse{}, nil
+}
+
+func TestMeterRoundTrips(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(5 * time.Millisecond)
+		w.Write([]byte("{}"))
+	}))
+	defer server.Close()
+
+	var observed []common.HTTPTimings
+	common.SetRoundTripObserver(func(provider string, timings common.HTTPTimings) {
+		if provider == "probe" {
+			observed = append(observed, timings)
+		}
+	})
+	defer common.SetRoundTripObserver(nil)
+
+	llm := Meter("meterprobe-small")(&httpLLM{client: &http.Client{Transport: common.TimingTransport("probe", nil)}, url: server.URL})
+	response, err := llm.Call(context.Background(), &models.LLMRequest{})
+	if err != nil {
+		t.Fatalf("Call failed: %v", err)
+	}
+	timings, ok := response.CustomMetadata[common.MetadataHTTPTimings].(common.HTTPTimings)
+	if !ok || timings.Attempts != 1 || timings.TTFBMs < 5 || timings.TotalMs < timings.TTFBMs || timings.ConnectMs <= 0 {
+		t.Fatalf("Unexpected timings %+v", response.CustomMetadata)
+	}
+	if math.Abs(response.Usage.LatencyMs-timings.TotalMs) >= 1 || response.Usage.LatencyMs >= 20 {
+		t.Errorf("Expected the round trip's %vms as latency, got %v", timings.TotalMs, response.Usage.LatencyMs)
+	}
+	if len(observed) != 1 || observed[0].TotalMs != timings.TotalMs {
+		t.Errorf("Expected the observer to see the round trip, got %+v", observed)
+	}
+}
+
+// tierLLM replies with fixed usage served in a service tier.
+type tierLLM struct {
+	usageLLM
+	tier string
+}
+
+func (l *tierLLM) Call(ctx context.Context, request *models.LLMRequest) (*models.LLMResponse, error) {
+	return &models.LLMResponse{Usage: l.usage, CustomMetadata: map[string]any{common.MetadataServiceTier: l.tier}}, nil
+}
+
+func TestMeterServiceTier(t *testing.T) {
+	if err := models.Register("^tierprobe-.*", models.ModelInfo{Provider: "tierprobe", CostPerToken: 0.001}); err != nil {
+		t.Fatalf("models.Register failed: %v", err)
+	}
+
+	testCases := []struct {
+		tier        string
+		cost, delta float64
+	}{
+		{models.ServiceTierPriority, 0.175, 0.075},
+		{models.ServiceTierFlex, 0.05, -0.05},
+		{models.ServiceTierDefault, 0.1, 0},
+	}
+	for _, tc := range testCases {
+		llm := Meter("tierprobe-small")(&tierLLM{usageLLM: usageLLM{usage: models.UsageMetrics{TotalTokens: 100}}, tier: tc.tier})
+		response, err := llm.Call(context.Background(), &models.LLMRequest{})
+		if err != nil {
+			t.Fatalf("Call failed: %v", err)
+		}
+		if math.Abs(response.Usage.CostCents-tc.cost) > 1e-9 {
+			t.Errorf("%s: expected cost %v cents, got %v", tc.tier, tc.cost, response.Usage.CostCents)
+		}
+		delta, _ := response.CustomMetadata[common.MetadataServiceTierCostDelta].(float64)
+		if math.Abs(delta-tc.delta) > 1e-9 {
+			t.Errorf("%s: expected cost delta %v cents, got %v", tc.tier, tc.delta, delta)
+		}
+	}
+}
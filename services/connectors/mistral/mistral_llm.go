@@ -28,6 +28,13 @@ type MistralClient struct {
 	// client *mistral.Client
 }
 
+// The interfaces MistralClient implements, checked at compile time.
+var (
+	_ common.LLM        = (*MistralClient)(nil)
+	_ common.ModelNamer = (*MistralClient)(nil)
+	_ common.Pinger     = (*MistralClient)(nil)
+)
+
 // init registers this adapter with the connectors registry.
 func init() {
 	for _, pattern := range supportedModelPatterns {
@@ -100,30 +107,23 @@ func (c *MistralClient) Call(ctx context.Context, request *models.LLMRequest) (*
 	}, nil
 }
 
+// Ping implements common.Pinger.
+func (c *MistralClient) Ping(ctx context.Context) error {
+	// In a real implementation, we would list the models of Mistral's API, which refuses an invalid API key
+	return ctx.Err()
+}
+
 // BatchCall implements the LLM interface BatchCall method.
 func (c *MistralClient) BatchCall(ctx context.Context, requests []*models.LLMRequest) ([]*models.LLMResponse, error) {
-	responses := make([]*models.LLMResponse, len(requests))
-	var err error
-
-	// Process each request sequentially
-	// In a real implementation, we might consider parallel processing with rate limiting
-	for i, req := range requests {
-		responses[i], err = c.Call(ctx, req)
-		if err != nil {
-			return responses, fmt.Errorf("error processing request %d: %w", i, err)
-		}
-	}
+	return common.BatchCall(ctx, requests, c.config.BatchConcurrency, c.Call)
+}
 
-	return responses, nil
+// Model returns the model name this client was created for.
+func (c *MistralClient) Model() string {
+	return c.modelName
 }
 
-// SupportedModels returns a list of model names supported by this client.
+// SupportedModels returns the IDs of the provider's models in the registry.
 func (c *MistralClient) SupportedModels() []string {
-	// In a real implementation, we might fetch this from the API
-	// or from the models registry
-	return []string{
-		"mistral-small",
-		"mistral-medium",
-		"mistral-large",
-	}
+	return common.RegisteredModels(models.ProviderMistral)
 }
@@ -0,0 +1,236 @@
+// Package normalize cleans request text before it reaches a provider.
+//
+// Pasted and user-generated content often carries control characters, invisible formatting
+// characters, decomposed accents or emoji sequences that some providers tokenize poorly or
+// reject. Wrap applies Unicode normalization and the configured clean-ups to every text field
+// of a request and reports what was changed in the response's CustomMetadata.
+package normalize
+
+import (
+	"context"
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/unicode/norm"
+
+	"github.com/nexen/models"
+	"github.com/nexen/services/connectors/common"
+)
+
+// MetadataKey is the CustomMetadata key holding the Report for a normalized request.
+const MetadataKey = "normalization"
+
+// Options selects the normalizations to apply. The zero value applies NFC normalization and
+// strips control characters.
+type Options struct {
+	// Form is the Unicode normalization form; the zero value is NFC. NFKC additionally folds
+	// compatibility characters such as full-width letters and ligatures.
+	Form norm.Form
+
+	// KeepControl keeps control and invisible formatting characters. By default they are
+	// removed, except tab, newline and carriage return.
+	KeepControl bool
+
+	// StripEmoji removes emoji, including their variation selectors and skin-tone modifiers.
+	StripEmoji bool
+
+	// Transliterate folds Latin diacritics and typographic punctuation to ASCII, e.g. "café"
+	// to "cafe" and curly quotes to straight ones. Other scripts are left unchanged.
+	Transliterate bool
+}
+
+// Report counts the changes made to a request.
+type Report struct {
+	// Fields is the number of text fields that changed.
+	Fields int `json:"fields"`
+
+	// ControlRemoved is the number of control and formatting characters removed.
+	ControlRemoved int `json:"controlRemoved,omitempty"`
+
+	// EmojiRemoved is the number of emoji characters removed.
+	EmojiRemoved int `json:"emojiRemoved,omitempty"`
+
+	// Transliterated is the number of characters replaced by ASCII equivalents.
+	Transliterated int `json:"transliterated,omitempty"`
+}
+
+func (r *Report) add(other Report) {
+	r.Fields += other.Fields
+	r.ControlRemoved += other.ControlRemoved
+	r.EmojiRemoved += other.EmojiRemoved
+	r.Transliterated += other.Transliterated
+}
+
+// Text normalizes s according to opts.
+func Text(s string, opts Options) (string, Report) {
+	var report Report
+	out := s
+	if opts.Transliterate {
+		out = transliterate(norm.NFC.String(out), &report)
+	}
+	out = opts.Form.String(out)
+
+	var sb strings.Builder
+	sb.Grow(len(out))
+	afterEmoji := false
+	for _, r := range out {
+		switch {
+		case opts.StripEmoji && (isEmoji(r) || afterEmoji && r == zeroWidthJoiner):
+			// Joiners inside an emoji sequence go with it
+			report.EmojiRemoved++
+			afterEmoji = true
+			continue
+		case !opts.KeepControl && isControl(r):
+			report.ControlRemoved++
+		default:
+			sb.WriteRune(r)
+		}
+		afterEmoji = false
+	}
+	out = sb.String()
+
+	if out != s {
+		report.Fields = 1
+	}
+	return out, report
+}
+
+// Request returns a normalized copy of request. The caller's request is not modified.
+// Message text, string parts, and the system instruction are normalized; structured parts
+// such as function calls are passed through.
+func Request(request *models.LLMRequest, opts Options) (*models.LLMRequest, Report) {
+	var report Report
+	normalized := *request
+
+	normalized.Contents = make([]models.Content, len(request.Contents))
+	for i, content := range request.Contents {
+		var r Report
+		content.Message, r = Text(content.Message, opts)
+		report.add(r)
+		if len(content.Parts) > 0 {
+			parts := make([]any, len(content.Parts))
+			for j, part := range content.Parts {
+				if text, ok := part.(string); ok {
+					part, r = Text(text, opts)
+					report.add(r)
+				}
+				parts[j] = part
+			}
+			content.Parts = parts
+		}
+		normalized.Contents[i] = content
+	}
+
+	if request.Config != nil {
+		config := *request.Config
+		var r Report
+		config.SystemInstruction, r = Text(config.SystemInstruction, opts)
+		report.add(r)
+		normalized.Config = &config
+	}
+	return &normalized, report
+}
+
+// normalizingLLM normalizes requests before passing them to the wrapped LLM.
+type normalizingLLM struct {
+	common.LLM
+	opts Options
+}
+
+// Wrap returns an LLM that normalizes every request with opts. When anything was changed,
+// the Report is stored in the response's CustomMetadata under MetadataKey.
+func Wrap(llm common.LLM, opts Options) common.LLM {
+	return &normalizingLLM{LLM: llm, opts: opts}
+}
+
+// Call implements the LLM interface Call method.
+func (n *normalizingLLM) Call(ctx context.Context, request *models.LLMRequest) (*models.LLMResponse, error) {
+	normalized, report := Request(request, n.opts)
+	response, err := n.LLM.Call(ctx, normalized)
+	if response != nil && report.Fields > 0 {
+		if response.CustomMetadata == nil {
+			response.CustomMetadata = make(map[string]any)
+		}
+		response.CustomMetadata[MetadataKey] = report
+	}
+	return response, err
+}
+
+// BatchCall implements the LLM interface BatchCall method.
+func (n *normalizingLLM) BatchCall(ctx context.Context, requests []*models.LLMRequest) ([]*models.LLMResponse, error) {
+	return common.BatchCall(ctx, requests, common.DefaultBatchConcurrency, n.Call)
+}
+
+// isControl reports whether r is a control character other than tab, newline and carriage
+// return, or an invisible character that is commonly pasted by accident: zero-width space,
+// word joiner, byte order mark, and bidirectional overrides. Zero-width (non-)joiners are
+// kept because Indic and Persian text depends on them.
+func isControl(r rune) bool {
+	switch r {
+	case '\t', '\n', '\r':
+		return false
+	case '\u200B', '\u2060', '\uFEFF':
+		return true
+	}
+	if r >= '\u202A' && r <= '\u202E' || r >= '\u2066' && r <= '\u2069' {
+		return true
+	}
+	return unicode.IsControl(r)
+}
+
+// zeroWidthJoiner combines emoji into sequences such as family emoji.
+const zeroWidthJoiner = '\u200D'
+
+// isEmoji reports whether r is an emoji pictograph, dingbat, regional indicator, skin-tone
+// modifier, or the emoji presentation selector.
+func isEmoji(r rune) bool {
+	switch {
+	case r >= 0x1F000 && r <= 0x1FAFF: // pictographs, emoticons, regional indicators, modifiers
+		return true
+	case r >= 0x2600 && r <= 0x27BF: // miscellaneous symbols and dingbats
+		return true
+	case r == 0xFE0F: // emoji presentation selector
+		return true
+	}
+	return false
+}
+
+// asciiPunctuation maps typographic characters to their ASCII equivalents.
+var asciiPunctuation = map[rune]string{
+	'‘': "'", '’': "'", '‚': "'", '′': "'",
+	'“': `"`, '”': `"`, '„': `"`, '″': `"`,
+	'‐': "-", '‑': "-", '‒': "-", '–': "-", '—': "-", '−': "-", '…': "...",
+	'\u00A0': " ", '\u2002': " ", '\u2003': " ", '\u2009': " ", '\u202F': " ", // non-breaking and fixed-width spaces
+	'ß': "ss", 'æ': "ae", 'Æ': "AE", 'œ': "oe", 'Œ': "OE",
+	'ø': "o", 'Ø': "O", 'ł': "l", 'Ł': "L", 'đ': "d", 'Đ': "D",
+}
+
+// transliterate folds Latin diacritics and typographic punctuation in NFC text to ASCII.
+func transliterate(s string, report *Report) string {
+	var sb strings.Builder
+	sb.Grow(len(s))
+	for _, r := range s {
+		if replacement, ok := asciiPunctuation[r]; ok {
+			sb.WriteString(replacement)
+			report.Transliterated++
+			continue
+		}
+		if r < 0x80 || !unicode.Is(unicode.Latin, r) {
+			sb.WriteRune(r)
+			continue
+		}
+		// Decompose and keep the base letter, dropping combining marks
+		folded := false
+		for _, d := range norm.NFD.String(string(r)) {
+			if unicode.Is(unicode.Mn, d) {
+				folded = true
+				continue
+			}
+			sb.WriteRune(d)
+		}
+		if folded {
+			report.Transliterated++
+		}
+	}
+	return sb.String()
+}
@@ -0,0 +1,99 @@
+package normalize
+
+import (
+	"context"
+	"testing"
+
+	"golang.org/x/text/unicode/norm"
+
+	"github.com/nexen/models"
+)
+
+// echoLLM replies with the text of the last message it received.
+type echoLLM struct {
+	last *models.LLMRequest
+}
+
+func (e *echoLLM) Call(ctx context.Context, request *models.LLMRequest) (*models.LLMResponse, error) {
+	e.last = request
+	message := request.Contents[len(request.Contents)-1].Message
+	return &models.LLMResponse{Content: &models.Content{Role: "assistant", Message: message}}, nil
+}
+
+func (e *echoLLM) BatchCall(ctx context.Context, requests []*models.LLMRequest) ([]*models.LLMResponse, error) {
+	return nil, nil
+}
+
+func (e *echoLLM) SupportedModels() []string {
+	return []string{"echo"}
+}
+
+func TestText(t *testing.T) {
+	testCases := []struct {
+		name   string
+		input  string
+		opts   Options
+		want   string
+		report Report
+	}{
+		{"decomposed accent", "cafe\u0301", Options{}, "caf\u00e9", Report{Fields: 1}},
+		{"control characters", "a\x00b\u200Bc\u202Ed\ne\tf", Options{}, "abcd\ne\tf", Report{Fields: 1, ControlRemoved: 3}},
+		{"keep control", "a\x00b", Options{KeepControl: true}, "a\x00b", Report{}},
+		{"compatibility", "ｆｕｌｌ ﬁle", Options{Form: norm.NFKC}, "full file", Report{Fields: 1}},
+		{"emoji", "hi 👋🏽 family 👨\u200D👩\u200D👧 ok ✅", Options{StripEmoji: true}, "hi  family  ok ", Report{Fields: 1, EmojiRemoved: 8}},
+		{"transliterate", "Crème brûlée – “naïve” Straße…", Options{Transliterate: true}, `Creme brulee - "naive" Strasse...`, Report{Fields: 1, Transliterated: 9}},
+		{"other scripts", "Привет 東京 مرحبا", Options{Transliterate: true}, "Привет 東京 مرحبا", Report{}},
+		{"persian joiner kept", "می\u200Cخواهم", Options{}, "می\u200Cخواهم", Report{}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, report := Text(tc.input, tc.opts)
+			if got != tc.want {
+				t.Errorf("Text(%q) = %q, want %q", tc.input, got, tc.want)
+			}
+			if report != tc.report {
+				t.Errorf("Report = %+v, want %+v", report, tc.report)
+			}
+		})
+	}
+}
+
+func TestWrapReportsChanges(t *testing.T) {
+	echo := &echoLLM{}
+	llm := Wrap(echo, Options{})
+
+	request := &models.LLMRequest{
+		Model: "echo",
+		Contents: []models.Content{
+			{Role: "user", Parts: []any{"a\x07", models.NewFunctionCallPart(models.FunctionCall{Name: "f"})}},
+			{Role: "user", Message: "résumé\x1b"},
+		},
+		Config: &models.GenerateContentConfig{SystemInstruction: "\uFEFFBe brief"},
+	}
+	response, err := llm.Call(context.Background(), request)
+	if err != nil {
+		t.Fatalf("Call failed: %v", err)
+	}
+
+	if response.Content.Message != "résumé" || echo.last.Config.SystemInstruction != "Be brief" {
+		t.Errorf("Expected normalized request, got %q and %q", response.Content.Message, echo.last.Config.SystemInstruction)
+	}
+	if echo.last.Contents[0].Parts[0] != "a" || len(echo.last.Contents[0].Parts) != 2 {
+		t.Errorf("Expected string parts to be normalized, got %v", echo.last.Contents[0].Parts)
+	}
+	if request.Contents[1].Message != "résumé\x1b" || request.Config.SystemInstruction != "\uFEFFBe brief" {
+		t.Error("Caller's request should not be modified")
+	}
+
+	report, ok := response.CustomMetadata[MetadataKey].(Report)
+	if !ok || report.Fields != 3 || report.ControlRemoved != 3 {
+		t.Errorf("Unexpected report %+v", response.CustomMetadata[MetadataKey])
+	}
+
+	clean := &models.LLMRequest{Model: "echo", Contents: []models.Content{{Role: "user", Message: "plain"}}}
+	response, _ = llm.Call(context.Background(), clean)
+	if _, ok := response.CustomMetadata[MetadataKey]; ok {
+		t.Error("Expected no report when nothing changed")
+	}
+}
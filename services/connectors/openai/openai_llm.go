@@ -1,8 +1,15 @@
 package openai
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
 	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
 
 	"github.com/nexen/models"
 	"github.com/nexen/services/connectors"
@@ -23,12 +30,23 @@ var (
 
 // OpenAIClient implements the LLM interface for OpenAI's API.
 type OpenAIClient struct {
-	config    *common.LLMConfig
-	modelName string
-	// We would include the actual OpenAI SDK client here in a real implementation
-	// client *openai.Client
+	config     *common.LLMConfig
+	modelName  string
+	regions    *common.RegionRouter
+	httpClient *http.Client
+	limiter    *common.RateLimiter
 }
 
+// The interfaces OpenAIClient implements, checked at compile time.
+var (
+	_ common.LLM            = (*OpenAIClient)(nil)
+	_ common.ModelNamer     = (*OpenAIClient)(nil)
+	_ common.Streamer       = (*OpenAIClient)(nil)
+	_ common.ModelLister    = (*OpenAIClient)(nil)
+	_ common.ModelDescriber = (*OpenAIClient)(nil)
+	_ common.Pinger         = (*OpenAIClient)(nil)
+)
+
 // init registers this adapter with the connectors registry.
 func init() {
 	for _, pattern := range supportedModelPatterns {
@@ -53,10 +71,231 @@ func NewOpenAIClient(model string, opts ...common.Option) (common.LLM, error) {
 	return &OpenAIClient{
 		config:    config,
 		modelName: model,
-		// In a real implementation, we would initialize the OpenAI client here
+		regions:   common.NewRegionRouter(models.ProviderOpenAI, defaultOpenAIEndpoint, config),
+		// Timeouts are applied per call with common.CallContext
+		httpClient: &http.Client{Transport: common.TimingTransport(models.ProviderOpenAI, nil)},
+		limiter:    common.SharedRateLimiter(models.ProviderOpenAI, config.APIKey, config.RateLimit),
 	}, nil
 }
 
+// newChatCompletionRequest transforms a models.LLMRequest into OpenAI's request structure.
+func newChatCompletionRequest(model string, request *models.LLMRequest) *chatCompletionRequest {
+	payload := &chatCompletionRequest{Model: model, User: request.Metadata.UserID}
+
+	if request.Config != nil && request.Config.SystemInstruction != "" {
+		payload.Messages = append(payload.Messages, chatMessage{Role: "system", Content: request.Config.SystemInstruction})
+	}
+	for _, content := range request.Contents {
+		payload.Messages = append(payload.Messages, contentToChatMessages(content)...)
+	}
+
+	if request.Config == nil {
+		return payload
+	}
+	payload.Temperature = request.Config.Temperature
+	payload.TopP = request.Config.TopP
+	payload.MaxTokens = request.Config.MaxTokens
+	payload.Stop = request.Config.StopSequences
+
+	payload.ResponseFormat = responseFormatParam(request.Config)
+	if payload.ResponseFormat != nil && payload.ResponseFormat.Type == "json_object" && !mentionsJSON(payload.Messages) {
+		// OpenAI rejects JSON mode unless the messages ask for JSON
+		payload.Messages = append([]chatMessage{{Role: "system", Content: models.JSONModeInstruction}}, payload.Messages...)
+	}
+
+	if request.Config.ResponseLogprobs {
+		payload.Logprobs = true
+		payload.TopLogprobs = request.Config.TopLogprobs
+	}
+
+	for _, toolDecl := range request.Config.Tools {
+		for _, declaration := range toolDecl.FunctionDeclarations {
+			payload.Tools = append(payload.Tools, chatTool{Type: "function", Function: json.RawMessage(declaration)})
+		}
+	}
+	if len(payload.Tools) > 0 {
+		payload.ToolChoice = toolChoiceParam(request.Config)
+	}
+	return payload
+}
+
+// responseFormatParam maps the request's output schema to OpenAI's response_format.
+// A schema selects structured outputs; JSONMode or a JSON mime type alone selects JSON mode.
+func responseFormatParam(config *models.GenerateContentConfig) *chatResponseFormat {
+	schema, err := config.OutputSchema()
+	if err == nil && schema != nil {
+		return &chatResponseFormat{
+			Type:       "json_schema",
+			JSONSchema: &chatJSONSchema{Name: "response", Schema: schema},
+		}
+	}
+	if config.JSONMode || config.ResponseMimeType == "application/json" {
+		return &chatResponseFormat{Type: "json_object"}
+	}
+	return nil
+}
+
+// mentionsJSON reports whether any message contains the word "JSON", in any case.
+func mentionsJSON(messages []chatMessage) bool {
+	for _, message := range messages {
+		if strings.Contains(strings.ToLower(message.Content), "json") {
+			return true
+		}
+	}
+	return false
+}
+
+// contentToChatMessages converts a models.Content into chat messages. Function calls become
+// assistant tool_calls and each function response becomes its own "tool" message.
+func contentToChatMessages(content models.Content) []chatMessage {
+	role := content.Role
+	if role == "model" {
+		role = "assistant"
+	}
+	if len(content.Parts) == 0 {
+		return []chatMessage{{Role: role, Content: content.Message}}
+	}
+
+	var text strings.Builder
+	var toolCalls []chatToolCall
+	var results []chatMessage
+	for _, part := range content.Parts {
+		switch v := part.(type) {
+		case string:
+			text.WriteString(v)
+		case map[string]any:
+			if call, ok := v[models.PartFunctionCall].(map[string]any); ok {
+				id, _ := call["id"].(string)
+				name, _ := call["name"].(string)
+				args, _ := json.Marshal(call["args"])
+				toolCalls = append(toolCalls, chatToolCall{
+					ID:       id,
+					Type:     "function",
+					Function: chatFunctionCall{Name: name, Arguments: string(args)},
+				})
+			} else if resp, ok := v[models.PartFunctionResponse].(map[string]any); ok {
+				id, _ := resp["id"].(string)
+				results = append(results, chatMessage{Role: "tool", ToolCallID: id, Content: functionResultText(resp["response"])})
+			}
+		}
+	}
+
+	var messages []chatMessage
+	if text.Len() > 0 || len(toolCalls) > 0 {
+		messages = append(messages, chatMessage{Role: role, Content: text.String(), ToolCalls: toolCalls})
+	}
+	return append(messages, results...)
+}
+
+// functionResultText renders a tool result as message content.
+func functionResultText(result any) string {
+	if text, ok := result.(string); ok {
+		return text
+	}
+	encoded, err := json.Marshal(result)
+	if err != nil {
+		return fmt.Sprintf("%v", result)
+	}
+	return string(encoded)
+}
+
+// toolChoiceParam maps the request's tool choice to OpenAI's tool_choice value.
+// The modes are passed as strings; a specific function becomes a function object.
+func toolChoiceParam(config *models.GenerateContentConfig) any {
+	if name, ok := config.SpecificToolChoice(); ok {
+		return map[string]any{
+			"type":     "function",
+			"function": map[string]string{"name": name},
+		}
+	}
+	if config.ToolChoice == "" {
+		return models.ToolChoiceAuto
+	}
+	return config.ToolChoice
+}
+
+// chatResponseToLLMResponse converts OpenAI's response to models.LLMResponse.
+func chatResponseToLLMResponse(chatResp *chatCompletionResponse) *models.LLMResponse {
+	response := &models.LLMResponse{
+		Usage: models.UsageMetrics{
+			PromptTokens:       chatResp.Usage.PromptTokens,
+			CachedPromptTokens: chatResp.Usage.PromptTokensDetails.CachedTokens,
+			CompletionTokens:   chatResp.Usage.CompletionTokens,
+			TotalTokens:        chatResp.Usage.PromptTokens + chatResp.Usage.CompletionTokens,
+		},
+	}
+
+	if len(chatResp.Choices) == 0 {
+		code, msg := "NO_CHOICES", "OpenAI returned no choices"
+		response.ErrorCode, response.ErrorMessage = &code, &msg
+		return response
+	}
+
+	choice := chatResp.Choices[0]
+	content := &models.Content{
+		Role:    "assistant",
+		Message: choice.Message.Content,
+	}
+	if len(choice.Message.ToolCalls) > 0 {
+		if choice.Message.Content != "" {
+			content.Parts = append(content.Parts, choice.Message.Content)
+		}
+		for _, call := range choice.Message.ToolCalls {
+			var args map[string]any
+			json.Unmarshal([]byte(call.Function.Arguments), &args)
+			content.Parts = append(content.Parts, models.NewFunctionCallPart(models.FunctionCall{
+				ID:   call.ID,
+				Name: call.Function.Name,
+				Args: args,
+			}))
+		}
+	}
+	response.Content = content
+	response.Logprobs = convertLogprobs(choice.Logprobs)
+
+	if choice.FinishReason != "" {
+		response.CustomMetadata = map[string]any{common.MetadataFinishReason: choice.FinishReason}
+	}
+	if chatResp.ServiceTier != "" {
+		if response.CustomMetadata == nil {
+			response.CustomMetadata = make(map[string]any)
+		}
+		response.CustomMetadata[common.MetadataServiceTier] = chatResp.ServiceTier
+	}
+
+	// Set error information if the finish reason indicates an issue
+	common.CheckValue(models.ProviderOpenAI, "choices.finish_reason", choice.FinishReason, knownFinishReasons...)
+	switch choice.FinishReason {
+	case "length":
+		code, msg := "MAX_TOKENS", "Response was cut off due to token limit"
+		response.ErrorCode, response.ErrorMessage = &code, &msg
+	case "content_filter":
+		code, msg := "CONTENT_FILTER", "Response was blocked by the content filter"
+		response.ErrorCode, response.ErrorMessage = &code, &msg
+	}
+
+	return response
+}
+
+// knownFinishReasons lists the finish_reason values this connector understands.
+var knownFinishReasons = []string{"stop", "length", "content_filter", "tool_calls", "function_call"}
+
+// convertLogprobs maps OpenAI's per-token logprobs to models.Logprobs.
+func convertLogprobs(lp *chatLogprobs) *models.Logprobs {
+	if lp == nil || len(lp.Content) == 0 {
+		return nil
+	}
+	result := &models.Logprobs{Tokens: make([]models.TokenLogprob, 0, len(lp.Content))}
+	for _, tok := range lp.Content {
+		token := models.TokenLogprob{Token: tok.Token, Logprob: tok.Logprob}
+		for _, alt := range tok.TopLogprobs {
+			token.TopAlternatives = append(token.TopAlternatives, models.TopLogprob{Token: alt.Token, Logprob: alt.Logprob})
+		}
+		result.Tokens = append(result.Tokens, token)
+	}
+	return result
+}
+
 // Call implements the LLM interface Call method.
 func (c *OpenAIClient) Call(ctx context.Context, request *models.LLMRequest) (*models.LLMResponse, error) {
 	// Check if context is done
@@ -68,63 +307,210 @@ func (c *OpenAIClient) Call(ctx context.Context, request *models.LLMRequest) (*m
 	if err := request.Validate(); err != nil {
 		return nil, fmt.Errorf("invalid request: %w", err)
 	}
+	ctx, cancel := common.CallContext(ctx, request, c.config)
+	defer cancel()
 
-	// In a real implementation, we would:
-	// 1. Transform the models.LLMRequest to OpenAI's request structure
-	// 2. Call the OpenAI API
-	// 3. Transform the response to models.LLMResponse
-	// 4. Handle errors, retries, and streaming if requested
-
-	// For this example, we'll return a mock response
-	mockResponse := &models.GenerateContentResponse{
-		Candidates: []models.Candidate{
-			{
-				Content: &models.Content{
-					Role:    "assistant",
-					Message: fmt.Sprintf("This is a mock response from %s", c.modelName),
-				},
-				FinishReason: "stop",
-			},
-		},
-		Usage: models.UsageMetrics{
-			PromptTokens:     100,
-			CompletionTokens: 50,
-			TotalTokens:      150,
-			LatencyMs:        500,
-			CostCents:        0.02,
-		},
+	// Transform the models.LLMRequest to OpenAI's request structure
+	payload := newChatCompletionRequest(c.modelName, request)
+	payload.ServiceTier = common.RequestServiceTier(c.config, request)
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return nil, fmt.Errorf("encoding OpenAI request: %w", err)
 	}
 
-	return &models.LLMResponse{
-		Content: mockResponse.Candidates[0].Content,
-		Usage:   mockResponse.Usage,
-	}, nil
+	// Wait for the key's rate limit before sending
+	estimatedTokens := common.EstimateTokens(request)
+	if err := c.limiter.Wait(ctx, estimatedTokens); err != nil {
+		return nil, err
+	}
+
+	// Make the API call, failing over between regions and retrying transient failures
+	start := time.Now()
+	var chatResp *chatCompletionResponse
+	err = common.DoWithRetry(ctx, c.config.RetryConfig, func(ctx context.Context) error {
+		return c.regions.Do(ctx, func(ctx context.Context, endpoint string) error {
+			var err error
+			chatResp, err = c.postChatCompletion(ctx, endpoint, body)
+			return err
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Convert to LLMResponse
+	response := chatResponseToLLMResponse(chatResp)
+	c.limiter.Adjust(response.Usage.TotalTokens - estimatedTokens)
+	common.DefaultTokenCalibrator.ObserveRequest(request, response.Usage.PromptTokens)
+	response.Usage.LatencyMs = float64(time.Since(start).Milliseconds())
+	return response, nil
 }
 
-// BatchCall implements the LLM interface BatchCall method.
-func (c *OpenAIClient) BatchCall(ctx context.Context, requests []*models.LLMRequest) ([]*models.LLMResponse, error) {
-	responses := make([]*models.LLMResponse, len(requests))
-	var err error
+// newChatCompletionHTTPRequest creates a chat completions request to endpoint with body.
+func (c *OpenAIClient) newChatCompletionHTTPRequest(ctx context.Context, endpoint string, body []byte) (*http.Request, error) {
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimRight(endpoint, "/")+"/chat/completions", bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("creating OpenAI request: %w", err)
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	httpReq.Header.Set("Authorization", "Bearer "+c.config.APIKey)
+	if c.config.OrgID != "" {
+		httpReq.Header.Set("OpenAI-Organization", c.config.OrgID)
+	}
+	common.InjectTraceContext(ctx, httpReq.Header)
+	common.DumpRequest(c.config.RequestDump, httpReq)
+	return httpReq, nil
+}
+
+// postChatCompletion sends one chat completions request to endpoint.
+func (c *OpenAIClient) postChatCompletion(ctx context.Context, endpoint string, body []byte) (*chatCompletionResponse, error) {
+	httpReq, err := c.newChatCompletionHTTPRequest(ctx, endpoint, body)
+	if err != nil {
+		return nil, err
+	}
+
+	httpResp, err := c.httpClient.Do(httpReq)
+	if err != nil {
+		return nil, common.TransportError(models.ProviderOpenAI, err)
+	}
+	defer httpResp.Body.Close()
+
+	respBody, err := io.ReadAll(httpResp.Body)
+	if err != nil {
+		return nil, common.TransportError(models.ProviderOpenAI, err)
+	}
+	if httpResp.StatusCode != http.StatusOK {
+		return nil, newAPIError(httpResp, respBody)
+	}
+
+	// Decode leniently so new or changed fields are reported instead of failing the call
+	var chatResp chatCompletionResponse
+	if err := common.DecodeLenient(models.ProviderOpenAI, respBody, &chatResp); err != nil {
+		return nil, fmt.Errorf("decoding OpenAI response: %w", err)
+	}
+	return &chatResp, nil
+}
 
-	// Process each request sequentially
-	// In a real implementation, we might consider parallel processing with rate limiting
-	for i, req := range requests {
-		responses[i], err = c.Call(ctx, req)
+// newAPIError converts a non-200 response into a classified *common.ProviderError.
+func newAPIError(httpResp *http.Response, body []byte) error {
+	code, message := "", strings.TrimSpace(string(body))
+	var errResp errorResponse
+	if err := json.Unmarshal(body, &errResp); err == nil && errResp.Error.Message != "" {
+		message = errResp.Error.Message
+		code = errResp.Error.Type
+		if c, ok := errResp.Error.Code.(string); ok && c != "" {
+			code = c
+		}
+	}
+
+	apiErr := common.NewProviderError(models.ProviderOpenAI, httpResp.StatusCode, code, message)
+	apiErr.RetryAfter = common.ParseRetryAfter(httpResp.Header.Get("Retry-After"))
+	return apiErr
+}
+
+// ListModels implements common.ModelLister with the models endpoint.
+func (c *OpenAIClient) ListModels(ctx context.Context) ([]string, error) {
+	described, err := c.DescribeModels(ctx)
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]string, len(described))
+	for i, model := range described {
+		ids[i] = model.ID
+	}
+	return ids, nil
+}
+
+// DescribeModels implements common.ModelDescriber with the models endpoint, which reports
+// when each model was created.
+func (c *OpenAIClient) DescribeModels(ctx context.Context) ([]common.ModelDescription, error) {
+	var described []common.ModelDescription
+	after := ""
+	for {
+		var page *modelList
+		err := common.DoWithRetry(ctx, c.config.RetryConfig, func(ctx context.Context) error {
+			return c.regions.Do(ctx, func(ctx context.Context, endpoint string) error {
+				var err error
+				page, err = c.getModels(ctx, endpoint, after)
+				return err
+			})
+		})
 		if err != nil {
-			return responses, fmt.Errorf("error processing request %d: %w", i, err)
+			return nil, err
+		}
+		for _, model := range page.Data {
+			description := common.ModelDescription{ID: model.ID}
+			if model.Created > 0 {
+				description.Created = time.Unix(model.Created, 0).UTC()
+			}
+			described = append(described, description)
 		}
+		if !page.HasMore || page.LastID == "" {
+			return described, nil
+		}
+		after = page.LastID
 	}
+}
 
-	return responses, nil
+// Ping implements common.Pinger by fetching the first page of the models endpoint, which
+// fails like a call would when the API key is refused or no region can be reached. It is not
+// retried.
+func (c *OpenAIClient) Ping(ctx context.Context) error {
+	return c.regions.Do(ctx, func(ctx context.Context, endpoint string) error {
+		_, err := c.getModels(ctx, endpoint, "")
+		return err
+	})
 }
 
-// SupportedModels returns a list of model names supported by this client.
-func (c *OpenAIClient) SupportedModels() []string {
-	// In a real implementation, we might fetch this from the API
-	// or from the models registry
-	return []string{
-		"gpt-4",
-		"gpt-4-turbo",
-		"gpt-3.5-turbo",
+// getModels fetches one page of the models endpoint of endpoint, starting after the model ID
+// after.
+func (c *OpenAIClient) getModels(ctx context.Context, endpoint, after string) (*modelList, error) {
+	endpoint = strings.TrimRight(endpoint, "/") + "/models"
+	if after != "" {
+		endpoint += "?after=" + url.QueryEscape(after)
+	}
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return nil, fmt.Errorf("creating OpenAI request: %w", err)
 	}
+	httpReq.Header.Set("Authorization", "Bearer "+c.config.APIKey)
+	if c.config.OrgID != "" {
+		httpReq.Header.Set("OpenAI-Organization", c.config.OrgID)
+	}
+	common.InjectTraceContext(ctx, httpReq.Header)
+
+	httpResp, err := c.httpClient.Do(httpReq)
+	if err != nil {
+		return nil, common.TransportError(models.ProviderOpenAI, err)
+	}
+	defer httpResp.Body.Close()
+
+	respBody, err := io.ReadAll(httpResp.Body)
+	if err != nil {
+		return nil, common.TransportError(models.ProviderOpenAI, err)
+	}
+	if httpResp.StatusCode != http.StatusOK {
+		return nil, newAPIError(httpResp, respBody)
+	}
+
+	var page modelList
+	if err := json.Unmarshal(respBody, &page); err != nil {
+		return nil, fmt.Errorf("decoding OpenAI models: %w", err)
+	}
+	return &page, nil
+}
+
+// BatchCall implements the LLM interface BatchCall method.
+func (c *OpenAIClient) BatchCall(ctx context.Context, requests []*models.LLMRequest) ([]*models.LLMResponse, error) {
+	return common.BatchCall(ctx, requests, c.config.BatchConcurrency, c.Call)
+}
+
+// Model returns the model name this client was created for.
+func (c *OpenAIClient) Model() string {
+	return c.modelName
+}
+
+// SupportedModels returns the IDs of the provider's models in the registry.
+func (c *OpenAIClient) SupportedModels() []string {
+	return common.RegisteredModels(models.ProviderOpenAI)
 }
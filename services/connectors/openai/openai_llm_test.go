@@ -0,0 +1,468 @@
+package openai
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/nexen/models"
+	"github.com/nexen/services/connectors/common"
+)
+
+func TestNewChatCompletionRequestToolChoice(t *testing.T) {
+	testCases := []struct {
+		choice   string
+		expected string
+	}{
+		{"", `"auto"`},
+		{models.ToolChoiceNone, `"none"`},
+		{models.ToolChoiceRequired, `"required"`},
+		{"get_weather", `{"function":{"name":"get_weather"},"type":"function"}`},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.choice, func(t *testing.T) {
+			request := &models.LLMRequest{
+				Model:    "gpt-4",
+				Contents: []models.Content{{Role: "user", Message: "Weather in Paris?"}},
+				Config: &models.GenerateContentConfig{
+					Tools:      []models.ToolDeclaration{{FunctionDeclarations: []string{`{"name":"get_weather"}`}}},
+					ToolChoice: tc.choice,
+				},
+			}
+
+			payload := newChatCompletionRequest("gpt-4", request)
+			got, err := json.Marshal(payload.ToolChoice)
+			if err != nil {
+				t.Fatalf("Marshal failed: %v", err)
+			}
+			if string(got) != tc.expected {
+				t.Errorf("Expected tool_choice %s, got %s", tc.expected, got)
+			}
+		})
+	}
+}
+
+func TestNewChatCompletionRequestWithoutTools(t *testing.T) {
+	request := &models.LLMRequest{
+		Model:    "gpt-4",
+		Contents: []models.Content{{Role: "user", Message: "Hello"}},
+		Config:   &models.GenerateContentConfig{SystemInstruction: "Be brief"},
+	}
+
+	payload := newChatCompletionRequest("gpt-4", request)
+	if payload.ToolChoice != nil {
+		t.Errorf("Expected no tool_choice without tools, got %v", payload.ToolChoice)
+	}
+	if len(payload.Messages) != 2 || payload.Messages[0].Role != "system" {
+		t.Errorf("Expected system message first, got %+v", payload.Messages)
+	}
+}
+
+func TestNewChatCompletionRequestUser(t *testing.T) {
+	request := &models.LLMRequest{
+		Contents: []models.Content{{Role: "user", Message: "Hello"}},
+		Metadata: models.RequestMetadata{TenantID: "acme", UserID: "u-42"},
+	}
+	if payload := newChatCompletionRequest("gpt-4", request); payload.User != "u-42" {
+		t.Errorf("Expected user u-42, got %q", payload.User)
+	}
+}
+
+func TestNewChatCompletionRequestResponseFormat(t *testing.T) {
+	type answer struct {
+		City string `json:"city"`
+	}
+	request := &models.LLMRequest{
+		Model:    "gpt-4",
+		Contents: []models.Content{{Role: "user", Message: "Capital of France?"}},
+	}
+	request.SetOutputSchema(answer{})
+
+	payload := newChatCompletionRequest("gpt-4", request)
+	if payload.ResponseFormat == nil || payload.ResponseFormat.Type != "json_schema" {
+		t.Fatalf("Expected json_schema response format, got %+v", payload.ResponseFormat)
+	}
+	if payload.ResponseFormat.JSONSchema.Schema.Properties["city"] == nil {
+		t.Error("Expected city property in response schema")
+	}
+
+	request.Config.ResponseSchema = nil
+	payload = newChatCompletionRequest("gpt-4", request)
+	if payload.ResponseFormat == nil || payload.ResponseFormat.Type != "json_object" {
+		t.Errorf("Expected json_object response format, got %+v", payload.ResponseFormat)
+	}
+}
+
+func TestNewChatCompletionRequestJSONMode(t *testing.T) {
+	request := &models.LLMRequest{
+		Model:    "gpt-4",
+		Contents: []models.Content{{Role: "user", Message: "List three colors."}},
+		Config:   &models.GenerateContentConfig{JSONMode: true},
+	}
+	payload := newChatCompletionRequest("gpt-4", request)
+	if payload.ResponseFormat == nil || payload.ResponseFormat.Type != "json_object" {
+		t.Fatalf("Expected json_object response format, got %+v", payload.ResponseFormat)
+	}
+	if payload.Messages[0].Content != models.JSONModeInstruction {
+		t.Errorf("Expected the JSON instruction when no message mentions JSON, got %+v", payload.Messages)
+	}
+
+	request.Contents[0].Message = "List three colors as JSON."
+	if payload := newChatCompletionRequest("gpt-4", request); len(payload.Messages) != 1 {
+		t.Errorf("Expected no extra instruction when a message mentions JSON, got %+v", payload.Messages)
+	}
+}
+
+func TestCallParsesLogprobsAndToolCalls(t *testing.T) {
+	var received chatCompletionRequest
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/chat/completions" {
+			t.Errorf("Unexpected path %s", r.URL.Path)
+		}
+		if r.Header.Get("Authorization") != "Bearer test-api-key" {
+			t.Errorf("Missing bearer token")
+		}
+		json.NewDecoder(r.Body).Decode(&received)
+		w.Write([]byte(`{
+			"id": "chatcmpl-1",
+			"choices": [{
+				"index": 0,
+				"finish_reason": "tool_calls",
+				"message": {
+					"role": "assistant",
+					"content": "",
+					"tool_calls": [{"id": "call_1", "type": "function", "function": {"name": "get_weather", "arguments": "{\"city\":\"Paris\"}"}}]
+				},
+				"logprobs": {"content": [
+					{"token": "Hi", "logprob": -0.01, "top_logprobs": [{"token": "Hi", "logprob": -0.01}, {"token": "Hello", "logprob": -4.6}]}
+				]}
+			}],
+			"usage": {"prompt_tokens": 12, "completion_tokens": 3, "total_tokens": 15, "prompt_tokens_details": {"cached_tokens": 8}}
+		}`))
+	}))
+	defer srv.Close()
+
+	client, err := NewOpenAIClient("gpt-4", common.WithAPIKey("test-api-key"), common.WithEndpoint(srv.URL))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	request := &models.LLMRequest{
+		Model:    "gpt-4",
+		Contents: []models.Content{{Role: "user", Message: "Weather in Paris?"}},
+		Config:   &models.GenerateContentConfig{ResponseLogprobs: true, TopLogprobs: 2},
+	}
+	response, err := client.Call(context.Background(), request)
+	if err != nil {
+		t.Fatalf("Call failed: %v", err)
+	}
+
+	if !received.Logprobs || received.TopLogprobs != 2 {
+		t.Errorf("Expected logprobs to be requested, got logprobs=%v top=%d", received.Logprobs, received.TopLogprobs)
+	}
+	if response.Usage.PromptTokens != 12 || response.Usage.CachedPromptTokens != 8 {
+		t.Errorf("Unexpected usage %+v", response.Usage)
+	}
+	if response.Logprobs == nil || len(response.Logprobs.Tokens) != 1 {
+		t.Fatalf("Expected 1 logprob token, got %+v", response.Logprobs)
+	}
+	if alts := response.Logprobs.Tokens[0].TopAlternatives; len(alts) != 2 || alts[1].Token != "Hello" {
+		t.Errorf("Unexpected top alternatives %+v", alts)
+	}
+	calls := response.Content.FunctionCalls()
+	if len(calls) != 1 || calls[0].Name != "get_weather" || calls[0].Args["city"] != "Paris" {
+		t.Errorf("Unexpected function calls %+v", calls)
+	}
+	if response.Usage.TotalTokens != 15 {
+		t.Errorf("Expected 15 total tokens, got %d", response.Usage.TotalTokens)
+	}
+}
+
+func TestCallReturnsErrorOnHTTPFailure(t *testing.T) {
+	testCases := []struct {
+		name   string
+		status int
+		body   string
+		class  error
+	}{
+		{"auth", http.StatusUnauthorized, `{"error":{"message":"invalid key","type":"invalid_request_error"}}`, common.ErrAuth},
+		{"rate limit", http.StatusTooManyRequests, `{"error":{"message":"slow down","type":"requests"}}`, common.ErrRateLimited},
+		{"context length", http.StatusBadRequest, `{"error":{"message":"too long","type":"invalid_request_error","code":"context_length_exceeded"}}`, common.ErrContextLengthExceeded},
+		{"content policy", http.StatusBadRequest, `{"error":{"message":"rejected","code":"content_policy_violation"}}`, common.ErrContentFiltered},
+		{"unavailable", http.StatusServiceUnavailable, `upstream down`, common.ErrProviderUnavailable},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Retry-After", "2")
+				http.Error(w, tc.body, tc.status)
+			}))
+			defer srv.Close()
+
+			client, _ := NewOpenAIClient("gpt-4", common.WithAPIKey("key"), common.WithEndpoint(srv.URL),
+				common.WithRetryConfig(0, 0, 0, nil))
+			_, err := client.Call(context.Background(), &models.LLMRequest{
+				Model:    "gpt-4",
+				Contents: []models.Content{{Role: "user", Message: "Hello"}},
+			})
+			if !errors.Is(err, tc.class) {
+				t.Fatalf("Expected %v, got %v", tc.class, err)
+			}
+			var apiErr *common.ProviderError
+			if !errors.As(err, &apiErr) || apiErr.StatusCode != tc.status || apiErr.RetryAfter != 2*time.Second {
+				t.Errorf("Unexpected provider error %+v", apiErr)
+			}
+		})
+	}
+}
+
+func TestCallRetriesTransientFailures(t *testing.T) {
+	attempts := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		if attempts < 3 {
+			http.Error(w, `{"error":{"message":"slow down"}}`, http.StatusTooManyRequests)
+			return
+		}
+		w.Write([]byte(`{"choices":[{"message":{"role":"assistant","content":"Hi"},"finish_reason":"stop"}]}`))
+	}))
+	defer srv.Close()
+
+	client, _ := NewOpenAIClient("gpt-4", common.WithAPIKey("key"), common.WithEndpoint(srv.URL),
+		common.WithRetryConfig(3, 1, 5, common.DefaultRetryStatusCodes))
+	response, err := client.Call(context.Background(), &models.LLMRequest{
+		Model:    "gpt-4",
+		Contents: []models.Content{{Role: "user", Message: "Hello"}},
+	})
+	if err != nil {
+		t.Fatalf("Call failed: %v", err)
+	}
+	if attempts != 3 || response.Content.Message != "Hi" {
+		t.Errorf("Expected success on third attempt, got %d attempts and %+v", attempts, response.Content)
+	}
+}
+
+func TestContentToChatMessagesToolRoundTrip(t *testing.T) {
+	assistant := models.Content{Role: "assistant", Parts: []any{
+		models.NewFunctionCallPart(models.FunctionCall{ID: "call_1", Name: "get_weather", Args: map[string]any{"city": "Paris"}}),
+	}}
+	tool := models.Content{Role: "tool", Parts: []any{
+		models.NewFunctionResponsePart(models.FunctionResponse{ID: "call_1", Name: "get_weather", Response: "sunny"}),
+	}}
+
+	msgs := contentToChatMessages(assistant)
+	if len(msgs) != 1 || len(msgs[0].ToolCalls) != 1 || msgs[0].ToolCalls[0].Function.Arguments != `{"city":"Paris"}` {
+		t.Errorf("Unexpected assistant messages %+v", msgs)
+	}
+	msgs = contentToChatMessages(tool)
+	if len(msgs) != 1 || msgs[0].Role != "tool" || msgs[0].ToolCallID != "call_1" || msgs[0].Content != "sunny" {
+		t.Errorf("Unexpected tool messages %+v", msgs)
+	}
+}
+
+func TestCallToleratesSchemaDrift(t *testing.T) {
+	var drifts []common.Drift
+	common.SetDriftHandler(func(d common.Drift) { drifts = append(drifts, d) })
+	defer common.SetDriftHandler(nil)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{
+			"id": "chatcmpl-2",
+			"system_fingerprint": "fp_1",
+			"choices": [{"index": 0, "finish_reason": "paused", "message": {"role": "assistant", "content": "Paris", "annotations": []}}],
+			"usage": {"prompt_tokens": 4, "completion_tokens": 1, "total_tokens": 5}
+		}`))
+	}))
+	defer srv.Close()
+
+	client, err := NewOpenAIClient("gpt-4", common.WithAPIKey("test-api-key"), common.WithEndpoint(srv.URL))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	request := &models.LLMRequest{Model: "gpt-4", Contents: []models.Content{{Role: "user", Message: "Capital of France?"}}}
+	response, err := client.Call(context.Background(), request)
+	if err != nil {
+		t.Fatalf("Call failed: %v", err)
+	}
+	if response.Content.Message != "Paris" || response.IsError() {
+		t.Errorf("Expected the answer despite drift, got %+v", response)
+	}
+
+	reported := make(map[string]bool)
+	for _, d := range drifts {
+		reported[d.Field] = true
+	}
+	for _, field := range []string{"system_fingerprint", "choices.message.annotations", "choices.finish_reason"} {
+		if !reported[field] {
+			t.Errorf("Expected drift to be reported for %s, got %+v", field, drifts)
+		}
+	}
+}
+
+func TestTokenCounter(t *testing.T) {
+	contents := []models.Content{{Role: "user", Message: "hello world"}}
+
+	// 3 per message + "user" (1) + "hello world" (2) + 3 to prime the reply
+	n, err := TokenCounter{}.CountTokens("gpt-4", contents)
+	if err != nil || n != 9 {
+		t.Errorf("Expected 9 tokens, got %d, %v", n, err)
+	}
+
+	// Models tiktoken does not know use the newest encoding
+	if n, err := (TokenCounter{}).CountTokens("gpt-future", contents); err != nil || n != 9 {
+		t.Errorf("Expected 9 tokens with the default encoding, got %d, %v", n, err)
+	}
+
+	if err := models.Register("^counterprobe-gpt$", models.ModelInfo{Provider: models.ProviderOpenAI}); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := common.TokenCounterFor("counterprobe-gpt").(TokenCounter); !ok {
+		t.Error("Expected the tiktoken counter to be registered for OpenAI models")
+	}
+}
+
+func TestListModelsFollowsPages(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/models" {
+			t.Errorf("Expected the models endpoint, got %s", r.URL.Path)
+		}
+		if r.URL.Query().Get("after") == "" {
+			w.Write([]byte(`{"data": [{"id": "gpt-4o", "created": 1715367049}, {"id": "gpt-4o-mini"}], "has_more": true, "last_id": "gpt-4o-mini"}`))
+			return
+		}
+		w.Write([]byte(`{"data": [{"id": "o1"}]}`))
+	}))
+	defer srv.Close()
+
+	client, err := NewOpenAIClient("gpt-4", common.WithAPIKey("test-api-key"), common.WithEndpoint(srv.URL))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ids, err := client.(*OpenAIClient).ListModels(context.Background())
+	if err != nil {
+		t.Fatalf("ListModels() error = %v", err)
+	}
+	if want := []string{"gpt-4o", "gpt-4o-mini", "o1"}; !reflect.DeepEqual(ids, want) {
+		t.Errorf("ListModels() = %v, want %v", ids, want)
+	}
+
+	described, err := client.(*OpenAIClient).DescribeModels(context.Background())
+	if err != nil || len(described) != 3 || described[0].Created.Unix() != 1715367049 || !described[1].Created.IsZero() {
+		t.Errorf("Expected the creation dates the endpoint reports, got %+v, %v", described, err)
+	}
+}
+
+func TestPing(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/models" || r.URL.Query().Get("after") != "" {
+			t.Errorf("Expected the first page of the models endpoint, got %s", r.URL)
+		}
+		if r.Header.Get("Authorization") != "Bearer test-api-key" {
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write([]byte(`{"error": {"message": "Incorrect API key provided", "type": "invalid_request_error", "code": "invalid_api_key"}}`))
+			return
+		}
+		w.Write([]byte(`{"data": [{"id": "gpt-4o"}], "has_more": true, "last_id": "gpt-4o"}`))
+	}))
+	defer srv.Close()
+
+	for _, key := range []string{"test-api-key", "revoked-key"} {
+		client, err := NewOpenAIClient("gpt-4", common.WithAPIKey(key), common.WithEndpoint(srv.URL))
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = client.(common.Pinger).Ping(context.Background())
+		if key == "revoked-key" {
+			if !errors.Is(err, common.ErrAuth) {
+				t.Errorf("Expected an authentication error, got %v", err)
+			}
+		} else if err != nil {
+			t.Errorf("Ping() error = %v", err)
+		}
+	}
+}
+
+func TestCallTimeoutOverridesClientTimeout(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(time.Second):
+		}
+	}))
+	defer srv.Close()
+
+	client, _ := NewOpenAIClient("gpt-4", common.WithAPIKey("key"), common.WithEndpoint(srv.URL), common.WithTimeout(60),
+		common.WithRetryConfig(0, 0, 0, nil))
+	ctx := common.WithCallTimeout(context.Background(), 50*time.Millisecond)
+	start := time.Now()
+	_, err := client.Call(ctx, &models.LLMRequest{Model: "gpt-4", Contents: []models.Content{{Role: "user", Message: "hi"}}})
+	if err == nil || time.Since(start) > 500*time.Millisecond {
+		t.Errorf("Expected the per-call timeout to end the call, got %v after %v", err, time.Since(start))
+	}
+}
+
+func TestCallPropagatesTraceContext(t *testing.T) {
+	type traceKey struct{}
+	common.SetTracePropagator(func(ctx context.Context, header http.Header) {
+		if id, ok := ctx.Value(traceKey{}).(string); ok {
+			header.Set("traceparent", id)
+		}
+	})
+	defer common.SetTracePropagator(nil)
+
+	var traceparent string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		traceparent = r.Header.Get("traceparent")
+		w.Write([]byte(`{"choices": [{"message": {"role": "assistant", "content": "hi"}, "finish_reason": "stop"}]}`))
+	}))
+	defer srv.Close()
+
+	client, _ := NewOpenAIClient("gpt-4", common.WithAPIKey("key"), common.WithEndpoint(srv.URL))
+	ctx := context.WithValue(context.Background(), traceKey{}, "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01")
+	response, err := client.Call(ctx, &models.LLMRequest{Model: "gpt-4", Contents: []models.Content{{Role: "user", Message: "hi"}}})
+	if err != nil {
+		t.Fatalf("Call() error = %v", err)
+	}
+	if traceparent != "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01" {
+		t.Errorf("Expected the trace context in the request headers, got %q", traceparent)
+	}
+	if response.CustomMetadata[common.MetadataFinishReason] != "stop" {
+		t.Errorf("Expected the finish reason in CustomMetadata, got %v", response.CustomMetadata)
+	}
+}
+
+func TestCallServiceTier(t *testing.T) {
+	var tiers []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body chatCompletionRequest
+		json.NewDecoder(r.Body).Decode(&body)
+		tiers = append(tiers, body.ServiceTier)
+		w.Write([]byte(`{"service_tier": "flex", "choices": [{"message": {"role": "assistant", "content": "hi"}, "finish_reason": "stop"}]}`))
+	}))
+	defer srv.Close()
+
+	client, _ := NewOpenAIClient("gpt-4", common.WithAPIKey("key"), common.WithEndpoint(srv.URL), common.WithServiceTier(models.ServiceTierPriority))
+	request := &models.LLMRequest{Model: "gpt-4", Contents: []models.Content{{Role: "user", Message: "hi"}}}
+	response, err := client.Call(context.Background(), request)
+	if err != nil {
+		t.Fatalf("Call() error = %v", err)
+	}
+	if response.CustomMetadata[common.MetadataServiceTier] != "flex" {
+		t.Errorf("Expected the serving tier in CustomMetadata, got %v", response.CustomMetadata)
+	}
+
+	request.Config = &models.GenerateContentConfig{ServiceTier: models.ServiceTierFlex}
+	if _, err := client.Call(context.Background(), request); err != nil {
+		t.Fatalf("Call() error = %v", err)
+	}
+	if want := []string{models.ServiceTierPriority, models.ServiceTierFlex}; !reflect.DeepEqual(tiers, want) {
+		t.Errorf("Sent service tiers %v, want %v", tiers, want)
+	}
+}
@@ -0,0 +1,169 @@
+package openai
+
+import (
+	"encoding/json"
+
+	"github.com/nexen/models"
+)
+
+// chatCompletionRequest is the request body for OpenAI's chat completions endpoint.
+type chatCompletionRequest struct {
+	Model       string        `json:"model"`
+	Messages    []chatMessage `json:"messages"`
+	Tools       []chatTool    `json:"tools,omitempty"`
+	ToolChoice  any           `json:"tool_choice,omitempty"`
+	Temperature float64       `json:"temperature,omitempty"`
+	TopP        float64       `json:"top_p,omitempty"`
+	MaxTokens   int           `json:"max_tokens,omitempty"`
+	Stop        []string      `json:"stop,omitempty"`
+	Logprobs    bool          `json:"logprobs,omitempty"`
+	TopLogprobs int           `json:"top_logprobs,omitempty"`
+	User        string        `json:"user,omitempty"`
+	ServiceTier string        `json:"service_tier,omitempty"`
+
+	ResponseFormat *chatResponseFormat `json:"response_format,omitempty"`
+
+	Stream        bool               `json:"stream,omitempty"`
+	StreamOptions *chatStreamOptions `json:"stream_options,omitempty"`
+}
+
+// chatStreamOptions asks for the usage of a streamed completion in its last chunk.
+type chatStreamOptions struct {
+	IncludeUsage bool `json:"include_usage"`
+}
+
+// chatResponseFormat selects JSON mode ("json_object") or schema-constrained output ("json_schema").
+type chatResponseFormat struct {
+	Type       string          `json:"type"`
+	JSONSchema *chatJSONSchema `json:"json_schema,omitempty"`
+}
+
+// chatJSONSchema names the schema the response must follow.
+type chatJSONSchema struct {
+	Name   string             `json:"name"`
+	Schema *models.JSONSchema `json:"schema"`
+}
+
+// chatMessage is a single message in a chat completions request or response.
+type chatMessage struct {
+	Role       string         `json:"role"`
+	Content    string         `json:"content"`
+	ToolCalls  []chatToolCall `json:"tool_calls,omitempty"`
+	ToolCallID string         `json:"tool_call_id,omitempty"`
+}
+
+// chatTool declares a function the model may call.
+type chatTool struct {
+	Type     string          `json:"type"`
+	Function json.RawMessage `json:"function"`
+}
+
+// chatToolCall is a function call made by the model.
+type chatToolCall struct {
+	ID       string           `json:"id"`
+	Type     string           `json:"type"`
+	Function chatFunctionCall `json:"function"`
+}
+
+// chatFunctionCall holds the function name and JSON-encoded arguments of a tool call.
+type chatFunctionCall struct {
+	Name      string `json:"name"`
+	Arguments string `json:"arguments"`
+}
+
+// chatCompletionResponse is the response body from the chat completions endpoint.
+type chatCompletionResponse struct {
+	ID          string       `json:"id"`
+	Model       string       `json:"model"`
+	Choices     []chatChoice `json:"choices"`
+	Usage       chatUsage    `json:"usage"`
+	ServiceTier string       `json:"service_tier"`
+}
+
+// chatCompletionChunk is an event of a streamed chat completion. Usage is only set in the
+// last chunk, whose choices are empty; Error is set when the stream fails.
+type chatCompletionChunk struct {
+	ID          string            `json:"id"`
+	Model       string            `json:"model"`
+	Choices     []chatChunkChoice `json:"choices"`
+	Usage       *chatUsage        `json:"usage"`
+	ServiceTier string            `json:"service_tier"`
+	Error       *struct {
+		Message string `json:"message"`
+		Type    string `json:"type"`
+	} `json:"error"`
+}
+
+// chatChunkChoice is the part of a completion choice in a chunk.
+type chatChunkChoice struct {
+	Index        int           `json:"index"`
+	Delta        chatDelta     `json:"delta"`
+	FinishReason string        `json:"finish_reason"`
+	Logprobs     *chatLogprobs `json:"logprobs"`
+}
+
+// chatDelta is the part of the message in a chunk. The arguments of a tool call are spread
+// over the chunks, which identify the call by its index.
+type chatDelta struct {
+	Role      string `json:"role"`
+	Content   string `json:"content"`
+	ToolCalls []struct {
+		Index    int              `json:"index"`
+		ID       string           `json:"id"`
+		Type     string           `json:"type"`
+		Function chatFunctionCall `json:"function"`
+	} `json:"tool_calls"`
+}
+
+// chatChoice is a single completion choice.
+type chatChoice struct {
+	Index        int           `json:"index"`
+	Message      chatMessage   `json:"message"`
+	FinishReason string        `json:"finish_reason"`
+	Logprobs     *chatLogprobs `json:"logprobs"`
+}
+
+// chatUsage reports token usage for a completion.
+type chatUsage struct {
+	PromptTokens        int                `json:"prompt_tokens"`
+	CompletionTokens    int                `json:"completion_tokens"`
+	TotalTokens         int                `json:"total_tokens"`
+	PromptTokensDetails chatPromptTokenUse `json:"prompt_tokens_details"`
+}
+
+// chatPromptTokenUse breaks down prompt tokens.
+type chatPromptTokenUse struct {
+	CachedTokens int `json:"cached_tokens"`
+}
+
+// chatLogprobs holds per-token log probabilities for the message content.
+type chatLogprobs struct {
+	Content []chatTokenLogprob `json:"content"`
+}
+
+// chatTokenLogprob is the log probability of one output token and its top alternatives.
+type chatTokenLogprob struct {
+	Token       string             `json:"token"`
+	Logprob     float64            `json:"logprob"`
+	TopLogprobs []chatTokenLogprob `json:"top_logprobs,omitempty"`
+}
+
+// modelList is a page of the models endpoint. OpenAI returns every model in one page today;
+// HasMore and LastID follow its cursor convention for paginated lists.
+type modelList struct {
+	Data []struct {
+		ID      string `json:"id"`
+		Created int64  `json:"created"`
+	} `json:"data"`
+	HasMore bool   `json:"has_more"`
+	LastID  string `json:"last_id"`
+}
+
+// errorResponse is the body OpenAI returns with a non-200 status.
+type errorResponse struct {
+	Error struct {
+		Message string `json:"message"`
+		Type    string `json:"type"`
+		Code    any    `json:"code"` // string or null
+	} `json:"error"`
+}
@@ -0,0 +1,158 @@
+package openai
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/nexen/models"
+	"github.com/nexen/services/connectors/common"
+)
+
+// CallStream implements common.Streamer with streamed chat completions. Each content delta
+// is sent as a partial response; tool calls, logprobs and usage are only in the final one.
+func (c *OpenAIClient) CallStream(ctx context.Context, request *models.LLMRequest, yield func(*models.LLMResponse) error) error {
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	if err := request.Validate(); err != nil {
+		return fmt.Errorf("invalid request: %w", err)
+	}
+	ctx, cancel := common.CallContext(ctx, request, c.config)
+	defer cancel()
+
+	payload := newChatCompletionRequest(c.modelName, request)
+	payload.ServiceTier = common.RequestServiceTier(c.config, request)
+	payload.Stream = true
+	payload.StreamOptions = &chatStreamOptions{IncludeUsage: true}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("encoding OpenAI request: %w", err)
+	}
+
+	estimatedTokens := common.EstimateTokens(request)
+	if err := c.limiter.Wait(ctx, estimatedTokens); err != nil {
+		return err
+	}
+
+	// Streams are opened in the first available region and, when they break before the first
+	// event, reopened as Call retries; OpenAI streams cannot be resumed after it
+	start := time.Now()
+	var completion chatStream
+	partial := true
+	config := common.StreamConfig{MaxRepairs: c.config.RetryConfig.MaxRetries, Retry: c.config.RetryConfig}
+	open := func(ctx context.Context, _ string) (stream io.ReadCloser, err error) {
+		err = c.regions.Do(ctx, func(ctx context.Context, endpoint string) error {
+			stream, err = c.openChatCompletionStream(ctx, endpoint, body)
+			return err
+		})
+		return stream, err
+	}
+	err = common.ReadStream(ctx, config, open, func(event common.SSEEvent) error {
+		if event.Data == "[DONE]" {
+			return nil
+		}
+		var chunk chatCompletionChunk
+		if err := json.Unmarshal([]byte(event.Data), &chunk); err != nil {
+			return fmt.Errorf("%w: %v", common.ErrMalformedFrame, err)
+		}
+		if chunk.Error != nil {
+			return common.NewProviderError(models.ProviderOpenAI, http.StatusInternalServerError, chunk.Error.Type, chunk.Error.Message)
+		}
+		if delta := completion.add(&chunk); delta != "" {
+			return yield(&models.LLMResponse{Partial: &partial, Content: &models.Content{Role: "assistant", Message: delta}})
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	response := chatResponseToLLMResponse(&completion.response)
+	c.limiter.Adjust(response.Usage.TotalTokens - estimatedTokens)
+	common.DefaultTokenCalibrator.ObserveRequest(request, response.Usage.PromptTokens)
+	response.Usage.LatencyMs = float64(time.Since(start).Milliseconds())
+	return yield(response)
+}
+
+// openChatCompletionStream sends one streamed chat completions request to endpoint and
+// returns its event stream.
+func (c *OpenAIClient) openChatCompletionStream(ctx context.Context, endpoint string, body []byte) (io.ReadCloser, error) {
+	httpReq, err := c.newChatCompletionHTTPRequest(ctx, endpoint, body)
+	if err != nil {
+		return nil, err
+	}
+	httpReq.Header.Set("Accept", "text/event-stream")
+
+	httpResp, err := c.httpClient.Do(httpReq)
+	if err != nil {
+		return nil, common.TransportError(models.ProviderOpenAI, err)
+	}
+	if httpResp.StatusCode != http.StatusOK {
+		defer httpResp.Body.Close()
+		respBody, err := io.ReadAll(httpResp.Body)
+		if err != nil {
+			return nil, common.TransportError(models.ProviderOpenAI, err)
+		}
+		return nil, newAPIError(httpResp, respBody)
+	}
+	return httpResp.Body, nil
+}
+
+// chatStream accumulates the chunks of a streamed completion into the response Call would
+// have received.
+type chatStream struct {
+	response chatCompletionResponse
+}
+
+// add adds chunk to the completion and returns the content it adds to the first choice.
+func (s *chatStream) add(chunk *chatCompletionChunk) string {
+	if chunk.ID != "" {
+		s.response.ID, s.response.Model = chunk.ID, chunk.Model
+	}
+	if chunk.ServiceTier != "" {
+		s.response.ServiceTier = chunk.ServiceTier
+	}
+	if chunk.Usage != nil {
+		s.response.Usage = *chunk.Usage
+	}
+	var delta string
+	for _, part := range chunk.Choices {
+		if part.Index != 0 {
+			continue // Only the first choice is returned, as by Call
+		}
+		if len(s.response.Choices) == 0 {
+			s.response.Choices = []chatChoice{{Message: chatMessage{Role: "assistant"}}}
+		}
+		choice := &s.response.Choices[0]
+		choice.Message.Content += part.Delta.Content
+		delta += part.Delta.Content
+		for _, call := range part.Delta.ToolCalls {
+			if call.Index < 0 || call.Index > len(choice.Message.ToolCalls) {
+				continue // Calls are numbered in order
+			}
+			if call.Index == len(choice.Message.ToolCalls) {
+				choice.Message.ToolCalls = append(choice.Message.ToolCalls, chatToolCall{Type: "function"})
+			}
+			toolCall := &choice.Message.ToolCalls[call.Index]
+			if call.ID != "" {
+				toolCall.ID = call.ID
+			}
+			toolCall.Function.Name += call.Function.Name
+			toolCall.Function.Arguments += call.Function.Arguments
+		}
+		if part.FinishReason != "" {
+			choice.FinishReason = part.FinishReason
+		}
+		if part.Logprobs != nil {
+			if choice.Logprobs == nil {
+				choice.Logprobs = &chatLogprobs{}
+			}
+			choice.Logprobs.Content = append(choice.Logprobs.Content, part.Logprobs.Content...)
+		}
+	}
+	return delta
+}
@@ -0,0 +1,97 @@
+package openai
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/nexen/models"
+	"github.com/nexen/services/connectors/common"
+)
+
+func TestCallStream(t *testing.T) {
+	var received chatCompletionRequest
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&received)
+		w.Header().Set("Content-Type", "text/event-stream")
+		for _, chunk := range []string{
+			`{"id":"chatcmpl-1","choices":[{"index":0,"delta":{"role":"assistant","content":""}}]}`,
+			`{"id":"chatcmpl-1","choices":[{"index":0,"delta":{"content":"Let me "}}]}`,
+			`{"id":"chatcmpl-1","choices":[{"index":0,"delta":{"content":"check."}}]}`,
+			`{"id":"chatcmpl-1","choices":[{"index":0,"delta":{"tool_calls":[{"index":0,"id":"call_1","type":"function","function":{"name":"get_weather","arguments":"{\"ci"}}]}}]}`,
+			`{"id":"chatcmpl-1","choices":[{"index":0,"delta":{"tool_calls":[{"index":0,"function":{"arguments":"ty\":\"Paris\"}"}}]}}]}`,
+			`{"id":"chatcmpl-1","choices":[{"index":0,"delta":{},"finish_reason":"tool_calls"}]}`,
+			`{"id":"chatcmpl-1","choices":[],"usage":{"prompt_tokens":12,"completion_tokens":3,"total_tokens":15}}`,
+			`[DONE]`,
+		} {
+			fmt.Fprintf(w, "data: %s\n\n", chunk)
+		}
+	}))
+	defer srv.Close()
+
+	client, err := NewOpenAIClient("gpt-4", common.WithAPIKey("key"), common.WithEndpoint(srv.URL))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var responses []*models.LLMResponse
+	err = client.(common.Streamer).CallStream(context.Background(), &models.LLMRequest{
+		Model:    "gpt-4",
+		Contents: []models.Content{{Role: "user", Message: "Weather in Paris?"}},
+	}, func(response *models.LLMResponse) error {
+		responses = append(responses, response)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("CallStream failed: %v", err)
+	}
+
+	if !received.Stream || received.StreamOptions == nil || !received.StreamOptions.IncludeUsage {
+		t.Errorf("Expected a streamed request with usage, got %+v", received)
+	}
+	if len(responses) != 3 || !responses[0].IsPartial() || responses[0].Content.Message != "Let me " || responses[1].Content.Message != "check." {
+		t.Fatalf("Expected two partial responses and a final one, got %+v", responses)
+	}
+	final := responses[2]
+	if final.IsPartial() || final.Content.Message != "Let me check." || final.Usage.TotalTokens != 15 {
+		t.Errorf("Unexpected final response %+v", final)
+	}
+	calls := final.Content.FunctionCalls()
+	if len(calls) != 1 || calls[0].ID != "call_1" || calls[0].Args["city"] != "Paris" {
+		t.Errorf("Unexpected function calls %+v", calls)
+	}
+}
+
+func TestCallStreamErrors(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, `{"error":{"message":"slow down","type":"requests"}}`, http.StatusTooManyRequests)
+	}))
+	defer srv.Close()
+
+	client, _ := NewOpenAIClient("gpt-4", common.WithAPIKey("key"), common.WithEndpoint(srv.URL),
+		common.WithRetryConfig(0, 0, 0, nil))
+	err := client.(common.Streamer).CallStream(context.Background(), &models.LLMRequest{
+		Model:    "gpt-4",
+		Contents: []models.Content{{Role: "user", Message: "Hello"}},
+	}, func(*models.LLMResponse) error { return nil })
+	if !errors.Is(err, common.ErrRateLimited) {
+		t.Errorf("Expected a rate limit error, got %v", err)
+	}
+
+	// A failing caller stops the stream
+	stop := errors.New("client gone")
+	srv.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, strings.Repeat(`data: {"choices":[{"index":0,"delta":{"content":"x"}}]}`+"\n\n", 3))
+	})
+	err = client.(common.Streamer).CallStream(context.Background(), &models.LLMRequest{
+		Model:    "gpt-4",
+		Contents: []models.Content{{Role: "user", Message: "Hello"}},
+	}, func(*models.LLMResponse) error { return stop })
+	if !errors.Is(err, stop) {
+		t.Errorf("Expected the caller's error, got %v", err)
+	}
+}
@@ -0,0 +1,77 @@
+package openai
+
+import (
+	"sync"
+
+	"github.com/pkoukk/tiktoken-go"
+	tiktoken_loader "github.com/pkoukk/tiktoken-go-loader"
+
+	"github.com/nexen/models"
+	"github.com/nexen/services/connectors/common"
+)
+
+const (
+	// tokensPerMessage is the formatting overhead of each chat message.
+	tokensPerMessage = 3
+
+	// replyPrimingTokens starts every reply with <|start|>assistant<|message|>.
+	replyPrimingTokens = 3
+
+	// defaultEncoding is used for models tiktoken does not know, such as newer releases.
+	defaultEncoding = "o200k_base"
+)
+
+func init() {
+	// Use the encodings embedded in the binary instead of downloading them on first use
+	tiktoken.SetBpeLoader(tiktoken_loader.NewOfflineLoader())
+	common.RegisterTokenCounter(models.ProviderOpenAI, TokenCounter{})
+}
+
+var (
+	encodingsMu sync.Mutex
+	encodings   = make(map[string]*tiktoken.Tiktoken)
+)
+
+// encodingFor returns the tiktoken encoding of model, building each encoding once.
+func encodingFor(model string) (*tiktoken.Tiktoken, error) {
+	encodingsMu.Lock()
+	defer encodingsMu.Unlock()
+	if enc, ok := encodings[model]; ok {
+		return enc, nil
+	}
+	enc, err := tiktoken.EncodingForModel(model)
+	if err != nil {
+		if enc, err = tiktoken.GetEncoding(defaultEncoding); err != nil {
+			return nil, err
+		}
+	}
+	encodings[model] = enc
+	return enc, nil
+}
+
+// TokenCounter counts chat tokens exactly with OpenAI's tiktoken encodings, including the
+// per-message formatting overhead. It is registered as the OpenAI common.TokenCounter.
+type TokenCounter struct{}
+
+var _ common.TokenCounter = TokenCounter{}
+
+// CountTokens implements common.TokenCounter.
+func (TokenCounter) CountTokens(model string, contents []models.Content) (int, error) {
+	enc, err := encodingFor(model)
+	if err != nil {
+		return 0, err
+	}
+	count := func(text string) int {
+		return len(enc.EncodeOrdinary(text))
+	}
+
+	request := newChatCompletionRequest(model, &models.LLMRequest{Model: model, Contents: contents})
+	tokens := replyPrimingTokens
+	for _, message := range request.Messages {
+		tokens += tokensPerMessage + count(message.Role) + count(message.Content)
+		for _, call := range message.ToolCalls {
+			tokens += count(call.Function.Name) + count(call.Function.Arguments)
+		}
+	}
+	return tokens, nil
+}
@@ -0,0 +1,124 @@
+package openai
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/nexen/models"
+)
+
+// ExportConversation encodes a conversation as an OpenAI chat messages array. The system
+// instruction, if any, becomes the first message; function calls and results become
+// tool_calls and "tool" messages.
+func ExportConversation(contents []models.Content, systemInstruction string) ([]byte, error) {
+	request := &models.LLMRequest{Contents: contents}
+	if systemInstruction != "" {
+		request.Config = &models.GenerateContentConfig{SystemInstruction: systemInstruction}
+	}
+	return json.Marshal(newChatCompletionRequest("", request).Messages)
+}
+
+// transcriptMessage is a chat message as found in OpenAI transcripts, whose content may be
+// a string or an array of content parts.
+type transcriptMessage struct {
+	Role       string          `json:"role"`
+	Content    json.RawMessage `json:"content"`
+	ToolCalls  []chatToolCall  `json:"tool_calls"`
+	ToolCallID string          `json:"tool_call_id"`
+	Name       string          `json:"name"`
+}
+
+// ImportConversation decodes an OpenAI chat messages array, or a chat completions request
+// body holding one, into contents and the system instruction. System and developer messages
+// are joined into the system instruction; consecutive tool messages become one "tool"
+// content of function responses.
+func ImportConversation(data []byte) ([]models.Content, string, error) {
+	var messages []transcriptMessage
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '{' {
+		var body struct {
+			Messages []transcriptMessage `json:"messages"`
+		}
+		if err := json.Unmarshal(data, &body); err != nil {
+			return nil, "", fmt.Errorf("decoding OpenAI conversation: %w", err)
+		}
+		messages = body.Messages
+	} else if err := json.Unmarshal(data, &messages); err != nil {
+		return nil, "", fmt.Errorf("decoding OpenAI conversation: %w", err)
+	}
+
+	var contents []models.Content
+	var system []string
+	callNames := make(map[string]string)
+	for i, message := range messages {
+		text, err := messageText(message.Content)
+		if err != nil {
+			return nil, "", fmt.Errorf("message %d: %w", i, err)
+		}
+
+		switch message.Role {
+		case "system", "developer":
+			system = append(system, text)
+		case "tool", "function":
+			name := callNames[message.ToolCallID]
+			if name == "" {
+				name = message.Name
+			}
+			part := models.NewFunctionResponsePart(models.FunctionResponse{ID: message.ToolCallID, Name: name, Response: text})
+			if n := len(contents); n > 0 && contents[n-1].Role == "tool" {
+				contents[n-1].Parts = append(contents[n-1].Parts, part)
+			} else {
+				contents = append(contents, models.Content{Role: "tool", Parts: []any{part}})
+			}
+		case "user", "assistant":
+			content := models.Content{Role: message.Role, Message: text}
+			if len(message.ToolCalls) > 0 {
+				if text != "" {
+					content.Parts = append(content.Parts, text)
+				}
+				for _, call := range message.ToolCalls {
+					var args map[string]any
+					if call.Function.Arguments != "" {
+						if err := json.Unmarshal([]byte(call.Function.Arguments), &args); err != nil {
+							return nil, "", fmt.Errorf("message %d: arguments of %s: %w", i, call.Function.Name, err)
+						}
+					}
+					callNames[call.ID] = call.Function.Name
+					content.Parts = append(content.Parts, models.NewFunctionCallPart(models.FunctionCall{ID: call.ID, Name: call.Function.Name, Args: args}))
+				}
+			}
+			contents = append(contents, content)
+		default:
+			return nil, "", fmt.Errorf("message %d: unknown role %q", i, message.Role)
+		}
+	}
+	return contents, strings.Join(system, "\n\n"), nil
+}
+
+// messageText returns the text of message content given as a string, null, or an array of
+// content parts. Non-text parts such as images are not supported.
+func messageText(raw json.RawMessage) (string, error) {
+	if len(raw) == 0 || string(raw) == "null" {
+		return "", nil
+	}
+	var text string
+	if err := json.Unmarshal(raw, &text); err == nil {
+		return text, nil
+	}
+	var parts []struct {
+		Type string `json:"type"`
+		Text string `json:"text"`
+	}
+	if err := json.Unmarshal(raw, &parts); err != nil {
+		return "", fmt.Errorf("content is neither text nor content parts")
+	}
+	var sb strings.Builder
+	for _, part := range parts {
+		if part.Type != "text" {
+			return "", fmt.Errorf("content part type %q is not supported", part.Type)
+		}
+		sb.WriteString(part.Text)
+	}
+	return sb.String(), nil
+}
@@ -0,0 +1,63 @@
+package openai
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/nexen/models"
+)
+
+func weatherConversation() []models.Content {
+	return []models.Content{
+		{Role: "user", Message: "What's the weather in Paris?"},
+		{Role: "assistant", Parts: []any{models.NewFunctionCallPart(models.FunctionCall{ID: "call_1", Name: "get_weather", Args: map[string]any{"city": "Paris"}})}},
+		{Role: "tool", Parts: []any{models.NewFunctionResponsePart(models.FunctionResponse{ID: "call_1", Name: "get_weather", Response: "sunny"})}},
+		{Role: "assistant", Message: "It's sunny."},
+	}
+}
+
+func TestConversationRoundTrip(t *testing.T) {
+	data, err := ExportConversation(weatherConversation(), "Be brief.")
+	if err != nil {
+		t.Fatalf("ExportConversation failed: %v", err)
+	}
+	contents, system, err := ImportConversation(data)
+	if err != nil {
+		t.Fatalf("ImportConversation failed: %v", err)
+	}
+	if system != "Be brief." {
+		t.Errorf("Expected system instruction, got %q", system)
+	}
+	if !reflect.DeepEqual(contents, weatherConversation()) {
+		t.Errorf("Round trip changed the conversation:\n got %#v\nwant %#v\nJSON %s", contents, weatherConversation(), data)
+	}
+}
+
+func TestImportOpenAIConversation(t *testing.T) {
+	data := `{"model":"gpt-4o","messages":[
+		{"role":"developer","content":"Be brief."},
+		{"role":"user","content":[{"type":"text","text":"Weather in "},{"type":"text","text":"Paris and Rome?"}]},
+		{"role":"assistant","content":null,"tool_calls":[
+			{"id":"call_1","type":"function","function":{"name":"get_weather","arguments":"{\"city\":\"Paris\"}"}},
+			{"id":"call_2","type":"function","function":{"name":"get_weather","arguments":"{\"city\":\"Rome\"}"}}]},
+		{"role":"tool","tool_call_id":"call_1","content":"sunny"},
+		{"role":"tool","tool_call_id":"call_2","content":"rainy"}]}`
+
+	contents, system, err := ImportConversation([]byte(data))
+	if err != nil {
+		t.Fatalf("ImportConversation failed: %v", err)
+	}
+	if system != "Be brief." || len(contents) != 3 {
+		t.Fatalf("Unexpected import: %q, %#v", system, contents)
+	}
+	if contents[0].Message != "Weather in Paris and Rome?" || len(contents[1].FunctionCalls()) != 2 {
+		t.Errorf("Unexpected messages %#v", contents[:2])
+	}
+	if contents[2].Role != "tool" || len(contents[2].Parts) != 2 {
+		t.Errorf("Expected consecutive tool messages to be grouped, got %#v", contents[2])
+	}
+
+	if _, _, err := ImportConversation([]byte(`[{"role":"user","content":[{"type":"image_url"}]}]`)); err == nil {
+		t.Error("Expected an error for unsupported content parts")
+	}
+}
@@ -0,0 +1,81 @@
+// Package parallel runs fan-out work with bounded concurrency and collects a result per item,
+// so that one failure does not lose the others' results.
+//
+//	results := parallel.Map(ctx, prompts, 4, func(ctx context.Context, i int, prompt string) (string, error) {
+//		return complete(ctx, prompt)
+//	})
+//	if failed := parallel.Failed(results); failed != nil {
+//		// Some prompts failed; the other results are still usable
+//	}
+package parallel
+
+import (
+	"context"
+	"sync"
+)
+
+// Result is the outcome of one item.
+type Result[T any] struct {
+	// Value is fn's result, the zero value if it failed.
+	Value T
+
+	// Err is fn's error, if any.
+	Err error
+}
+
+// Map calls fn for every item with at most limit calls running at once, and returns one
+// Result per item, in item order. A limit of 0 or less runs every item at once. A failed
+// item does not stop the others. Once ctx is done, items that have not started fail with
+// ctx's error.
+func Map[I, O any](ctx context.Context, items []I, limit int, fn func(ctx context.Context, i int, item I) (O, error)) []Result[O] {
+	results := make([]Result[O], len(items))
+	if limit <= 0 || limit > len(items) {
+		limit = len(items)
+	}
+
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < limit; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				if err := ctx.Err(); err != nil {
+					results[i].Err = err
+					continue
+				}
+				results[i].Value, results[i].Err = fn(ctx, i, items[i])
+			}
+		}()
+	}
+	for i := range items {
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
+
+	return results
+}
+
+// Values returns the values of results, the zero value where an item failed.
+func Values[T any](results []Result[T]) []T {
+	values := make([]T, len(results))
+	for i, result := range results {
+		values[i] = result.Value
+	}
+	return values
+}
+
+// Failed maps the index of every failed item to its error, or returns nil when none failed.
+func Failed[T any](results []Result[T]) map[int]error {
+	var failed map[int]error
+	for i, result := range results {
+		if result.Err != nil {
+			if failed == nil {
+				failed = make(map[int]error)
+			}
+			failed[i] = result.Err
+		}
+	}
+	return failed
+}
@@ -0,0 +1,51 @@
+package parallel
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+)
+
+func TestMap(t *testing.T) {
+	var running, peak atomic.Int32
+	boom := errors.New("boom")
+	results := Map(context.Background(), []int{1, 2, 3, 4, 5, 6}, 2, func(ctx context.Context, i int, item int) (int, error) {
+		n := running.Add(1)
+		defer running.Add(-1)
+		for {
+			p := peak.Load()
+			if n <= p || peak.CompareAndSwap(p, n) {
+				break
+			}
+		}
+		if item == 3 {
+			return 0, boom
+		}
+		return item * 10, nil
+	})
+
+	if peak.Load() > 2 {
+		t.Errorf("Expected at most 2 concurrent calls, got %d", peak.Load())
+	}
+	values := Values(results)
+	for i, want := range []int{10, 20, 0, 40, 50, 60} {
+		if values[i] != want {
+			t.Errorf("Values()[%d] = %d, want %d", i, values[i], want)
+		}
+	}
+	if failed := Failed(results); len(failed) != 1 || !errors.Is(failed[2], boom) {
+		t.Errorf("Failed() = %v, want item 2 to fail", failed)
+	}
+}
+
+func TestMapCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	results := Map(ctx, []string{"a", "b"}, 0, func(ctx context.Context, i int, item string) (string, error) {
+		return item, nil
+	})
+	if failed := Failed(results); len(failed) != 2 || !errors.Is(failed[0], context.Canceled) {
+		t.Errorf("Expected every item to fail with the context's error, got %v", failed)
+	}
+}
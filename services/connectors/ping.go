@@ -0,0 +1,81 @@
+package connectors
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/nexen/models"
+	"github.com/nexen/services/connectors/common"
+)
+
+// ErrPingNotSupported is returned by PingProvider for providers whose connector implements
+// neither common.Pinger nor common.ModelLister.
+var ErrPingNotSupported = errors.New("connector does not support ping")
+
+// PingProvider checks that provider can be reached with its credentials, using a client of its
+// first registered model that has a constructor, created with opts and the provider's settings
+// like NewLLM. Clients implementing common.Pinger are pinged; others that can list models do
+// so instead, which is as cheap.
+func PingProvider(ctx context.Context, provider string, opts ...Option) error {
+	local, err := providerModels(provider)
+	if err != nil {
+		return err
+	}
+	llm, err := providerClient(provider, local, opts)
+	if err != nil {
+		return err
+	}
+	switch c := llm.(type) {
+	case common.Pinger:
+		err = c.Ping(ctx)
+	case common.ModelLister:
+		_, err = c.ListModels(ctx)
+	default:
+		return fmt.Errorf("provider %s: %w", provider, ErrPingNotSupported)
+	}
+	if err != nil {
+		return fmt.Errorf("pinging %s: %w", provider, err)
+	}
+	return nil
+}
+
+// MonitorProviders pings every provider of the registry with PingProvider, then again each
+// interval until ctx is done, and records the results in tracker with ObservePing. Routing then
+// avoids the models of a provider refusing its credentials or out of reach before their calls
+// fail. The providers are pinged at once, each for at most interval.
+func MonitorProviders(ctx context.Context, tracker *HealthTracker, interval time.Duration, opts ...Option) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		pingProviders(ctx, tracker, interval, opts)
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// pingProviders pings every provider of the registry for at most timeout and records the
+// results in tracker.
+func pingProviders(ctx context.Context, tracker *HealthTracker, timeout time.Duration, opts []Option) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	seen := make(map[string]bool)
+	var wg sync.WaitGroup
+	for _, info := range models.ListModelInfos() {
+		if seen[info.Provider] {
+			continue
+		}
+		seen[info.Provider] = true
+		wg.Add(1)
+		go func(provider string) {
+			defer wg.Done()
+			tracker.ObservePing(provider, PingProvider(ctx, provider, opts...))
+		}(info.Provider)
+	}
+	wg.Wait()
+}
@@ -0,0 +1,92 @@
+package connectors
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/nexen/models"
+	"github.com/nexen/services/connectors/common"
+)
+
+// pingingLLM is a mockLLM whose provider answers pings with err.
+type pingingLLM struct {
+	mockLLM
+	err error
+}
+
+func (p *pingingLLM) Ping(ctx context.Context) error {
+	return p.err
+}
+
+func TestPingProvider(t *testing.T) {
+	down := errors.New("connection refused")
+	clients := map[string]common.LLM{
+		"pingprobe-up":   &pingingLLM{},
+		"pingprobe-down": &pingingLLM{err: down},
+		"pingprobe-list": &listingLLM{},
+		"pingprobe-none": &mockLLM{},
+	}
+	for id, llm := range clients {
+		llm := llm
+		if err := models.Register("^"+id+"$", models.ModelInfo{ID: id, Provider: id}); err != nil {
+			t.Fatal(err)
+		}
+		Register("^"+id+"$", func(model string, opts ...common.Option) (common.LLM, error) {
+			return llm, nil
+		})
+	}
+
+	if err := PingProvider(context.Background(), "pingprobe-up"); err != nil {
+		t.Errorf("Expected a reachable provider, got %v", err)
+	}
+	if err := PingProvider(context.Background(), "pingprobe-down"); !errors.Is(err, down) {
+		t.Errorf("Expected the ping's error, got %v", err)
+	}
+	if err := PingProvider(context.Background(), "pingprobe-list"); err != nil {
+		t.Errorf("Expected a provider that lists models to be pinged by listing, got %v", err)
+	}
+	if err := PingProvider(context.Background(), "pingprobe-none"); !errors.Is(err, ErrPingNotSupported) {
+		t.Errorf("Expected ErrPingNotSupported, got %v", err)
+	}
+	if err := PingProvider(context.Background(), "unknownprobe"); err == nil {
+		t.Error("Expected an error for a provider without registered models")
+	}
+}
+
+func TestMonitorProviders(t *testing.T) {
+	for id, llm := range map[string]common.LLM{
+		"monitorprobe-up":   &pingingLLM{},
+		"monitorprobe-down": &pingingLLM{err: errors.New("connection refused")},
+	} {
+		llm := llm
+		if err := models.Register("^"+id+"$", models.ModelInfo{ID: id, Provider: id}); err != nil {
+			t.Fatal(err)
+		}
+		Register("^"+id+"$", func(model string, opts ...common.Option) (common.LLM, error) {
+			return llm, nil
+		})
+	}
+
+	h := NewHealthTracker(HealthOptions{})
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan struct{})
+	go func() {
+		MonitorProviders(ctx, h, time.Hour)
+		close(stopped)
+	}()
+	deadline := time.Now().Add(5 * time.Second)
+	for h.Healthy("monitorprobe-down") && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	cancel()
+	<-stopped
+
+	if stats, _ := h.Stats("monitorprobe-down"); stats.Healthy || stats.PingError == "" {
+		t.Errorf("Expected the unreachable provider's model to be unhealthy, got %+v", stats)
+	}
+	if !h.Healthy("monitorprobe-up") {
+		t.Error("Expected the reachable provider's model to stay healthy")
+	}
+}
@@ -0,0 +1,98 @@
+// Package policy injects organization-wide instructions into every request.
+//
+// A Policy holds a system preamble, such as compliance text or persona constraints, that is
+// placed before each request's own system instruction. Tenants can have their own preamble
+// in place of the organization's. The instruction that was actually sent is recorded in the
+// response's CustomMetadata so transcripts show what the model was told.
+package policy
+
+import (
+	"context"
+
+	"github.com/nexen/libs/nexenctx"
+	"github.com/nexen/models"
+	"github.com/nexen/services/connectors/common"
+)
+
+// MetadataKey is the CustomMetadata key holding the merged system instruction that was sent.
+const MetadataKey = "system_instruction"
+
+// Policy describes the system preamble to inject.
+type Policy struct {
+	// Preamble is the organization-wide text placed before every system instruction.
+	Preamble string
+
+	// TenantPreambles replaces Preamble for the listed tenants. The tenant is taken from the
+	// request's Metadata, or from the context (see nexenctx.WithTenant) when it names none.
+	TenantPreambles map[string]string
+}
+
+// PreambleFor returns the preamble that applies to requests made with ctx.
+func (p Policy) PreambleFor(ctx context.Context) string {
+	if tenant, ok := nexenctx.TenantFrom(ctx); ok {
+		return p.tenantPreamble(tenant)
+	}
+	return p.Preamble
+}
+
+// tenantPreamble returns the preamble of tenant, or the organization's when it has none.
+func (p Policy) tenantPreamble(tenant string) string {
+	if preamble, ok := p.TenantPreambles[tenant]; ok {
+		return preamble
+	}
+	return p.Preamble
+}
+
+// Apply returns a copy of request whose system instruction starts with preamble. The
+// caller's request is not modified.
+func Apply(request *models.LLMRequest, preamble string) *models.LLMRequest {
+	if preamble == "" {
+		return request
+	}
+	merged := *request
+	config := models.GenerateContentConfig{}
+	if request.Config != nil {
+		config = *request.Config
+	}
+	config.SystemInstruction = ""
+	merged.Config = &config
+	merged.AppendInstructions(preamble)
+	if request.Config != nil && request.Config.SystemInstruction != "" {
+		merged.AppendInstructions(request.Config.SystemInstruction)
+	}
+	return &merged
+}
+
+// policyLLM applies a Policy before passing requests to the wrapped LLM.
+type policyLLM struct {
+	common.LLM
+	policy Policy
+}
+
+// Wrap returns an LLM that applies policy to every request and stores the merged system
+// instruction in the response's CustomMetadata under MetadataKey.
+func Wrap(llm common.LLM, policy Policy) common.LLM {
+	return &policyLLM{LLM: llm, policy: policy}
+}
+
+// Call implements the LLM interface Call method.
+func (p *policyLLM) Call(ctx context.Context, request *models.LLMRequest) (*models.LLMResponse, error) {
+	preamble := p.policy.PreambleFor(ctx)
+	if request.Metadata.TenantID != "" {
+		preamble = p.policy.tenantPreamble(request.Metadata.TenantID)
+	}
+	merged := Apply(request, preamble)
+	response, err := p.LLM.Call(ctx, merged)
+	if response != nil && merged.Config != nil && merged.Config.SystemInstruction != "" {
+		if response.CustomMetadata == nil {
+			response.CustomMetadata = make(map[string]any)
+		}
+		response.CustomMetadata[MetadataKey] = merged.Config.SystemInstruction
+	}
+	return response, err
+}
+
+// BatchCall implements the LLM interface BatchCall method.
+func (p *policyLLM) BatchCall(ctx context.Context, requests []*models.LLMRequest) ([]*models.LLMResponse, error) {
+	return common.BatchCall(ctx, requests, common.DefaultBatchConcurrency, p.Call)
+}
@@ -0,0 +1,80 @@
+package policy
+
+import (
+	"context"
+	"testing"
+
+	"github.com/nexen/libs/nexenctx"
+	"github.com/nexen/models"
+)
+
+// recordingLLM returns an empty response and remembers the last request.
+type recordingLLM struct {
+	last *models.LLMRequest
+}
+
+func (r *recordingLLM) Call(ctx context.Context, request *models.LLMRequest) (*models.LLMResponse, error) {
+	r.last = request
+	return &models.LLMResponse{Content: &models.Content{Role: "assistant"}}, nil
+}
+
+func (r *recordingLLM) BatchCall(ctx context.Context, requests []*models.LLMRequest) ([]*models.LLMResponse, error) {
+	return nil, nil
+}
+
+func (r *recordingLLM) SupportedModels() []string {
+	return []string{"recording"}
+}
+
+func TestWrapInjectsPreamble(t *testing.T) {
+	recorder := &recordingLLM{}
+	llm := Wrap(recorder, Policy{
+		Preamble:        "Follow the acceptable use policy.",
+		TenantPreambles: map[string]string{"acme": "You are Acme's assistant."},
+	})
+
+	request := &models.LLMRequest{
+		Model:    "recording",
+		Contents: []models.Content{{Role: "user", Message: "Hi"}},
+		Config:   &models.GenerateContentConfig{SystemInstruction: "Answer in French.", Temperature: 0.3},
+	}
+	response, err := llm.Call(context.Background(), request)
+	if err != nil {
+		t.Fatalf("Call failed: %v", err)
+	}
+
+	want := "Follow the acceptable use policy.\n\nAnswer in French."
+	if recorder.last.Config.SystemInstruction != want || recorder.last.Config.Temperature != 0.3 {
+		t.Errorf("Unexpected config sent: %+v", recorder.last.Config)
+	}
+	if response.CustomMetadata[MetadataKey] != want {
+		t.Errorf("Expected merged instruction in metadata, got %v", response.CustomMetadata)
+	}
+	if request.Config.SystemInstruction != "Answer in French." {
+		t.Error("Caller's request should not be modified")
+	}
+
+	ctx := nexenctx.WithTenant(context.Background(), "acme")
+	llm.Call(ctx, &models.LLMRequest{Model: "recording", Contents: []models.Content{{Role: "user", Message: "Hi"}}})
+	if recorder.last.Config.SystemInstruction != "You are Acme's assistant." {
+		t.Errorf("Expected tenant preamble, got %q", recorder.last.Config.SystemInstruction)
+	}
+
+	// The request's metadata takes precedence over the context
+	llm.Call(context.Background(), &models.LLMRequest{Model: "recording", Metadata: models.RequestMetadata{TenantID: "acme"}})
+	if recorder.last.Config.SystemInstruction != "You are Acme's assistant." {
+		t.Errorf("Expected tenant preamble from metadata, got %q", recorder.last.Config.SystemInstruction)
+	}
+
+	ctx = nexenctx.WithTenant(context.Background(), "globex")
+	if preamble := (Policy{Preamble: "org"}).PreambleFor(ctx); preamble != "org" {
+		t.Errorf("Expected organization preamble for other tenants, got %q", preamble)
+	}
+}
+
+func TestApplyWithoutPreamble(t *testing.T) {
+	request := &models.LLMRequest{Model: "recording"}
+	if Apply(request, "") != request {
+		t.Error("Expected the request unchanged without a preamble")
+	}
+}
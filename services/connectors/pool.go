@@ -0,0 +1,56 @@
+package connectors
+
+import (
+	"sync"
+
+	"github.com/nexen/models"
+)
+
+// pooledLLM is a cached client together with the settings version it was built with.
+type pooledLLM struct {
+	llm     LLM
+	version uint64
+}
+
+// Pool caches one LLM client per model and rebuilds it whenever provider settings or model
+// registrations change.
+type Pool struct {
+	mu      sync.Mutex
+	opts    []Option
+	clients map[string]pooledLLM
+}
+
+// NewPool creates a client pool; opts are passed to every client it creates.
+func NewPool(opts ...Option) *Pool {
+	return &Pool{
+		opts:    opts,
+		clients: make(map[string]pooledLLM),
+	}
+}
+
+// Get returns the pooled client for model, creating or refreshing it as needed. Model aliases
+// are resolved on every call, so clients follow an alias to the model it currently stands for.
+func (p *Pool) Get(model string) (LLM, error) {
+	model, _ = models.ResolveAlias(model)
+	version := currentSettingsVersion()
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if cached, ok := p.clients[model]; ok && cached.version == version {
+		return cached.llm, nil
+	}
+
+	llm, err := NewLLM(model, p.opts...)
+	if err != nil {
+		return nil, err
+	}
+	p.clients[model] = pooledLLM{llm: llm, version: version}
+	return llm, nil
+}
+
+// Reset drops all pooled clients.
+func (p *Pool) Reset() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.clients = make(map[string]pooledLLM)
+}
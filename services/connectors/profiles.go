@@ -0,0 +1,196 @@
+package connectors
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/nexen/models"
+	"github.com/nexen/services/connectors/common"
+	"github.com/nexen/services/connectors/selection"
+)
+
+// ProfileAliasPrefix starts model names that stand for a capability profile rather than a
+// model, such as "profile:code".
+const ProfileAliasPrefix = "profile:"
+
+// MetadataProfile is the CustomMetadata key holding the profile a ProfileLLM resolved. The
+// model it chose is under MetadataServedBy.
+const MetadataProfile = "profile"
+
+// Built-in strategies ranking the models of profiles without a configured default, as in the
+// model_selection.strategy config setting. Others can be added with selection.Register.
+const (
+	StrategyCost        = selection.Cost
+	StrategyPerformance = selection.Performance
+	StrategyBalanced    = selection.Balanced
+)
+
+var (
+	profilesMu        sync.RWMutex
+	profileDefaults   = make(map[string]string) // profile -> model ID
+	selectionStrategy = StrategyCost
+)
+
+// SetSelectionStrategy sets how ModelForProfile ranks the models of profiles without a
+// configured default, by the name of a strategy registered with selection.Register. The
+// initial strategy is StrategyCost.
+func SetSelectionStrategy(strategy string) error {
+	strategy = strings.ToLower(strategy)
+	if _, ok := selection.Lookup(strategy); !ok {
+		return fmt.Errorf("unknown model selection strategy %q (registered: %s)", strategy, strings.Join(selection.Names(), ", "))
+	}
+	profilesMu.Lock()
+	defer profilesMu.Unlock()
+	selectionStrategy = strategy
+	return nil
+}
+
+// ParseProfileAlias returns the profile of a model name such as "profile:code", and whether
+// the name is a profile alias.
+func ParseProfileAlias(model string) (string, bool) {
+	if len(model) <= len(ProfileAliasPrefix) || !strings.EqualFold(model[:len(ProfileAliasPrefix)], ProfileAliasPrefix) {
+		return "", false
+	}
+	return strings.ToLower(model[len(ProfileAliasPrefix):]), true
+}
+
+// SetProfileDefault sets the model serving profile, e.g. from the profiles.<name>.default_model
+// config settings:
+//
+//	for name, p := range cfg.Profiles {
+//		connectors.SetProfileDefault(name, p.DefaultModel)
+//	}
+func SetProfileDefault(profile, model string) {
+	profilesMu.Lock()
+	defer profilesMu.Unlock()
+	profileDefaults[profile] = model
+}
+
+// DeleteProfileDefault removes the configured model of profile.
+func DeleteProfileDefault(profile string) {
+	profilesMu.Lock()
+	defer profilesMu.Unlock()
+	delete(profileDefaults, profile)
+}
+
+// ModelForProfile returns the model serving profile. The model set with SetProfileDefault
+// wins; it must support the profile if it is in the models registry. Otherwise the registered
+// models with the profile and a registered constructor are ranked by the selection strategy,
+// which is told how healthy and fast each is from DefaultHealthTracker, and the first one is
+// used.
+func ModelForProfile(profile string) (string, error) {
+	return modelForProfile(profile, "")
+}
+
+// modelForProfile is ModelForProfile skipping the models refused to tenant by the model
+// access rules.
+func modelForProfile(profile, tenant string) (string, error) {
+	profilesMu.RLock()
+	model, ok := profileDefaults[profile]
+	strategy := selectionStrategy
+	profilesMu.RUnlock()
+	if ok {
+		if supported, err := models.HasProfile(model, profile); err == nil && !supported {
+			return "", fmt.Errorf("default model %s of profile %s does not support the profile", model, profile)
+		}
+		return model, nil
+	}
+
+	ranker, ok := selection.Lookup(strategy)
+	if !ok {
+		return "", fmt.Errorf("unknown model selection strategy %q", strategy)
+	}
+	var candidates []selection.Candidate
+	for _, info := range models.ListModelsByProfile(profile) {
+		stats, _ := DefaultHealthTracker.Stats(info.ID)
+		candidates = append(candidates, selection.Candidate{ModelInfo: info, Healthy: stats.Healthy, LatencyMs: stats.LatencyMs,
+			CostCents: estimateCost(info, typicalUsage)})
+	}
+	candidates = ranker.Rank(profile, candidates)
+	for _, info := range candidates {
+		if _, err := Resolve(info.ID); err != nil {
+			continue
+		}
+		if CheckModelAccess(info.ID, tenant) == nil {
+			return info.ID, nil
+		}
+	}
+	return "", fmt.Errorf("no model found for profile %s", profile)
+}
+
+// NewLLMForProfile creates an LLM like NewLLM for the model serving profile, so callers can
+// code against capabilities such as models.ProfileCode rather than model IDs. It is the same
+// as NewLLM with the profile's alias, e.g. "profile:code".
+func NewLLMForProfile(profile string, opts ...Option) (LLM, error) {
+	return NewLLM(ProfileAliasPrefix+profile, opts...)
+}
+
+// ProfileLLM sends requests whose Model is a profile alias such as "profile:thinking" to the
+// model ModelForProfile picks for the profile, skipping models the request's tenant may not
+// use, and records the choice in the response's CustomMetadata. Requests naming a model are
+// sent to that model. Clients are created on first use and kept in a Pool.
+type ProfileLLM struct {
+	pool *Pool
+}
+
+// NewProfileLLM returns a ProfileLLM; opts are passed to every client it creates.
+func NewProfileLLM(opts ...Option) *ProfileLLM {
+	return &ProfileLLM{pool: NewPool(opts...)}
+}
+
+// Call implements the LLM interface Call method.
+func (p *ProfileLLM) Call(ctx context.Context, request *models.LLMRequest) (*models.LLMResponse, error) {
+	profile, isAlias := ParseProfileAlias(request.Model)
+	if !isAlias {
+		llm, err := p.pool.Get(request.Model)
+		if err != nil {
+			return nil, err
+		}
+		return llm.Call(ctx, request)
+	}
+
+	model, err := modelForProfile(profile, request.Metadata.TenantID)
+	if err != nil {
+		return nil, err
+	}
+	llm, err := p.pool.Get(model)
+	if err != nil {
+		return nil, err
+	}
+	resolved := *request
+	resolved.Model = model
+	response, err := llm.Call(ctx, &resolved)
+	if err != nil {
+		return nil, err
+	}
+	if response.CustomMetadata == nil {
+		response.CustomMetadata = make(map[string]any)
+	}
+	response.CustomMetadata[MetadataServedBy] = model
+	response.CustomMetadata[MetadataProfile] = profile
+	return response, nil
+}
+
+// BatchCall implements the LLM interface BatchCall method.
+func (p *ProfileLLM) BatchCall(ctx context.Context, requests []*models.LLMRequest) ([]*models.LLMResponse, error) {
+	return common.BatchCall(ctx, requests, common.DefaultBatchConcurrency, p.Call)
+}
+
+// SupportedModels returns the aliases of the profiles of the registered models.
+func (p *ProfileLLM) SupportedModels() []string {
+	seen := make(map[string]bool)
+	var aliases []string
+	for _, info := range models.ListModelInfos() {
+		for _, profile := range info.Profiles {
+			if !seen[profile] {
+				seen[profile] = true
+				aliases = append(aliases, ProfileAliasPrefix+profile)
+			}
+		}
+	}
+	sort.Strings(aliases)
+	return aliases
+}
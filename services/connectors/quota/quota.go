@@ -0,0 +1,289 @@
+// Package quota enforces per-API-key limits in the gateway, so that the internal teams
+// sharing it get their own throughput, models and request sizes.
+//
+// Each key's Policy caps its requests and tokens per minute, lists the models it may use and
+// bounds the completion tokens a request may ask for. Requests over a limit are refused with
+// a *Error rather than queued, so callers can answer with a 429 and its retry delay. Requests
+// of priority models.PriorityBatch can be held to a share of the per-minute limits. The
+// per-minute limits are counted by each process. A policy carried by the request, such as
+// one stored with an API key, takes precedence over the configured ones (see
+// Options.PolicyFrom).
+//
+//	quotas := quota.New(quota.Options{Policies: policies, KeyFrom: apiKeyFrom})
+//	llm, err := connectors.NewLLMWithMiddleware("gpt-4o", quotas.Middleware())
+package quota
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nexen/models"
+	"github.com/nexen/services/connectors/common"
+)
+
+// DefaultPolicy names the policy of keys without their own, as in the gateway's key_policies
+// configuration.
+const DefaultPolicy = "default"
+
+// Error classes of refused requests.
+var (
+	// ErrQuotaExceeded means the request is over one of its key's limits.
+	ErrQuotaExceeded = errors.New("quota exceeded")
+
+	// ErrModelNotAllowed means the key may not use the request's model.
+	ErrModelNotAllowed = errors.New("model not allowed")
+)
+
+// Error reports why a request was refused. It matches ErrQuotaExceeded or ErrModelNotAllowed
+// with errors.Is.
+type Error struct {
+	// Key is the API key name the request was made with.
+	Key string
+
+	// Limit names the limit reached: "allowed_models", "max_tokens_per_request",
+	// "rate_limit" for the per-minute limits or "batch_rate_limit" for their batch share.
+	Limit string
+
+	// RetryAfter is the time until a rate-limited request would fit, or 0.
+	RetryAfter time.Duration
+
+	// Class is ErrQuotaExceeded or ErrModelNotAllowed.
+	Class error
+}
+
+func (e *Error) Error() string {
+	msg := fmt.Sprintf("%v: key %s: %s", e.Class, e.Key, e.Limit)
+	if e.RetryAfter > 0 {
+		msg += fmt.Sprintf(" (retry after %v)", e.RetryAfter.Round(time.Millisecond))
+	}
+	return msg
+}
+
+// Unwrap returns the error's class.
+func (e *Error) Unwrap() error {
+	return e.Class
+}
+
+// Policy limits the requests made with one API key, typically a config.KeyPolicy. Zero
+// values mean unlimited.
+type Policy struct {
+	RequestsPerMinute int
+	TokensPerMinute   int
+
+	// AllowedModels lists the models the key may use, as names or path.Match patterns such
+	// as "gpt-4o*". Empty allows every model.
+	AllowedModels []string
+
+	// MaxTokensPerRequest caps a request's MaxTokens. Requests that leave it unset are sent
+	// with the cap; requests asking for more are refused.
+	MaxTokensPerRequest int
+
+	// BatchPercent is the share of RequestsPerMinute and TokensPerMinute, in percent, that
+	// requests of priority models.PriorityBatch may use, so that batches leave room for
+	// interactive requests. Zero lets them use all of it.
+	BatchPercent int
+}
+
+// Options configures the quotas.
+type Options struct {
+	// Policies maps API key names, in lower case, to their policies. The DefaultPolicy entry
+	// applies to keys without their own; without it, they are not limited.
+	Policies map[string]Policy
+
+	// KeyFrom returns the name of the API key a request was made with. Requests without one
+	// are subject to the default policy.
+	KeyFrom func(ctx context.Context) (string, bool)
+
+	// PolicyFrom returns the policy a request carries, such as one stored with its API key.
+	// It takes precedence over Policies. Nil looks policies up in Policies only.
+	PolicyFrom func(ctx context.Context) (Policy, bool)
+}
+
+// Quotas enforces the policies of Options. The rate limits of a key are shared by every LLM
+// wrapped by the same Quotas. It is safe for concurrent use.
+type Quotas struct {
+	opts Options
+
+	mu       sync.Mutex
+	limiters map[string]*common.RateLimiter // key, or key and batchSuffix -> limiter
+}
+
+// batchSuffix ends the limiter keys of the batch budgets of API keys.
+const batchSuffix = "#batch"
+
+// New returns Quotas enforcing opts.
+func New(opts Options) *Quotas {
+	return &Quotas{opts: opts, limiters: make(map[string]*common.RateLimiter)}
+}
+
+// Middleware returns a common.Middleware that enforces the quotas on the wrapped LLM.
+func (q *Quotas) Middleware() common.Middleware {
+	return func(next common.LLM) common.LLM {
+		return &quotaLLM{LLM: next, quotas: q}
+	}
+}
+
+// policy returns the key making requests with ctx and its policy, if any applies.
+func (q *Quotas) policy(ctx context.Context) (string, Policy, bool) {
+	var key string
+	if q.opts.KeyFrom != nil {
+		key, _ = q.opts.KeyFrom(ctx)
+	}
+	key = strings.ToLower(key)
+	if q.opts.PolicyFrom != nil {
+		if p, ok := q.opts.PolicyFrom(ctx); ok {
+			return key, p, true
+		}
+	}
+	if p, ok := q.opts.Policies[key]; ok && key != "" {
+		return key, p, true
+	}
+	p, ok := q.opts.Policies[DefaultPolicy]
+	return key, p, ok
+}
+
+// limiter returns the rate limiter of key, creating it on first use.
+func (q *Quotas) limiter(key string, p Policy) *common.RateLimiter {
+	limit := common.RateLimit{RequestsPerMinute: p.RequestsPerMinute, TokensPerMinute: p.TokensPerMinute}
+	if !limit.Enabled() {
+		return nil
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	l, ok := q.limiters[key]
+	if !ok {
+		l = common.NewRateLimiter(limit)
+		q.limiters[key] = l
+	}
+	return l
+}
+
+// batchLimiter returns the limiter of the batch budget of key, or nil when p sets none.
+func (q *Quotas) batchLimiter(key string, p Policy) *common.RateLimiter {
+	if p.BatchPercent <= 0 || p.BatchPercent >= 100 {
+		return nil
+	}
+	batch := Policy{
+		RequestsPerMinute: max(1, p.RequestsPerMinute*p.BatchPercent/100),
+		TokensPerMinute:   max(1, p.TokensPerMinute*p.BatchPercent/100),
+	}
+	if p.RequestsPerMinute == 0 {
+		batch.RequestsPerMinute = 0
+	}
+	if p.TokensPerMinute == 0 {
+		batch.TokensPerMinute = 0
+	}
+	return q.limiter(key+batchSuffix, batch)
+}
+
+// allowed reports whether p allows model.
+func (p Policy) allowed(model string) bool {
+	if len(p.AllowedModels) == 0 {
+		return true
+	}
+	for _, pattern := range p.AllowedModels {
+		if matched, _ := path.Match(pattern, model); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// quotaLLM enforces the quotas before calling the wrapped LLM.
+type quotaLLM struct {
+	common.LLM
+	quotas *Quotas
+}
+
+// Call implements the LLM interface Call method.
+func (l *quotaLLM) Call(ctx context.Context, request *models.LLMRequest) (*models.LLMResponse, error) {
+	request, done, err := l.admit(ctx, request)
+	if err != nil {
+		return nil, err
+	}
+	response, err := l.LLM.Call(ctx, request)
+	done(response)
+	return response, err
+}
+
+// CallStream implements common.Streamer, enforcing the quotas before the stream starts. LLMs
+// that cannot stream are called with Call, as by common.CallStream.
+func (l *quotaLLM) CallStream(ctx context.Context, request *models.LLMRequest, yield func(*models.LLMResponse) error) error {
+	request, done, err := l.admit(ctx, request)
+	if err != nil {
+		return err
+	}
+	var final *models.LLMResponse
+	err = common.CallStream(ctx, l.LLM, request, func(response *models.LLMResponse) error {
+		if !response.IsPartial() {
+			final = response
+		}
+		return yield(response)
+	})
+	done(final)
+	return err
+}
+
+// admit checks request against the policy of its key, returning the request to send, with
+// its MaxTokens capped as needed, and a function to call with its response, if any, to count
+// the tokens it actually used.
+func (l *quotaLLM) admit(ctx context.Context, request *models.LLMRequest) (*models.LLMRequest, func(*models.LLMResponse), error) {
+	key, policy, ok := l.quotas.policy(ctx)
+	if !ok {
+		return request, func(*models.LLMResponse) {}, nil
+	}
+
+	model := request.Model
+	if namer, ok := l.LLM.(common.ModelNamer); ok && model == "" {
+		model = namer.Model()
+	}
+	if !policy.allowed(model) {
+		return nil, nil, &Error{Key: key, Limit: "allowed_models", Class: ErrModelNotAllowed}
+	}
+
+	if limit := policy.MaxTokensPerRequest; limit > 0 {
+		switch {
+		case request.Config == nil || request.Config.MaxTokens == 0:
+			capped := *request
+			config := models.GenerateContentConfig{}
+			if request.Config != nil {
+				config = *request.Config
+			}
+			config.MaxTokens = limit
+			capped.Config = &config
+			request = &capped
+		case request.Config.MaxTokens > limit:
+			return nil, nil, &Error{Key: key, Limit: "max_tokens_per_request", Class: ErrQuotaExceeded}
+		}
+	}
+
+	limiter := l.quotas.limiter(key, policy)
+	var batch *common.RateLimiter
+	if request.Metadata.Priority == models.PriorityBatch {
+		batch = l.quotas.batchLimiter(key, policy)
+	}
+	estimated := common.EstimateTokens(request)
+	if ok, retry := batch.Allow(estimated); !ok {
+		return nil, nil, &Error{Key: key, Limit: "batch_rate_limit", RetryAfter: retry, Class: ErrQuotaExceeded}
+	}
+	if ok, retry := limiter.Allow(estimated); !ok {
+		batch.Release(estimated)
+		return nil, nil, &Error{Key: key, Limit: "rate_limit", RetryAfter: retry, Class: ErrQuotaExceeded}
+	}
+	return request, func(response *models.LLMResponse) {
+		if response != nil {
+			limiter.Adjust(response.Usage.TotalTokens - estimated)
+			batch.Adjust(response.Usage.TotalTokens - estimated)
+		}
+	}, nil
+}
+
+// BatchCall implements the LLM interface BatchCall method.
+func (l *quotaLLM) BatchCall(ctx context.Context, requests []*models.LLMRequest) ([]*models.LLMResponse, error) {
+	return common.BatchCall(ctx, requests, common.DefaultBatchConcurrency, l.Call)
+}
@@ -0,0 +1,151 @@
+package quota
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/nexen/models"
+	"github.com/nexen/services/connectors/common"
+)
+
+// recordingLLM records the requests it receives.
+type recordingLLM struct {
+	requests []*models.LLMRequest
+}
+
+func (r *recordingLLM) Call(ctx context.Context, request *models.LLMRequest) (*models.LLMResponse, error) {
+	r.requests = append(r.requests, request)
+	return &models.LLMResponse{Usage: models.UsageMetrics{TotalTokens: 10}}, nil
+}
+
+func (r *recordingLLM) BatchCall(ctx context.Context, requests []*models.LLMRequest) ([]*models.LLMResponse, error) {
+	return nil, nil
+}
+
+func (r *recordingLLM) SupportedModels() []string {
+	return nil
+}
+
+type keyKey struct{}
+
+func keyFrom(ctx context.Context) (string, bool) {
+	key, ok := ctx.Value(keyKey{}).(string)
+	return key, ok
+}
+
+func TestQuotas(t *testing.T) {
+	quotas := New(Options{
+		Policies: map[string]Policy{
+			"search":  {RequestsPerMinute: 2, AllowedModels: []string{"gpt-4o*"}, MaxTokensPerRequest: 100},
+			"default": {AllowedModels: []string{"gpt-4o-mini"}},
+		},
+		KeyFrom: keyFrom,
+	})
+	upstream := &recordingLLM{}
+	llm := quotas.Middleware()(upstream)
+	search := context.WithValue(context.Background(), keyKey{}, "Search")
+
+	// Unset MaxTokens are capped, larger ones refused
+	if _, err := llm.Call(search, &models.LLMRequest{Model: "gpt-4o"}); err != nil {
+		t.Fatalf("Call() error = %v", err)
+	}
+	if got := upstream.requests[0].Config; got == nil || got.MaxTokens != 100 {
+		t.Errorf("Expected MaxTokens capped at 100, got %+v", got)
+	}
+	_, err := llm.Call(search, &models.LLMRequest{Model: "gpt-4o", Config: &models.GenerateContentConfig{MaxTokens: 500}})
+	var quotaErr *Error
+	if !errors.As(err, &quotaErr) || !errors.Is(err, ErrQuotaExceeded) || quotaErr.Limit != "max_tokens_per_request" {
+		t.Errorf("Expected a max_tokens_per_request error, got %v", err)
+	}
+
+	if _, err := llm.Call(search, &models.LLMRequest{Model: "claude-3-sonnet"}); !errors.Is(err, ErrModelNotAllowed) {
+		t.Errorf("Expected ErrModelNotAllowed, got %v", err)
+	}
+
+	// The second allowed request uses up the two requests per minute
+	if _, err := llm.Call(search, &models.LLMRequest{Model: "gpt-4o-mini"}); err != nil {
+		t.Fatalf("Call() error = %v", err)
+	}
+	_, err = llm.Call(search, &models.LLMRequest{Model: "gpt-4o-mini"})
+	if !errors.As(err, &quotaErr) || quotaErr.Limit != "rate_limit" || quotaErr.RetryAfter <= 0 {
+		t.Errorf("Expected a rate limit error with a retry delay, got %v", err)
+	}
+
+	// Other keys get the default policy and their own limits
+	if _, err := llm.Call(context.Background(), &models.LLMRequest{Model: "gpt-4o"}); !errors.Is(err, ErrModelNotAllowed) {
+		t.Errorf("Expected the default policy to refuse gpt-4o, got %v", err)
+	}
+	for i := 0; i < 3; i++ {
+		if _, err := llm.Call(context.Background(), &models.LLMRequest{Model: "gpt-4o-mini"}); err != nil {
+			t.Errorf("Call() error = %v", err)
+		}
+	}
+	if len(upstream.requests) != 5 {
+		t.Errorf("Expected 5 requests upstream, got %d", len(upstream.requests))
+	}
+}
+
+type policyKey struct{}
+
+func TestPolicyFrom(t *testing.T) {
+	quotas := New(Options{
+		Policies: map[string]Policy{"default": {AllowedModels: []string{"gpt-4o-mini"}}},
+		KeyFrom:  keyFrom,
+		PolicyFrom: func(ctx context.Context) (Policy, bool) {
+			p, ok := ctx.Value(policyKey{}).(Policy)
+			return p, ok
+		},
+	})
+	llm := quotas.Middleware()(&recordingLLM{})
+	ctx := context.WithValue(context.Background(), keyKey{}, "key_1")
+	ctx = context.WithValue(ctx, policyKey{}, Policy{RequestsPerMinute: 1, AllowedModels: []string{"gpt-4o"}})
+
+	// The request's own policy replaces the default one
+	if _, err := llm.Call(ctx, &models.LLMRequest{Model: "gpt-4o-mini"}); !errors.Is(err, ErrModelNotAllowed) {
+		t.Errorf("Expected ErrModelNotAllowed, got %v", err)
+	}
+	if _, err := llm.Call(ctx, &models.LLMRequest{Model: "gpt-4o"}); err != nil {
+		t.Fatalf("Call() error = %v", err)
+	}
+
+	// Streams are limited too
+	var final *models.LLMResponse
+	err := llm.(common.Streamer).CallStream(ctx, &models.LLMRequest{Model: "gpt-4o"}, func(response *models.LLMResponse) error {
+		final = response
+		return nil
+	})
+	if !errors.Is(err, ErrQuotaExceeded) || final != nil {
+		t.Errorf("Expected the stream to be refused, got %v", err)
+	}
+}
+
+func TestBatchBudget(t *testing.T) {
+	quotas := New(Options{
+		Policies: map[string]Policy{"default": {RequestsPerMinute: 4, BatchPercent: 50}},
+	})
+	llm := quotas.Middleware()(&recordingLLM{})
+	batch := func() *models.LLMRequest {
+		return &models.LLMRequest{Model: "gpt-4o", Metadata: models.RequestMetadata{Priority: models.PriorityBatch}}
+	}
+	ctx := context.Background()
+
+	// Batches use half of the requests per minute, leaving the rest to interactive requests
+	for i := 0; i < 2; i++ {
+		if _, err := llm.Call(ctx, batch()); err != nil {
+			t.Fatalf("Call() error = %v", err)
+		}
+	}
+	var quotaErr *Error
+	if _, err := llm.Call(ctx, batch()); !errors.As(err, &quotaErr) || quotaErr.Limit != "batch_rate_limit" {
+		t.Errorf("Expected a batch_rate_limit error, got %v", err)
+	}
+	for i := 0; i < 2; i++ {
+		if _, err := llm.Call(ctx, &models.LLMRequest{Model: "gpt-4o"}); err != nil {
+			t.Errorf("Expected interactive requests to fit, got %v", err)
+		}
+	}
+	if _, err := llm.Call(ctx, &models.LLMRequest{Model: "gpt-4o"}); !errors.As(err, &quotaErr) || quotaErr.Limit != "rate_limit" {
+		t.Errorf("Expected a rate_limit error, got %v", err)
+	}
+}
@@ -5,42 +5,54 @@ import (
 	"regexp"
 	"sync"
 
+	"github.com/nexen/models"
 	"github.com/nexen/services/connectors/common"
 )
 
-// LLM represents the generic interface for any LLM client.
-// Concrete implementations should satisfy this interface.
+// LLM represents the generic interface for any LLM client. It is common.LLM, which every
+// connector implements and asserts at compile time, so the two are interchangeable.
 type LLM = common.LLM
 
-// Option represents a functional option for configuring an LLM.
+// Option represents a functional option for configuring an LLM. It is common.Option.
 type Option = common.Option
 
+// Middleware wraps an LLM with cross-cutting behavior. It is common.Middleware.
+type Middleware = common.Middleware
+
 // constructorFn defines a function that creates an LLM given a model name and config.
 type constructorFn func(model string, opts ...Option) (LLM, error)
 
+// registration is a constructor registered under a model-name regex.
+type registration struct {
+	re   *regexp.Regexp
+	ctor constructorFn
+}
+
 // registry holds mappings from model-name regexes to LLM constructors.
 var (
 	mu           sync.RWMutex
-	registry     = make(map[string]constructorFn)
+	registry     = make(map[string]registration)
 	resolveCache = make(map[string]constructorFn)
 )
 
 // Register associates a model-name regex with an LLM constructor.
-// Call this in each connector's init() function or setup.
+// Call this in each connector's init() function or setup. The regex is compiled once, here.
 func Register(modelRegex string, constructor constructorFn) error {
+	re, err := regexp.Compile(modelRegex)
+	if err != nil {
+		return fmt.Errorf("invalid regex %s: %w", modelRegex, err)
+	}
 	mu.Lock()
 	defer mu.Unlock()
-	if _, exists := registry[modelRegex]; exists {
-		// Overwriting existing registration
-	}
-	registry[modelRegex] = constructor
+	registry[modelRegex] = registration{re: re, ctor: constructor}
 	// clear cache so new registrations are considered
 	resolveCache = make(map[string]constructorFn)
 	return nil
 }
 
 // Resolve returns the constructor for the given model name, matching against registered regexes.
-// It caches resolved constructors for performance.
+// It caches resolved constructors for performance. An unknown model fails with a
+// *models.ModelNotFoundError suggesting the closest model names.
 func Resolve(model string) (constructorFn, error) {
 	mu.RLock()
 	if ctor, cached := resolveCache[model]; cached {
@@ -56,26 +68,73 @@ func Resolve(model string) (constructorFn, error) {
 		return ctor, nil
 	}
 
-	for regex, ctor := range registry {
-		matched, err := regexp.MatchString(regex, model)
-		if err != nil {
-			return nil, fmt.Errorf("invalid regex %s: %w", regex, err)
-		}
-		if matched {
-			resolveCache[model] = ctor
-			return ctor, nil
+	for _, r := range registry {
+		if r.re.MatchString(model) {
+			resolveCache[model] = r.ctor
+			return r.ctor, nil
 		}
 	}
-	return nil, fmt.Errorf("no LLM constructor found for model %s", model)
+	// Suggest both connector patterns and the models registry's names
+	candidates := make([]string, 0, len(registry))
+	for regex := range registry {
+		candidates = append(candidates, regex)
+	}
+	for _, info := range models.ListModelInfos() {
+		candidates = append(candidates, info.ID)
+	}
+	return nil, models.NewModelNotFoundError(model, candidates)
 }
 
 // NewLLM creates an LLM instance for the given model name using the resolved constructor.
+// Provider overrides set via SetProviderSettings are applied after the caller's options.
+// The client is wrapped with Meter so responses always carry latency and cost, with
+// CheckCapabilities so requests needing a capability the model lacks fail before they are
+// sent, with Trace when a tracer is set with common.SetTracer, and outermost with the middleware set by
+// common.WithMiddleware. Models with deployments set with SetDeployments get a BalancedLLM
+// over them. Models refused by the access rules (see SetModelAccess) fail with a
+// *common.ModelAccessError. A model alias registered with models.RegisterAlias, or a profile
+// alias such as "profile:code", is resolved once, when the client is created; use a Pool or a
+// ProfileLLM to follow changes to the alias.
 func NewLLM(model string, opts ...Option) (LLM, error) {
-	ctor, err := Resolve(model)
+	config := optionsConfig(opts)
+	if profile, ok := ParseProfileAlias(model); ok {
+		var err error
+		if model, err = modelForProfile(profile, config.Tenant); err != nil {
+			return nil, err
+		}
+	} else {
+		model, _ = models.ResolveAlias(model)
+	}
+	if err := CheckModelAccess(model, config.Tenant, config.ModelAccess...); err != nil {
+		return nil, err
+	}
+	llm, err := newModelLLM(model, append(opts[:len(opts):len(opts)], settingsOptions(model)...))
+	if err != nil {
+		return nil, err
+	}
+	llm = CheckCapabilities(model)(Meter(model)(llm))
+	if tracer := common.CurrentTracer(); tracer != nil {
+		llm = Trace(model, tracer)(llm)
+	}
+	return common.Chain(llm, config.Middleware...), nil
+}
+
+// newModelLLM creates the client of model with its constructor, or a BalancedLLM over its
+// deployments when some are set with SetDeployments.
+func newModelLLM(model string, opts []Option) (LLM, error) {
+	d, ok := deploymentsOf(model)
+	if !ok {
+		ctor, err := Resolve(model)
+		if err != nil {
+			return nil, err
+		}
+		return ctor(model, opts...)
+	}
+	deployments, err := NewDeployments(model, d.settings, opts...)
 	if err != nil {
 		return nil, err
 	}
-	return ctor(model, opts...)
+	return NewBalancedLLM(d.policy, deployments...)
 }
 
 // ListModelPatterns returns all registered model patterns.
@@ -89,3 +148,9 @@ func ListModelPatterns() []string {
 	}
 	return patterns
 }
+
+// NewLLMWithMiddleware creates an LLM like NewLLM wrapped with mws; the first middleware is
+// the outermost. Use NewLLM with common.WithMiddleware to pass other options as well.
+func NewLLMWithMiddleware(model string, mws ...Middleware) (LLM, error) {
+	return NewLLM(model, common.WithMiddleware(mws...))
+}
@@ -2,10 +2,14 @@ package connectors
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"sort"
 	"testing"
 
 	"github.com/nexen/models"
 	"github.com/nexen/services/connectors/common"
+	"github.com/nexen/services/connectors/selection"
 )
 
 // mockLLM is a test implementation of the LLM interface.
@@ -35,7 +39,7 @@ func mockConstructor(model string, opts ...common.Option) (common.LLM, error) {
 func TestRegistry(t *testing.T) {
 	// Clear the registry before testing
 	mu.Lock()
-	registry = make(map[string]constructorFn)
+	registry = make(map[string]registration)
 	resolveCache = make(map[string]constructorFn)
 	mu.Unlock()
 
@@ -44,6 +48,9 @@ func TestRegistry(t *testing.T) {
 	if err != nil {
 		t.Fatalf("Register failed: %v", err)
 	}
+	if err := Register("test-(", mockConstructor); err == nil {
+		t.Fatal("Register should fail with an invalid regex")
+	}
 
 	// Test Resolve - positive case
 	ctor, err := Resolve("test-model")
@@ -62,8 +69,8 @@ func TestRegistry(t *testing.T) {
 
 	// Test Resolve - negative case
 	_, err = Resolve("unknown-model")
-	if err == nil {
-		t.Fatal("Resolve should have failed for unknown model")
+	if !errors.Is(err, models.ErrModelNotFound) {
+		t.Fatalf("Resolve should have failed with ErrModelNotFound for unknown model, got %v", err)
 	}
 
 	// Test NewLLM
@@ -80,4 +87,165 @@ func TestRegistry(t *testing.T) {
 	if err == nil {
 		t.Fatal("NewLLM should have failed for unknown model")
 	}
+
+	// Test NewLLMWithMiddleware
+	wrapped := &mockLLM{}
+	llm, err = NewLLMWithMiddleware("test-model", func(next LLM) LLM { return wrapped })
+	if err != nil {
+		t.Fatalf("NewLLMWithMiddleware failed: %v", err)
+	}
+	if llm != wrapped {
+		t.Fatal("NewLLMWithMiddleware did not apply the middleware")
+	}
+	if _, err = NewLLMWithMiddleware("unknown-model"); err == nil {
+		t.Fatal("NewLLMWithMiddleware should have failed for unknown model")
+	}
+}
+
+func TestNewLLMForProfile(t *testing.T) {
+	for id, cost := range map[string]float64{"profprobe-cheap": 0.001, "profprobe-pricey": 0.01, "profprobe-unbuildable": 0.0001} {
+		if err := models.Register("^"+id+"$", models.ModelInfo{ID: id, Provider: "profprobe", Profiles: []string{"profprobe"}, CostPerToken: cost}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := models.Register("^profprobe-chat$", models.ModelInfo{ID: "profprobe-chat", Provider: "profprobe", Profiles: []string{models.ProfileChat}}); err != nil {
+		t.Fatal(err)
+	}
+	Register("^profprobe-(cheap|pricey|chat)$", mockConstructor)
+
+	// Without a configured default, the cheapest model that can be built is used
+	if model, err := ModelForProfile("profprobe"); err != nil || model != "profprobe-cheap" {
+		t.Errorf("Expected profprobe-cheap, got %q, %v", model, err)
+	}
+
+	SetProfileDefault("profprobe", "profprobe-pricey")
+	defer DeleteProfileDefault("profprobe")
+	if model, err := ModelForProfile("profprobe"); err != nil || model != "profprobe-pricey" {
+		t.Errorf("Expected the configured default, got %q, %v", model, err)
+	}
+	if _, err := NewLLMForProfile("profprobe"); err != nil {
+		t.Errorf("NewLLMForProfile() error = %v", err)
+	}
+
+	// A profile alias goes through NewLLM's access checks and middleware like a model name
+	wrapped := &mockLLM{}
+	if llm, err := NewLLM("profile:profprobe", common.WithMiddleware(func(next LLM) LLM { return wrapped })); err != nil || llm != wrapped {
+		t.Errorf("NewLLM(profile alias) = %v, %v; want the middleware's client", llm, err)
+	}
+	SetTenantModelAccess("profprobe-tenant", ModelAccess{Deny: []string{"profprobe-pricey"}})
+	defer DeleteTenantModelAccess("profprobe-tenant")
+	var accessErr *common.ModelAccessError
+	if _, err := NewLLM("profile:profprobe", common.WithTenant("profprobe-tenant")); !errors.As(err, &accessErr) {
+		t.Errorf("NewLLM(profile alias) for a denied tenant error = %v, want a *ModelAccessError", err)
+	}
+
+	SetProfileDefault("profprobe", "profprobe-chat")
+	if _, err := NewLLMForProfile("profprobe"); err == nil {
+		t.Error("Expected an error for a default model without the profile")
+	}
+	if _, err := NewLLMForProfile("profprobe-unknown"); err == nil {
+		t.Error("Expected an error for a profile no model supports")
+	}
+}
+
+func TestProfileLLM(t *testing.T) {
+	for _, info := range []models.ModelInfo{
+		{ID: "aliasprobe-basic", Profiles: []string{"aliasprobe"}, CostPerToken: 0.001, CostTier: models.CostTierBasic},
+		{ID: "aliasprobe-standard", Profiles: []string{"aliasprobe"}, CostPerToken: 0.01, CostTier: models.CostTierStandard},
+		{ID: "aliasprobe-premium", Profiles: []string{"aliasprobe"}, CostPerToken: 0.1, CostTier: models.CostTierPremium},
+	} {
+		if err := models.Register("^"+info.ID+"$", info); err != nil {
+			t.Fatal(err)
+		}
+	}
+	Register("^aliasprobe-.*$", mockConstructor)
+	defer SetSelectionStrategy(StrategyCost)
+
+	if profile, ok := ParseProfileAlias("Profile:AliasProbe"); !ok || profile != "aliasprobe" {
+		t.Errorf("ParseProfileAlias() = %q, %v", profile, ok)
+	}
+	if _, ok := ParseProfileAlias("aliasprobe-basic"); ok {
+		t.Error("ParseProfileAlias() accepted a model name")
+	}
+
+	llm := NewProfileLLM()
+	testCases := []struct {
+		strategy string
+		tenant   string
+		want     string
+	}{
+		{StrategyCost, "", "aliasprobe-basic"},
+		{StrategyBalanced, "", "aliasprobe-standard"},
+		{StrategyPerformance, "", "aliasprobe-premium"},
+		{StrategyPerformance, "aliasprobe-tenant", "aliasprobe-standard"},
+	}
+	SetTenantModelAccess("aliasprobe-tenant", ModelAccess{Deny: []string{"*-premium"}})
+	defer DeleteTenantModelAccess("aliasprobe-tenant")
+	for _, tc := range testCases {
+		if err := SetSelectionStrategy(tc.strategy); err != nil {
+			t.Fatal(err)
+		}
+		request := &models.LLMRequest{Model: "profile:aliasprobe", Metadata: models.RequestMetadata{TenantID: tc.tenant}}
+		response, err := llm.Call(context.Background(), request)
+		if err != nil {
+			t.Fatalf("%s: Call() error = %v", tc.strategy, err)
+		}
+		if got := response.CustomMetadata[MetadataServedBy]; got != tc.want {
+			t.Errorf("%s for tenant %q: served by %v, want %s", tc.strategy, tc.tenant, got, tc.want)
+		}
+		if got := response.CustomMetadata[MetadataProfile]; got != "aliasprobe" {
+			t.Errorf("%s: profile = %v, want aliasprobe", tc.strategy, got)
+		}
+	}
+
+	if _, err := llm.Call(context.Background(), &models.LLMRequest{Model: "profile:aliasprobe-unknown"}); err == nil {
+		t.Error("Expected an error for a profile no model supports")
+	}
+	if err := SetSelectionStrategy("fastest"); err == nil {
+		t.Error("Expected an error for an unknown strategy")
+	}
+
+	// A registered third-party strategy is used like the built-in ones
+	selection.Register("aliasprobe-priciest", selection.StrategyFunc(func(_ string, candidates []selection.Candidate) []selection.Candidate {
+		sort.Slice(candidates, func(i, j int) bool { return candidates[i].CostPerToken > candidates[j].CostPerToken })
+		return candidates
+	}))
+	if err := SetSelectionStrategy("AliasProbe-Priciest"); err != nil {
+		t.Fatal(err)
+	}
+	if model, err := ModelForProfile("aliasprobe"); err != nil || model != "aliasprobe-premium" {
+		t.Errorf("ModelForProfile() with a registered strategy = %q, %v", model, err)
+	}
+}
+
+// BenchmarkResolve resolves names missing from the cache against hundreds of patterns.
+func BenchmarkResolve(b *testing.B) {
+	mu.Lock()
+	saved := registry
+	registry = make(map[string]registration)
+	resolveCache = make(map[string]constructorFn)
+	mu.Unlock()
+	b.Cleanup(func() {
+		mu.Lock()
+		registry = saved
+		resolveCache = make(map[string]constructorFn)
+		mu.Unlock()
+	})
+
+	for i := 0; i < 500; i++ {
+		if err := Register(fmt.Sprintf("^bench-%03d(-.*)?$", i), mockConstructor); err != nil {
+			b.Fatal(err)
+		}
+	}
+	names := make([]string, b.N)
+	for i := range names {
+		names[i] = fmt.Sprintf("bench-%03d-%d", i%500, i)
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for _, name := range names {
+		if _, err := Resolve(name); err != nil {
+			b.Fatal(err)
+		}
+	}
 }
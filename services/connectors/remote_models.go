@@ -0,0 +1,235 @@
+package connectors
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sort"
+	"time"
+
+	"github.com/nexen/models"
+	"github.com/nexen/services/connectors/common"
+)
+
+// RemoteModel is a model of a provider's catalog, as listed by the provider, registered in
+// the models registry, or both.
+type RemoteModel struct {
+	// ID is the model ID as the provider names it.
+	ID string `json:"id"`
+
+	// Upstream is true when the provider lists the model.
+	Upstream bool `json:"upstream"`
+
+	// Registered is true when the ID resolves to a model of the provider in the models
+	// registry, e.g. "gpt-4o-2024-08-06" through the "gpt-4o.*" pattern. Upstream models that
+	// are not registered are missing from the catalog; local models that are not upstream may
+	// have been retired.
+	Registered bool `json:"registered"`
+
+	// Added is true when SyncRemoteModels registered the model.
+	Added bool `json:"added,omitempty"`
+
+	// DisplayName, ContextWindow, Created and DeprecatedAt are what the provider says of an
+	// upstream model, when its connector implements common.ModelDescriber and the provider
+	// reports them.
+	DisplayName   string     `json:"displayName,omitempty"`
+	ContextWindow int        `json:"contextWindow,omitempty"`
+	Created       *time.Time `json:"created,omitempty"`
+	DeprecatedAt  *time.Time `json:"deprecatedAt,omitempty"`
+}
+
+// ListRemoteModels queries provider's models endpoint and merges the result with the models
+// registry, sorted by ID. The provider is queried with a client of its first registered model
+// that has a constructor, created with opts and the provider's settings like NewLLM.
+func ListRemoteModels(ctx context.Context, provider string, opts ...Option) ([]RemoteModel, error) {
+	local, err := providerModels(provider)
+	if err != nil {
+		return nil, err
+	}
+	upstream, err := describeRemoteModels(ctx, provider, local, opts)
+	if err != nil {
+		return nil, err
+	}
+	return mergeRemoteModels(provider, local, upstream), nil
+}
+
+// SyncRemoteModels refreshes the models registry from provider's models endpoint and returns
+// the merged listing like ListRemoteModels. Upstream models that do not resolve to a model of
+// the provider are registered under their exact ID, with the context window and deprecation
+// date the provider reports, and bound to the provider's connector; they are flagged Added.
+// They have no profiles nor prices, so they can be called by name but are not selected for a
+// profile until an operator completes their registration. Registered models named exactly as
+// an upstream model get the context window they lack and the deprecation date the provider
+// reports. Models that are no longer upstream are kept.
+func SyncRemoteModels(ctx context.Context, provider string, opts ...Option) ([]RemoteModel, error) {
+	local, err := providerModels(provider)
+	if err != nil {
+		return nil, err
+	}
+	_, ctor, err := providerConstructor(provider, local)
+	if err != nil {
+		return nil, err
+	}
+	upstream, err := describeRemoteModels(ctx, provider, local, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	catalog := make(map[string]models.CatalogEntry)
+	for _, entry := range models.ListCatalog().Models {
+		catalog[entry.ID] = entry
+	}
+	added := make(map[string]bool)
+	for _, remote := range upstream {
+		info, err := models.Resolve(remote.ID)
+		if err == nil && info.Provider == provider {
+			entry, ok := catalog[remote.ID]
+			if ok && refreshModel(&entry.ModelInfo, remote) {
+				if err := models.RegisterModel(entry); err != nil {
+					return nil, fmt.Errorf("updating %s: %w", remote.ID, err)
+				}
+			}
+			continue
+		}
+		pattern := "^" + regexp.QuoteMeta(remote.ID) + "$"
+		entry := models.CatalogEntry{ModelInfo: models.ModelInfo{ID: remote.ID, Provider: provider}, Patterns: []string{pattern}}
+		refreshModel(&entry.ModelInfo, remote)
+		if err := models.RegisterModel(entry); err != nil {
+			return nil, fmt.Errorf("registering %s: %w", remote.ID, err)
+		}
+		if _, err := Resolve(remote.ID); err != nil {
+			Register(pattern, ctor)
+		}
+		added[remote.ID] = true
+	}
+
+	if local, err = providerModels(provider); err != nil {
+		return nil, err
+	}
+	merged := mergeRemoteModels(provider, local, upstream)
+	for i := range merged {
+		merged[i].Added = added[merged[i].ID]
+	}
+	return merged, nil
+}
+
+// refreshModel sets the context window info lacks and the deprecation date of remote, and
+// reports whether info changed.
+func refreshModel(info *models.ModelInfo, remote common.ModelDescription) bool {
+	changed := false
+	if info.ContextWindow == 0 && remote.ContextWindow > 0 {
+		info.ContextWindow = remote.ContextWindow
+		changed = true
+	}
+	if !remote.DeprecatedAt.IsZero() && (info.DeprecatedAt == nil || !info.DeprecatedAt.Equal(remote.DeprecatedAt)) {
+		deprecatedAt := remote.DeprecatedAt
+		info.DeprecatedAt = &deprecatedAt
+		changed = true
+	}
+	return changed
+}
+
+// describeRemoteModels lists provider's models with a client of local, described when its
+// connector implements common.ModelDescriber.
+func describeRemoteModels(ctx context.Context, provider string, local []models.ModelInfo, opts []Option) ([]common.ModelDescription, error) {
+	llm, err := providerClient(provider, local, opts)
+	if err != nil {
+		return nil, err
+	}
+	var upstream []common.ModelDescription
+	switch c := llm.(type) {
+	case common.ModelDescriber:
+		upstream, err = c.DescribeModels(ctx)
+	case common.ModelLister:
+		var ids []string
+		ids, err = c.ListModels(ctx)
+		for _, id := range ids {
+			upstream = append(upstream, common.ModelDescription{ID: id})
+		}
+	default:
+		return nil, fmt.Errorf("provider %s does not support listing models", provider)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("listing %s models: %w", provider, err)
+	}
+	return upstream, nil
+}
+
+// mergeRemoteModels merges the upstream models of provider with its registered models local,
+// sorted by ID.
+func mergeRemoteModels(provider string, local []models.ModelInfo, upstream []common.ModelDescription) []RemoteModel {
+	byID := make(map[string]*RemoteModel)
+	for _, described := range upstream {
+		remote := &RemoteModel{
+			ID:            described.ID,
+			Upstream:      true,
+			DisplayName:   described.DisplayName,
+			ContextWindow: described.ContextWindow,
+			Created:       timeOrNil(described.Created),
+			DeprecatedAt:  timeOrNil(described.DeprecatedAt),
+		}
+		if info, err := models.Resolve(described.ID); err == nil && info.Provider == provider {
+			remote.Registered = true
+		}
+		byID[described.ID] = remote
+	}
+	for _, info := range local {
+		if _, ok := byID[info.ID]; !ok {
+			byID[info.ID] = &RemoteModel{ID: info.ID, Registered: true}
+		}
+	}
+
+	result := make([]RemoteModel, 0, len(byID))
+	for _, remote := range byID {
+		result = append(result, *remote)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].ID < result[j].ID })
+	return result
+}
+
+// timeOrNil returns a pointer to t, or nil when t is zero.
+func timeOrNil(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}
+
+// providerModels returns the registered models of provider, sorted by ID.
+func providerModels(provider string) ([]models.ModelInfo, error) {
+	var local []models.ModelInfo
+	for _, info := range models.ListModelInfos() {
+		if info.Provider == provider {
+			local = append(local, info)
+		}
+	}
+	if len(local) == 0 {
+		return nil, fmt.Errorf("no models registered for provider %s", provider)
+	}
+	return local, nil
+}
+
+// providerConstructor returns the first of local that has a constructor, and its constructor.
+func providerConstructor(provider string, local []models.ModelInfo) (string, constructorFn, error) {
+	for _, info := range local {
+		if ctor, err := Resolve(info.ID); err == nil {
+			return info.ID, ctor, nil
+		}
+	}
+	return "", nil, fmt.Errorf("no connector registered for provider %s", provider)
+}
+
+// providerClient returns a client for the first of local that has a constructor, created
+// with opts and the model's settings. The client is not wrapped by NewLLM's middleware, so
+// that the optional interfaces of its connector are visible.
+func providerClient(provider string, local []models.ModelInfo, opts []Option) (LLM, error) {
+	model, ctor, err := providerConstructor(provider, local)
+	if err != nil {
+		return nil, err
+	}
+	llm, err := ctor(model, append(opts[:len(opts):len(opts)], settingsOptions(model)...)...)
+	if err != nil {
+		return nil, fmt.Errorf("creating %s client: %w", provider, err)
+	}
+	return llm, nil
+}
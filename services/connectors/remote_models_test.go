@@ -0,0 +1,107 @@
+package connectors
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/nexen/models"
+	"github.com/nexen/services/connectors/common"
+)
+
+// listingLLM is a mockLLM whose provider serves a fixed list of models.
+type listingLLM struct {
+	mockLLM
+	upstream []string
+}
+
+func (l *listingLLM) ListModels(ctx context.Context) ([]string, error) {
+	return l.upstream, nil
+}
+
+// describingLLM is a mockLLM whose provider describes its models.
+type describingLLM struct {
+	mockLLM
+	upstream []common.ModelDescription
+}
+
+func (d *describingLLM) ListModels(ctx context.Context) ([]string, error) {
+	return nil, errors.New("ListModels called instead of DescribeModels")
+}
+
+func (d *describingLLM) DescribeModels(ctx context.Context) ([]common.ModelDescription, error) {
+	return d.upstream, nil
+}
+
+func TestListRemoteModels(t *testing.T) {
+	for pattern, id := range map[string]string{"^listprobe-large.*": "listprobe-large", "^listprobe-old$": "listprobe-old"} {
+		if err := models.Register(pattern, models.ModelInfo{ID: id, Provider: "listprobe"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	Register("^listprobe-.*", func(model string, opts ...common.Option) (common.LLM, error) {
+		return &listingLLM{upstream: []string{"listprobe-large-2024", "listprobe-small"}}, nil
+	})
+
+	remote, err := ListRemoteModels(context.Background(), "listprobe")
+	if err != nil {
+		t.Fatalf("ListRemoteModels() error = %v", err)
+	}
+	want := []RemoteModel{
+		{ID: "listprobe-large", Registered: true},
+		{ID: "listprobe-large-2024", Upstream: true, Registered: true},
+		{ID: "listprobe-old", Registered: true},
+		{ID: "listprobe-small", Upstream: true},
+	}
+	if !reflect.DeepEqual(remote, want) {
+		t.Errorf("ListRemoteModels() = %+v, want %+v", remote, want)
+	}
+
+	if _, err := ListRemoteModels(context.Background(), "unknownprobe"); err == nil {
+		t.Error("Expected an error for a provider without registered models")
+	}
+}
+
+func TestSyncRemoteModels(t *testing.T) {
+	retired := time.Date(2026, 6, 1, 0, 0, 0, 0, time.UTC)
+	released := time.Date(2025, 2, 1, 0, 0, 0, 0, time.UTC)
+	if err := models.Register("^syncprobe-large.*", models.ModelInfo{ID: "syncprobe-large", Provider: "syncprobe", Profiles: []string{models.ProfileChat}}); err != nil {
+		t.Fatal(err)
+	}
+	Register("^syncprobe-large.*", func(model string, opts ...common.Option) (common.LLM, error) {
+		return &describingLLM{upstream: []common.ModelDescription{
+			{ID: "syncprobe-large", ContextWindow: 200000, DeprecatedAt: retired},
+			{ID: "syncprobe-large-2025", ContextWindow: 200000},
+			{ID: "syncprobe-mini", DisplayName: "Sync Mini", ContextWindow: 128000, Created: released},
+		}}, nil
+	})
+
+	remote, err := SyncRemoteModels(context.Background(), "syncprobe")
+	if err != nil {
+		t.Fatalf("SyncRemoteModels() error = %v", err)
+	}
+	if len(remote) != 3 || remote[2].ID != "syncprobe-mini" || !remote[2].Added || !remote[2].Registered || remote[2].DisplayName != "Sync Mini" || !remote[2].Created.Equal(released) {
+		t.Errorf("Expected the missing model to be added, got %+v", remote)
+	}
+	if remote[0].Added || remote[1].Added {
+		t.Errorf("Expected registered models not to be added, got %+v", remote)
+	}
+
+	mini, err := models.Resolve("syncprobe-mini")
+	if err != nil || mini.Provider != "syncprobe" || mini.MaxTokens != 128000 || len(mini.Profiles) != 0 {
+		t.Errorf("Expected the added model registered with its context window and no profiles, got %+v, %v", mini, err)
+	}
+	if _, err := Resolve("syncprobe-mini"); err != nil {
+		t.Errorf("Expected the added model bound to the provider's connector, got %v", err)
+	}
+	large, _ := models.Resolve("syncprobe-large")
+	if large.MaxTokens != 200000 || large.DeprecatedAt == nil || !large.DeprecatedAt.Equal(retired) || len(large.Profiles) != 1 {
+		t.Errorf("Expected the registered model refreshed and kept, got %+v", large)
+	}
+	// syncprobe-large-2025 resolves through the pattern of syncprobe-large
+	if got := common.RegisteredModels("syncprobe"); !reflect.DeepEqual(got, []string{"syncprobe-large", "syncprobe-mini"}) {
+		t.Errorf("Expected only the missing model to be added, got %v", got)
+	}
+}
@@ -0,0 +1,122 @@
+package connectors
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/nexen/models"
+	"github.com/nexen/services/connectors/common"
+)
+
+// Gateway headers that let clients influence routing without changing the request payload.
+const (
+	// HeaderProfile names the capability profile the model must support, e.g. "agent".
+	HeaderProfile = "X-Nexen-Profile"
+
+	// HeaderMaxCost is the most the request may cost, in cents.
+	HeaderMaxCost = "X-Nexen-Max-Cost"
+
+	// HeaderPreferProvider ranks a provider's models first, e.g. "anthropic".
+	HeaderPreferProvider = "X-Nexen-Prefer-Provider"
+)
+
+// ErrNoMatchingModel is returned by SelectModel when no registered model meets the requirements.
+var ErrNoMatchingModel = errors.New("no model meets the requirements")
+
+// RequirementsFromHeaders overlays the routing hints in header on base, typically the
+// defaults configured for the route. Headers that are absent leave base unchanged.
+func RequirementsFromHeaders(header http.Header, base models.Requirements) (models.Requirements, error) {
+	req := base
+	if profile := strings.TrimSpace(header.Get(HeaderProfile)); profile != "" {
+		req.Profile = strings.ToLower(profile)
+	}
+	if maxCost := strings.TrimSpace(header.Get(HeaderMaxCost)); maxCost != "" {
+		cents, err := strconv.ParseFloat(maxCost, 64)
+		if err != nil || cents < 0 {
+			return base, fmt.Errorf("%s %q is not a non-negative number of cents", HeaderMaxCost, maxCost)
+		}
+		req.MaxCostCents = cents
+	}
+	if provider := strings.TrimSpace(header.Get(HeaderPreferProvider)); provider != "" {
+		req.PreferProvider = strings.ToLower(provider)
+	}
+	return req, nil
+}
+
+// SelectModel returns the registered model that best meets req for request. Models must
+// support req.Profile and fit req.MaxCostCents for the request's estimated prompt and
+// completion tokens; among those, models DefaultHealthTracker considers healthy come first,
+// then models of req.PreferProvider, then the cheapest for the request.
+func SelectModel(request *models.LLMRequest, req models.Requirements) (models.ModelInfo, error) {
+	usage := estimateUsage(request)
+
+	var candidates []models.ModelInfo
+	cost := make(map[string]float64)
+	for _, info := range models.ListModelInfos() {
+		if req.Profile != "" && !hasProfile(info, req.Profile) {
+			continue
+		}
+		cost[info.ID] = estimateCost(info, usage)
+		if req.MaxCostCents > 0 && cost[info.ID] > req.MaxCostCents {
+			continue
+		}
+		candidates = append(candidates, info)
+	}
+	if len(candidates) == 0 {
+		return models.ModelInfo{}, fmt.Errorf("%w: %+v", ErrNoMatchingModel, req)
+	}
+
+	healthy := make(map[string]bool, len(candidates))
+	for _, info := range candidates {
+		healthy[info.ID] = DefaultHealthTracker.Healthy(info.ID)
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		if hi, hj := healthy[candidates[i].ID], healthy[candidates[j].ID]; hi != hj {
+			return hi
+		}
+		pi := strings.EqualFold(candidates[i].Provider, req.PreferProvider)
+		pj := strings.EqualFold(candidates[j].Provider, req.PreferProvider)
+		if pi != pj {
+			return pi
+		}
+		return cost[candidates[i].ID] < cost[candidates[j].ID]
+	})
+	return candidates[0], nil
+}
+
+// typicalUsage is what models are priced at when there is no request to price, such as when
+// ranking the models of a profile: a thousand tokens, three quarters of them prompt.
+var typicalUsage = models.UsageMetrics{PromptTokens: 750, CompletionTokens: 250, TotalTokens: 1000}
+
+// estimateUsage returns the usage request is expected to have: its estimated prompt tokens and
+// up to its MaxTokens of completion.
+func estimateUsage(request *models.LLMRequest) models.UsageMetrics {
+	total := common.EstimateTokens(request)
+	completion := 0
+	if request.Config != nil {
+		completion = request.Config.MaxTokens
+	}
+	return models.UsageMetrics{PromptTokens: total - completion, CompletionTokens: completion, TotalTokens: total}
+}
+
+// estimateCost returns the cost of usage on the model of info in cents, priced by
+// models.EstimateCost. Models whose ID does not resolve fall back to info's CostPerToken.
+func estimateCost(info models.ModelInfo, usage models.UsageMetrics) float64 {
+	if cents, err := models.EstimateCost(info.ID, usage); err == nil {
+		return cents
+	}
+	return float64(usage.TotalTokens) * info.CostPerToken
+}
+
+func hasProfile(info models.ModelInfo, profile string) bool {
+	for _, p := range info.Profiles {
+		if p == profile {
+			return true
+		}
+	}
+	return false
+}
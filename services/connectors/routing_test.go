@@ -0,0 +1,71 @@
+package connectors
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/nexen/models"
+)
+
+func TestRequirementsFromHeaders(t *testing.T) {
+	base := models.Requirements{Profile: models.ProfileChat, MaxCostCents: 5}
+
+	header := http.Header{}
+	header.Set(HeaderProfile, "Agent")
+	header.Set(HeaderPreferProvider, "anthropic")
+	req, err := RequirementsFromHeaders(header, base)
+	if err != nil {
+		t.Fatalf("RequirementsFromHeaders failed: %v", err)
+	}
+	want := models.Requirements{Profile: models.ProfileAgent, MaxCostCents: 5, PreferProvider: models.ProviderAnthropic}
+	if req != want {
+		t.Errorf("RequirementsFromHeaders() = %+v, want %+v", req, want)
+	}
+
+	header.Set(HeaderMaxCost, "-1")
+	if _, err := RequirementsFromHeaders(header, base); err == nil {
+		t.Error("Expected an error for a negative max cost")
+	}
+}
+
+func TestSelectModel(t *testing.T) {
+	const profile = "routingprobe"
+	for _, info := range []models.ModelInfo{
+		{ID: "routingprobe-cheap", Profiles: []string{profile}, CostPerToken: 0.001, Provider: "probe-a"},
+		{ID: "routingprobe-mid", Profiles: []string{profile}, CostPerToken: 0.01, Provider: "probe-b"},
+		{ID: "routingprobe-premium", Profiles: []string{profile}, CostPerToken: 1, Provider: "probe-b"},
+		// Priced per million tokens only: about 1 cent for the request below
+		{ID: "routingprobe-metered", Profiles: []string{profile}, InputCostPerMTok: 1000, OutputCostPerMTok: 1000, Provider: "probe-c"},
+	} {
+		if err := models.Register("^"+info.ID+"$", info); err != nil {
+			t.Fatalf("models.Register failed: %v", err)
+		}
+	}
+	// About 10 tokens
+	request := &models.LLMRequest{Contents: []models.Content{{Role: "user", Message: "What is the capital of France?"}}}
+
+	testCases := []struct {
+		name string
+		req  models.Requirements
+		want string
+	}{
+		{"cheapest", models.Requirements{Profile: profile}, "routingprobe-cheap"},
+		{"preferred provider", models.Requirements{Profile: profile, PreferProvider: "probe-b"}, "routingprobe-mid"},
+		{"preferred over budget", models.Requirements{Profile: profile, PreferProvider: "probe-b", MaxCostCents: 0.05}, "routingprobe-cheap"},
+		{"preferred per-MTok pricing", models.Requirements{Profile: profile, PreferProvider: "probe-c"}, "routingprobe-metered"},
+		{"per-MTok pricing over budget", models.Requirements{Profile: profile, PreferProvider: "probe-c", MaxCostCents: 0.05}, "routingprobe-cheap"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			info, err := SelectModel(request, tc.req)
+			if err != nil || info.ID != tc.want {
+				t.Errorf("SelectModel() = %s, %v, want %s", info.ID, err, tc.want)
+			}
+		})
+	}
+
+	if _, err := SelectModel(request, models.Requirements{Profile: profile, MaxCostCents: 0.001}); !errors.Is(err, ErrNoMatchingModel) {
+		t.Errorf("Expected ErrNoMatchingModel, got %v", err)
+	}
+}
@@ -0,0 +1,270 @@
+// Package savings measures what caching saves, so platform owners can justify or tune their
+// caching policies.
+//
+// A Recorder observes responses through its middleware and accumulates, per tenant and model,
+// how many calls each cache answered and the tokens and cents it saved:
+//
+//   - response caches, such as the cache package, save the whole call: its tokens and its
+//     cost at the model's prices;
+//   - provider prompt caching saves the difference between the full and the cached prompt
+//     price, net of the premium paid for cache writes, which can make it negative.
+//
+// Place the middleware outside the response cache so that cache hits are observed.
+package savings
+
+import (
+	"context"
+	"log/slog"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/nexen/libs/nexenctx"
+	"github.com/nexen/models"
+	"github.com/nexen/services/connectors/cache"
+	"github.com/nexen/services/connectors/common"
+)
+
+// Sources of savings.
+const (
+	// SourceExact is the response cache of the cache package.
+	SourceExact = "exact"
+
+	// SourcePrompt is the provider's prompt caching.
+	SourcePrompt = "prompt"
+)
+
+// Options configures what a Recorder's middleware observes.
+type Options struct {
+	// HitKeys maps response cache sources to the CustomMetadata key their hits are marked
+	// with, e.g. a semantic cache. Nil means {SourceExact: cache.MetadataKey}.
+	HitKeys map[string]string
+}
+
+// SourceSavings are the savings of one source.
+type SourceSavings struct {
+	// Hits is the number of calls the source answered or discounted.
+	Hits int64 `json:"hits"`
+
+	// TokensSaved is the number of tokens not paid for at the full price.
+	TokensSaved int64 `json:"tokensSaved"`
+
+	// CentsSaved is the estimated cost saved in cents.
+	CentsSaved float64 `json:"centsSaved"`
+}
+
+// Savings are the savings of one tenant on one model.
+type Savings struct {
+	Tenant string `json:"tenant"`
+	Model  string `json:"model"`
+
+	// Requests is the number of calls observed.
+	Requests int64 `json:"requests"`
+
+	// Sources holds the savings of each source that saved anything.
+	Sources map[string]SourceSavings `json:"sources"`
+}
+
+// HitRate returns the fraction of requests answered or discounted by source.
+func (s Savings) HitRate(source string) float64 {
+	if s.Requests == 0 {
+		return 0
+	}
+	return float64(s.Sources[source].Hits) / float64(s.Requests)
+}
+
+// Report is the savings of a period, sorted by tenant and model.
+type Report struct {
+	Start   time.Time `json:"start"`
+	End     time.Time `json:"end"`
+	Savings []Savings `json:"savings"`
+}
+
+// CentsSaved returns the cents saved by all sources in the report.
+func (r Report) CentsSaved() float64 {
+	var total float64
+	for _, s := range r.Savings {
+		for _, source := range s.Sources {
+			total += source.CentsSaved
+		}
+	}
+	return total
+}
+
+// key identifies the savings of a tenant on a model.
+type key struct {
+	tenant, model string
+}
+
+// Recorder accumulates savings. It is safe for concurrent use.
+type Recorder struct {
+	mu          sync.Mutex
+	start       time.Time
+	periodStart time.Time
+	total       map[key]*Savings
+	period      map[key]*Savings
+}
+
+// NewRecorder returns an empty Recorder.
+func NewRecorder() *Recorder {
+	now := time.Now()
+	return &Recorder{start: now, periodStart: now, total: make(map[key]*Savings), period: make(map[key]*Savings)}
+}
+
+// Middleware returns a common.Middleware that records the savings of every call.
+func (r *Recorder) Middleware(opts Options) common.Middleware {
+	if opts.HitKeys == nil {
+		opts.HitKeys = map[string]string{SourceExact: cache.MetadataKey}
+	}
+	return func(next common.LLM) common.LLM {
+		return &recordingLLM{LLM: next, recorder: r, opts: opts}
+	}
+}
+
+// Snapshot returns the savings since the Recorder was created.
+func (r *Recorder) Snapshot() Report {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return report(r.start, time.Now(), r.total)
+}
+
+// Flush returns the savings since the previous Flush and starts a new period.
+func (r *Recorder) Flush() Report {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	now := time.Now()
+	rep := report(r.periodStart, now, r.period)
+	r.periodStart, r.period = now, make(map[key]*Savings)
+	return rep
+}
+
+// Run calls publish with the report of each interval until ctx is done. A nil publish logs
+// the reports with LogReport.
+func (r *Recorder) Run(ctx context.Context, interval time.Duration, publish func(Report)) {
+	if publish == nil {
+		publish = LogReport
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			publish(r.Flush())
+		}
+	}
+}
+
+// LogReport logs one line per tenant, model and source of the report.
+func LogReport(rep Report) {
+	for _, s := range rep.Savings {
+		for name, source := range s.Sources {
+			slog.Info("cache savings",
+				"tenant", s.Tenant, "model", s.Model, "source", name,
+				"requests", s.Requests, "hits", source.Hits, "hit_rate", s.HitRate(name),
+				"tokens_saved", source.TokensSaved, "cents_saved", source.CentsSaved,
+				"period", rep.End.Sub(rep.Start))
+		}
+	}
+}
+
+// record adds the savings of one call.
+func (r *Recorder) record(tenant, model string, saved map[string]SourceSavings) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, m := range []map[key]*Savings{r.total, r.period} {
+		s, ok := m[key{tenant, model}]
+		if !ok {
+			s = &Savings{Tenant: tenant, Model: model, Sources: make(map[string]SourceSavings)}
+			m[key{tenant, model}] = s
+		}
+		s.Requests++
+		for name, add := range saved {
+			source := s.Sources[name]
+			source.Hits += add.Hits
+			source.TokensSaved += add.TokensSaved
+			source.CentsSaved += add.CentsSaved
+			s.Sources[name] = source
+		}
+	}
+}
+
+// report copies savings into a sorted Report.
+func report(start, end time.Time, savings map[key]*Savings) Report {
+	rep := Report{Start: start, End: end, Savings: make([]Savings, 0, len(savings))}
+	for _, s := range savings {
+		sources := make(map[string]SourceSavings, len(s.Sources))
+		for name, source := range s.Sources {
+			sources[name] = source
+		}
+		rep.Savings = append(rep.Savings, Savings{Tenant: s.Tenant, Model: s.Model, Requests: s.Requests, Sources: sources})
+	}
+	sort.Slice(rep.Savings, func(i, j int) bool {
+		if rep.Savings[i].Tenant != rep.Savings[j].Tenant {
+			return rep.Savings[i].Tenant < rep.Savings[j].Tenant
+		}
+		return rep.Savings[i].Model < rep.Savings[j].Model
+	})
+	return rep
+}
+
+// recordingLLM records the savings of the wrapped LLM's responses.
+type recordingLLM struct {
+	common.LLM
+	recorder *Recorder
+	opts     Options
+}
+
+// Call implements the LLM interface Call method.
+func (l *recordingLLM) Call(ctx context.Context, request *models.LLMRequest) (*models.LLMResponse, error) {
+	response, err := l.LLM.Call(ctx, request)
+	if err != nil || response == nil || response.IsError() {
+		return response, err
+	}
+
+	model := request.Model
+	if namer, ok := l.LLM.(common.ModelNamer); ok && model == "" {
+		model = namer.Model()
+	}
+	tenant := request.Metadata.TenantID
+	if tenant == "" {
+		tenant, _ = nexenctx.TenantFrom(ctx)
+	}
+	l.recorder.record(tenant, model, l.saved(model, response))
+	return response, nil
+}
+
+// BatchCall implements the LLM interface BatchCall method.
+func (l *recordingLLM) BatchCall(ctx context.Context, requests []*models.LLMRequest) ([]*models.LLMResponse, error) {
+	return common.BatchCall(ctx, requests, common.DefaultBatchConcurrency, l.Call)
+}
+
+// saved returns what each source saved on response.
+func (l *recordingLLM) saved(model string, response *models.LLMResponse) map[string]SourceSavings {
+	usage := response.Usage
+	for name, metadataKey := range l.opts.HitKeys {
+		if hit, _ := response.CustomMetadata[metadataKey].(bool); hit {
+			// The provider was not called: the whole call was saved
+			cents, _ := models.EstimateCost(model, usage)
+			return map[string]SourceSavings{name: {Hits: 1, TokensSaved: int64(usage.TotalTokens), CentsSaved: cents}}
+		}
+	}
+
+	if usage.CachedPromptTokens == 0 && usage.CacheWritePromptTokens == 0 {
+		return nil
+	}
+	actual, err := models.EstimateCost(model, usage)
+	if err != nil {
+		return nil
+	}
+	uncached := usage
+	uncached.CachedPromptTokens, uncached.CacheWritePromptTokens = 0, 0
+	full, _ := models.EstimateCost(model, uncached)
+
+	prompt := SourceSavings{TokensSaved: int64(usage.CachedPromptTokens), CentsSaved: full - actual}
+	if usage.CachedPromptTokens > 0 {
+		prompt.Hits = 1
+	}
+	return map[string]SourceSavings{SourcePrompt: prompt}
+}
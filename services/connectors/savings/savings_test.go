@@ -0,0 +1,90 @@
+package savings
+
+import (
+	"context"
+	"errors"
+	"math"
+	"testing"
+
+	"github.com/nexen/libs/nexenctx"
+	"github.com/nexen/models"
+	"github.com/nexen/services/connectors/cache"
+)
+
+// scriptedLLM returns its responses in order.
+type scriptedLLM struct {
+	responses []*models.LLMResponse
+}
+
+func (s *scriptedLLM) Call(ctx context.Context, request *models.LLMRequest) (*models.LLMResponse, error) {
+	response := s.responses[0]
+	s.responses = s.responses[1:]
+	return response, nil
+}
+
+func (s *scriptedLLM) BatchCall(ctx context.Context, requests []*models.LLMRequest) ([]*models.LLMResponse, error) {
+	return nil, errors.New("not used")
+}
+
+func (s *scriptedLLM) SupportedModels() []string { return []string{"savingsprobe"} }
+
+func TestRecorder(t *testing.T) {
+	// $10 per million input tokens, $1 cached, $12.50 for cache writes, $30 output
+	err := models.Register("^savingsprobe$", models.ModelInfo{ID: "savingsprobe", Provider: "savingsprobe",
+		InputCostPerMTok: 10, CachedInputCostPerMTok: 1, CacheWriteCostPerMTok: 12.5, OutputCostPerMTok: 30})
+	if err != nil {
+		t.Fatal(err)
+	}
+	llm := &scriptedLLM{responses: []*models.LLMResponse{
+		// Served from the response cache
+		{CustomMetadata: map[string]any{cache.MetadataKey: true}, Usage: models.UsageMetrics{PromptTokens: 1000, CompletionTokens: 100, TotalTokens: 1100}},
+		// Writes the prompt cache
+		{Usage: models.UsageMetrics{PromptTokens: 10000, CacheWritePromptTokens: 10000, TotalTokens: 10000}},
+		// Reads the prompt cache
+		{Usage: models.UsageMetrics{PromptTokens: 10000, CachedPromptTokens: 10000, TotalTokens: 10000}},
+		// No caching
+		{Usage: models.UsageMetrics{PromptTokens: 100, TotalTokens: 100}},
+	}}
+	recorder := NewRecorder()
+	observed := recorder.Middleware(Options{})(llm)
+
+	ctx := nexenctx.WithTenant(context.Background(), "acme")
+	request := &models.LLMRequest{Model: "savingsprobe", Contents: []models.Content{{Role: "user", Message: "hi"}}}
+	for i := 0; i < 3; i++ {
+		observed.Call(ctx, request)
+	}
+	// The request's metadata names the tenant without a context
+	attributed := *request
+	attributed.Metadata = models.RequestMetadata{TenantID: "globex"}
+	observed.Call(context.Background(), &attributed)
+
+	rep := recorder.Flush()
+	if len(rep.Savings) != 2 || rep.Savings[0].Tenant != "acme" || rep.Savings[1].Tenant != "globex" {
+		t.Fatalf("Expected savings for two tenants, got %+v", rep.Savings)
+	}
+	acme := rep.Savings[0]
+	exact := acme.Sources[SourceExact]
+	// 1000 * $10 + 100 * $30 per million = 1.3 cents
+	if acme.Requests != 3 || exact.Hits != 1 || exact.TokensSaved != 1100 || !near(exact.CentsSaved, 1.3) {
+		t.Errorf("Unexpected exact cache savings %+v of %d requests", exact, acme.Requests)
+	}
+	prompt := acme.Sources[SourcePrompt]
+	// The write cost 2.5 cents extra, the read saved 9 cents
+	if prompt.Hits != 1 || prompt.TokensSaved != 10000 || !near(prompt.CentsSaved, 6.5) {
+		t.Errorf("Unexpected prompt cache savings %+v", prompt)
+	}
+	if !near(acme.HitRate(SourceExact), 1.0/3) || !near(rep.CentsSaved(), 7.8) {
+		t.Errorf("Unexpected hit rate %v or total %v", acme.HitRate(SourceExact), rep.CentsSaved())
+	}
+
+	if len(recorder.Flush().Savings) != 0 {
+		t.Error("Expected Flush to start a new period")
+	}
+	if total := recorder.Snapshot(); len(total.Savings) != 2 {
+		t.Errorf("Expected the snapshot to keep the totals, got %+v", total.Savings)
+	}
+}
+
+func near(a, b float64) bool {
+	return math.Abs(a-b) < 1e-9
+}
@@ -0,0 +1,151 @@
+// Package selection ranks the models that can serve a capability profile.
+//
+// The connectors package asks the Strategy named by the model_selection.strategy setting to
+// order the registered models of a profile, and uses the first one the request's tenant may
+// use. Three strategies are built in; teams can plug in their own routing algorithms by
+// registering a Strategy under a new name, typically from an init function:
+//
+//	func init() {
+//		selection.Register("carbon", selection.StrategyFunc(rankByCarbon))
+//	}
+//
+// and selecting it with connectors.SetSelectionStrategy("carbon").
+package selection
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/nexen/models"
+)
+
+// Names of the built-in strategies.
+const (
+	Cost        = "cost"        // cheapest model first
+	Performance = "performance" // highest cost tier first, then the fastest, then the most expensive
+	Balanced    = "balanced"    // standard tier first, then the cheapest
+)
+
+// Candidate is a model that can serve the profile being selected for, with what is known of
+// its recent traffic.
+type Candidate struct {
+	models.ModelInfo
+
+	// Healthy is false when the model has recently been failing most calls.
+	Healthy bool
+
+	// LatencyMs is the moving average latency of the model's calls, or 0 when unknown.
+	LatencyMs float64
+
+	// CostCents is the estimated cost of a typical request on the model, in cents, from the
+	// model's per-direction prices when it has them.
+	CostCents float64
+}
+
+// Strategy orders the candidate models of a profile, best first. Models left out of the
+// result are not used. Rank may reorder the candidates slice in place.
+type Strategy interface {
+	Rank(profile string, candidates []Candidate) []Candidate
+}
+
+// StrategyFunc adapts a function to the Strategy interface.
+type StrategyFunc func(profile string, candidates []Candidate) []Candidate
+
+// Rank implements the Strategy interface by calling f.
+func (f StrategyFunc) Rank(profile string, candidates []Candidate) []Candidate {
+	return f(profile, candidates)
+}
+
+var (
+	mu         sync.RWMutex
+	strategies = map[string]Strategy{
+		Cost:        ranking(Cost),
+		Performance: ranking(Performance),
+		Balanced:    ranking(Balanced),
+	}
+)
+
+// Register makes strategy available under name, case-insensitively. Registering a name again,
+// including a built-in one, replaces its strategy.
+func Register(name string, strategy Strategy) error {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if name == "" {
+		return fmt.Errorf("selection strategy name must not be empty")
+	}
+	if strategy == nil {
+		return fmt.Errorf("selection strategy %q is nil", name)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	strategies[name] = strategy
+	return nil
+}
+
+// Lookup returns the strategy registered under name, and whether there is one.
+func Lookup(name string) (Strategy, bool) {
+	mu.RLock()
+	defer mu.RUnlock()
+	strategy, ok := strategies[strings.ToLower(name)]
+	return strategy, ok
+}
+
+// Names returns the names of the registered strategies, sorted.
+func Names() []string {
+	mu.RLock()
+	defer mu.RUnlock()
+	names := make([]string, 0, len(strategies))
+	for name := range strategies {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ranking is a built-in strategy. Each ranks healthy models first.
+type ranking string
+
+// Rank implements the Strategy interface.
+func (r ranking) Rank(_ string, candidates []Candidate) []Candidate {
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return r.before(candidates[i], candidates[j])
+	})
+	return candidates
+}
+
+// before reports whether a ranks before b. Ties go to the lower model ID.
+func (r ranking) before(a, b Candidate) bool {
+	if a.Healthy != b.Healthy {
+		return a.Healthy
+	}
+	switch r {
+	case Performance:
+		if ra, rb := costTierRank[a.CostTier], costTierRank[b.CostTier]; ra != rb {
+			return ra > rb
+		}
+		if a.LatencyMs > 0 && b.LatencyMs > 0 && a.LatencyMs != b.LatencyMs {
+			return a.LatencyMs < b.LatencyMs
+		}
+		if a.CostCents != b.CostCents {
+			return a.CostCents > b.CostCents
+		}
+	case Balanced:
+		if sa, sb := a.CostTier == models.CostTierStandard, b.CostTier == models.CostTierStandard; sa != sb {
+			return sa
+		}
+		fallthrough
+	default:
+		if a.CostCents != b.CostCents {
+			return a.CostCents < b.CostCents
+		}
+	}
+	return a.ID < b.ID
+}
+
+// costTierRank orders the cost tiers from the cheapest.
+var costTierRank = map[models.CostTier]int{
+	models.CostTierBasic:    1,
+	models.CostTierStandard: 2,
+	models.CostTierPremium:  3,
+}
@@ -0,0 +1,75 @@
+package selection
+
+import (
+	"testing"
+
+	"github.com/nexen/models"
+)
+
+func candidates() []Candidate {
+	return []Candidate{
+		{ModelInfo: models.ModelInfo{ID: "premium-slow", CostTier: models.CostTierPremium}, CostCents: 0.1, Healthy: true, LatencyMs: 900},
+		{ModelInfo: models.ModelInfo{ID: "premium-fast", CostTier: models.CostTierPremium}, CostCents: 0.2, Healthy: true, LatencyMs: 300},
+		{ModelInfo: models.ModelInfo{ID: "standard", CostTier: models.CostTierStandard}, CostCents: 0.01, Healthy: true},
+		{ModelInfo: models.ModelInfo{ID: "basic", CostTier: models.CostTierBasic}, CostCents: 0.001, Healthy: true},
+		{ModelInfo: models.ModelInfo{ID: "basic-failing", CostTier: models.CostTierBasic}, CostCents: 0.0001},
+	}
+}
+
+func TestBuiltInStrategies(t *testing.T) {
+	testCases := []struct {
+		name string
+		want []string
+	}{
+		{Cost, []string{"basic", "standard", "premium-slow", "premium-fast", "basic-failing"}},
+		{Performance, []string{"premium-fast", "premium-slow", "standard", "basic", "basic-failing"}},
+		{Balanced, []string{"standard", "basic", "premium-slow", "premium-fast", "basic-failing"}},
+	}
+	for _, tc := range testCases {
+		strategy, ok := Lookup(tc.name)
+		if !ok {
+			t.Fatalf("Strategy %s is not registered", tc.name)
+		}
+		ranked := strategy.Rank("chat", candidates())
+		for i, want := range tc.want {
+			if ranked[i].ID != want {
+				t.Errorf("%s: position %d = %s, want %s", tc.name, i, ranked[i].ID, want)
+			}
+		}
+	}
+}
+
+func TestRegister(t *testing.T) {
+	defer func() {
+		mu.Lock()
+		delete(strategies, "reverse")
+		mu.Unlock()
+	}()
+
+	reverse := StrategyFunc(func(_ string, c []Candidate) []Candidate {
+		for i, j := 0, len(c)-1; i < j; i, j = i+1, j-1 {
+			c[i], c[j] = c[j], c[i]
+		}
+		return c
+	})
+	if err := Register(" Reverse ", reverse); err != nil {
+		t.Fatal(err)
+	}
+	strategy, ok := Lookup("REVERSE")
+	if !ok {
+		t.Fatal("Expected the strategy under its lowercase name")
+	}
+	if ranked := strategy.Rank("chat", candidates()); ranked[0].ID != "basic-failing" {
+		t.Errorf("Expected the registered strategy to rank, got %s first", ranked[0].ID)
+	}
+	if names := Names(); len(names) != 4 || names[3] != "reverse" {
+		t.Errorf("Names() = %v", names)
+	}
+
+	if err := Register("", reverse); err == nil {
+		t.Error("Expected an error for an empty name")
+	}
+	if err := Register("nil", nil); err == nil {
+		t.Error("Expected an error for a nil strategy")
+	}
+}
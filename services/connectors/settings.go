@@ -0,0 +1,159 @@
+package connectors
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/nexen/models"
+	"github.com/nexen/services/connectors/common"
+)
+
+// ProviderSettings holds runtime overrides applied to every client created for a provider.
+// Zero values leave the corresponding caller-supplied option untouched.
+type ProviderSettings struct {
+	// EndpointOverride replaces the provider's base endpoint.
+	EndpointOverride string `json:"endpointOverride,omitempty"`
+
+	// APIKeyAlias names an API key registered with SetAPIKeyAlias.
+	APIKeyAlias string `json:"apiKeyAlias,omitempty"`
+
+	// Timeout specifies the request timeout in seconds.
+	Timeout int `json:"timeout,omitempty"`
+
+	// RequestsPerMinute and TokensPerMinute limit each API key of the provider.
+	RequestsPerMinute int `json:"requestsPerMinute,omitempty"`
+	TokensPerMinute   int `json:"tokensPerMinute,omitempty"`
+
+	// ServiceTier is the service tier requests are sent with, e.g. models.ServiceTierPriority.
+	ServiceTier string `json:"serviceTier,omitempty"`
+}
+
+var (
+	settingsMu      sync.RWMutex
+	providerConfigs = make(map[string]ProviderSettings) // provider -> settings
+	apiKeyAliases   = make(map[string]string)           // alias -> API key
+	settingsVersion uint64
+)
+
+func init() {
+	// Pooled clients are rebuilt when a registration changes, e.g. a model's provider or limits
+	models.Subscribe(func(models.RegistryEvent) {
+		settingsMu.Lock()
+		defer settingsMu.Unlock()
+		settingsVersion++
+	})
+}
+
+// SetProviderSettings stores the runtime overrides for a provider.
+// Clients created afterwards pick up the new settings; pooled clients are rebuilt on next use.
+func SetProviderSettings(provider string, settings ProviderSettings) {
+	settingsMu.Lock()
+	defer settingsMu.Unlock()
+	providerConfigs[provider] = settings
+	settingsVersion++
+}
+
+// GetProviderSettings returns the runtime overrides for a provider, if any.
+func GetProviderSettings(provider string) (ProviderSettings, bool) {
+	settingsMu.RLock()
+	defer settingsMu.RUnlock()
+	settings, ok := providerConfigs[provider]
+	return settings, ok
+}
+
+// DeleteProviderSettings removes the runtime overrides for a provider.
+func DeleteProviderSettings(provider string) {
+	settingsMu.Lock()
+	defer settingsMu.Unlock()
+	if _, ok := providerConfigs[provider]; ok {
+		delete(providerConfigs, provider)
+		settingsVersion++
+	}
+}
+
+// ListProviderSettings returns a copy of all provider overrides.
+func ListProviderSettings() map[string]ProviderSettings {
+	settingsMu.RLock()
+	defer settingsMu.RUnlock()
+
+	out := make(map[string]ProviderSettings, len(providerConfigs))
+	for provider, settings := range providerConfigs {
+		out[provider] = settings
+	}
+	return out
+}
+
+// SetAPIKeyAlias registers (or replaces) the API key behind an alias.
+func SetAPIKeyAlias(alias, apiKey string) {
+	settingsMu.Lock()
+	defer settingsMu.Unlock()
+	apiKeyAliases[alias] = apiKey
+	settingsVersion++
+}
+
+// DeleteAPIKeyAlias removes an API key alias.
+func DeleteAPIKeyAlias(alias string) {
+	settingsMu.Lock()
+	defer settingsMu.Unlock()
+	if _, ok := apiKeyAliases[alias]; ok {
+		delete(apiKeyAliases, alias)
+		settingsVersion++
+	}
+}
+
+// ListAPIKeyAliases returns the registered alias names, sorted. Keys are never returned.
+func ListAPIKeyAliases() []string {
+	settingsMu.RLock()
+	defer settingsMu.RUnlock()
+
+	aliases := make([]string, 0, len(apiKeyAliases))
+	for alias := range apiKeyAliases {
+		aliases = append(aliases, alias)
+	}
+	sort.Strings(aliases)
+	return aliases
+}
+
+// currentSettingsVersion returns a counter that changes whenever any override or model
+// registration changes.
+func currentSettingsVersion() uint64 {
+	settingsMu.RLock()
+	defer settingsMu.RUnlock()
+	return settingsVersion
+}
+
+// settingsOptions returns the options derived from the provider overrides for a model.
+// The model's provider is looked up in the models registry; unknown models get no overrides.
+func settingsOptions(model string) []Option {
+	info, err := models.Resolve(model)
+	if err != nil {
+		return nil
+	}
+
+	settingsMu.RLock()
+	defer settingsMu.RUnlock()
+	settings, ok := providerConfigs[info.Provider]
+	if !ok {
+		return nil
+	}
+
+	var opts []Option
+	if settings.EndpointOverride != "" {
+		opts = append(opts, common.WithEndpoint(settings.EndpointOverride))
+	}
+	if settings.APIKeyAlias != "" {
+		if apiKey, found := apiKeyAliases[settings.APIKeyAlias]; found {
+			opts = append(opts, common.WithAPIKey(apiKey))
+		}
+	}
+	if settings.Timeout > 0 {
+		opts = append(opts, common.WithTimeout(settings.Timeout))
+	}
+	if settings.RequestsPerMinute > 0 || settings.TokensPerMinute > 0 {
+		opts = append(opts, common.WithRateLimit(settings.RequestsPerMinute, settings.TokensPerMinute))
+	}
+	if settings.ServiceTier != "" {
+		opts = append(opts, common.WithServiceTier(settings.ServiceTier))
+	}
+	return opts
+}
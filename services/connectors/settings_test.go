@@ -0,0 +1,435 @@
+package connectors
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nexen/models"
+	"github.com/nexen/services/connectors/common"
+)
+
+// configLLM records the configuration it was constructed with.
+type configLLM struct {
+	mockLLM
+	config *common.LLMConfig
+}
+
+func configConstructor(model string, opts ...common.Option) (common.LLM, error) {
+	config := common.DefaultLLMConfig()
+	if err := common.ApplyOptions(config, opts...); err != nil {
+		return nil, err
+	}
+	return &configLLM{config: config}, nil
+}
+
+// testAdminToken authorizes the test requests to AdminHandler.
+const testAdminToken = "admin-test-token"
+
+// authorizedAdminHandler returns an AdminHandler that sees every request with testAdminToken.
+func authorizedAdminHandler() http.Handler {
+	handler := AdminHandler(testAdminToken)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.Header.Set("Authorization", "Bearer "+testAdminToken)
+		handler.ServeHTTP(w, r)
+	})
+}
+
+func TestProviderSettingsAppliedToNewClients(t *testing.T) {
+	if err := models.Register("^settingsprobe-.*", models.ModelInfo{Provider: "settingsprobe"}); err != nil {
+		t.Fatalf("models.Register failed: %v", err)
+	}
+	Register("^settingsprobe-.*", configConstructor)
+	defer DeleteProviderSettings("settingsprobe")
+	defer DeleteAPIKeyAlias("primary")
+
+	SetAPIKeyAlias("primary", "key-from-alias")
+	SetProviderSettings("settingsprobe", ProviderSettings{
+		EndpointOverride: "https://example.test/v1",
+		APIKeyAlias:      "primary",
+		Timeout:          7,
+		TokensPerMinute:  5000,
+	})
+
+	llm, err := NewLLM("settingsprobe-model", common.WithAPIKey("caller-key"))
+	if err != nil {
+		t.Fatalf("NewLLM failed: %v", err)
+	}
+	config := llm.(*capableLLM).LLM.(*meteredLLM).LLM.(*configLLM).config
+	if config.EndpointOverride != "https://example.test/v1" {
+		t.Errorf("Expected endpoint override, got %q", config.EndpointOverride)
+	}
+	if config.APIKey != "key-from-alias" {
+		t.Errorf("Expected aliased API key, got %q", config.APIKey)
+	}
+	if config.Timeout != 7 {
+		t.Errorf("Expected timeout 7, got %d", config.Timeout)
+	}
+	if config.RateLimit.TokensPerMinute != 5000 {
+		t.Errorf("Expected 5000 tokens per minute, got %+v", config.RateLimit)
+	}
+}
+
+func TestPoolRefreshesOnSettingsChange(t *testing.T) {
+	if err := models.Register("^poolprobe-.*", models.ModelInfo{Provider: "poolprobe"}); err != nil {
+		t.Fatalf("models.Register failed: %v", err)
+	}
+	Register("^poolprobe-.*", configConstructor)
+	defer DeleteProviderSettings("poolprobe")
+
+	pool := NewPool()
+	first, err := pool.Get("poolprobe-model")
+	if err != nil {
+		t.Fatalf("Get failed: %v", err)
+	}
+	again, _ := pool.Get("poolprobe-model")
+	if first != again {
+		t.Fatal("Expected pooled client to be reused")
+	}
+
+	SetProviderSettings("poolprobe", ProviderSettings{Timeout: 3})
+	refreshed, _ := pool.Get("poolprobe-model")
+	if refreshed == first {
+		t.Fatal("Expected pooled client to be rebuilt after settings change")
+	}
+	if refreshed.(*capableLLM).LLM.(*meteredLLM).LLM.(*configLLM).config.Timeout != 3 {
+		t.Errorf("Expected refreshed client timeout 3, got %d", refreshed.(*capableLLM).LLM.(*meteredLLM).LLM.(*configLLM).config.Timeout)
+	}
+
+	if err := models.Register("^poolprobe-.*", models.ModelInfo{Provider: "poolprobe", MaxTokens: 1000}); err != nil {
+		t.Fatal(err)
+	}
+	if reregistered, _ := pool.Get("poolprobe-model"); reregistered == refreshed {
+		t.Error("Expected pooled client to be rebuilt after the model's registration changed")
+	}
+}
+
+func TestPoolFollowsModelAliases(t *testing.T) {
+	for _, id := range []string{"aliaspoolprobe-a", "aliaspoolprobe-b"} {
+		if err := models.Register("^"+id+"$", models.ModelInfo{ID: id, Provider: "aliaspoolprobe"}); err != nil {
+			t.Fatalf("models.Register failed: %v", err)
+		}
+	}
+	Register("^aliaspoolprobe-.*", configConstructor)
+	defer models.DeleteAlias("aliaspoolprobe-fast")
+
+	if err := models.RegisterAlias("aliaspoolprobe-fast", "aliaspoolprobe-a"); err != nil {
+		t.Fatal(err)
+	}
+	pool := NewPool()
+	llm, err := pool.Get("aliaspoolprobe-fast")
+	if err != nil || llm.(common.ModelNamer).Model() != "aliaspoolprobe-a" {
+		t.Fatalf("Get() = %v, %v, want a client for aliaspoolprobe-a", llm, err)
+	}
+
+	if err := models.RegisterAlias("aliaspoolprobe-fast", "aliaspoolprobe-b"); err != nil {
+		t.Fatal(err)
+	}
+	if llm, err := pool.Get("aliaspoolprobe-fast"); err != nil || llm.(common.ModelNamer).Model() != "aliaspoolprobe-b" {
+		t.Errorf("Get() after the swap = %v, %v, want a client for aliaspoolprobe-b", llm, err)
+	}
+}
+
+func TestAdminAliases(t *testing.T) {
+	defer models.DeleteAlias("adminaliasprobe")
+	handler := authorizedAdminHandler()
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPut, "/aliases/adminaliasprobe", strings.NewReader(`{"model":"gpt-4o-mini"}`)))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("PUT alias: expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if model, ok := models.ResolveAlias("adminaliasprobe"); !ok || model != "gpt-4o-mini" {
+		t.Errorf("ResolveAlias() = %q, %v", model, ok)
+	}
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/aliases?model=gpt-4o-mini", nil))
+	if !strings.Contains(rec.Body.String(), `"alias":"adminaliasprobe"`) {
+		t.Errorf("Expected the alias in the listing, got %s", rec.Body.String())
+	}
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPut, "/aliases/adminaliasprobe", strings.NewReader(`{"model":"adminaliasprobe"}`)))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for an alias of itself, got %d", rec.Code)
+	}
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodDelete, "/aliases/adminaliasprobe", nil))
+	if _, ok := models.ResolveAlias("adminaliasprobe"); rec.Code != http.StatusNoContent || ok {
+		t.Errorf("DELETE alias: got %d, alias still registered: %v", rec.Code, ok)
+	}
+}
+
+func TestAdminStats(t *testing.T) {
+	defer DefaultHealthTracker.Reset()
+	DefaultHealthTracker.Observe("adminstatsprobe", 20*time.Millisecond, nil)
+	handler := authorizedAdminHandler()
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/stats?healthy=true", nil))
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"model":"adminstatsprobe"`) {
+		t.Errorf("Expected the model in the listing, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/stats/adminstatsprobe", nil))
+	var stats ModelStats
+	if err := json.NewDecoder(rec.Body).Decode(&stats); err != nil || stats.Requests != 1 || stats.P50Ms != 20 {
+		t.Errorf("Unexpected stats %+v (%v)", stats, err)
+	}
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/stats/unseen", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 for an unobserved model, got %d", rec.Code)
+	}
+}
+
+func TestAdminHandler(t *testing.T) {
+	defer DeleteProviderSettings("admin-test")
+	defer DeleteAPIKeyAlias("admin-alias")
+	handler := authorizedAdminHandler()
+
+	req := httptest.NewRequest(http.MethodPut, "/providers/admin-test", strings.NewReader(`{"endpointOverride":"https://admin.test","timeout":12}`))
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("PUT provider: expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	settings, ok := GetProviderSettings("admin-test")
+	if !ok || settings.Timeout != 12 || settings.EndpointOverride != "https://admin.test" {
+		t.Fatalf("Unexpected settings after PUT: %+v", settings)
+	}
+
+	req = httptest.NewRequest(http.MethodPut, "/keys/admin-alias", strings.NewReader(`{"apiKey":"secret"}`))
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("PUT key: expected 204, got %d", rec.Code)
+	}
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/keys", nil))
+	if strings.Contains(rec.Body.String(), "secret") {
+		t.Error("Listing aliases must not expose API keys")
+	}
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPut, "/providers/admin-test", strings.NewReader(`{"timeout":-1}`)))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for negative timeout, got %d", rec.Code)
+	}
+}
+
+func TestAdminHandlerRequiresToken(t *testing.T) {
+	defer DeleteAPIKeyAlias("unauthorized-alias")
+
+	testCases := map[string]struct {
+		token  string
+		header string
+	}{
+		"no credentials": {token: testAdminToken},
+		"wrong token":    {token: testAdminToken, header: "Bearer other"},
+		"not bearer":     {token: testAdminToken, header: testAdminToken},
+		"empty bearer":   {header: "Bearer "},
+		"no admin token": {header: "Bearer " + testAdminToken},
+	}
+	for name, tc := range testCases {
+		req := httptest.NewRequest(http.MethodPut, "/keys/unauthorized-alias", strings.NewReader(`{"apiKey":"stolen"}`))
+		if tc.header != "" {
+			req.Header.Set("Authorization", tc.header)
+		}
+		rec := httptest.NewRecorder()
+		AdminHandler(tc.token).ServeHTTP(rec, req)
+		if rec.Code != http.StatusUnauthorized {
+			t.Errorf("%s: expected 401, got %d", name, rec.Code)
+		}
+	}
+	for _, alias := range ListAPIKeyAliases() {
+		if alias == "unauthorized-alias" {
+			t.Error("Expected unauthorized requests not to set API keys")
+		}
+	}
+}
+
+func TestAdminListings(t *testing.T) {
+	for _, id := range []string{"adminprobe-a", "adminprobe-b", "adminprobe-c"} {
+		if err := models.Register("^"+id+"$", models.ModelInfo{ID: id, Provider: "adminprobe", MaxTokens: 1000}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	handler := authorizedAdminHandler()
+
+	var page struct {
+		Items      []models.ModelInfo `json:"items"`
+		NextCursor string             `json:"nextCursor"`
+		Total      int                `json:"total"`
+	}
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/models?provider=adminprobe&limit=2&sort=-maxTokens", nil))
+	if err := json.NewDecoder(rec.Body).Decode(&page); err != nil || rec.Code != http.StatusOK {
+		t.Fatalf("GET /models: got %d, %v", rec.Code, err)
+	}
+	if page.Total != 3 || len(page.Items) != 2 || page.Items[0].ID != "adminprobe-c" || page.NextCursor == "" {
+		t.Fatalf("Unexpected first page %+v", page)
+	}
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/models?provider=adminprobe&limit=2&sort=-maxTokens&cursor="+page.NextCursor, nil))
+	page.Items, page.NextCursor = nil, ""
+	json.NewDecoder(rec.Body).Decode(&page)
+	if len(page.Items) != 1 || page.Items[0].ID != "adminprobe-a" || page.NextCursor != "" {
+		t.Errorf("Unexpected last page %+v", page)
+	}
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/providers?sort=unknown", nil))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for an unknown sort field, got %d", rec.Code)
+	}
+}
+
+func TestAdminModelsBatch(t *testing.T) {
+	handler := authorizedAdminHandler()
+	post := func(url, body string) (*httptest.ResponseRecorder, catalogReport) {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, url, strings.NewReader(body)))
+		var report catalogReport
+		json.NewDecoder(rec.Body).Decode(&report)
+		return rec, report
+	}
+
+	rec, report := post("/models:batch", `{"models":[
+		{"id":"batchprobe-a","provider":"mistral","patterns":["^batchprobe-a$"],"maxTokens":1000},
+		{"id":"batchprobe-b","provider":"mistral","patterns":["batchprobe-("],"costPerToken":-1}
+	]}`)
+	if rec.Code != http.StatusUnprocessableEntity || report.Applied {
+		t.Fatalf("Expected 422 without applying, got %d %+v", rec.Code, report)
+	}
+	if !report.Entries[0].Accepted || report.Entries[1].Accepted || len(report.Entries[1].Errors) != 2 {
+		t.Errorf("Unexpected per-entry report %+v", report.Entries)
+	}
+	if _, err := models.Resolve("batchprobe-a"); err == nil {
+		t.Error("Expected a rejected catalog to register nothing")
+	}
+
+	valid := `{"models":[{"id":"batchprobe-a","provider":"mistral","patterns":["^batchprobe-a$"],"maxTokens":1000}]}`
+	if rec, report := post("/models:batch?dryRun=true", valid); rec.Code != http.StatusOK || report.Applied {
+		t.Errorf("Expected a validated dry run, got %d %+v", rec.Code, report)
+	}
+	if rec, report := post("/models:batch", valid); rec.Code != http.StatusOK || !report.Applied {
+		t.Fatalf("Expected the catalog to be applied, got %d %+v", rec.Code, report)
+	}
+	if info, err := models.Resolve("batchprobe-a"); err != nil || info.MaxTokens != 1000 {
+		t.Errorf("Resolve() = %+v, %v", info, err)
+	}
+}
+
+func TestAdminSnapshot(t *testing.T) {
+	saved := models.Snapshot()
+	t.Cleanup(func() { models.Import(saved) })
+	handler := authorizedAdminHandler()
+	put := func(url, body string) (*httptest.ResponseRecorder, models.SnapshotDiff) {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPut, url, strings.NewReader(body)))
+		var diff models.SnapshotDiff
+		json.NewDecoder(rec.Body).Decode(&diff)
+		return rec, diff
+	}
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/snapshot", nil))
+	var exported []models.ModelEntry
+	if err := json.NewDecoder(rec.Body).Decode(&exported); err != nil || rec.Code != http.StatusOK || len(exported) != len(saved) {
+		t.Fatalf("Expected the registry's %d entries, got %d %d %v", len(saved), rec.Code, len(exported), err)
+	}
+
+	snapshot := `[{"pattern":"^snapprobe$","info":{"id":"snapprobe","provider":"snapprobe","maxTokens":1000}}]`
+	if rec, diff := put("/snapshot?dryRun=true", snapshot); rec.Code != http.StatusOK || len(diff.Added) != 1 || len(diff.Removed) != len(saved) {
+		t.Errorf("Expected the dry run to report the changes, got %d %+v", rec.Code, diff)
+	}
+	if _, err := models.Resolve("snapprobe"); err == nil {
+		t.Error("Expected a dry run to import nothing")
+	}
+	if rec, _ := put("/snapshot", snapshot); rec.Code != http.StatusOK {
+		t.Fatalf("Expected the snapshot to be imported, got %d", rec.Code)
+	}
+	if got := models.ListModels(); len(got) != 1 || got[0] != "^snapprobe$" {
+		t.Errorf("Expected only the imported pattern, got %v", got)
+	}
+	if rec, _ := put("/snapshot", `[{"pattern":"snapprobe-("}]`); rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for an invalid pattern, got %d", rec.Code)
+	}
+}
+
+func TestAdminModelSuggestions(t *testing.T) {
+	if err := models.Register("^suggestprobe-large$", models.ModelInfo{ID: "suggestprobe-large", Provider: "suggestprobe"}); err != nil {
+		t.Fatal(err)
+	}
+	handler := authorizedAdminHandler()
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/models/suggestprobe-large", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected 200 for a registered model, got %d", rec.Code)
+	}
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/models/suggestprobe-lrage", nil))
+	var body modelNotFoundBody
+	json.NewDecoder(rec.Body).Decode(&body)
+	if rec.Code != http.StatusNotFound || len(body.Suggestions) == 0 || body.Suggestions[0] != "suggestprobe-large" {
+		t.Errorf("Expected 404 suggesting suggestprobe-large, got %d %+v", rec.Code, body)
+	}
+}
+
+func TestAdminModelCRUD(t *testing.T) {
+	handler := authorizedAdminHandler()
+	do := func(method, url, body string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(method, url, strings.NewReader(body)))
+		return rec
+	}
+
+	if rec := do(http.MethodPut, "/models/crudprobe", `{"provider":"mistral","maxTokens":1000}`); rec.Code != http.StatusCreated {
+		t.Fatalf("PUT model: expected 201, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if info, err := models.Resolve("crudprobe"); err != nil || info.MaxTokens != 1000 {
+		t.Errorf("Resolve() = %+v, %v", info, err)
+	}
+	if _, err := models.Resolve("crudprobe-2"); err == nil {
+		t.Error("Expected the default pattern to match the exact name only")
+	}
+
+	rec := do(http.MethodPut, "/models/crudprobe", `{"provider":"mistral","maxTokens":2000,"patterns":["^crudprobe.*"]}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("PUT model again: expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if info, err := models.Resolve("crudprobe-2"); err != nil || info.MaxTokens != 2000 {
+		t.Errorf("Expected the replaced registration, got %+v, %v", info, err)
+	}
+	if rec := do(http.MethodGet, "/catalog", ""); !strings.Contains(rec.Body.String(), `"patterns":["^crudprobe.*"]`) {
+		t.Errorf("Expected the model and its only pattern in the catalog, got %s", rec.Body.String())
+	}
+
+	for _, body := range []string{`{"maxTokens":1000}`, `{"id":"other","provider":"mistral"}`, `not json`} {
+		if rec := do(http.MethodPut, "/models/crudprobe", body); rec.Code != http.StatusBadRequest {
+			t.Errorf("PUT %s: expected 400, got %d", body, rec.Code)
+		}
+	}
+
+	if rec := do(http.MethodDelete, "/models/crudprobe", ""); rec.Code != http.StatusNoContent {
+		t.Errorf("DELETE model: expected 204, got %d", rec.Code)
+	}
+	if _, err := models.Resolve("crudprobe"); err == nil {
+		t.Error("Expected a deleted model not to resolve")
+	}
+	if rec := do(http.MethodDelete, "/models/crudprobe", ""); rec.Code != http.StatusNotFound {
+		t.Errorf("DELETE missing model: expected 404, got %d", rec.Code)
+	}
+}
@@ -0,0 +1,210 @@
+// Package shadow mirrors a fraction of production requests to a second model for offline
+// comparison.
+//
+// The caller always gets the primary model's response. Mirrored requests are sent to the
+// shadow model in the background, after the primary call returns, and the request is stored
+// with both responses for evaluating a model migration. Shadow calls never block, fail or
+// slow down the caller: when too many are in flight, requests are simply not mirrored.
+package shadow
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	mathrand "math/rand"
+	"sync"
+	"time"
+
+	"github.com/nexen/models"
+	"github.com/nexen/services/connectors/common"
+)
+
+const (
+	// DefaultTTL is how long records are kept when Options.TTL is zero.
+	DefaultTTL = 7 * 24 * time.Hour
+
+	// DefaultTimeout bounds a shadow call when Options.Timeout is zero.
+	DefaultTimeout = time.Minute
+
+	// DefaultMaxInFlight is the number of concurrent shadow calls when Options.MaxInFlight is
+	// zero.
+	DefaultMaxInFlight = 16
+
+	// KeyPrefix starts the store keys of records, followed by the record ID.
+	KeyPrefix = "shadow:"
+)
+
+// Store holds the records; libs/store satisfies it.
+type Store interface {
+	Set(ctx context.Context, key string, value []byte, ttl time.Duration) error
+}
+
+// Record is a mirrored request with the responses of both models.
+type Record struct {
+	ID          string              `json:"id"`
+	Time        time.Time           `json:"time"`
+	Request     *models.LLMRequest  `json:"request"`
+	Primary     *models.LLMResponse `json:"primary"`
+	ShadowModel string              `json:"shadowModel"`
+	Shadow      *models.LLMResponse `json:"shadow,omitempty"`
+
+	// ShadowError is the error of the shadow call, if it failed.
+	ShadowError string `json:"shadowError,omitempty"`
+}
+
+// Options configures the shadow model and how much traffic it gets.
+type Options struct {
+	// Shadow is the client for the shadow model.
+	Shadow common.LLM
+
+	// ShadowModel is the model ID sent to Shadow. When empty, the request's model is kept.
+	ShadowModel string
+
+	// Fraction is the share of requests, from 0 to 1, mirrored to the shadow model.
+	Fraction float64
+
+	// Store receives a Record for every mirrored request, under KeyPrefix and the record ID.
+	Store Store
+
+	// TTL is how long records are kept. Zero means DefaultTTL.
+	TTL time.Duration
+
+	// Timeout bounds each shadow call. Zero means DefaultTimeout.
+	Timeout time.Duration
+
+	// MaxInFlight caps the concurrent shadow calls. Zero means DefaultMaxInFlight.
+	MaxInFlight int
+
+	// Random returns a number in [0, 1) deciding which requests are mirrored. Nil uses
+	// math/rand.
+	Random func() float64
+}
+
+// MirrorLLM sends requests to the wrapped LLM and mirrors a fraction of them to the shadow
+// model.
+type MirrorLLM struct {
+	common.LLM
+	opts     Options
+	inFlight chan struct{}
+	wg       sync.WaitGroup
+}
+
+// New returns a MirrorLLM answering with llm and mirroring opts.Fraction of the requests.
+func New(llm common.LLM, opts Options) (*MirrorLLM, error) {
+	if opts.Shadow == nil || opts.Store == nil {
+		return nil, fmt.Errorf("shadow mode requires a shadow client and a store")
+	}
+	if opts.Fraction < 0 || opts.Fraction > 1 {
+		return nil, fmt.Errorf("shadow fraction %g is not between 0 and 1", opts.Fraction)
+	}
+	if opts.TTL <= 0 {
+		opts.TTL = DefaultTTL
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = DefaultTimeout
+	}
+	if opts.MaxInFlight <= 0 {
+		opts.MaxInFlight = DefaultMaxInFlight
+	}
+	if opts.Random == nil {
+		opts.Random = mathrand.Float64
+	}
+	return &MirrorLLM{LLM: llm, opts: opts, inFlight: make(chan struct{}, opts.MaxInFlight)}, nil
+}
+
+// Call implements the LLM interface Call method. Requests the primary model answered are
+// mirrored after it returns.
+func (m *MirrorLLM) Call(ctx context.Context, request *models.LLMRequest) (*models.LLMResponse, error) {
+	response, err := m.LLM.Call(ctx, request)
+	if err != nil || response == nil || m.opts.Random() >= m.opts.Fraction {
+		return response, err
+	}
+	select {
+	case m.inFlight <- struct{}{}:
+	default:
+		return response, nil
+	}
+
+	record := Record{Time: time.Now().UTC(), ShadowModel: request.Model}
+	if m.opts.ShadowModel != "" {
+		record.ShadowModel = m.opts.ShadowModel
+	}
+	// Copy the primary's side now, before the caller can modify the request or response
+	err = deepCopy(&record.Request, request)
+	if err == nil {
+		err = deepCopy(&record.Primary, response)
+	}
+	if err != nil {
+		<-m.inFlight
+		slog.Warn("shadow: copying request", "error", err)
+		return response, nil
+	}
+
+	m.wg.Add(1)
+	go func() {
+		defer m.wg.Done()
+		defer func() { <-m.inFlight }()
+		m.mirror(context.WithoutCancel(ctx), record)
+	}()
+	return response, nil
+}
+
+// mirror calls the shadow model with the record's request and stores the record.
+func (m *MirrorLLM) mirror(ctx context.Context, record Record) {
+	id, err := newRecordID()
+	if err != nil {
+		slog.Warn("shadow: creating record ID", "error", err)
+		return
+	}
+	record.ID = id
+
+	callCtx, cancel := context.WithTimeout(ctx, m.opts.Timeout)
+	defer cancel()
+	shadowRequest := *record.Request
+	shadowRequest.Model = record.ShadowModel
+	record.Shadow, err = m.opts.Shadow.Call(callCtx, &shadowRequest)
+	if err != nil {
+		record.ShadowError = err.Error()
+	}
+
+	data, err := json.Marshal(record)
+	if err != nil {
+		slog.Warn("shadow: encoding record", "id", id, "error", err)
+		return
+	}
+	if err := m.opts.Store.Set(ctx, KeyPrefix+id, data, m.opts.TTL); err != nil {
+		slog.Warn("shadow: storing record", "id", id, "error", err)
+	}
+}
+
+// Wait blocks until the shadow calls in flight have finished, e.g. before shutting down.
+func (m *MirrorLLM) Wait() {
+	m.wg.Wait()
+}
+
+// BatchCall implements the LLM interface BatchCall method.
+func (m *MirrorLLM) BatchCall(ctx context.Context, requests []*models.LLMRequest) ([]*models.LLMResponse, error) {
+	return common.BatchCall(ctx, requests, common.DefaultBatchConcurrency, m.Call)
+}
+
+// deepCopy sets dst to a copy of src made through its JSON encoding, which is also how the
+// record is stored.
+func deepCopy[T any](dst **T, src *T) error {
+	data, err := json.Marshal(src)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, dst)
+}
+
+// newRecordID returns a random 16-byte hex record ID.
+func newRecordID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,170 @@
+package shadow
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/nexen/models"
+)
+
+// memStore is an in-memory Store.
+type memStore struct {
+	mu    sync.Mutex
+	items map[string][]byte
+}
+
+func (m *memStore) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.items[key] = value
+	return nil
+}
+
+func (m *memStore) records(t *testing.T) []Record {
+	t.Helper()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var records []Record
+	for key, data := range m.items {
+		var record Record
+		if err := json.Unmarshal(data, &record); err != nil {
+			t.Fatal(err)
+		}
+		if key != KeyPrefix+record.ID {
+			t.Errorf("Record %s stored under %s", record.ID, key)
+		}
+		records = append(records, record)
+	}
+	return records
+}
+
+// echoLLM answers with the request's model, or fails with err, after delay.
+type echoLLM struct {
+	delay time.Duration
+	err   error
+}
+
+func (e *echoLLM) Call(ctx context.Context, request *models.LLMRequest) (*models.LLMResponse, error) {
+	select {
+	case <-time.After(e.delay):
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	if e.err != nil {
+		return nil, e.err
+	}
+	return &models.LLMResponse{Content: &models.Content{Role: "assistant", Message: request.Model}}, nil
+}
+
+func (e *echoLLM) BatchCall(ctx context.Context, requests []*models.LLMRequest) ([]*models.LLMResponse, error) {
+	return nil, nil
+}
+
+func (e *echoLLM) SupportedModels() []string {
+	return nil
+}
+
+func request() *models.LLMRequest {
+	return &models.LLMRequest{Model: "gpt-4o", Contents: []models.Content{{Role: "user", Message: "Hi"}}}
+}
+
+func TestMirrorLLMStoresBothResponses(t *testing.T) {
+	store := &memStore{items: make(map[string][]byte)}
+	draws := []float64{0.05, 0.5}
+	llm, err := New(&echoLLM{}, Options{
+		Shadow:      &echoLLM{delay: 50 * time.Millisecond},
+		ShadowModel: "claude-3-5-sonnet",
+		Fraction:    0.1,
+		Store:       store,
+		Random: func() float64 {
+			draw := draws[0]
+			draws = draws[1:]
+			return draw
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Now()
+	for i := 0; i < 2; i++ {
+		response, err := llm.Call(context.Background(), request())
+		if err != nil || response.Content.Message != "gpt-4o" {
+			t.Fatalf("Expected the primary's response, got %+v, %v", response, err)
+		}
+	}
+	if elapsed := time.Since(start); elapsed >= 50*time.Millisecond {
+		t.Errorf("Expected the shadow call not to block the caller, took %v", elapsed)
+	}
+
+	llm.Wait()
+	records := store.records(t)
+	if len(records) != 1 {
+		t.Fatalf("Expected one mirrored request, got %d", len(records))
+	}
+	record := records[0]
+	if record.Request.Model != "gpt-4o" || record.Primary.Content.Message != "gpt-4o" ||
+		record.ShadowModel != "claude-3-5-sonnet" || record.Shadow.Content.Message != "claude-3-5-sonnet" {
+		t.Errorf("Unexpected record %+v", record)
+	}
+}
+
+func TestMirrorLLMRecordsShadowFailures(t *testing.T) {
+	store := &memStore{items: make(map[string][]byte)}
+	llm, err := New(&echoLLM{}, Options{Shadow: &echoLLM{err: errors.New("shadow down")}, Fraction: 1, Store: store})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := llm.Call(context.Background(), request()); err != nil {
+		t.Fatalf("Expected the shadow's failure not to reach the caller, got %v", err)
+	}
+	llm.Wait()
+	if records := store.records(t); len(records) != 1 || !strings.Contains(records[0].ShadowError, "shadow down") {
+		t.Errorf("Expected the shadow error to be recorded, got %+v", records)
+	}
+}
+
+func TestMirrorLLMSkipsWhenSaturated(t *testing.T) {
+	store := &memStore{items: make(map[string][]byte)}
+	llm, err := New(&echoLLM{}, Options{Shadow: &echoLLM{delay: 50 * time.Millisecond}, Fraction: 1, Store: store, MaxInFlight: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		llm.Call(context.Background(), request())
+	}
+	llm.Wait()
+	if records := store.records(t); len(records) != 1 {
+		t.Errorf("Expected requests over MaxInFlight not to be mirrored, got %d records", len(records))
+	}
+}
+
+func TestMirrorLLMKeepsPrimaryFailures(t *testing.T) {
+	store := &memStore{items: make(map[string][]byte)}
+	llm, err := New(&echoLLM{err: errors.New("primary down")}, Options{Shadow: &echoLLM{}, Fraction: 1, Store: store})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := llm.Call(context.Background(), request()); err == nil {
+		t.Fatal("Expected the primary's error")
+	}
+	llm.Wait()
+	if records := store.records(t); len(records) != 0 {
+		t.Errorf("Expected failed requests not to be mirrored, got %d records", len(records))
+	}
+}
+
+func TestNewValidates(t *testing.T) {
+	store := &memStore{items: make(map[string][]byte)}
+	if _, err := New(&echoLLM{}, Options{Store: store}); err == nil {
+		t.Error("Expected an error without a shadow client")
+	}
+	if _, err := New(&echoLLM{}, Options{Shadow: &echoLLM{}, Store: store, Fraction: 2}); err == nil {
+		t.Error("Expected an error for a fraction over 1")
+	}
+}
@@ -0,0 +1,215 @@
+// Package structured enforces the output schema set with LLMRequest.SetOutputSchema.
+//
+// Connectors ask the provider for JSON matching the schema, but models can still return
+// malformed or incomplete output. Wrap validates every response against the schema and
+// re-asks the model with a corrective message until it complies.
+package structured
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/nexen/models"
+	"github.com/nexen/services/connectors/common"
+)
+
+// ErrInvalidOutput is returned when the model's output still fails validation after the
+// last attempt.
+var ErrInvalidOutput = errors.New("structured: response does not match the output schema")
+
+// DefaultMaxAttempts is used when Wrap is called with a non-positive attempt limit.
+const DefaultMaxAttempts = 3
+
+// correctionPrompt is sent after an invalid response. It receives the validation error.
+const correctionPrompt = "Your previous reply did not match the required JSON schema: %v. " +
+	"Reply again with only a JSON value that matches the schema."
+
+// validatingLLM validates responses to requests that carry an output schema.
+type validatingLLM struct {
+	common.LLM
+	maxAttempts int
+}
+
+// Wrap returns an LLM that validates responses against the request's output schema and
+// re-asks up to maxAttempts calls in total. Requests without a schema pass through unchanged.
+// On success the response message holds the bare JSON, with any surrounding text removed.
+func Wrap(llm common.LLM, maxAttempts int) common.LLM {
+	if maxAttempts <= 0 {
+		maxAttempts = DefaultMaxAttempts
+	}
+	return &validatingLLM{LLM: llm, maxAttempts: maxAttempts}
+}
+
+// Call implements the LLM interface Call method.
+func (v *validatingLLM) Call(ctx context.Context, request *models.LLMRequest) (*models.LLMResponse, error) {
+	schema, err := request.Config.OutputSchema()
+	if err != nil {
+		return nil, fmt.Errorf("invalid request: %w", err)
+	}
+	if schema == nil {
+		return v.LLM.Call(ctx, request)
+	}
+
+	// Corrections are added to a copy so the caller's conversation is left untouched
+	attempt := *request
+	attempt.Contents = append([]models.Content(nil), request.Contents...)
+
+	var usage models.UsageMetrics
+	var response *models.LLMResponse
+	var invalid error
+	for i := 0; i < v.maxAttempts; i++ {
+		response, err = v.LLM.Call(ctx, &attempt)
+		if err != nil {
+			return nil, fmt.Errorf("attempt %d: %w", i+1, err)
+		}
+		usage = usage.Add(response.Usage)
+		response.Usage = usage
+		if response.IsError() || response.Content == nil {
+			return response, nil
+		}
+
+		output := ExtractJSON(response.Content.Message)
+		if invalid = schema.ValidateJSON([]byte(output)); invalid == nil {
+			response.Content.Message = output
+			return response, nil
+		}
+
+		attempt.Contents = append(attempt.Contents,
+			models.Content{Role: "assistant", Message: response.Content.Message},
+			models.Content{Role: "user", Message: fmt.Sprintf(correctionPrompt, invalid)},
+		)
+	}
+
+	return response, fmt.Errorf("%w after %d attempts: %v", ErrInvalidOutput, v.maxAttempts, invalid)
+}
+
+// BatchCall implements the LLM interface BatchCall method.
+func (v *validatingLLM) BatchCall(ctx context.Context, requests []*models.LLMRequest) ([]*models.LLMResponse, error) {
+	return common.BatchCall(ctx, requests, common.DefaultBatchConcurrency, v.Call)
+}
+
+// Decode unmarshals the response message into out.
+func Decode(response *models.LLMResponse, out any) error {
+	if response == nil || response.Content == nil {
+		return fmt.Errorf("structured: response has no content")
+	}
+	if err := json.Unmarshal([]byte(ExtractJSON(response.Content.Message)), out); err != nil {
+		return fmt.Errorf("structured: decoding response: %w", err)
+	}
+	return nil
+}
+
+// ExtractJSON returns the JSON value embedded in a model reply. It handles markdown code
+// fences and prose before or after the value, which models often add even when asked not to.
+// It returns an empty string if the reply contains no object or array.
+func ExtractJSON(text string) string {
+	text = strings.TrimSpace(text)
+	if fence := strings.Index(text, "```"); fence >= 0 {
+		inner := text[fence+3:]
+		if newline := strings.IndexByte(inner, '\n'); newline >= 0 {
+			// Drop the language tag, e.g. ```json
+			inner = inner[newline+1:]
+		}
+		if closing := strings.Index(inner, "```"); closing >= 0 {
+			inner = inner[:closing]
+		}
+		text = strings.TrimSpace(inner)
+	}
+	if json.Valid([]byte(text)) {
+		return text
+	}
+
+	start := strings.IndexAny(text, "{[")
+	if start < 0 {
+		return ""
+	}
+	if end := closingIndex(text, start); end >= 0 {
+		return text[start : end+1]
+	}
+	// Unterminated value, most likely truncated output
+	return text[start:]
+}
+
+// RepairJSON fixes common defects in model-generated JSON: trailing commas and values
+// truncated before their closing quotes and brackets.
+func RepairJSON(text string) string {
+	var out strings.Builder
+	var stack []byte
+	inString, escaped := false, false
+	for i := 0; i < len(text); i++ {
+		c := text[i]
+		if inString {
+			out.WriteByte(c)
+			switch {
+			case escaped:
+				escaped = false
+			case c == '\\':
+				escaped = true
+			case c == '"':
+				inString = false
+			}
+			continue
+		}
+		switch c {
+		case '"':
+			inString = true
+		case '{':
+			stack = append(stack, '}')
+		case '[':
+			stack = append(stack, ']')
+		case '}', ']':
+			if len(stack) > 0 {
+				stack = stack[:len(stack)-1]
+			}
+		case ',':
+			if next := strings.TrimLeft(text[i+1:], " \t\r\n"); next == "" || next[0] == '}' || next[0] == ']' {
+				continue
+			}
+		}
+		out.WriteByte(c)
+	}
+
+	if inString {
+		out.WriteByte('"')
+	}
+	repaired := strings.TrimRight(out.String(), " \t\r\n,")
+	for i := len(stack) - 1; i >= 0; i-- {
+		repaired += string(stack[i])
+	}
+	return repaired
+}
+
+// closingIndex returns the index of the bracket closing the one at start, or -1.
+func closingIndex(text string, start int) int {
+	depth := 0
+	inString, escaped := false, false
+	for i := start; i < len(text); i++ {
+		c := text[i]
+		if inString {
+			switch {
+			case escaped:
+				escaped = false
+			case c == '\\':
+				escaped = true
+			case c == '"':
+				inString = false
+			}
+			continue
+		}
+		switch c {
+		case '"':
+			inString = true
+		case '{', '[':
+			depth++
+		case '}', ']':
+			depth--
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return -1
+}
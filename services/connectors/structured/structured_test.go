@@ -0,0 +1,100 @@
+package structured
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/nexen/models"
+)
+
+// scriptedLLM replies with the queued messages in order and records each request it sees.
+type scriptedLLM struct {
+	replies  []string
+	requests []*models.LLMRequest
+}
+
+func (s *scriptedLLM) Call(ctx context.Context, request *models.LLMRequest) (*models.LLMResponse, error) {
+	if len(s.requests) >= len(s.replies) {
+		return nil, errors.New("no more scripted replies")
+	}
+	reply := s.replies[len(s.requests)]
+	s.requests = append(s.requests, request)
+	return &models.LLMResponse{
+		Content: &models.Content{Role: "assistant", Message: reply},
+		Usage:   models.UsageMetrics{TotalTokens: 10},
+	}, nil
+}
+
+func (s *scriptedLLM) BatchCall(ctx context.Context, requests []*models.LLMRequest) ([]*models.LLMResponse, error) {
+	return nil, errors.New("not implemented")
+}
+
+func (s *scriptedLLM) SupportedModels() []string {
+	return []string{"scripted"}
+}
+
+type capital struct {
+	City    string `json:"city"`
+	Country string `json:"country"`
+}
+
+func newRequest() *models.LLMRequest {
+	request := &models.LLMRequest{
+		Model:    "scripted",
+		Contents: []models.Content{{Role: "user", Message: "Capital of France?"}},
+	}
+	request.SetOutputSchema(capital{})
+	return request
+}
+
+func TestWrapReasksOnInvalidOutput(t *testing.T) {
+	llm := &scriptedLLM{replies: []string{
+		`{"city": "Paris"}`,
+		"```json\n{\"city\": \"Paris\", \"country\": \"France\"}\n```",
+	}}
+	request := newRequest()
+
+	response, err := Wrap(llm, 3).Call(context.Background(), request)
+	if err != nil {
+		t.Fatalf("Call failed: %v", err)
+	}
+	var got capital
+	if err := Decode(response, &got); err != nil || got.Country != "France" {
+		t.Errorf("Decode() = %+v, %v", got, err)
+	}
+	if response.Usage.TotalTokens != 20 {
+		t.Errorf("Expected usage from both attempts, got %d", response.Usage.TotalTokens)
+	}
+
+	retry := llm.requests[1].Contents
+	if len(retry) != 3 || !strings.Contains(retry[2].Message, "country") {
+		t.Errorf("Expected corrective message naming the missing field, got %+v", retry)
+	}
+	if len(request.Contents) != 1 {
+		t.Errorf("Caller's request should not be modified, got %d contents", len(request.Contents))
+	}
+}
+
+func TestWrapGivesUp(t *testing.T) {
+	llm := &scriptedLLM{replies: []string{"Paris", "Paris"}}
+
+	_, err := Wrap(llm, 2).Call(context.Background(), newRequest())
+	if !errors.Is(err, ErrInvalidOutput) {
+		t.Fatalf("Expected ErrInvalidOutput, got %v", err)
+	}
+	if len(llm.requests) != 2 {
+		t.Errorf("Expected 2 attempts, got %d", len(llm.requests))
+	}
+}
+
+func TestWrapPassesThroughWithoutSchema(t *testing.T) {
+	llm := &scriptedLLM{replies: []string{"not JSON"}}
+	request := &models.LLMRequest{Model: "scripted", Contents: []models.Content{{Role: "user", Message: "Hi"}}}
+
+	response, err := Wrap(llm, 0).Call(context.Background(), request)
+	if err != nil || response.Content.Message != "not JSON" {
+		t.Errorf("Expected pass-through, got %+v, %v", response, err)
+	}
+}
@@ -0,0 +1,163 @@
+package connectors
+
+import (
+	"context"
+	"errors"
+	"strconv"
+
+	"github.com/nexen/models"
+	"github.com/nexen/services/connectors/common"
+)
+
+// Trace returns a Middleware that records a span around every call with tracer, following the
+// OpenTelemetry semantic conventions for generative AI: the span is named "chat {model}" and
+// carries the model, provider, request parameters, token counts and finish reason, and the
+// request's metadata. NewLLM
+// applies it to every client when a tracer is set with common.SetTracer.
+func Trace(model string, tracer common.Tracer) Middleware {
+	return func(next LLM) LLM {
+		return &tracedLLM{LLM: next, model: model, tracer: tracer}
+	}
+}
+
+// tracedLLM records a span around each call of the wrapped LLM.
+type tracedLLM struct {
+	LLM
+	model  string
+	tracer common.Tracer
+}
+
+// Model implements common.ModelNamer.
+func (t *tracedLLM) Model() string {
+	return t.model
+}
+
+// Call implements the LLM interface Call method.
+func (t *tracedLLM) Call(ctx context.Context, request *models.LLMRequest) (*models.LLMResponse, error) {
+	model := t.model
+	if request != nil && request.Model != "" {
+		model = request.Model
+	}
+	ctx, span := t.tracer.Start(ctx, "chat "+model, requestAttributes(model, request))
+	response, err := t.LLM.Call(ctx, request)
+	if response != nil {
+		span.SetAttributes(responseAttributes(response))
+	}
+	if err != nil {
+		span.SetAttributes(map[string]any{common.AttrErrorType: errorType(err)})
+	}
+	span.End(err)
+	return response, err
+}
+
+// CallStream implements common.Streamer, recording one span for the whole stream with the
+// attributes of its final response. LLMs that cannot stream are called with Call, as by
+// common.CallStream.
+func (t *tracedLLM) CallStream(ctx context.Context, request *models.LLMRequest, yield func(*models.LLMResponse) error) error {
+	model := t.model
+	if request != nil && request.Model != "" {
+		model = request.Model
+	}
+	ctx, span := t.tracer.Start(ctx, "chat "+model, requestAttributes(model, request))
+	err := common.CallStream(ctx, t.LLM, request, func(response *models.LLMResponse) error {
+		if !response.IsPartial() {
+			span.SetAttributes(responseAttributes(response))
+		}
+		return yield(response)
+	})
+	if err != nil {
+		span.SetAttributes(map[string]any{common.AttrErrorType: errorType(err)})
+	}
+	span.End(err)
+	return err
+}
+
+// BatchCall implements the LLM interface BatchCall method. Each request gets its own span.
+func (t *tracedLLM) BatchCall(ctx context.Context, requests []*models.LLMRequest) ([]*models.LLMResponse, error) {
+	return common.BatchCall(ctx, requests, common.DefaultBatchConcurrency, t.Call)
+}
+
+// requestAttributes returns the span attributes known before the call.
+func requestAttributes(model string, request *models.LLMRequest) map[string]any {
+	attrs := map[string]any{
+		common.AttrOperationName: "chat",
+		common.AttrRequestModel:  model,
+	}
+	if info, err := models.Resolve(model); err == nil {
+		attrs[common.AttrSystem] = info.Provider
+	}
+	if request == nil {
+		return attrs
+	}
+	metadataAttributes(attrs, request.Metadata)
+	if request.Config == nil {
+		return attrs
+	}
+	config := request.Config
+	if config.Temperature > 0 {
+		attrs[common.AttrRequestTemperature] = config.Temperature
+	}
+	if config.TopP > 0 {
+		attrs[common.AttrRequestTopP] = config.TopP
+	}
+	if config.MaxTokens > 0 {
+		attrs[common.AttrRequestMaxTokens] = config.MaxTokens
+	}
+	if len(config.StopSequences) > 0 {
+		attrs[common.AttrRequestStopSequences] = config.StopSequences
+	}
+	return attrs
+}
+
+// metadataAttributes adds the set fields of metadata to attrs.
+func metadataAttributes(attrs map[string]any, metadata models.RequestMetadata) {
+	if metadata.TenantID != "" {
+		attrs[common.AttrTenantID] = metadata.TenantID
+	}
+	if metadata.UserID != "" {
+		attrs[common.AttrEndUserID] = metadata.UserID
+	}
+	if metadata.RequestID != "" {
+		attrs[common.AttrRequestID] = metadata.RequestID
+	}
+	for name, value := range metadata.Tags {
+		attrs[common.AttrTagPrefix+name] = value
+	}
+}
+
+// responseAttributes returns the span attributes of a response.
+func responseAttributes(response *models.LLMResponse) map[string]any {
+	attrs := map[string]any{
+		common.AttrUsageInputTokens:  response.Usage.PromptTokens,
+		common.AttrUsageOutputTokens: response.Usage.CompletionTokens,
+	}
+	if reason, ok := response.CustomMetadata[common.MetadataFinishReason].(string); ok && reason != "" {
+		attrs[common.AttrResponseFinishReasons] = []string{reason}
+	} else if response.ErrorCode != nil {
+		attrs[common.AttrResponseFinishReasons] = []string{*response.ErrorCode}
+	}
+	if timings, ok := response.CustomMetadata[common.MetadataHTTPTimings].(common.HTTPTimings); ok {
+		for k, v := range timings.Attributes() {
+			attrs[k] = v
+		}
+	}
+	return attrs
+}
+
+// errorType returns the error.type attribute of err: "timeout", the HTTP status code of a
+// *common.ProviderError or its class when no response was received, or "_OTHER".
+func errorType(err error) string {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return "timeout"
+	}
+	var providerErr *common.ProviderError
+	if errors.As(err, &providerErr) {
+		if providerErr.StatusCode != 0 {
+			return strconv.Itoa(providerErr.StatusCode)
+		}
+		if providerErr.Class != nil {
+			return providerErr.Class.Error()
+		}
+	}
+	return "_OTHER"
+}
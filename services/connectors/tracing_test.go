@@ -0,0 +1,113 @@
+package connectors
+
+import (
+	"context"
+	"errors"
+	"net"
+	"reflect"
+	"testing"
+
+	"github.com/nexen/models"
+	"github.com/nexen/services/connectors/common"
+)
+
+// recordingTracer records the spans it starts.
+type recordingTracer struct {
+	spans []*recordedSpan
+}
+
+type recordedSpan struct {
+	name  string
+	attrs map[string]any
+	ended bool
+	err   error
+}
+
+func (r *recordingTracer) Start(ctx context.Context, name string, attrs map[string]any) (context.Context, common.Span) {
+	span := &recordedSpan{name: name, attrs: attrs}
+	r.spans = append(r.spans, span)
+	return ctx, span
+}
+
+func (s *recordedSpan) SetAttributes(attrs map[string]any) {
+	for key, value := range attrs {
+		s.attrs[key] = value
+	}
+}
+
+func (s *recordedSpan) End(err error) {
+	s.ended, s.err = true, err
+}
+
+// finishingLLM answers with usage and a finish reason.
+type finishingLLM struct {
+	mockLLM
+}
+
+func (f *finishingLLM) Call(ctx context.Context, request *models.LLMRequest) (*models.LLMResponse, error) {
+	return &models.LLMResponse{
+		Content:        &models.Content{Role: "assistant", Message: "hi"},
+		Usage:          models.UsageMetrics{PromptTokens: 12, CompletionTokens: 3, TotalTokens: 15},
+		CustomMetadata: map[string]any{common.MetadataFinishReason: "stop"},
+	}, nil
+}
+
+func TestNewLLMTracesCalls(t *testing.T) {
+	if err := models.Register("^traceprobe-.*", models.ModelInfo{ID: "traceprobe", Provider: "traceprobe"}); err != nil {
+		t.Fatal(err)
+	}
+	Register("^traceprobe-.*", func(model string, opts ...common.Option) (common.LLM, error) {
+		return &finishingLLM{}, nil
+	})
+	tracer := &recordingTracer{}
+	common.SetTracer(tracer)
+	defer common.SetTracer(nil)
+
+	llm, err := NewLLM("traceprobe-large")
+	if err != nil {
+		t.Fatalf("NewLLM() error = %v", err)
+	}
+	request := &models.LLMRequest{
+		Contents: []models.Content{{Role: "user", Message: "hello"}},
+		Config:   &models.GenerateContentConfig{Temperature: 0.2, MaxTokens: 100},
+		Metadata: models.RequestMetadata{TenantID: "acme", UserID: "u-1", Tags: map[string]string{"feature": "search"}},
+	}
+	if _, err := llm.Call(context.Background(), request); err != nil {
+		t.Fatalf("Call() error = %v", err)
+	}
+
+	if len(tracer.spans) != 1 {
+		t.Fatalf("Expected one span, got %d", len(tracer.spans))
+	}
+	span := tracer.spans[0]
+	want := map[string]any{
+		common.AttrOperationName:         "chat",
+		common.AttrSystem:                "traceprobe",
+		common.AttrRequestModel:          "traceprobe-large",
+		common.AttrRequestTemperature:    0.2,
+		common.AttrRequestMaxTokens:      100,
+		common.AttrUsageInputTokens:      12,
+		common.AttrUsageOutputTokens:     3,
+		common.AttrResponseFinishReasons: []string{"stop"},
+		common.AttrTenantID:              "acme",
+		common.AttrEndUserID:             "u-1",
+		common.AttrTagPrefix + "feature": "search",
+	}
+	if span.name != "chat traceprobe-large" || !span.ended || span.err != nil || !reflect.DeepEqual(span.attrs, want) {
+		t.Errorf("Unexpected span %q (ended %v, err %v): %v", span.name, span.ended, span.err, span.attrs)
+	}
+}
+
+func TestErrorType(t *testing.T) {
+	rateLimited := common.NewProviderError("openai", 429, "rate_limit_exceeded", "slow down")
+	unreachable := common.TransportError("openai", &net.OpError{Op: "dial", Err: errors.New("connection refused")})
+	if got := errorType(rateLimited); got != "429" {
+		t.Errorf("errorType() = %q, want 429", got)
+	}
+	if got := errorType(unreachable); got != common.ErrProviderUnavailable.Error() {
+		t.Errorf("errorType() = %q, want the error class", got)
+	}
+	if got := errorType(common.TransportError("openai", context.DeadlineExceeded)); got != "timeout" {
+		t.Errorf("errorType() = %q, want timeout", got)
+	}
+}
@@ -0,0 +1,36 @@
+package gateway
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/nexen/config"
+	"github.com/nexen/services/connectors/calllog"
+	"github.com/nexen/services/connectors/common"
+	"github.com/nexen/services/gateway/audit"
+)
+
+// auditTimeout bounds the write of an audit record, which outlives a canceled request.
+const auditTimeout = 5 * time.Second
+
+// newAuditor returns the middleware recording the calls of clients to sink, with their
+// content redacted as cfg says, or nil without a sink.
+func newAuditor(sink audit.Sink, cfg config.AuditConfig) common.Middleware {
+	if sink == nil {
+		return nil
+	}
+	return calllog.Middleware(calllog.Options{
+		Content:          calllog.ContentMode(cfg.Content),
+		MaxContentLength: cfg.MaxContentLength,
+		Sink: func(ctx context.Context, entry calllog.Entry) {
+			caller, _ := callerFrom(ctx)
+			ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), auditTimeout)
+			defer cancel()
+			// A call is not failed for its record; the sink's outage is logged instead
+			if err := sink.Write(ctx, audit.NewRecord(entry, caller, time.Now())); err != nil {
+				slog.ErrorContext(ctx, "writing audit record", "model", entry.Model, "error", err)
+			}
+		},
+	})
+}
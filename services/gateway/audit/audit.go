@@ -0,0 +1,165 @@
+// Package audit keeps an append-only trail of the gateway's LLM calls for compliance reviews:
+// who called which model, with what usage, cost and latency, and with what outcome.
+//
+// Records go to a Sink: a JSON-lines file (FileSink), a Redis stream (RedisSink), or a Kafka
+// topic (package kafkasink). Records are built from the entries of calllog, whose content mode
+// decides whether prompts and responses are left out, hashed, truncated or kept.
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/nexen/services/connectors/calllog"
+	"github.com/redis/go-redis/v9"
+)
+
+// OutcomeOK is the Outcome of calls that succeeded.
+const OutcomeOK = "ok"
+
+// Record is the audit record of one call.
+type Record struct {
+	// Time is when the call ended.
+	Time time.Time `json:"time"`
+
+	RequestID string `json:"requestId,omitempty"`
+
+	// Caller identifies the credential of the call: an API key ID or a token subject. It is
+	// empty when the gateway does not authenticate callers.
+	Caller   string `json:"caller,omitempty"`
+	TenantID string `json:"tenantId,omitempty"`
+	UserID   string `json:"userId,omitempty"`
+
+	Model            string  `json:"model"`
+	Provider         string  `json:"provider,omitempty"`
+	PromptTokens     int     `json:"promptTokens"`
+	CompletionTokens int     `json:"completionTokens"`
+	CostCents        float64 `json:"costCents"`
+	LatencyMs        int64   `json:"latencyMs"`
+
+	// Outcome is OutcomeOK, or the class of the call's error (see calllog.ErrorClass).
+	Outcome string `json:"outcome"`
+	Error   string `json:"error,omitempty"`
+
+	// Prompt and Response are redacted as the call log's content mode says.
+	Prompt   string `json:"prompt,omitempty"`
+	Response string `json:"response,omitempty"`
+}
+
+// NewRecord returns the record of the call logged as entry, made by caller and ended at end.
+func NewRecord(entry calllog.Entry, caller string, end time.Time) Record {
+	record := Record{
+		Time:             end.UTC(),
+		RequestID:        entry.Metadata.RequestID,
+		Caller:           caller,
+		TenantID:         entry.Metadata.TenantID,
+		UserID:           entry.Metadata.UserID,
+		Model:            entry.Model,
+		Provider:         entry.Provider,
+		PromptTokens:     entry.PromptTokens,
+		CompletionTokens: entry.CompletionTokens,
+		CostCents:        entry.CostCents,
+		LatencyMs:        entry.Latency.Milliseconds(),
+		Outcome:          OutcomeOK,
+		Error:            entry.Error,
+		Prompt:           entry.Prompt,
+		Response:         entry.Response,
+	}
+	if entry.ErrorClass != "" {
+		record.Outcome = entry.ErrorClass
+	}
+	return record
+}
+
+// Sink appends records to an audit trail. Implementations are safe for concurrent use.
+type Sink interface {
+	// Write appends record to the trail.
+	Write(ctx context.Context, record Record) error
+
+	// Close flushes the records written and releases the sink's resources.
+	Close() error
+}
+
+// FileSink appends records to a file, one JSON object per line.
+type FileSink struct {
+	mu   sync.Mutex
+	file *os.File
+}
+
+// OpenFile returns a FileSink appending to the file at path, which is created, readable by
+// its owner only, if it does not exist.
+func OpenFile(path string) (*FileSink, error) {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("audit: opening %s: %w", path, err)
+	}
+	return &FileSink{file: file}, nil
+}
+
+// Write implements Sink.
+func (s *FileSink) Write(ctx context.Context, record Record) error {
+	line, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	// One write per record, so that lines are never interleaved
+	if _, err := s.file.Write(line); err != nil {
+		return fmt.Errorf("audit: writing %s: %w", s.file.Name(), err)
+	}
+	return nil
+}
+
+// Close implements Sink.
+func (s *FileSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.file.Close()
+}
+
+// streamAdder is the command of the Redis client RedisSink uses.
+type streamAdder interface {
+	XAdd(ctx context.Context, a *redis.XAddArgs) *redis.StringCmd
+}
+
+// RedisSink adds records to a Redis stream, each as the JSON of its "record" field.
+type RedisSink struct {
+	client streamAdder
+	stream string
+	maxLen int64
+}
+
+// NewRedisSink returns a RedisSink adding records to stream with client. A positive maxLen
+// trims the stream to about that many records; zero keeps every record. Close does not close
+// the client.
+func NewRedisSink(client redis.Cmdable, stream string, maxLen int64) *RedisSink {
+	return &RedisSink{client: client, stream: stream, maxLen: maxLen}
+}
+
+// Write implements Sink.
+func (s *RedisSink) Write(ctx context.Context, record Record) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	args := &redis.XAddArgs{Stream: s.stream, Values: []any{"record", data}}
+	if s.maxLen > 0 {
+		args.MaxLen, args.Approx = s.maxLen, true
+	}
+	if err := s.client.XAdd(ctx, args).Err(); err != nil {
+		return fmt.Errorf("audit: adding to stream %s: %w", s.stream, err)
+	}
+	return nil
+}
+
+// Close implements Sink.
+func (s *RedisSink) Close() error {
+	return nil
+}
@@ -0,0 +1,109 @@
+package audit
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/nexen/models"
+	"github.com/nexen/services/connectors/calllog"
+	"github.com/redis/go-redis/v9"
+)
+
+func TestNewRecord(t *testing.T) {
+	end := time.Date(2026, 1, 2, 3, 4, 5, 0, time.FixedZone("CET", 3600))
+	entry := calllog.Entry{
+		Model:        "gpt-4o",
+		Provider:     "openai",
+		Metadata:     models.RequestMetadata{RequestID: "req-1", TenantID: "acme"},
+		Latency:      1500 * time.Millisecond,
+		PromptTokens: 10,
+	}
+	record := NewRecord(entry, "key-1", end)
+	if record.Outcome != OutcomeOK || record.Caller != "key-1" || record.TenantID != "acme" || record.LatencyMs != 1500 || !record.Time.Equal(end) || record.Time.Location() != time.UTC {
+		t.Errorf("Unexpected record %+v", record)
+	}
+
+	entry.ErrorClass, entry.Error = "rate_limited", "too many requests"
+	if record := NewRecord(entry, "key-1", end); record.Outcome != "rate_limited" || record.Error != "too many requests" {
+		t.Errorf("Expected the error class as outcome, got %+v", record)
+	}
+}
+
+func TestFileSink(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	for _, model := range []string{"a", "b"} {
+		// Reopening appends to the trail
+		sink, err := OpenFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := sink.Write(context.Background(), Record{Model: model, Outcome: OutcomeOK}); err != nil {
+			t.Fatal(err)
+		}
+		if err := sink.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	var got []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var record Record
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			t.Fatalf("Invalid line %q: %v", scanner.Text(), err)
+		}
+		got = append(got, record.Model)
+	}
+	if len(got) != 2 || got[0] != "a" || got[1] != "b" {
+		t.Errorf("Expected a line per record, got %v", got)
+	}
+	if info, _ := file.Stat(); info.Mode().Perm() != 0o600 {
+		t.Errorf("Expected the file to be private, got %v", info.Mode())
+	}
+}
+
+// fakeStream records the arguments of XAdd, failing with err.
+type fakeStream struct {
+	args []*redis.XAddArgs
+	err  error
+}
+
+func (f *fakeStream) XAdd(ctx context.Context, a *redis.XAddArgs) *redis.StringCmd {
+	f.args = append(f.args, a)
+	cmd := redis.NewStringCmd(ctx)
+	cmd.SetErr(f.err)
+	return cmd
+}
+
+func TestRedisSink(t *testing.T) {
+	stream := &fakeStream{}
+	sink := &RedisSink{client: stream, stream: "nexen:audit", maxLen: 1000}
+	if err := sink.Write(context.Background(), Record{Model: "a", Outcome: OutcomeOK}); err != nil {
+		t.Fatal(err)
+	}
+	args := stream.args[0]
+	values := args.Values.([]any)
+	var record Record
+	if err := json.Unmarshal(values[1].([]byte), &record); err != nil || values[0] != "record" || record.Model != "a" {
+		t.Errorf("Unexpected values %v", values)
+	}
+	if args.Stream != "nexen:audit" || args.MaxLen != 1000 || !args.Approx {
+		t.Errorf("Expected the stream to be trimmed, got %+v", args)
+	}
+
+	stream.err = errors.New("connection refused")
+	if err := sink.Write(context.Background(), Record{Model: "a"}); !errors.Is(err, stream.err) {
+		t.Errorf("Expected the error of Redis, got %v", err)
+	}
+}
@@ -0,0 +1,52 @@
+// Package kafkasink provides an audit.Sink producing records to a Kafka topic. It is a package
+// of its own so that only the binaries using it depend on a Kafka client.
+package kafkasink
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/nexen/services/gateway/audit"
+	"github.com/segmentio/kafka-go"
+)
+
+// batchTimeout bounds how long a record waits for others to be produced with, since Write
+// blocks until its record is acknowledged.
+const batchTimeout = 10 * time.Millisecond
+
+// Sink produces records to a Kafka topic as JSON, keyed by caller so that the records of a
+// caller stay in order.
+type Sink struct {
+	writer *kafka.Writer
+}
+
+// New returns a Sink producing to topic on brokers. Each record is acknowledged by every
+// in-sync replica before Write returns.
+func New(brokers []string, topic string) *Sink {
+	return &Sink{writer: &kafka.Writer{
+		Addr:         kafka.TCP(brokers...),
+		Topic:        topic,
+		Balancer:     &kafka.Hash{},
+		RequiredAcks: kafka.RequireAll,
+		BatchTimeout: batchTimeout,
+	}}
+}
+
+// Write implements audit.Sink.
+func (s *Sink) Write(ctx context.Context, record audit.Record) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	if err := s.writer.WriteMessages(ctx, kafka.Message{Key: []byte(record.Caller), Value: data, Time: record.Time}); err != nil {
+		return fmt.Errorf("audit: producing to %s: %w", s.writer.Topic, err)
+	}
+	return nil
+}
+
+// Close implements audit.Sink.
+func (s *Sink) Close() error {
+	return s.writer.Close()
+}
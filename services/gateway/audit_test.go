@@ -0,0 +1,67 @@
+package gateway
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/nexen/config"
+	"github.com/nexen/services/gateway/audit"
+)
+
+// recordingSink keeps the records written to it.
+type recordingSink struct {
+	mu      sync.Mutex
+	records []audit.Record
+}
+
+func (s *recordingSink) Write(ctx context.Context, record audit.Record) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.records = append(s.records, record)
+	return nil
+}
+
+func (s *recordingSink) Close() error {
+	return nil
+}
+
+func TestAuditLog(t *testing.T) {
+	sink := &recordingSink{}
+	s := authServer()
+	s.audit = newAuditor(sink, config.AuditConfig{Content: "full"})
+
+	send(t, s, http.MethodPost, "/v1/llm/call", searchKey, `{"model": "echo", "contents": [{"role": "user", "message": "Hi"}]}`)
+	send(t, s, http.MethodPost, "/v1/llm/call", searchKey, `{"model": "tenant", "contents": [{"role": "user", "message": "Hi"}]}`)
+	if len(sink.records) != 2 {
+		t.Fatalf("Expected a record per call, got %+v", sink.records)
+	}
+	record := sink.records[0]
+	if record.Caller == "" || record.TenantID != "acme" || record.Model != "echo" || record.Outcome != audit.OutcomeOK || record.Prompt != "user: Hi" || record.Response != "Hi" {
+		t.Errorf("Unexpected record %+v", record)
+	}
+
+	// Calls refused by the key's policy are recorded with their outcome
+	send(t, s, http.MethodPost, "/v1/llm/call", searchKey, `{"model": "streaming", "contents": [{"role": "user", "message": "Hi"}]}`)
+	if len(sink.records) != 3 || sink.records[2].Outcome == audit.OutcomeOK || sink.records[2].Error == "" {
+		t.Errorf("Expected the refused call to be recorded, got %+v", sink.records)
+	}
+}
+
+func TestAuditLogStreams(t *testing.T) {
+	sink := &recordingSink{}
+	s := testServer(config.GatewayConfig{})
+	s.audit = newAuditor(sink, config.AuditConfig{Content: "omit"})
+
+	s.Handler().ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/v1/llm/stream",
+		strings.NewReader(`{"model": "streaming", "contents": [{"role": "user", "message": "Hello there"}]}`)))
+	if len(sink.records) != 1 {
+		t.Fatalf("Expected one record for the stream, got %+v", sink.records)
+	}
+	if record := sink.records[0]; record.PromptTokens != 5 || record.CompletionTokens != 2 || record.Prompt != "" || record.Response != "" {
+		t.Errorf("Expected the usage of the final response without content, got %+v", record)
+	}
+}
@@ -0,0 +1,359 @@
+package gateway
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/nexen/config"
+	"github.com/nexen/libs/store"
+	"github.com/nexen/models"
+	"github.com/nexen/services/connectors/quota"
+	"google.golang.org/grpc/metadata"
+)
+
+// Errors of key stores and authentication.
+var (
+	// ErrKeyNotFound is returned by KeyStore methods for keys they do not hold.
+	ErrKeyNotFound = errors.New("gateway: API key not found")
+
+	// ErrKeyReadOnly is returned when creating or revoking a key of a store that cannot
+	// change it, such as a key of the configuration.
+	ErrKeyReadOnly = errors.New("gateway: API key cannot be changed at runtime")
+
+	// errUnauthorized is matched by the errors of requests without valid credentials.
+	errUnauthorized = errors.New("unauthorized")
+
+	// errNoCredentials is the error of requests without a valid API key or token.
+	errNoCredentials = fmt.Errorf("%w: a valid API key or token is required as \"Authorization: Bearer <credential>\"", errUnauthorized)
+)
+
+// keyPrefix starts every API key created by the gateway, so that leaked keys are easy to spot.
+const keyPrefix = "nxk_"
+
+// APIKey is the record of an API key. The key itself is not kept, only its hash.
+type APIKey struct {
+	// ID identifies the key in the admin API, and names its limits. The ID of a key of the
+	// configuration is its name.
+	ID   string `json:"id"`
+	Name string `json:"name,omitempty"`
+
+	// TenantID attributes the requests made with the key to a tenant.
+	TenantID string `json:"tenantId,omitempty"`
+
+	// AllowedModels and the limits below are the quota.Policy of keys created at runtime.
+	// Keys of the configuration have the gateway.key_policies entry of their name instead.
+	AllowedModels       []string `json:"allowedModels,omitempty"`
+	RequestsPerMinute   int      `json:"requestsPerMinute,omitempty"`
+	TokensPerMinute     int      `json:"tokensPerMinute,omitempty"`
+	MaxTokensPerRequest int      `json:"maxTokensPerRequest,omitempty"`
+	BatchPercent        int      `json:"batchPercent,omitempty"`
+
+	CreatedAt time.Time `json:"createdAt,omitempty"`
+
+	configured bool // set on keys of the configuration
+}
+
+// policy returns the quota policy of a key created at runtime.
+func (k *APIKey) policy() (quota.Policy, bool) {
+	if k.configured {
+		return quota.Policy{}, false
+	}
+	return quota.Policy{
+		RequestsPerMinute:   k.RequestsPerMinute,
+		TokensPerMinute:     k.TokensPerMinute,
+		AllowedModels:       k.AllowedModels,
+		MaxTokensPerRequest: k.MaxTokensPerRequest,
+		BatchPercent:        k.BatchPercent,
+	}, true
+}
+
+// KeyStore holds the API keys the gateway accepts, by the hash of the key.
+type KeyStore interface {
+	// Lookup returns the key whose hash is hash, or ErrKeyNotFound.
+	Lookup(ctx context.Context, hash string) (*APIKey, error)
+
+	// Create adds key under hash.
+	Create(ctx context.Context, hash string, key *APIKey) error
+
+	// Revoke removes the key with the given ID, or returns ErrKeyNotFound.
+	Revoke(ctx context.Context, id string) error
+}
+
+// HashKey returns the hash under which key is stored: its hex-encoded SHA-256, as in the
+// hash of config.APIKeyConfig.
+func HashKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// newKey returns a random API key.
+func newKey() (string, error) {
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("generating API key: %w", err)
+	}
+	return keyPrefix + hex.EncodeToString(b), nil
+}
+
+// newKeyID returns a random ID for a key created at runtime.
+func newKeyID() (string, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("generating API key ID: %w", err)
+	}
+	return "key_" + hex.EncodeToString(b), nil
+}
+
+// StaticKeys is a KeyStore of the keys of the configuration, which cannot be changed.
+type StaticKeys struct {
+	keys map[string]*APIKey // hash -> key
+}
+
+// NewStaticKeys returns a StaticKeys holding keys, typically gateway.auth.keys.
+func NewStaticKeys(keys []config.APIKeyConfig) *StaticKeys {
+	s := &StaticKeys{keys: make(map[string]*APIKey, len(keys))}
+	for _, k := range keys {
+		s.keys[strings.ToLower(k.Hash)] = &APIKey{ID: k.Name, Name: k.Name, TenantID: k.TenantID, configured: true}
+	}
+	return s
+}
+
+// Lookup implements KeyStore.
+func (s *StaticKeys) Lookup(ctx context.Context, hash string) (*APIKey, error) {
+	if key, ok := s.keys[hash]; ok {
+		return key, nil
+	}
+	return nil, ErrKeyNotFound
+}
+
+// Create implements KeyStore. It always returns ErrKeyReadOnly.
+func (s *StaticKeys) Create(ctx context.Context, hash string, key *APIKey) error {
+	return ErrKeyReadOnly
+}
+
+// Revoke implements KeyStore. It returns ErrKeyReadOnly for the keys it holds.
+func (s *StaticKeys) Revoke(ctx context.Context, id string) error {
+	for _, key := range s.keys {
+		if key.ID == id {
+			return ErrKeyReadOnly
+		}
+	}
+	return ErrKeyNotFound
+}
+
+// Keys of StoredKeys in the store.
+const (
+	storedKeyPrefix   = "apikey:"    // + hash -> APIKey as JSON
+	storedKeyIDPrefix = "apikey:id:" // + ID -> hash
+)
+
+// StoredKeys is a KeyStore keeping the keys created at runtime in a store.Store, such as
+// Redis, so that every replica of the gateway accepts them. It also accepts the keys of the
+// configuration.
+type StoredKeys struct {
+	store  store.Store
+	static *StaticKeys
+}
+
+// NewStoredKeys returns a StoredKeys keeping its keys in st and accepting the keys of the
+// configuration.
+func NewStoredKeys(st store.Store, keys []config.APIKeyConfig) *StoredKeys {
+	return &StoredKeys{store: st, static: NewStaticKeys(keys)}
+}
+
+// Lookup implements KeyStore.
+func (s *StoredKeys) Lookup(ctx context.Context, hash string) (*APIKey, error) {
+	if key, err := s.static.Lookup(ctx, hash); err == nil {
+		return key, nil
+	}
+	data, err := s.store.Get(ctx, storedKeyPrefix+hash)
+	if errors.Is(err, store.ErrNotFound) {
+		return nil, ErrKeyNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("gateway: looking up API key: %w", err)
+	}
+	var key APIKey
+	if err := json.Unmarshal(data, &key); err != nil {
+		return nil, fmt.Errorf("gateway: decoding API key: %w", err)
+	}
+	return &key, nil
+}
+
+// Create implements KeyStore.
+func (s *StoredKeys) Create(ctx context.Context, hash string, key *APIKey) error {
+	data, err := json.Marshal(key)
+	if err != nil {
+		return fmt.Errorf("gateway: encoding API key: %w", err)
+	}
+	created, err := s.store.SetNX(ctx, storedKeyIDPrefix+key.ID, []byte(hash), 0)
+	if err != nil {
+		return fmt.Errorf("gateway: storing API key: %w", err)
+	}
+	if !created {
+		return fmt.Errorf("gateway: API key %s already exists", key.ID)
+	}
+	if err := s.store.Set(ctx, storedKeyPrefix+hash, data, 0); err != nil {
+		s.store.Delete(ctx, storedKeyIDPrefix+key.ID)
+		return fmt.Errorf("gateway: storing API key: %w", err)
+	}
+	return nil
+}
+
+// Revoke implements KeyStore. Keys of the configuration cannot be revoked.
+func (s *StoredKeys) Revoke(ctx context.Context, id string) error {
+	if err := s.static.Revoke(ctx, id); err != ErrKeyNotFound {
+		return err
+	}
+	hash, err := s.store.Get(ctx, storedKeyIDPrefix+id)
+	if errors.Is(err, store.ErrNotFound) {
+		return ErrKeyNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("gateway: looking up API key: %w", err)
+	}
+	if err := s.store.Delete(ctx, storedKeyPrefix+string(hash), storedKeyIDPrefix+id); err != nil {
+		return fmt.Errorf("gateway: revoking API key: %w", err)
+	}
+	return nil
+}
+
+// apiKeyContextKey is the context key of the API key of a request.
+type apiKeyContextKey struct{}
+
+// tokenContextKey is the context key of the claims of the token of a request.
+type tokenContextKey struct{}
+
+// keyFrom returns the API key of the request made with ctx, if it was authenticated by one.
+func keyFrom(ctx context.Context) (*APIKey, bool) {
+	key, ok := ctx.Value(apiKeyContextKey{}).(*APIKey)
+	return key, ok
+}
+
+// claimsFrom returns the claims of the token of the request made with ctx, if it was
+// authenticated by one.
+func claimsFrom(ctx context.Context) (*tokenClaims, bool) {
+	claims, ok := ctx.Value(tokenContextKey{}).(*tokenClaims)
+	return claims, ok
+}
+
+// callerFrom returns the identity of the authenticated caller of a request made with ctx: the
+// ID of its API key, or the subject of its token.
+func callerFrom(ctx context.Context) (string, bool) {
+	if key, ok := keyFrom(ctx); ok {
+		return key.ID, true
+	}
+	if claims, ok := claimsFrom(ctx); ok {
+		return "oidc:" + claims.Subject, true
+	}
+	return "", false
+}
+
+// newQuotas returns the quotas of the API keys: the key policies of the configuration, or
+// the policy stored with a key created at runtime. Each subject of a token has the default
+// policy, with its own limits.
+func newQuotas(cfg config.GatewayConfig) *quota.Quotas {
+	policies := make(map[string]quota.Policy, len(cfg.KeyPolicies))
+	for name, p := range cfg.KeyPolicies {
+		policies[name] = quota.Policy{
+			RequestsPerMinute:   p.RequestsPerMinute,
+			TokensPerMinute:     p.TokensPerMinute,
+			AllowedModels:       p.AllowedModels,
+			MaxTokensPerRequest: p.MaxTokensPerRequest,
+			BatchPercent:        p.BatchPercent,
+		}
+	}
+	return quota.New(quota.Options{
+		Policies: policies,
+		KeyFrom:  callerFrom,
+		PolicyFrom: func(ctx context.Context) (quota.Policy, bool) {
+			if key, ok := keyFrom(ctx); ok {
+				return key.policy()
+			}
+			return quota.Policy{}, false
+		},
+	})
+}
+
+// authenticate returns ctx carrying the API key or the token claims of the authorization
+// header, which must hold a valid key, or a valid token of the OIDC issuer, when auth is
+// enabled.
+func (s *Server) authenticate(ctx context.Context, authorization string) (context.Context, error) {
+	if !s.config.Gateway.Auth.Enabled {
+		return ctx, nil
+	}
+	credential, ok := strings.CutPrefix(authorization, "Bearer ")
+	if !ok || credential == "" {
+		return ctx, errNoCredentials
+	}
+	if s.oidc != nil && isToken(credential) {
+		claims, err := s.oidc.verify(ctx, credential)
+		if err != nil {
+			return ctx, err
+		}
+		return context.WithValue(ctx, tokenContextKey{}, claims), nil
+	}
+	key, err := s.opts.Keys.Lookup(ctx, HashKey(credential))
+	if errors.Is(err, ErrKeyNotFound) {
+		return ctx, errNoCredentials
+	}
+	if err != nil {
+		return ctx, err
+	}
+	return context.WithValue(ctx, apiKeyContextKey{}, key), nil
+}
+
+// requireAuth rejects requests without valid credentials, when auth is enabled, writing their
+// error with writeErr, and passes the key or token claims of the others to next in their
+// context.
+func (s *Server) requireAuth(next http.HandlerFunc, writeErr func(http.ResponseWriter, int, errorBody)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx, err := s.authenticate(r.Context(), r.Header.Get("Authorization"))
+		if err != nil {
+			status, body := errorResponse(r.Context(), err)
+			if status == http.StatusUnauthorized {
+				w.Header().Set("WWW-Authenticate", `Bearer realm="nexen"`)
+			}
+			writeErr(w, status, body)
+			return
+		}
+		next(w, r.WithContext(ctx))
+	}
+}
+
+// authenticateRPC authenticates a gRPC call by its "authorization" metadata.
+func (s *Server) authenticateRPC(ctx context.Context) (context.Context, error) {
+	var authorization string
+	if values := metadata.ValueFromIncomingContext(ctx, "authorization"); len(values) > 0 {
+		authorization = values[0]
+	}
+	ctx, err := s.authenticate(ctx, authorization)
+	if err != nil {
+		return ctx, grpcError(ctx, err)
+	}
+	return ctx, nil
+}
+
+// attribute attributes request to the tenant of the API key it was made with, or to the
+// tenant and user of its token, if any, so that callers cannot spend as another tenant.
+func attribute(ctx context.Context, request *models.LLMRequest) {
+	if key, ok := keyFrom(ctx); ok && key.TenantID != "" {
+		request.Metadata.TenantID = key.TenantID
+	}
+	if claims, ok := claimsFrom(ctx); ok {
+		if claims.TenantID != "" {
+			request.Metadata.TenantID = claims.TenantID
+		}
+		if claims.UserID != "" {
+			request.Metadata.UserID = claims.UserID
+		}
+	}
+}
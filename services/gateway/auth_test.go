@@ -0,0 +1,243 @@
+package gateway
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/nexen/config"
+	"github.com/nexen/libs/flags"
+	"github.com/nexen/libs/store"
+	"github.com/nexen/models"
+	"github.com/nexen/services/connectors"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// tenantLLM replies with the tenant the request is attributed to.
+type tenantLLM struct{ stubLLM }
+
+func (t *tenantLLM) Call(ctx context.Context, request *models.LLMRequest) (*models.LLMResponse, error) {
+	return &models.LLMResponse{Content: &models.Content{Role: "assistant", Message: request.Metadata.TenantID}}, nil
+}
+
+// flagLLM replies "on" or "off" as its flag is enabled for the tenant of the call.
+type flagLLM struct {
+	stubLLM
+	flags *flags.Flags
+}
+
+func (f *flagLLM) Call(ctx context.Context, request *models.LLMRequest) (*models.LLMResponse, error) {
+	state := "off"
+	if f.flags.Enabled(ctx, "new-path") {
+		state = "on"
+	}
+	return &models.LLMResponse{Content: &models.Content{Role: "assistant", Message: state}}, nil
+}
+
+const searchKey = "nxk_search"
+
+// authConfig enables auth with the key searchKey, named "search", of the tenant "acme", which
+// may only use the model "echo".
+func authConfig() config.GatewayConfig {
+	return config.GatewayConfig{
+		Auth: config.AuthConfig{
+			Enabled:    true,
+			Keys:       []config.APIKeyConfig{{Name: "search", Hash: HashKey(searchKey), TenantID: "acme"}},
+			AdminToken: "admin-token",
+		},
+		KeyPolicies: map[string]config.KeyPolicy{"search": {AllowedModels: []string{"echo", "tenant"}}},
+	}
+}
+
+func authServer() *Server {
+	cfg := authConfig()
+	s := testServer(cfg)
+	s.opts.Keys = NewStoredKeys(store.NewMemory(), cfg.Auth.Keys)
+	s.opts.Clients.(stubClients)["tenant"] = &tenantLLM{}
+	return s
+}
+
+// send sends a request with the bearer token, if any, and decodes its JSON response.
+func send(t *testing.T, s *Server, method, path, token, body string) (*httptest.ResponseRecorder, map[string]any) {
+	t.Helper()
+	r := httptest.NewRequest(method, path, strings.NewReader(body))
+	if token != "" {
+		r.Header.Set("Authorization", "Bearer "+token)
+	}
+	rec := httptest.NewRecorder()
+	s.Handler().ServeHTTP(rec, r)
+	var decoded map[string]any
+	if rec.Body.Len() > 0 {
+		if err := json.Unmarshal(rec.Body.Bytes(), &decoded); err != nil {
+			t.Fatalf("Invalid response body %q: %v", rec.Body.String(), err)
+		}
+	}
+	return rec, decoded
+}
+
+func TestAuthRequiresKey(t *testing.T) {
+	s := authServer()
+	call := `{"model": "tenant", "contents": [{"role": "user", "message": "Hi"}]}`
+	for _, token := range []string{"", "nxk_other"} {
+		rec, body := send(t, s, http.MethodPost, "/v1/llm/call", token, call)
+		if rec.Code != http.StatusUnauthorized || errorCode(body) != codeUnauthorized || rec.Header().Get("WWW-Authenticate") == "" {
+			t.Errorf("Key %q: expected 401, got %d %v", token, rec.Code, body)
+		}
+	}
+
+	// Requests are attributed to the key's tenant, whatever they say
+	rec, body := send(t, s, http.MethodPost, "/v1/llm/call", searchKey, `{"model": "tenant", "contents": [{"role": "user", "message": "Hi"}], "metadata": {"tenantId": "other"}}`)
+	if rec.Code != http.StatusOK || body["content"].(map[string]any)["message"] != "acme" {
+		t.Errorf("Expected the key's tenant, got %d %v", rec.Code, body)
+	}
+
+	// The key policy of its name applies
+	rec, body = send(t, s, http.MethodPost, "/v1/llm/call", searchKey, `{"model": "streaming", "contents": [{"role": "user", "message": "Hi"}]}`)
+	if rec.Code != http.StatusForbidden || errorCode(body) != codeModelNotAllowed {
+		t.Errorf("Expected 403, got %d %v", rec.Code, body)
+	}
+
+	// The chat completions endpoint answers in OpenAI's format
+	rec, body = send(t, s, http.MethodPost, "/v1/chat/completions", "", `{"model": "echo", "messages": [{"role": "user", "content": "Hi"}]}`)
+	if e, _ := body["error"].(map[string]any); rec.Code != http.StatusUnauthorized || e["type"] != "invalid_request_error" {
+		t.Errorf("Expected an OpenAI error, got %d %v", rec.Code, body)
+	}
+}
+
+func TestModelAccess(t *testing.T) {
+	connectors.SetModelAccess(connectors.ModelAccess{Deny: []string{"slow"}})
+	connectors.SetTenantModelAccess("acme", connectors.ModelAccess{Allow: []string{"tenant"}})
+	t.Cleanup(func() {
+		connectors.SetModelAccess()
+		connectors.DeleteTenantModelAccess("acme")
+	})
+
+	// The process rules apply to every caller
+	rec, body := post(t, testServer(config.GatewayConfig{}), "/v1/llm/call", `{"model": "slow", "contents": [{"role": "user", "message": "Hi"}]}`)
+	if rec.Code != http.StatusForbidden || errorCode(body) != codeModelNotAllowed {
+		t.Errorf("Expected the denied model to be refused with 403, got %d %v", rec.Code, body)
+	}
+
+	// The tenant's rule applies to the tenant of the key, even when its key policy allows the model
+	s := authServer()
+	rec, body = send(t, s, http.MethodPost, "/v1/llm/call", searchKey, `{"model": "echo", "contents": [{"role": "user", "message": "Hi"}]}`)
+	if rec.Code != http.StatusForbidden || errorCode(body) != codeModelNotAllowed {
+		t.Errorf("Expected the tenant's rule to refuse echo with 403, got %d %v", rec.Code, body)
+	}
+	if rec, body := send(t, s, http.MethodPost, "/v1/llm/call", searchKey, `{"model": "tenant", "contents": [{"role": "user", "message": "Hi"}]}`); rec.Code != http.StatusOK {
+		t.Errorf("Expected the tenant's allowed model to be served, got %d %v", rec.Code, body)
+	}
+
+	// Sessions are refused at setup
+	conn := dialSession(t, stubClients{"slow": &stubLLM{}})
+	sendMessage(t, conn, sessionMessage{Type: sessionSetup, Setup: &models.LLMRequest{Model: "slow"}})
+	if msg := receive(t, conn); msg.Type != sessionError || msg.Error.Code != codeModelNotAllowed {
+		t.Errorf("Expected the session setup to be refused, got %+v", msg)
+	}
+}
+
+func TestTenantFlags(t *testing.T) {
+	s := authServer()
+	s.opts.Clients.(stubClients)["tenant"] = &flagLLM{flags: flags.New(map[string]config.FlagConfig{
+		"new-path": {Rollout: 0, Tenants: map[string]bool{"acme": true}},
+	}, nil)}
+
+	// The flag is off for everyone but the tenant of the key
+	rec, body := send(t, s, http.MethodPost, "/v1/llm/call", searchKey, `{"model": "tenant", "contents": [{"role": "user", "message": "Hi"}]}`)
+	if rec.Code != http.StatusOK || body["content"].(map[string]any)["message"] != "on" {
+		t.Errorf("Expected the tenant's override to enable the flag, got %d %v", rec.Code, body)
+	}
+}
+
+func TestKeyAdmin(t *testing.T) {
+	s := authServer()
+	rec, _ := send(t, s, http.MethodPost, keysPath, "wrong", `{}`)
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("Expected the admin token to be required, got %d", rec.Code)
+	}
+
+	rec, body := send(t, s, http.MethodPost, keysPath, "admin-token", `{"name": "batch jobs", "tenantId": "globex", "allowedModels": ["tenant"], "requestsPerMinute": 1}`)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("Expected 201, got %d %v", rec.Code, body)
+	}
+	key, id := body["key"].(string), body["id"].(string)
+	if !strings.HasPrefix(key, keyPrefix) || !strings.HasPrefix(id, "key_") || body["tenantId"] != "globex" {
+		t.Fatalf("Unexpected key %v", body)
+	}
+
+	// The key's own limits apply
+	call := `{"model": "tenant", "contents": [{"role": "user", "message": "Hi"}]}`
+	rec, body = send(t, s, http.MethodPost, "/v1/llm/call", key, call)
+	if rec.Code != http.StatusOK || body["content"].(map[string]any)["message"] != "globex" {
+		t.Errorf("Expected the key's tenant, got %d %v", rec.Code, body)
+	}
+	rec, body = send(t, s, http.MethodPost, "/v1/llm/call", key, call)
+	if rec.Code != http.StatusTooManyRequests || errorCode(body) != codeQuotaExceeded || rec.Header().Get("Retry-After") == "" {
+		t.Errorf("Expected 429 with Retry-After, got %d %v", rec.Code, body)
+	}
+
+	rec, _ = send(t, s, http.MethodDelete, keysPath+"/"+id, "admin-token", "")
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("Expected 204, got %d", rec.Code)
+	}
+	if rec, _ = send(t, s, http.MethodPost, "/v1/llm/call", key, call); rec.Code != http.StatusUnauthorized {
+		t.Errorf("Expected the revoked key to be refused, got %d", rec.Code)
+	}
+
+	testCases := []struct {
+		name, method, path, body string
+		status                   int
+	}{
+		{"revoked twice", http.MethodDelete, keysPath + "/" + id, "", http.StatusNotFound},
+		{"configured key", http.MethodDelete, keysPath + "/search", "", http.StatusBadRequest},
+		{"negative limit", http.MethodPost, keysPath, `{"tokensPerMinute": -1}`, http.StatusBadRequest},
+		{"invalid pattern", http.MethodPost, keysPath, `{"allowedModels": ["gpt-["]}`, http.StatusBadRequest},
+	}
+	for _, tc := range testCases {
+		if rec, body := send(t, s, tc.method, tc.path, "admin-token", tc.body); rec.Code != tc.status {
+			t.Errorf("%s: expected %d, got %d %v", tc.name, tc.status, rec.Code, body)
+		}
+	}
+}
+
+func TestKeyAdminWithStaticKeys(t *testing.T) {
+	s := testServer(authConfig())
+	rec, body := send(t, s, http.MethodPost, keysPath, "admin-token", `{"name": "batch jobs"}`)
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected static keys to be read-only, got %d %v", rec.Code, body)
+	}
+}
+
+func TestRegistryAdmin(t *testing.T) {
+	s := testServer(authConfig())
+	path := connectorsAdminPath + "/models/registryprobe"
+	if rec, _ := send(t, s, http.MethodPut, path, searchKey, `{"provider": "mistral"}`); rec.Code != http.StatusUnauthorized {
+		t.Errorf("Expected the admin token to be required, got %d", rec.Code)
+	}
+	rec, body := send(t, s, http.MethodPut, path, "admin-token", `{"provider": "mistral", "maxTokens": 1000}`)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("Expected 201, got %d %v", rec.Code, body)
+	}
+	if info, err := models.Resolve("registryprobe"); err != nil || info.MaxTokens != 1000 {
+		t.Errorf("Resolve() = %+v, %v", info, err)
+	}
+	if rec, _ := send(t, s, http.MethodDelete, path, "admin-token", ""); rec.Code != http.StatusNoContent {
+		t.Errorf("Expected 204, got %d", rec.Code)
+	}
+}
+
+func TestGRPCAuth(t *testing.T) {
+	client := grpcClient(t, authConfig())
+	if _, err := client.Call(context.Background(), grpcRequest("echo", "Hi")); status.Code(err) != codes.Unauthenticated {
+		t.Errorf("Expected Unauthenticated, got %v", err)
+	}
+	ctx := metadata.AppendToOutgoingContext(context.Background(), "authorization", "Bearer "+searchKey)
+	if _, err := client.Call(ctx, grpcRequest("echo", "Hi")); err != nil {
+		t.Errorf("Call() error = %v", err)
+	}
+}
@@ -0,0 +1,494 @@
+package gateway
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nexen/models"
+	"github.com/nexen/services/connectors/common"
+)
+
+// chatRequest is the body of POST /v1/chat/completions, in OpenAI's format. Fields without
+// an equivalent in models.LLMRequest are ignored rather than rejected, so that SDKs can send
+// their defaults.
+type chatRequest struct {
+	Model               string              `json:"model"`
+	Messages            []chatMessage       `json:"messages"`
+	Tools               []chatTool          `json:"tools"`
+	ToolChoice          json.RawMessage     `json:"tool_choice"`
+	Temperature         float64             `json:"temperature"`
+	TopP                float64             `json:"top_p"`
+	MaxTokens           int                 `json:"max_tokens"`
+	MaxCompletionTokens int                 `json:"max_completion_tokens"`
+	Stop                json.RawMessage     `json:"stop"`
+	N                   int                 `json:"n"`
+	Logprobs            bool                `json:"logprobs"`
+	TopLogprobs         int                 `json:"top_logprobs"`
+	ResponseFormat      *chatResponseFormat `json:"response_format"`
+	ServiceTier         string              `json:"service_tier"`
+	User                string              `json:"user"`
+	Stream              bool                `json:"stream"`
+	StreamOptions       *chatStreamOptions  `json:"stream_options"`
+}
+
+// chatMessage is a message of a chat completions request, whose content may be a string,
+// null, or an array of content parts.
+type chatMessage struct {
+	Role       string          `json:"role"`
+	Content    json.RawMessage `json:"content"`
+	Name       string          `json:"name"`
+	ToolCalls  []chatToolCall  `json:"tool_calls"`
+	ToolCallID string          `json:"tool_call_id"`
+}
+
+// chatTool declares a function the model may call.
+type chatTool struct {
+	Type     string          `json:"type"`
+	Function json.RawMessage `json:"function"`
+}
+
+// chatToolCall is a function call made by the model, with JSON-encoded arguments. Index is
+// only set in streamed deltas.
+type chatToolCall struct {
+	Index    *int             `json:"index,omitempty"`
+	ID       string           `json:"id"`
+	Type     string           `json:"type"`
+	Function chatFunctionCall `json:"function"`
+}
+
+// chatFunctionCall holds the function name and JSON-encoded arguments of a tool call.
+type chatFunctionCall struct {
+	Name      string `json:"name"`
+	Arguments string `json:"arguments"`
+}
+
+// chatResponseFormat selects JSON mode ("json_object") or schema-constrained output
+// ("json_schema").
+type chatResponseFormat struct {
+	Type       string `json:"type"`
+	JSONSchema *struct {
+		Name   string `json:"name"`
+		Schema any    `json:"schema"`
+	} `json:"json_schema"`
+}
+
+// chatStreamOptions configures streamed responses.
+type chatStreamOptions struct {
+	IncludeUsage bool `json:"include_usage"`
+}
+
+// chatCompletion is the response of POST /v1/chat/completions, and each chunk of a streamed
+// one.
+type chatCompletion struct {
+	ID      string       `json:"id"`
+	Object  string       `json:"object"`
+	Created int64        `json:"created"`
+	Model   string       `json:"model"`
+	Choices []chatChoice `json:"choices"`
+	Usage   *chatUsage   `json:"usage,omitempty"`
+}
+
+// chatChoice is the completion, with its Message, or a chunk of it, with its Delta.
+type chatChoice struct {
+	Index        int                 `json:"index"`
+	Message      *chatResponseOutput `json:"message,omitempty"`
+	Delta        *chatResponseOutput `json:"delta,omitempty"`
+	Logprobs     *chatLogprobs       `json:"logprobs,omitempty"`
+	FinishReason *string             `json:"finish_reason"`
+}
+
+// chatResponseOutput is the message of a completion, or the part of it in a chunk.
+type chatResponseOutput struct {
+	Role      string         `json:"role,omitempty"`
+	Content   *string        `json:"content,omitempty"`
+	ToolCalls []chatToolCall `json:"tool_calls,omitempty"`
+}
+
+// chatUsage reports the tokens of a completion.
+type chatUsage struct {
+	PromptTokens        int `json:"prompt_tokens"`
+	CompletionTokens    int `json:"completion_tokens"`
+	TotalTokens         int `json:"total_tokens"`
+	PromptTokensDetails struct {
+		CachedTokens int `json:"cached_tokens"`
+	} `json:"prompt_tokens_details"`
+}
+
+// chatLogprobs holds the log probabilities of the tokens of a completion.
+type chatLogprobs struct {
+	Content []chatTokenLogprob `json:"content"`
+}
+
+// chatTokenLogprob is the log probability of one token and its top alternatives.
+type chatTokenLogprob struct {
+	Token       string             `json:"token"`
+	Logprob     float64            `json:"logprob"`
+	TopLogprobs []chatTokenLogprob `json:"top_logprobs,omitempty"`
+}
+
+// chatError is the body of error responses of the chat completions endpoint, under "error".
+type chatError struct {
+	Message string  `json:"message"`
+	Type    string  `json:"type"`
+	Param   *string `json:"param"`
+	Code    string  `json:"code"`
+}
+
+// handleChatCompletions serves OpenAI's chat completions API, so that OpenAI SDKs and tools
+// can use the gateway as their base URL. Requests are converted to models.LLMRequest and sent
+// like those of /v1/llm/call; with "stream" set, the response is sent as server-sent events.
+func (s *Server) handleChatCompletions(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeChatError(w, http.StatusMethodNotAllowed, errorBody{Code: codeInvalidRequest, Message: "method not allowed"})
+		return
+	}
+	var chat chatRequest
+	if err := s.decode(w, r, &chat, false); err != nil {
+		writeChatError(w, http.StatusBadRequest, errorBody{Code: codeInvalidRequest, Message: err.Error()})
+		return
+	}
+	request, err := chat.toLLMRequest()
+	if err == nil {
+		err = request.Validate()
+	}
+	if err != nil {
+		writeChatError(w, http.StatusBadRequest, errorBody{Code: codeInvalidRequest, Message: err.Error()})
+		return
+	}
+
+	completion := chatCompletion{ID: newCompletionID(), Object: "chat.completion", Created: time.Now().Unix(), Model: chat.Model}
+	if chat.Stream {
+		s.streamChat(w, r, request, completion, chat.StreamOptions != nil && chat.StreamOptions.IncludeUsage)
+		return
+	}
+	response, err := s.call(r.Context(), request)
+	if err != nil {
+		status, body := errorResponse(r.Context(), err)
+		writeChatError(w, status, body)
+		return
+	}
+	text := responseText(response)
+	finish := finishReason(response)
+	completion.Choices = []chatChoice{{
+		Message:      &chatResponseOutput{Role: "assistant", Content: &text, ToolCalls: toolCalls(response, false)},
+		Logprobs:     fromLogprobs(response.Logprobs),
+		FinishReason: &finish,
+	}}
+	completion.Usage = fromUsage(response.Usage)
+	writeJSON(w, http.StatusOK, completion)
+}
+
+// streamChat sends the response of request as chunks of completion. Errors before the stream
+// starts get an error response; later ones end the stream with an error event.
+func (s *Server) streamChat(w http.ResponseWriter, r *http.Request, request *models.LLMRequest, completion chatCompletion, includeUsage bool) {
+	completion.Object = "chat.completion.chunk"
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+	events := newSSEWriter(w, s.config.Gateway.StreamHeartbeat, cancel)
+	first := true
+	var streamed bool
+	send := func(delta chatResponseOutput, finish *string) error {
+		chunk := completion
+		chunk.Choices = []chatChoice{{Delta: &delta, FinishReason: finish}}
+		return events.data(chunk)
+	}
+
+	err := s.stream(ctx, request, func(response *models.LLMResponse) error {
+		if first {
+			first = false
+			if err := send(chatResponseOutput{Role: "assistant"}, nil); err != nil {
+				return err
+			}
+		}
+		if response.IsPartial() {
+			streamed = true
+			text := responseText(response)
+			return send(chatResponseOutput{Content: &text}, nil)
+		}
+		// The final response holds the whole content, which was only sent when not streamed
+		if text := responseText(response); !streamed && text != "" {
+			if err := send(chatResponseOutput{Content: &text}, nil); err != nil {
+				return err
+			}
+		}
+		if calls := toolCalls(response, true); len(calls) > 0 {
+			if err := send(chatResponseOutput{ToolCalls: calls}, nil); err != nil {
+				return err
+			}
+		}
+		finish := finishReason(response)
+		if err := send(chatResponseOutput{}, &finish); err != nil {
+			return err
+		}
+		if includeUsage {
+			chunk := completion
+			chunk.Choices, chunk.Usage = []chatChoice{}, fromUsage(response.Usage)
+			return events.data(chunk)
+		}
+		return nil
+	})
+	events.close()
+	if err != nil {
+		status, body := errorResponse(ctx, err)
+		if !events.isStarted() {
+			writeChatError(w, status, body)
+		} else {
+			events.data(map[string]chatError{"error": toChatError(status, body)})
+		}
+		return
+	}
+	events.done()
+}
+
+// toLLMRequest converts c to a models.LLMRequest. System and developer messages become the
+// system instruction, and tool calls and results become function call and response parts.
+func (c *chatRequest) toLLMRequest() (*models.LLMRequest, error) {
+	if c.N > 1 {
+		return nil, errors.New("n greater than 1 is not supported")
+	}
+	request := &models.LLMRequest{
+		Model: c.Model,
+		Config: &models.GenerateContentConfig{
+			Temperature:      c.Temperature,
+			TopP:             c.TopP,
+			MaxTokens:        c.MaxTokens,
+			ResponseLogprobs: c.Logprobs,
+			TopLogprobs:      c.TopLogprobs,
+			ServiceTier:      c.ServiceTier,
+		},
+		Metadata: models.RequestMetadata{UserID: c.User},
+	}
+	if c.MaxCompletionTokens > 0 {
+		request.Config.MaxTokens = c.MaxCompletionTokens
+	}
+
+	var system []string
+	callNames := make(map[string]string)
+	for i, message := range c.Messages {
+		text, err := chatMessageText(message.Content)
+		if err != nil {
+			return nil, fmt.Errorf("messages[%d]: %w", i, err)
+		}
+		switch message.Role {
+		case "system", "developer":
+			system = append(system, text)
+		case "tool":
+			part := models.NewFunctionResponsePart(models.FunctionResponse{ID: message.ToolCallID, Name: callNames[message.ToolCallID], Response: text})
+			if n := len(request.Contents); n > 0 && request.Contents[n-1].Role == "tool" {
+				request.Contents[n-1].Parts = append(request.Contents[n-1].Parts, part)
+			} else {
+				request.Contents = append(request.Contents, models.Content{Role: "tool", Parts: []any{part}})
+			}
+		case "user", "assistant":
+			content := models.Content{Role: message.Role, Message: text}
+			if len(message.ToolCalls) > 0 && text != "" {
+				content.Parts = append(content.Parts, text)
+			}
+			for _, call := range message.ToolCalls {
+				var args map[string]any
+				if call.Function.Arguments != "" {
+					if err := json.Unmarshal([]byte(call.Function.Arguments), &args); err != nil {
+						return nil, fmt.Errorf("messages[%d]: arguments of %s: %w", i, call.Function.Name, err)
+					}
+				}
+				callNames[call.ID] = call.Function.Name
+				content.Parts = append(content.Parts, models.NewFunctionCallPart(models.FunctionCall{ID: call.ID, Name: call.Function.Name, Args: args}))
+			}
+			request.Contents = append(request.Contents, content)
+		default:
+			return nil, fmt.Errorf("messages[%d]: unknown role %q", i, message.Role)
+		}
+	}
+	request.Config.SystemInstruction = strings.Join(system, "\n\n")
+
+	if len(c.Tools) > 0 {
+		var declarations []string
+		for i, tool := range c.Tools {
+			if tool.Type != "function" {
+				return nil, fmt.Errorf("tools[%d]: tool type %q is not supported", i, tool.Type)
+			}
+			declarations = append(declarations, string(tool.Function))
+		}
+		request.Config.Tools = []models.ToolDeclaration{{FunctionDeclarations: declarations}}
+	}
+	if len(c.ToolChoice) > 0 && string(c.ToolChoice) != "null" {
+		var choice struct {
+			Function struct {
+				Name string `json:"name"`
+			} `json:"function"`
+		}
+		if err := json.Unmarshal(c.ToolChoice, &request.Config.ToolChoice); err != nil {
+			if err := json.Unmarshal(c.ToolChoice, &choice); err != nil || choice.Function.Name == "" {
+				return nil, errors.New("tool_choice must be a mode or a function")
+			}
+			request.Config.ToolChoice = choice.Function.Name
+		}
+	}
+	if len(c.Stop) > 0 && string(c.Stop) != "null" {
+		var stop string
+		if err := json.Unmarshal(c.Stop, &stop); err == nil {
+			request.Config.StopSequences = []string{stop}
+		} else if err := json.Unmarshal(c.Stop, &request.Config.StopSequences); err != nil {
+			return nil, errors.New("stop must be a string or an array of strings")
+		}
+	}
+	if f := c.ResponseFormat; f != nil {
+		switch f.Type {
+		case "", "text":
+		case "json_object":
+			request.Config.JSONMode = true
+		case "json_schema":
+			if f.JSONSchema == nil || f.JSONSchema.Schema == nil {
+				return nil, errors.New("response_format.json_schema.schema is required")
+			}
+			request.Config.ResponseSchema = f.JSONSchema.Schema
+		default:
+			return nil, fmt.Errorf("response_format type %q is not supported", f.Type)
+		}
+	}
+	return request, nil
+}
+
+// chatMessageText returns the text of message content given as a string, null, or an array
+// of text parts.
+func chatMessageText(raw json.RawMessage) (string, error) {
+	if len(raw) == 0 || string(raw) == "null" {
+		return "", nil
+	}
+	var text string
+	if err := json.Unmarshal(raw, &text); err == nil {
+		return text, nil
+	}
+	var parts []struct {
+		Type string `json:"type"`
+		Text string `json:"text"`
+	}
+	if err := json.Unmarshal(raw, &parts); err != nil {
+		return "", errors.New("content is neither text nor content parts")
+	}
+	var sb strings.Builder
+	for _, part := range parts {
+		if part.Type != "text" {
+			return "", fmt.Errorf("content part type %q is not supported", part.Type)
+		}
+		sb.WriteString(part.Text)
+	}
+	return sb.String(), nil
+}
+
+// responseText returns the text of a response: its message, or its text parts when it also
+// holds function calls.
+func responseText(response *models.LLMResponse) string {
+	if response.Content == nil {
+		return ""
+	}
+	if response.Content.Message != "" {
+		return response.Content.Message
+	}
+	var sb strings.Builder
+	for _, part := range response.Content.Parts {
+		if text, ok := part.(string); ok {
+			sb.WriteString(text)
+		}
+	}
+	return sb.String()
+}
+
+// toolCalls returns the function calls of a response as tool calls, indexed for streaming
+// when indexed is set.
+func toolCalls(response *models.LLMResponse, indexed bool) []chatToolCall {
+	var calls []chatToolCall
+	for i, call := range response.Content.FunctionCalls() {
+		args, _ := json.Marshal(call.Args)
+		if call.Args == nil {
+			args = []byte("{}")
+		}
+		toolCall := chatToolCall{ID: call.ID, Type: "function", Function: chatFunctionCall{Name: call.Name, Arguments: string(args)}}
+		if indexed {
+			index := i
+			toolCall.Index = &index
+		}
+		calls = append(calls, toolCall)
+	}
+	return calls
+}
+
+// finishReason returns OpenAI's finish reason for a response, translating the stop reasons
+// of other providers.
+func finishReason(response *models.LLMResponse) string {
+	if len(response.Content.FunctionCalls()) > 0 {
+		return "tool_calls"
+	}
+	reason, _ := response.CustomMetadata[common.MetadataFinishReason].(string)
+	if reason == "" && response.ErrorCode != nil {
+		reason = *response.ErrorCode
+	}
+	switch reason {
+	case "length", "max_tokens", "MAX_TOKENS":
+		return "length"
+	case "content_filter", "refusal", "CONTENT_FILTER", "SAFETY":
+		return "content_filter"
+	}
+	return "stop"
+}
+
+func fromUsage(usage models.UsageMetrics) *chatUsage {
+	u := &chatUsage{PromptTokens: usage.PromptTokens, CompletionTokens: usage.CompletionTokens, TotalTokens: usage.TotalTokens}
+	u.PromptTokensDetails.CachedTokens = usage.CachedPromptTokens
+	if u.TotalTokens == 0 {
+		u.TotalTokens = u.PromptTokens + u.CompletionTokens
+	}
+	return u
+}
+
+func fromLogprobs(logprobs *models.Logprobs) *chatLogprobs {
+	if logprobs == nil {
+		return nil
+	}
+	out := &chatLogprobs{Content: make([]chatTokenLogprob, len(logprobs.Tokens))}
+	for i, token := range logprobs.Tokens {
+		out.Content[i] = chatTokenLogprob{Token: token.Token, Logprob: token.Logprob}
+		for _, alt := range token.TopAlternatives {
+			out.Content[i].TopLogprobs = append(out.Content[i].TopLogprobs, chatTokenLogprob{Token: alt.Token, Logprob: alt.Logprob})
+		}
+	}
+	return out
+}
+
+// newCompletionID returns a random ID in OpenAI's format.
+func newCompletionID() string {
+	b := make([]byte, 12)
+	rand.Read(b)
+	return "chatcmpl-" + hex.EncodeToString(b)
+}
+
+// toChatError converts the body of an error response to OpenAI's format, whose type follows
+// the status.
+func toChatError(status int, body errorBody) chatError {
+	e := chatError{Message: body.Message, Code: body.Code, Type: "api_error"}
+	switch {
+	case status == http.StatusTooManyRequests:
+		e.Type = "rate_limit_error"
+	case status == http.StatusForbidden:
+		e.Type = "permission_error"
+	case status < 500:
+		e.Type = "invalid_request_error"
+	}
+	return e
+}
+
+// writeChatError writes body as an error response in OpenAI's format.
+func writeChatError(w http.ResponseWriter, status int, body errorBody) {
+	if body.retryAfterSeconds > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(body.retryAfterSeconds))
+	}
+	writeJSON(w, status, map[string]chatError{"error": toChatError(status, body)})
+}
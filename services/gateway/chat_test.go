@@ -0,0 +1,199 @@
+package gateway
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/nexen/config"
+	"github.com/nexen/models"
+)
+
+// toolLLM calls the function "lookup" with the last message as its query.
+type toolLLM struct{ stubLLM }
+
+func (t *toolLLM) Call(ctx context.Context, request *models.LLMRequest) (*models.LLMResponse, error) {
+	query := request.Contents[len(request.Contents)-1].Message
+	return &models.LLMResponse{Content: &models.Content{Role: "assistant", Parts: []any{
+		models.NewFunctionCallPart(models.FunctionCall{ID: "call_1", Name: "lookup", Args: map[string]any{"query": query}}),
+	}}}, nil
+}
+
+func chatServer() *Server {
+	s := testServer(config.GatewayConfig{})
+	clients := s.opts.Clients.(stubClients)
+	clients["tools"] = &toolLLM{}
+	return s
+}
+
+func TestChatCompletions(t *testing.T) {
+	s := chatServer()
+	rec, body := post(t, s, "/v1/chat/completions", `{
+		"model": "echo",
+		"messages": [{"role": "system", "content": "Be brief"}, {"role": "user", "content": "Hello"}],
+		"n": 1, "presence_penalty": 0
+	}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %v", rec.Code, body)
+	}
+	choice := body["choices"].([]any)[0].(map[string]any)
+	if body["object"] != "chat.completion" || choice["message"].(map[string]any)["content"] != "Hello" || choice["finish_reason"] != "stop" {
+		t.Errorf("Unexpected completion %v", body)
+	}
+	if !strings.HasPrefix(body["id"].(string), "chatcmpl-") || body["usage"] == nil {
+		t.Errorf("Expected an ID and usage, got %v", body)
+	}
+}
+
+func TestChatCompletionsToolCalls(t *testing.T) {
+	s := chatServer()
+	rec, body := post(t, s, "/v1/chat/completions", `{
+		"model": "tools",
+		"messages": [{"role": "user", "content": "weather in Paris"}],
+		"tools": [{"type": "function", "function": {"name": "lookup", "parameters": {"type": "object"}}}]
+	}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %v", rec.Code, body)
+	}
+	choice := body["choices"].([]any)[0].(map[string]any)
+	call := choice["message"].(map[string]any)["tool_calls"].([]any)[0].(map[string]any)
+	function := call["function"].(map[string]any)
+	if choice["finish_reason"] != "tool_calls" || call["id"] != "call_1" || function["name"] != "lookup" || function["arguments"] != `{"query":"weather in Paris"}` {
+		t.Errorf("Unexpected tool call %v", choice)
+	}
+}
+
+func TestChatRequestConversion(t *testing.T) {
+	var chat chatRequest
+	err := json.Unmarshal([]byte(`{
+		"model": "gpt-4o",
+		"messages": [
+			{"role": "developer", "content": "Be brief"},
+			{"role": "user", "content": [{"type": "text", "text": "Weather?"}]},
+			{"role": "assistant", "content": null, "tool_calls": [{"id": "c1", "type": "function", "function": {"name": "lookup", "arguments": "{\"city\":\"Paris\"}"}}]},
+			{"role": "tool", "tool_call_id": "c1", "content": "Sunny"}
+		],
+		"tools": [{"type": "function", "function": {"name": "lookup"}}],
+		"tool_choice": {"type": "function", "function": {"name": "lookup"}},
+		"stop": "END",
+		"max_completion_tokens": 64,
+		"response_format": {"type": "json_schema", "json_schema": {"name": "answer", "schema": {"type": "object"}}},
+		"user": "u1"
+	}`), &chat)
+	if err != nil {
+		t.Fatal(err)
+	}
+	request, err := chat.toLLMRequest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &models.LLMRequest{
+		Model: "gpt-4o",
+		Contents: []models.Content{
+			{Role: "user", Message: "Weather?"},
+			{Role: "assistant", Parts: []any{models.NewFunctionCallPart(models.FunctionCall{ID: "c1", Name: "lookup", Args: map[string]any{"city": "Paris"}})}},
+			{Role: "tool", Parts: []any{models.NewFunctionResponsePart(models.FunctionResponse{ID: "c1", Name: "lookup", Response: "Sunny"})}},
+		},
+		Config: &models.GenerateContentConfig{
+			SystemInstruction: "Be brief",
+			Tools:             []models.ToolDeclaration{{FunctionDeclarations: []string{`{"name": "lookup"}`}}},
+			ToolChoice:        "lookup",
+			ResponseSchema:    map[string]any{"type": "object"},
+			MaxTokens:         64,
+			StopSequences:     []string{"END"},
+		},
+		Metadata: models.RequestMetadata{UserID: "u1"},
+	}
+	if !reflect.DeepEqual(request, want) {
+		t.Errorf("Unexpected request:\ngot  %+v\nwant %+v", request, want)
+	}
+}
+
+func TestChatCompletionsErrors(t *testing.T) {
+	s := chatServer()
+	testCases := []struct {
+		name, body string
+		status     int
+		errorType  string
+	}{
+		{"no messages", `{"model": "echo", "messages": []}`, http.StatusBadRequest, "invalid_request_error"},
+		{"several choices", `{"model": "echo", "n": 2, "messages": [{"role": "user", "content": "Hi"}]}`, http.StatusBadRequest, "invalid_request_error"},
+		{"image", `{"model": "echo", "messages": [{"role": "user", "content": [{"type": "image_url"}]}]}`, http.StatusBadRequest, "invalid_request_error"},
+		{"unknown model", `{"model": "ecko", "messages": [{"role": "user", "content": "Hi"}]}`, http.StatusNotFound, "invalid_request_error"},
+		{"rate limited", `{"model": "limited", "messages": [{"role": "user", "content": "Hi"}]}`, http.StatusTooManyRequests, "rate_limit_error"},
+	}
+	for _, tc := range testCases {
+		rec, body := post(t, s, "/v1/chat/completions", tc.body)
+		e, _ := body["error"].(map[string]any)
+		if rec.Code != tc.status || e["type"] != tc.errorType {
+			t.Errorf("%s: expected %d %s, got %d %v", tc.name, tc.status, tc.errorType, rec.Code, body)
+		}
+	}
+}
+
+func TestChatCompletionsStream(t *testing.T) {
+	s := chatServer()
+	rec := httptest.NewRecorder()
+	s.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(`{
+		"model": "streaming", "stream": true, "stream_options": {"include_usage": true},
+		"messages": [{"role": "user", "content": "Hello there"}]
+	}`)))
+	events := streamEvents(t, rec)
+	if len(events) == 0 || events[len(events)-1] != "[DONE]" {
+		t.Fatalf("Expected the stream to end with [DONE], got %v", events)
+	}
+
+	var text strings.Builder
+	var finish string
+	var usage *chatUsage
+	for _, event := range events[:len(events)-1] {
+		var chunk chatCompletion
+		if err := json.Unmarshal([]byte(event), &chunk); err != nil {
+			t.Fatalf("Invalid chunk %q: %v", event, err)
+		}
+		if chunk.Object != "chat.completion.chunk" {
+			t.Errorf("Unexpected chunk %q", event)
+		}
+		if chunk.Usage != nil {
+			usage = chunk.Usage
+		}
+		for _, choice := range chunk.Choices {
+			if choice.Delta.Content != nil {
+				text.WriteString(*choice.Delta.Content)
+			}
+			if choice.FinishReason != nil {
+				finish = *choice.FinishReason
+			}
+		}
+	}
+	if text.String() != "Hello there" || finish != "stop" {
+		t.Errorf("Expected the streamed text once, got %q (%q)", text.String(), finish)
+	}
+	if usage == nil || usage.TotalTokens != 7 {
+		t.Errorf("Expected the usage at the end, got %+v", usage)
+	}
+}
+
+func TestChatCompletionsStreamWithoutStreamer(t *testing.T) {
+	s := chatServer()
+	rec := httptest.NewRecorder()
+	s.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(`{
+		"model": "echo", "stream": true, "messages": [{"role": "user", "content": "Hello"}]
+	}`)))
+	events := streamEvents(t, rec)
+	if len(events) != 4 || !strings.Contains(events[1], `"content":"Hello"`) || events[3] != "[DONE]" {
+		t.Errorf("Expected the role, content and finish chunks, got %v", events)
+	}
+}
+
+func TestChatCompletionsStreamError(t *testing.T) {
+	s := chatServer()
+	rec, body := post(t, s, "/v1/chat/completions", `{"model": "limited", "stream": true, "messages": [{"role": "user", "content": "Hi"}]}`)
+	if rec.Code != http.StatusTooManyRequests || body["error"].(map[string]any)["code"] != codeRateLimited {
+		t.Errorf("Expected an error response before the stream started, got %d %v", rec.Code, body)
+	}
+}
@@ -0,0 +1,182 @@
+// Command gateway runs the Nexen API gateway.
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/nexen/config"
+	"github.com/nexen/libs/redisx"
+	"github.com/nexen/libs/store"
+	"github.com/nexen/models"
+	"github.com/nexen/services/connectors"
+	"github.com/nexen/services/gateway"
+	"github.com/nexen/services/gateway/audit"
+	"github.com/nexen/services/gateway/audit/kafkasink"
+	"github.com/nexen/services/gateway/worker"
+	"github.com/nexen/services/gateway/worker/kafkaqueue"
+
+	// Import all connectors to register them
+	_ "github.com/nexen/services/connectors/anthropic"
+	_ "github.com/nexen/services/connectors/custom"
+	_ "github.com/nexen/services/connectors/google"
+	_ "github.com/nexen/services/connectors/llama"
+	_ "github.com/nexen/services/connectors/mistral"
+	_ "github.com/nexen/services/connectors/openai"
+)
+
+func main() {
+	cfg, err := config.LoadServiceConfig("gateway")
+	if err != nil {
+		slog.Error("loading config", "error", err)
+		os.Exit(1)
+	}
+	if err := cfg.Validate(); err != nil {
+		slog.Error("invalid config", "error", err)
+		os.Exit(1)
+	}
+	if err := loadModels(cfg); err != nil {
+		slog.Error("loading model catalog", "error", err)
+		os.Exit(1)
+	}
+	applyModelAccess(cfg)
+	if err := applyDeployments(cfg); err != nil {
+		slog.Error("applying deployments", "error", err)
+		os.Exit(1)
+	}
+
+	// Stop gracefully on SIGINT and SIGTERM
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// Rate limits, keys created at runtime and jobs are shared by the replicas through Redis
+	backend, err := store.Open(cfg.Redis)
+	if err != nil {
+		slog.Error("opening store", "error", err)
+		os.Exit(1)
+	}
+	defer backend.Close()
+	if expires(cfg.Retention) {
+		go store.NewJanitor(backend, cfg.Retention).Run(ctx)
+	}
+	opts := gateway.Options{Store: backend}
+	if cfg.Gateway.Auth.Store == config.KeyStoreRedis {
+		opts.Keys = gateway.NewStoredKeys(backend, cfg.Gateway.Auth.Keys)
+	}
+	if cfg.Gateway.Audit.Enabled {
+		sink, err := openAudit(cfg)
+		if err != nil {
+			slog.Error("opening audit log", "sink", cfg.Gateway.Audit.Sink, "error", err)
+			os.Exit(1)
+		}
+		defer sink.Close()
+		opts.Audit = sink
+	}
+	if cfg.Gateway.Worker.Enabled {
+		requests, replies, err := openWorker(cfg)
+		if err != nil {
+			slog.Error("opening worker queues", "transport", cfg.Gateway.Worker.Transport, "error", err)
+			os.Exit(1)
+		}
+		defer requests.Close()
+		defer replies.Close()
+		opts.Requests, opts.Replies = requests, replies
+	}
+
+	slog.Info("gateway listening", "host", cfg.Server.Host, "port", cfg.Server.Port)
+	if err := gateway.New(cfg, opts).ListenAndServe(ctx); err != nil {
+		slog.Error("gateway stopped", "error", err)
+		os.Exit(1)
+	}
+}
+
+// loadModels registers the built-in models and the catalog files of the configuration, and
+// its model aliases.
+func loadModels(cfg *config.Config) error {
+	if cfg.ModelCatalog.Builtin {
+		models.Init()
+	}
+	for _, path := range cfg.ModelCatalog.Files {
+		if err := models.LoadFromFile(path); err != nil {
+			return err
+		}
+	}
+	return models.SetAliases(cfg.ModelAliases)
+}
+
+// applyModelAccess refuses the models the model_access rules of the environment and of each
+// tenant do not allow.
+func applyModelAccess(cfg *config.Config) {
+	var rules []connectors.ModelAccess
+	for _, r := range cfg.ModelAccess.Rules(cfg.Environment) {
+		rules = append(rules, connectors.ModelAccess{Allow: r.Allow, Deny: r.Deny})
+	}
+	connectors.SetModelAccess(rules...)
+	for tenant, r := range cfg.ModelAccess.Tenants {
+		connectors.SetTenantModelAccess(tenant, connectors.ModelAccess{Allow: r.Allow, Deny: r.Deny})
+	}
+}
+
+// applyDeployments spreads the requests of each model of the deployments config over its
+// deployments.
+func applyDeployments(cfg *config.Config) error {
+	for model, d := range cfg.Deployments {
+		deployments := make([]connectors.DeploymentSettings, 0, len(d.Endpoints))
+		for _, e := range d.Endpoints {
+			deployments = append(deployments, connectors.DeploymentSettings{Name: e.Name, Endpoint: e.Endpoint, APIKey: e.APIKey, Weight: e.Weight})
+		}
+		if err := connectors.SetDeployments(model, d.Policy, deployments); err != nil {
+			return fmt.Errorf("deployments.%s: %w", model, err)
+		}
+	}
+	return nil
+}
+
+// expires reports whether a retention rule sets a max age, so that the retention janitor has
+// keys to delete.
+func expires(r config.RetentionConfig) bool {
+	for _, rule := range r.Rules() {
+		if rule.MaxAge > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// openAudit opens the sink of the gateway's audit log.
+func openAudit(cfg *config.Config) (audit.Sink, error) {
+	a := cfg.Gateway.Audit
+	switch a.Sink {
+	case config.AuditSinkRedis:
+		client, err := redisx.New(cfg.Redis, redisx.WithClientName("nexen-gateway-audit"))
+		if err != nil {
+			return nil, err
+		}
+		return audit.NewRedisSink(client, a.Stream, a.StreamMaxLen), nil
+	case config.AuditSinkKafka:
+		return kafkasink.New(a.Brokers, a.Topic), nil
+	default:
+		return audit.OpenFile(a.Path)
+	}
+}
+
+// openWorker opens the message queues of the gateway's worker.
+func openWorker(cfg *config.Config) (worker.Source, worker.Sink, error) {
+	w := cfg.Gateway.Worker
+	if w.Transport == config.WorkerTransportKafka {
+		return kafkaqueue.NewSource(w.Brokers, w.Requests, w.Group), kafkaqueue.NewSink(w.Brokers, w.Replies), nil
+	}
+	consumer := w.Consumer
+	if consumer == "" {
+		consumer, _ = os.Hostname()
+	}
+	client, err := redisx.New(cfg.Redis, redisx.WithClientName("nexen-gateway-worker"))
+	if err != nil {
+		return nil, nil, err
+	}
+	return worker.NewRedisSource(client, w.Requests, w.Group, consumer, w.ClaimIdle), worker.NewRedisSink(client, w.Replies, w.RepliesMaxLen), nil
+}
@@ -0,0 +1,133 @@
+package gateway
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/nexen/models"
+	"github.com/nexen/services/connectors/common"
+	"github.com/nexen/services/connectors/quota"
+)
+
+// Error codes of errorBody.Code.
+const (
+	codeInvalidRequest        = "invalid_request"
+	codeModelNotFound         = "model_not_found"
+	codeModelNotAllowed       = "model_not_allowed"
+	codeUnauthorized          = "unauthorized"
+	codeKeyNotFound           = "key_not_found"
+	codeJobNotFound           = "job_not_found"
+	codeRateLimited           = "rate_limited"
+	codeQuotaExceeded         = "quota_exceeded"
+	codeContextLengthExceeded = "context_length_exceeded"
+	codeCapabilityUnsupported = "capability_unsupported"
+	codeContentFiltered       = "content_filtered"
+	codeProviderAuth          = "provider_auth_failed"
+	codeProviderUnavailable   = "provider_unavailable"
+	codeOverloaded            = "overloaded"
+	codeTimeout               = "timeout"
+	codeCanceled              = "canceled"
+	codeUpstream              = "upstream_error"
+)
+
+// statusClientClosedRequest is the non-standard status logged for requests whose client went
+// away; the client never sees it.
+const statusClientClosedRequest = 499
+
+// errorBody is the body of error responses, under "error".
+type errorBody struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+
+	// Suggestions are the closest model names, for codeModelNotFound.
+	Suggestions []string `json:"suggestions,omitempty"`
+
+	// retryAfterSeconds is sent as the Retry-After header, when positive.
+	retryAfterSeconds int
+}
+
+// errorResponse maps an error of a call made with ctx to the status and body of its response.
+// Errors of the provider keep their class, so callers can tell a bad request from an outage.
+func errorResponse(ctx context.Context, err error) (int, errorBody) {
+	body := errorBody{Message: err.Error()}
+	var notFound *models.ModelNotFoundError
+	var provider *common.ProviderError
+	var quotaErr *quota.Error
+	if errors.As(err, &provider) && provider.RetryAfter > 0 {
+		body.retryAfterSeconds = int(provider.RetryAfter.Seconds() + 0.5)
+	}
+	if errors.As(err, &quotaErr) && quotaErr.RetryAfter > 0 {
+		body.retryAfterSeconds = int(quotaErr.RetryAfter.Seconds() + 0.5)
+	}
+	var limited *rateLimitError
+	var overloaded *overloadedError
+	switch {
+	case errors.As(err, &limited):
+		body.Code, body.retryAfterSeconds = codeRateLimited, retryAfterSeconds(limited.retryAfter)
+		return http.StatusTooManyRequests, body
+	case errors.As(err, &overloaded):
+		body.Code, body.retryAfterSeconds = codeOverloaded, retryAfterSeconds(overloaded.retryAfter)
+		return http.StatusServiceUnavailable, body
+	case errors.Is(err, errUnauthorized):
+		body.Code = codeUnauthorized
+		return http.StatusUnauthorized, body
+	case errors.Is(err, ErrKeyNotFound):
+		body.Code = codeKeyNotFound
+		return http.StatusNotFound, body
+	case errors.Is(err, errJobNotFound):
+		body.Code = codeJobNotFound
+		return http.StatusNotFound, body
+	case errors.Is(err, ErrKeyReadOnly):
+		body.Code = codeInvalidRequest
+		return http.StatusBadRequest, body
+	case errors.As(err, &notFound):
+		body.Code, body.Suggestions = codeModelNotFound, notFound.Suggestions
+		return http.StatusNotFound, body
+	case errors.Is(err, common.ErrModelNotAllowed) || errors.Is(err, quota.ErrModelNotAllowed):
+		body.Code = codeModelNotAllowed
+		return http.StatusForbidden, body
+	case errors.Is(err, quota.ErrQuotaExceeded):
+		body.Code = codeQuotaExceeded
+		return http.StatusTooManyRequests, body
+	case errors.Is(err, context.DeadlineExceeded) || errors.Is(ctx.Err(), context.DeadlineExceeded):
+		body.Code = codeTimeout
+		return http.StatusGatewayTimeout, body
+	case errors.Is(err, context.Canceled):
+		body.Code = codeCanceled
+		return statusClientClosedRequest, body
+	case errors.Is(err, common.ErrRateLimited):
+		body.Code = codeRateLimited
+		return http.StatusTooManyRequests, body
+	case errors.Is(err, common.ErrContextLengthExceeded):
+		body.Code = codeContextLengthExceeded
+		return http.StatusBadRequest, body
+	case errors.Is(err, models.ErrCapabilityUnsupported):
+		body.Code = codeCapabilityUnsupported
+		return http.StatusBadRequest, body
+	case errors.Is(err, common.ErrContentFiltered):
+		body.Code = codeContentFiltered
+		return http.StatusUnprocessableEntity, body
+	case errors.Is(err, common.ErrAuth):
+		// The gateway's own credentials for the provider failed, not the caller's
+		body.Code = codeProviderAuth
+		return http.StatusBadGateway, body
+	case errors.Is(err, common.ErrProviderUnavailable):
+		body.Code = codeProviderUnavailable
+		return http.StatusServiceUnavailable, body
+	case provider != nil && provider.StatusCode >= 400 && provider.StatusCode < 500:
+		body.Code = codeInvalidRequest
+		return http.StatusBadRequest, body
+	}
+	body.Code = codeUpstream
+	return http.StatusBadGateway, body
+}
+
+// writeError writes body as an error response with the given status.
+func writeError(w http.ResponseWriter, status int, body errorBody) {
+	if body.retryAfterSeconds > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(body.retryAfterSeconds))
+	}
+	writeJSON(w, status, map[string]errorBody{"error": body})
+}
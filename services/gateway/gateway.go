@@ -0,0 +1,374 @@
+// Package gateway serves the connectors to other services over the network.
+//
+// A Server exposes LLM calls as a REST API when the gateway configuration enables it:
+//
+//	POST /v1/llm/call          send one models.LLMRequest and get its models.LLMResponse
+//	POST /v1/llm/stream        send one request and get its response as server-sent events
+//	POST /v1/llm/batch         send several requests and get one result per request
+//	POST /v1/chat/completions  OpenAI's chat completions API, for OpenAI SDKs and tools
+//	GET  /v1/llm/session       hold an interactive session over a WebSocket
+//	POST /v1/jobs              submit a request to run in the background, with gateway.jobs
+//	GET  /v1/jobs/{id}         the status of a job, and its response once it is done
+//	GET  /healthz              liveness probe
+//	GET  /readyz               readiness probe: whether Options.Store can be reached
+//	GET  /status/providers     whether each provider can be pinged, and circuit states
+//	GET  /status/queues        the depth and counts of the providers' request queues
+//
+// and as the gRPC service LLMService of gatewaypb, with the methods Call, CallStream and
+// BatchCall, so that internal services can avoid the overhead of JSON.
+//
+// When gateway.auth is enabled, each request must carry an API key of the KeyStore of
+// Options.Keys, or a JWT of the configured OIDC issuer, as "Authorization: Bearer <credential>",
+// or as the "authorization" metadata of gRPC calls. Requests are attributed to the tenant of
+// their key, or to the tenant and user claims of their token, and held to its quotas: the
+// gateway.key_policies entry of a key of the configuration, the limits stored with a key
+// created through the admin API at /admin/keys, or the default policy. Each caller, by key,
+// token subject or else address, is also held to gateway.rate_limit_requests per
+// gateway.rate_limit_period, counted in Options.Store across replicas.
+//
+// Operators can change the model registry, model aliases and provider settings of a replica at
+// runtime through connectors.AdminHandler, served under /admin/connectors with
+// gateway.auth.admin_token.
+//
+// With gateway.queue, requests to a provider at its concurrency cap, or waiting out a
+// rate-limit error of the provider, are queued for a bounded time, interactive requests ahead
+// of batches, rather than failing at once; requests that find the queue full get a 503. The
+// priority of a request, models.PriorityInteractive or models.PriorityBatch, defaults per
+// tenant as gateway.priority says, and batch requests can be held to a share of their key's
+// rate limits and sent to cheaper models.
+//
+// Jobs submitted to /v1/jobs are kept, with their results, in Options.Store and scheduled on
+// Options.Queue, so that with Redis any replica runs them and they survive restarts. Each is
+// run as the caller that submitted it, and posted to the LiveConnect.CallbackURI of its request
+// once it is done.
+//
+// With gateway.worker, the gateway also runs the requests of the message queue of
+// Options.Requests, of priority batch unless they set their own, and publishes their replies to
+// Options.Replies (see package worker).
+//
+// With gateway.ping_interval, every provider is pinged in the background, and the models of
+// those that refuse their credentials or cannot be reached are held off routing until a ping
+// succeeds.
+//
+// Each LLM call can be recorded, with its caller, usage, cost, latency and outcome, to the
+// audit trail of Options.Audit.
+//
+// Requests are validated before any connector is called, and each is bounded by the timeout
+// of its route (see config.GatewayConfig.TimeoutFor). Clients are created per model by a
+// connectors.Pool unless Options.Clients says otherwise.
+package gateway
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/nexen/config"
+	"github.com/nexen/libs/store"
+	"github.com/nexen/services/connectors"
+	"github.com/nexen/services/connectors/common"
+	"github.com/nexen/services/connectors/deferred"
+	"github.com/nexen/services/gateway/audit"
+	"github.com/nexen/services/gateway/worker"
+	"google.golang.org/grpc"
+)
+
+const (
+	// DefaultMaxBodyBytes caps request bodies when Options.MaxBodyBytes is zero.
+	DefaultMaxBodyBytes = 10 << 20
+
+	// DefaultMaxBatchSize caps the requests of a batch when Options.MaxBatchSize is zero.
+	DefaultMaxBatchSize = 100
+
+	// writeGrace is how long past its route timeout a response may still be written, so that
+	// a timed-out request still gets its error.
+	writeGrace = 5 * time.Second
+)
+
+// Clients returns the client of a model. *connectors.Pool satisfies it.
+type Clients interface {
+	Get(model string) (connectors.LLM, error)
+}
+
+// Options configures a Server beyond the gateway configuration.
+type Options struct {
+	// Clients provides the client of each request's model. Nil uses a connectors.Pool.
+	Clients Clients
+
+	// MaxBodyBytes caps the size of request bodies. Zero means DefaultMaxBodyBytes.
+	MaxBodyBytes int64
+
+	// MaxBatchSize caps the number of requests of a batch. Zero means DefaultMaxBatchSize.
+	MaxBatchSize int
+
+	// BatchConcurrency is the number of requests of a batch called at once. Zero uses the
+	// connectors' default.
+	BatchConcurrency int
+
+	// Keys holds the API keys callers authenticate with when gateway.auth is enabled, and
+	// those created through the admin API. Nil accepts the keys of the configuration only; a
+	// StoredKeys on Redis also keeps the keys created at runtime.
+	Keys KeyStore
+
+	// Store holds the rate-limit counters. Nil uses an in-memory store, with which each
+	// replica counts its own requests; a Redis store applies the limit across replicas.
+	Store store.Store
+
+	// Queue schedules the jobs of /v1/jobs. Nil uses Store when it is also a store.Queue, as
+	// the backends of store.Open are, and an in-memory queue otherwise.
+	Queue store.Queue
+
+	// Requests and Replies are the message queues the worker of gateway.worker consumes
+	// requests from and publishes their replies to. The worker runs when both are set.
+	Requests worker.Source
+	Replies  worker.Sink
+
+	// Audit receives the record of every LLM call, with its content redacted as
+	// gateway.audit.content says. Nil records nothing.
+	Audit audit.Sink
+
+	// Health provides the circuit-breaker states reported by /status/providers, and receives
+	// the results of pinging providers. Nil uses connectors.DefaultHealthTracker, which the
+	// clients of NewLLM report to and routing consults.
+	Health *connectors.HealthTracker
+}
+
+// Server is the gateway's REST and gRPC server.
+type Server struct {
+	config *config.Config
+	opts   Options
+	mux    *http.ServeMux
+	grpc   *grpc.Server // nil when gRPC is disabled
+
+	limit common.Middleware // enforces the quotas of API keys
+	audit common.Middleware // nil without Options.Audit
+	oidc  *oidcVerifier     // nil without an OIDC issuer
+
+	queues      *queues             // nil without gateway.queue
+	jobs        *deferred.Scheduler // nil without gateway.jobs
+	worker      *worker.Worker      // nil without gateway.worker
+	rateLimiter *rateLimiter        // nil without a rate limit
+}
+
+// New returns a Server configured by cfg.
+func New(cfg *config.Config, opts Options) *Server {
+	if opts.Clients == nil {
+		opts.Clients = connectors.NewPool()
+	}
+	if opts.MaxBodyBytes <= 0 {
+		opts.MaxBodyBytes = DefaultMaxBodyBytes
+	}
+	if opts.MaxBatchSize <= 0 {
+		opts.MaxBatchSize = DefaultMaxBatchSize
+	}
+	if opts.Keys == nil {
+		opts.Keys = NewStaticKeys(cfg.Gateway.Auth.Keys)
+	}
+	if opts.Store == nil {
+		opts.Store = store.NewMemory()
+	}
+	if opts.Queue == nil {
+		if q, ok := opts.Store.(store.Queue); ok {
+			opts.Queue = q
+		} else {
+			opts.Queue = store.NewMemory()
+		}
+	}
+	if opts.Health == nil {
+		opts.Health = connectors.DefaultHealthTracker
+	}
+	s := &Server{
+		config:      cfg,
+		opts:        opts,
+		mux:         http.NewServeMux(),
+		limit:       newQuotas(cfg.Gateway).Middleware(),
+		audit:       newAuditor(opts.Audit, cfg.Gateway.Audit),
+		queues:      newQueues(cfg.Gateway.Queue),
+		rateLimiter: newRateLimiter(opts.Store, cfg.Gateway.RateLimitRequests, cfg.Gateway.RateLimitPeriod),
+	}
+	if cfg.Gateway.Auth.OIDC.Issuer != "" {
+		s.oidc = newOIDCVerifier(cfg.Gateway.Auth.OIDC)
+	}
+	s.jobs = s.newJobs(cfg.Gateway.Jobs)
+	s.worker = s.newWorker(cfg.Gateway.Worker)
+	if cfg.Gateway.EnableREST {
+		s.route("/v1/llm/call", s.guard(s.handleCall, writeError))
+		s.route("/v1/llm/stream", s.guard(s.handleStream, writeError))
+		s.route("/v1/llm/batch", s.guard(s.handleBatch, writeError))
+		s.route("/v1/chat/completions", s.guard(s.handleChatCompletions, writeChatError))
+		// Sessions outlive any request timeout; each of their turns has its own
+		s.mux.HandleFunc(sessionPath, s.guard(s.handleSession, writeError))
+		s.route(keysPath, s.requireAdmin(s.handleKeys))
+		s.route(keysPath+"/", s.requireAdmin(s.handleKeys))
+		s.route(connectorsAdminPath+"/", http.StripPrefix(connectorsAdminPath, connectors.AdminHandler(cfg.Gateway.Auth.AdminToken)).ServeHTTP)
+		s.route(healthzPath, s.handleHealthz)
+		s.route(readyzPath, s.handleReadyz)
+		s.route(providerStatusPath, s.guard(s.handleProviderStatus, writeError))
+		s.route(queueStatusPath, s.guard(s.handleQueueStatus, writeError))
+		if s.jobs != nil {
+			s.route(jobsPath, s.guard(s.handleJobs, writeError))
+			s.route(jobsPath+"/", s.guard(s.handleJobs, writeError))
+		}
+	}
+	if cfg.Gateway.EnableGRPC {
+		s.grpc = newGRPCServer(s)
+	}
+	return s
+}
+
+// Handler returns the handler serving the gateway's routes.
+func (s *Server) Handler() http.Handler {
+	return s.mux
+}
+
+// guard authenticates the requests of handler and applies the rate limit to them, writing
+// the errors of those it rejects with writeErr.
+func (s *Server) guard(handler http.HandlerFunc, writeErr func(http.ResponseWriter, int, errorBody)) http.HandlerFunc {
+	return s.requireAuth(s.limitRate(handler, writeErr), writeErr)
+}
+
+// route registers the handler of path, bounding its requests by the route's timeout.
+func (s *Server) route(path string, handler http.HandlerFunc) {
+	timeout := s.config.Gateway.TimeoutFor(path)
+	s.mux.HandleFunc(path, func(w http.ResponseWriter, r *http.Request) {
+		if timeout > 0 {
+			ctx, cancel := context.WithTimeout(r.Context(), timeout)
+			defer cancel()
+			r = r.WithContext(ctx)
+			// Routes may take longer than the server's write timeout
+			http.NewResponseController(w).SetWriteDeadline(time.Now().Add(timeout + writeGrace))
+		}
+		handler(w, r)
+	})
+}
+
+// ListenAndServe serves the REST API on the configured host and port, and the gRPC service on
+// the gRPC port, as enabled, until ctx is done, then shuts down gracefully.
+func (s *Server) ListenAndServe(ctx context.Context) error {
+	var rest, rpc net.Listener
+	var err error
+	if s.config.Gateway.EnableREST {
+		if rest, err = listen(s.config.Server.Host, s.config.Server.Port); err != nil {
+			return err
+		}
+	}
+	if s.grpc != nil {
+		if rpc, err = listen(s.config.Server.Host, s.config.Gateway.GRPCPort); err != nil {
+			if rest != nil {
+				rest.Close()
+			}
+			return err
+		}
+	}
+	if rest == nil && rpc == nil && s.worker == nil {
+		return errors.New("gateway: neither REST, gRPC nor the worker is enabled")
+	}
+	return s.Serve(ctx, rest, rpc)
+}
+
+func listen(host string, port int) (net.Listener, error) {
+	addr := net.JoinHostPort(host, strconv.Itoa(port))
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("gateway: listening on %s: %w", addr, err)
+	}
+	return l, nil
+}
+
+// Serve serves the REST API on rest and the gRPC service on rpc until ctx is done; either
+// listener may be nil. It also runs the due jobs of /v1/jobs, the worker and the pings of
+// providers, when enabled. It then stops accepting connections and waits up to the configured
+// shutdown timeout for the requests in flight before closing the remaining connections; the
+// jobs being run are put back for another replica, and the messages of the worker are left to
+// be delivered again. It returns nil after a graceful shutdown.
+func (s *Server) Serve(ctx context.Context, rest, rpc net.Listener) error {
+	if rpc != nil && s.grpc == nil {
+		return errors.New("gateway: gRPC is disabled")
+	}
+	errs := make(chan error, 2)
+	servers := 0
+	backgroundCtx, stopBackground := context.WithCancel(ctx)
+	var background sync.WaitGroup
+	if s.jobs != nil {
+		background.Add(1)
+		go func() {
+			defer background.Done()
+			s.runJobs(backgroundCtx)
+		}()
+	}
+	if s.worker != nil {
+		background.Add(1)
+		go func() {
+			defer background.Done()
+			s.worker.Run(backgroundCtx)
+		}()
+	}
+	if interval := s.config.Gateway.PingInterval; interval > 0 {
+		background.Add(1)
+		go func() {
+			defer background.Done()
+			connectors.MonitorProviders(backgroundCtx, s.opts.Health, interval)
+		}()
+	}
+	var srv *http.Server
+	if rest != nil {
+		srv = &http.Server{
+			Handler:      s.mux,
+			ReadTimeout:  s.config.Server.ReadTimeout,
+			WriteTimeout: s.config.Server.WriteTimeout,
+		}
+		servers++
+		go func() { errs <- srv.Serve(rest) }()
+	}
+	if rpc != nil {
+		servers++
+		go func() { errs <- s.grpc.Serve(rpc) }()
+	}
+
+	var served error
+	select {
+	case served = <-errs:
+		servers--
+	case <-ctx.Done():
+	}
+	stopBackground()
+	background.Wait()
+	shutdownCtx := context.Background()
+	if timeout := s.config.Gateway.ShutdownTimeout; timeout > 0 {
+		var cancel context.CancelFunc
+		shutdownCtx, cancel = context.WithTimeout(shutdownCtx, timeout)
+		defer cancel()
+	}
+	var stopped error
+	if srv != nil {
+		if err := srv.Shutdown(shutdownCtx); err != nil {
+			srv.Close()
+			stopped = fmt.Errorf("gateway: shutting down: %w", err)
+		}
+	}
+	if rpc != nil {
+		done := make(chan struct{})
+		go func() {
+			s.grpc.GracefulStop()
+			close(done)
+		}()
+		select {
+		case <-done:
+		case <-shutdownCtx.Done():
+			s.grpc.Stop()
+			stopped = fmt.Errorf("gateway: shutting down: %w", shutdownCtx.Err())
+		}
+	}
+	for ; servers > 0; servers-- {
+		<-errs
+	}
+	if served != nil && !errors.Is(served, http.ErrServerClosed) {
+		return served
+	}
+	return stopped
+}
@@ -0,0 +1,43 @@
+package gateway
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nexen/config"
+)
+
+func TestServeShutsDownGracefully(t *testing.T) {
+	s := testServer(config.GatewayConfig{ShutdownTimeout: 5 * time.Second})
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	served := make(chan error, 1)
+	go func() { served <- s.Serve(ctx, l, nil) }()
+
+	// Stop the server while a slow request is in flight
+	responses := make(chan *http.Response, 1)
+	go func() {
+		resp, err := http.Post("http://"+l.Addr().String()+"/v1/llm/call", "application/json",
+			strings.NewReader(`{"model": "slow", "contents": [{"role": "user", "message": "Hi"}]}`))
+		if err != nil {
+			t.Error(err)
+		}
+		responses <- resp
+	}()
+	time.Sleep(100 * time.Millisecond)
+	cancel()
+
+	if resp := <-responses; resp == nil || resp.StatusCode != http.StatusOK {
+		t.Errorf("Expected the request in flight to complete, got %v", resp)
+	}
+	if err := <-served; err != nil {
+		t.Errorf("Expected a graceful shutdown, got %v", err)
+	}
+}
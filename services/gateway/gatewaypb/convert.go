@@ -0,0 +1,272 @@
+package gatewaypb
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/nexen/models"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+// FromLLMRequest converts r to its protocol buffer form. Parts and the response schema must
+// be representable as JSON.
+func FromLLMRequest(r *models.LLMRequest) (*LLMRequest, error) {
+	contents, err := fromContents(r.Contents)
+	if err != nil {
+		return nil, err
+	}
+	pb := &LLMRequest{
+		Model:    r.Model,
+		Contents: contents,
+		LiveConnect: &LiveConnectConfig{
+			EnableStreaming: r.LiveConnect.EnableStreaming,
+			StreamTimeout:   int32(r.LiveConnect.StreamTimeout),
+			CallbackUri:     r.LiveConnect.CallbackURI,
+		},
+		Metadata: &RequestMetadata{
+			TenantId:  r.Metadata.TenantID,
+			UserId:    r.Metadata.UserID,
+			RequestId: r.Metadata.RequestID,
+			Priority:  r.Metadata.Priority,
+			Tags:      r.Metadata.Tags,
+		},
+	}
+	if r.LiveConnect.CustomConfig != nil {
+		if pb.LiveConnect.CustomConfig, err = toStruct(r.LiveConnect.CustomConfig); err != nil {
+			return nil, fmt.Errorf("liveConnect.customConfig: %w", err)
+		}
+	}
+	if c := r.Config; c != nil {
+		pb.Config = &GenerateContentConfig{
+			SystemInstruction:      c.SystemInstruction,
+			ToolChoice:             c.ToolChoice,
+			ResponseMimeType:       c.ResponseMimeType,
+			Temperature:            c.Temperature,
+			TopP:                   c.TopP,
+			MaxTokens:              int32(c.MaxTokens),
+			StopSequences:          c.StopSequences,
+			ResponseLogprobs:       c.ResponseLogprobs,
+			TopLogprobs:            int32(c.TopLogprobs),
+			Timeout:                int32(c.Timeout),
+			JsonMode:               c.JSONMode,
+			CacheSystemInstruction: c.CacheSystemInstruction,
+			ServiceTier:            c.ServiceTier,
+		}
+		for _, tool := range c.Tools {
+			pb.Config.Tools = append(pb.Config.Tools, &ToolDeclaration{FunctionDeclarations: tool.FunctionDeclarations})
+		}
+		if c.ResponseSchema != nil {
+			if pb.Config.ResponseSchema, err = toValue(c.ResponseSchema); err != nil {
+				return nil, fmt.Errorf("config.responseSchema: %w", err)
+			}
+		}
+	}
+	return pb, nil
+}
+
+// ToLLMRequest converts x back to a models.LLMRequest.
+func (x *LLMRequest) ToLLMRequest() *models.LLMRequest {
+	r := &models.LLMRequest{
+		Model:    x.GetModel(),
+		Contents: toContents(x.GetContents()),
+		LiveConnect: models.LiveConnectConfig{
+			EnableStreaming: x.GetLiveConnect().GetEnableStreaming(),
+			StreamTimeout:   int(x.GetLiveConnect().GetStreamTimeout()),
+			CallbackURI:     x.GetLiveConnect().GetCallbackUri(),
+		},
+		Metadata: models.RequestMetadata{
+			TenantID:  x.GetMetadata().GetTenantId(),
+			UserID:    x.GetMetadata().GetUserId(),
+			RequestID: x.GetMetadata().GetRequestId(),
+			Priority:  x.GetMetadata().GetPriority(),
+			Tags:      x.GetMetadata().GetTags(),
+		},
+	}
+	if custom := x.GetLiveConnect().GetCustomConfig(); custom != nil {
+		r.LiveConnect.CustomConfig = custom.AsMap()
+	}
+	if c := x.GetConfig(); c != nil {
+		r.Config = &models.GenerateContentConfig{
+			SystemInstruction:      c.GetSystemInstruction(),
+			ToolChoice:             c.GetToolChoice(),
+			ResponseMimeType:       c.GetResponseMimeType(),
+			Temperature:            c.GetTemperature(),
+			TopP:                   c.GetTopP(),
+			MaxTokens:              int(c.GetMaxTokens()),
+			StopSequences:          c.GetStopSequences(),
+			ResponseLogprobs:       c.GetResponseLogprobs(),
+			TopLogprobs:            int(c.GetTopLogprobs()),
+			Timeout:                int(c.GetTimeout()),
+			JSONMode:               c.GetJsonMode(),
+			CacheSystemInstruction: c.GetCacheSystemInstruction(),
+			ServiceTier:            c.GetServiceTier(),
+		}
+		for _, tool := range c.GetTools() {
+			r.Config.Tools = append(r.Config.Tools, models.ToolDeclaration{FunctionDeclarations: tool.GetFunctionDeclarations()})
+		}
+		if schema := c.GetResponseSchema(); schema != nil {
+			r.Config.ResponseSchema = schema.AsInterface()
+		}
+	}
+	return r
+}
+
+// FromLLMResponse converts r to its protocol buffer form. Parts and custom metadata must be
+// representable as JSON.
+func FromLLMResponse(r *models.LLMResponse) (*LLMResponse, error) {
+	pb := &LLMResponse{
+		Partial:      r.Partial,
+		TurnComplete: r.TurnComplete,
+		ErrorCode:    r.ErrorCode,
+		ErrorMessage: r.ErrorMessage,
+		Interrupted:  r.Interrupted,
+		Usage: &UsageMetrics{
+			PromptTokens:           int32(r.Usage.PromptTokens),
+			CompletionTokens:       int32(r.Usage.CompletionTokens),
+			CachedPromptTokens:     int32(r.Usage.CachedPromptTokens),
+			CacheWritePromptTokens: int32(r.Usage.CacheWritePromptTokens),
+			TotalTokens:            int32(r.Usage.TotalTokens),
+			LatencyMs:              r.Usage.LatencyMs,
+			CostCents:              r.Usage.CostCents,
+		},
+	}
+	var err error
+	if r.Content != nil {
+		if pb.Content, err = fromContent(*r.Content); err != nil {
+			return nil, err
+		}
+	}
+	if g := r.GroundingMetadata; g != nil {
+		pb.GroundingMetadata = &GroundingMetadata{GroundingScore: g.GroundingScore}
+		for _, c := range g.Citations {
+			pb.GroundingMetadata.Citations = append(pb.GroundingMetadata.Citations, &Citation{
+				SourceId: c.SourceID, Title: c.Title, Url: c.URL, StartIndex: int32(c.StartIndex), EndIndex: int32(c.EndIndex),
+			})
+		}
+	}
+	if l := r.Logprobs; l != nil {
+		pb.Logprobs = &Logprobs{}
+		for _, t := range l.Tokens {
+			token := &TokenLogprob{Token: t.Token, Logprob: t.Logprob}
+			for _, alt := range t.TopAlternatives {
+				token.TopAlternatives = append(token.TopAlternatives, &TopLogprob{Token: alt.Token, Logprob: alt.Logprob})
+			}
+			pb.Logprobs.Tokens = append(pb.Logprobs.Tokens, token)
+		}
+	}
+	if r.CustomMetadata != nil {
+		if pb.CustomMetadata, err = toStruct(r.CustomMetadata); err != nil {
+			return nil, fmt.Errorf("customMetadata: %w", err)
+		}
+	}
+	return pb, nil
+}
+
+// ToLLMResponse converts x back to a models.LLMResponse.
+func (x *LLMResponse) ToLLMResponse() *models.LLMResponse {
+	u := x.GetUsage()
+	r := &models.LLMResponse{
+		Partial:      x.Partial,
+		TurnComplete: x.TurnComplete,
+		ErrorCode:    x.ErrorCode,
+		ErrorMessage: x.ErrorMessage,
+		Interrupted:  x.Interrupted,
+		Usage: models.UsageMetrics{
+			PromptTokens:           int(u.GetPromptTokens()),
+			CompletionTokens:       int(u.GetCompletionTokens()),
+			CachedPromptTokens:     int(u.GetCachedPromptTokens()),
+			CacheWritePromptTokens: int(u.GetCacheWritePromptTokens()),
+			TotalTokens:            int(u.GetTotalTokens()),
+			LatencyMs:              u.GetLatencyMs(),
+			CostCents:              u.GetCostCents(),
+		},
+	}
+	if c := x.GetContent(); c != nil {
+		content := toContent(c)
+		r.Content = &content
+	}
+	if g := x.GetGroundingMetadata(); g != nil {
+		r.GroundingMetadata = &models.GroundingMetadata{GroundingScore: g.GetGroundingScore()}
+		for _, c := range g.GetCitations() {
+			r.GroundingMetadata.Citations = append(r.GroundingMetadata.Citations, models.Citation{
+				SourceID: c.GetSourceId(), Title: c.GetTitle(), URL: c.GetUrl(), StartIndex: int(c.GetStartIndex()), EndIndex: int(c.GetEndIndex()),
+			})
+		}
+	}
+	if l := x.GetLogprobs(); l != nil {
+		r.Logprobs = &models.Logprobs{}
+		for _, t := range l.GetTokens() {
+			token := models.TokenLogprob{Token: t.GetToken(), Logprob: t.GetLogprob()}
+			for _, alt := range t.GetTopAlternatives() {
+				token.TopAlternatives = append(token.TopAlternatives, models.TopLogprob{Token: alt.GetToken(), Logprob: alt.GetLogprob()})
+			}
+			r.Logprobs.Tokens = append(r.Logprobs.Tokens, token)
+		}
+	}
+	if custom := x.GetCustomMetadata(); custom != nil {
+		r.CustomMetadata = custom.AsMap()
+	}
+	return r
+}
+
+func fromContents(contents []models.Content) ([]*Content, error) {
+	pb := make([]*Content, len(contents))
+	for i, c := range contents {
+		var err error
+		if pb[i], err = fromContent(c); err != nil {
+			return nil, fmt.Errorf("contents[%d]: %w", i, err)
+		}
+	}
+	return pb, nil
+}
+
+func fromContent(c models.Content) (*Content, error) {
+	pb := &Content{Role: c.Role, Message: c.Message, CacheBreakpoint: c.CacheBreakpoint}
+	for i, part := range c.Parts {
+		value, err := toValue(part)
+		if err != nil {
+			return nil, fmt.Errorf("parts[%d]: %w", i, err)
+		}
+		pb.Parts = append(pb.Parts, value)
+	}
+	return pb, nil
+}
+
+func toContents(pb []*Content) []models.Content {
+	contents := make([]models.Content, len(pb))
+	for i, c := range pb {
+		contents[i] = toContent(c)
+	}
+	return contents
+}
+
+func toContent(pb *Content) models.Content {
+	c := models.Content{Role: pb.GetRole(), Message: pb.GetMessage(), CacheBreakpoint: pb.GetCacheBreakpoint()}
+	for _, part := range pb.GetParts() {
+		c.Parts = append(c.Parts, part.AsInterface())
+	}
+	return c
+}
+
+// toValue converts v to a structpb.Value through its JSON encoding, so that values of any
+// type that encodes to JSON, such as structs, are accepted.
+func toValue(v any) (*structpb.Value, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var generic any
+	if err := json.Unmarshal(data, &generic); err != nil {
+		return nil, err
+	}
+	return structpb.NewValue(generic)
+}
+
+// toStruct converts m to a structpb.Struct, as toValue does.
+func toStruct(m map[string]any) (*structpb.Struct, error) {
+	value, err := toValue(m)
+	if err != nil {
+		return nil, err
+	}
+	return value.GetStructValue(), nil
+}
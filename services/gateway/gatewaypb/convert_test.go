@@ -0,0 +1,58 @@
+package gatewaypb
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/nexen/models"
+)
+
+func TestLLMRequestRoundTrip(t *testing.T) {
+	request := &models.LLMRequest{
+		Model: "gpt-4o",
+		Contents: []models.Content{
+			{Role: "user", Message: "Hi", Parts: []any{map[string]any{"type": "text", "text": "Hi"}}},
+		},
+		Config: &models.GenerateContentConfig{
+			SystemInstruction: "Be brief",
+			Temperature:       0.5,
+			MaxTokens:         100,
+			StopSequences:     []string{"END"},
+			ResponseSchema:    map[string]any{"type": "object"},
+		},
+		LiveConnect: models.LiveConnectConfig{CustomConfig: map[string]any{"voice": "alloy"}},
+		Metadata:    models.RequestMetadata{TenantID: "acme", Priority: models.PriorityBatch, Tags: map[string]string{"team": "search"}},
+	}
+	pb, err := FromLLMRequest(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := pb.ToLLMRequest(); !reflect.DeepEqual(got, request) {
+		t.Errorf("Round trip changed the request:\ngot  %+v\nwant %+v", got, request)
+	}
+}
+
+func TestLLMResponseRoundTrip(t *testing.T) {
+	response := &models.LLMResponse{
+		Content: &models.Content{Role: "assistant", Message: "Hello"},
+		Usage:   models.UsageMetrics{PromptTokens: 3, CompletionTokens: 1, TotalTokens: 4, CostCents: 0.1},
+		Logprobs: &models.Logprobs{Tokens: []models.TokenLogprob{
+			{Token: "Hello", Logprob: -0.1, TopAlternatives: []models.TopLogprob{{Token: "Hi", Logprob: -2}}},
+		}},
+		CustomMetadata: map[string]any{"provider": "openai"},
+	}
+	pb, err := FromLLMResponse(response)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := pb.ToLLMResponse(); !reflect.DeepEqual(got, response) {
+		t.Errorf("Round trip changed the response:\ngot  %+v\nwant %+v", got, response)
+	}
+}
+
+func TestFromLLMRequestRejectsUnencodableParts(t *testing.T) {
+	request := &models.LLMRequest{Model: "gpt-4o", Contents: []models.Content{{Role: "user", Parts: []any{make(chan int)}}}}
+	if _, err := FromLLMRequest(request); err == nil {
+		t.Error("Expected an error for a part that is not JSON")
+	}
+}
@@ -0,0 +1,5 @@
+// Package gatewaypb holds the protocol buffer types and gRPC service of the gateway, generated
+// from llm.proto, and their conversions to and from the types of the models package.
+package gatewaypb
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative llm.proto
@@ -0,0 +1,216 @@
+// Protocol buffer mirror of the LLM request and response types of the models package, and
+// the gateway's gRPC service. Field names follow the JSON names of the Go types.
+
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.5.1
+// - protoc             v4.25.0
+// source: llm.proto
+
+package gatewaypb
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.64.0 or later.
+const _ = grpc.SupportPackageIsVersion9
+
+const (
+	LLMService_Call_FullMethodName       = "/nexen.gateway.v1.LLMService/Call"
+	LLMService_CallStream_FullMethodName = "/nexen.gateway.v1.LLMService/CallStream"
+	LLMService_BatchCall_FullMethodName  = "/nexen.gateway.v1.LLMService/BatchCall"
+)
+
+// LLMServiceClient is the client API for LLMService service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+//
+// LLMService sends requests to the gateway's models.
+type LLMServiceClient interface {
+	// Call sends one request and returns its response.
+	Call(ctx context.Context, in *LLMRequest, opts ...grpc.CallOption) (*LLMResponse, error)
+	// CallStream sends one request and streams its response: partial responses as the model
+	// generates them, then the final, complete response.
+	CallStream(ctx context.Context, in *LLMRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[LLMResponse], error)
+	// BatchCall sends several requests and returns one result per request, in order.
+	BatchCall(ctx context.Context, in *BatchCallRequest, opts ...grpc.CallOption) (*BatchCallResponse, error)
+}
+
+type lLMServiceClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewLLMServiceClient(cc grpc.ClientConnInterface) LLMServiceClient {
+	return &lLMServiceClient{cc}
+}
+
+func (c *lLMServiceClient) Call(ctx context.Context, in *LLMRequest, opts ...grpc.CallOption) (*LLMResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(LLMResponse)
+	err := c.cc.Invoke(ctx, LLMService_Call_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *lLMServiceClient) CallStream(ctx context.Context, in *LLMRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[LLMResponse], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &LLMService_ServiceDesc.Streams[0], LLMService_CallStream_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[LLMRequest, LLMResponse]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type LLMService_CallStreamClient = grpc.ServerStreamingClient[LLMResponse]
+
+func (c *lLMServiceClient) BatchCall(ctx context.Context, in *BatchCallRequest, opts ...grpc.CallOption) (*BatchCallResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(BatchCallResponse)
+	err := c.cc.Invoke(ctx, LLMService_BatchCall_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// LLMServiceServer is the server API for LLMService service.
+// All implementations must embed UnimplementedLLMServiceServer
+// for forward compatibility.
+//
+// LLMService sends requests to the gateway's models.
+type LLMServiceServer interface {
+	// Call sends one request and returns its response.
+	Call(context.Context, *LLMRequest) (*LLMResponse, error)
+	// CallStream sends one request and streams its response: partial responses as the model
+	// generates them, then the final, complete response.
+	CallStream(*LLMRequest, grpc.ServerStreamingServer[LLMResponse]) error
+	// BatchCall sends several requests and returns one result per request, in order.
+	BatchCall(context.Context, *BatchCallRequest) (*BatchCallResponse, error)
+	mustEmbedUnimplementedLLMServiceServer()
+}
+
+// UnimplementedLLMServiceServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedLLMServiceServer struct{}
+
+func (UnimplementedLLMServiceServer) Call(context.Context, *LLMRequest) (*LLMResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Call not implemented")
+}
+func (UnimplementedLLMServiceServer) CallStream(*LLMRequest, grpc.ServerStreamingServer[LLMResponse]) error {
+	return status.Errorf(codes.Unimplemented, "method CallStream not implemented")
+}
+func (UnimplementedLLMServiceServer) BatchCall(context.Context, *BatchCallRequest) (*BatchCallResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method BatchCall not implemented")
+}
+func (UnimplementedLLMServiceServer) mustEmbedUnimplementedLLMServiceServer() {}
+func (UnimplementedLLMServiceServer) testEmbeddedByValue()                    {}
+
+// UnsafeLLMServiceServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to LLMServiceServer will
+// result in compilation errors.
+type UnsafeLLMServiceServer interface {
+	mustEmbedUnimplementedLLMServiceServer()
+}
+
+func RegisterLLMServiceServer(s grpc.ServiceRegistrar, srv LLMServiceServer) {
+	// If the following call pancis, it indicates UnimplementedLLMServiceServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&LLMService_ServiceDesc, srv)
+}
+
+func _LLMService_Call_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(LLMRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(LLMServiceServer).Call(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: LLMService_Call_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(LLMServiceServer).Call(ctx, req.(*LLMRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _LLMService_CallStream_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(LLMRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(LLMServiceServer).CallStream(m, &grpc.GenericServerStream[LLMRequest, LLMResponse]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type LLMService_CallStreamServer = grpc.ServerStreamingServer[LLMResponse]
+
+func _LLMService_BatchCall_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(BatchCallRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(LLMServiceServer).BatchCall(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: LLMService_BatchCall_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(LLMServiceServer).BatchCall(ctx, req.(*BatchCallRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// LLMService_ServiceDesc is the grpc.ServiceDesc for LLMService service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var LLMService_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "nexen.gateway.v1.LLMService",
+	HandlerType: (*LLMServiceServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Call",
+			Handler:    _LLMService_Call_Handler,
+		},
+		{
+			MethodName: "BatchCall",
+			Handler:    _LLMService_BatchCall_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "CallStream",
+			Handler:       _LLMService_CallStream_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "llm.proto",
+}
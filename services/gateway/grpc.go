@@ -0,0 +1,184 @@
+package gateway
+
+import (
+	"context"
+
+	"github.com/nexen/models"
+	"github.com/nexen/services/connectors/common"
+	"github.com/nexen/services/gateway/gatewaypb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// grpcRoutes maps the gRPC methods to the REST route whose timeout they share.
+var grpcRoutes = map[string]string{
+	gatewaypb.LLMService_Call_FullMethodName:       "/v1/llm/call",
+	gatewaypb.LLMService_CallStream_FullMethodName: "/v1/llm/call",
+	gatewaypb.LLMService_BatchCall_FullMethodName:  "/v1/llm/batch",
+}
+
+// grpcCodes maps the codes of errorBody to gRPC status codes.
+var grpcCodes = map[string]codes.Code{
+	codeInvalidRequest:        codes.InvalidArgument,
+	codeModelNotFound:         codes.NotFound,
+	codeModelNotAllowed:       codes.PermissionDenied,
+	codeUnauthorized:          codes.Unauthenticated,
+	codeKeyNotFound:           codes.NotFound,
+	codeJobNotFound:           codes.NotFound,
+	codeRateLimited:           codes.ResourceExhausted,
+	codeQuotaExceeded:         codes.ResourceExhausted,
+	codeContextLengthExceeded: codes.InvalidArgument,
+	codeCapabilityUnsupported: codes.InvalidArgument,
+	codeContentFiltered:       codes.FailedPrecondition,
+	codeProviderAuth:          codes.Unavailable,
+	codeProviderUnavailable:   codes.Unavailable,
+	codeOverloaded:            codes.Unavailable,
+	codeTimeout:               codes.DeadlineExceeded,
+	codeCanceled:              codes.Canceled,
+	codeUpstream:              codes.Unavailable,
+}
+
+// newGRPCServer returns the gRPC server of s, bounding each call by the timeout of its route,
+// authenticating it by its "authorization" metadata when auth is enabled and applying the rate
+// limit.
+func newGRPCServer(s *Server) *grpc.Server {
+	srv := grpc.NewServer(
+		grpc.MaxRecvMsgSize(int(s.opts.MaxBodyBytes)),
+		grpc.UnaryInterceptor(func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+			ctx, cancel := s.grpcContext(ctx, info.FullMethod)
+			defer cancel()
+			ctx, err := s.authenticateRPC(ctx)
+			if err == nil {
+				err = s.limitRateRPC(ctx)
+			}
+			if err != nil {
+				return nil, err
+			}
+			return handler(ctx, req)
+		}),
+		grpc.StreamInterceptor(func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+			ctx, cancel := s.grpcContext(ss.Context(), info.FullMethod)
+			defer cancel()
+			ctx, err := s.authenticateRPC(ctx)
+			if err == nil {
+				err = s.limitRateRPC(ctx)
+			}
+			if err != nil {
+				return err
+			}
+			return handler(srv, &contextStream{ServerStream: ss, ctx: ctx})
+		}),
+	)
+	gatewaypb.RegisterLLMServiceServer(srv, &grpcService{s: s})
+	return srv
+}
+
+// grpcContext bounds ctx by the timeout of the route of method.
+func (s *Server) grpcContext(ctx context.Context, method string) (context.Context, context.CancelFunc) {
+	if timeout := s.config.Gateway.TimeoutFor(grpcRoutes[method]); timeout > 0 {
+		return context.WithTimeout(ctx, timeout)
+	}
+	return context.WithCancel(ctx)
+}
+
+// contextStream is a grpc.ServerStream with a different context.
+type contextStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (c *contextStream) Context() context.Context {
+	return c.ctx
+}
+
+// grpcService implements gatewaypb.LLMServiceServer with the clients of a Server.
+type grpcService struct {
+	gatewaypb.UnimplementedLLMServiceServer
+	s *Server
+}
+
+// Call implements gatewaypb.LLMServiceServer.
+func (g *grpcService) Call(ctx context.Context, in *gatewaypb.LLMRequest) (*gatewaypb.LLMResponse, error) {
+	request := in.ToLLMRequest()
+	if err := request.Validate(); err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	response, err := g.s.call(ctx, request)
+	if err != nil {
+		return nil, grpcError(ctx, err)
+	}
+	return toProtoResponse(response)
+}
+
+// CallStream implements gatewaypb.LLMServiceServer. Models whose client cannot stream send
+// their final response only.
+func (g *grpcService) CallStream(in *gatewaypb.LLMRequest, stream gatewaypb.LLMService_CallStreamServer) error {
+	ctx := stream.Context()
+	request := in.ToLLMRequest()
+	if err := request.Validate(); err != nil {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+	err := g.s.stream(ctx, request, func(response *models.LLMResponse) error {
+		pb, err := toProtoResponse(response)
+		if err != nil {
+			return err
+		}
+		return stream.Send(pb)
+	})
+	if _, ok := status.FromError(err); err != nil && !ok {
+		return grpcError(ctx, err)
+	}
+	return err
+}
+
+// BatchCall implements gatewaypb.LLMServiceServer. As with the REST API, a batch with an
+// invalid request is rejected as a whole, and the outcome of each request of an accepted batch
+// is reported in its result.
+func (g *grpcService) BatchCall(ctx context.Context, in *gatewaypb.BatchCallRequest) (*gatewaypb.BatchCallResponse, error) {
+	requests := make([]*models.LLMRequest, len(in.GetRequests()))
+	for i, request := range in.GetRequests() {
+		requests[i] = request.ToLLMRequest()
+	}
+	if err := g.s.validateBatch(requests); err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	results := common.ExecuteBatch(withPriority(ctx, models.PriorityBatch), requests, g.s.opts.BatchConcurrency, g.s.call)
+	out := &gatewaypb.BatchCallResponse{Results: make([]*gatewaypb.BatchResult, len(results))}
+	for i, result := range results {
+		out.Results[i] = &gatewaypb.BatchResult{}
+		if result.Err != nil {
+			_, body := errorResponse(ctx, result.Err)
+			out.Results[i].Error = &gatewaypb.Error{Code: body.Code, Message: body.Message}
+			continue
+		}
+		response, err := toProtoResponse(result.Response)
+		if err != nil {
+			return nil, err
+		}
+		out.Results[i].Response = response
+	}
+	return out, nil
+}
+
+// toProtoResponse converts response for sending, failing with an Internal status when it
+// cannot be represented.
+func toProtoResponse(response *models.LLMResponse) (*gatewaypb.LLMResponse, error) {
+	pb, err := gatewaypb.FromLLMResponse(response)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "encoding response: %v", err)
+	}
+	return pb, nil
+}
+
+// grpcError maps an error of a call made with ctx to a gRPC status error, with the same
+// classification as the REST API.
+func grpcError(ctx context.Context, err error) error {
+	_, body := errorResponse(ctx, err)
+	code, ok := grpcCodes[body.Code]
+	if !ok {
+		code = codes.Unknown
+	}
+	return status.Error(code, body.Message)
+}
@@ -0,0 +1,128 @@
+package gateway
+
+import (
+	"context"
+	"io"
+	"net"
+	"testing"
+
+	"github.com/nexen/config"
+	"github.com/nexen/services/gateway/gatewaypb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// grpcClient serves the gRPC service of a test server configured by gateway in memory and
+// returns a client of it.
+func grpcClient(t *testing.T, gateway config.GatewayConfig) gatewaypb.LLMServiceClient {
+	t.Helper()
+	gateway.EnableGRPC = true
+	s := testServer(gateway)
+	l := bufconn.Listen(1 << 20)
+	ctx, cancel := context.WithCancel(context.Background())
+	served := make(chan error, 1)
+	go func() { served <- s.Serve(ctx, nil, l) }()
+
+	conn, err := grpc.NewClient("passthrough:///bufconn",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return l.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		conn.Close()
+		cancel()
+		<-served
+	})
+	return gatewaypb.NewLLMServiceClient(conn)
+}
+
+func grpcRequest(model, message string) *gatewaypb.LLMRequest {
+	return &gatewaypb.LLMRequest{
+		Model:    model,
+		Contents: []*gatewaypb.Content{{Role: "user", Message: message}},
+	}
+}
+
+func TestGRPCCall(t *testing.T) {
+	client := grpcClient(t, config.GatewayConfig{})
+	response, err := client.Call(context.Background(), grpcRequest("echo", "Hello"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := response.GetContent().GetMessage(); got != "Hello" {
+		t.Errorf("Expected the echoed message, got %q", got)
+	}
+}
+
+func TestGRPCCallErrors(t *testing.T) {
+	client := grpcClient(t, config.GatewayConfig{})
+	tests := []struct {
+		name    string
+		request *gatewaypb.LLMRequest
+		code    codes.Code
+	}{
+		{"invalid", &gatewaypb.LLMRequest{Model: "echo"}, codes.InvalidArgument},
+		{"unknown model", grpcRequest("missing", "Hi"), codes.NotFound},
+		{"rate limited", grpcRequest("limited", "Hi"), codes.ResourceExhausted},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := client.Call(context.Background(), tt.request)
+			if got := status.Code(err); got != tt.code {
+				t.Errorf("Expected %v, got %v (%v)", tt.code, got, err)
+			}
+		})
+	}
+}
+
+func TestGRPCCallStream(t *testing.T) {
+	client := grpcClient(t, config.GatewayConfig{})
+	stream, err := client.CallStream(context.Background(), grpcRequest("echo", "Hello"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var responses []*gatewaypb.LLMResponse
+	for {
+		response, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		responses = append(responses, response)
+	}
+	// The stub cannot stream, so its final response is the only one
+	if len(responses) != 1 || responses[0].GetContent().GetMessage() != "Hello" {
+		t.Errorf("Expected the final response only, got %v", responses)
+	}
+}
+
+func TestGRPCBatchCall(t *testing.T) {
+	client := grpcClient(t, config.GatewayConfig{})
+	response, err := client.BatchCall(context.Background(), &gatewaypb.BatchCallRequest{
+		Requests: []*gatewaypb.LLMRequest{grpcRequest("echo", "one"), grpcRequest("missing", "two")},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	results := response.GetResults()
+	if len(results) != 2 {
+		t.Fatalf("Expected 2 results, got %d", len(results))
+	}
+	if got := results[0].GetResponse().GetContent().GetMessage(); got != "one" {
+		t.Errorf("Expected the first request to succeed, got %v", results[0])
+	}
+	if got := results[1].GetError().GetCode(); got != codeModelNotFound {
+		t.Errorf("Expected the second request to fail with %s, got %v", codeModelNotFound, results[1])
+	}
+
+	_, err = client.BatchCall(context.Background(), &gatewaypb.BatchCallRequest{})
+	if got := status.Code(err); got != codes.InvalidArgument {
+		t.Errorf("Expected an empty batch to be rejected, got %v", err)
+	}
+}
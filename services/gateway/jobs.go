@@ -0,0 +1,185 @@
+package gateway
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/nexen/config"
+	"github.com/nexen/libs/store"
+	"github.com/nexen/models"
+	"github.com/nexen/services/connectors/deferred"
+)
+
+// jobsPath is the route of the jobs API: POST submits a job, GET jobsPath/{id} polls it.
+const jobsPath = "/v1/jobs"
+
+// jobQueue is the queue of Options.Queue the gateway's jobs are scheduled on.
+const jobQueue = "gateway:jobs"
+
+// jobBatchSize is the number of due jobs taken from the queue at once.
+const jobBatchSize = 50
+
+// errJobNotFound is the error of polling a job that does not exist, has expired, or was
+// submitted by another caller.
+var errJobNotFound = errors.New("gateway: job not found")
+
+// jobCaller is the Caller of a job: the API key or the token claims it was submitted with, as
+// whom its attempts are made.
+type jobCaller struct {
+	Key *APIKey `json:"key,omitempty"`
+
+	// Configured is set for keys of the configuration, whose policy is looked up by name.
+	Configured bool         `json:"configured,omitempty"`
+	Claims     *tokenClaims `json:"claims,omitempty"`
+}
+
+// callerOf returns the caller of a request made with ctx.
+func callerOf(ctx context.Context) jobCaller {
+	var c jobCaller
+	if key, ok := keyFrom(ctx); ok {
+		c.Key, c.Configured = key, key.configured
+	}
+	if claims, ok := claimsFrom(ctx); ok {
+		c.Claims = claims
+	}
+	return c
+}
+
+// context returns ctx carrying the key or token claims of c, as authenticate does.
+func (c jobCaller) context(ctx context.Context) context.Context {
+	if c.Key != nil {
+		key := *c.Key
+		key.configured = c.Configured
+		ctx = context.WithValue(ctx, apiKeyContextKey{}, &key)
+	}
+	if c.Claims != nil {
+		ctx = context.WithValue(ctx, tokenContextKey{}, c.Claims)
+	}
+	return ctx
+}
+
+// newJobs returns the scheduler of the gateway's jobs, or nil when they are disabled.
+func (s *Server) newJobs(cfg config.JobsConfig) *deferred.Scheduler {
+	if !cfg.Enabled {
+		return nil
+	}
+	jobs := deferred.New(s.opts.Queue, s.opts.Store, nil)
+	jobs.Queue = jobQueue
+	jobs.StatusTTL = cfg.TTL
+	jobs.Lease = cfg.Timeout
+	jobs.Concurrency = cfg.Concurrency
+	jobs.MaxAttempts = cfg.MaxAttempts
+	jobs.Call = s.runJob
+	jobs.Notify = deferred.Webhook(&http.Client{Timeout: cfg.WebhookTimeout}, cfg.WebhookSecret)
+	return jobs
+}
+
+// handleJobs submits a job with POST /v1/jobs and reports one with GET /v1/jobs/{id}.
+func (s *Server) handleJobs(w http.ResponseWriter, r *http.Request) {
+	id := strings.TrimPrefix(strings.TrimPrefix(r.URL.Path, jobsPath), "/")
+	switch {
+	case id == "" && r.Method == http.MethodPost:
+		s.submitJob(w, r)
+	case id != "" && r.Method == http.MethodGet:
+		s.pollJob(w, r, id)
+	default:
+		writeError(w, http.StatusMethodNotAllowed, errorBody{Code: codeInvalidRequest, Message: "method not allowed"})
+	}
+}
+
+// submitJob queues a request to run in the background and answers 202 with its job, which
+// GET /v1/jobs/{id} reports and, once it is done, is posted to the request's
+// LiveConnect.CallbackURI.
+func (s *Server) submitJob(w http.ResponseWriter, r *http.Request) {
+	var request models.LLMRequest
+	if err := s.decode(w, r, &request, true); err != nil {
+		writeError(w, http.StatusBadRequest, errorBody{Code: codeInvalidRequest, Message: err.Error()})
+		return
+	}
+	if err := request.Validate(); err != nil {
+		writeError(w, http.StatusBadRequest, errorBody{Code: codeInvalidRequest, Message: err.Error()})
+		return
+	}
+
+	caller, err := json.Marshal(callerOf(r.Context()))
+	if err == nil {
+		var job *deferred.Job
+		if job, err = s.jobs.Submit(r.Context(), &request, caller); err == nil {
+			w.Header().Set("Location", jobsPath+"/"+job.ID)
+			writeJSON(w, http.StatusAccepted, jobView(job))
+			return
+		}
+	}
+	status, body := errorResponse(r.Context(), err)
+	writeError(w, status, body)
+}
+
+// pollJob reports job id to the caller that submitted it.
+func (s *Server) pollJob(w http.ResponseWriter, r *http.Request, id string) {
+	job, err := s.jobs.Status(r.Context(), id)
+	if errors.Is(err, store.ErrNotFound) || (err == nil && !ownsJob(r.Context(), job)) {
+		err = errJobNotFound
+	}
+	if err != nil {
+		status, body := errorResponse(r.Context(), err)
+		writeError(w, status, body)
+		return
+	}
+	writeJSON(w, http.StatusOK, jobView(job))
+}
+
+// ownsJob reports whether the caller of a request made with ctx submitted job.
+func ownsJob(ctx context.Context, job *deferred.Job) bool {
+	var c jobCaller
+	if err := json.Unmarshal(job.Caller, &c); err != nil {
+		return false
+	}
+	owner, _ := callerFrom(c.context(context.Background()))
+	caller, _ := callerFrom(ctx)
+	return owner == caller
+}
+
+// jobView returns job as reported to callers, without its Caller.
+func jobView(job *deferred.Job) *deferred.Job {
+	view := *job
+	view.Caller = nil
+	return &view
+}
+
+// runJob makes an attempt of job as the caller that submitted it. Its request is of priority
+// batch unless it sets its own.
+func (s *Server) runJob(ctx context.Context, job *deferred.Job) (*models.LLMResponse, error) {
+	var c jobCaller
+	if err := json.Unmarshal(job.Caller, &c); err != nil {
+		return nil, err
+	}
+	return s.call(withPriority(c.context(ctx), models.PriorityBatch), job.Request)
+}
+
+// runJobs runs the due jobs every gateway.jobs.poll_interval until ctx is done, logging the
+// jobs that could not be run or notified.
+func (s *Server) runJobs(ctx context.Context) {
+	ticker := time.NewTicker(s.config.Gateway.Jobs.PollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		for {
+			n, err := s.jobs.RunDue(ctx, jobBatchSize)
+			if err != nil {
+				slog.ErrorContext(ctx, "running jobs", "error", err)
+			}
+			if n < jobBatchSize || ctx.Err() != nil {
+				break
+			}
+		}
+	}
+}
@@ -0,0 +1,112 @@
+package gateway
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/nexen/config"
+	"github.com/nexen/libs/store"
+	"github.com/nexen/services/connectors/deferred"
+)
+
+// webhook is a body posted to a webhook receiver, and its signature.
+type webhook struct {
+	body      []byte
+	signature string
+}
+
+func TestJobs(t *testing.T) {
+	hooks := make(chan webhook, 1)
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		hooks <- webhook{body, r.Header.Get(deferred.SignatureHeader)}
+	}))
+	defer receiver.Close()
+
+	// Replicas share the store, as they share Redis
+	backend := store.NewMemory()
+	cfg := authConfig()
+	cfg.EnableREST = true
+	cfg.Jobs = config.JobsConfig{Enabled: true, TTL: time.Hour, Timeout: time.Minute, PollInterval: 10 * time.Millisecond,
+		Concurrency: 2, MaxAttempts: 2, WebhookSecret: "secret", WebhookTimeout: 5 * time.Second}
+	replica := func() *Server {
+		return New(&config.Config{Gateway: cfg}, Options{
+			Clients: stubClients{"tenant": &tenantLLM{}},
+			Keys:    NewStoredKeys(backend, cfg.Auth.Keys),
+			Store:   backend,
+		})
+	}
+	first := replica()
+
+	rec, body := send(t, first, http.MethodPost, jobsPath, searchKey,
+		`{"model": "tenant", "contents": [{"role": "user", "message": "Hi"}], "liveConnect": {"callbackUri": "`+receiver.URL+`"}}`)
+	id, _ := body["id"].(string)
+	if rec.Code != http.StatusAccepted || body["status"] != deferred.StatusPending || rec.Header().Get("Location") != jobsPath+"/"+id {
+		t.Fatalf("Expected a pending job, got %d %v %v", rec.Code, rec.Header(), body)
+	}
+	if _, ok := body["caller"]; ok {
+		t.Errorf("Expected the job's caller to be left out, got %v", body)
+	}
+
+	// The first replica stops before running the job; the next one runs it as its caller
+	second := replica()
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		second.runJobs(ctx)
+		close(done)
+	}()
+	defer func() {
+		cancel()
+		<-done
+	}()
+	var hook webhook
+	select {
+	case hook = <-hooks:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected the job's webhook")
+	}
+	if hook.signature != deferred.Sign("secret", hook.body) {
+		t.Errorf("Expected the webhook to be signed, got %q", hook.signature)
+	}
+	var notified deferred.Job
+	if err := json.Unmarshal(hook.body, &notified); err != nil || notified.ID != id || notified.Status != deferred.StatusSucceeded {
+		t.Errorf("Expected the succeeded job, got %s", hook.body)
+	}
+
+	rec, body = send(t, first, http.MethodGet, jobsPath+"/"+id, searchKey, "")
+	response, _ := body["response"].(map[string]any)
+	content, _ := response["content"].(map[string]any)
+	if rec.Code != http.StatusOK || body["status"] != deferred.StatusSucceeded || content["message"] != "acme" {
+		t.Errorf("Expected the response made for the caller's tenant, got %d %v", rec.Code, body)
+	}
+
+	// Jobs are only reported to the caller that submitted them
+	other, err := second.createAPIKey(context.Background(), &keyRequest{Name: "other", TenantID: "globex"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, path := range []string{jobsPath + "/" + id, jobsPath + "/unknown"} {
+		if rec, body := send(t, second, http.MethodGet, path, other.Key, ""); rec.Code != http.StatusNotFound || errorCode(body) != codeJobNotFound {
+			t.Errorf("Expected 404 for %s, got %d %v", path, rec.Code, body)
+		}
+	}
+	if rec, _ := send(t, second, http.MethodGet, jobsPath+"/"+id, "", ""); rec.Code != http.StatusUnauthorized {
+		t.Errorf("Expected 401 without a key, got %d", rec.Code)
+	}
+	if rec, body := send(t, second, http.MethodPost, jobsPath, searchKey, `{"model": "tenant"}`); rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected an invalid request to be refused, got %d %v", rec.Code, body)
+	}
+
+	// Without gateway.jobs, there is no jobs API
+	rec = httptest.NewRecorder()
+	testServer(config.GatewayConfig{}).Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, jobsPath+"/"+id, nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 with jobs disabled, got %d", rec.Code)
+	}
+}
@@ -0,0 +1,142 @@
+package gateway
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+)
+
+// keysPath is the route of the key admin API.
+const keysPath = "/admin/keys"
+
+// connectorsAdminPath is the prefix under which connectors.AdminHandler is served, for the
+// model registry, aliases and provider settings.
+const connectorsAdminPath = "/admin/connectors"
+
+// keyRequest is the body of POST /admin/keys.
+type keyRequest struct {
+	Name                string   `json:"name"`
+	TenantID            string   `json:"tenantId"`
+	AllowedModels       []string `json:"allowedModels"`
+	RequestsPerMinute   int      `json:"requestsPerMinute"`
+	TokensPerMinute     int      `json:"tokensPerMinute"`
+	MaxTokensPerRequest int      `json:"maxTokensPerRequest"`
+	BatchPercent        int      `json:"batchPercent"`
+}
+
+// validate checks the limits and model patterns of the key.
+func (k *keyRequest) validate() error {
+	if k.RequestsPerMinute < 0 || k.TokensPerMinute < 0 || k.MaxTokensPerRequest < 0 {
+		return errors.New("limits must not be negative")
+	}
+	if k.BatchPercent < 0 || k.BatchPercent > 100 {
+		return errors.New("batchPercent must be between 0 and 100")
+	}
+	for _, pattern := range k.AllowedModels {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("allowedModels pattern %q is invalid", pattern)
+		}
+	}
+	return nil
+}
+
+// createdKey is the response of POST /admin/keys: the record of the key and the key itself,
+// which is never shown again.
+type createdKey struct {
+	Key string `json:"key"`
+	*APIKey
+}
+
+// handleKeys serves the key admin API:
+//
+//	POST   /admin/keys       create a key and return it, with its record
+//	DELETE /admin/keys/{id}  revoke a key
+//
+// Every request must carry the admin token as "Authorization: Bearer <token>".
+func (s *Server) handleKeys(w http.ResponseWriter, r *http.Request) {
+	id := strings.TrimPrefix(strings.TrimPrefix(r.URL.Path, keysPath), "/")
+	switch {
+	case id == "" && r.Method == http.MethodPost:
+		s.createKey(w, r)
+	case id != "" && r.Method == http.MethodDelete:
+		s.revokeKey(w, r, id)
+	default:
+		writeError(w, http.StatusMethodNotAllowed, errorBody{Code: codeInvalidRequest, Message: "method not allowed"})
+	}
+}
+
+func (s *Server) createKey(w http.ResponseWriter, r *http.Request) {
+	var request keyRequest
+	if err := s.decode(w, r, &request, true); err != nil {
+		writeError(w, http.StatusBadRequest, errorBody{Code: codeInvalidRequest, Message: err.Error()})
+		return
+	}
+	if err := request.validate(); err != nil {
+		writeError(w, http.StatusBadRequest, errorBody{Code: codeInvalidRequest, Message: err.Error()})
+		return
+	}
+
+	created, err := s.createAPIKey(r.Context(), &request)
+	if err != nil {
+		status, body := errorResponse(r.Context(), err)
+		writeError(w, status, body)
+		return
+	}
+	writeJSON(w, http.StatusCreated, created)
+}
+
+// createAPIKey generates a key with the settings of request and adds it to the key store.
+func (s *Server) createAPIKey(ctx context.Context, request *keyRequest) (*createdKey, error) {
+	secret, err := newKey()
+	if err != nil {
+		return nil, err
+	}
+	id, err := newKeyID()
+	if err != nil {
+		return nil, err
+	}
+	key := &APIKey{
+		ID:                  id,
+		Name:                request.Name,
+		TenantID:            request.TenantID,
+		AllowedModels:       request.AllowedModels,
+		RequestsPerMinute:   request.RequestsPerMinute,
+		TokensPerMinute:     request.TokensPerMinute,
+		MaxTokensPerRequest: request.MaxTokensPerRequest,
+		BatchPercent:        request.BatchPercent,
+		CreatedAt:           time.Now().UTC(),
+	}
+	if err := s.opts.Keys.Create(ctx, HashKey(secret), key); err != nil {
+		return nil, err
+	}
+	return &createdKey{Key: secret, APIKey: key}, nil
+}
+
+func (s *Server) revokeKey(w http.ResponseWriter, r *http.Request, id string) {
+	if err := s.opts.Keys.Revoke(r.Context(), id); err != nil {
+		status, body := errorResponse(r.Context(), err)
+		writeError(w, status, body)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// requireAdmin rejects requests that do not carry the admin token as a bearer token. An empty
+// token rejects all requests.
+func (s *Server) requireAdmin(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		token := s.config.Gateway.Auth.AdminToken
+		got, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if token == "" || !ok || subtle.ConstantTimeCompare([]byte(got), []byte(token)) != 1 {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="nexen-admin"`)
+			writeError(w, http.StatusUnauthorized, errorBody{Code: codeUnauthorized, Message: "admin token required"})
+			return
+		}
+		next(w, r)
+	}
+}
@@ -0,0 +1,249 @@
+package gateway
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/nexen/config"
+)
+
+// jwksMinRefresh is the least time between two fetches of the signing keys for tokens signed
+// with an unknown key, so that such tokens cannot make the gateway hammer the issuer.
+const jwksMinRefresh = time.Minute
+
+// tokenLeeway is the clock skew allowed when checking the times of a token.
+const tokenLeeway = 30 * time.Second
+
+// defaultJWKSCacheTTL caches the signing keys when config.OIDCConfig.JWKSCacheTTL is zero.
+const defaultJWKSCacheTTL = time.Hour
+
+// errUnknownSigningKey is the error of tokens signed with a key the issuer does not publish.
+var errUnknownSigningKey = errors.New("token is signed with an unknown key")
+
+// tokenClaims is the identity a verified token attributes its requests to.
+type tokenClaims struct {
+	Subject  string
+	TenantID string
+	UserID   string
+}
+
+// oidcVerifier verifies the JWTs of an OpenID Connect issuer against its published signing
+// keys, which it caches.
+type oidcVerifier struct {
+	cfg    config.OIDCConfig
+	client *http.Client
+	parser *jwt.Parser
+
+	mu      sync.Mutex
+	jwksURL string         // discovered when not configured
+	keys    map[string]any // key ID -> public key
+	fetched time.Time
+}
+
+func newOIDCVerifier(cfg config.OIDCConfig) *oidcVerifier {
+	if cfg.JWKSCacheTTL <= 0 {
+		cfg.JWKSCacheTTL = defaultJWKSCacheTTL
+	}
+	return &oidcVerifier{
+		cfg:     cfg,
+		client:  &http.Client{Timeout: 10 * time.Second},
+		jwksURL: cfg.JWKSURL,
+		parser: jwt.NewParser(
+			jwt.WithIssuer(cfg.Issuer),
+			jwt.WithAudience(cfg.Audience),
+			jwt.WithExpirationRequired(),
+			jwt.WithLeeway(tokenLeeway),
+			jwt.WithValidMethods([]string{"RS256", "RS384", "RS512", "PS256", "PS384", "PS512", "ES256", "ES384", "ES512"}),
+		),
+	}
+}
+
+// isToken reports whether a bearer credential is a JWT rather than an API key.
+func isToken(credential string) bool {
+	return strings.Count(credential, ".") == 2
+}
+
+// verify checks the signature, issuer, audience and times of token and returns its claims.
+// Invalid tokens fail with errUnauthorized; failures to get the signing keys do not.
+func (v *oidcVerifier) verify(ctx context.Context, token string) (*tokenClaims, error) {
+	var fetchErr error
+	claims := jwt.MapClaims{}
+	_, err := v.parser.ParseWithClaims(token, claims, func(t *jwt.Token) (any, error) {
+		kid, _ := t.Header["kid"].(string)
+		key, err := v.key(ctx, kid)
+		if err != nil && !errors.Is(err, errUnknownSigningKey) {
+			fetchErr = err
+		}
+		return key, err
+	})
+	if fetchErr != nil {
+		return nil, fetchErr
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid token: %v", errUnauthorized, err)
+	}
+	subject, _ := claims.GetSubject()
+	tenant, _ := claims[v.cfg.TenantClaim].(string)
+	user, _ := claims[v.cfg.UserClaim].(string)
+	return &tokenClaims{Subject: subject, TenantID: tenant, UserID: user}, nil
+}
+
+// key returns the signing key with the given ID, fetching the keys when the cache has expired
+// or, at most every jwksMinRefresh, when it does not hold the key. An empty ID matches the
+// only key of the set.
+func (v *oidcVerifier) key(ctx context.Context, kid string) (any, error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	age := time.Since(v.fetched)
+	key, ok := v.lookup(kid)
+	if v.keys == nil || age > v.cfg.JWKSCacheTTL || (!ok && age > jwksMinRefresh) {
+		keys, err := v.fetch(ctx)
+		switch {
+		case err == nil:
+			v.keys, v.fetched = keys, time.Now()
+			key, ok = v.lookup(kid)
+		case v.keys == nil:
+			return nil, err
+		}
+		// Otherwise keep verifying with the stale keys while the issuer is unreachable
+	}
+	if !ok {
+		return nil, errUnknownSigningKey
+	}
+	return key, nil
+}
+
+// lookup returns the cached key with the given ID. Callers hold v.mu.
+func (v *oidcVerifier) lookup(kid string) (any, bool) {
+	if kid == "" && len(v.keys) == 1 {
+		for _, key := range v.keys {
+			return key, true
+		}
+	}
+	key, ok := v.keys[kid]
+	return key, ok
+}
+
+// jwks is a JSON Web Key Set, as published by an issuer.
+type jwks struct {
+	Keys []jwk `json:"keys"`
+}
+
+// jwk is a public JSON Web Key of type RSA or EC.
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// fetch gets the issuer's signing keys, discovering their URL first if needed. Keys of other
+// types or uses are skipped. Callers hold v.mu.
+func (v *oidcVerifier) fetch(ctx context.Context) (map[string]any, error) {
+	if v.jwksURL == "" {
+		var discovery struct {
+			JWKSURI string `json:"jwks_uri"`
+		}
+		if err := v.get(ctx, strings.TrimSuffix(v.cfg.Issuer, "/")+"/.well-known/openid-configuration", &discovery); err != nil {
+			return nil, err
+		}
+		if discovery.JWKSURI == "" {
+			return nil, errors.New("gateway: the OIDC issuer publishes no jwks_uri")
+		}
+		v.jwksURL = discovery.JWKSURI
+	}
+	var set jwks
+	if err := v.get(ctx, v.jwksURL, &set); err != nil {
+		return nil, err
+	}
+	keys := make(map[string]any, len(set.Keys))
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		if key, err := k.publicKey(); err == nil {
+			keys[k.Kid] = key
+		}
+	}
+	return keys, nil
+}
+
+// get decodes the JSON document at url into into.
+func (v *oidcVerifier) get(ctx context.Context, url string, into any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return fmt.Errorf("gateway: fetching %s: %w", url, err)
+	}
+	resp, err := v.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("gateway: fetching %s: %w", url, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("gateway: fetching %s: status %d", url, resp.StatusCode)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(into); err != nil {
+		return fmt.Errorf("gateway: decoding %s: %w", url, err)
+	}
+	return nil
+}
+
+// publicKey returns the *rsa.PublicKey or *ecdsa.PublicKey of k.
+func (k jwk) publicKey() (any, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeInt(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeInt(k.E)
+		if err != nil || !e.IsInt64() {
+			return nil, errors.New("invalid RSA exponent")
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		curves := map[string]elliptic.Curve{"P-256": elliptic.P256(), "P-384": elliptic.P384(), "P-521": elliptic.P521()}
+		curve, ok := curves[k.Crv]
+		if !ok {
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := decodeInt(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeInt(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		if !curve.IsOnCurve(x, y) {
+			return nil, errors.New("EC point is not on its curve")
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	}
+	return nil, fmt.Errorf("unsupported key type %q", k.Kty)
+}
+
+// decodeInt decodes a base64url-encoded big-endian integer.
+func decodeInt(s string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil || len(b) == 0 {
+		return nil, errors.New("invalid key parameter")
+	}
+	return new(big.Int).SetBytes(b), nil
+}
@@ -0,0 +1,164 @@
+package gateway
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/nexen/config"
+	"github.com/nexen/models"
+)
+
+// userLLM replies with the tenant and user the request is attributed to.
+type userLLM struct{ stubLLM }
+
+func (u *userLLM) Call(ctx context.Context, request *models.LLMRequest) (*models.LLMResponse, error) {
+	message := request.Metadata.TenantID + "/" + request.Metadata.UserID
+	return &models.LLMResponse{Content: &models.Content{Role: "assistant", Message: message}}, nil
+}
+
+// testIssuer is an OIDC issuer publishing the keys it signs tokens with.
+type testIssuer struct {
+	*httptest.Server
+	fetches atomic.Int32
+
+	mu   sync.Mutex
+	keys map[string]*ecdsa.PrivateKey
+}
+
+func newTestIssuer(t *testing.T) *testIssuer {
+	i := &testIssuer{keys: make(map[string]*ecdsa.PrivateKey)}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{"issuer": i.URL, "jwks_uri": i.URL + "/keys"})
+	})
+	mux.HandleFunc("/keys", func(w http.ResponseWriter, r *http.Request) {
+		i.fetches.Add(1)
+		i.mu.Lock()
+		defer i.mu.Unlock()
+		var set jwks
+		for kid, key := range i.keys {
+			set.Keys = append(set.Keys, jwk{
+				Kty: "EC", Kid: kid, Use: "sig", Crv: "P-256",
+				X: base64.RawURLEncoding.EncodeToString(key.X.FillBytes(make([]byte, 32))),
+				Y: base64.RawURLEncoding.EncodeToString(key.Y.FillBytes(make([]byte, 32))),
+			})
+		}
+		json.NewEncoder(w).Encode(set)
+	})
+	i.Server = httptest.NewServer(mux)
+	t.Cleanup(i.Close)
+	i.addKey(t, "k1")
+	return i
+}
+
+func (i *testIssuer) addKey(t *testing.T, kid string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.keys[kid] = key
+}
+
+// token returns a token of the issuer for audience, signed with the key kid, that expires
+// after ttl.
+func (i *testIssuer) token(t *testing.T, kid, audience string, ttl time.Duration) string {
+	t.Helper()
+	token := jwt.NewWithClaims(jwt.SigningMethodES256, jwt.MapClaims{
+		"iss":       i.URL,
+		"aud":       audience,
+		"sub":       "user-1",
+		"tenant_id": "acme",
+		"exp":       time.Now().Add(ttl).Unix(),
+	})
+	token.Header["kid"] = kid
+	i.mu.Lock()
+	key, ok := i.keys[kid]
+	i.mu.Unlock()
+	if !ok {
+		key, _ = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	}
+	signed, err := token.SignedString(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed
+}
+
+func oidcServer(t *testing.T) (*Server, *testIssuer) {
+	issuer := newTestIssuer(t)
+	cfg := authConfig()
+	cfg.Auth.OIDC = config.OIDCConfig{Issuer: issuer.URL, Audience: "nexen", TenantClaim: "tenant_id", UserClaim: "sub"}
+	s := testServer(cfg)
+	s.opts.Clients.(stubClients)["user"] = &userLLM{}
+	return s, issuer
+}
+
+func TestOIDCAuth(t *testing.T) {
+	s, issuer := oidcServer(t)
+	call := `{"model": "user", "contents": [{"role": "user", "message": "Hi"}], "metadata": {"tenantId": "other"}}`
+
+	// Requests are attributed to the claims of their token
+	for i := 0; i < 2; i++ {
+		rec, body := send(t, s, http.MethodPost, "/v1/llm/call", issuer.token(t, "k1", "nexen", time.Minute), call)
+		if rec.Code != http.StatusOK || body["content"].(map[string]any)["message"] != "acme/user-1" {
+			t.Fatalf("Expected the token's tenant and user, got %d %v", rec.Code, body)
+		}
+	}
+	if n := issuer.fetches.Load(); n != 1 {
+		t.Errorf("Expected the keys to be fetched once, got %d", n)
+	}
+
+	testCases := []struct {
+		name  string
+		token string
+	}{
+		{"wrong audience", issuer.token(t, "k1", "other", time.Minute)},
+		{"expired", issuer.token(t, "k1", "nexen", -time.Hour)},
+		{"unknown key", issuer.token(t, "k9", "nexen", time.Minute)},
+		{"malformed", "a.b.c"},
+	}
+	for _, tc := range testCases {
+		rec, body := send(t, s, http.MethodPost, "/v1/llm/call", tc.token, call)
+		if rec.Code != http.StatusUnauthorized || errorCode(body) != codeUnauthorized {
+			t.Errorf("%s: expected 401, got %d %v", tc.name, rec.Code, body)
+		}
+	}
+
+	// API keys are still accepted
+	if rec, body := send(t, s, http.MethodPost, "/v1/llm/call", searchKey, `{"model": "echo", "contents": [{"role": "user", "message": "Hi"}]}`); rec.Code != http.StatusOK {
+		t.Errorf("Expected the API key to be accepted, got %d %v", rec.Code, body)
+	}
+}
+
+func TestOIDCKeyRotation(t *testing.T) {
+	s, issuer := oidcServer(t)
+	call := `{"model": "user", "contents": [{"role": "user", "message": "Hi"}]}`
+	if rec, body := send(t, s, http.MethodPost, "/v1/llm/call", issuer.token(t, "k1", "nexen", time.Minute), call); rec.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d %v", rec.Code, body)
+	}
+
+	// A token signed with a new key refreshes the keys, once they are old enough
+	issuer.addKey(t, "k2")
+	s.oidc.mu.Lock()
+	s.oidc.fetched = time.Now().Add(-2 * jwksMinRefresh)
+	s.oidc.mu.Unlock()
+	if rec, body := send(t, s, http.MethodPost, "/v1/llm/call", issuer.token(t, "k2", "nexen", time.Minute), call); rec.Code != http.StatusOK {
+		t.Errorf("Expected the new key to be fetched, got %d %v", rec.Code, body)
+	}
+	if n := issuer.fetches.Load(); n != 2 {
+		t.Errorf("Expected the keys to be fetched twice, got %d", n)
+	}
+}
@@ -0,0 +1,56 @@
+package gateway
+
+import (
+	"context"
+
+	"github.com/nexen/models"
+)
+
+// priorityContextKey is the context key of the priority of the requests of an endpoint.
+type priorityContextKey struct{}
+
+// withPriority returns ctx for the requests of an endpoint that are of priority p when they
+// set none, such as models.PriorityBatch for the batch endpoints.
+func withPriority(ctx context.Context, p string) context.Context {
+	return context.WithValue(ctx, priorityContextKey{}, p)
+}
+
+// priorityFrom returns the priority of the endpoint of a request made with ctx, if it has one.
+func priorityFrom(ctx context.Context) (string, bool) {
+	p, ok := ctx.Value(priorityContextKey{}).(string)
+	return p, ok
+}
+
+// prioritize sets the priority of request, attributed to its tenant: its own, or else that of
+// its endpoint or the default of gateway.priority for the tenant, lowered to the tenant's
+// maximum. Batch requests are sent to the batch model of theirs, if any.
+func (s *Server) prioritize(ctx context.Context, request *models.LLMRequest) {
+	rule := s.config.Gateway.Priority.PriorityFor(request.Metadata.TenantID)
+	p := request.Metadata.Priority
+	if p == "" {
+		if endpoint, ok := priorityFrom(ctx); ok {
+			p = endpoint
+		} else {
+			p = rule.Default
+		}
+	}
+	if p == "" {
+		p = models.PriorityInteractive
+	}
+	if rule.Max == models.PriorityBatch {
+		p = models.PriorityBatch
+	}
+	request.Metadata.Priority = p
+	if model, ok := rule.BatchModels[request.Model]; ok && p == models.PriorityBatch {
+		request.Model = model
+	}
+}
+
+// queueRank orders the requests of priority p waiting in a queue: those of higher ranks are
+// admitted first.
+func queueRank(p string) int {
+	if p == models.PriorityBatch {
+		return 0
+	}
+	return 1
+}
@@ -0,0 +1,58 @@
+package gateway
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/nexen/config"
+	"github.com/nexen/models"
+)
+
+func TestPrioritize(t *testing.T) {
+	s := testServer(config.GatewayConfig{Priority: config.PriorityConfig{
+		PriorityRule: config.PriorityRule{BatchModels: map[string]string{"gpt-4o": "gpt-4o-mini"}},
+		Tenants: map[string]config.PriorityRule{
+			"reports": {Default: models.PriorityBatch},
+			"trial":   {Max: models.PriorityBatch},
+		},
+	}})
+	batch := withPriority(context.Background(), models.PriorityBatch)
+	for _, tt := range []struct {
+		name          string
+		ctx           context.Context
+		tenant, asked string
+		want, model   string
+	}{
+		{"interactive by default", context.Background(), "acme", "", models.PriorityInteractive, "gpt-4o"},
+		{"asked for", context.Background(), "acme", models.PriorityBatch, models.PriorityBatch, "gpt-4o-mini"},
+		{"batch endpoint", batch, "acme", "", models.PriorityBatch, "gpt-4o-mini"},
+		{"asked for on a batch endpoint", batch, "acme", models.PriorityInteractive, models.PriorityInteractive, "gpt-4o"},
+		{"tenant default", context.Background(), "reports", "", models.PriorityBatch, "gpt-4o-mini"},
+		{"tenant maximum", context.Background(), "trial", models.PriorityInteractive, models.PriorityBatch, "gpt-4o-mini"},
+	} {
+		request := &models.LLMRequest{Model: "gpt-4o", Metadata: models.RequestMetadata{TenantID: tt.tenant, Priority: tt.asked}}
+		s.prioritize(tt.ctx, request)
+		if request.Metadata.Priority != tt.want || request.Model != tt.model {
+			t.Errorf("%s: expected %s on %s, got %s on %s", tt.name, tt.want, tt.model, request.Metadata.Priority, request.Model)
+		}
+	}
+}
+
+func TestBatchModels(t *testing.T) {
+	s := testServer(config.GatewayConfig{Priority: config.PriorityConfig{
+		PriorityRule: config.PriorityRule{BatchModels: map[string]string{"premium": "echo"}},
+	}})
+	s.opts.Clients.(stubClients)["premium"] = &stubLLM{err: errors.New("premium is not for batches")}
+
+	rec, body := post(t, s, "/v1/llm/batch", `{"requests": [{"model": "premium", "contents": [{"role": "user", "message": "one"}]}]}`)
+	results, _ := body["results"].([]any)
+	if rec.Code != http.StatusOK || len(results) != 1 || results[0].(map[string]any)["response"] == nil {
+		t.Errorf("Expected the batch model to answer, got %d %v", rec.Code, body)
+	}
+	rec, body = post(t, s, "/v1/llm/call", `{"model": "premium", "contents": [{"role": "user", "message": "one"}]}`)
+	if rec.Code == http.StatusOK {
+		t.Errorf("Expected interactive requests to keep their model, got %v", body)
+	}
+}
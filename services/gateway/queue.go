@@ -0,0 +1,393 @@
+package gateway
+
+import (
+	"container/heap"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/nexen/config"
+	"github.com/nexen/models"
+	"github.com/nexen/services/connectors/common"
+)
+
+// queueStatusPath is the route of the queue metrics.
+const queueStatusPath = "/status/queues"
+
+// defaultRateLimitPause is how long a provider's queue pauses after a rate-limit error that
+// does not say when to retry.
+const defaultRateLimitPause = time.Second
+
+// overloadedError is the error of requests refused because their provider's queue is full or
+// they waited in it too long.
+type overloadedError struct {
+	provider   string
+	reason     string
+	retryAfter time.Duration
+}
+
+func (e *overloadedError) Error() string {
+	return fmt.Sprintf("provider %s is overloaded: %s", e.provider, e.reason)
+}
+
+// queueStats are the metrics of a provider's queue, items of GET /status/queues.
+type queueStats struct {
+	Provider string `json:"provider"`
+
+	// Depth is the number of requests waiting, and InFlight the number admitted and not
+	// finished, of at most Limit when it is positive.
+	Depth    int `json:"depth"`
+	InFlight int `json:"inFlight"`
+	Limit    int `json:"limit"`
+
+	// PausedMs is how long the queue still waits out the provider's rate limit.
+	PausedMs int64 `json:"pausedMs"`
+
+	// Counts since the gateway started: requests admitted, admitted after waiting, refused
+	// because the queue was full, refused after waiting too long, and rate-limit errors of the
+	// provider.
+	Admitted    int64 `json:"admitted"`
+	Queued      int64 `json:"queued"`
+	Rejected    int64 `json:"rejected"`
+	TimedOut    int64 `json:"timedOut"`
+	RateLimited int64 `json:"rateLimited"`
+}
+
+// waiter is a request waiting in a queue.
+type waiter struct {
+	rank     int // see queueRank
+	deadline time.Time
+	seq      uint64
+	ready    chan struct{} // closed when the request is admitted
+	index    int           // in the queue's heap; -1 once admitted or removed
+}
+
+// waiters is a heap of waiters, ordered by rank, then deadline, then arrival.
+type waiters []*waiter
+
+func (w waiters) Len() int { return len(w) }
+
+func (w waiters) Less(i, j int) bool {
+	a, b := w[i], w[j]
+	if a.rank != b.rank {
+		return a.rank > b.rank
+	}
+	if !a.deadline.Equal(b.deadline) {
+		return a.deadline.Before(b.deadline)
+	}
+	return a.seq < b.seq
+}
+
+func (w waiters) Swap(i, j int) {
+	w[i], w[j] = w[j], w[i]
+	w[i].index, w[j].index = i, j
+}
+
+func (w *waiters) Push(x any) {
+	x.(*waiter).index = len(*w)
+	*w = append(*w, x.(*waiter))
+}
+
+func (w *waiters) Pop() any {
+	old := *w
+	last := old[len(old)-1]
+	old[len(old)-1] = nil
+	last.index = -1
+	*w = old[:len(old)-1]
+	return last
+}
+
+// queue admits the requests of one provider: at most limit at once, when it is positive, and
+// none while the provider's rate limit is waited out. Others wait, at most maxDepth of them,
+// the most urgent first.
+type queue struct {
+	provider string
+	limit    int
+	maxDepth int
+
+	// now is replaceable in tests
+	now func() time.Time
+
+	mu          sync.Mutex
+	inFlight    int
+	waiting     waiters
+	seq         uint64
+	pausedUntil time.Time
+	resume      *time.Timer   // admits waiters when the pause ends
+	latency     time.Duration // moving average of the time requests are in flight
+	stats       queueStats
+}
+
+// free reports whether a request can be admitted at now. Callers hold q.mu.
+func (q *queue) free(now time.Time) bool {
+	return (q.limit <= 0 || q.inFlight < q.limit) && !now.Before(q.pausedUntil)
+}
+
+// acquire admits a request of the given rank, waiting until expires at most. Requests that
+// cannot wait, or that wait until expires, fail with an *overloadedError, and those whose ctx
+// is done first with its error.
+func (q *queue) acquire(ctx context.Context, rank int, expires time.Time) error {
+	q.mu.Lock()
+	now := q.now()
+	if len(q.waiting) == 0 && q.free(now) {
+		q.inFlight++
+		q.stats.Admitted++
+		q.mu.Unlock()
+		return nil
+	}
+	if len(q.waiting) >= q.maxDepth {
+		q.stats.Rejected++
+		err := &overloadedError{provider: q.provider, reason: "too many requests are queued", retryAfter: q.retryAfter(now)}
+		q.mu.Unlock()
+		return err
+	}
+	deadline := expires
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	q.seq++
+	w := &waiter{rank: rank, deadline: deadline, seq: q.seq, ready: make(chan struct{})}
+	heap.Push(&q.waiting, w)
+	q.schedule(now)
+	q.mu.Unlock()
+
+	timer := time.NewTimer(expires.Sub(now))
+	defer timer.Stop()
+	var err error
+	select {
+	case <-w.ready:
+		return nil
+	case <-timer.C:
+		err = &overloadedError{provider: q.provider, reason: "the request waited too long in the queue"}
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	select {
+	case <-w.ready:
+		// Admitted meanwhile: give the slot to the next request
+		q.inFlight--
+		q.dispatch()
+	default:
+		heap.Remove(&q.waiting, w.index)
+	}
+	var overloaded *overloadedError
+	if errors.As(err, &overloaded) {
+		q.stats.TimedOut++
+		overloaded.retryAfter = q.retryAfter(q.now())
+	}
+	return err
+}
+
+// release ends a request admitted by acquire that was in flight for d.
+func (q *queue) release(d time.Duration) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.inFlight--
+	if q.latency == 0 {
+		q.latency = d
+	} else {
+		q.latency += (d - q.latency) / 8
+	}
+	q.dispatch()
+}
+
+// pause stops admitting requests for d, after the provider refused one with a rate-limit
+// error.
+func (q *queue) pause(d time.Duration) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.stats.RateLimited++
+	if until := q.now().Add(d); until.After(q.pausedUntil) {
+		q.pausedUntil = until
+	}
+}
+
+// dispatch admits waiters while there is room. Callers hold q.mu.
+func (q *queue) dispatch() {
+	now := q.now()
+	for len(q.waiting) > 0 && q.free(now) {
+		w := heap.Pop(&q.waiting).(*waiter)
+		q.inFlight++
+		q.stats.Admitted++
+		q.stats.Queued++
+		close(w.ready)
+	}
+	q.schedule(now)
+}
+
+// schedule arranges for waiters to be admitted when the pause ends. Callers hold q.mu.
+func (q *queue) schedule(now time.Time) {
+	if len(q.waiting) == 0 || !now.Before(q.pausedUntil) || q.resume != nil {
+		return
+	}
+	q.resume = time.AfterFunc(q.pausedUntil.Sub(now), func() {
+		q.mu.Lock()
+		defer q.mu.Unlock()
+		q.resume = nil
+		q.dispatch()
+	})
+}
+
+// retryAfter estimates how long until a request would be admitted: the rest of the pause, or
+// the time for the requests in flight and waiting to go through. Callers hold q.mu.
+func (q *queue) retryAfter(now time.Time) time.Duration {
+	if now.Before(q.pausedUntil) {
+		return q.pausedUntil.Sub(now)
+	}
+	slots := q.limit
+	if slots <= 0 {
+		slots = 1
+	}
+	return q.latency * time.Duration(len(q.waiting)+1) / time.Duration(slots)
+}
+
+// snapshot returns the metrics of q.
+func (q *queue) snapshot() queueStats {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	stats := q.stats
+	stats.Provider, stats.Depth, stats.InFlight, stats.Limit = q.provider, len(q.waiting), q.inFlight, q.limit
+	if paused := q.pausedUntil.Sub(q.now()); paused > 0 {
+		stats.PausedMs = paused.Milliseconds()
+	}
+	return stats
+}
+
+// queues holds the queue of each provider, created on first use.
+type queues struct {
+	cfg config.QueueConfig
+
+	mu         sync.Mutex
+	byProvider map[string]*queue
+}
+
+// newQueues returns the queues of cfg, or nil when it is disabled.
+func newQueues(cfg config.QueueConfig) *queues {
+	if !cfg.Enabled {
+		return nil
+	}
+	return &queues{cfg: cfg, byProvider: make(map[string]*queue)}
+}
+
+// get returns the queue of provider.
+func (qs *queues) get(provider string) *queue {
+	qs.mu.Lock()
+	defer qs.mu.Unlock()
+	q, ok := qs.byProvider[provider]
+	if !ok {
+		q = &queue{provider: provider, limit: qs.cfg.MaxConcurrentFor(provider), maxDepth: qs.cfg.MaxDepth, now: time.Now}
+		qs.byProvider[provider] = q
+	}
+	return q
+}
+
+// wrap returns llm, the client of model, sending its requests through the queue of the
+// model's provider.
+func (qs *queues) wrap(model string, llm common.LLM) common.LLM {
+	provider := model
+	if info, err := models.Resolve(model); err == nil && info.Provider != "" {
+		provider = info.Provider
+	}
+	return &queuedLLM{LLM: llm, queue: qs.get(provider), maxWait: qs.cfg.MaxWait}
+}
+
+// stats returns the metrics of every queue, by provider.
+func (qs *queues) stats() []queueStats {
+	qs.mu.Lock()
+	all := make([]*queue, 0, len(qs.byProvider))
+	for _, q := range qs.byProvider {
+		all = append(all, q)
+	}
+	qs.mu.Unlock()
+	stats := make([]queueStats, len(all))
+	for i, q := range all {
+		stats[i] = q.snapshot()
+	}
+	sort.Slice(stats, func(i, j int) bool { return stats[i].Provider < stats[j].Provider })
+	return stats
+}
+
+// queuedLLM sends the requests of a client through its provider's queue.
+type queuedLLM struct {
+	common.LLM
+	queue   *queue
+	maxWait time.Duration
+}
+
+// Call implements common.LLM.
+func (l *queuedLLM) Call(ctx context.Context, request *models.LLMRequest) (*models.LLMResponse, error) {
+	var response *models.LLMResponse
+	err := l.run(ctx, request, func() (err error) {
+		response, err = l.LLM.Call(ctx, request)
+		return err
+	}, func() bool { return true })
+	return response, err
+}
+
+// CallStream implements common.Streamer. A stream is only retried after a rate-limit error
+// when none of it was yielded.
+func (l *queuedLLM) CallStream(ctx context.Context, request *models.LLMRequest, yield func(*models.LLMResponse) error) error {
+	started := false
+	return l.run(ctx, request, func() error {
+		return common.CallStream(ctx, l.LLM, request, func(response *models.LLMResponse) error {
+			started = true
+			return yield(response)
+		})
+	}, func() bool { return !started })
+}
+
+// BatchCall implements common.LLM, queueing each request on its own.
+func (l *queuedLLM) BatchCall(ctx context.Context, requests []*models.LLMRequest) ([]*models.LLMResponse, error) {
+	return common.BatchCall(ctx, requests, common.DefaultBatchConcurrency, l.Call)
+}
+
+// run calls call for request once the queue admits it. When the provider refuses it with a rate-limit
+// error, the queue pauses until the provider says to retry, and call is retried if retry
+// allows it and the pause ends within the request's wait.
+func (l *queuedLLM) run(ctx context.Context, request *models.LLMRequest, call func() error, retry func() bool) error {
+	expires := l.queue.now().Add(l.maxWait)
+	rank := queueRank(request.Metadata.Priority)
+	for {
+		if err := l.queue.acquire(ctx, rank, expires); err != nil {
+			return err
+		}
+		start := l.queue.now()
+		err := call()
+		l.queue.release(l.queue.now().Sub(start))
+		if !errors.Is(err, common.ErrRateLimited) {
+			return err
+		}
+		pause := defaultRateLimitPause
+		var provider *common.ProviderError
+		if errors.As(err, &provider) && provider.RetryAfter > 0 {
+			pause = provider.RetryAfter
+		}
+		l.queue.pause(pause)
+		if !retry() || l.queue.now().Add(pause).After(expires) {
+			return err
+		}
+	}
+}
+
+// handleQueueStatus reports the metrics of the providers' queues.
+func (s *Server) handleQueueStatus(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, errorBody{Code: codeInvalidRequest, Message: "method not allowed"})
+		return
+	}
+	report := struct {
+		Enabled bool         `json:"enabled"`
+		Queues  []queueStats `json:"queues"`
+	}{Queues: []queueStats{}}
+	if s.queues != nil {
+		report.Enabled, report.Queues = true, s.queues.stats()
+	}
+	writeJSON(w, http.StatusOK, report)
+}
@@ -0,0 +1,185 @@
+package gateway
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/nexen/config"
+	"github.com/nexen/models"
+	"github.com/nexen/services/connectors/common"
+)
+
+// waitForDepth waits until depth requests wait in q.
+func waitForDepth(t *testing.T, q *queue, depth int) {
+	t.Helper()
+	for start := time.Now(); q.snapshot().Depth != depth; time.Sleep(time.Millisecond) {
+		if time.Since(start) > 5*time.Second {
+			t.Fatalf("Expected %d requests to wait, got %+v", depth, q.snapshot())
+		}
+	}
+}
+
+func TestQueueOrder(t *testing.T) {
+	q := &queue{provider: "test", limit: 1, maxDepth: 10, now: time.Now}
+	ctx := context.Background()
+	expires := time.Now().Add(time.Minute)
+	if err := q.acquire(ctx, queueRank(models.PriorityInteractive), expires); err != nil {
+		t.Fatal(err)
+	}
+
+	var mu sync.Mutex
+	var order []string
+	var wg sync.WaitGroup
+	enqueue := func(name, p string, ctx context.Context) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := q.acquire(ctx, queueRank(p), expires); err != nil {
+				t.Error(err)
+				return
+			}
+			mu.Lock()
+			order = append(order, name)
+			mu.Unlock()
+			q.release(time.Millisecond)
+		}()
+	}
+	soon, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+	enqueue("batch", models.PriorityBatch, ctx)
+	waitForDepth(t, q, 1)
+	enqueue("interactive", models.PriorityInteractive, ctx)
+	waitForDepth(t, q, 2)
+	enqueue("urgent", models.PriorityInteractive, soon)
+	waitForDepth(t, q, 3)
+
+	q.release(time.Millisecond)
+	wg.Wait()
+	// Interactive requests first, the one with the earliest deadline leading
+	if strings.Join(order, ",") != "urgent,interactive,batch" {
+		t.Errorf("Unexpected order %v", order)
+	}
+	if stats := q.snapshot(); stats.Admitted != 4 || stats.Queued != 3 || stats.InFlight != 0 {
+		t.Errorf("Unexpected stats %+v", stats)
+	}
+}
+
+func TestQueueBounds(t *testing.T) {
+	q := &queue{provider: "test", limit: 1, maxDepth: 1, now: time.Now}
+	ctx := context.Background()
+	if err := q.acquire(ctx, queueRank(models.PriorityInteractive), time.Now().Add(time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+
+	// A request waits until it expires
+	var overloaded *overloadedError
+	if err := q.acquire(ctx, queueRank(models.PriorityInteractive), time.Now().Add(10*time.Millisecond)); !errors.As(err, &overloaded) {
+		t.Errorf("Expected the request to time out in the queue, got %v", err)
+	}
+
+	// or until its context is done
+	canceled, cancel := context.WithCancel(ctx)
+	done := make(chan error)
+	go func() {
+		done <- q.acquire(canceled, queueRank(models.PriorityInteractive), time.Now().Add(time.Minute))
+	}()
+	waitForDepth(t, q, 1)
+
+	// The queue being full, others are refused at once
+	if err := q.acquire(ctx, queueRank(models.PriorityInteractive), time.Now().Add(time.Minute)); !errors.As(err, &overloaded) {
+		t.Errorf("Expected a full queue to refuse the request, got %v", err)
+	}
+	cancel()
+	if err := <-done; !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected the context's error, got %v", err)
+	}
+	if stats := q.snapshot(); stats.Depth != 0 || stats.InFlight != 1 || stats.Rejected != 1 || stats.TimedOut != 1 {
+		t.Errorf("Unexpected stats %+v", stats)
+	}
+}
+
+// flakyLLM fails its first calls with a rate-limit error of the provider.
+type flakyLLM struct {
+	stubLLM
+	mu       sync.Mutex
+	failures int
+}
+
+func (f *flakyLLM) Call(ctx context.Context, request *models.LLMRequest) (*models.LLMResponse, error) {
+	f.mu.Lock()
+	fail := f.failures > 0
+	f.failures--
+	f.mu.Unlock()
+	if fail {
+		return nil, &common.ProviderError{Provider: "test", StatusCode: 429, RetryAfter: 20 * time.Millisecond, Class: common.ErrRateLimited}
+	}
+	return f.stubLLM.Call(ctx, request)
+}
+
+// gatedLLM answers once its gate is closed.
+type gatedLLM struct {
+	stubLLM
+	gate chan struct{}
+}
+
+func (g *gatedLLM) Call(ctx context.Context, request *models.LLMRequest) (*models.LLMResponse, error) {
+	<-g.gate
+	return g.stubLLM.Call(ctx, request)
+}
+
+func TestQueue(t *testing.T) {
+	gated := &gatedLLM{gate: make(chan struct{})}
+	clients := stubClients{"flaky": &flakyLLM{failures: 1}, "gated": gated}
+	s := New(&config.Config{Gateway: config.GatewayConfig{
+		EnableREST: true,
+		Queue:      config.QueueConfig{Enabled: true, MaxConcurrent: 1, MaxDepth: 1, MaxWait: 5 * time.Second},
+	}}, Options{Clients: clients})
+	call := func(model string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		s.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/v1/llm/call",
+			strings.NewReader(`{"model": "`+model+`", "contents": [{"role": "user", "message": "Hi"}]}`)))
+		return rec
+	}
+
+	// Rate-limit errors of the provider are waited out
+	if rec := call("flaky"); rec.Code != http.StatusOK {
+		t.Errorf("Expected the call to be retried, got %d %s", rec.Code, rec.Body)
+	}
+
+	// A request over the cap waits; the next one is refused
+	var wg sync.WaitGroup
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if rec := call("gated"); rec.Code != http.StatusOK {
+				t.Errorf("Expected 200, got %d %s", rec.Code, rec.Body)
+			}
+		}()
+	}
+	waitForDepth(t, s.queues.get("gated"), 1)
+	rec := call("gated")
+	if rec.Code != http.StatusServiceUnavailable || rec.Header().Get("Retry-After") == "" || !strings.Contains(rec.Body.String(), codeOverloaded) {
+		t.Errorf("Expected 503 with Retry-After, got %d %v %s", rec.Code, rec.Header(), rec.Body)
+	}
+	close(gated.gate)
+	wg.Wait()
+
+	rec, body := send(t, s, http.MethodGet, queueStatusPath, "", "")
+	queues, _ := body["queues"].([]any)
+	if rec.Code != http.StatusOK || len(queues) != 2 {
+		t.Fatalf("Expected the stats of two queues, got %d %v", rec.Code, body)
+	}
+	if flaky := queues[0].(map[string]any); flaky["provider"] != "flaky" || flaky["rateLimited"] != 1.0 || flaky["admitted"] != 2.0 {
+		t.Errorf("Unexpected stats %v", flaky)
+	}
+	if gated := queues[1].(map[string]any); gated["rejected"] != 1.0 || gated["queued"] != 1.0 || gated["depth"] != 0.0 {
+		t.Errorf("Unexpected stats %v", gated)
+	}
+}
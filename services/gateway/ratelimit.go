@@ -0,0 +1,145 @@
+package gateway
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/nexen/libs/store"
+	"google.golang.org/grpc/peer"
+)
+
+// rateLimitPrefix starts the keys of the rate-limit counters in the store.
+const rateLimitPrefix = "ratelimit:"
+
+// rateLimitError is the error of requests over the gateway's rate limit.
+type rateLimitError struct {
+	limit      int
+	period     time.Duration
+	retryAfter time.Duration
+}
+
+func (e *rateLimitError) Error() string {
+	return fmt.Sprintf("rate limit of %d requests per %v exceeded", e.limit, e.period)
+}
+
+// rateLimiter limits the requests of each caller to limit per period. Requests are counted in
+// fixed windows of the store, shared by every replica, and the count of a sliding window is
+// estimated from the current window and the part of the previous one it still overlaps.
+type rateLimiter struct {
+	store  store.Store
+	limit  int
+	period time.Duration
+
+	// now is replaceable in tests
+	now func() time.Time
+}
+
+// newRateLimiter returns the rate limiter of the gateway configuration, or nil when it sets
+// no limit.
+func newRateLimiter(st store.Store, limit int, period time.Duration) *rateLimiter {
+	if limit <= 0 || period <= 0 {
+		return nil
+	}
+	return &rateLimiter{store: st, limit: limit, period: period, now: time.Now}
+}
+
+// allow counts a request of caller, returning a *rateLimitError when it is over the limit.
+// Refused requests are not counted. Errors of the store are returned as they are.
+func (l *rateLimiter) allow(ctx context.Context, caller string) error {
+	now := l.now()
+	window := now.UnixNano() / int64(l.period)
+	key := func(window int64) string {
+		return rateLimitPrefix + caller + ":" + strconv.FormatInt(window, 10)
+	}
+
+	current, err := l.store.IncrBy(ctx, key(window), 1, 2*l.period)
+	if err != nil {
+		return err
+	}
+	var previous int64
+	data, err := l.store.Get(ctx, key(window-1))
+	switch {
+	case err == nil:
+		previous, _ = strconv.ParseInt(string(data), 10, 64)
+	case !errors.Is(err, store.ErrNotFound):
+		return err
+	}
+
+	elapsed := time.Duration(now.UnixNano() - window*int64(l.period))
+	overlap := 1 - float64(elapsed)/float64(l.period)
+	if float64(previous)*overlap+float64(current) <= float64(l.limit) {
+		return nil
+	}
+	if _, err := l.store.IncrBy(ctx, key(window), -1, 2*l.period); err != nil {
+		return err
+	}
+	return &rateLimitError{limit: l.limit, period: l.period, retryAfter: l.retryAfter(previous, current-1, elapsed)}
+}
+
+// retryAfter returns how long until a request would fit, given the counts of the previous and
+// current windows and the time elapsed in the current one.
+func (l *rateLimiter) retryAfter(previous, current int64, elapsed time.Duration) time.Duration {
+	period, limit := float64(l.period), float64(l.limit)
+	if float64(current) < limit {
+		// Once enough of the previous window has slid past
+		return time.Duration(period*(1-(limit-1-float64(current))/float64(previous))) - elapsed
+	}
+	// In the next window, once enough of this one has slid past
+	return l.period - elapsed + time.Duration(period*(1-(limit-1)/float64(current)))
+}
+
+// retryAfterSeconds rounds a retry delay up to whole seconds, of which there is at least one.
+func retryAfterSeconds(d time.Duration) int {
+	return int(math.Max(1, math.Ceil(d.Seconds())))
+}
+
+// caller returns the identity that the rate limit of a request made with ctx is counted
+// against: its API key or token subject, or else the client address remote.
+func caller(ctx context.Context, remote string) string {
+	if id, ok := callerFrom(ctx); ok {
+		return id
+	}
+	if host, _, err := net.SplitHostPort(remote); err == nil {
+		remote = host
+	}
+	return "addr:" + remote
+}
+
+// limitRate rejects the requests of callers over the rate limit, writing their error with
+// writeErr. The store being unavailable does not block requests.
+func (s *Server) limitRate(next http.HandlerFunc, writeErr func(http.ResponseWriter, int, errorBody)) http.HandlerFunc {
+	if s.rateLimiter == nil {
+		return next
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		var limited *rateLimitError
+		if err := s.rateLimiter.allow(r.Context(), caller(r.Context(), r.RemoteAddr)); errors.As(err, &limited) {
+			status, body := errorResponse(r.Context(), err)
+			writeErr(w, status, body)
+			return
+		}
+		next(w, r)
+	}
+}
+
+// limitRateRPC rejects the gRPC calls of callers over the rate limit.
+func (s *Server) limitRateRPC(ctx context.Context) error {
+	if s.rateLimiter == nil {
+		return nil
+	}
+	var remote string
+	if p, ok := peer.FromContext(ctx); ok {
+		remote = p.Addr.String()
+	}
+	var limited *rateLimitError
+	if err := s.rateLimiter.allow(ctx, caller(ctx, remote)); errors.As(err, &limited) {
+		return grpcError(ctx, err)
+	}
+	return nil
+}
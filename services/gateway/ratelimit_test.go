@@ -0,0 +1,66 @@
+package gateway
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nexen/config"
+	"github.com/nexen/libs/store"
+)
+
+func TestRateLimiterSlidingWindow(t *testing.T) {
+	l := newRateLimiter(store.NewMemory(), 2, time.Minute)
+	now := time.Unix(0, 0).Add(100 * time.Minute)
+	l.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	for i := 0; i < 2; i++ {
+		if err := l.allow(ctx, "search"); err != nil {
+			t.Fatalf("Request %d: allow() error = %v", i, err)
+		}
+	}
+	var limited *rateLimitError
+	// The full window must pass, then half of it in the next window
+	if err := l.allow(ctx, "search"); !errors.As(err, &limited) || limited.retryAfter != 90*time.Second {
+		t.Fatalf("Expected a rate limit error for 90s, got %v", err)
+	}
+	if err := l.allow(ctx, "other"); err != nil {
+		t.Errorf("Expected other callers to have their own limit, got %v", err)
+	}
+
+	// A quarter into the next window, three quarters of the previous one still count
+	now = now.Add(75 * time.Second)
+	if err := l.allow(ctx, "search"); !errors.As(err, &limited) || limited.retryAfter != 15*time.Second {
+		t.Errorf("Expected a rate limit error until half of the window, got %v", err)
+	}
+	now = now.Add(15 * time.Second)
+	if err := l.allow(ctx, "search"); err != nil {
+		t.Errorf("Expected the request to fit, refused ones not being counted, got %v", err)
+	}
+}
+
+func TestRateLimit(t *testing.T) {
+	s := testServer(config.GatewayConfig{RateLimitRequests: 1, RateLimitPeriod: time.Minute})
+	call := func(remote string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodPost, "/v1/llm/call", strings.NewReader(`{"model": "echo", "contents": [{"role": "user", "message": "Hi"}]}`))
+		r.RemoteAddr = remote
+		rec := httptest.NewRecorder()
+		s.Handler().ServeHTTP(rec, r)
+		return rec
+	}
+	if rec := call("192.0.2.1:1234"); rec.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d", rec.Code)
+	}
+	rec := call("192.0.2.1:5678")
+	if rec.Code != http.StatusTooManyRequests || rec.Header().Get("Retry-After") == "" || !strings.Contains(rec.Body.String(), codeRateLimited) {
+		t.Errorf("Expected 429 with Retry-After, got %d %v %s", rec.Code, rec.Header(), rec.Body)
+	}
+	if rec := call("192.0.2.2:1234"); rec.Code != http.StatusOK {
+		t.Errorf("Expected other addresses to have their own limit, got %d", rec.Code)
+	}
+}
@@ -0,0 +1,228 @@
+package gateway
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/nexen/libs/nexenctx"
+	"github.com/nexen/models"
+	"github.com/nexen/services/connectors"
+	"github.com/nexen/services/connectors/common"
+)
+
+// batchRequest is the body of POST /v1/llm/batch.
+type batchRequest struct {
+	Requests []*models.LLMRequest `json:"requests"`
+}
+
+// batchResult is the outcome of one request of a batch: its response, or its error.
+type batchResult struct {
+	Response *models.LLMResponse `json:"response,omitempty"`
+	Error    *errorBody          `json:"error,omitempty"`
+}
+
+// batchResponse is the response of POST /v1/llm/batch, with one result per request, in
+// request order.
+type batchResponse struct {
+	Results []batchResult `json:"results"`
+}
+
+// handleCall sends one request to its model.
+func (s *Server) handleCall(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, errorBody{Code: codeInvalidRequest, Message: "method not allowed"})
+		return
+	}
+	var request models.LLMRequest
+	if err := s.decode(w, r, &request, true); err != nil {
+		writeError(w, http.StatusBadRequest, errorBody{Code: codeInvalidRequest, Message: err.Error()})
+		return
+	}
+	if err := request.Validate(); err != nil {
+		writeError(w, http.StatusBadRequest, errorBody{Code: codeInvalidRequest, Message: err.Error()})
+		return
+	}
+
+	response, err := s.call(r.Context(), &request)
+	if err != nil {
+		status, body := errorResponse(r.Context(), err)
+		writeError(w, status, body)
+		return
+	}
+	writeJSON(w, http.StatusOK, response)
+}
+
+// handleStream sends one request to its model and streams its response as server-sent
+// events: a "partial" event with each models.LLMResponse holding the text generated since the
+// previous one, then a "response" event with the final response, including its usage. Models
+// whose client cannot stream send the final event only. Errors before the stream starts get
+// an error response; later ones end the stream with an "error" event. A client that goes away
+// cancels the call.
+func (s *Server) handleStream(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, errorBody{Code: codeInvalidRequest, Message: "method not allowed"})
+		return
+	}
+	var request models.LLMRequest
+	if err := s.decode(w, r, &request, true); err != nil {
+		writeError(w, http.StatusBadRequest, errorBody{Code: codeInvalidRequest, Message: err.Error()})
+		return
+	}
+	if err := request.Validate(); err != nil {
+		writeError(w, http.StatusBadRequest, errorBody{Code: codeInvalidRequest, Message: err.Error()})
+		return
+	}
+
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+	events := newSSEWriter(w, s.config.Gateway.StreamHeartbeat, cancel)
+	err := s.stream(ctx, &request, func(response *models.LLMResponse) error {
+		if response.IsPartial() {
+			return events.event("partial", response)
+		}
+		return events.event("response", response)
+	})
+	events.close()
+	if err != nil {
+		status, body := errorResponse(ctx, err)
+		if !events.isStarted() {
+			writeError(w, status, body)
+		} else {
+			events.event("error", map[string]errorBody{"error": body})
+		}
+	}
+}
+
+// handleBatch sends the requests of a batch to their models. A batch is rejected as a whole
+// when any request is invalid; once it is accepted, the result of every request is reported
+// with status 200, whether it succeeded or not.
+func (s *Server) handleBatch(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, errorBody{Code: codeInvalidRequest, Message: "method not allowed"})
+		return
+	}
+	var batch batchRequest
+	if err := s.decode(w, r, &batch, true); err != nil {
+		writeError(w, http.StatusBadRequest, errorBody{Code: codeInvalidRequest, Message: err.Error()})
+		return
+	}
+	if err := s.validateBatch(batch.Requests); err != nil {
+		writeError(w, http.StatusBadRequest, errorBody{Code: codeInvalidRequest, Message: err.Error()})
+		return
+	}
+
+	results := common.ExecuteBatch(withPriority(r.Context(), models.PriorityBatch), batch.Requests, s.opts.BatchConcurrency, s.call)
+	response := batchResponse{Results: make([]batchResult, len(results))}
+	for i, result := range results {
+		response.Results[i].Response = result.Response
+		if result.Err != nil {
+			_, body := errorResponse(r.Context(), result.Err)
+			response.Results[i].Error = &body
+		}
+	}
+	writeJSON(w, http.StatusOK, response)
+}
+
+// validateBatch checks the size of a batch and each of its requests.
+func (s *Server) validateBatch(requests []*models.LLMRequest) error {
+	if len(requests) == 0 {
+		return errors.New("batch has no requests")
+	}
+	if len(requests) > s.opts.MaxBatchSize {
+		return fmt.Errorf("batch has %d requests, more than %d", len(requests), s.opts.MaxBatchSize)
+	}
+	for i, request := range requests {
+		err := errors.New("request is null")
+		if request != nil {
+			err = request.Validate()
+		}
+		if err != nil {
+			return fmt.Errorf("requests[%d]: %w", i, err)
+		}
+	}
+	return nil
+}
+
+// call sends request with the client of its model.
+func (s *Server) call(ctx context.Context, request *models.LLMRequest) (*models.LLMResponse, error) {
+	llm, err := s.client(ctx, request)
+	if err != nil {
+		return nil, err
+	}
+	return llm.Call(withRequest(ctx, request), request)
+}
+
+// stream sends request with the client of its model, streaming its response with yield as
+// common.CallStream does.
+func (s *Server) stream(ctx context.Context, request *models.LLMRequest, yield func(*models.LLMResponse) error) error {
+	llm, err := s.client(ctx, request)
+	if err != nil {
+		return err
+	}
+	return common.CallStream(withRequest(ctx, request), llm, request, yield)
+}
+
+// withRequest returns ctx carrying the ID of request and the tenant it is attributed to, if
+// any, so that the feature flags, policies and request dumps of the connectors apply to them.
+// A request without an ID is given one, which its call log entries and audit record carry too.
+func withRequest(ctx context.Context, request *models.LLMRequest) context.Context {
+	if request.Metadata.RequestID == "" {
+		request.Metadata.RequestID = nexenctx.NewRequestID()
+	}
+	ctx = nexenctx.WithRequestID(ctx, request.Metadata.RequestID)
+	if request.Metadata.TenantID == "" {
+		return ctx
+	}
+	return nexenctx.WithTenant(ctx, request.Metadata.TenantID)
+}
+
+// client attributes request to the caller's tenant and sets its priority, which may change its
+// model, refuses the model when the model_access rules do not allow it for the tenant, then
+// returns the client of its model, limited by the quotas of the caller's API key, queued for
+// its provider and audited. Calls refused by the quotas or the queue are audited too.
+func (s *Server) client(ctx context.Context, request *models.LLMRequest) (common.LLM, error) {
+	attribute(ctx, request)
+	s.prioritize(ctx, request)
+	if err := connectors.CheckModelAccess(request.Model, request.Metadata.TenantID); err != nil {
+		return nil, err
+	}
+	llm, err := s.opts.Clients.Get(request.Model)
+	if err != nil {
+		return nil, err
+	}
+	if s.queues != nil {
+		llm = s.queues.wrap(request.Model, llm)
+	}
+	llm = s.limit(llm)
+	if s.audit != nil {
+		llm = s.audit(llm)
+	}
+	return llm, nil
+}
+
+// decode reads the JSON body of r into v, rejecting trailing data, bodies over the size limit
+// and, when strict, unknown fields.
+func (s *Server) decode(w http.ResponseWriter, r *http.Request, v any, strict bool) error {
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, s.opts.MaxBodyBytes))
+	if strict {
+		dec.DisallowUnknownFields()
+	}
+	if err := dec.Decode(v); err != nil {
+		return fmt.Errorf("invalid body: %w", err)
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return errors.New("invalid body: unexpected data after the JSON value")
+	}
+	return nil
+}
+
+// writeJSON writes v as a JSON response with the given status.
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,326 @@
+package gateway
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nexen/config"
+	"github.com/nexen/libs/nexenctx"
+	"github.com/nexen/models"
+	"github.com/nexen/services/connectors"
+	"github.com/nexen/services/connectors/common"
+)
+
+// stubLLM echoes the last message of a request, or fails with err, after delay.
+type stubLLM struct {
+	delay time.Duration
+	err   error
+}
+
+func (s *stubLLM) Call(ctx context.Context, request *models.LLMRequest) (*models.LLMResponse, error) {
+	select {
+	case <-time.After(s.delay):
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	if s.err != nil {
+		return nil, s.err
+	}
+	message := request.Contents[len(request.Contents)-1].Message
+	return &models.LLMResponse{Content: &models.Content{Role: "assistant", Message: message}}, nil
+}
+
+func (s *stubLLM) BatchCall(ctx context.Context, requests []*models.LLMRequest) ([]*models.LLMResponse, error) {
+	return common.BatchCall(ctx, requests, common.DefaultBatchConcurrency, s.Call)
+}
+
+func (s *stubLLM) SupportedModels() []string {
+	return nil
+}
+
+// streamingLLM streams the words of the last message.
+type streamingLLM struct{ stubLLM }
+
+func (s *streamingLLM) CallStream(ctx context.Context, request *models.LLMRequest, yield func(*models.LLMResponse) error) error {
+	message := request.Contents[len(request.Contents)-1].Message
+	partial := true
+	for _, word := range strings.SplitAfter(message, " ") {
+		if err := yield(&models.LLMResponse{Partial: &partial, Content: &models.Content{Role: "assistant", Message: word}}); err != nil {
+			return err
+		}
+	}
+	return yield(&models.LLMResponse{
+		Content: &models.Content{Role: "assistant", Message: message},
+		Usage:   models.UsageMetrics{PromptTokens: 5, CompletionTokens: 2, TotalTokens: 7},
+	})
+}
+
+// stubClients serves the clients of a fixed set of models.
+type stubClients map[string]connectors.LLM
+
+func (c stubClients) Get(model string) (connectors.LLM, error) {
+	if llm, ok := c[model]; ok {
+		return llm, nil
+	}
+	return nil, models.NewModelNotFoundError(model, []string{"echo"})
+}
+
+func testServer(gateway config.GatewayConfig) *Server {
+	gateway.EnableREST = true
+	return New(&config.Config{Gateway: gateway}, Options{Clients: stubClients{
+		"echo":      &stubLLM{},
+		"slow":      &stubLLM{delay: time.Second},
+		"streaming": &streamingLLM{},
+		"limited":   &stubLLM{err: &common.ProviderError{Provider: "test", StatusCode: 429, RetryAfter: 2 * time.Second, Class: common.ErrRateLimited}},
+		"text-only": &stubLLM{err: &models.UnsupportedCapabilityError{Model: "text-only", Missing: []string{models.CapabilityVision}}},
+	}})
+}
+
+func post(t *testing.T, s *Server, path, body string) (*httptest.ResponseRecorder, map[string]any) {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	s.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodPost, path, strings.NewReader(body)))
+	var decoded map[string]any
+	if err := json.Unmarshal(rec.Body.Bytes(), &decoded); err != nil {
+		t.Fatalf("Invalid response body %q: %v", rec.Body.String(), err)
+	}
+	return rec, decoded
+}
+
+func errorCode(body map[string]any) any {
+	e, _ := body["error"].(map[string]any)
+	return e["code"]
+}
+
+func TestCall(t *testing.T) {
+	s := testServer(config.GatewayConfig{})
+	rec, body := post(t, s, "/v1/llm/call", `{"model": "echo", "contents": [{"role": "user", "message": "Hello"}]}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %v", rec.Code, body)
+	}
+	if content := body["content"].(map[string]any); content["message"] != "Hello" {
+		t.Errorf("Unexpected response %v", body)
+	}
+}
+
+// requestIDLLM replies with the request ID of the ctx of the call and of the request.
+type requestIDLLM struct{ stubLLM }
+
+func (r *requestIDLLM) Call(ctx context.Context, request *models.LLMRequest) (*models.LLMResponse, error) {
+	id, _ := nexenctx.RequestIDFrom(ctx)
+	return &models.LLMResponse{Content: &models.Content{Role: "assistant", Message: id + " " + request.Metadata.RequestID}}, nil
+}
+
+func TestCallSetsRequestID(t *testing.T) {
+	s := testServer(config.GatewayConfig{})
+	s.opts.Clients.(stubClients)["ids"] = &requestIDLLM{}
+
+	_, body := post(t, s, "/v1/llm/call", `{"model": "ids", "contents": [{"role": "user", "message": "Hi"}], "metadata": {"requestId": "req-1"}}`)
+	if message := body["content"].(map[string]any)["message"]; message != "req-1 req-1" {
+		t.Errorf("Expected the request's own ID, got %q", message)
+	}
+
+	// Requests without an ID are given one
+	_, body = post(t, s, "/v1/llm/call", `{"model": "ids", "contents": [{"role": "user", "message": "Hi"}]}`)
+	ids := strings.Fields(body["content"].(map[string]any)["message"].(string))
+	if len(ids) != 2 || ids[0] != ids[1] {
+		t.Errorf("Expected a generated ID on the context and the request, got %q", ids)
+	}
+}
+
+func TestCallRejectsInvalidRequests(t *testing.T) {
+	s := testServer(config.GatewayConfig{})
+	testCases := []struct {
+		name, body string
+		status     int
+		code       string
+	}{
+		{"malformed", `{"model": `, http.StatusBadRequest, codeInvalidRequest},
+		{"unknown field", `{"model": "echo", "prompt": "Hi", "contents": [{"role": "user", "message": "Hi"}]}`, http.StatusBadRequest, codeInvalidRequest},
+		{"no contents", `{"model": "echo"}`, http.StatusBadRequest, codeInvalidRequest},
+		{"trailing data", `{"model": "echo", "contents": [{"role": "user", "message": "Hi"}]} {}`, http.StatusBadRequest, codeInvalidRequest},
+		{"unknown model", `{"model": "ecko", "contents": [{"role": "user", "message": "Hi"}]}`, http.StatusNotFound, codeModelNotFound},
+	}
+	for _, tc := range testCases {
+		rec, body := post(t, s, "/v1/llm/call", tc.body)
+		if rec.Code != tc.status || errorCode(body) != tc.code {
+			t.Errorf("%s: expected %d %s, got %d %v", tc.name, tc.status, tc.code, rec.Code, body)
+		}
+	}
+}
+
+func TestCallMapsProviderErrors(t *testing.T) {
+	s := testServer(config.GatewayConfig{})
+	rec, body := post(t, s, "/v1/llm/call", `{"model": "limited", "contents": [{"role": "user", "message": "Hi"}]}`)
+	if rec.Code != http.StatusTooManyRequests || errorCode(body) != codeRateLimited || rec.Header().Get("Retry-After") != "2" {
+		t.Errorf("Expected 429 with Retry-After, got %d %v %v", rec.Code, rec.Header(), body)
+	}
+	rec, body = post(t, s, "/v1/llm/call", `{"model": "text-only", "contents": [{"role": "user", "parts": [{"image": {"url": "https://example.com/cat.png"}}]}]}`)
+	if rec.Code != http.StatusBadRequest || errorCode(body) != codeCapabilityUnsupported {
+		t.Errorf("Expected 400 %s, got %d %v", codeCapabilityUnsupported, rec.Code, body)
+	}
+}
+
+func TestCallAppliesRouteTimeout(t *testing.T) {
+	s := testServer(config.GatewayConfig{
+		RequestTimeout: time.Minute,
+		RouteTimeouts:  map[string]time.Duration{"/v1/llm/call": 20 * time.Millisecond},
+	})
+	rec, body := post(t, s, "/v1/llm/call", `{"model": "slow", "contents": [{"role": "user", "message": "Hi"}]}`)
+	if rec.Code != http.StatusGatewayTimeout || errorCode(body) != codeTimeout {
+		t.Errorf("Expected 504, got %d %v", rec.Code, body)
+	}
+}
+
+// streamEvents returns the data of the events of a streamed response.
+func streamEvents(t *testing.T, rec *httptest.ResponseRecorder) []string {
+	t.Helper()
+	if ct := rec.Header().Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("Expected an event stream, got %q: %s", ct, rec.Body.String())
+	}
+	var events []string
+	scanner := bufio.NewScanner(rec.Body)
+	for scanner.Scan() {
+		if data, ok := strings.CutPrefix(scanner.Text(), "data: "); ok {
+			events = append(events, data)
+		}
+	}
+	return events
+}
+
+func TestStream(t *testing.T) {
+	s := testServer(config.GatewayConfig{})
+	rec := httptest.NewRecorder()
+	s.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/v1/llm/stream",
+		strings.NewReader(`{"model": "streaming", "contents": [{"role": "user", "message": "Hello there"}]}`)))
+	if !strings.Contains(rec.Body.String(), "event: partial\n") || !strings.Contains(rec.Body.String(), "event: response\n") {
+		t.Fatalf("Expected partial and response events, got %q", rec.Body.String())
+	}
+
+	events := streamEvents(t, rec)
+	var responses []models.LLMResponse
+	for _, event := range events {
+		var response models.LLMResponse
+		if err := json.Unmarshal([]byte(event), &response); err != nil {
+			t.Fatalf("Invalid event %q: %v", event, err)
+		}
+		responses = append(responses, response)
+	}
+	if len(responses) != 3 || responses[0].Content.Message != "Hello " || responses[1].Content.Message != "there" {
+		t.Fatalf("Expected two partial responses and a final one, got %v", events)
+	}
+	if final := responses[2]; final.IsPartial() || final.Content.Message != "Hello there" || final.Usage.TotalTokens != 7 {
+		t.Errorf("Expected the final response with its usage, got %+v", final)
+	}
+}
+
+func TestStreamErrors(t *testing.T) {
+	s := testServer(config.GatewayConfig{})
+	rec, body := post(t, s, "/v1/llm/stream", `{"model": "ecko", "contents": [{"role": "user", "message": "Hi"}]}`)
+	if rec.Code != http.StatusNotFound || errorCode(body) != codeModelNotFound {
+		t.Errorf("Expected an error response before the stream started, got %d %v", rec.Code, body)
+	}
+
+	// Once heartbeats have started the stream, errors are sent as events
+	s = testServer(config.GatewayConfig{
+		StreamHeartbeat: 10 * time.Millisecond,
+		RouteTimeouts:   map[string]time.Duration{"/v1/llm/stream": 50 * time.Millisecond},
+	})
+	rec = httptest.NewRecorder()
+	s.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/v1/llm/stream",
+		strings.NewReader(`{"model": "slow", "contents": [{"role": "user", "message": "Hi"}]}`)))
+	if !strings.Contains(rec.Body.String(), ": ping\n") || !strings.Contains(rec.Body.String(), "event: error\n") {
+		t.Fatalf("Expected heartbeats and an error event, got %q", rec.Body.String())
+	}
+	events := streamEvents(t, rec)
+	var errorEvent map[string]any
+	if err := json.Unmarshal([]byte(events[len(events)-1]), &errorEvent); err != nil || errorCode(errorEvent) != codeTimeout {
+		t.Errorf("Expected a timeout error event, got %v", events)
+	}
+}
+
+// blockingLLM streams one word, then waits for its call to be canceled.
+type blockingLLM struct {
+	stubLLM
+	canceled chan struct{}
+}
+
+func (b *blockingLLM) CallStream(ctx context.Context, request *models.LLMRequest, yield func(*models.LLMResponse) error) error {
+	partial := true
+	if err := yield(&models.LLMResponse{Partial: &partial, Content: &models.Content{Message: "Hello"}}); err != nil {
+		return err
+	}
+	<-ctx.Done()
+	close(b.canceled)
+	return ctx.Err()
+}
+
+func TestStreamCancelsOnDisconnect(t *testing.T) {
+	blocking := &blockingLLM{canceled: make(chan struct{})}
+	s := New(&config.Config{Gateway: config.GatewayConfig{EnableREST: true}}, Options{Clients: stubClients{"blocking": blocking}})
+	srv := httptest.NewServer(s.Handler())
+	defer srv.Close()
+
+	resp, err := http.Post(srv.URL+"/v1/llm/stream", "application/json",
+		strings.NewReader(`{"model": "blocking", "contents": [{"role": "user", "message": "Hi"}]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	line, err := bufio.NewReader(resp.Body).ReadString('\n')
+	if err != nil || line != "event: partial\n" {
+		t.Fatalf("Expected the first event, got %q %v", line, err)
+	}
+	resp.Body.Close()
+
+	select {
+	case <-blocking.canceled:
+	case <-time.After(5 * time.Second):
+		t.Error("Expected the call to be canceled when the client went away")
+	}
+}
+
+func TestBatch(t *testing.T) {
+	s := testServer(config.GatewayConfig{})
+	rec, body := post(t, s, "/v1/llm/batch", `{"requests": [
+		{"model": "echo", "contents": [{"role": "user", "message": "one"}]},
+		{"model": "limited", "contents": [{"role": "user", "message": "two"}]}
+	]}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %v", rec.Code, body)
+	}
+	results := body["results"].([]any)
+	first, second := results[0].(map[string]any), results[1].(map[string]any)
+	if first["response"].(map[string]any)["content"].(map[string]any)["message"] != "one" || first["error"] != nil {
+		t.Errorf("Unexpected first result %v", first)
+	}
+	if errorCode(second) != codeRateLimited || second["response"] != nil {
+		t.Errorf("Unexpected second result %v", second)
+	}
+}
+
+func TestBatchRejectsInvalidRequests(t *testing.T) {
+	s := testServer(config.GatewayConfig{})
+	rec, body := post(t, s, "/v1/llm/batch", `{"requests": [{"model": "echo", "contents": [{"role": "user", "message": "one"}]}, {"model": "echo"}]}`)
+	if rec.Code != http.StatusBadRequest || !strings.Contains(body["error"].(map[string]any)["message"].(string), "requests[1]") {
+		t.Errorf("Expected the invalid request to be reported, got %d %v", rec.Code, body)
+	}
+	rec, _ = post(t, s, "/v1/llm/batch", `{"requests": []}`)
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected an empty batch to be rejected, got %d", rec.Code)
+	}
+}
+
+func TestRESTDisabled(t *testing.T) {
+	s := New(&config.Config{}, Options{Clients: stubClients{}})
+	rec := httptest.NewRecorder()
+	s.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/v1/llm/call", strings.NewReader(`{}`)))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("Expected the REST API to be disabled, got %d", rec.Code)
+	}
+}
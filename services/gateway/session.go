@@ -0,0 +1,260 @@
+package gateway
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/nexen/models"
+	"github.com/nexen/services/connectors"
+)
+
+// sessionPath is the route of WebSocket sessions.
+const sessionPath = "/v1/llm/session"
+
+// Types of sessionMessage.
+const (
+	sessionSetup     = "setup"     // client: starts the session with Setup
+	sessionTurn      = "turn"      // client: sends Content and generates a response
+	sessionInterrupt = "interrupt" // client: stops the generation in progress
+	sessionReady     = "ready"     // server: the session is set up
+	sessionPartial   = "partial"   // server: part of the response in progress
+	sessionResponse  = "response"  // server: the final response of a turn
+	sessionError     = "error"     // server: a message or turn failed
+)
+
+// errInterrupted is the cause of the cancellation of interrupted turns.
+var errInterrupted = errors.New("turn interrupted")
+
+// sessionMessage is a message of a WebSocket session, in either direction.
+type sessionMessage struct {
+	Type string `json:"type"`
+
+	// Setup holds the model, config, live connection settings, metadata and any earlier
+	// contents of the session.
+	Setup *models.LLMRequest `json:"setup,omitempty"`
+
+	// Content is the content of a turn.
+	Content *models.Content `json:"content,omitempty"`
+
+	Response *models.LLMResponse `json:"response,omitempty"`
+	Error    *errorBody          `json:"error,omitempty"`
+}
+
+var upgrader = websocket.Upgrader{ReadBufferSize: 4096, WriteBufferSize: 4096}
+
+// handleSession serves an interactive session over a WebSocket. After a "setup" message, each
+// "turn" message adds its content to the conversation and streams the model's response as
+// "partial" messages and a final "response" message whose TurnComplete is set. An "interrupt"
+// message, or a new turn, stops the generation in progress; its response is then the text
+// generated so far, with Interrupted set.
+func (s *Server) handleSession(w http.ResponseWriter, r *http.Request) {
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return // Upgrade has replied
+	}
+	defer conn.Close()
+	conn.SetReadLimit(s.opts.MaxBodyBytes)
+
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+	sess := &session{s: s, conn: conn}
+	go sess.keepAlive(ctx, s.config.Gateway.StreamHeartbeat)
+	defer sess.interrupt()
+
+	for {
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			return // closed by the client
+		}
+		var msg sessionMessage
+		if err := json.Unmarshal(data, &msg); err != nil {
+			sess.fail(errorBody{Code: codeInvalidRequest, Message: "invalid message: " + err.Error()})
+			continue
+		}
+		switch msg.Type {
+		case sessionSetup:
+			sess.setup(ctx, msg.Setup)
+		case sessionTurn:
+			sess.turn(ctx, msg.Content)
+		case sessionInterrupt:
+			sess.interrupt()
+		default:
+			sess.fail(errorBody{Code: codeInvalidRequest, Message: "unknown message type " + msg.Type})
+		}
+	}
+}
+
+// session is the state of a WebSocket session. Its conversation is only changed by the turn
+// in progress, and read by the next one once it is done.
+type session struct {
+	s    *Server
+	conn *websocket.Conn
+
+	writeMu sync.Mutex
+
+	request *models.LLMRequest // nil until set up
+
+	cancel context.CancelCauseFunc // of the turn in progress
+	done   chan struct{}           // closed when the turn in progress ends
+}
+
+// setup starts the session with the settings of request, refusing models the caller's tenant
+// may not use.
+func (sess *session) setup(ctx context.Context, request *models.LLMRequest) {
+	switch {
+	case sess.request != nil:
+		sess.fail(errorBody{Code: codeInvalidRequest, Message: "session is already set up"})
+		return
+	case request == nil || request.Model == "":
+		sess.fail(errorBody{Code: codeInvalidRequest, Message: "setup requires a model"})
+		return
+	}
+	attribute(ctx, request)
+	err := connectors.CheckModelAccess(request.Model, request.Metadata.TenantID)
+	if err == nil {
+		_, err = sess.s.opts.Clients.Get(request.Model)
+	}
+	if err != nil {
+		_, body := errorResponse(ctx, err)
+		sess.fail(body)
+		return
+	}
+	sess.request = request
+	sess.send(sessionMessage{Type: sessionReady})
+}
+
+// turn adds content to the conversation and starts generating its response, interrupting
+// the turn in progress.
+func (sess *session) turn(ctx context.Context, content *models.Content) {
+	if sess.request == nil {
+		sess.fail(errorBody{Code: codeInvalidRequest, Message: "session is not set up"})
+		return
+	}
+	if content == nil {
+		sess.fail(errorBody{Code: codeInvalidRequest, Message: "turn requires content"})
+		return
+	}
+	sess.interrupt()
+
+	request := *sess.request
+	request.Contents = append(request.Contents[:len(request.Contents):len(request.Contents)], *content)
+	if err := request.Validate(); err != nil {
+		sess.fail(errorBody{Code: codeInvalidRequest, Message: err.Error()})
+		return
+	}
+
+	ctx, cancel := context.WithCancelCause(ctx)
+	if timeout := sess.turnTimeout(); timeout > 0 {
+		var cancelTimeout context.CancelFunc
+		ctx, cancelTimeout = context.WithTimeout(ctx, timeout)
+		cancel = chainCancel(cancel, cancelTimeout)
+	}
+	sess.cancel, sess.done = cancel, make(chan struct{})
+	go func() {
+		defer close(sess.done)
+		defer cancel(nil)
+		sess.generate(ctx, &request)
+	}()
+}
+
+// generate streams the response of request, and adds it to the conversation unless the turn
+// failed.
+func (sess *session) generate(ctx context.Context, request *models.LLMRequest) {
+	var text strings.Builder
+	var final *models.LLMResponse
+	err := sess.s.stream(ctx, request, func(response *models.LLMResponse) error {
+		if !response.IsPartial() {
+			final = response
+			return nil
+		}
+		text.WriteString(responseText(response))
+		if request.LiveConnect.EnableStreaming {
+			return sess.send(sessionMessage{Type: sessionPartial, Response: response})
+		}
+		return nil
+	})
+	if err != nil && errors.Is(context.Cause(ctx), errInterrupted) {
+		interrupted := true
+		final, err = &models.LLMResponse{Content: &models.Content{Role: "assistant", Message: text.String()}, Interrupted: &interrupted}, nil
+	}
+	if err != nil {
+		_, body := errorResponse(ctx, err)
+		sess.fail(body)
+		return
+	}
+
+	complete := true
+	final.TurnComplete = &complete
+	sess.request.Contents = request.Contents
+	if final.Content != nil {
+		sess.request.Contents = append(sess.request.Contents, *final.Content)
+	}
+	sess.send(sessionMessage{Type: sessionResponse, Response: final})
+}
+
+// turnTimeout returns the timeout of a turn: the session's stream timeout, or the timeout of
+// the session route.
+func (sess *session) turnTimeout() time.Duration {
+	if seconds := sess.request.LiveConnect.StreamTimeout; seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	return sess.s.config.Gateway.TimeoutFor(sessionPath)
+}
+
+// interrupt stops the turn in progress, if any, and waits for its response to be sent.
+func (sess *session) interrupt() {
+	if sess.cancel == nil {
+		return
+	}
+	sess.cancel(errInterrupted)
+	<-sess.done
+	sess.cancel, sess.done = nil, nil
+}
+
+// keepAlive pings the client every interval, when positive, until ctx is done.
+func (sess *session) keepAlive(ctx context.Context, interval time.Duration) {
+	if interval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := sess.conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(writeGrace)); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// fail sends an error message.
+func (sess *session) fail(body errorBody) {
+	sess.send(sessionMessage{Type: sessionError, Error: &body})
+}
+
+// send writes msg to the client.
+func (sess *session) send(msg sessionMessage) error {
+	sess.writeMu.Lock()
+	defer sess.writeMu.Unlock()
+	sess.conn.SetWriteDeadline(time.Now().Add(writeGrace))
+	return sess.conn.WriteJSON(msg)
+}
+
+// chainCancel returns a CancelCauseFunc calling cancel, then each of others.
+func chainCancel(cancel context.CancelCauseFunc, others ...context.CancelFunc) context.CancelCauseFunc {
+	return func(cause error) {
+		cancel(cause)
+		for _, other := range others {
+			other()
+		}
+	}
+}
@@ -0,0 +1,119 @@
+package gateway
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/nexen/config"
+	"github.com/nexen/models"
+)
+
+// dialSession opens a session with a test server serving clients.
+func dialSession(t *testing.T, clients stubClients) *websocket.Conn {
+	t.Helper()
+	s := New(&config.Config{Gateway: config.GatewayConfig{EnableREST: true}}, Options{Clients: clients})
+	srv := httptest.NewServer(s.Handler())
+	t.Cleanup(srv.Close)
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http")+sessionPath, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	return conn
+}
+
+func sendMessage(t *testing.T, conn *websocket.Conn, msg sessionMessage) {
+	t.Helper()
+	if err := conn.WriteJSON(msg); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func receive(t *testing.T, conn *websocket.Conn) sessionMessage {
+	t.Helper()
+	var msg sessionMessage
+	if err := conn.ReadJSON(&msg); err != nil {
+		t.Fatal(err)
+	}
+	return msg
+}
+
+func setUp(t *testing.T, conn *websocket.Conn, model string) {
+	t.Helper()
+	sendMessage(t, conn, sessionMessage{Type: sessionSetup, Setup: &models.LLMRequest{
+		Model:       model,
+		LiveConnect: models.LiveConnectConfig{EnableStreaming: true},
+	}})
+	if msg := receive(t, conn); msg.Type != sessionReady {
+		t.Fatalf("Expected the session to be ready, got %+v", msg)
+	}
+}
+
+func TestSessionStreamsTurns(t *testing.T) {
+	conn := dialSession(t, stubClients{"streaming": &streamingLLM{}})
+	setUp(t, conn, "streaming")
+
+	for _, message := range []string{"Hello there", "Good bye"} {
+		sendMessage(t, conn, sessionMessage{Type: sessionTurn, Content: &models.Content{Role: "user", Message: message}})
+		var text strings.Builder
+		for {
+			msg := receive(t, conn)
+			if msg.Type == sessionPartial {
+				text.WriteString(msg.Response.Content.Message)
+				continue
+			}
+			if msg.Type != sessionResponse || msg.Response.TurnComplete == nil || !*msg.Response.TurnComplete {
+				t.Fatalf("Expected the final response, got %+v", msg)
+			}
+			if msg.Response.Content.Message != message || text.String() != message {
+				t.Errorf("Expected %q streamed and final, got %q and %q", message, text.String(), msg.Response.Content.Message)
+			}
+			break
+		}
+	}
+}
+
+func TestSessionInterrupt(t *testing.T) {
+	conn := dialSession(t, stubClients{"blocking": &blockingLLM{canceled: make(chan struct{})}})
+	setUp(t, conn, "blocking")
+
+	sendMessage(t, conn, sessionMessage{Type: sessionTurn, Content: &models.Content{Role: "user", Message: "Hi"}})
+	if msg := receive(t, conn); msg.Type != sessionPartial {
+		t.Fatalf("Expected a partial response, got %+v", msg)
+	}
+	sendMessage(t, conn, sessionMessage{Type: sessionInterrupt})
+	msg := receive(t, conn)
+	if msg.Type != sessionResponse || msg.Response.Interrupted == nil || !*msg.Response.Interrupted || msg.Response.Content.Message != "Hello" {
+		t.Errorf("Expected an interrupted response with the text so far, got %+v", msg.Response)
+	}
+}
+
+func TestSessionErrors(t *testing.T) {
+	conn := dialSession(t, stubClients{"echo": &stubLLM{}})
+	testCases := []struct {
+		name string
+		msg  sessionMessage
+		code string
+	}{
+		{"turn before setup", sessionMessage{Type: sessionTurn, Content: &models.Content{Role: "user", Message: "Hi"}}, codeInvalidRequest},
+		{"unknown model", sessionMessage{Type: sessionSetup, Setup: &models.LLMRequest{Model: "ecko"}}, codeModelNotFound},
+		{"unknown type", sessionMessage{Type: "hello"}, codeInvalidRequest},
+	}
+	for _, tc := range testCases {
+		sendMessage(t, conn, tc.msg)
+		if msg := receive(t, conn); msg.Type != sessionError || msg.Error.Code != tc.code {
+			t.Errorf("%s: expected a %s error, got %+v", tc.name, tc.code, msg)
+		}
+	}
+
+	// The session survives its errors
+	setUp(t, conn, "echo")
+	sendMessage(t, conn, sessionMessage{Type: sessionTurn, Content: &models.Content{Role: "user", Message: "Hi"}})
+	if msg := receive(t, conn); msg.Type != sessionResponse || msg.Response.Content.Message != "Hi" {
+		t.Errorf("Expected the echoed response, got %+v", msg)
+	}
+}
@@ -0,0 +1,112 @@
+package gateway
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// sseWriter writes server-sent events to a response, flushing each one. The response starts
+// with the first event or heartbeat, so that errors before it can still get an error
+// response.
+type sseWriter struct {
+	w      http.ResponseWriter
+	rc     *http.ResponseController
+	cancel context.CancelFunc
+
+	mu      sync.Mutex
+	started bool
+
+	stop    chan struct{}
+	stopped chan struct{}
+}
+
+// newSSEWriter returns an sseWriter for w that sends a keep-alive comment every heartbeat,
+// when positive, until close is called. cancel is called when a write fails, since the client
+// is gone.
+func newSSEWriter(w http.ResponseWriter, heartbeat time.Duration, cancel context.CancelFunc) *sseWriter {
+	e := &sseWriter{
+		w:       w,
+		rc:      http.NewResponseController(w),
+		cancel:  cancel,
+		stop:    make(chan struct{}),
+		stopped: make(chan struct{}),
+	}
+	go e.heartbeat(heartbeat)
+	return e
+}
+
+func (e *sseWriter) heartbeat(interval time.Duration) {
+	defer close(e.stopped)
+	if interval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-e.stop:
+			return
+		case <-ticker.C:
+			e.write(": ping\n\n")
+		}
+	}
+}
+
+// close stops the heartbeats. Events can still be written.
+func (e *sseWriter) close() {
+	close(e.stop)
+	<-e.stopped
+}
+
+// isStarted reports whether the event stream response has started.
+func (e *sseWriter) isStarted() bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.started
+}
+
+// data sends v as the JSON data of an unnamed event.
+func (e *sseWriter) data(v any) error {
+	return e.event("", v)
+}
+
+// event sends v as the JSON data of an event named name.
+func (e *sseWriter) event(name string, v any) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	if name == "" {
+		return e.write("data: %s\n\n", data)
+	}
+	return e.write("event: %s\ndata: %s\n\n", name, data)
+}
+
+// done sends the "[DONE]" event that ends OpenAI streams.
+func (e *sseWriter) done() error {
+	return e.write("data: [DONE]\n\n")
+}
+
+func (e *sseWriter) write(format string, args ...any) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if !e.started {
+		e.w.Header().Set("Content-Type", "text/event-stream")
+		e.w.Header().Set("Cache-Control", "no-cache")
+		e.w.Header().Set("X-Accel-Buffering", "no") // Keep proxies from buffering the stream
+		e.w.WriteHeader(http.StatusOK)
+		e.started = true
+	}
+	_, err := fmt.Fprintf(e.w, format, args...)
+	if err == nil {
+		err = e.rc.Flush()
+	}
+	if err != nil {
+		e.cancel()
+	}
+	return err
+}
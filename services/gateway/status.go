@@ -0,0 +1,168 @@
+package gateway
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/nexen/libs/store"
+	"github.com/nexen/models"
+	"github.com/nexen/services/connectors"
+)
+
+// Routes of the health and status endpoints.
+const (
+	healthzPath        = "/healthz"
+	readyzPath         = "/readyz"
+	providerStatusPath = "/status/providers"
+)
+
+// pingTimeout bounds the ping of each provider by GET /status/providers.
+const pingTimeout = 5 * time.Second
+
+// readinessProbeKey is the key read to check that the store can be reached.
+const readinessProbeKey = "readyz"
+
+// readiness is the body of GET /readyz: its status and the result of each check, "ok" or the
+// error.
+type readiness struct {
+	Status string            `json:"status"`
+	Checks map[string]string `json:"checks"`
+}
+
+// providerStatus is an item of GET /status/providers.
+type providerStatus struct {
+	Provider string `json:"provider"`
+
+	// Status is "reachable", "unreachable", or "unknown" when its connector cannot be pinged.
+	Status    string  `json:"status"`
+	Error     string  `json:"error,omitempty"`
+	LatencyMs float64 `json:"latencyMs"`
+
+	// Models is the number of the provider's models in the registry.
+	Models int `json:"models"`
+
+	// Circuits holds the circuit-breaker state of each of the provider's models that has
+	// served traffic.
+	Circuits map[string]connectors.CircuitState `json:"circuits,omitempty"`
+}
+
+// registryCounts are the sizes of the model registries, under "registry" in GET
+// /status/providers.
+type registryCounts struct {
+	Models            int `json:"models"`
+	ModelPatterns     int `json:"modelPatterns"`
+	ConnectorPatterns int `json:"connectorPatterns"`
+	Aliases           int `json:"aliases"`
+}
+
+// statusReport is the body of GET /status/providers.
+type statusReport struct {
+	Providers []providerStatus `json:"providers"`
+	Registry  registryCounts   `json:"registry"`
+}
+
+// handleHealthz answers liveness probes: the process is up and serving.
+func (s *Server) handleHealthz(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, errorBody{Code: codeInvalidRequest, Message: "method not allowed"})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
+
+// handleReadyz answers readiness probes: the store holding rate limits and keys can be
+// reached. Not-ready replicas get a 503.
+func (s *Server) handleReadyz(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, errorBody{Code: codeInvalidRequest, Message: "method not allowed"})
+		return
+	}
+	report := readiness{Status: "ready", Checks: map[string]string{"store": "ok"}}
+	if _, err := s.opts.Store.Get(r.Context(), readinessProbeKey); err != nil && !errors.Is(err, store.ErrNotFound) {
+		report.Status, report.Checks["store"] = "not_ready", err.Error()
+	}
+	status := http.StatusOK
+	if report.Status != "ready" {
+		status = http.StatusServiceUnavailable
+	}
+	writeJSON(w, status, report)
+}
+
+// handleProviderStatus reports, for dashboards, whether each provider of the registry can be
+// reached, the circuit-breaker states of its models, and the sizes of the registries. The
+// providers are pinged at once, each for at most pingTimeout.
+func (s *Server) handleProviderStatus(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, errorBody{Code: codeInvalidRequest, Message: "method not allowed"})
+		return
+	}
+	infos := models.ListModelInfos()
+	byProvider := make(map[string]*providerStatus)
+	for _, info := range infos {
+		p, ok := byProvider[info.Provider]
+		if !ok {
+			p = &providerStatus{Provider: info.Provider}
+			byProvider[info.Provider] = p
+		}
+		p.Models++
+	}
+	for _, stats := range s.opts.Health.ListStats() {
+		info, err := models.Resolve(stats.Model)
+		if err != nil {
+			continue
+		}
+		if p, ok := byProvider[info.Provider]; ok {
+			if p.Circuits == nil {
+				p.Circuits = make(map[string]connectors.CircuitState)
+			}
+			p.Circuits[stats.Model] = stats.Circuit
+		}
+	}
+
+	var wg sync.WaitGroup
+	for _, p := range byProvider {
+		wg.Add(1)
+		go func(p *providerStatus) {
+			defer wg.Done()
+			s.ping(r.Context(), p)
+		}(p)
+	}
+	wg.Wait()
+
+	report := statusReport{
+		Providers: make([]providerStatus, 0, len(byProvider)),
+		Registry: registryCounts{
+			Models:            len(infos),
+			ModelPatterns:     len(models.ListModels()),
+			ConnectorPatterns: len(connectors.ListModelPatterns()),
+			Aliases:           len(models.ListAliases()),
+		},
+	}
+	for _, p := range byProvider {
+		report.Providers = append(report.Providers, *p)
+	}
+	sort.Slice(report.Providers, func(i, j int) bool { return report.Providers[i].Provider < report.Providers[j].Provider })
+	writeJSON(w, http.StatusOK, report)
+}
+
+// ping sets the reachability of p, and records it for routing.
+func (s *Server) ping(ctx context.Context, p *providerStatus) {
+	ctx, cancel := context.WithTimeout(ctx, pingTimeout)
+	defer cancel()
+	start := time.Now()
+	err := connectors.PingProvider(ctx, p.Provider)
+	p.LatencyMs = float64(time.Since(start)) / float64(time.Millisecond)
+	s.opts.Health.ObservePing(p.Provider, err)
+	switch {
+	case err == nil:
+		p.Status = "reachable"
+	case errors.Is(err, connectors.ErrPingNotSupported):
+		p.Status = "unknown"
+	default:
+		p.Status, p.Error = "unreachable", err.Error()
+	}
+}
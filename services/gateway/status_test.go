@@ -0,0 +1,103 @@
+package gateway
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nexen/config"
+	"github.com/nexen/libs/store"
+	"github.com/nexen/models"
+	"github.com/nexen/services/connectors"
+	"github.com/nexen/services/connectors/common"
+)
+
+// pingLLM is a stubLLM whose provider answers pings with err.
+type pingLLM struct {
+	stubLLM
+	err error
+}
+
+func (p *pingLLM) Ping(ctx context.Context) error {
+	return p.err
+}
+
+// downStore is a store that cannot be reached.
+type downStore struct{ store.Store }
+
+func (downStore) Get(ctx context.Context, key string) ([]byte, error) {
+	return nil, errors.New("connection refused")
+}
+
+func TestHealthAndReadiness(t *testing.T) {
+	s := testServer(config.GatewayConfig{})
+	if rec, body := send(t, s, http.MethodGet, "/healthz", "", ""); rec.Code != http.StatusOK || body["status"] != "ok" {
+		t.Errorf("Expected the gateway to be live, got %d %v", rec.Code, body)
+	}
+	if rec, body := send(t, s, http.MethodGet, "/readyz", "", ""); rec.Code != http.StatusOK || body["status"] != "ready" {
+		t.Errorf("Expected the gateway to be ready, got %d %v", rec.Code, body)
+	}
+
+	down := New(&config.Config{Gateway: config.GatewayConfig{EnableREST: true}}, Options{Store: downStore{}})
+	rec, body := send(t, down, http.MethodGet, "/readyz", "", "")
+	checks, _ := body["checks"].(map[string]any)
+	if rec.Code != http.StatusServiceUnavailable || body["status"] != "not_ready" || checks["store"] != "connection refused" {
+		t.Errorf("Expected the gateway not to be ready without its store, got %d %v", rec.Code, body)
+	}
+}
+
+func TestProviderStatus(t *testing.T) {
+	clients := map[string]common.LLM{
+		"statusup-large":  &pingLLM{},
+		"statusup-small":  &pingLLM{},
+		"statusdown-chat": &pingLLM{err: errors.New("invalid API key")},
+	}
+	for id, llm := range clients {
+		llm := llm
+		provider, _, _ := strings.Cut(id, "-")
+		if err := models.Register("^"+id+"$", models.ModelInfo{ID: id, Provider: provider}); err != nil {
+			t.Fatal(err)
+		}
+		connectors.Register("^"+id+"$", func(model string, opts ...common.Option) (common.LLM, error) {
+			return llm, nil
+		})
+	}
+	health := connectors.NewHealthTracker(connectors.HealthOptions{MinSamples: 1, RecoveryAfter: time.Hour})
+	health.Observe("statusup-large", time.Second, nil)
+	health.Observe("statusup-small", time.Second, &common.ProviderError{Provider: "statusup", StatusCode: 503, Class: common.ErrProviderUnavailable})
+
+	s := New(&config.Config{Gateway: config.GatewayConfig{EnableREST: true}}, Options{Health: health})
+	var report statusReport
+	rec, _ := send(t, s, http.MethodGet, "/status/providers", "", "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d %s", rec.Code, rec.Body)
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &report); err != nil {
+		t.Fatal(err)
+	}
+
+	byProvider := make(map[string]providerStatus)
+	for _, p := range report.Providers {
+		byProvider[p.Provider] = p
+	}
+	up := byProvider["statusup"]
+	if up.Status != "reachable" || up.Models != 2 {
+		t.Errorf("Expected a reachable provider with 2 models, got %+v", up)
+	}
+	if up.Circuits["statusup-large"] != connectors.CircuitClosed || up.Circuits["statusup-small"] != connectors.CircuitOpen {
+		t.Errorf("Expected the circuit states of the provider's models, got %v", up.Circuits)
+	}
+	if down := byProvider["statusdown"]; down.Status != "unreachable" || down.Error == "" {
+		t.Errorf("Expected an unreachable provider with its error, got %+v", down)
+	}
+	if health.Healthy("statusdown-chat") || !health.Healthy("statusup-large") {
+		t.Error("Expected the pings to be recorded for routing")
+	}
+	if report.Registry.Models < 3 || report.Registry.ConnectorPatterns < 3 {
+		t.Errorf("Expected the registry counts to include the test models, got %+v", report.Registry)
+	}
+}
@@ -0,0 +1,33 @@
+package gateway
+
+import (
+	"context"
+
+	"github.com/nexen/config"
+	"github.com/nexen/models"
+	"github.com/nexen/services/connectors/common"
+	"github.com/nexen/services/gateway/worker"
+)
+
+// newWorker returns the worker of the message queues of Options.Requests and Options.Replies,
+// or nil when it is disabled or either is missing.
+func (s *Server) newWorker(cfg config.WorkerConfig) *worker.Worker {
+	if !cfg.Enabled || s.opts.Requests == nil || s.opts.Replies == nil {
+		return nil
+	}
+	return worker.New(s.opts.Requests, s.opts.Replies, s.runMessage, worker.Options{
+		Concurrency: cfg.Concurrency,
+		RateLimit:   common.RateLimit{RequestsPerMinute: cfg.RequestsPerMinute, TokensPerMinute: cfg.TokensPerMinute},
+		Timeout:     cfg.Timeout,
+		ErrorCode: func(ctx context.Context, err error) string {
+			_, body := errorResponse(ctx, err)
+			return body.Code
+		},
+	})
+}
+
+// runMessage calls the request of a message of the worker, of priority batch unless it sets
+// its own. It is attributed by its metadata only, and held to the default key policy.
+func (s *Server) runMessage(ctx context.Context, request *models.LLMRequest) (*models.LLMResponse, error) {
+	return s.call(withPriority(ctx, models.PriorityBatch), request)
+}
@@ -0,0 +1,136 @@
+// Package kafkaqueue provides a worker.Source consuming requests from a Kafka topic and a
+// worker.Sink producing replies to one. It is a package of its own so that only the binaries
+// using it depend on a Kafka client.
+package kafkaqueue
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/nexen/services/gateway/worker"
+	"github.com/segmentio/kafka-go"
+)
+
+// batchTimeout bounds how long a reply waits for others to be produced with, since Publish
+// blocks until its reply is acknowledged.
+const batchTimeout = 10 * time.Millisecond
+
+// fetched is a message received from a partition, and whether it was acknowledged.
+type fetched struct {
+	msg  kafka.Message
+	done bool
+}
+
+// Source consumes requests from a Kafka topic as a member of a consumer group, each message
+// holding the JSON of a request. Since the offsets of a partition are committed in order, a
+// message is committed once it and every message received before it from its partition are
+// acknowledged; those that are not are delivered again after a restart or a rebalance.
+type Source struct {
+	reader *kafka.Reader
+
+	mu       sync.Mutex
+	received map[string]*fetched // message ID -> message
+	pending  map[int][]*fetched  // partition -> messages not committed yet, in offset order
+}
+
+// NewSource returns a Source consuming topic on brokers in group.
+func NewSource(brokers []string, topic, group string) *Source {
+	return &Source{
+		reader: kafka.NewReader(kafka.ReaderConfig{
+			Brokers: brokers,
+			Topic:   topic,
+			GroupID: group,
+		}),
+		received: make(map[string]*fetched),
+		pending:  make(map[int][]*fetched),
+	}
+}
+
+// Receive implements worker.Source. It returns one message at a time.
+func (s *Source) Receive(ctx context.Context, max int) ([]worker.Message, error) {
+	msg, err := s.reader.FetchMessage(ctx)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, fmt.Errorf("worker: fetching from %s: %w", s.reader.Config().Topic, err)
+	}
+	id := strconv.Itoa(msg.Partition) + ":" + strconv.FormatInt(msg.Offset, 10)
+	f := &fetched{msg: msg}
+	s.mu.Lock()
+	s.received[id] = f
+	s.pending[msg.Partition] = append(s.pending[msg.Partition], f)
+	s.mu.Unlock()
+	return []worker.Message{{ID: id, Body: msg.Value}}, nil
+}
+
+// Ack implements worker.Source. It commits the messages of the partition of msg that are
+// acknowledged, in order, up to the first that is not.
+func (s *Source) Ack(ctx context.Context, msg worker.Message) error {
+	s.mu.Lock()
+	f, ok := s.received[msg.ID]
+	if !ok {
+		s.mu.Unlock()
+		return fmt.Errorf("worker: message %s was not received", msg.ID)
+	}
+	f.done = true
+	delete(s.received, msg.ID)
+	partition := s.pending[f.msg.Partition]
+	var last *fetched
+	for len(partition) > 0 && partition[0].done {
+		last, partition = partition[0], partition[1:]
+	}
+	s.pending[f.msg.Partition] = partition
+	s.mu.Unlock()
+
+	if last == nil {
+		return nil
+	}
+	if err := s.reader.CommitMessages(ctx, last.msg); err != nil {
+		return fmt.Errorf("worker: committing %s: %w", msg.ID, err)
+	}
+	return nil
+}
+
+// Close implements worker.Source.
+func (s *Source) Close() error {
+	return s.reader.Close()
+}
+
+// Sink produces replies to a Kafka topic as JSON, keyed by request ID.
+type Sink struct {
+	writer *kafka.Writer
+}
+
+// NewSink returns a Sink producing to topic on brokers. Each reply is acknowledged by every
+// in-sync replica before Publish returns.
+func NewSink(brokers []string, topic string) *Sink {
+	return &Sink{writer: &kafka.Writer{
+		Addr:         kafka.TCP(brokers...),
+		Topic:        topic,
+		Balancer:     &kafka.Hash{},
+		RequiredAcks: kafka.RequireAll,
+		BatchTimeout: batchTimeout,
+	}}
+}
+
+// Publish implements worker.Sink.
+func (s *Sink) Publish(ctx context.Context, reply worker.Reply) error {
+	data, err := json.Marshal(reply)
+	if err != nil {
+		return err
+	}
+	if err := s.writer.WriteMessages(ctx, kafka.Message{Key: []byte(reply.RequestID), Value: data, Time: reply.Time}); err != nil {
+		return fmt.Errorf("worker: producing to %s: %w", s.writer.Topic, err)
+	}
+	return nil
+}
+
+// Close implements worker.Sink.
+func (s *Sink) Close() error {
+	return s.writer.Close()
+}
@@ -0,0 +1,164 @@
+package worker
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// redisBlock is how long RedisSource.Receive waits for new messages.
+const redisBlock = 5 * time.Second
+
+// streamReader is the commands of the Redis client RedisSource uses.
+type streamReader interface {
+	XGroupCreateMkStream(ctx context.Context, stream, group, start string) *redis.StatusCmd
+	XAutoClaim(ctx context.Context, a *redis.XAutoClaimArgs) *redis.XAutoClaimCmd
+	XReadGroup(ctx context.Context, a *redis.XReadGroupArgs) *redis.XStreamSliceCmd
+	XAck(ctx context.Context, stream, group string, ids ...string) *redis.IntCmd
+}
+
+// RedisSource reads requests from a Redis stream as a consumer of a consumer group, so that
+// the replicas of a worker share them. Each entry holds the JSON of a request in its
+// "request" field:
+//
+//	XADD nexen-requests * request '{"model": "gpt-4o-mini", "contents": [...]}'
+//
+// Entries left unacknowledged by a consumer for longer than the claim idle time, because it
+// stopped, are taken over by the next consumer that receives.
+type RedisSource struct {
+	client    streamReader
+	stream    string
+	group     string
+	consumer  string
+	claimIdle time.Duration
+	block     time.Duration
+
+	mu        sync.Mutex
+	created   bool   // whether the group is known to exist
+	claimFrom string // the ID the next claim starts from
+}
+
+// NewRedisSource returns a RedisSource reading stream with client as consumer of group,
+// creating the stream and the group when they do not exist. Close does not close the client.
+func NewRedisSource(client redis.Cmdable, stream, group, consumer string, claimIdle time.Duration) *RedisSource {
+	return &RedisSource{client: client, stream: stream, group: group, consumer: consumer, claimIdle: claimIdle, block: redisBlock, claimFrom: "0-0"}
+}
+
+// Receive implements Source. It returns the entries of stopped consumers first, then waits for
+// new ones.
+func (s *RedisSource) Receive(ctx context.Context, max int) ([]Message, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.created {
+		err := s.client.XGroupCreateMkStream(ctx, s.stream, s.group, "0").Err()
+		if err != nil && !strings.HasPrefix(err.Error(), "BUSYGROUP") {
+			return nil, fmt.Errorf("worker: creating group %s of %s: %w", s.group, s.stream, err)
+		}
+		s.created = true
+	}
+
+	claimed, next, err := s.client.XAutoClaim(ctx, &redis.XAutoClaimArgs{
+		Stream: s.stream, Group: s.group, Consumer: s.consumer, MinIdle: s.claimIdle, Start: s.claimFrom, Count: int64(max),
+	}).Result()
+	if err != nil {
+		return nil, s.fail(ctx, err)
+	}
+	s.claimFrom = next
+	if len(claimed) > 0 {
+		return messages(claimed), nil
+	}
+
+	streams, err := s.client.XReadGroup(ctx, &redis.XReadGroupArgs{
+		Group: s.group, Consumer: s.consumer, Streams: []string{s.stream, ">"}, Count: int64(max), Block: s.block,
+	}).Result()
+	if errors.Is(err, redis.Nil) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, s.fail(ctx, err)
+	}
+	var msgs []Message
+	for _, stream := range streams {
+		msgs = append(msgs, messages(stream.Messages)...)
+	}
+	return msgs, nil
+}
+
+// fail returns the error of a read of the stream, or ctx's error once ctx is done. The group
+// is created again after errors, in case the stream was deleted.
+func (s *RedisSource) fail(ctx context.Context, err error) error {
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	s.created = false
+	return fmt.Errorf("worker: reading %s: %w", s.stream, err)
+}
+
+// messages returns the messages of the entries of a stream.
+func messages(entries []redis.XMessage) []Message {
+	msgs := make([]Message, len(entries))
+	for i, entry := range entries {
+		body, _ := entry.Values["request"].(string)
+		msgs[i] = Message{ID: entry.ID, Body: []byte(body)}
+	}
+	return msgs
+}
+
+// Ack implements Source.
+func (s *RedisSource) Ack(ctx context.Context, msg Message) error {
+	if err := s.client.XAck(ctx, s.stream, s.group, msg.ID).Err(); err != nil {
+		return fmt.Errorf("worker: acknowledging %s of %s: %w", msg.ID, s.stream, err)
+	}
+	return nil
+}
+
+// Close implements Source.
+func (s *RedisSource) Close() error {
+	return nil
+}
+
+// streamAdder is the command of the Redis client RedisSink uses.
+type streamAdder interface {
+	XAdd(ctx context.Context, a *redis.XAddArgs) *redis.StringCmd
+}
+
+// RedisSink adds replies to a Redis stream, each as the JSON of its "reply" field.
+type RedisSink struct {
+	client streamAdder
+	stream string
+	maxLen int64
+}
+
+// NewRedisSink returns a RedisSink adding replies to stream with client. A positive maxLen
+// trims the stream to about that many replies; zero keeps every reply. Close does not close
+// the client.
+func NewRedisSink(client redis.Cmdable, stream string, maxLen int64) *RedisSink {
+	return &RedisSink{client: client, stream: stream, maxLen: maxLen}
+}
+
+// Publish implements Sink.
+func (s *RedisSink) Publish(ctx context.Context, reply Reply) error {
+	data, err := json.Marshal(reply)
+	if err != nil {
+		return err
+	}
+	args := &redis.XAddArgs{Stream: s.stream, Values: []any{"reply", data}}
+	if s.maxLen > 0 {
+		args.MaxLen, args.Approx = s.maxLen, true
+	}
+	if err := s.client.XAdd(ctx, args).Err(); err != nil {
+		return fmt.Errorf("worker: adding to stream %s: %w", s.stream, err)
+	}
+	return nil
+}
+
+// Close implements Sink.
+func (s *RedisSink) Close() error {
+	return nil
+}
@@ -0,0 +1,114 @@
+package worker
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// fakeStream serves the entries of a stream to RedisSource and records RedisSink's XAdds.
+type fakeStream struct {
+	created int
+	claims  [][]redis.XMessage // returned by XAutoClaim in turn, then none
+	reads   [][]redis.XMessage // returned by XReadGroup in turn, then redis.Nil
+	starts  []string
+	acked   []string
+	added   []*redis.XAddArgs
+}
+
+func (f *fakeStream) XGroupCreateMkStream(ctx context.Context, stream, group, start string) *redis.StatusCmd {
+	cmd := redis.NewStatusCmd(ctx)
+	if f.created++; f.created > 1 {
+		cmd.SetErr(errors.New("BUSYGROUP Consumer Group name already exists"))
+	}
+	return cmd
+}
+
+func (f *fakeStream) XAutoClaim(ctx context.Context, a *redis.XAutoClaimArgs) *redis.XAutoClaimCmd {
+	f.starts = append(f.starts, a.Start)
+	cmd := redis.NewXAutoClaimCmd(ctx)
+	if len(f.claims) == 0 {
+		cmd.SetVal(nil, "0-0")
+		return cmd
+	}
+	claimed := f.claims[0]
+	f.claims = f.claims[1:]
+	cmd.SetVal(claimed, claimed[len(claimed)-1].ID)
+	return cmd
+}
+
+func (f *fakeStream) XReadGroup(ctx context.Context, a *redis.XReadGroupArgs) *redis.XStreamSliceCmd {
+	cmd := redis.NewXStreamSliceCmd(ctx)
+	if len(f.reads) == 0 {
+		cmd.SetErr(redis.Nil)
+		return cmd
+	}
+	cmd.SetVal([]redis.XStream{{Stream: a.Streams[0], Messages: f.reads[0]}})
+	f.reads = f.reads[1:]
+	return cmd
+}
+
+func (f *fakeStream) XAck(ctx context.Context, stream, group string, ids ...string) *redis.IntCmd {
+	f.acked = append(f.acked, ids...)
+	cmd := redis.NewIntCmd(ctx)
+	cmd.SetVal(int64(len(ids)))
+	return cmd
+}
+
+func (f *fakeStream) XAdd(ctx context.Context, a *redis.XAddArgs) *redis.StringCmd {
+	f.added = append(f.added, a)
+	return redis.NewStringCmd(ctx)
+}
+
+func entry(id, request string) redis.XMessage {
+	return redis.XMessage{ID: id, Values: map[string]any{"request": request}}
+}
+
+func TestRedisSource(t *testing.T) {
+	stream := &fakeStream{
+		claims: [][]redis.XMessage{{entry("1-0", `{"model": "a"}`)}},
+		reads:  [][]redis.XMessage{{entry("2-0", `{"model": "b"}`), entry("3-0", `{"model": "c"}`)}},
+	}
+	source := &RedisSource{client: stream, stream: "nexen-requests", group: "nexen-worker", consumer: "gw-1", claimFrom: "0-0"}
+	ctx := context.Background()
+
+	// The entries of stopped consumers come first
+	msgs, err := source.Receive(ctx, 10)
+	if err != nil || len(msgs) != 1 || msgs[0].ID != "1-0" || string(msgs[0].Body) != `{"model": "a"}` {
+		t.Fatalf("Expected the claimed entry, got %v, %v", msgs, err)
+	}
+	msgs, err = source.Receive(ctx, 10)
+	if err != nil || len(msgs) != 2 || msgs[1].ID != "3-0" {
+		t.Fatalf("Expected the new entries, got %v, %v", msgs, err)
+	}
+	if msgs, err := source.Receive(ctx, 10); err != nil || len(msgs) != 0 {
+		t.Errorf("Expected no entries, got %v, %v", msgs, err)
+	}
+	if stream.created != 1 || len(stream.starts) != 3 || stream.starts[1] != "1-0" {
+		t.Errorf("Expected the group to be created once and claims to resume, got %d %v", stream.created, stream.starts)
+	}
+
+	if err := source.Ack(ctx, msgs[0]); err != nil || len(stream.acked) != 1 || stream.acked[0] != "2-0" {
+		t.Errorf("Expected the entry to be acknowledged, got %v, %v", stream.acked, err)
+	}
+}
+
+func TestRedisSink(t *testing.T) {
+	stream := &fakeStream{}
+	sink := &RedisSink{client: stream, stream: "nexen-replies", maxLen: 1000}
+	if err := sink.Publish(context.Background(), Reply{RequestID: "enrich-1", MessageID: "1-0"}); err != nil {
+		t.Fatal(err)
+	}
+	args := stream.added[0]
+	values := args.Values.([]any)
+	var reply Reply
+	if err := json.Unmarshal(values[1].([]byte), &reply); err != nil || values[0] != "reply" || reply.RequestID != "enrich-1" {
+		t.Errorf("Unexpected values %v", values)
+	}
+	if args.Stream != "nexen-replies" || args.MaxLen != 1000 || !args.Approx {
+		t.Errorf("Expected the stream to be trimmed, got %+v", args)
+	}
+}
@@ -0,0 +1,242 @@
+// Package worker runs LLM requests consumed from a message queue and publishes their results
+// to a reply queue, for offline pipelines that send more requests than they would hold
+// connections open for.
+//
+// Requests come from a Source: a Redis stream read by a consumer group (RedisSource), or a
+// Kafka topic (package kafkaqueue). Each message holds the JSON of a models.LLMRequest, and its
+// Reply, with the response or the error, goes to a Sink once the request is done. Messages are
+// acknowledged only once their reply is published, so those of a worker that stops are
+// delivered again.
+package worker
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"time"
+
+	"github.com/nexen/models"
+	"github.com/nexen/services/connectors/common"
+)
+
+const (
+	// DefaultConcurrency is the number of requests run at once when Options.Concurrency is
+	// zero.
+	DefaultConcurrency = 8
+
+	// receiveBackoff is the wait after a Source fails to receive.
+	receiveBackoff = time.Second
+)
+
+// Error codes of replies, besides those of Options.ErrorCode.
+const (
+	CodeInvalidRequest = "invalid_request"
+	CodeError          = "error"
+)
+
+// Message is a request taken from a Source.
+type Message struct {
+	// ID identifies the message in its source, such as the ID of a stream entry.
+	ID string
+
+	// Body is the JSON of a models.LLMRequest.
+	Body []byte
+}
+
+// Source delivers the messages of a request queue.
+type Source interface {
+	// Receive waits for messages and returns up to max of them. It may return none when it
+	// has waited for a while, and returns ctx's error once ctx is done.
+	Receive(ctx context.Context, max int) ([]Message, error)
+
+	// Ack marks msg processed, so that it is not delivered again.
+	Ack(ctx context.Context, msg Message) error
+
+	// Close releases the resources of the source.
+	Close() error
+}
+
+// Sink publishes replies.
+type Sink interface {
+	// Publish adds reply to the reply queue.
+	Publish(ctx context.Context, reply Reply) error
+
+	// Close flushes pending replies and releases the resources of the sink.
+	Close() error
+}
+
+// Reply is the result of the request of a message: its response, or its error.
+type Reply struct {
+	// RequestID correlates the reply with its request: the request's metadata.requestId, or
+	// else the ID of its message.
+	RequestID string `json:"requestId"`
+	MessageID string `json:"messageId"`
+
+	Response *models.LLMResponse `json:"response,omitempty"`
+	Error    *Error              `json:"error,omitempty"`
+
+	// Time is when the request was done.
+	Time time.Time `json:"time"`
+}
+
+// Error is the error of a request that failed.
+type Error struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// Call makes an LLM call, such as with the client of the request's model.
+type Call func(ctx context.Context, request *models.LLMRequest) (*models.LLMResponse, error)
+
+// Options configures a Worker.
+type Options struct {
+	// Concurrency is the number of requests run at once. Zero means DefaultConcurrency.
+	Concurrency int
+
+	// RateLimit caps the requests and tokens run per minute; zero values are unlimited.
+	RateLimit common.RateLimit
+
+	// Timeout bounds each request. Zero leaves them unbounded.
+	Timeout time.Duration
+
+	// ErrorCode returns the code of the error a request failed with. Nil uses CodeError.
+	ErrorCode func(ctx context.Context, err error) string
+}
+
+// Worker runs the requests of a Source and publishes their replies to a Sink.
+type Worker struct {
+	source  Source
+	sink    Sink
+	call    Call
+	opts    Options
+	limiter *common.RateLimiter // nil without a rate limit
+
+	// now is replaceable in tests
+	now func() time.Time
+}
+
+// New returns a Worker running the requests of source with call and publishing their replies
+// to sink.
+func New(source Source, sink Sink, call Call, opts Options) *Worker {
+	if opts.Concurrency <= 0 {
+		opts.Concurrency = DefaultConcurrency
+	}
+	w := &Worker{source: source, sink: sink, call: call, opts: opts, now: time.Now}
+	if opts.RateLimit.Enabled() {
+		w.limiter = common.NewRateLimiter(opts.RateLimit)
+	}
+	return w
+}
+
+// Run receives and runs requests, Concurrency at a time, until ctx is done. It then stops
+// receiving, and returns once the requests in flight, which are canceled, have ended; their
+// messages are not acknowledged, to be delivered again.
+func (w *Worker) Run(ctx context.Context) {
+	slots := make(chan struct{}, w.opts.Concurrency)
+	defer func() {
+		// Wait for the requests in flight
+		for i := 0; i < cap(slots); i++ {
+			slots <- struct{}{}
+		}
+	}()
+	for {
+		// Receive as many messages as there are free slots, at least one
+		select {
+		case slots <- struct{}{}:
+		case <-ctx.Done():
+			return
+		}
+		free := 1
+	reserve:
+		for free < cap(slots) {
+			select {
+			case slots <- struct{}{}:
+				free++
+			default:
+				break reserve
+			}
+		}
+		msgs, err := w.source.Receive(ctx, free)
+		for i := len(msgs); i < free; i++ {
+			<-slots
+		}
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			slog.ErrorContext(ctx, "receiving requests", "error", err)
+			select {
+			case <-time.After(receiveBackoff):
+			case <-ctx.Done():
+				return
+			}
+		}
+		for _, msg := range msgs {
+			msg := msg
+			go func() {
+				defer func() { <-slots }()
+				w.process(ctx, msg)
+			}()
+		}
+	}
+}
+
+// process runs the request of msg, publishes its reply and acknowledges msg. A request cut
+// short by ctx being done is left to be delivered again.
+func (w *Worker) process(ctx context.Context, msg Message) {
+	reply := w.handle(ctx, msg)
+	if ctx.Err() != nil {
+		return
+	}
+	if err := w.sink.Publish(ctx, reply); err != nil {
+		slog.ErrorContext(ctx, "publishing reply", "message", msg.ID, "error", err)
+		return
+	}
+	if err := w.source.Ack(ctx, msg); err != nil {
+		slog.ErrorContext(ctx, "acknowledging request", "message", msg.ID, "error", err)
+	}
+}
+
+// handle runs the request of msg within the rate limit and returns its reply.
+func (w *Worker) handle(ctx context.Context, msg Message) Reply {
+	reply := Reply{RequestID: msg.ID, MessageID: msg.ID}
+	var request models.LLMRequest
+	err := json.Unmarshal(msg.Body, &request)
+	if err == nil {
+		if request.Metadata.RequestID != "" {
+			reply.RequestID = request.Metadata.RequestID
+		}
+		err = request.Validate()
+	}
+	if err != nil {
+		reply.Error = &Error{Code: CodeInvalidRequest, Message: err.Error()}
+		reply.Time = w.now()
+		return reply
+	}
+
+	estimated := common.EstimateTokens(&request)
+	if err := w.limiter.Wait(ctx, estimated); err != nil {
+		return reply
+	}
+	callCtx := ctx
+	if w.opts.Timeout > 0 {
+		var cancel context.CancelFunc
+		callCtx, cancel = context.WithTimeout(ctx, w.opts.Timeout)
+		defer cancel()
+	}
+	response, err := w.call(callCtx, &request)
+	if response != nil {
+		w.limiter.Adjust(response.Usage.TotalTokens - estimated)
+	}
+	reply.Time = w.now()
+	if err != nil {
+		code := CodeError
+		if w.opts.ErrorCode != nil {
+			code = w.opts.ErrorCode(callCtx, err)
+		}
+		reply.Error = &Error{Code: code, Message: err.Error()}
+		return reply
+	}
+	reply.Response = response
+	return reply
+}
@@ -0,0 +1,182 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/nexen/models"
+)
+
+// memQueue is a Source delivering its messages once, and a Sink collecting replies.
+type memQueue struct {
+	mu      sync.Mutex
+	msgs    []Message
+	acked   []string
+	replies []Reply
+	done    chan struct{} // closed once every message is acknowledged
+	total   int
+}
+
+func newMemQueue(msgs ...Message) *memQueue {
+	return &memQueue{msgs: msgs, done: make(chan struct{}), total: len(msgs)}
+}
+
+func (q *memQueue) Receive(ctx context.Context, max int) ([]Message, error) {
+	q.mu.Lock()
+	n := min(max, len(q.msgs))
+	msgs := q.msgs[:n]
+	q.msgs = q.msgs[n:]
+	q.mu.Unlock()
+	if n == 0 {
+		select {
+		case <-time.After(time.Millisecond):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	return msgs, nil
+}
+
+func (q *memQueue) Ack(ctx context.Context, msg Message) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.acked = append(q.acked, msg.ID)
+	if len(q.acked) == q.total {
+		close(q.done)
+	}
+	return nil
+}
+
+func (q *memQueue) Publish(ctx context.Context, reply Reply) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.replies = append(q.replies, reply)
+	return nil
+}
+
+func (q *memQueue) Close() error { return nil }
+
+// reply returns the reply of message id.
+func (q *memQueue) reply(id string) Reply {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for _, r := range q.replies {
+		if r.MessageID == id {
+			return r
+		}
+	}
+	return Reply{}
+}
+
+var errUnknownModel = errors.New("unknown model")
+
+// echo answers with the last message of the request, failing for the model "missing".
+func echo(ctx context.Context, request *models.LLMRequest) (*models.LLMResponse, error) {
+	if request.Model == "missing" {
+		return nil, errUnknownModel
+	}
+	message := request.Contents[len(request.Contents)-1].Message
+	return &models.LLMResponse{Content: &models.Content{Role: "assistant", Message: message}}, nil
+}
+
+func TestWorker(t *testing.T) {
+	q := newMemQueue(
+		Message{ID: "1-0", Body: []byte(`{"model": "echo", "contents": [{"role": "user", "message": "Hi"}], "metadata": {"requestId": "enrich-1"}}`)},
+		Message{ID: "2-0", Body: []byte(`{"model": "echo", "contents": [{"role": "user", "message": "Hello"}]}`)},
+		Message{ID: "3-0", Body: []byte(`{"model": "echo"`)},
+		Message{ID: "4-0", Body: []byte(`{"model": "missing", "contents": [{"role": "user", "message": "Hi"}]}`)},
+	)
+	w := New(q, q, echo, Options{Concurrency: 2, ErrorCode: func(ctx context.Context, err error) string {
+		if errors.Is(err, errUnknownModel) {
+			return "model_not_found"
+		}
+		return CodeError
+	}})
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan struct{})
+	go func() {
+		w.Run(ctx)
+		close(stopped)
+	}()
+	select {
+	case <-q.done:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Expected every message to be acknowledged, got %v", q.acked)
+	}
+	cancel()
+	<-stopped
+
+	if r := q.reply("1-0"); r.RequestID != "enrich-1" || r.Response == nil || r.Response.Content.Message != "Hi" || r.Time.IsZero() {
+		t.Errorf("Expected the response correlated by request ID, got %+v", r)
+	}
+	if r := q.reply("2-0"); r.RequestID != "2-0" || r.Response == nil || r.Response.Content.Message != "Hello" {
+		t.Errorf("Expected the response correlated by message ID, got %+v", r)
+	}
+	if r := q.reply("3-0"); r.Error == nil || r.Error.Code != CodeInvalidRequest || r.Response != nil {
+		t.Errorf("Expected an invalid request, got %+v", r)
+	}
+	if r := q.reply("4-0"); r.Error == nil || r.Error.Code != "model_not_found" {
+		t.Errorf("Expected the code of the call's error, got %+v", r)
+	}
+}
+
+func TestWorkerConcurrency(t *testing.T) {
+	var msgs []Message
+	for _, id := range []string{"1-0", "2-0", "3-0", "4-0", "5-0"} {
+		msgs = append(msgs, Message{ID: id, Body: []byte(`{"model": "echo", "contents": [{"role": "user", "message": "Hi"}]}`)})
+	}
+	q := newMemQueue(msgs...)
+	var mu sync.Mutex
+	inFlight, most := 0, 0
+	slow := func(ctx context.Context, request *models.LLMRequest) (*models.LLMResponse, error) {
+		mu.Lock()
+		inFlight++
+		most = max(most, inFlight)
+		mu.Unlock()
+		time.Sleep(10 * time.Millisecond)
+		mu.Lock()
+		inFlight--
+		mu.Unlock()
+		return echo(ctx, request)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go New(q, q, slow, Options{Concurrency: 2}).Run(ctx)
+	select {
+	case <-q.done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected every message to be acknowledged")
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if most != 2 {
+		t.Errorf("Expected 2 requests in flight at most, got %d", most)
+	}
+}
+
+func TestWorkerStops(t *testing.T) {
+	q := newMemQueue(Message{ID: "1-0", Body: []byte(`{"model": "echo", "contents": [{"role": "user", "message": "Hi"}]}`)})
+	started := make(chan struct{})
+	blocked := func(ctx context.Context, request *models.LLMRequest) (*models.LLMResponse, error) {
+		close(started)
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan struct{})
+	go func() {
+		New(q, q, blocked, Options{}).Run(ctx)
+		close(stopped)
+	}()
+	<-started
+	cancel()
+	<-stopped
+
+	// The request in flight is left to be delivered again
+	if len(q.acked) != 0 || len(q.replies) != 0 {
+		t.Errorf("Expected no reply nor acknowledgement, got %v %v", q.replies, q.acked)
+	}
+}
@@ -0,0 +1,80 @@
+package gateway
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/nexen/config"
+	"github.com/nexen/services/gateway/worker"
+)
+
+// messageQueue is a worker.Source delivering its messages once, and a worker.Sink sending
+// replies to a channel.
+type messageQueue struct {
+	mu      sync.Mutex
+	msgs    []worker.Message
+	replies chan worker.Reply
+}
+
+func (q *messageQueue) Receive(ctx context.Context, max int) ([]worker.Message, error) {
+	q.mu.Lock()
+	msgs := q.msgs
+	q.msgs = nil
+	q.mu.Unlock()
+	if len(msgs) == 0 {
+		select {
+		case <-time.After(time.Millisecond):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	return msgs, nil
+}
+
+func (q *messageQueue) Ack(ctx context.Context, msg worker.Message) error { return nil }
+
+func (q *messageQueue) Publish(ctx context.Context, reply worker.Reply) error {
+	q.replies <- reply
+	return nil
+}
+
+func (q *messageQueue) Close() error { return nil }
+
+func TestWorker(t *testing.T) {
+	q := &messageQueue{
+		msgs: []worker.Message{
+			{ID: "1-0", Body: []byte(`{"model": "echo", "contents": [{"role": "user", "message": "Hi"}]}`)},
+			{ID: "2-0", Body: []byte(`{"model": "unknown", "contents": [{"role": "user", "message": "Hi"}]}`)},
+		},
+		replies: make(chan worker.Reply, 2),
+	}
+	cfg := config.GatewayConfig{Worker: config.WorkerConfig{Enabled: true, Concurrency: 2, Timeout: time.Minute}}
+	s := New(&config.Config{Gateway: cfg}, Options{Clients: stubClients{"echo": &stubLLM{}}, Requests: q, Replies: q})
+
+	// The worker runs without REST or gRPC
+	ctx, cancel := context.WithCancel(context.Background())
+	served := make(chan error)
+	go func() { served <- s.Serve(ctx, nil, nil) }()
+	replies := make(map[string]worker.Reply)
+	for len(replies) < 2 {
+		select {
+		case reply := <-q.replies:
+			replies[reply.MessageID] = reply
+		case <-time.After(5 * time.Second):
+			t.Fatalf("Expected two replies, got %v", replies)
+		}
+	}
+	cancel()
+	if err := <-served; err != nil {
+		t.Errorf("Serve() error = %v", err)
+	}
+
+	if r := replies["1-0"]; r.Response == nil || r.Response.Content.Message != "Hi" {
+		t.Errorf("Expected the response, got %+v", r)
+	}
+	if r := replies["2-0"]; r.Error == nil || r.Error.Code != codeModelNotFound {
+		t.Errorf("Expected the gateway's error code, got %+v", r)
+	}
+}
@@ -0,0 +1,249 @@
+package usage
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nexen/config"
+	"github.com/nexen/libs/nexenctx"
+	"github.com/nexen/models"
+	"github.com/nexen/services/connectors/common"
+)
+
+// ErrBudgetExceeded marks requests rejected because their tenant reached a spend cap.
+var ErrBudgetExceeded = errors.New("budget exceeded")
+
+// BudgetError reports the cap a rejected request's tenant reached. It matches
+// ErrBudgetExceeded with errors.Is.
+type BudgetError struct {
+	Tenant     string
+	Window     Window
+	CapCents   float64
+	SpentCents float64
+}
+
+func (e *BudgetError) Error() string {
+	return fmt.Sprintf("budget exceeded: tenant %s spent %.2f of %.2f cents this %s", e.Tenant, e.SpentCents, e.CapCents, e.Window)
+}
+
+// Is reports whether target is ErrBudgetExceeded.
+func (e *BudgetError) Is(target error) bool {
+	return target == ErrBudgetExceeded
+}
+
+// Alert levels.
+const (
+	// AlertSoft is sent when spend reaches the soft limit of a cap.
+	AlertSoft = "soft"
+
+	// AlertHard is sent when spend reaches a cap.
+	AlertHard = "hard"
+)
+
+// alertKeyPrefix starts the keys marking alerts as sent.
+const alertKeyPrefix = KeyPrefix + "alert:"
+
+// DefaultSoftLimitPercent is the soft limit of budgets that do not set one.
+const DefaultSoftLimitPercent = 80
+
+// BudgetAlert is a warning that a tenant's spend reached a limit. Each alert is sent once per
+// tenant, window period and level.
+type BudgetAlert struct {
+	Tenant     string  `json:"tenant"`
+	Level      string  `json:"level"`
+	Window     Window  `json:"window"`
+	CapCents   float64 `json:"capCents"`
+	SpentCents float64 `json:"spentCents"`
+
+	// DowngradeModel is the model serving the tenant's requests after a hard limit, or empty
+	// when they are rejected.
+	DowngradeModel string `json:"downgradeModel,omitempty"`
+}
+
+// BudgetOptions configures the budget middleware.
+type BudgetOptions struct {
+	// Budgets maps tenants, in lower case, to their budgets, typically the budgets section
+	// of the configuration. Tenants without a budget are not limited.
+	Budgets map[string]config.BudgetConfig
+
+	// NewLLM creates the client of a budget's downgrade model, typically connectors.NewLLM.
+	// Without it, requests over a cap are rejected even when a downgrade model is set.
+	NewLLM func(model string) (common.LLM, error)
+
+	// Notify receives every alert, in addition to the log and the budget's webhook.
+	Notify func(ctx context.Context, alert BudgetAlert)
+}
+
+// Budget returns a common.Middleware that enforces the tenants' spend caps with the usage r
+// records. Requests of a tenant that reached a daily or monthly cap are sent to its downgrade
+// model or rejected with a *BudgetError. Spend is checked before each call, so concurrent
+// calls can take a tenant slightly over its cap.
+//
+// Place the middleware outside r.Middleware() so that the usage of each call is recorded
+// before the next is checked.
+func (r *Recorder) Budget(opts BudgetOptions) common.Middleware {
+	return func(next common.LLM) common.LLM {
+		return &budgetLLM{LLM: next, recorder: r, opts: opts, downgrades: make(map[string]common.LLM)}
+	}
+}
+
+// budgetLLM enforces budgets before calling the wrapped LLM.
+type budgetLLM struct {
+	common.LLM
+	recorder *Recorder
+	opts     BudgetOptions
+
+	mu         sync.Mutex
+	downgrades map[string]common.LLM // downgrade model -> client
+}
+
+// Call implements the LLM interface Call method.
+func (b *budgetLLM) Call(ctx context.Context, request *models.LLMRequest) (*models.LLMResponse, error) {
+	tenant := request.Metadata.TenantID
+	if tenant == "" {
+		tenant, _ = nexenctx.TenantFrom(ctx)
+	}
+	budget, ok := b.opts.Budgets[strings.ToLower(tenant)]
+	if !ok {
+		return b.LLM.Call(ctx, request)
+	}
+
+	exceeded, err := b.check(ctx, tenant, budget)
+	if err != nil {
+		// Accounting failures must not take the tenant offline
+		slog.WarnContext(ctx, "budget check failed", "tenant", tenant, "error", err)
+		return b.LLM.Call(ctx, request)
+	}
+	if exceeded == nil {
+		return b.LLM.Call(ctx, request)
+	}
+
+	if budget.DowngradeModel != "" && b.opts.NewLLM != nil {
+		llm, err := b.downgrade(budget.DowngradeModel)
+		if err == nil {
+			downgraded := *request
+			downgraded.Model = budget.DowngradeModel
+			return llm.Call(ctx, &downgraded)
+		}
+		slog.WarnContext(ctx, "budget downgrade failed", "tenant", tenant, "model", budget.DowngradeModel, "error", err)
+	}
+	return nil, exceeded
+}
+
+// BatchCall implements the LLM interface BatchCall method.
+func (b *budgetLLM) BatchCall(ctx context.Context, requests []*models.LLMRequest) ([]*models.LLMResponse, error) {
+	return common.BatchCall(ctx, requests, common.DefaultBatchConcurrency, b.Call)
+}
+
+// check compares the tenant's daily and monthly spend with its caps, sends the alerts due,
+// and returns the first cap reached.
+func (b *budgetLLM) check(ctx context.Context, tenant string, budget config.BudgetConfig) (*BudgetError, error) {
+	softPercent := budget.SoftLimitPercent
+	if softPercent == 0 {
+		softPercent = DefaultSoftLimitPercent
+	}
+
+	var exceeded *BudgetError
+	for _, limit := range []struct {
+		window Window
+		cap    float64
+	}{{WindowDay, budget.DailyCents}, {WindowMonth, budget.MonthlyCents}} {
+		if limit.cap <= 0 {
+			continue
+		}
+		spent, err := b.recorder.GetUsage(ctx, tenant, limit.window)
+		if err != nil {
+			return nil, err
+		}
+
+		alert := BudgetAlert{Tenant: tenant, Window: limit.window, CapCents: limit.cap, SpentCents: spent.CostCents}
+		switch {
+		case spent.CostCents >= limit.cap:
+			alert.Level = AlertHard
+			if b.opts.NewLLM != nil {
+				alert.DowngradeModel = budget.DowngradeModel
+			}
+			if exceeded == nil {
+				exceeded = &BudgetError{Tenant: tenant, Window: limit.window, CapCents: limit.cap, SpentCents: spent.CostCents}
+			}
+		case spent.CostCents >= limit.cap*float64(softPercent)/100:
+			alert.Level = AlertSoft
+		default:
+			continue
+		}
+		b.alert(ctx, spent, alert, budget.WebhookURL)
+	}
+	return exceeded, nil
+}
+
+// alert sends an alert unless it was already sent in the window period of spent.
+func (b *budgetLLM) alert(ctx context.Context, spent Usage, alert BudgetAlert, webhookURL string) {
+	// The marker expires with the period, so every replica sends each alert once per period
+	marker := alertKeyPrefix + url.QueryEscape(alert.Tenant) + ":" + string(alert.Window) + ":" + spent.Start.Format("2006010215") + ":" + alert.Level
+	first, err := b.recorder.store.SetNX(ctx, marker, []byte("1"), spent.End.Sub(b.recorder.now()))
+	if err != nil || !first {
+		return
+	}
+
+	slog.WarnContext(ctx, "budget limit reached", "tenant", alert.Tenant, "level", alert.Level, "window", alert.Window,
+		"cap_cents", alert.CapCents, "spent_cents", alert.SpentCents, "downgrade_model", alert.DowngradeModel)
+	if webhookURL != "" {
+		go postAlert(context.WithoutCancel(ctx), webhookURL, alert)
+	}
+	if b.opts.Notify != nil {
+		b.opts.Notify(ctx, alert)
+	}
+}
+
+// webhookTimeout bounds the delivery of an alert to a webhook.
+const webhookTimeout = 10 * time.Second
+
+// postAlert posts alert as JSON to webhookURL.
+func postAlert(ctx context.Context, webhookURL string, alert BudgetAlert) {
+	body, err := json.Marshal(alert)
+	if err != nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(ctx, webhookTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhookURL, bytes.NewReader(body))
+	if err != nil {
+		slog.WarnContext(ctx, "budget webhook failed", "url", webhookURL, "error", err)
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		slog.WarnContext(ctx, "budget webhook failed", "url", webhookURL, "error", err)
+		return
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		slog.WarnContext(ctx, "budget webhook failed", "url", webhookURL, "status", resp.Status)
+	}
+}
+
+// downgrade returns the client of model, creating it on first use. Its usage is recorded too.
+func (b *budgetLLM) downgrade(model string) (common.LLM, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if llm, ok := b.downgrades[model]; ok {
+		return llm, nil
+	}
+	llm, err := b.opts.NewLLM(model)
+	if err != nil {
+		return nil, err
+	}
+	llm = b.recorder.Middleware()(llm)
+	b.downgrades[model] = llm
+	return llm, nil
+}
@@ -0,0 +1,151 @@
+package usage
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nexen/config"
+)
+
+// USD is the currency costs are priced in.
+const USD = "USD"
+
+// RatesProvider returns exchange rates in units of each currency per US dollar, keyed by
+// ISO 4217 code.
+type RatesProvider interface {
+	Rates(ctx context.Context) (map[string]float64, error)
+}
+
+// StaticRates are fixed exchange rates.
+type StaticRates map[string]float64
+
+// Rates implements RatesProvider.
+func (r StaticRates) Rates(ctx context.Context) (map[string]float64, error) {
+	return r, nil
+}
+
+// HTTPRates fetches exchange rates from a URL serving {"rates": {"EUR": 0.92, ...}}.
+type HTTPRates struct {
+	URL string
+
+	// Client sends the requests; nil means http.DefaultClient.
+	Client *http.Client
+}
+
+// Rates implements RatesProvider.
+func (h HTTPRates) Rates(ctx context.Context) (map[string]float64, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, h.URL, nil)
+	if err != nil {
+		return nil, err
+	}
+	client := h.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("fetching exchange rates: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("fetching exchange rates: %s", resp.Status)
+	}
+	var body struct {
+		Rates map[string]float64 `json:"rates"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return nil, fmt.Errorf("decoding exchange rates: %w", err)
+	}
+	return body.Rates, nil
+}
+
+// Converter converts costs from US cents to other currencies, in hundredths of their unit. It
+// is safe for concurrent use.
+type Converter struct {
+	billing  string
+	static   map[string]float64
+	provider RatesProvider
+	refresh  time.Duration
+	now      func() time.Time
+
+	mu      sync.Mutex
+	fetched map[string]float64
+	expires time.Time
+}
+
+// NewConverter returns a Converter to the billing currency of cfg, at the rates provider
+// returns, or at the configured rates for currencies it has no rate for. A nil provider
+// fetches rates from cfg.RatesURL when set, and uses only the configured rates otherwise.
+func NewConverter(cfg config.CurrencyConfig, provider RatesProvider) *Converter {
+	if provider == nil && cfg.RatesURL != "" {
+		provider = HTTPRates{URL: cfg.RatesURL}
+	}
+	billing := strings.ToUpper(cfg.Billing)
+	if billing == "" {
+		billing = USD
+	}
+	static := make(map[string]float64, len(cfg.Rates))
+	for code, rate := range cfg.Rates {
+		static[strings.ToUpper(code)] = rate
+	}
+	return &Converter{billing: billing, static: static, provider: provider, refresh: cfg.RefreshInterval, now: time.Now}
+}
+
+// Billing returns the code of the billing currency.
+func (c *Converter) Billing() string {
+	return c.billing
+}
+
+// Rate returns the units of currency per US dollar. Rates are fetched at most once per refresh
+// interval; when fetching fails, the previous rates are used and the failure is logged.
+func (c *Converter) Rate(ctx context.Context, currency string) (float64, error) {
+	currency = strings.ToUpper(currency)
+	if currency == USD {
+		return 1, nil
+	}
+	if rate := c.fetchedRate(ctx, currency); rate > 0 {
+		return rate, nil
+	}
+	if rate := c.static[currency]; rate > 0 {
+		return rate, nil
+	}
+	return 0, fmt.Errorf("no exchange rate for %s", currency)
+}
+
+// fetchedRate returns the provider's rate for currency, or 0 when it has none.
+func (c *Converter) fetchedRate(ctx context.Context, currency string) float64 {
+	if c.provider == nil {
+		return 0
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if now := c.now(); !now.Before(c.expires) {
+		// Failed fetches are retried after the interval too, rather than on every call
+		c.expires = now.Add(c.refresh)
+		rates, err := c.provider.Rates(ctx)
+		if err != nil {
+			slog.WarnContext(ctx, "exchange rates refresh failed", "error", err)
+		} else {
+			c.fetched = make(map[string]float64, len(rates))
+			for code, rate := range rates {
+				c.fetched[strings.ToUpper(code)] = rate
+			}
+		}
+	}
+	return c.fetched[currency]
+}
+
+// Convert returns cents US cents in currency, in hundredths of its unit.
+func (c *Converter) Convert(ctx context.Context, cents float64, currency string) (float64, error) {
+	rate, err := c.Rate(ctx, currency)
+	if err != nil {
+		return 0, err
+	}
+	return cents * rate, nil
+}
@@ -0,0 +1,48 @@
+module github.com/nexen/services/usage
+
+go 1.21
+
+require (
+	github.com/nexen/config v0.0.0
+	github.com/nexen/libs/nexenctx v0.0.0
+	github.com/nexen/libs/store v0.0.0
+	github.com/nexen/models v0.0.0
+	github.com/nexen/services/connectors v0.0.0
+)
+
+require (
+	github.com/cespare/xxhash/v2 v2.2.0 // indirect
+	github.com/dgryski/go-rendezvous v0.0.0-20200823014737-9f7001d12a5f // indirect
+	github.com/fsnotify/fsnotify v1.6.0 // indirect
+	github.com/hashicorp/hcl v1.0.0 // indirect
+	github.com/magiconair/properties v1.8.7 // indirect
+	github.com/mattn/go-colorable v0.1.13 // indirect
+	github.com/mattn/go-isatty v0.0.19 // indirect
+	github.com/mitchellh/mapstructure v1.5.0 // indirect
+	github.com/nexen/libs/logging v0.0.0 // indirect
+	github.com/nexen/libs/redisx v0.0.0 // indirect
+	github.com/pelletier/go-toml/v2 v2.0.8 // indirect
+	github.com/redis/go-redis/v9 v9.7.0 // indirect
+	github.com/rs/zerolog v1.34.0 // indirect
+	github.com/spf13/afero v1.9.5 // indirect
+	github.com/spf13/cast v1.5.1 // indirect
+	github.com/spf13/jwalterweatherman v1.1.0 // indirect
+	github.com/spf13/pflag v1.0.5 // indirect
+	github.com/spf13/viper v1.16.0 // indirect
+	github.com/subosito/gotenv v1.4.2 // indirect
+	golang.org/x/sys v0.22.0 // indirect
+	golang.org/x/text v0.16.0 // indirect
+	gopkg.in/ini.v1 v1.67.0 // indirect
+	gopkg.in/yaml.v3 v3.0.1 // indirect
+)
+
+replace (
+	github.com/nexen/config => ../../config
+	github.com/nexen/libs/logging => ../../libs/logging
+	github.com/nexen/libs/nexenctx => ../../libs/nexenctx
+	github.com/nexen/libs/paging => ../../libs/paging
+	github.com/nexen/libs/redisx => ../../libs/redisx
+	github.com/nexen/libs/store => ../../libs/store
+	github.com/nexen/models => ../../models
+	github.com/nexen/services/connectors => ../connectors
+)
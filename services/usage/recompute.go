@@ -0,0 +1,220 @@
+package usage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/nexen/libs/store"
+	"github.com/nexen/models"
+)
+
+// Period is a time range, from Start inclusive to End exclusive.
+type Period struct {
+	Start time.Time
+	End   time.Time
+}
+
+// PeriodOf returns the period of the window containing t, such as the current month.
+func PeriodOf(window Window, t time.Time) Period {
+	start, end := bounds(window, t)
+	return Period{Start: start, End: end}
+}
+
+// RecomputeStats are the results of RecomputeCosts.
+type RecomputeStats struct {
+	// Windows is the number of per-model windows repriced.
+	Windows int64
+	// Updated is the number of per-model and all-model cost counters changed.
+	Updated int64
+	// DeltaCents is the change of the all-model cost totals.
+	DeltaCents float64
+	// Unpriced are the models without a registered price, whose costs were kept.
+	Unpriced []string
+}
+
+// group identifies the counters of one tenant, model and window.
+type group struct {
+	tenant string
+	model  string
+	window Window
+	start  time.Time
+}
+
+// priced is usage with its recomputed cost in micro-cents.
+type priced struct {
+	usage models.UsageMetrics
+	cost  int64
+}
+
+// RecomputeCosts reprices the recorded usage of the windows overlapping period at the prices
+// in effect at the time (see models.ImportPrices), so that cost reports stay correct after a
+// price changes mid-month or an earlier price is corrected. Hours are priced at their own
+// price; days and months sum their hours and days, and price the usage of expired shorter
+// windows at the price in effect at their start. The all-model totals are updated to match.
+//
+// Costs are adjusted by increments, so calls recorded during the recomputation are not lost.
+// The recorder's store must implement store.Scanner.
+func (r *Recorder) RecomputeCosts(ctx context.Context, period Period) (RecomputeStats, error) {
+	scanner, ok := r.store.(store.Scanner)
+	if !ok {
+		return RecomputeStats{}, errors.New("recomputing costs: store does not support scanning")
+	}
+
+	// Reprice whole months, so that every shorter window a total sums is known
+	span := Period{Start: PeriodOf(WindowMonth, period.Start).Start, End: PeriodOf(WindowMonth, period.End.Add(-time.Nanosecond)).End}
+	var groups []group
+	err := scanner.Scan(ctx, KeyPrefix, func(k string, _ time.Duration) error {
+		if g, ok := parseKey(k); ok && g.model != allModels && !g.start.Before(span.Start) && g.start.Before(span.End) {
+			groups = append(groups, g)
+		}
+		return nil
+	})
+	if err != nil {
+		return RecomputeStats{}, fmt.Errorf("recomputing costs: %w", err)
+	}
+
+	// Shorter windows first, so that longer ones can sum them
+	order := map[Window]int{WindowHour: 0, WindowDay: 1, WindowMonth: 2}
+	sort.Slice(groups, func(i, j int) bool {
+		if groups[i].window != groups[j].window {
+			return order[groups[i].window] < order[groups[j].window]
+		}
+		return groups[i].start.Before(groups[j].start)
+	})
+
+	var stats RecomputeStats
+	sums := make(map[group]priced) // longer window -> priced shorter windows
+	unpriced := make(map[string]bool)
+	totals := make(map[group]int64) // all-model window -> cost delta
+	for _, g := range groups {
+		if unpriced[g.model] {
+			continue
+		}
+		values, err := r.read(ctx, g.tenant, g.model, g.window, g.start)
+		if err != nil {
+			return stats, fmt.Errorf("recomputing costs: %w", err)
+		}
+		usage := usageMetrics(values)
+
+		// The usage not covered by the shorter windows is priced at the window's start
+		sum := sums[g]
+		cents, err := models.EstimateCostAt(g.model, subtract(usage, sum.usage), g.start)
+		if err != nil {
+			slog.WarnContext(ctx, "usage cost not recomputed", "model", g.model, "error", err)
+			unpriced[g.model] = true
+			stats.Unpriced = append(stats.Unpriced, g.model)
+			continue
+		}
+		cost := sum.cost + int64(math.Round(cents*microCents))
+		if longer, ok := longerWindow(g.window); ok {
+			parent := g
+			parent.window = longer
+			parent.start, _ = bounds(longer, g.start)
+			p := sums[parent]
+			p.usage = add(p.usage, usage)
+			p.cost += cost
+			sums[parent] = p
+		}
+
+		// Only the windows overlapping the period are written
+		if _, end := bounds(g.window, g.start); !end.After(period.Start) || !g.start.Before(period.End) {
+			continue
+		}
+		stats.Windows++
+		if delta := cost - values[fieldCost]; delta != 0 {
+			if _, err := r.store.IncrBy(ctx, key(g.tenant, g.model, g.window, g.start, fieldCost), delta, r.opts.TTLs[g.window]); err != nil {
+				return stats, fmt.Errorf("recomputing costs: %w", err)
+			}
+			stats.Updated++
+			total := g
+			total.model = allModels
+			totals[total] += delta
+		}
+	}
+
+	for total, delta := range totals {
+		if _, err := r.store.IncrBy(ctx, key(total.tenant, total.model, total.window, total.start, fieldCost), delta, r.opts.TTLs[total.window]); err != nil {
+			return stats, fmt.Errorf("recomputing costs: %w", err)
+		}
+		stats.Updated++
+		if total.window == WindowMonth {
+			stats.DeltaCents += float64(delta) / microCents
+		}
+	}
+	sort.Strings(stats.Unpriced)
+	return stats, nil
+}
+
+// parseKey returns the group of a request counter key, which every group has.
+func parseKey(k string) (group, bool) {
+	parts := strings.Split(strings.TrimPrefix(k, KeyPrefix), ":")
+	if len(parts) != 5 || parts[4] != fieldRequests {
+		return group{}, false
+	}
+	window := Window(parts[2])
+	if _, ok := defaultTTLs[window]; !ok {
+		return group{}, false
+	}
+	tenant, err := url.QueryUnescape(parts[0])
+	if err != nil {
+		return group{}, false
+	}
+	model, err := url.QueryUnescape(parts[1])
+	if err != nil {
+		return group{}, false
+	}
+	start, err := time.Parse("2006010215", parts[3])
+	if err != nil {
+		return group{}, false
+	}
+	return group{tenant: tenant, model: model, window: window, start: start}, true
+}
+
+// longerWindow returns the window that sums windows of kind window.
+func longerWindow(window Window) (Window, bool) {
+	switch window {
+	case WindowHour:
+		return WindowDay, true
+	case WindowDay:
+		return WindowMonth, true
+	}
+	return "", false
+}
+
+// usageMetrics converts window counters to the usage models.EstimateCostAt prices.
+func usageMetrics(values map[string]int64) models.UsageMetrics {
+	return models.UsageMetrics{
+		PromptTokens:           int(values[fieldPromptTokens]),
+		CompletionTokens:       int(values[fieldCompletionTokens]),
+		CachedPromptTokens:     int(values[fieldCachedTokens]),
+		CacheWritePromptTokens: int(values[fieldCacheWriteTokens]),
+		TotalTokens:            int(values[fieldPromptTokens] + values[fieldCompletionTokens]),
+	}
+}
+
+// add returns the sum of u and other.
+func add(u, other models.UsageMetrics) models.UsageMetrics {
+	u.PromptTokens += other.PromptTokens
+	u.CompletionTokens += other.CompletionTokens
+	u.CachedPromptTokens += other.CachedPromptTokens
+	u.CacheWritePromptTokens += other.CacheWritePromptTokens
+	u.TotalTokens += other.TotalTokens
+	return u
+}
+
+// subtract returns the usage of u not in sub, never below zero.
+func subtract(u, sub models.UsageMetrics) models.UsageMetrics {
+	u.PromptTokens = max(u.PromptTokens-sub.PromptTokens, 0)
+	u.CompletionTokens = max(u.CompletionTokens-sub.CompletionTokens, 0)
+	u.CachedPromptTokens = max(u.CachedPromptTokens-sub.CachedPromptTokens, 0)
+	u.CacheWritePromptTokens = max(u.CacheWritePromptTokens-sub.CacheWritePromptTokens, 0)
+	u.TotalTokens = u.PromptTokens + u.CompletionTokens
+	return u
+}
@@ -0,0 +1,293 @@
+// Package usage accounts for who spends what: it counts the requests, tokens and cost of
+// every LLM call per tenant and model, in hourly, daily and monthly windows.
+//
+// Counters live in a store.Store; with the Redis backend they are shared by every replica and
+// survive restarts. A Recorder's middleware records each call made through a connector, and
+// GetUsage and Query read the counters back.
+package usage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/nexen/libs/nexenctx"
+	"github.com/nexen/libs/store"
+	"github.com/nexen/models"
+	"github.com/nexen/services/connectors/common"
+)
+
+// Window is the period usage is counted over. Windows are aligned to UTC.
+type Window string
+
+const (
+	WindowHour  Window = "hour"
+	WindowDay   Window = "day"
+	WindowMonth Window = "month"
+)
+
+// Windows are all the windows usage is counted in.
+var Windows = []Window{WindowHour, WindowDay, WindowMonth}
+
+// KeyPrefix starts the keys of every usage counter, as expected by the default usage rule of
+// the store retention janitor.
+const KeyPrefix = "usage:"
+
+// allModels stands for the total over every model in counter keys.
+const allModels = "*"
+
+// Default counter lifetimes, counted from the first call of a window.
+var defaultTTLs = map[Window]time.Duration{
+	WindowHour:  7 * 24 * time.Hour,
+	WindowDay:   400 * 24 * time.Hour,
+	WindowMonth: 0, // kept until the retention janitor removes it
+}
+
+// microCents converts cost to the integer unit of the cost counters.
+const microCents = 1e6
+
+// Counter fields of a window.
+const (
+	fieldRequests         = "requests"
+	fieldPromptTokens     = "prompt_tokens"
+	fieldCompletionTokens = "completion_tokens"
+	fieldCachedTokens     = "cached_prompt_tokens"
+	fieldCacheWriteTokens = "cache_write_prompt_tokens"
+	fieldCost             = "cost_ucents"
+)
+
+var fields = []string{fieldRequests, fieldPromptTokens, fieldCompletionTokens, fieldCachedTokens, fieldCacheWriteTokens, fieldCost}
+
+// Usage is the usage of a tenant, on one model or all of them, during one window.
+type Usage struct {
+	Tenant string    `json:"tenant"`
+	Model  string    `json:"model,omitempty"` // empty for all models
+	Window Window    `json:"window"`
+	Start  time.Time `json:"start"`
+	End    time.Time `json:"end"`
+
+	Requests         int64   `json:"requests"`
+	PromptTokens     int64   `json:"promptTokens"`
+	CompletionTokens int64   `json:"completionTokens"`
+	CostCents        float64 `json:"costCents"`
+
+	// CachedPromptTokens and CacheWritePromptTokens are the parts of PromptTokens read from
+	// and written to the provider's prompt cache, which RecomputeCosts prices separately.
+	CachedPromptTokens     int64 `json:"cachedPromptTokens,omitempty"`
+	CacheWritePromptTokens int64 `json:"cacheWritePromptTokens,omitempty"`
+
+	// BillingCurrency and BillingCostCents report CostCents in the billing currency of the
+	// Recorder's Converter, in hundredths of its unit, at the current exchange rate.
+	BillingCurrency  string  `json:"billingCurrency,omitempty"`
+	BillingCostCents float64 `json:"billingCostCents,omitempty"`
+}
+
+// TotalTokens returns the prompt and completion tokens used.
+func (u Usage) TotalTokens() int64 {
+	return u.PromptTokens + u.CompletionTokens
+}
+
+// Query selects the usage to read.
+type Query struct {
+	Tenant string
+
+	// Model is the model to report; empty means all models.
+	Model string
+
+	Window Window
+
+	// At is a time in the window to report; zero means now.
+	At time.Time
+}
+
+// Options configures a Recorder.
+type Options struct {
+	// TTLs overrides how long the counters of each window are kept.
+	TTLs map[Window]time.Duration
+
+	// Currency converts reported costs to the billing currency. Without it, costs are reported
+	// in US cents only.
+	Currency *Converter
+}
+
+// Recorder records and reports usage. It is safe for concurrent use.
+type Recorder struct {
+	store store.Store
+	opts  Options
+	now   func() time.Time
+}
+
+// NewRecorder returns a Recorder keeping its counters in s.
+func NewRecorder(s store.Store, opts Options) *Recorder {
+	ttls := make(map[Window]time.Duration, len(defaultTTLs))
+	for window, ttl := range defaultTTLs {
+		ttls[window] = ttl
+	}
+	for window, ttl := range opts.TTLs {
+		ttls[window] = ttl
+	}
+	opts.TTLs = ttls
+	return &Recorder{store: s, opts: opts, now: time.Now}
+}
+
+// Record adds one call's usage to the tenant's counters for model and for all models, in
+// every window.
+func (r *Recorder) Record(ctx context.Context, tenant, model string, u models.UsageMetrics) error {
+	now := r.now()
+	values := map[string]int64{
+		fieldRequests:         1,
+		fieldPromptTokens:     int64(u.PromptTokens),
+		fieldCompletionTokens: int64(u.CompletionTokens),
+		fieldCachedTokens:     int64(u.CachedPromptTokens),
+		fieldCacheWriteTokens: int64(u.CacheWritePromptTokens),
+		fieldCost:             int64(math.Round(u.CostCents * microCents)),
+	}
+	for _, window := range Windows {
+		start, _ := bounds(window, now)
+		for _, m := range []string{model, allModels} {
+			for _, field := range fields {
+				if values[field] == 0 {
+					continue
+				}
+				if _, err := r.store.IncrBy(ctx, key(tenant, m, window, start, field), values[field], r.opts.TTLs[window]); err != nil {
+					return fmt.Errorf("recording usage: %w", err)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// GetUsage returns the tenant's usage over all models in the current window.
+func (r *Recorder) GetUsage(ctx context.Context, tenant string, window Window) (Usage, error) {
+	return r.Query(ctx, Query{Tenant: tenant, Window: window})
+}
+
+// Query returns the usage selected by q.
+func (r *Recorder) Query(ctx context.Context, q Query) (Usage, error) {
+	if _, ok := defaultTTLs[q.Window]; !ok {
+		return Usage{}, fmt.Errorf("unknown usage window %q", q.Window)
+	}
+	at := q.At
+	if at.IsZero() {
+		at = r.now()
+	}
+	start, end := bounds(q.Window, at)
+	model := q.Model
+	if model == "" {
+		model = allModels
+	}
+
+	values, err := r.read(ctx, q.Tenant, model, q.Window, start)
+	if err != nil {
+		return Usage{}, err
+	}
+	u := Usage{
+		Tenant:                 q.Tenant,
+		Model:                  q.Model,
+		Window:                 q.Window,
+		Start:                  start,
+		End:                    end,
+		Requests:               values[fieldRequests],
+		PromptTokens:           values[fieldPromptTokens],
+		CompletionTokens:       values[fieldCompletionTokens],
+		CachedPromptTokens:     values[fieldCachedTokens],
+		CacheWritePromptTokens: values[fieldCacheWriteTokens],
+		CostCents:              float64(values[fieldCost]) / microCents,
+	}
+	if c := r.opts.Currency; c != nil {
+		// A missing rate must not hide the usage, which is still reported in US cents
+		if cost, err := c.Convert(ctx, u.CostCents, c.Billing()); err == nil {
+			u.BillingCurrency, u.BillingCostCents = c.Billing(), cost
+		} else {
+			slog.WarnContext(ctx, "usage cost conversion failed", "currency", c.Billing(), "error", err)
+		}
+	}
+	return u, nil
+}
+
+// read returns the counters of one window by field; missing counters are zero.
+func (r *Recorder) read(ctx context.Context, tenant, model string, window Window, start time.Time) (map[string]int64, error) {
+	values := make(map[string]int64, len(fields))
+	for _, field := range fields {
+		// Reading a counter with IncrBy(0) would create it, so read it as a value
+		data, err := r.store.Get(ctx, key(tenant, model, window, start, field))
+		if errors.Is(err, store.ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("reading usage: %w", err)
+		}
+		if values[field], err = strconv.ParseInt(string(data), 10, 64); err != nil {
+			return nil, fmt.Errorf("reading usage: %w", err)
+		}
+	}
+	return values, nil
+}
+
+// Middleware returns a common.Middleware that records the usage of every successful call.
+// Recording failures are logged and do not fail the call.
+func (r *Recorder) Middleware() common.Middleware {
+	return func(next common.LLM) common.LLM {
+		return &recordingLLM{LLM: next, recorder: r}
+	}
+}
+
+// recordingLLM records the usage of the wrapped LLM's responses.
+type recordingLLM struct {
+	common.LLM
+	recorder *Recorder
+}
+
+// Call implements the LLM interface Call method.
+func (l *recordingLLM) Call(ctx context.Context, request *models.LLMRequest) (*models.LLMResponse, error) {
+	response, err := l.LLM.Call(ctx, request)
+	if err != nil || response == nil || response.IsError() {
+		return response, err
+	}
+
+	model := request.Model
+	if namer, ok := l.LLM.(common.ModelNamer); ok && model == "" {
+		model = namer.Model()
+	}
+	tenant := request.Metadata.TenantID
+	if tenant == "" {
+		tenant, _ = nexenctx.TenantFrom(ctx)
+	}
+	if err := l.recorder.Record(ctx, tenant, model, response.Usage); err != nil {
+		slog.WarnContext(ctx, "usage accounting failed", "tenant", tenant, "model", model, "error", err)
+	}
+	return response, nil
+}
+
+// BatchCall implements the LLM interface BatchCall method.
+func (l *recordingLLM) BatchCall(ctx context.Context, requests []*models.LLMRequest) ([]*models.LLMResponse, error) {
+	return common.BatchCall(ctx, requests, common.DefaultBatchConcurrency, l.Call)
+}
+
+// bounds returns the start and end of the window containing t.
+func bounds(window Window, t time.Time) (time.Time, time.Time) {
+	t = t.UTC()
+	switch window {
+	case WindowHour:
+		start := t.Truncate(time.Hour)
+		return start, start.Add(time.Hour)
+	case WindowDay:
+		start := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+		return start, start.AddDate(0, 0, 1)
+	default:
+		start := time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+		return start, start.AddDate(0, 1, 0)
+	}
+}
+
+// key returns the key of one counter: usage:{tenant}:{model}:{window}:{start}:{field}.
+func key(tenant, model string, window Window, start time.Time, field string) string {
+	return KeyPrefix + url.QueryEscape(tenant) + ":" + url.QueryEscape(model) + ":" + string(window) + ":" +
+		start.Format("2006010215") + ":" + field
+}
@@ -0,0 +1,261 @@
+package usage
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/nexen/config"
+	"github.com/nexen/libs/nexenctx"
+	"github.com/nexen/libs/store"
+	"github.com/nexen/models"
+	"github.com/nexen/services/connectors/common"
+)
+
+// fixedLLM answers every call with the same usage.
+type fixedLLM struct {
+	usage models.UsageMetrics
+}
+
+func (f *fixedLLM) Call(ctx context.Context, request *models.LLMRequest) (*models.LLMResponse, error) {
+	return &models.LLMResponse{Usage: f.usage}, nil
+}
+
+func (f *fixedLLM) BatchCall(ctx context.Context, requests []*models.LLMRequest) ([]*models.LLMResponse, error) {
+	return nil, nil
+}
+
+func (f *fixedLLM) SupportedModels() []string {
+	return nil
+}
+
+func TestRecorder(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2026, 10, 16, 9, 30, 0, 0, time.UTC)
+	recorder := NewRecorder(store.NewMemory(), Options{})
+	recorder.now = func() time.Time { return now }
+
+	llm := recorder.Middleware()(&fixedLLM{usage: models.UsageMetrics{PromptTokens: 100, CompletionTokens: 20, TotalTokens: 120, CostCents: 0.35}})
+	acme := nexenctx.WithTenant(ctx, "acme")
+	llm.Call(acme, &models.LLMRequest{Model: "gpt-4o"})
+	llm.Call(acme, &models.LLMRequest{Model: "claude-3-sonnet"})
+	// The request's metadata takes precedence over the context
+	llm.Call(acme, &models.LLMRequest{Model: "gpt-4o", Metadata: models.RequestMetadata{TenantID: "globex"}})
+
+	day, err := recorder.GetUsage(ctx, "acme", WindowDay)
+	if err != nil {
+		t.Fatalf("GetUsage() error = %v", err)
+	}
+	if day.Requests != 2 || day.PromptTokens != 200 || day.TotalTokens() != 240 || math.Abs(day.CostCents-0.7) > 1e-9 {
+		t.Errorf("Unexpected daily usage %+v", day)
+	}
+	if !day.Start.Equal(time.Date(2026, 10, 16, 0, 0, 0, 0, time.UTC)) || !day.End.Equal(day.Start.AddDate(0, 0, 1)) {
+		t.Errorf("Unexpected day bounds %v to %v", day.Start, day.End)
+	}
+
+	model, _ := recorder.Query(ctx, Query{Tenant: "acme", Model: "gpt-4o", Window: WindowMonth})
+	if model.Requests != 1 || model.CompletionTokens != 20 {
+		t.Errorf("Unexpected monthly gpt-4o usage %+v", model)
+	}
+	if globex, _ := recorder.GetUsage(ctx, "globex", WindowHour); globex.Requests != 1 {
+		t.Errorf("Expected one call for globex, got %+v", globex)
+	}
+
+	// The next hour starts a new hourly window within the same day
+	now = now.Add(time.Hour)
+	hour, _ := recorder.GetUsage(ctx, "acme", WindowHour)
+	day, _ = recorder.GetUsage(ctx, "acme", WindowDay)
+	if hour.Requests != 0 || day.Requests != 2 {
+		t.Errorf("Expected an empty hour and an unchanged day, got %d and %d", hour.Requests, day.Requests)
+	}
+	past, _ := recorder.Query(ctx, Query{Tenant: "acme", Window: WindowHour, At: now.Add(-time.Hour)})
+	if past.Requests != 2 {
+		t.Errorf("Expected the previous hour's usage, got %+v", past)
+	}
+
+	if _, err := recorder.GetUsage(ctx, "acme", "week"); err == nil {
+		t.Error("Expected an error for an unknown window")
+	}
+}
+
+func TestBudget(t *testing.T) {
+	ctx := context.Background()
+	recorder := NewRecorder(store.NewMemory(), Options{})
+
+	var alerts []BudgetAlert
+	hook := make(chan BudgetAlert, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var alert BudgetAlert
+		json.NewDecoder(r.Body).Decode(&alert)
+		hook <- alert
+	}))
+	defer server.Close()
+
+	var downgradedTo []string
+	budget := recorder.Budget(BudgetOptions{
+		Budgets: map[string]config.BudgetConfig{
+			"acme":   {DailyCents: 1, WebhookURL: server.URL},
+			"globex": {MonthlyCents: 1, DowngradeModel: "gpt-4o-mini"},
+		},
+		NewLLM: func(model string) (common.LLM, error) {
+			downgradedTo = append(downgradedTo, model)
+			return &fixedLLM{}, nil
+		},
+		Notify: func(ctx context.Context, alert BudgetAlert) { alerts = append(alerts, alert) },
+	})
+	llm := budget(recorder.Middleware()(&fixedLLM{usage: models.UsageMetrics{PromptTokens: 100, CostCents: 0.45}}))
+	acme := &models.LLMRequest{Model: "gpt-4o", Metadata: models.RequestMetadata{TenantID: "Acme"}}
+
+	// 0, 0.45 and 0.9 cents spent: the third call passes the soft limit
+	for i := 0; i < 3; i++ {
+		if _, err := llm.Call(ctx, acme); err != nil {
+			t.Fatalf("Call %d error = %v", i, err)
+		}
+	}
+	if len(alerts) != 1 || alerts[0].Level != AlertSoft || alerts[0].Window != WindowDay {
+		t.Fatalf("Expected one soft alert, got %+v", alerts)
+	}
+	if alert := <-hook; alert.Level != AlertSoft || alert.Tenant != "Acme" {
+		t.Errorf("Unexpected webhook alert %+v", alert)
+	}
+
+	// 1.35 cents spent: rejected, and the hard alert is sent once
+	for i := 0; i < 2; i++ {
+		if _, err := llm.Call(ctx, acme); !errors.Is(err, ErrBudgetExceeded) {
+			t.Fatalf("Expected ErrBudgetExceeded, got %v", err)
+		}
+	}
+	if len(alerts) != 2 || alerts[1].Level != AlertHard {
+		t.Errorf("Expected one hard alert, got %+v", alerts)
+	}
+	<-hook
+
+	// Over its monthly cap, globex is served by its downgrade model
+	globex := &models.LLMRequest{Model: "gpt-4o", Metadata: models.RequestMetadata{TenantID: "globex"}}
+	for i := 0; i < 5; i++ {
+		if _, err := llm.Call(ctx, globex); err != nil {
+			t.Fatalf("Call error = %v", err)
+		}
+	}
+	if len(downgradedTo) != 1 || downgradedTo[0] != "gpt-4o-mini" {
+		t.Errorf("Expected one downgrade client, got %v", downgradedTo)
+	}
+	if usage, _ := recorder.Query(ctx, Query{Tenant: "globex", Model: "gpt-4o-mini", Window: WindowMonth}); usage.Requests != 2 {
+		t.Errorf("Expected the downgraded calls to be recorded, got %+v", usage)
+	}
+
+	// Tenants without a budget are not limited
+	if _, err := llm.Call(ctx, &models.LLMRequest{Model: "gpt-4o"}); err != nil {
+		t.Errorf("Call error = %v", err)
+	}
+}
+
+func TestRecomputeCosts(t *testing.T) {
+	ctx := context.Background()
+	models.NewModelInfo(models.ModelInfo{ID: "repriced-model", InputCostPerMTok: 3, OutputCostPerMTok: 15}, "^repriced-model$")
+	backend := store.NewMemory()
+	recorder := NewRecorder(backend, Options{})
+	now := time.Date(2026, 10, 10, 9, 0, 0, 0, time.UTC)
+	recorder.now = func() time.Time { return now }
+
+	// Both calls were recorded at a stale price of 1 cent
+	million := models.UsageMetrics{PromptTokens: 1000000, CostCents: 1}
+	recorder.Record(ctx, "acme", "repriced-model", million)
+	recorder.Record(ctx, "acme", "unpriced-model", million)
+	now = time.Date(2026, 10, 20, 9, 0, 0, 0, time.UTC)
+	recorder.Record(ctx, "acme", "repriced-model", million)
+
+	// The hourly counters of the first call have expired
+	for _, field := range fields {
+		backend.Delete(ctx, key("acme", "repriced-model", WindowHour, time.Date(2026, 10, 10, 9, 0, 0, 0, time.UTC), field))
+	}
+
+	err := models.ImportPrices(models.PriceSheet{Prices: []models.PriceSheetEntry{{Model: "repriced-model", EffectiveFrom: "2026-10-15", InputCostPerMTok: 2, OutputCostPerMTok: 10}}})
+	if err != nil {
+		t.Fatalf("ImportPrices() error = %v", err)
+	}
+	stats, err := recorder.RecomputeCosts(ctx, PeriodOf(WindowMonth, now))
+	if err != nil {
+		t.Fatalf("RecomputeCosts() error = %v", err)
+	}
+	if len(stats.Unpriced) != 1 || stats.Unpriced[0] != "unpriced-model" || math.Abs(stats.DeltaCents-498) > 1e-9 {
+		t.Errorf("Unexpected stats %+v", stats)
+	}
+
+	// 300 cents before the price change and 200 after it
+	for _, tt := range []struct {
+		q    Query
+		want float64
+	}{
+		{Query{Tenant: "acme", Model: "repriced-model", Window: WindowMonth}, 500},
+		{Query{Tenant: "acme", Model: "repriced-model", Window: WindowDay, At: time.Date(2026, 10, 10, 0, 0, 0, 0, time.UTC)}, 300},
+		{Query{Tenant: "acme", Model: "repriced-model", Window: WindowHour}, 200},
+		{Query{Tenant: "acme", Model: "unpriced-model", Window: WindowMonth}, 1},
+		{Query{Tenant: "acme", Window: WindowMonth}, 501},
+	} {
+		if got, _ := recorder.Query(ctx, tt.q); math.Abs(got.CostCents-tt.want) > 1e-9 {
+			t.Errorf("Query(%+v) cost = %v, want %v", tt.q, got.CostCents, tt.want)
+		}
+	}
+
+	// Recomputing again changes nothing
+	if stats, _ := recorder.RecomputeCosts(ctx, PeriodOf(WindowMonth, now)); stats.Updated != 0 {
+		t.Errorf("Expected no updates, got %+v", stats)
+	}
+}
+
+func TestConverter(t *testing.T) {
+	ctx := context.Background()
+	fetches, fail := 0, false
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetches++
+		if fail {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte(`{"rates": {"EUR": 0.9}}`))
+	}))
+	defer server.Close()
+
+	// Keys are configured in lower case, as viper reads them
+	converter := NewConverter(config.CurrencyConfig{
+		Billing:         "eur",
+		Rates:           map[string]float64{"eur": 0.8, "gbp": 0.75},
+		RatesURL:        server.URL,
+		RefreshInterval: time.Hour,
+	}, nil)
+	now := time.Date(2026, 10, 16, 9, 0, 0, 0, time.UTC)
+	converter.now = func() time.Time { return now }
+
+	if got, _ := converter.Convert(ctx, 100, converter.Billing()); converter.Billing() != "EUR" || math.Abs(got-90) > 1e-9 {
+		t.Errorf("Expected 90 EUR cents at the fetched rate, got %v %s", got, converter.Billing())
+	}
+	if got, _ := converter.Convert(ctx, 100, "GBP"); math.Abs(got-75) > 1e-9 {
+		t.Errorf("Expected 75 GBP pence at the configured rate, got %v", got)
+	}
+	if _, err := converter.Convert(ctx, 100, "JPY"); err == nil {
+		t.Error("Expected an error for a currency without a rate")
+	}
+	if fetches != 1 {
+		t.Errorf("Expected one fetch within the refresh interval, got %d", fetches)
+	}
+
+	// A failed refresh keeps the previous rates
+	fail = true
+	now = now.Add(time.Hour)
+	if rate, err := converter.Rate(ctx, "EUR"); err != nil || rate != 0.9 || fetches != 2 {
+		t.Errorf("Expected the previous rate after a failed refresh, got %v, %v after %d fetches", rate, err, fetches)
+	}
+
+	recorder := NewRecorder(store.NewMemory(), Options{Currency: converter})
+	recorder.Record(ctx, "acme", "gpt-4o", models.UsageMetrics{PromptTokens: 10, CostCents: 2})
+	usage, _ := recorder.GetUsage(ctx, "acme", WindowDay)
+	if usage.BillingCurrency != "EUR" || math.Abs(usage.BillingCostCents-1.8) > 1e-9 || usage.CostCents != 2 {
+		t.Errorf("Unexpected billing cost %+v", usage)
+	}
+}